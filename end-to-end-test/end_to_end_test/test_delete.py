@@ -93,8 +93,7 @@ if __name__ == "__main__":
         ).stdout
     )
     assert len(experiments) == 1
-    # TODO(bfirsh): checkpoint metadata is no longer deleted, so check that checkout fails
-    assert experiments[0]["num_checkpoints"] == 3
+    assert experiments[0]["num_checkpoints"] == 2
     assert not path_exists(repository, checkpoint_storage_path)
 
     experiment_id = experiments[0]["id"]
@@ -120,3 +119,24 @@ if __name__ == "__main__":
     )
     assert len(experiments) == 0
     assert not path_exists(repository, experiment_storage_path)
+
+    # Removed experiments are in the trash, and can be restored
+    subprocess.run(
+        ["replicate", "restore", experiment_id],
+        cwd=tmpdir,
+        env=env,
+        check=True,
+    )
+
+    experiments = json.loads(
+        subprocess.run(
+            ["replicate", "list", "--json"],
+            cwd=tmpdir,
+            env=env,
+            capture_output=True,
+            check=True,
+        ).stdout
+    )
+    assert len(experiments) == 1
+    assert experiments[0]["num_checkpoints"] == 2
+    assert path_exists(repository, experiment_storage_path)
@@ -0,0 +1,103 @@
+// Package chunk splits data into content-defined chunks, using the FastCDC
+// algorithm (https://www.usenix.org/conference/atc16/technical-sessions/presentation/xia).
+//
+// Chunk boundaries depend on the bytes around them rather than their offset,
+// so inserting or changing bytes in a file only changes the chunks around the
+// change. The rest of the chunks are the same as before, so they don't need to
+// be stored again.
+package chunk
+
+import (
+	"io"
+)
+
+const (
+	// MinSize is the smallest a chunk can be, except the last one
+	MinSize = 512 * 1024
+	// AvgSize is the size chunks are normalized towards
+	AvgSize = 2 * 1024 * 1024
+	// MaxSize is the largest a chunk can be
+	MaxSize = 8 * 1024 * 1024
+)
+
+// Boundaries are where the top bits of the fingerprint are zero. Before
+// AvgSize the mask has more bits so boundaries are less likely, and after it
+// fewer, which pulls chunk sizes towards AvgSize ("normalized chunking").
+const (
+	maskSmall = uint64(1<<23-1) << (64 - 23)
+	maskLarge = uint64(1<<19-1) << (64 - 19)
+)
+
+// gear is the table of random values the rolling fingerprint is made from.
+// It must never change, or the chunks of the same data would change too.
+var gear [256]uint64
+
+func init() {
+	// splitmix64, so the table is the same on every platform
+	seed := uint64(0x7265706c69636174) // "replicat"
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Split reads r to the end, calling fn with each chunk in order. The slice
+// passed to fn is reused, so fn must copy it if it keeps it after returning.
+func Split(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, MaxSize)
+	n := 0
+	eof := false
+	for {
+		if !eof {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		// The buffer is only partly full at the end of r, so a boundary
+		// can always be found in a full buffer
+		cut := boundary(buf[:n])
+		if err := fn(buf[:cut]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[cut:n])
+	}
+}
+
+// boundary returns the length of the first chunk in data
+func boundary(data []byte) int {
+	if len(data) <= MinSize {
+		return len(data)
+	}
+	if len(data) > MaxSize {
+		data = data[:MaxSize]
+	}
+	normal := AvgSize
+	if len(data) < normal {
+		normal = len(data)
+	}
+	var fp uint64
+	i := MinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(data); i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,53 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func split(t *testing.T, data []byte) [][32]byte {
+	hashes := [][32]byte{}
+	joined := []byte{}
+	err := Split(bytes.NewReader(data), func(chunk []byte) error {
+		require.True(t, len(chunk) <= MaxSize)
+		hashes = append(hashes, sha256.Sum256(chunk))
+		joined = append(joined, chunk...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, data, joined)
+	return hashes
+}
+
+func TestSplit(t *testing.T) {
+	data := make([]byte, 32*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	original := split(t, data)
+	require.True(t, len(original) > 4)
+
+	// Inserting and changing bytes only changes the chunks around them
+	edited := append([]byte("hello"), data...)
+	edited[20*1024*1024] ^= 1
+	seen := map[[32]byte]bool{}
+	for _, hash := range original {
+		seen[hash] = true
+	}
+	changed := 0
+	for _, hash := range split(t, edited) {
+		if !seen[hash] {
+			changed++
+		}
+	}
+	require.True(t, changed <= 4, "%d of %d chunks changed", changed, len(original))
+}
+
+func TestSplitSmall(t *testing.T) {
+	require.Empty(t, split(t, []byte{}))
+	require.Len(t, split(t, []byte("hello")), 1)
+	// Data without any boundaries is split at MaxSize
+	require.Len(t, split(t, make([]byte, 2*MaxSize+1)), 3)
+}
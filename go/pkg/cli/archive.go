@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type archiveOpts struct {
+	repositoryURL string
+	storageClass  string
+}
+
+func newArchiveCommand() *cobra.Command {
+	var opts archiveOpts
+
+	cmd := &cobra.Command{
+		Use:   "archive <experiment ID...>",
+		Short: "Move the files of experiments to cold storage",
+		Long: `Move the files of experiments to cold storage.
+
+The files of the experiments and their checkpoints are moved to an archive storage class, which is much cheaper to keep them in: GLACIER on S3, and ARCHIVE on Google Cloud Storage, unless --storage-class says otherwise. Their metadata is left where it is, so 'replicate ls' and 'replicate show' still show them, with the status "archived".
+
+Checking out an archived experiment or checkpoint restores its files first, if the storage class needs it. S3 Glacier restores usually take 3-5 hours. Files in Google Cloud Storage's archive classes can be read straight away, but reading them costs more.
+
+Chunks and large files are left where they are, because other checkpoints might share them. Running experiments can't be archived.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return archiveExperiments(opts, args)
+		}),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeIDs,
+		Example: `Archive an experiment that has finished:
+replicate archive a1b2c3d4
+
+Move an experiment's files to S3 Glacier Deep Archive:
+replicate archive a1b2c3d4 --storage-class DEEP_ARCHIVE`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.storageClass, "storage-class", "", "The storage class to move files to. Defaults to GLACIER on S3 and ARCHIVE on Google Cloud Storage")
+
+	return cmd
+}
+
+func archiveExperiments(opts archiveOpts, prefixes []string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	experiments := []*project.Experiment{}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		experiments = append(experiments, exp)
+	}
+	for _, exp := range experiments {
+		console.Info("Archiving experiment %s...", exp.ShortID())
+		files, err := proj.ArchiveExperiment(exp, opts.storageClass)
+		if err != nil {
+			return err
+		}
+		console.Info("Moved %d files of experiment %s to %s", files, exp.ShortID(), exp.Archived.StorageClass)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type auditOpts struct {
+	repositoryURL string
+	limit         int
+	json          bool
+}
+
+func newAuditCommand() *cobra.Command {
+	var opts auditOpts
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the log of changes to the repository",
+		Long: `Show the log of changes to the repository.
+
+Every time experiments are created, removed, restored from the trash or pruned, who did it, when, with which command, and to which experiments and checkpoints are recorded in the "` + project.AuditDir + `" directory of the repository. This shows the most recent records, oldest first.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return showAuditLog(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().IntVarP(&opts.limit, "limit", "n", 50, "Number of records to show. 0 shows all of them")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print output in JSON format")
+
+	return cmd
+}
+
+func showAuditLog(opts auditOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	records, err := proj.AuditLog(opts.limit)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(out, "The audit log is empty.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "TIME\tUSER\tOPERATION\tOBJECTS\tCOMMAND\n")
+	for _, r := range records {
+		user := r.User
+		if r.Host != "" {
+			user += "@" + r.Host
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Time.In(timezone).Format("2006-01-02 15:04:05"), user, r.Operation, formatAuditObjects(r), r.Command)
+	}
+	return tw.Flush()
+}
+
+// maxAuditCheckpoints is how many checkpoint IDs are shown in a record
+// before they are counted instead
+const maxAuditCheckpoints = 3
+
+// formatAuditObjects returns a short description of what a record is about,
+// e.g. "experiment 1eeeeee, 5 checkpoints"
+func formatAuditObjects(r *project.AuditRecord) string {
+	parts := []string{}
+	for _, id := range r.Experiments {
+		parts = append(parts, "experiment "+shortID(id))
+	}
+	if len(r.Checkpoints) > maxAuditCheckpoints {
+		parts = append(parts, fmt.Sprintf("%d checkpoints", len(r.Checkpoints)))
+	} else {
+		for _, id := range r.Checkpoints {
+			parts = append(parts, "checkpoint "+shortID(id))
+		}
+	}
+	parts = append(parts, r.Paths...)
+	return strings.Join(parts, ", ")
+}
+
+func shortID(id string) string {
+	if len(id) > 7 {
+		return id[:7]
+	}
+	return id
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestFormatAuditObjects(t *testing.T) {
+	require.Equal(t, "experiment 1eeeeee, checkpoint 1cccccc", formatAuditObjects(&project.AuditRecord{
+		Experiments: []string{"1eeeeeeeee"},
+		Checkpoints: []string{"1ccccccccc"},
+	}))
+	require.Equal(t, "experiment 1eeeeee, 4 checkpoints", formatAuditObjects(&project.AuditRecord{
+		Experiments: []string{"1eeeeeeeee"},
+		Checkpoints: []string{"1ccccccccc", "2ccccccccc", "3ccccccccc", "4ccccccccc"},
+	}))
+	require.Equal(t, "checkpoints/1ccccccccc.tar.gz", formatAuditObjects(&project.AuditRecord{
+		Paths: []string{"checkpoints/1ccccccccc.tar.gz"},
+	}))
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/chunk"
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type benchmarkOpts struct {
+	repositoryURL string
+	concurrency   []int
+	sizeMB        int
+	objects       int
+	smallObjects  int
+}
+
+func newBenchmarkCommand() *cobra.Command {
+	var opts benchmarkOpts
+
+	cmd := &cobra.Command{
+		Use:   "benchmark",
+		Short: "Measure how fast the repository is, and suggest settings to make it faster",
+		Long: `Measure how fast the repository is, and suggest settings to make it faster.
+
+This uploads and downloads large objects to measure throughput, and puts and gets small objects to measure latency, at each level of concurrency. The objects are written to a "benchmark/" directory in the repository, which is deleted afterwards.
+
+Replicate transfers up to 128 files at once. To change this, set the REPLICATE_MAX_WORKERS environment variable.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return benchmark(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Benchmark with larger objects, and more concurrency:
+replicate benchmark --size-mb 64 --concurrency 16,64,256`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().IntSliceVar(&opts.concurrency, "concurrency", []int{1, 4, 16, 64}, "Numbers of transfers to run at once")
+	cmd.Flags().IntVar(&opts.sizeMB, "size-mb", 8, "Size in megabytes of the objects used to measure throughput")
+	cmd.Flags().IntVar(&opts.objects, "objects", 8, "Number of large objects to transfer at each level of concurrency, or the concurrency if that is more")
+	cmd.Flags().IntVar(&opts.smallObjects, "small-objects", 100, "Number of small objects to transfer at each level of concurrency")
+
+	return cmd
+}
+
+func benchmark(opts benchmarkOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	// Use the repository directly, not the metadata cache, so we measure the storage
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+
+	console.Info("Benchmarking %s...", repo.RootURL())
+	results, err := repository.Benchmark(repo, repository.BenchmarkOptions{
+		Concurrency:     opts.concurrency,
+		LargeObjectSize: int64(opts.sizeMB) * 1024 * 1024,
+		LargeObjects:    opts.objects,
+		SmallObjects:    opts.smallObjects,
+		Progress: func(s string) {
+			console.Info("%s", s)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONCURRENCY\tUPLOAD\tDOWNLOAD\tPUT LATENCY\tGET LATENCY\tSMALL PUTS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%.0f/s\n",
+			r.Concurrency,
+			formatThroughput(r.UploadThroughput),
+			formatThroughput(r.DownloadThroughput),
+			r.PutLatency.Round(time.Millisecond),
+			r.GetLatency.Round(time.Millisecond),
+			r.SmallObjectsPerSecond)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	for _, suggestion := range benchmarkSuggestions(results, repository.MaxWorkers(), chunkingMinFileSizeMB()) {
+		fmt.Fprintf(out, "* %s\n", suggestion)
+	}
+	return nil
+}
+
+// chunkingMinFileSizeMB returns the chunking size threshold in replicate.yaml,
+// or the default if there is no replicate.yaml, such as when --repository is
+// passed outside a project
+func chunkingMinFileSizeMB() int {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil || conf.Chunking == nil {
+		return config.DefaultChunkingMinFileSizeMB
+	}
+	return int(conf.Chunking.MinFileSize() / 1024 / 1024)
+}
+
+// benchmarkSuggestions returns advice on REPLICATE_MAX_WORKERS and
+// chunking.min_file_size_mb, based on the results of a benchmark
+func benchmarkSuggestions(results []repository.BenchmarkResult, maxWorkers int, minFileSizeMB int) []string {
+	if len(results) == 0 {
+		return nil
+	}
+	suggestions := []string{}
+
+	// The best concurrency is the lowest that gets close to the fastest
+	// upload, because more connections cost more for little gain
+	var fastest float64
+	highest := results[0].Concurrency
+	for _, r := range results {
+		if r.UploadThroughput > fastest {
+			fastest = r.UploadThroughput
+		}
+		if r.Concurrency > highest {
+			highest = r.Concurrency
+		}
+	}
+	best := highest
+	for _, r := range results {
+		if r.UploadThroughput >= fastest*0.95 && r.Concurrency < best {
+			best = r.Concurrency
+		}
+	}
+	slowerAboveBest := false
+	for _, r := range results {
+		if r.Concurrency > best && r.UploadThroughput < fastest*0.9 {
+			slowerAboveBest = true
+		}
+	}
+	switch {
+	case slowerAboveBest && best < maxWorkers:
+		suggestions = append(suggestions, fmt.Sprintf("Uploads were fastest at concurrency %d, and slowed down above it. Set REPLICATE_MAX_WORKERS=%d to transfer fewer files at once (currently %d).", best, best, maxWorkers))
+	case best == highest && len(results) > 1:
+		suggestions = append(suggestions, fmt.Sprintf("Uploads were still getting faster at concurrency %d, the highest tested. Try higher levels with --concurrency to find the best value for REPLICATE_MAX_WORKERS (currently %d).", highest, maxWorkers))
+	default:
+		suggestions = append(suggestions, fmt.Sprintf("REPLICATE_MAX_WORKERS (currently %d) doesn't need changing.", maxWorkers))
+	}
+
+	// Chunks are uploaded a few at a time, so with a slow round trip they
+	// can't keep up with uploading whole files in parallel. Estimate the time
+	// to upload a chunk from the lowest concurrency, which is closest to a
+	// single connection.
+	lowest := results[0]
+	for _, r := range results {
+		if r.Concurrency < lowest.Concurrency {
+			lowest = r
+		}
+	}
+	perStream := lowest.UploadThroughput / float64(lowest.Concurrency)
+	if perStream <= 0 {
+		return suggestions
+	}
+	chunkSeconds := lowest.PutLatency.Seconds() + chunk.AvgSize/perStream
+	chunked := float64(project.MaxChunkWorkers) * chunk.AvgSize / chunkSeconds
+	if chunked > fastest {
+		chunked = fastest
+	}
+	if chunked < fastest/2 {
+		suggestions = append(suggestions, fmt.Sprintf("Chunked files would upload at about %s, compared to %s for whole files, because only %d chunks are uploaded at once. If large files in your checkpoints are usually rewritten completely, set chunking.min_file_size_mb in replicate.yaml higher than %d, such as %d, so fewer files are chunked.", formatThroughput(chunked), formatThroughput(fastest), project.MaxChunkWorkers, minFileSizeMB, minFileSizeMB*4))
+	} else {
+		suggestions = append(suggestions, fmt.Sprintf("Chunked files should upload at close to full speed, so chunking.min_file_size_mb (currently %d) doesn't need changing.", minFileSizeMB))
+	}
+	return suggestions
+}
+
+// formatThroughput formats bytes per second for humans, e.g. "1.5 MB/s"
+func formatThroughput(bytesPerSecond float64) string {
+	return formatBytes(int64(bytesPerSecond)) + "/s"
+}
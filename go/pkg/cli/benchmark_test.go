@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestBenchmarkSuggestions(t *testing.T) {
+	const mb = 1000 * 1000
+
+	// Fastest at 16, and slower above it
+	suggestions := benchmarkSuggestions([]repository.BenchmarkResult{
+		{Concurrency: 1, UploadThroughput: 50 * mb, PutLatency: 5 * time.Millisecond},
+		{Concurrency: 4, UploadThroughput: 180 * mb, PutLatency: 5 * time.Millisecond},
+		{Concurrency: 16, UploadThroughput: 400 * mb, PutLatency: 5 * time.Millisecond},
+		{Concurrency: 64, UploadThroughput: 300 * mb, PutLatency: 5 * time.Millisecond},
+	}, 128, 64)
+	require.Equal(t, []string{
+		"Uploads were fastest at concurrency 16, and slowed down above it. Set REPLICATE_MAX_WORKERS=16 to transfer fewer files at once (currently 128).",
+		"Chunked files should upload at close to full speed, so chunking.min_file_size_mb (currently 64) doesn't need changing.",
+	}, suggestions)
+
+	// Still getting faster, with a slow round trip
+	suggestions = benchmarkSuggestions([]repository.BenchmarkResult{
+		{Concurrency: 1, UploadThroughput: 10 * mb, PutLatency: 200 * time.Millisecond},
+		{Concurrency: 4, UploadThroughput: 40 * mb, PutLatency: 200 * time.Millisecond},
+		{Concurrency: 16, UploadThroughput: 160 * mb, PutLatency: 200 * time.Millisecond},
+	}, 128, 64)
+	require.Len(t, suggestions, 2)
+	require.Equal(t, "Uploads were still getting faster at concurrency 16, the highest tested. Try higher levels with --concurrency to find the best value for REPLICATE_MAX_WORKERS (currently 128).", suggestions[0])
+	require.Contains(t, suggestions[1], "set chunking.min_file_size_mb in replicate.yaml higher than 64, such as 256")
+
+	// Levels off, so the lowest concurrency close to the fastest is fine
+	suggestions = benchmarkSuggestions([]repository.BenchmarkResult{
+		{Concurrency: 1, UploadThroughput: 500 * mb},
+		{Concurrency: 4, UploadThroughput: 510 * mb},
+	}, 128, 64)
+	require.Equal(t, "REPLICATE_MAX_WORKERS (currently 128) doesn't need changing.", suggestions[0])
+}
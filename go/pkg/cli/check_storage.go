@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type checkStorageOpts struct {
+	repositoryURL string
+	sizeMB        int
+}
+
+func newCheckStorageCommand() *cobra.Command {
+	var opts checkStorageOpts
+
+	cmd := &cobra.Command{
+		Use:   "check-storage",
+		Short: "Check that the repository can be written to, read, listed and deleted from",
+		Long: `Check that the repository can be written to, read, listed and deleted from.
+
+This writes objects to a "check-storage/" directory in the repository, reads them back, lists them and deletes them, and shows how long each operation took. Run it before a long training run to make sure your credentials allow everything Replicate needs to do, including deleting, which 'replicate rm' and 'replicate prune' need.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return checkStorage(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().IntVar(&opts.sizeMB, "size-mb", 8, "Size in megabytes of the object used to measure throughput")
+
+	return cmd
+}
+
+func checkStorage(opts checkStorageOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	// Use the repository directly, not the metadata cache, so we check the storage
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+
+	console.Info("Checking %s...", repo.RootURL())
+	checks, err := repository.CheckStorage(repo, int64(opts.sizeMB)*1024*1024)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	return printStorageChecks(out, getAurora(), checks)
+}
+
+func printStorageChecks(out io.Writer, au aurora.Aurora, checks []*repository.StorageCheck) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tRESULT\tTIME\tTHROUGHPUT")
+	failed := []*repository.StorageCheck{}
+	for _, check := range checks {
+		result := au.Green("ok").String()
+		if check.Error != nil {
+			result = au.Red("failed").String()
+			failed = append(failed, check)
+		}
+		throughput := ""
+		if check.Throughput() > 0 {
+			throughput = formatThroughput(check.Throughput())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", check.Operation, result, check.Duration.Round(time.Millisecond), throughput)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(failed) == 0 {
+		fmt.Fprintln(out, "\nThe repository is ready to use.")
+		return nil
+	}
+	for _, check := range failed {
+		fmt.Fprintf(out, "\n%s %s failed: %s\n", au.Red("✗"), check.Operation, check.Error)
+		if errors.Code(check.Error) == errors.CodeRepositoryCredentialsError {
+			fmt.Fprintf(out, "Your credentials don't allow this. Check they have permission to %s objects in the repository.\n", check.Operation)
+		}
+	}
+	fmt.Fprintln(out)
+	return fmt.Errorf("%d of %d checks failed", len(failed), len(checks))
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+	"github.com/replicate/replicate/go/pkg/testutil"
+)
+
+func TestPrintStorageChecks(t *testing.T) {
+	au := aurora.NewAurora(false)
+	out := new(bytes.Buffer)
+	err := printStorageChecks(out, au, []*repository.StorageCheck{
+		{Operation: "write", Duration: 20 * time.Millisecond},
+		{Operation: "upload", Duration: 2 * time.Second, Bytes: 8 * 1000 * 1000},
+		{Operation: "delete", Duration: 10 * time.Millisecond, Error: errors.RepositoryCredentialsError("Access denied")},
+	})
+	require.EqualError(t, err, "1 of 3 checks failed")
+	expected := `
+OPERATION  RESULT  TIME  THROUGHPUT
+write      ok      20ms
+upload     ok      2s    4.0 MB/s
+delete     failed  10ms
+
+✗ delete failed: Access denied
+Your credentials don't allow this. Check they have permission to delete objects in the repository.
+
+`
+	require.Equal(t, expected[1:], testutil.TrimRightLines(out.String()))
+
+	out = new(bytes.Buffer)
+	require.NoError(t, printStorageChecks(out, au, []*repository.StorageCheck{
+		{Operation: "write", Duration: 20 * time.Millisecond},
+	}))
+	require.Contains(t, out.String(), "The repository is ready to use.")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
@@ -18,6 +19,13 @@ type checkoutOpts struct {
 	force           bool
 	repositoryURL   string
 	checkoutPath    string
+	dvc             bool
+	trees           []string
+	pointers        bool
+	all             bool
+	filters         []string
+	parallelism     int
+	strict          bool
 }
 
 func newCheckoutCommand() *cobra.Command {
@@ -26,16 +34,42 @@ func newCheckoutCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "checkout <experiment or checkpoint ID>",
 		Short: "Copy files from an experiment or checkpoint into the project directory",
+		Long: `Copy files from an experiment or checkpoint into the project directory.
+
+With --all, the best or latest checkpoint of every experiment that matches the filters passed with --filter is checked out, each into a directory named after its experiment's ID in the output directory. Several are downloaded at once, and files they have in common are only downloaded once.
+
+If the operating system, CUDA version or Python version of this machine differ from the ones the experiment ran on in ways that are likely to stop its models loading, there is a warning. With --strict, nothing is checked out instead.`,
 		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			if opts.all {
+				return checkoutAll(opts)
+			}
 			return checkoutCheckpoint(opts, args)
 		}),
-		Args: cobra.ExactArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		ValidArgsFunction: completeNIDs(1),
+		Example: `Check out the code of a checkpoint, without downloading its weights and artifacts:
+replicate checkout --tree code 3ccc
+
+Check out the weights of every experiment with a learning rate of 0.01, to evaluate them:
+replicate checkout --all --filter "learning_rate = 0.01" --tree weights -o models/`,
 	}
 
 	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
 	cmd.Flags().StringVarP(&opts.outputDirectory, "output-directory", "o", "", "Output directory (defaults to working directory or directory with replicate.yaml in it)")
 	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Force checkout without prompt, even if the directory is not empty")
 	cmd.Flags().StringVarP(&opts.checkoutPath, "path", "", "", "A specific file or directory to checkout (defaults to all files or directory in checkpoint/experiment)")
+	cmd.Flags().StringSliceVar(&opts.trees, "tree", nil, "Only check out these trees of the checkpoint: code, weights or artifacts (defaults to all of them)")
+	cmd.Flags().BoolVar(&opts.pointers, "pointers", false, "Check out pointer files in place of large files, without downloading them")
+	cmd.Flags().BoolVar(&opts.dvc, "dvc", false, "Also pull the versions of DVC-tracked data that the experiment used, with 'dvc pull'")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "Check out every experiment that matches --filter, into a directory for each in the output directory")
+	cmd.Flags().StringArrayVar(&opts.filters, "filter", nil, "With --all, only check out experiments that match these filters, like in 'replicate ls' (format: \"<name> <operator> <value>\")")
+	cmd.Flags().IntVarP(&opts.parallelism, "parallelism", "j", 4, "With --all, the number of experiments to check out at once")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Don't check out if this machine's OS, CUDA version or Python version differ from the ones the experiment ran on")
 
 	return cmd
 }
@@ -71,6 +105,28 @@ func getExperimentAndCheckpoint(prefix string, proj *project.Project, projectDir
 	return experiment, checkpoint, nil
 }
 
+// checkHostEnvironment warns about the differences between the machines
+// experiments ran on and this one that are likely to stop their models
+// loading. With strict, they are an error instead.
+func checkHostEnvironment(experiments []*project.Experiment, strict bool) error {
+	current := project.CurrentHostEnvironment()
+	pythonVersion := project.CurrentPythonVersion()
+	mismatches := []string{}
+	for _, exp := range experiments {
+		mismatches = append(mismatches, project.HostEnvironmentMismatches(exp, current, pythonVersion)...)
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("Not checking out, because --strict is set and this machine doesn't match the one the experiment ran on:\n\n- %s", strings.Join(mismatches, "\n- "))
+	}
+	for _, mismatch := range mismatches {
+		console.Warn("%s", mismatch)
+	}
+	return nil
+}
+
 // Handle errors related to the outputDir
 func validateOrCreateOutputDir(outputDir string) error {
 	exists, err := files.FileExists(outputDir)
@@ -143,10 +199,18 @@ func checkoutCheckpoint(opts checkoutOpts, args []string) error {
 	}
 
 	proj := project.NewProject(repo, projectDir)
+	proj.SetWaitForRestore(true)
+	if err := proj.SetCheckoutTrees(opts.trees); err != nil {
+		return err
+	}
+	proj.SetCheckoutPointers(opts.pointers)
 	experiment, checkpoint, err := getExperimentAndCheckpoint(prefix, proj, projectDir)
 	if err != nil {
 		return err
 	}
+	if err := checkHostEnvironment([]*project.Experiment{experiment}, opts.strict); err != nil {
+		return err
+	}
 
 	outputDir := opts.outputDirectory
 	if outputDir == "" {
@@ -178,8 +242,20 @@ func checkoutCheckpoint(opts checkoutOpts, args []string) error {
 
 	checkoutPath := opts.checkoutPath
 	if checkoutPath == "" {
-		return proj.CheckoutCheckpoint(checkpoint, experiment, outputDir, false)
+		err = proj.CheckoutCheckpoint(checkpoint, experiment, outputDir, false)
 	} else {
-		return proj.CheckoutFileOrDirectory(checkpoint, experiment, outputDir, checkoutPath)
+		err = proj.CheckoutFileOrDirectory(checkpoint, experiment, outputDir, checkoutPath)
 	}
+	if err != nil {
+		return err
+	}
+
+	if opts.dvc {
+		if len(experiment.DVCOutputs) == 0 {
+			console.Warn("Experiment %s did not record any DVC outputs", experiment.ShortID())
+			return nil
+		}
+		return project.PullDVCOutputs(experiment, outputDir)
+	}
+	return nil
 }
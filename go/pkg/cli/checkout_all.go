@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/cli/list"
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+// checkoutTarget is an experiment, and the checkpoint of it, to check out
+// into dir
+type checkoutTarget struct {
+	experiment *project.Experiment
+	checkpoint *project.Checkpoint
+	dir        string
+}
+
+// replicate CLI `checkout --all` command
+func checkoutAll(opts checkoutOpts) error {
+	if opts.outputDirectory == "" {
+		return fmt.Errorf("Pass the directory to check the experiments out into with --output-directory")
+	}
+	if opts.checkoutPath != "" || opts.dvc {
+		return fmt.Errorf("--path and --dvc can't be used with --all")
+	}
+	if opts.parallelism < 1 {
+		return fmt.Errorf("--parallelism must be at least 1")
+	}
+	filters, err := param.MakeFilters(opts.filters)
+	if err != nil {
+		return err
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetWaitForRestore(true)
+	if err := proj.SetCheckoutTrees(opts.trees); err != nil {
+		return err
+	}
+	proj.SetCheckoutPointers(opts.pointers)
+
+	targets, err := getCheckoutTargets(proj, filters, opts.outputDirectory)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		console.Info("No experiments found")
+		return nil
+	}
+	experiments := []*project.Experiment{}
+	for _, target := range targets {
+		experiments = append(experiments, target.experiment)
+	}
+	if err := checkHostEnvironment(experiments, opts.strict); err != nil {
+		return err
+	}
+	if !opts.force {
+		for _, target := range targets {
+			if err := checkEmptyDir(target.dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	cacheDir, err := files.TempDir("checkout-cache")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cacheDir)
+	cache := project.NewCheckoutCache(cacheDir)
+	proj.SetCheckoutCache(cache)
+
+	console.Info("Checking out %d experiments into %s...", len(targets), opts.outputDirectory)
+	// Experiments that fail to check out don't stop the others, so one
+	// missing file doesn't throw away everything else that was downloaded
+	var mu sync.Mutex
+	failed := 0
+	queue := concurrency.NewWorkerQueue(context.Background(), opts.parallelism)
+	for _, target := range targets {
+		target := target
+		_ = queue.Go(func() error {
+			err := checkoutTargetDir(proj, target)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				console.Error("Failed to check out experiment %s: %s", target.experiment.ShortID(), err)
+				return nil
+			}
+			if target.checkpoint != nil {
+				console.Info("Checked out checkpoint %s of experiment %s to %s", target.checkpoint.ShortID(), target.experiment.ShortID(), target.dir)
+			} else {
+				console.Info("Checked out experiment %s to %s", target.experiment.ShortID(), target.dir)
+			}
+			return nil
+		})
+	}
+	if err := queue.Wait(); err != nil {
+		return err
+	}
+
+	if hits := cache.Hits(); hits > 0 {
+		console.Info("%d downloads were shared between checkpoints, so were only done once", hits)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to check out %d of %d experiments", failed, len(targets))
+	}
+	return nil
+}
+
+// getCheckoutTargets returns the best or latest checkpoint of each
+// experiment that matches filters, and the directory in outputDir to check it
+// out into
+func getCheckoutTargets(proj *project.Project, filters *param.Filters, outputDir string) ([]*checkoutTarget, error) {
+	listExperiments, err := list.FilterExperiments(proj, filters)
+	if err != nil {
+		return nil, err
+	}
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	experimentsByID := map[string]*project.Experiment{}
+	for _, exp := range experiments {
+		experimentsByID[exp.ID] = exp
+	}
+	targets := []*checkoutTarget{}
+	for _, listExp := range listExperiments {
+		exp := experimentsByID[listExp.ID]
+		checkpoint := bestOrLatestCheckpoint(exp)
+		if checkpoint == nil && exp.Path == "" {
+			console.Warn("Skipping experiment %s, because it doesn't have any files", exp.ShortID())
+			continue
+		}
+		targets = append(targets, &checkoutTarget{
+			experiment: exp,
+			checkpoint: checkpoint,
+			dir:        filepath.Join(outputDir, exp.ShortID()),
+		})
+	}
+	return targets, nil
+}
+
+// checkoutTargetDir checks out target into its directory. If it creates the
+// directory and the checkout fails, the directory is removed, so a partial
+// checkout isn't mistaken for a whole one.
+func checkoutTargetDir(proj *project.Project, target *checkoutTarget) error {
+	exists, err := files.FileExists(target.dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target.dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %q: %w", target.dir, err)
+	}
+	if err := proj.CheckoutCheckpoint(target.checkpoint, target.experiment, target.dir, true); err != nil {
+		if !exists {
+			os.RemoveAll(target.dir)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkEmptyDir returns an error if dir exists and has files in it
+func checkEmptyDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s already has files in it. Pass --force to check out over them.", dir)
+	}
+	return nil
+}
@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/replicate/go/pkg/config"
 	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
 	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
 	"github.com/replicate/replicate/go/pkg/repository"
 )
 
@@ -28,7 +31,8 @@ func addRepositoryURLFlagVar(cmd *cobra.Command, opt *string) {
 }
 
 // getRepositoryURLFromStringOrConfig attempts to get it from passed string from --repository,
-// otherwise finds replicate.yaml recursively.
+// otherwise finds replicate.yaml recursively and uses the repository named with
+// --repository-name, or the default repository.
 // The project directory is determined by the following logic:
 // * If an explicit directory is passed with -D, that is used
 // * Else, if repository URL isn't manually passed with -R, the directory of replicate.yaml is used
@@ -36,13 +40,17 @@ func addRepositoryURLFlagVar(cmd *cobra.Command, opt *string) {
 // Returns (repositoryURL, projectDir, error)
 func getRepositoryURLFromStringOrConfig(repositoryURL string) (string, string, error) {
 	projectDir := global.ProjectDirectory
+	if repositoryURL != "" && global.RepositoryName != "" {
+		return "", "", fmt.Errorf("--repository and --repository-name cannot both be passed")
+	}
 	if repositoryURL == "" {
 		conf, confProjectDir, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
 		if err != nil {
 			return "", "", err
 		}
-		if repositoryURL == "" {
-			repositoryURL = conf.Repository
+		repositoryURL, err = conf.RepositoryURL(global.RepositoryName)
+		if err != nil {
+			return "", "", err
 		}
 		if global.ProjectDirectory == "" {
 			projectDir = confProjectDir
@@ -88,6 +96,22 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 	}
 	// projectDir might be "" if you use --repository option
 	if repository.NeedsCaching(repo) && projectDir != "" {
+		spoolingRepo, err := repository.NewSpoolingRepository(repo, repository.SpoolDirForRepository(projectDir, repo.RootURL()))
+		if err != nil {
+			return nil, err
+		}
+		pushSpool(spoolingRepo)
+		repo = spoolingRepo
+
+		// Objects that have been prefetched with 'replicate prefetch' are
+		// read from local disk
+		if prefetchDir := repository.PrefetchDirForRepository(repo.RootURL()); prefetchDir != "" {
+			repo, err = repository.NewPrefetchingRepository(repo, prefetchDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		console.Info("Fetching new data from %q...", repo.RootURL())
 		repo, err = repository.NewCachedMetadataRepository(projectDir, repo)
 		if err != nil {
@@ -95,12 +119,61 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 		}
 		cachedRepo := repo.(*repository.CachedRepository)
 		if err := cachedRepo.SyncCache(); err != nil {
-			return nil, err
+			if !repository.IsUnreachable(err) {
+				return nil, err
+			}
+			console.Warn("Failed to reach %q, so showing what was fetched from it last time: %s", repo.RootURL(), err)
 		}
 	}
 	return repo, nil
 }
 
+// pushSpool uploads anything that was saved to the spool while the
+// repository couldn't be reached, so it is uploaded by whichever command is
+// run next
+func pushSpool(repo *repository.SpoolingRepository) {
+	if repo.Offline() {
+		return
+	}
+	paths, err := repo.SpooledPaths()
+	if err != nil || len(paths) == 0 {
+		return
+	}
+	console.Info("Uploading %d objects that were saved while %q couldn't be reached...", len(paths), repo.RootURL())
+	if _, err := repo.Push(); err != nil {
+		if repository.IsUnreachable(err) {
+			console.Debug("Still can't reach %q: %s", repo.RootURL(), err)
+			return
+		}
+		console.Warn("Failed to upload queued objects, so they will be uploaded next time: %s", err)
+	}
+}
+
+func addNoInventoryFlagVar(cmd *cobra.Command, opt *bool) {
+	cmd.Flags().BoolVar(opt, "no-inventory", false, "List the repository, even if replicate.yaml has an inventory of it")
+}
+
+// setInventory makes proj read the inventory in replicate.yaml, if there is
+// one, instead of listing the repository. If the inventory can't be read or
+// is too old, the repository is listed as usual.
+func setInventory(proj *project.Project) {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil || conf.Inventory == nil {
+		return
+	}
+	inv, err := repository.LoadInventory(conf.Inventory.URL)
+	if err != nil {
+		console.Warn("Listing the repository, because its inventory couldn't be read: %s", err)
+		return
+	}
+	if inv.Age() > conf.Inventory.MaxAge() {
+		console.Warn("Listing the repository, because its newest inventory was made %s ago, which is longer than 'max_age_hours' in 'inventory' in replicate.yaml", inv.Age().Round(time.Hour))
+		return
+	}
+	console.Info("Using the inventory made %s ago, so objects saved since then are looked for separately", inv.Age().Round(time.Minute))
+	proj.SetInventory(inv)
+}
+
 // handlErrors wraps a cobra function, and will print and exit on error
 //
 // We don't use RunE because if that returns an error, Cobra will print usage.
@@ -108,6 +181,12 @@ func getRepository(repositoryURL, projectDir string) (repository.Repository, err
 func handleErrors(f func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
 		if err := f(cmd, args); err != nil {
+			if repository.TransfersCancelled() {
+				console.Fatal("%s%s", err, interruptedHint)
+			}
+			if hint := errors.Remediation(err); hint != "" {
+				console.Fatal("%s\n\n%s", err, hint)
+			}
 			console.Fatal(err.Error())
 		}
 	}
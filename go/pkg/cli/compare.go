@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type compareOpts struct {
+	repositoryURL string
+	json          bool
+}
+
+func newCompareCommand() *cobra.Command {
+	var opts compareOpts
+
+	cmd := &cobra.Command{
+		Use:   "compare <ID> <ID> [ID...]",
+		Short: "Compare the params and metrics of several experiments or checkpoints",
+		Long: `Compare the params and metrics of several experiments or checkpoints.
+
+Each experiment or checkpoint is shown in a column, and rows where the values differ are highlighted. If an experiment ID is passed, the metrics from its best checkpoint are shown, or its latest checkpoint if it doesn't have a primary metric.`,
+		Example: `Compare three experiments:
+replicate compare 3ef2a1 1b9c3d 7d8e2f
+
+Output the comparison as JSON:
+replicate compare --json 3ef2a1 1b9c3d`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return compare(opts, args, os.Stdout)
+		}),
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeIDs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.json, "json", false, "Print output in JSON format")
+
+	return cmd
+}
+
+// comparison is the output of compare, which is also its JSON format
+type comparison struct {
+	Experiments []string         `json:"experiments"`
+	Checkpoints []*string        `json:"checkpoints"`
+	Params      []*comparisonRow `json:"params"`
+	Metrics     []*comparisonRow `json:"metrics"`
+}
+
+// comparisonRow is the values of a param or metric across the compared
+// experiments, with nil for the ones where it isn't set
+type comparisonRow struct {
+	Name      string         `json:"name"`
+	Values    []*param.Value `json:"values"`
+	Different bool           `json:"different"`
+}
+
+func compare(opts compareOpts, prefixes []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	c, err := makeComparison(proj, prefixes)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	printComparison(out, getAurora(), c)
+	return nil
+}
+
+func makeComparison(proj *project.Project, prefixes []string) (*comparison, error) {
+	c := &comparison{
+		Experiments: []string{},
+		Checkpoints: []*string{},
+	}
+	params := []param.ValueMap{}
+	metrics := []param.ValueMap{}
+	for _, prefix := range prefixes {
+		result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		checkpoint := result.Checkpoint
+		if checkpoint == nil {
+			checkpoint = bestOrLatestCheckpoint(result.Experiment)
+		}
+		c.Experiments = append(c.Experiments, result.Experiment.ID)
+		params = append(params, result.Experiment.Params)
+		if checkpoint == nil {
+			c.Checkpoints = append(c.Checkpoints, nil)
+			metrics = append(metrics, param.ValueMap{})
+		} else {
+			id := checkpoint.ID
+			c.Checkpoints = append(c.Checkpoints, &id)
+			metrics = append(metrics, checkpoint.Metrics)
+		}
+	}
+	c.Params = comparisonRows(params)
+	c.Metrics = comparisonRows(metrics)
+	return c, nil
+}
+
+// comparisonRows returns a row for each key in maps, sorted by key
+func comparisonRows(maps []param.ValueMap) []*comparisonRow {
+	names := map[string]bool{}
+	for _, m := range maps {
+		for name := range m {
+			names[name] = true
+		}
+	}
+	rows := []*comparisonRow{}
+	for name := range names {
+		row := &comparisonRow{Name: name, Values: []*param.Value{}}
+		for _, m := range maps {
+			if v, ok := m[name]; ok {
+				row.Values = append(row.Values, &v)
+			} else {
+				row.Values = append(row.Values, nil)
+			}
+		}
+		for _, v := range row.Values[1:] {
+			if !valuesEqual(row.Values[0], v) {
+				row.Different = true
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+func valuesEqual(a, b *param.Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	equal, err := a.Equal(*b)
+	if err != nil {
+		// Different types
+		return false
+	}
+	return equal
+}
+
+func printComparison(out io.Writer, au aurora.Aurora, c *comparison) {
+	table := [][]string{}
+	highlight := []bool{}
+	headings := map[int]bool{}
+	addRow := func(different bool, cells ...string) {
+		table = append(table, cells)
+		highlight = append(highlight, different)
+	}
+	addHeading := func(text string) {
+		if len(table) > 0 {
+			addRow(false)
+		}
+		headings[len(table)] = true
+		addRow(false, text)
+	}
+
+	experimentIDs := []string{"ID:"}
+	checkpointIDs := []string{"Checkpoint:"}
+	for i, id := range c.Experiments {
+		experimentIDs = append(experimentIDs, id[:7])
+		if c.Checkpoints[i] == nil {
+			checkpointIDs = append(checkpointIDs, "(none)")
+		} else {
+			checkpointIDs = append(checkpointIDs, (*c.Checkpoints[i])[:7])
+		}
+	}
+	addHeading("Experiment")
+	addRow(false, experimentIDs...)
+	addRow(false, checkpointIDs...)
+
+	for _, section := range []struct {
+		heading string
+		rows    []*comparisonRow
+	}{{"Params", c.Params}, {"Metrics", c.Metrics}} {
+		addHeading(section.heading)
+		if len(section.rows) == 0 {
+			addRow(false, "(none)")
+		}
+		for _, row := range section.rows {
+			cells := []string{row.Name + ":"}
+			for _, v := range row.Values {
+				if v == nil {
+					cells = append(cells, "(not set)")
+				} else {
+					// Truncate to keep columns a sensible width, like diff
+					cells = append(cells, param.Truncate(v.String(), 50))
+				}
+			}
+			addRow(row.Different, cells...)
+		}
+	}
+
+	// Pad cells ourselves rather than using tabwriter, because tabwriter
+	// counts color escape codes in the width of cells
+	widths := []int{}
+	for _, cells := range table {
+		for i, cell := range cells {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	for r, cells := range table {
+		if headings[r] {
+			fmt.Fprintln(out, au.Bold(cells[0]))
+			continue
+		}
+		line := []string{}
+		for i, cell := range cells {
+			padded := cell
+			if i < len(cells)-1 {
+				padded += strings.Repeat(" ", widths[i]-len(cell))
+			}
+			if highlight[r] {
+				line = append(line, au.Yellow(padded).String())
+			} else {
+				line = append(line, padded)
+			}
+		}
+		fmt.Fprintln(out, strings.Join(line, "  "))
+	}
+}
+
+// bestOrLatestCheckpoint returns the best checkpoint of an experiment if it
+// has a primary metric, otherwise the latest checkpoint. It returns nil if the
+// experiment has no checkpoints.
+func bestOrLatestCheckpoint(exp *project.Experiment) *project.Checkpoint {
+	if checkpoint := exp.BestCheckpoint(); checkpoint != nil {
+		return checkpoint
+	}
+	return exp.LatestCheckpoint()
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestCompare(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	primaryMetric := &project.PrimaryMetric{Name: "metric-1", Goal: project.GoalMinimize}
+	experiments := []*project.Experiment{{
+		ID:     "1eeeeeeeee",
+		Params: param.ValueMap{"param-1": param.Int(100), "param-2": param.String("hello")},
+		Config: &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:            "2ccccccccc",
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.01), "metric-2": param.Int(2)},
+			PrimaryMetric: primaryMetric,
+		}, {
+			ID:            "3ccccccccc",
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.02), "metric-2": param.Int(2)},
+			PrimaryMetric: primaryMetric,
+		}},
+	}, {
+		ID:     "2eeeeeeeee",
+		Params: param.ValueMap{"param-1": param.Int(200), "param-2": param.String("hello"), "param-3": param.String("hi")},
+		Config: &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:      "4ccccccccc",
+			Metrics: param.ValueMap{"metric-3": param.Float(0.5)},
+		}},
+	}}
+	for _, exp := range experiments {
+		require.NoError(t, exp.Save(repo))
+	}
+	proj := project.NewProject(repo, workingDir)
+
+	c, err := makeComparison(proj, []string{"1e", "2e", "3c"})
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	printComparison(out, aurora.NewAurora(false), c)
+	expected := `
+Experiment
+ID:          1eeeeee    2eeeeee    1eeeeee
+Checkpoint:  2cccccc    4cccccc    3cccccc
+
+Params
+param-1:     100        200        100
+param-2:     hello      hello      hello
+param-3:     (not set)  hi         (not set)
+
+Metrics
+metric-1:    0.01       (not set)  0.02
+metric-2:    2          (not set)  2
+metric-3:    (not set)  0.5        (not set)
+`
+	require.Equal(t, expected[1:], out.String())
+
+	// Differences are highlighted
+	out = new(bytes.Buffer)
+	printComparison(out, aurora.NewAurora(true), c)
+	require.Contains(t, out.String(), aurora.Yellow("param-1:   ").String())
+	require.NotContains(t, out.String(), aurora.Yellow("param-2:   ").String())
+
+	// JSON
+	j, err := json.Marshal(c)
+	require.NoError(t, err)
+	actual := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(j, &actual))
+	require.Equal(t, []interface{}{"1eeeeeeeee", "2eeeeeeeee", "1eeeeeeeee"}, actual["experiments"])
+	require.Equal(t, []interface{}{"2ccccccccc", "4ccccccccc", "3ccccccccc"}, actual["checkpoints"])
+	require.Equal(t, map[string]interface{}{
+		"name":      "param-3",
+		"values":    []interface{}{nil, "hi", nil},
+		"different": true,
+	}, actual["params"].([]interface{})[2])
+	require.Equal(t, false, actual["params"].([]interface{})[1].(map[string]interface{})["different"])
+}
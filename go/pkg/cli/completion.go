@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func newCompletionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion <bash|zsh|fish>",
+		Short: "Generate shell completion scripts",
+		Long: `Generate shell completion scripts.
+
+As well as commands and flags, this completes experiment and checkpoint IDs,
+and experiment names.
+
+To load completions in Bash, add this to ~/.bashrc:
+
+    source <(replicate completion bash)
+
+In Zsh, add this to ~/.zshrc:
+
+    source <(replicate completion zsh)
+    compdef _replicate replicate
+
+In Fish, run:
+
+    replicate completion fish > ~/.config/fish/completions/replicate.fish`,
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		Args:      cobra.ExactValidArgs(1),
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			switch args[0] {
+			case "bash":
+				return cmd.Root().GenBashCompletion(os.Stdout)
+			case "zsh":
+				return cmd.Root().GenZshCompletion(os.Stdout)
+			case "fish":
+				return cmd.Root().GenFishCompletion(os.Stdout, true)
+			}
+			return fmt.Errorf("Unknown shell: %s", args[0])
+		}),
+	}
+	return cmd
+}
+
+// completeIDs is a cobra.Command.ValidArgsFunction that completes experiment
+// and checkpoint IDs.
+//
+// It is run every time the user presses tab, so it doesn't sync the metadata
+// cache of remote repositories: it completes using whatever was fetched by the
+// last command. It also mustn't print anything, because the output is parsed
+// by the shell.
+func completeIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	proj, err := getProjectForCompletion(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return matchIDs(experiments, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNIDs returns a function that completes IDs for the first n arguments
+func completeNIDs(n int) func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeIDs(cmd, args, toComplete)
+	}
+}
+
+func getProjectForCompletion(cmd *cobra.Command) (*project.Project, error) {
+	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if repository.NeedsCaching(repo) && projectDir != "" {
+		repo, err = repository.NewCachedMetadataRepository(projectDir, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return project.NewProject(repo, projectDir), nil
+}
+
+// matchIDs returns the IDs of experiments and checkpoints, and the names of
+// experiments, that start with prefix, with a description for the shell to display alongside them. Short
+// IDs are completed, unless the prefix is already longer than a short ID.
+func matchIDs(experiments []*project.Experiment, prefix string) []string {
+	results := []string{}
+	add := func(id string, shortID string, description string) {
+		if !strings.HasPrefix(id, prefix) {
+			return
+		}
+		if len(prefix) >= len(shortID) {
+			results = append(results, id+"\t"+description)
+		} else {
+			results = append(results, shortID+"\t"+description)
+		}
+	}
+	for _, exp := range experiments {
+		add(exp.ID, exp.ShortID(), fmt.Sprintf("experiment (%s)", exp.Command))
+		if exp.Name != "" && strings.HasPrefix(exp.Name, prefix) {
+			results = append(results, exp.Name+"\t"+fmt.Sprintf("experiment %s (%s)", exp.ShortID(), exp.Command))
+		}
+		for _, chk := range exp.Checkpoints {
+			add(chk.ID, chk.ShortID(), fmt.Sprintf("checkpoint of experiment %s", exp.ShortID()))
+		}
+	}
+	return results
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestMatchIDs(t *testing.T) {
+	experiments := []*project.Experiment{{
+		ID:      "1eeeeeeeeeeeeeee",
+		Command: "train.py",
+		Checkpoints: []*project.Checkpoint{
+			{ID: "1ccccccccccccccc"},
+			{ID: "2ccccccccccccccc"},
+		},
+	}, {
+		ID:      "2eeeeeeeeeeeeeee",
+		Name:    "brave-falcon-42",
+		Command: "train.py --lr=0.1",
+	}}
+
+	require.Equal(t, []string{
+		"1eeeeee\texperiment (train.py)",
+		"1cccccc\tcheckpoint of experiment 1eeeeee",
+		"2cccccc\tcheckpoint of experiment 1eeeeee",
+		"2eeeeee\texperiment (train.py --lr=0.1)",
+		"brave-falcon-42\texperiment 2eeeeee (train.py --lr=0.1)",
+	}, matchIDs(experiments, ""))
+
+	require.Equal(t, []string{
+		"brave-falcon-42\texperiment 2eeeeee (train.py --lr=0.1)",
+	}, matchIDs(experiments, "brave"))
+
+	require.Equal(t, []string{
+		"1eeeeee\texperiment (train.py)",
+	}, matchIDs(experiments, "1e"))
+
+	// Full IDs are completed if the prefix is longer than a short ID
+	require.Equal(t, []string{
+		"2ccccccccccccccc\tcheckpoint of experiment 1eeeeee",
+	}, matchIDs(experiments, "2cccccccc"))
+
+	require.Empty(t, matchIDs(experiments, "3"))
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type cpOpts struct {
+	repositoryURL string
+}
+
+func newCpCommand() *cobra.Command {
+	var opts cpOpts
+
+	cmd := &cobra.Command{
+		Use:   "cp <experiment or checkpoint ID>:<path> <destination>",
+		Short: "Copy a single file out of an experiment or checkpoint",
+		Long: `Copy a single file out of an experiment or checkpoint.
+
+The path is relative to the project directory, as it is in the output of "replicate show". If an experiment ID is passed, the file is copied from its best or latest checkpoint, falling back to the experiment itself.
+
+Only the file is downloaded, not the whole experiment or checkpoint. The destination can be a file or an existing directory. Pass "-" as the destination to write the file to stdout.`,
+		Example: `Copy weights from a checkpoint into the current directory:
+replicate cp 3ef2a1:weights/model.pt .
+
+Print a file from an experiment:
+replicate cp 3ef2a1:params.json -`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return cp(opts, args[0], args[1])
+		}),
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeNIDs(1),
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func cp(opts cpOpts, source string, destination string) error {
+	prefix, filePath, err := parseCpSource(source)
+	if err != nil {
+		return err
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	experiment := result.Experiment
+	checkpoint := result.Checkpoint
+	if checkpoint == nil {
+		checkpoint = bestOrLatestCheckpoint(experiment)
+	}
+
+	if destination == "-" {
+		return proj.CopyFile(checkpoint, experiment, filePath, os.Stdout)
+	}
+
+	isDir, err := files.IsDir(destination)
+	if err == nil && isDir {
+		destination = filepath.Join(destination, path.Base(filePath))
+	}
+	if err := copyFileTo(proj, checkpoint, experiment, filePath, destination); err != nil {
+		return err
+	}
+	console.Info("Copied %s to %s", filePath, destination)
+	return nil
+}
+
+// copyFileTo copies filePath to the local file destination, removing the
+// partially written file if it fails
+func copyFileTo(proj *project.Project, checkpoint *project.Checkpoint, experiment *project.Experiment, filePath string, destination string) error {
+	f, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", destination, err)
+	}
+	err = proj.CopyFile(checkpoint, experiment, filePath, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Failed to write %s: %w", destination, closeErr)
+	}
+	if err != nil {
+		os.Remove(destination)
+		return err
+	}
+	return nil
+}
+
+// parseCpSource splits "<id>:<path>" into its ID and path
+func parseCpSource(source string) (prefix string, filePath string, err error) {
+	parts := strings.SplitN(source, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Source must be in the form <experiment or checkpoint ID>:<path>, got %q", source)
+	}
+	filePath = strings.TrimPrefix(path.Clean(filepath.ToSlash(parts[1])), "/")
+	if filePath == "." || filePath == "" || filePath == ".." || strings.HasPrefix(filePath, "../") {
+		return "", "", fmt.Errorf("Invalid path in %q: it must be a file inside the experiment or checkpoint", source)
+	}
+	return parts[0], filePath, nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestCp(t *testing.T) {
+	repoDir, err := files.TempDir("test-cp")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	experiment := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Now().Add(-10 * time.Minute),
+		Config:  &config.Config{},
+		Path:    ".",
+		Checkpoints: []*project.Checkpoint{
+			{
+				ID:      "1ccccccccc",
+				Created: time.Now().Add(-5 * time.Minute),
+				Path:    "weights",
+			},
+		},
+	}
+	require.NoError(t, experiment.Save(repo))
+
+	codeDir, err := files.TempDir("test-cp-code")
+	require.NoError(t, err)
+	defer os.RemoveAll(codeDir)
+	require.NoError(t, os.MkdirAll(path.Join(codeDir, "weights"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "weights", "model.pt"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPathTar(codeDir, "experiments/1eeeeeeeee.tar.gz", ""))
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/1ccccccccc.tar.gz", "weights"))
+
+	outDir, err := files.TempDir("test-cp-out")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	opts := cpOpts{repositoryURL: "file://" + repoDir}
+
+	// file from checkpoint into a directory
+	require.NoError(t, cp(opts, "1cc:weights/model.pt", outDir))
+	contents, err := ioutil.ReadFile(path.Join(outDir, "model.pt"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(contents))
+
+	// file only in experiment, to a file path
+	require.NoError(t, cp(opts, "1ee:./train.py", path.Join(outDir, "copied.py")))
+	contents, err = ioutil.ReadFile(path.Join(outDir, "copied.py"))
+	require.NoError(t, err)
+	require.Equal(t, "print(1)", string(contents))
+
+	// missing file doesn't leave anything behind
+	err = cp(opts, "1ee:missing.txt", path.Join(outDir, "missing.txt"))
+	require.Error(t, err)
+	require.True(t, errors.IsDoesNotExist(err))
+	exists, err := files.FileExists(path.Join(outDir, "missing.txt"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// directories can't be copied
+	err = cp(opts, "1ee:weights", path.Join(outDir, "weights"))
+	require.Error(t, err)
+
+	_, _, err = parseCpSource("1ee")
+	require.Error(t, err)
+	_, _, err = parseCpSource("1ee:../outside")
+	require.Error(t, err)
+}
@@ -1,11 +1,19 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/replicate/go/pkg/config"
 	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
 	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/metrics"
 	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
 	"github.com/replicate/replicate/go/pkg/shared"
 )
 
@@ -16,14 +24,46 @@ func NewDaemonCommand() *cobra.Command {
 	}
 	setPersistentFlags(cmd)
 	addRepositoryURLFlag(cmd)
+	cmd.Flags().String("metrics-address", os.Getenv(metrics.AddressEnvVar), "Address to serve Prometheus metrics on at /metrics, such as ':9090' (default: $"+metrics.AddressEnvVar+", or not served)")
+	cmd.Flags().String("prefetch-interval", os.Getenv(PrefetchIntervalEnvVar), "How often to prefetch the latest checkpoints of running experiments, such as '1m', so checking them out is instant (default: $"+PrefetchIntervalEnvVar+", or not prefetched)")
 	return cmd
 }
 
 func runDaemon(cmd *cobra.Command, args []string) error {
 	socketPath := args[0]
 
-	if global.Verbose {
-		console.SetLevel(console.DebugLevel)
+	setLogging()
+	repository.DisableMFAPrompt()
+	metricsAddress, err := cmd.Flags().GetString("metrics-address")
+	if err != nil {
+		return err
+	}
+	if metricsAddress != "" {
+		// Metrics are only for monitoring, so the daemon carries on saving
+		// experiments without them
+		if address, err := metrics.Serve(metricsAddress); err != nil {
+			console.Warn("%s", err)
+		} else {
+			console.Debug("Serving metrics on http://%s/metrics", address)
+		}
+	}
+	if conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory); err == nil {
+		project.ApplyGlobalSettings(conf)
+	}
+	prefetchInterval, err := cmd.Flags().GetString("prefetch-interval")
+	if err != nil {
+		return err
+	}
+	if prefetchInterval != "" {
+		interval, err := time.ParseDuration(prefetchInterval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("--prefetch-interval must be a duration like '1m', not '%s'", prefetchInterval)
+		}
+		repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
+		if err != nil {
+			return err
+		}
+		go prefetchRunningExperiments(repositoryURL, projectDir, interval)
 	}
 
 	projectGetter := func() (proj *project.Project, err error) {
@@ -36,7 +76,12 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 			return nil, err
 		}
 		proj = project.NewProject(repo, projectDir)
-		return proj, err
+		conf, err := getProjectConfig(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		proj.ApplySettings(conf)
+		return proj, nil
 	}
 
 	if err := shared.Serve(projectGetter, socketPath); err != nil {
@@ -44,3 +89,16 @@ func runDaemon(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// getProjectConfig returns replicate.yaml in projectDir, or an empty config
+// if there isn't one, which might be the case if --repository was passed.
+func getProjectConfig(projectDir string) (*config.Config, error) {
+	conf, _, err := config.FindConfigInWorkingDir(projectDir)
+	if err != nil {
+		if errors.IsConfigNotFound(err) {
+			return &config.Config{}, nil
+		}
+		return nil, err
+	}
+	return conf, nil
+}
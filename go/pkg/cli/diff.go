@@ -6,6 +6,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -19,17 +20,21 @@ import (
 
 func newDiffCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "diff <ID> <ID>",
+		Use:   "diff <ID> <ID> [path...]",
 		Short: "Compare two experiments or checkpoints",
 		Long: `Compare two experiments or checkpoints.
 
-If an experiment ID is passed, it will pick the best checkpoint from that experiment. If a primary metric is not defined in replicate.yaml, it will use the latest checkpoint.`,
-		Run:  handleErrors(diffCheckpoints),
-		Args: cobra.ExactArgs(2),
+If an experiment ID is passed, it will pick the best checkpoint from that experiment. If a primary metric is not defined in replicate.yaml, it will use the latest checkpoint.
+
+With --files, or if paths are passed, it also lists the files that are different, and shows what changed in text files like configs and scripts. Only the files that are different are downloaded.`,
+		Run:               handleErrors(diffCheckpoints),
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeNIDs(2),
 	}
 
 	// We should have a --json flag here, see https://github.com/replicate/replicate/issues/338
 	addRepositoryURLFlag(cmd)
+	cmd.Flags().Bool("files", false, "Compare the files of the checkpoints too")
 
 	return cmd
 }
@@ -41,6 +46,11 @@ func diffCheckpoints(cmd *cobra.Command, args []string) error {
 
 	prefix1 := args[0]
 	prefix2 := args[1]
+	paths := args[2:]
+	files, err := cmd.Flags().GetBool("files")
+	if err != nil {
+		return err
+	}
 
 	repositoryURL, projectDir, err := getRepositoryURLFromFlagOrConfig(cmd)
 	if err != nil {
@@ -52,7 +62,7 @@ func diffCheckpoints(cmd *cobra.Command, args []string) error {
 	}
 	proj := project.NewProject(repo, projectDir)
 	au := getAurora()
-	return printDiff(os.Stdout, au, proj, prefix1, prefix2)
+	return printDiff(os.Stdout, au, proj, prefix1, prefix2, files || len(paths) > 0, paths)
 }
 
 // TODO: implement this as a thing in console
@@ -64,7 +74,10 @@ func heading(w *tabwriter.Writer, au aurora.Aurora, text string) {
 	fmt.Fprintf(w, "%s\t\t\n", au.Bold(text))
 }
 
-func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 string, prefix2 string) error {
+// printDiff prints the differences between two checkpoints. If files is true,
+// it prints the differences between their files at or inside paths too, or
+// all their files if paths is empty.
+func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 string, prefix2 string, files bool, paths []string) error {
 	exp1, com1, err := loadCheckpoint(proj, prefix1)
 	if err != nil {
 		return err
@@ -90,10 +103,28 @@ func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 s
 	printMapDiff(w, au, paramMapToStringMap(exp1.Params), paramMapToStringMap(exp2.Params))
 	br(w)
 
+	if len(exp1.Seeds) > 0 || len(exp2.Seeds) > 0 {
+		heading(w, au, "Seeds")
+		printMapDiff(w, au, exp1.Seeds, exp2.Seeds)
+		br(w)
+	}
+
+	if len(exp1.Environment) > 0 || len(exp2.Environment) > 0 {
+		heading(w, au, "Environment")
+		printMapDiff(w, au, exp1.Environment, exp2.Environment)
+		br(w)
+	}
+
 	heading(w, au, "Python Packages")
 	printMapDiff(w, au, exp1.PythonPackages, exp2.PythonPackages)
 	br(w)
 
+	if len(exp1.Datasets) > 0 || len(exp2.Datasets) > 0 {
+		heading(w, au, "Datasets")
+		printMapDiff(w, au, datasetsToMap(exp1), datasetsToMap(exp2))
+		br(w)
+	}
+
 	heading(w, au, "Checkpoint")
 	fmt.Fprintf(w, "ID:\t%s\t%s\n", com1.ShortID(), com2.ShortID())
 	printMapDiff(w, au, checkpointToMap(com1), checkpointToMap(com2))
@@ -104,7 +135,57 @@ func printDiff(out io.Writer, au aurora.Aurora, proj *project.Project, prefix1 s
 	printMapDiff(w, au, paramMapToStringMap(com1.Metrics), paramMapToStringMap(com2.Metrics))
 	br(w)
 
-	return w.Flush()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !files {
+		return nil
+	}
+	fileDiffs, err := proj.DiffFiles(exp1, com1, exp2, com2, paths)
+	if err != nil {
+		return err
+	}
+	return printFileDiffs(out, au, fileDiffs)
+}
+
+// printFileDiffs prints a list of the files that differ, followed by the
+// changes to each text file. It doesn't use a tabwriter, because the
+// contents of files have tabs in them.
+func printFileDiffs(out io.Writer, au aurora.Aurora, fileDiffs []*project.FileDiff) error {
+	fmt.Fprintf(out, "%s\n", au.Bold("Files"))
+	if len(fileDiffs) == 0 {
+		fmt.Fprintf(out, "%s\n\n", au.Faint("(no difference)"))
+		return nil
+	}
+	for _, diff := range fileDiffs {
+		line := fmt.Sprintf("%-10s%s", string(diff.Change)+":", diff.Path)
+		if diff.NotCompared != "" {
+			line += " " + au.Faint(fmt.Sprintf("(not compared, because %s)", diff.NotCompared)).String()
+		}
+		fmt.Fprintln(out, line)
+	}
+	fmt.Fprintln(out)
+	for _, diff := range fileDiffs {
+		if diff.Diff == "" {
+			continue
+		}
+		for _, line := range strings.SplitAfter(diff.Diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				fmt.Fprint(out, au.Bold(line))
+			case strings.HasPrefix(line, "@@"):
+				fmt.Fprint(out, au.Cyan(line))
+			case strings.HasPrefix(line, "+"):
+				fmt.Fprint(out, au.Green(line))
+			case strings.HasPrefix(line, "-"):
+				fmt.Fprint(out, au.Red(line))
+			default:
+				fmt.Fprint(out, line)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
 }
 
 func printMapDiff(w *tabwriter.Writer, au aurora.Aurora, map1, map2 map[string]string) {
@@ -162,6 +243,14 @@ func experimentToMap(exp *project.Experiment) map[string]string {
 	}
 }
 
+func datasetsToMap(exp *project.Experiment) map[string]string {
+	ret := map[string]string{}
+	for _, d := range exp.Datasets {
+		ret[d.Name] = formatDataset(d)
+	}
+	return ret
+}
+
 func paramMapToStringMap(params param.ValueMap) map[string]string {
 	result := make(map[string]string)
 	for k, v := range params {
@@ -25,7 +25,7 @@ func TestDiffSameExperiment(t *testing.T) {
 
 	au := aurora.NewAurora(false)
 	out := new(bytes.Buffer)
-	err = printDiff(out, au, proj, "1e", "3c")
+	err = printDiff(out, au, proj, "1e", "3c", false, nil)
 	require.NoError(t, err)
 	actual := out.String()
 
@@ -63,7 +63,7 @@ func TestDiffDifferentExperiment(t *testing.T) {
 
 	au := aurora.NewAurora(false)
 	out := new(bytes.Buffer)
-	err = printDiff(out, au, proj, "1e", "4c")
+	err = printDiff(out, au, proj, "1e", "4c", false, nil)
 	require.NoError(t, err)
 	actual := out.String()
 
@@ -98,6 +98,36 @@ metric-3:                 (not set)                      0.5
 	require.Equal(t, expected, actual)
 }
 
+func TestPrintFileDiffs(t *testing.T) {
+	au := aurora.NewAurora(false)
+	out := new(bytes.Buffer)
+	err := printFileDiffs(out, au, []*project.FileDiff{
+		{Path: "model/new.txt", Change: project.FileAdded},
+		{Path: "model/params.yaml", Change: project.FileModified, Diff: "--- 1cccccc/model/params.yaml\n+++ 2cccccc/model/params.yaml\n@@ -1,2 +1,2 @@\n-lr: 0.1\n+lr: 0.01\n layers: 2\n"},
+		{Path: "model/weights.pt", Change: project.FileModified, NotCompared: "it isn't code"},
+	})
+	require.NoError(t, err)
+	expected := `
+Files
+added:    model/new.txt
+modified: model/params.yaml
+modified: model/weights.pt (not compared, because it isn't code)
+
+--- 1cccccc/model/params.yaml
++++ 2cccccc/model/params.yaml
+@@ -1,2 +1,2 @@
+-lr: 0.1
++lr: 0.01
+ layers: 2
+
+`
+	require.Equal(t, expected[1:], out.String())
+
+	out = new(bytes.Buffer)
+	require.NoError(t, printFileDiffs(out, au, []*project.FileDiff{}))
+	require.Equal(t, "Files\n(no difference)\n\n", out.String())
+}
+
 func TestMapString(t *testing.T) {
 	// string pointer helpers
 	baz := "baz"
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func newDoctorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that Replicate is set up correctly",
+		Long: `Check that Replicate is set up correctly.
+
+This checks that replicate.yaml is valid, and that each of the repositories in it can be reached with your credentials.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return doctor(os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+	return cmd
+}
+
+// doctorReport prints the result of each check and counts the problems
+type doctorReport struct {
+	out      io.Writer
+	au       aurora.Aurora
+	problems int
+}
+
+func (r *doctorReport) ok(format string, v ...interface{}) {
+	fmt.Fprintf(r.out, "%s %s\n", r.au.Green("✓"), fmt.Sprintf(format, v...))
+}
+
+func (r *doctorReport) fail(err error, format string, v ...interface{}) {
+	r.problems++
+	fmt.Fprintf(r.out, "%s %s\n", r.au.Red("✗"), fmt.Sprintf(format, v...))
+	fmt.Fprintf(r.out, "\n%s\n\n", err)
+}
+
+func doctor(out io.Writer) error {
+	r := &doctorReport{out: out, au: getAurora()}
+
+	conf, projectDir, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		r.fail(err, "Failed to load replicate.yaml")
+		return fmt.Errorf("Found 1 problem")
+	}
+	r.ok("Loaded replicate.yaml from %s", projectDir)
+	if profile := config.SelectedProfile(); profile != "" {
+		r.ok("Using profile %q", profile)
+	}
+
+	names := []string{}
+	for name := range conf.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if conf.Repository != "" {
+		checkRepository(r, "Default repository", config.ProjectRepositoryURL(conf.Repository, conf.Project), projectDir)
+	}
+	for _, name := range names {
+		checkRepository(r, fmt.Sprintf("Repository %q", name), config.ProjectRepositoryURL(conf.Repositories[name], conf.Project), projectDir)
+	}
+
+	switch r.problems {
+	case 0:
+		fmt.Fprintln(out, "\nEverything looks good!")
+		return nil
+	case 1:
+		return fmt.Errorf("Found 1 problem")
+	default:
+		return fmt.Errorf("Found %d problems", r.problems)
+	}
+}
+
+// checkRepository checks a repository can be read from, which also checks
+// the credentials for it
+func checkRepository(r *doctorReport, description string, repositoryURL string, projectDir string) {
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		r.fail(err, "%s has an invalid URL: %s", description, repositoryURL)
+		return
+	}
+	spec, err := repository.LoadSpec(repo)
+	if err != nil {
+		if errors.Code(err) == errors.CodeRepositoryCredentialsError {
+			r.fail(err, "%s (%s) could not be accessed with your credentials", description, repo.RootURL())
+		} else {
+			r.fail(err, "%s (%s) could not be read", description, repo.RootURL())
+		}
+		return
+	}
+	if spec != nil && spec.Version > repository.Version {
+		r.fail(errors.IncompatibleRepositoryVersion(repo.RootURL()), "%s (%s) was written by a newer version of Replicate", description, repo.RootURL())
+		return
+	}
+	experiments, err := repo.List("metadata/experiments")
+	if err != nil {
+		r.fail(err, "%s (%s) could not be listed", description, repo.RootURL())
+		return
+	}
+	r.ok("%s (%s) is reachable and has %d experiments", description, repo.RootURL(), len(experiments))
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/global"
+)
+
+func TestDoctor(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	workingDir, err := files.TempDir("test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	global.ProjectDirectory = workingDir
+	defer func() { global.ProjectDirectory = "" }()
+
+	err = ioutil.WriteFile(path.Join(workingDir, "replicate.yaml"), []byte(`
+repository: "file://.replicate"
+repositories:
+  broken: "foo://bar"
+`), 0644)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	err = doctor(out)
+	require.EqualError(t, err, "Found 1 problem")
+	require.Contains(t, out.String(), "✓ Loaded replicate.yaml from "+workingDir)
+	require.Contains(t, out.String(), "✓ Default repository (file://"+path.Join(workingDir, ".replicate")+") is reachable and has 0 experiments")
+	require.Contains(t, out.String(), `✗ Repository "broken" has an invalid URL: foo://bar`)
+
+	// A valid config is all good
+	err = ioutil.WriteFile(path.Join(workingDir, "replicate.yaml"), []byte(`repository: "file://.replicate"`), 0644)
+	require.NoError(t, err)
+	out = new(bytes.Buffer)
+	require.NoError(t, doctor(out))
+	require.Contains(t, out.String(), "Everything looks good!")
+}
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/mlflow"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/tensorboard"
+)
+
+type exportOpts struct {
+	repositoryURL   string
+	format          string
+	outputDirectory string
+}
+
+func newExportCommand() *cobra.Command {
+	var opts exportOpts
+
+	cmd := &cobra.Command{
+		Use:   "export <experiment ID> [experiment ID...]",
+		Short: "Export experiments to other tools",
+		Long: `Export experiments to other tools.
+
+Supported formats:
+
+  mlflow       Write each experiment as a run in an MLflow "mlruns" directory. Params, numeric metrics, and the files of the experiment and its best (or latest) checkpoint are exported. Runs are added to MLflow's default experiment.
+  tensorboard  Write the metrics of each checkpoint as TensorBoard event files. Each experiment is written to a subdirectory of the output directory, so it shows up as a run in TensorBoard. Only numeric metrics are exported.`,
+		Example: `Export an experiment's metrics so they can be viewed in TensorBoard:
+replicate export --format tensorboard -o logs 3ef2a1
+tensorboard --logdir logs
+
+Export experiments to MLflow:
+replicate export --format mlflow -o mlruns 3ef2a1 1b9c3d`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return export(opts, args)
+		}),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeIDs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.format, "format", "", "Format to export to: \"mlflow\" or \"tensorboard\"")
+	cmd.Flags().StringVarP(&opts.outputDirectory, "output-directory", "o", "", "Directory to export to")
+
+	return cmd
+}
+
+func export(opts exportOpts, prefixes []string) error {
+	if opts.format != "mlflow" && opts.format != "tensorboard" {
+		return fmt.Errorf("Unknown export format: %q. Must be \"mlflow\" or \"tensorboard\"", opts.format)
+	}
+	if opts.outputDirectory == "" {
+		return fmt.Errorf("An output directory must be passed with --output-directory")
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		var dir string
+		if opts.format == "mlflow" {
+			dir, err = exportMLflow(proj, exp, opts.outputDirectory)
+			if err != nil {
+				return err
+			}
+		} else {
+			dir = filepath.Join(opts.outputDirectory, exp.ShortID())
+			if err := exportTensorBoard(exp, dir); err != nil {
+				return err
+			}
+		}
+		console.Info("Exported experiment %s to %s", exp.ShortID(), dir)
+	}
+	return nil
+}
+
+// exportTensorBoard writes the numeric metrics of an experiment's checkpoints
+// to an event file in dir, using each checkpoint's step and created time
+func exportTensorBoard(exp *project.Experiment, dir string) error {
+	f, w, err := tensorboard.CreateEventFile(dir, exp.Created)
+	if err != nil {
+		return err
+	}
+	// The file is closed once, whether or not writing it failed, so an
+	// error closing it isn't lost
+	err = writeTensorBoardScalars(exp, w)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Failed to write event file: %w", closeErr)
+	}
+	return err
+}
+
+// writeTensorBoardScalars writes the numeric metrics of an experiment's
+// checkpoints to w
+func writeTensorBoardScalars(exp *project.Experiment, w *tensorboard.EventWriter) error {
+	for _, chk := range copyCheckpointsByStep(exp.Checkpoints) {
+		names := []string{}
+		for name := range chk.Metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, ok := metricFloat(chk.Metrics[name])
+			if !ok {
+				continue
+			}
+			if err := w.WriteScalar(name, chk.Step, chk.Created, value); err != nil {
+				return fmt.Errorf("Failed to write event file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Tags that are added to exported MLflow runs so they can be imported again
+// without losing information
+const (
+	mlflowTagExperimentID      = "replicate.experiment_id"
+	mlflowTagCommand           = "replicate.command"
+	mlflowTagPrimaryMetric     = "replicate.primary_metric"
+	mlflowTagPrimaryMetricGoal = "replicate.primary_metric_goal"
+)
+
+// mlflowDefaultExperimentID is the ID of the experiment MLflow logs runs to
+// if one isn't set
+const mlflowDefaultExperimentID = "0"
+
+// exportMLflow writes an experiment as a run in an mlruns directory, and
+// returns the run directory
+func exportMLflow(proj *project.Project, exp *project.Experiment, mlrunsDir string) (string, error) {
+	if err := mlflow.EnsureExperiment(mlrunsDir, mlflowDefaultExperimentID, "Default"); err != nil {
+		return "", err
+	}
+
+	run := &mlflow.Run{
+		ID:           exp.ID,
+		ExperimentID: mlflowDefaultExperimentID,
+		Name:         exp.ShortID(),
+		User:         exp.User,
+		Status:       mlflow.StatusFinished,
+		StartTime:    exp.Created,
+		Params:       map[string]string{},
+		Metrics:      map[string][]*mlflow.MetricPoint{},
+		Tags: map[string]string{
+			"mlflow.runName":      exp.ShortID(),
+			"mlflow.user":         exp.User,
+			"mlflow.source.type":  "LOCAL",
+			mlflowTagExperimentID: exp.ID,
+		},
+	}
+	if exp.Command != "" {
+		run.Tags[mlflowTagCommand] = exp.Command
+	}
+	running, err := proj.ExperimentIsRunning(exp.ID)
+	if err != nil {
+		return "", err
+	}
+	if running {
+		run.Status = mlflow.StatusRunning
+	} else if latest := exp.LatestCheckpoint(); latest != nil {
+		run.EndTime = latest.Created
+	} else {
+		run.EndTime = exp.Created
+	}
+
+	for name, value := range exp.Params {
+		run.Params[name] = value.String()
+	}
+	for _, chk := range copyCheckpointsByStep(exp.Checkpoints) {
+		for name, v := range chk.Metrics {
+			value, ok := metricFloat(v)
+			if !ok {
+				continue
+			}
+			run.Metrics[name] = append(run.Metrics[name], &mlflow.MetricPoint{Timestamp: chk.Created, Value: value, Step: chk.Step})
+		}
+		if chk.PrimaryMetric != nil {
+			run.Tags[mlflowTagPrimaryMetric] = chk.PrimaryMetric.Name
+			run.Tags[mlflowTagPrimaryMetricGoal] = string(chk.PrimaryMetric.Goal)
+		}
+	}
+
+	dir, err := mlflow.WriteRun(mlrunsDir, run)
+	if err != nil {
+		return "", err
+	}
+
+	checkpoint := bestOrLatestCheckpoint(exp)
+	if exp.Path != "" || (checkpoint != nil && checkpoint.Path != "") {
+		if err := proj.CheckoutCheckpoint(checkpoint, exp, filepath.Join(dir, "artifacts"), true); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
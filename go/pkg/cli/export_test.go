@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestExportTensorBoard(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	exp := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Date(2006, 1, 2, 14, 54, 5, 0, time.UTC),
+		Config:  &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:      "1ccccccccc",
+			Metrics: param.ValueMap{"metric-1": param.Float(0.1), "metric-2": param.Int(2)},
+			Step:    10,
+		}, {
+			ID:      "2ccccccccc",
+			Metrics: param.ValueMap{"metric-1": param.Float(0.01), "metric-2": param.Int(3)},
+			Step:    20,
+		}},
+	}
+
+	dir := filepath.Join(workingDir, "logs", exp.ShortID())
+	require.NoError(t, exportTensorBoard(exp, dir))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.True(t, strings.HasPrefix(files[0].Name(), "events.out.tfevents."))
+	require.NotZero(t, files[0].Size())
+
+	err = export(exportOpts{format: "html", outputDirectory: "logs"}, []string{"1eee"})
+	require.Error(t, err)
+}
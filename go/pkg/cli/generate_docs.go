@@ -88,6 +88,15 @@ To install the command-line interface, [see the installation instructions](/docs
 		if err := genMarkdown(c, f); err != nil {
 			return err
 		}
+		for _, sub := range c.Commands() {
+			if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+				continue
+			}
+			sub.DisableAutoGenTag = true
+			if err := genMarkdown(sub, f); err != nil {
+				return err
+			}
+		}
 	}
 
 	fmt.Fprintln(f, "</DocsLayout>")
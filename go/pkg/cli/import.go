@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/hash"
+	"github.com/replicate/replicate/go/pkg/mlflow"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/wandb"
+)
+
+type importOpts struct {
+	repositoryURL string
+	format        string
+}
+
+func newImportCommand() *cobra.Command {
+	var opts importOpts
+
+	cmd := &cobra.Command{
+		Use:   "import <source> [source...]",
+		Short: "Import experiments from other tools",
+		Long: `Import experiments from other tools.
+
+Supported formats:
+
+  mlflow  Import runs from an MLflow "mlruns" directory. Each source can be a run directory or an experiment directory, in which case all of its runs are imported. Params and metrics are imported, and artifacts are saved as the experiment's files. A checkpoint is created for each step that metrics were logged at.
+  wandb   Import all the runs in a Weights & Biases project, passed as "<entity>/<project>". The run's config is imported as params, each row of its history is imported as a checkpoint, and the run's files are saved as the experiment's files. Runs that have already been imported are skipped, unless they hadn't finished when they were imported, so this can be run repeatedly to archive a project. The API key is read from $WANDB_API_KEY, or from ~/.netrc if you have run 'wandb login'.`,
+		Example: `Import all the runs in MLflow's default experiment:
+replicate import --format mlflow mlruns/0
+
+Import all the runs in a W&B project:
+replicate import --format wandb my-team/my-project`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return importExperiments(opts, args)
+		}),
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.format, "format", "", "Format to import from: \"mlflow\" or \"wandb\"")
+
+	return cmd
+}
+
+func importExperiments(opts importOpts, sources []string) error {
+	if opts.format != "mlflow" && opts.format != "wandb" {
+		return fmt.Errorf("Unknown import format: %q. Must be \"mlflow\" or \"wandb\"", opts.format)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	if opts.format == "wandb" {
+		client, err := wandb.NewClientFromEnvironment()
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			if err := importWandbProject(proj, repo.RootURL(), client, source); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, dir := range sources {
+		runDirs, err := mlflow.ListRuns(dir)
+		if err != nil {
+			return err
+		}
+		for _, runDir := range runDirs {
+			run, err := mlflow.ReadRun(runDir)
+			if err != nil {
+				return err
+			}
+			exp, err := importMLflowRun(proj, repo.RootURL(), run)
+			if err != nil {
+				return fmt.Errorf("Failed to import MLflow run %s: %w", run.ID, err)
+			}
+			console.Info("Imported MLflow run %s as experiment %s", run.ID, exp.ShortID())
+		}
+	}
+	return nil
+}
+
+// importMLflowRun saves an MLflow run as an experiment, with a checkpoint for
+// each step that metrics were logged at
+func importMLflowRun(proj *project.Project, repositoryURL string, run *mlflow.Run) (*project.Experiment, error) {
+	id := run.Tags[mlflowTagExperimentID]
+	if id == "" {
+		id = hash.Random()
+	}
+	user := run.User
+	if user == "" {
+		user = run.Tags["mlflow.user"]
+	}
+	exp := &project.Experiment{
+		ID:               id,
+		Created:          run.StartTime,
+		Params:           param.ValueMap{},
+		User:             user,
+		Config:           &config.Config{Repository: repositoryURL},
+		Command:          run.Tags[mlflowTagCommand],
+		Checkpoints:      []*project.Checkpoint{},
+		ReplicateVersion: global.Version,
+	}
+	for name, value := range run.Params {
+		exp.Params[name] = param.ParseFromString(value)
+	}
+
+	var primaryMetric *project.PrimaryMetric
+	if name := run.Tags[mlflowTagPrimaryMetric]; name != "" {
+		primaryMetric = &project.PrimaryMetric{Name: name, Goal: project.MetricGoal(run.Tags[mlflowTagPrimaryMetricGoal])}
+	}
+	checkpointsByStep := map[int64]*project.Checkpoint{}
+	for name, points := range run.Metrics {
+		for _, point := range points {
+			chk, ok := checkpointsByStep[point.Step]
+			if !ok {
+				chk = &project.Checkpoint{
+					ID:            hash.Random(),
+					Created:       point.Timestamp,
+					Metrics:       param.ValueMap{},
+					Step:          point.Step,
+					PrimaryMetric: primaryMetric,
+				}
+				checkpointsByStep[point.Step] = chk
+				exp.Checkpoints = append(exp.Checkpoints, chk)
+			}
+			// If a metric is logged several times at a step, the last
+			// value wins, which is what MLflow shows
+			chk.Metrics[name] = param.Float(point.Value)
+			if point.Timestamp.After(chk.Created) {
+				chk.Created = point.Timestamp
+			}
+		}
+	}
+	sort.Slice(exp.Checkpoints, func(i, j int) bool {
+		return exp.Checkpoints[i].Step < exp.Checkpoints[j].Step
+	})
+
+	filesDir := ""
+	if files, err := ioutil.ReadDir(run.ArtifactsDir); err == nil && len(files) > 0 {
+		filesDir = run.ArtifactsDir
+	}
+	if err := proj.ImportExperiment(exp, filesDir); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// importWandbProject imports each run in a W&B project, passed as
+// "<entity>/<project>". Runs that have already been imported are skipped,
+// unless they hadn't finished when they were imported, in which case they are
+// imported again to pick up what they have logged since.
+func importWandbProject(proj *project.Project, repositoryURL string, client *wandb.Client, source string) error {
+	parts := strings.Split(source, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("W&B projects must be passed as <entity>/<project>, not %q", source)
+	}
+	entity, projectName := parts[0], parts[1]
+
+	console.Info("Fetching runs from W&B project %s...", source)
+	runs, err := client.ListRuns(entity, projectName)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		id := wandbExperimentID(entity, projectName, run.Name)
+		existing, _ := proj.ExperimentByID(id)
+		if existing != nil && existing.Imported != nil && wandbRunDone(existing.Imported.State) {
+			console.Info("Skipping W&B run %s, which has already been imported as experiment %s", run.Name, existing.ShortID())
+			continue
+		}
+		exp, err := importWandbRun(proj, repositoryURL, client, entity, projectName, id, run, existing)
+		if err != nil {
+			return fmt.Errorf("Failed to import W&B run %s: %w", run.Name, err)
+		}
+		if existing != nil {
+			console.Info("Re-imported W&B run %s as experiment %s, because it hadn't finished when it was last imported", run.Name, exp.ShortID())
+		} else {
+			console.Info("Imported W&B run %s as experiment %s", run.Name, exp.ShortID())
+		}
+	}
+	return nil
+}
+
+// wandbRunDone returns true if a W&B run in state won't log anything else.
+// Crashed runs are not done, because W&B marks runs as crashed when it stops
+// getting heartbeats from them, and they can come back.
+func wandbRunDone(state string) bool {
+	switch state {
+	case "finished", "failed", "killed":
+		return true
+	}
+	return false
+}
+
+// wandbExperimentID returns the ID of the experiment that a W&B run is
+// imported as, which is derived from the run's name so importing a project
+// again doesn't duplicate runs
+func wandbExperimentID(entity, projectName, runName string) string {
+	sum := sha256.Sum256([]byte("wandb/" + entity + "/" + projectName + "/" + runName))
+	return hex.EncodeToString(sum[:])
+}
+
+// importWandbRun saves a W&B run as an experiment, with a checkpoint for each
+// row of its history. Values that aren't params or metrics, like images and
+// histograms, are skipped. If existing is not nil, it is the experiment the
+// run was previously imported as, which is replaced.
+func importWandbRun(proj *project.Project, repositoryURL string, client *wandb.Client, entity string, projectName string, id string, run *wandb.Run, existing *project.Experiment) (*project.Experiment, error) {
+	exp := &project.Experiment{
+		ID:               id,
+		Created:          run.Created,
+		Params:           param.ValueMap{},
+		User:             run.User,
+		Config:           &config.Config{Repository: repositoryURL},
+		Checkpoints:      []*project.Checkpoint{},
+		ReplicateVersion: global.Version,
+		Imported: &project.ImportRecord{
+			Source: "wandb",
+			RunID:  entity + "/" + projectName + "/" + run.Name,
+			State:  run.State,
+		},
+	}
+	for name, data := range run.Config {
+		var value param.Value
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("Failed to parse config value %s: %w", name, err)
+		}
+		exp.Params[name] = value
+	}
+
+	history, err := client.History(entity, projectName, run)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range history {
+		chk := &project.Checkpoint{
+			ID:      hash.Random(),
+			Created: run.Created,
+			Metrics: param.ValueMap{},
+		}
+		if data, ok := row["_step"]; ok {
+			if err := json.Unmarshal(data, &chk.Step); err != nil {
+				return nil, fmt.Errorf("Failed to parse _step: %w", err)
+			}
+		}
+		if data, ok := row["_timestamp"]; ok {
+			var timestamp float64
+			if err := json.Unmarshal(data, &timestamp); err != nil {
+				return nil, fmt.Errorf("Failed to parse _timestamp: %w", err)
+			}
+			chk.Created = time.Unix(0, int64(timestamp*float64(time.Second))).UTC()
+		}
+		for name, data := range row {
+			if strings.HasPrefix(name, "_") {
+				continue
+			}
+			var value param.Value
+			if err := json.Unmarshal(data, &value); err != nil || value.Type() == param.TypeObject {
+				continue
+			}
+			chk.Metrics[name] = value
+		}
+		if len(chk.Metrics) > 0 {
+			exp.Checkpoints = append(exp.Checkpoints, chk)
+		}
+	}
+
+	filesDir := ""
+	if len(run.Files) > 0 {
+		tempDir, err := ioutil.TempDir("", "replicate-wandb-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tempDir)
+		for _, file := range run.Files {
+			localPath := filepath.Join(tempDir, filepath.FromSlash(file.Name))
+			if !strings.HasPrefix(localPath, tempDir+string(filepath.Separator)) {
+				console.Warn("Skipping file with invalid name: %s", file.Name)
+				continue
+			}
+			if err := client.DownloadFile(file, localPath); err != nil {
+				return nil, err
+			}
+		}
+		filesDir = tempDir
+	}
+
+	// Only replace the existing experiment once everything has been
+	// fetched, so it isn't lost if fetching fails
+	if existing != nil {
+		if err := proj.DeleteExperiment(existing); err != nil {
+			return nil, err
+		}
+	}
+	if err := proj.ImportExperiment(exp, filesDir); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
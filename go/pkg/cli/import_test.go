@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/mlflow"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+	"github.com/replicate/replicate/go/pkg/wandb"
+)
+
+func TestExportAndImportMLflow(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	created := time.Date(2006, 1, 2, 14, 54, 5, 0, time.UTC)
+	primaryMetric := &project.PrimaryMetric{Name: "metric-1", Goal: project.GoalMinimize}
+	exp := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: created,
+		Params:  param.ValueMap{"param-1": param.Int(100), "param-2": param.String("hello")},
+		Command: "train.py --gamma=1.2 -x",
+		Config:  &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:            "1ccccccccc",
+			Created:       created.Add(5 * time.Minute),
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.1)},
+			PrimaryMetric: primaryMetric,
+			Step:          10,
+		}, {
+			ID:            "2ccccccccc",
+			Created:       created.Add(6 * time.Minute),
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.01)},
+			PrimaryMetric: primaryMetric,
+			Step:          20,
+		}, {
+			ID:            "3ccccccccc",
+			Created:       created.Add(7 * time.Minute),
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.02)},
+			PrimaryMetric: primaryMetric,
+			Step:          20,
+		}},
+	}
+	require.NoError(t, exp.Save(repo))
+	require.NoError(t, project.CreateHeartbeat(repo, exp.ID, time.Now().UTC()))
+	proj := project.NewProject(repo, workingDir)
+
+	mlrunsDir := filepath.Join(workingDir, "mlruns")
+	runDir, err := exportMLflow(proj, exp, mlrunsDir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(mlrunsDir, "0", exp.ID), runDir)
+	data, err := ioutil.ReadFile(filepath.Join(runDir, "params", "param-1"))
+	require.NoError(t, err)
+	require.Equal(t, "100", string(data))
+
+	run, err := mlflow.ReadRun(runDir)
+	require.NoError(t, err)
+	require.Equal(t, mlflow.StatusRunning, run.Status)
+	require.Len(t, run.Metrics["metric-1"], 3)
+	require.Equal(t, "train.py --gamma=1.2 -x", run.Tags[mlflowTagCommand])
+
+	// Import into a new repository
+	importRepo, err := repository.NewDiskRepository(path.Join(workingDir, "imported"))
+	require.NoError(t, err)
+	importProj := project.NewProject(importRepo, workingDir)
+	imported, err := importMLflowRun(importProj, importRepo.RootURL(), run)
+	require.NoError(t, err)
+
+	imported, err = importProj.ExperimentByID(imported.ID)
+	require.NoError(t, err)
+	require.Equal(t, exp.ID, imported.ID)
+	require.True(t, exp.Created.Equal(imported.Created))
+	require.Equal(t, exp.Command, imported.Command)
+	require.Equal(t, param.ValueMap{
+		"param-1": param.Int(100),
+		"param-2": param.String("hello"),
+	}, imported.Params)
+
+	// The two checkpoints at step 20 are merged
+	require.Len(t, imported.Checkpoints, 2)
+	require.Equal(t, int64(10), imported.Checkpoints[0].Step)
+	require.Equal(t, param.Float(0.1), imported.Checkpoints[0].Metrics["metric-1"])
+	require.Equal(t, int64(20), imported.Checkpoints[1].Step)
+	require.Equal(t, param.Float(0.02), imported.Checkpoints[1].Metrics["metric-1"])
+	require.Equal(t, &project.PrimaryMetric{Name: "metric-1", Goal: project.GoalMinimize}, imported.Checkpoints[1].PrimaryMetric)
+
+	// Importing again fails, rather than duplicating the experiment
+	_, err = importMLflowRun(importProj, importRepo.RootURL(), run)
+	require.Error(t, err)
+}
+
+func TestImportWandb(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	state := "running"
+	history := []string{
+		`{"_step": 0, "_timestamp": 1601553660, "loss": 0.5, "image": {"_type": "image-file"}}`,
+		`{"_step": 1, "_timestamp": 1601553720, "loss": 0.25}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/output.log" {
+			w.Write([]byte("hello"))
+			return
+		}
+		body := struct {
+			Variables map[string]interface{} `json:"variables"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if _, ok := body.Variables["run"]; ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"project": map[string]interface{}{
+						"run": map[string]interface{}{"history": history},
+					},
+				},
+			})
+			return
+		}
+		node := map[string]interface{}{
+			"name":        "abc123",
+			"state":       state,
+			"createdAt":   "2020-10-01T12:00:00",
+			"config":      `{"lr": {"value": 0.01}, "optimizer": {"value": "adam"}}`,
+			"user":        map[string]string{"username": "andreas"},
+			"historyKeys": map[string]interface{}{"lastStep": len(history) - 1},
+			"files": map[string]interface{}{"edges": []interface{}{
+				map[string]interface{}{"node": map[string]interface{}{"name": "output.log", "directUrl": "http://" + r.Host + "/files/output.log"}},
+			}},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"project": map[string]interface{}{
+					"runs": map[string]interface{}{
+						"edges":    []interface{}{map[string]interface{}{"node": node}},
+						"pageInfo": map[string]interface{}{"hasNextPage": false},
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+	client := wandb.NewClient(server.URL, "secret")
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	proj := project.NewProject(repo, workingDir)
+	require.NoError(t, importWandbProject(proj, repo.RootURL(), client, "my-team/my-project"))
+
+	experiments, err := proj.Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	exp := experiments[0]
+	require.Equal(t, wandbExperimentID("my-team", "my-project", "abc123"), exp.ID)
+	require.Equal(t, "andreas", exp.User)
+	require.Equal(t, &project.ImportRecord{Source: "wandb", RunID: "my-team/my-project/abc123", State: "running"}, exp.Imported)
+	require.Equal(t, param.ValueMap{
+		"lr":        param.Float(0.01),
+		"optimizer": param.String("adam"),
+	}, exp.Params)
+	require.Len(t, exp.Checkpoints, 2)
+	require.Equal(t, int64(1), exp.Checkpoints[1].Step)
+	require.Equal(t, param.ValueMap{"loss": param.Float(0.5)}, exp.Checkpoints[0].Metrics)
+	require.Equal(t, int64(1601553720), exp.Checkpoints[1].Created.Unix())
+
+	outputDir := path.Join(workingDir, "output")
+	require.NoError(t, proj.CheckoutCheckpoint(nil, exp, outputDir, true))
+	data, err := ioutil.ReadFile(path.Join(outputDir, "output.log"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	// Importing again picks up what the run logged since, because it
+	// hadn't finished
+	state = "finished"
+	history = append(history, `{"_step": 2, "_timestamp": 1601553780, "loss": 0.125}`)
+	require.NoError(t, importWandbProject(proj, repo.RootURL(), client, "my-team/my-project"))
+	experiments, err = proj.Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	require.Len(t, experiments[0].Checkpoints, 3)
+	require.Equal(t, "finished", experiments[0].Imported.State)
+
+	// Importing a finished run again skips it
+	history = append(history, `{"_step": 3, "_timestamp": 1601553840, "loss": 0.0625}`)
+	require.NoError(t, importWandbProject(proj, repo.RootURL(), client, "my-team/my-project"))
+	experiments, err = proj.Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	require.Len(t, experiments[0].Checkpoints, 3)
+
+	require.Error(t, importWandbProject(proj, repo.RootURL(), client, "my-project"))
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// interruptGracePeriod is how long a command has to stop after it is
+// interrupted, once its transfers have been cancelled
+const interruptGracePeriod = 15 * time.Second
+
+// handlesInterruptsAnnotation is set on commands that handle interrupts
+// themselves, so handleInterrupts isn't used for them
+const handlesInterruptsAnnotation = "handles-interrupts"
+
+// handleInterrupts cancels transfers when the command is interrupted with
+// Ctrl-C or SIGTERM, so multipart uploads are aborted rather than left in the
+// bucket, and the command fails with a hint about how to carry on. If it is
+// interrupted again, or doesn't stop within interruptGracePeriod, it exits
+// straight away.
+func handleInterrupts() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		console.Info("Stopping... (interrupt again to quit straight away)")
+		repository.CancelTransfers()
+		select {
+		case <-sigc:
+		case <-time.After(interruptGracePeriod):
+			console.Warn("Took longer than %s to stop, so quitting straight away", interruptGracePeriod)
+		}
+		os.Exit(130)
+	}()
+}
+
+// interruptedHint is appended to the error of a command whose transfers were
+// cancelled
+const interruptedHint = `
+
+Uploads and downloads that were in progress were stopped, and incomplete uploads were aborted. Run the command again to finish it. Commands that copy files, such as 'replicate push' and 'replicate mirror', skip what has already been copied.`
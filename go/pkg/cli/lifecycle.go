@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type lifecycleOpts struct {
+	repositoryURL string
+	dryRun        bool
+}
+
+func newLifecycleCommand() *cobra.Command {
+	var opts lifecycleOpts
+
+	cmd := &cobra.Command{
+		Use:   "lifecycle",
+		Short: "Set lifecycle rules on the repository's bucket to move old files to cheaper storage",
+		Long: `Set lifecycle rules on the repository's bucket to move old files to cheaper storage.
+
+The rules are defined in the 'lifecycle' section of replicate.yaml. The files of experiments and checkpoints are moved to the STANDARD_IA and GLACIER storage classes as they get older. Metadata is never moved, so 'replicate ls' and 'replicate show' stay fast. Files in GLACIER are restored when you check them out.
+
+Other lifecycle rules on the bucket are left as they are. Only S3 repositories are supported. For Google Cloud Storage repositories, use 'replicate archive' instead.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return setLifecycle(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `See what rules would be set:
+replicate lifecycle --dry-run`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show the rules without setting them")
+
+	return cmd
+}
+
+func setLifecycle(opts lifecycleOpts, out io.Writer) error {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return err
+	}
+	if conf.Lifecycle == nil {
+		return fmt.Errorf("replicate.yaml doesn't have a 'lifecycle' section, so there are no rules to set. To define lifecycle rules, take a look at the replicate.yaml reference:\n%s/docs/reference/yaml", global.WebURL)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	manager, ok := repository.AsLifecycleManager(repo)
+	if !ok {
+		return lifecycleUnsupportedError(repo.RootURL())
+	}
+
+	rules := lifecycleRules(conf.Lifecycle)
+	if opts.dryRun {
+		fmt.Fprintf(out, "This would set these lifecycle rules on %s:\n", repo.RootURL())
+	} else {
+		fmt.Fprintf(out, "Setting these lifecycle rules on %s:\n", repo.RootURL())
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(out, "  %s\n", describeLifecycleRule(rule))
+	}
+	if opts.dryRun {
+		return nil
+	}
+	if err := manager.SetLifecycleRules(rules); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Done.")
+	return nil
+}
+
+// lifecycleUnsupportedError returns the error for a repository that lifecycle
+// rules can't be set on
+func lifecycleUnsupportedError(repositoryURL string) error {
+	if strings.HasPrefix(repositoryURL, "gs://") {
+		// GCS rules can only be limited to a prefix with a newer version of
+		// cloud.google.com/go/storage, and a rule for the whole bucket
+		// would move metadata too
+		return fmt.Errorf(`Lifecycle rules can't be set on Google Cloud Storage repositories yet, and the repository is %s.
+
+To move old files to cheaper storage classes, use 'replicate archive', or add rules to the bucket in the Google Cloud console with a "matchesPrefix" condition for the experiments/ and checkpoints/ folders in the repository. Don't add rules for the whole bucket, because moving metadata makes listing experiments slow and expensive.`, repositoryURL)
+	}
+	return fmt.Errorf("Lifecycle rules can only be set on S3 repositories, and the repository is %s", repositoryURL)
+}
+
+// lifecycleRules returns a rule for each kind of file in the repository. A
+// kind that isn't in the config gets a rule without transitions, so its rule
+// is removed from the bucket.
+func lifecycleRules(l *config.Lifecycle) []repository.LifecycleRule {
+	rules := []repository.LifecycleRule{}
+	for _, kind := range []struct {
+		prefix      string
+		transitions *config.LifecycleTransitions
+	}{
+		{"experiments", l.Experiments},
+		{"checkpoints", l.Checkpoints},
+	} {
+		rule := repository.LifecycleRule{Prefix: kind.prefix}
+		if kind.transitions != nil {
+			rule.InfrequentAccessAfterDays = kind.transitions.InfrequentAccessAfterDays
+			rule.ArchiveAfterDays = kind.transitions.ArchiveAfterDays
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func describeLifecycleRule(rule repository.LifecycleRule) string {
+	moves := []string{}
+	if rule.InfrequentAccessAfterDays > 0 {
+		moves = append(moves, fmt.Sprintf("to STANDARD_IA after %d days", rule.InfrequentAccessAfterDays))
+	}
+	if rule.ArchiveAfterDays > 0 {
+		moves = append(moves, fmt.Sprintf("to GLACIER after %d days", rule.ArchiveAfterDays))
+	}
+	if len(moves) == 0 {
+		return rule.Prefix + ": not moved"
+	}
+	return rule.Prefix + ": moved " + strings.Join(moves, ", then ")
+}
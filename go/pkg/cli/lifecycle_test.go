@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestLifecycleRules(t *testing.T) {
+	rules := lifecycleRules(&config.Lifecycle{
+		Checkpoints: &config.LifecycleTransitions{InfrequentAccessAfterDays: 30, ArchiveAfterDays: 90},
+	})
+	require.Equal(t, []repository.LifecycleRule{
+		{Prefix: "experiments"},
+		{Prefix: "checkpoints", InfrequentAccessAfterDays: 30, ArchiveAfterDays: 90},
+	}, rules)
+
+	require.Equal(t, "experiments: not moved", describeLifecycleRule(rules[0]))
+	require.Equal(t, "checkpoints: moved to STANDARD_IA after 30 days, then to GLACIER after 90 days", describeLifecycleRule(rules[1]))
+	require.Equal(t, "checkpoints: moved to GLACIER after 180 days", describeLifecycleRule(repository.LifecycleRule{Prefix: "checkpoints", ArchiveAfterDays: 180}))
+}
+
+func TestLifecycleUnsupported(t *testing.T) {
+	err := lifecycleUnsupportedError("gs://my-bucket")
+	require.Contains(t, err.Error(), "Google Cloud Storage")
+	require.Contains(t, err.Error(), "replicate archive")
+
+	err = lifecycleUnsupportedError("file:///tmp/repo")
+	require.EqualError(t, err, "Lifecycle rules can only be set on S3 repositories, and the repository is file:///tmp/repo")
+}
@@ -6,7 +6,12 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/replicate/go/pkg/cli/list"
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
 	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
 )
 
 func newListCommand() *cobra.Command {
@@ -28,6 +33,9 @@ $ replicate ls --filter "optimizer = adam" --filter "accuracy > 0.8"
 
 Sort all stopped experiments by the metric "val_loss":
 $ replicate ls --sort "val_loss" --filter "status = stopped"
+
+Save the params and metrics of every checkpoint to a CSV file:
+$ replicate ls --format csv > results.csv
 `,
 	}
 
@@ -60,25 +68,68 @@ func listExperiments(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return list.Experiments(repo, format, all, filters, sortKey)
+	if err := list.Experiments(repo, format, all, filters, sortKey); err != nil {
+		return err
+	}
+	warnAboutQuota(repo, projectDir)
+	return nil
+}
+
+// warnAboutQuota warns if the usage that was last recorded is past a limit
+// in replicate.yaml. It doesn't measure usage, so it doesn't slow down
+// listing.
+func warnAboutQuota(repo repository.Repository, projectDir string) {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil || conf.Quota == nil {
+		return
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetQuota(conf.Quota)
+	usage, err := proj.LoadUsage()
+	if err != nil {
+		console.Debug("Failed to load storage usage: %s", err)
+		return
+	}
+	for _, warning := range proj.QuotaWarnings(usage, project.CurrentUsername()) {
+		console.Warn("%s", warning)
+	}
 }
 
 func addListFormatFlags(cmd *cobra.Command) {
-	cmd.Flags().Bool("json", false, "Print output in JSON format")
+	cmd.Flags().String("format", "table", "Output format: table, json, csv, or tsv. csv and tsv have a row for each checkpoint")
+	cmd.Flags().Bool("json", false, "Print output in JSON format (same as --format json)")
 	cmd.Flags().Bool("all", false, "Output all params and metrics. Default: only params/metrics that differ")
 	cmd.Flags().BoolP("quiet", "q", false, "Only print experiment IDs")
 }
 
 // FIXME(bfirsh): use an opts struct and the "Var" version of flag functions to get rid of this
 func parseListFormatFlags(cmd *cobra.Command) (format list.Format, all bool, err error) {
+	formatString, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return 0, false, err
+	}
+	switch formatString {
+	case "table":
+		format = list.FormatTable
+	case "json":
+		format = list.FormatJSON
+	case "csv":
+		format = list.FormatCSV
+	case "tsv":
+		format = list.FormatTSV
+	default:
+		return 0, false, fmt.Errorf("Unknown format: %s. It must be one of: table, json, csv, tsv", formatString)
+	}
+
 	json, err := cmd.Flags().GetBool("json")
 	if err != nil {
 		return 0, false, err
 	}
 	if json {
+		if format != list.FormatTable && format != list.FormatJSON {
+			return 0, false, fmt.Errorf("Cannot use the --json flag in combination with --format %s", formatString)
+		}
 		format = list.FormatJSON
-	} else {
-		format = list.FormatTable
 	}
 
 	quiet, err := cmd.Flags().GetBool("quiet")
@@ -88,6 +139,9 @@ func parseListFormatFlags(cmd *cobra.Command) (format list.Format, all bool, err
 	if quiet && format == list.FormatJSON {
 		return 0, false, fmt.Errorf("Cannot use the --quiet flag in combination with --json")
 	}
+	if quiet && format != list.FormatTable {
+		return 0, false, fmt.Errorf("Cannot use the --quiet flag in combination with --format %s", formatString)
+	}
 
 	all, err = cmd.Flags().GetBool("all")
 	if err != nil {
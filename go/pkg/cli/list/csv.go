@@ -0,0 +1,147 @@
+package list
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+// outputCSV prints a row for each checkpoint, with a column for each param
+// and metric, so it can be loaded into pandas or a spreadsheet. Experiments
+// without any checkpoints get a single row with the checkpoint columns empty.
+//
+// Params and metrics that are objects are flattened into a column for each
+// key, e.g. the param {"optimizer": {"lr": 0.01}} becomes "params.optimizer.lr".
+func outputCSV(experiments []*ListExperiment, comma rune) error {
+	type row struct {
+		exp     *ListExperiment
+		chk     *project.Checkpoint
+		params  map[string]string
+		metrics map[string]string
+	}
+
+	rows := []*row{}
+	paramNames := map[string]bool{}
+	metricNames := map[string]bool{}
+	for _, exp := range experiments {
+		params := flattenValues(exp.Params)
+		for name := range params {
+			paramNames[name] = true
+		}
+		if len(exp.Checkpoints) == 0 {
+			rows = append(rows, &row{exp: exp, params: params, metrics: map[string]string{}})
+			continue
+		}
+		checkpoints := make([]*project.Checkpoint, len(exp.Checkpoints))
+		copy(checkpoints, exp.Checkpoints)
+		sort.SliceStable(checkpoints, func(i, j int) bool {
+			return checkpoints[i].Created.Before(checkpoints[j].Created)
+		})
+		for _, chk := range checkpoints {
+			metrics := flattenValues(chk.Metrics)
+			for name := range metrics {
+				metricNames[name] = true
+			}
+			rows = append(rows, &row{exp: exp, chk: chk, params: params, metrics: metrics})
+		}
+	}
+
+	sortedParamNames := sortedKeys(paramNames)
+	sortedMetricNames := sortedKeys(metricNames)
+
+	w := csv.NewWriter(os.Stdout)
+	w.Comma = comma
+
+	heading := []string{"experiment", "experiment_created", "checkpoint", "checkpoint_created", "step", "status", "host", "user", "command"}
+	for _, name := range sortedParamNames {
+		heading = append(heading, "params."+name)
+	}
+	for _, name := range sortedMetricNames {
+		heading = append(heading, "metrics."+name)
+	}
+	if err := w.Write(heading); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		checkpointID, checkpointCreated, step := "", "", ""
+		if r.chk != nil {
+			checkpointID = r.chk.ID
+			checkpointCreated = r.chk.Created.UTC().Format(time.RFC3339)
+			step = strconv.FormatInt(r.chk.Step, 10)
+		}
+		record := []string{r.exp.ID, r.exp.Created.UTC().Format(time.RFC3339), checkpointID, checkpointCreated, step, r.exp.Status(), r.exp.Host, r.exp.User, r.exp.Command}
+		for _, name := range sortedParamNames {
+			record = append(record, r.params[name])
+		}
+		for _, name := range sortedMetricNames {
+			record = append(record, r.metrics[name])
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// flattenValues converts params or metrics to strings for a CSV file,
+// flattening objects into dot-separated keys
+func flattenValues(values param.ValueMap) map[string]string {
+	result := map[string]string{}
+	for name, v := range values {
+		if v.Type() == param.TypeObject {
+			if obj, ok := v.ObjectVal().(map[string]interface{}); ok {
+				flattenObject(result, name, obj)
+				continue
+			}
+		}
+		result[name] = csvString(v)
+	}
+	return result
+}
+
+func flattenObject(result map[string]string, prefix string, obj map[string]interface{}) {
+	for key, val := range obj {
+		name := prefix + "." + key
+		if nested, ok := val.(map[string]interface{}); ok {
+			flattenObject(result, name, nested)
+			continue
+		}
+		switch val := val.(type) {
+		case nil:
+			result[name] = ""
+		case string:
+			result[name] = val
+		default:
+			data, err := json.Marshal(val)
+			if err != nil {
+				continue
+			}
+			result[name] = string(data)
+		}
+	}
+}
+
+// csvString returns a value as a string, with None as an empty cell
+func csvString(v param.Value) string {
+	if v.IsNone() {
+		return ""
+	}
+	return v.String()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
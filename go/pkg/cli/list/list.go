@@ -25,6 +25,8 @@ const (
 	FormatJSON = iota
 	FormatTable
 	FormatQuiet
+	FormatCSV
+	FormatTSV
 )
 
 const valueMaxLength = 20
@@ -32,6 +34,7 @@ const valueTruncate = 5
 
 type ListExperiment struct {
 	ID               string              `json:"id"`
+	Name             string              `json:"name,omitempty"`
 	Created          time.Time           `json:"created"`
 	Params           param.ValueMap      `json:"params"`
 	Command          string              `json:"command"`
@@ -41,9 +44,26 @@ type ListExperiment struct {
 	User             string              `json:"user"`
 	Host             string              `json:"host"`
 	Running          bool                `json:"running"`
+	Archived         bool                `json:"archived,omitempty"`
+	Alerts           []string            `json:"alerts,omitempty"`
 
-	// exclude config from json output
-	Config *config.Config `json:"-"`
+	Datasets []*project.DatasetFingerprint `json:"datasets,omitempty"`
+
+	// exclude config and the full list of checkpoints from json output
+	Config      *config.Config        `json:"-"`
+	Checkpoints []*project.Checkpoint `json:"-"`
+}
+
+// Status returns whether the experiment is running, stopped, or stopped and
+// archived
+func (exp *ListExperiment) Status() string {
+	if exp.Running {
+		return "running"
+	}
+	if exp.Archived {
+		return "archived"
+	}
+	return "stopped"
 }
 
 // We should add some validation and better error messages, see https://github.com/replicate/replicate/issues/340
@@ -58,6 +78,9 @@ func (exp *ListExperiment) GetValue(name string) param.Value {
 		}
 		return param.Int(0)
 	}
+	if name == "name" {
+		return param.String(exp.Name)
+	}
 	if name == "user" {
 		return param.String(exp.User)
 	}
@@ -68,10 +91,19 @@ func (exp *ListExperiment) GetValue(name string) param.Value {
 		return param.String(exp.Command)
 	}
 	if name == "status" {
-		if exp.Running {
-			return param.String("running")
+		return param.String(exp.Status())
+	}
+	if name == "alerts" {
+		return param.Int(int64(len(exp.Alerts)))
+	}
+	if strings.HasPrefix(name, project.DatasetFilterPrefix) {
+		datasetName := strings.TrimPrefix(name, project.DatasetFilterPrefix)
+		for _, d := range exp.Datasets {
+			if d.Name == datasetName {
+				return param.String(d.Fingerprint())
+			}
 		}
-		return param.String("stopped")
+		return param.None()
 	}
 	if exp.BestCheckpoint != nil {
 		if val, ok := exp.BestCheckpoint.Metrics[name]; ok {
@@ -86,7 +118,7 @@ func (exp *ListExperiment) GetValue(name string) param.Value {
 
 func Experiments(repo repository.Repository, format Format, all bool, filters *param.Filters, sorter *param.Sorter) error {
 	proj := project.NewProject(repo, "")
-	listExperiments, err := createListExperiments(proj, filters)
+	listExperiments, err := FilterExperiments(proj, filters)
 	if err != nil {
 		return err
 	}
@@ -101,6 +133,10 @@ func Experiments(repo repository.Repository, format Format, all bool, filters *p
 		return outputTable(listExperiments, all)
 	case FormatQuiet:
 		return outputQuiet(listExperiments)
+	case FormatCSV:
+		return outputCSV(listExperiments, ',')
+	case FormatTSV:
+		return outputCSV(listExperiments, '\t')
 	}
 	panic(fmt.Sprintf("Unknown format: %d", format))
 }
@@ -137,10 +173,18 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 	}
 
 	// Hide various fields if they are all the same
+	displayName := false
+	displayAlerts := false
 	displayHost := false
 	displayUser := false
 	prevExp := experiments[0]
 	for _, exp := range experiments {
+		if exp.Name != "" {
+			displayName = true
+		}
+		if len(exp.Alerts) > 0 {
+			displayAlerts = true
+		}
 		if exp.Host != prevExp.Host {
 			displayHost = true
 		}
@@ -151,7 +195,11 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 
-	headings := []string{"EXPERIMENT", "STARTED", "STATUS"}
+	headings := []string{"EXPERIMENT"}
+	if displayName {
+		headings = append(headings, "NAME")
+	}
+	headings = append(headings, "STARTED", "STATUS")
 	if displayHost {
 		headings = append(headings, "HOST")
 	}
@@ -163,6 +211,9 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 		headings = append(headings, "BEST CHECKPOINT")
 	}
 	headings = append(headings, "LATEST CHECKPOINT")
+	if displayAlerts {
+		headings = append(headings, "ALERTS")
+	}
 
 	for i, key := range headings {
 		fmt.Fprintf(tw, "%s", key)
@@ -173,12 +224,12 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 	fmt.Fprint(tw, "\n")
 
 	for _, exp := range experiments {
-		columns := []string{exp.ID[:7], console.FormatTime(exp.Created)}
-		if exp.Running {
-			columns = append(columns, "running")
-		} else {
-			columns = append(columns, "stopped")
+		columns := []string{exp.ID[:7]}
+		if displayName {
+			columns = append(columns, exp.Name)
 		}
+		columns = append(columns, console.FormatTime(exp.Created))
+		columns = append(columns, exp.Status())
 
 		if displayHost {
 			columns = append(columns, exp.Host)
@@ -210,6 +261,10 @@ func outputTable(experiments []*ListExperiment, all bool) error {
 		}
 		columns = append(columns, latestCheckpoint)
 
+		if displayAlerts {
+			columns = append(columns, strings.Join(exp.Alerts, "\n"))
+		}
+
 		writeRow(tw, columns)
 
 	}
@@ -339,7 +394,9 @@ func getMetricsToDisplay(experiments []*ListExperiment, all bool) []string {
 	return slices.StringKeys(metricsToDisplay)
 }
 
-func createListExperiments(proj *project.Project, filters *param.Filters) ([]*ListExperiment, error) {
+// FilterExperiments returns the experiments in proj that match filters, in
+// the order they were created
+func FilterExperiments(proj *project.Project, filters *param.Filters) ([]*ListExperiment, error) {
 	experiments, err := proj.Experiments()
 	if err != nil {
 		return nil, err
@@ -348,12 +405,15 @@ func createListExperiments(proj *project.Project, filters *param.Filters) ([]*Li
 	for _, exp := range experiments {
 		listExperiment := &ListExperiment{
 			ID:      exp.ID,
+			Name:    exp.Name,
 			Params:  exp.Params,
 			Command: exp.Command,
 			Created: exp.Created,
 			Host:    exp.Host,
 			User:    exp.User,
 			Config:  exp.Config,
+
+			Datasets: exp.Datasets,
 		}
 		running, err := proj.ExperimentIsRunning(exp.ID)
 		if err != nil {
@@ -362,7 +422,12 @@ func createListExperiments(proj *project.Project, filters *param.Filters) ([]*Li
 		listExperiment.LatestCheckpoint = exp.LatestCheckpoint()
 		listExperiment.BestCheckpoint = exp.BestCheckpoint()
 		listExperiment.NumCheckpoints = len(exp.Checkpoints)
+		listExperiment.Checkpoints = exp.Checkpoints
 		listExperiment.Running = running
+		listExperiment.Archived = exp.Archived != nil
+		for _, alert := range exp.Alerts {
+			listExperiment.Alerts = append(listExperiment.Alerts, alert.Name)
+		}
 
 		match, err := filters.Matches(listExperiment)
 		if err != nil {
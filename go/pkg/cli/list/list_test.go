@@ -1,10 +1,12 @@
 package list
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -336,3 +338,49 @@ func TestListJSON(t *testing.T) {
 	require.Equal(t, param.Float(0.987), experiments[1].LatestCheckpoint.Metrics["accuracy"])
 	require.Equal(t, true, experiments[1].Running)
 }
+
+func TestListCSV(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	conf := &config.Config{}
+	repo := createTestData(t, workingDir, conf)
+
+	actual := capturer.CaptureStdout(func() {
+		err = Experiments(repo, FormatTSV, false, new(param.Filters), &param.Sorter{Key: "started"})
+	})
+	require.NoError(t, err)
+
+	r := csv.NewReader(strings.NewReader(actual))
+	r.Comma = '\t'
+	records, err := r.ReadAll()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"experiment", "experiment_created", "checkpoint", "checkpoint_created", "step", "status", "host", "user", "command",
+		"params.param-1", "params.param-2", "params.param-3", "params.param-4",
+		"metrics.metric-1", "metrics.metric-2", "metrics.metric-3",
+	}, records[0])
+
+	// One row per checkpoint, and one for the experiment without checkpoints
+	require.Len(t, records, 6)
+	columns := func(record []string) []string {
+		return append([]string{record[0], record[2], record[4], record[5]}, record[9:]...)
+	}
+	require.Equal(t, []string{"3eeeeeeeee", "", "", "stopped", "200", "hello", "hi", "", "", "", ""}, columns(records[1]))
+	require.Equal(t, []string{"2eeeeeeeee", "4ccccccccc", "5", "stopped", "200", "hello", "hi", "", "", "", "0.5"}, columns(records[2]))
+	require.Equal(t, []string{"1eeeeeeeee", "1ccccccccc", "10", "running", "100", "hello", "", "", "0.1", "2", ""}, columns(records[3]))
+	require.Equal(t, "train.py --foo bar", records[3][8])
+}
+
+func TestFlattenValues(t *testing.T) {
+	var obj param.Value
+	require.NoError(t, json.Unmarshal([]byte(`{"optimizer": {"name": "adam", "lr": 0.01}, "layers": [1, 2]}`), &obj))
+	require.Equal(t, map[string]string{
+		"config.optimizer.name": "adam",
+		"config.optimizer.lr":   "0.01",
+		"config.layers":         "[1,2]",
+		"seed":                  "42",
+	}, flattenValues(param.ValueMap{"config": obj, "seed": param.Int(42)}))
+}
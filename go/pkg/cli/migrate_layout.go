@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type migrateLayoutOpts struct {
+	repositoryURL string
+	dryRun        bool
+	force         bool
+}
+
+func newMigrateLayoutCommand() *cobra.Command {
+	var opts migrateLayoutOpts
+
+	cmd := &cobra.Command{
+		Use:   "migrate-layout",
+		Short: "Move the files of existing experiments and checkpoints into the layout in replicate.yaml",
+		Long: `Move the files of existing experiments and checkpoints into the layout in replicate.yaml.
+
+The 'layout' section of replicate.yaml sets where the files of new experiments and checkpoints are stored in the repository. Each experiment and checkpoint records where its files are, so existing ones keep working when the layout changes, and this command moves them into the new layout.
+
+Files are copied to their new paths before the metadata is updated, and the old files are only deleted after that, so nothing is lost if it is interrupted. Running experiments aren't moved. While it runs, the repository is locked, so other maintenance can't run at the same time, and experiments wait before they save anything.
+
+Trash entries and snapshots still refer to the old paths, so take a new snapshot afterwards with 'replicate snapshot create'.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return migrateLayout(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `See what would be moved:
+replicate migrate-layout --dry-run`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show what would be moved without moving anything")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Move without interactive prompt")
+
+	return cmd
+}
+
+func migrateLayout(opts migrateLayoutOpts, out io.Writer) error {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return err
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetLayout(conf.Layout, conf.Project)
+
+	moves, err := proj.PlanLayoutMigration()
+	if err != nil {
+		return err
+	}
+	if len(moves) == 0 {
+		fmt.Fprintln(out, "Everything is already in the layout.")
+		return nil
+	}
+
+	if opts.dryRun {
+		fmt.Fprintln(out, "This would move:")
+	} else {
+		fmt.Fprintln(out, "You are about to move:")
+	}
+	for _, move := range moves {
+		if move.Checkpoint == nil {
+			fmt.Fprintf(out, "* Experiment %s: %s -> %s\n", move.Experiment.ShortID(), move.From, move.To)
+		} else {
+			fmt.Fprintf(out, "* Checkpoint %s of experiment %s: %s -> %s\n", move.Checkpoint.ShortID(), move.Experiment.ShortID(), move.From, move.To)
+		}
+	}
+
+	if opts.dryRun {
+		return nil
+	}
+	if !opts.force {
+		continueMigrate, err := console.InteractiveBool{
+			Prompt:  "\nDo you want to continue?",
+			Default: false,
+		}.Read()
+		if err != nil {
+			return err
+		}
+		if !continueMigrate {
+			return nil
+		}
+	}
+
+	console.Info("Moving files...")
+	return proj.MigrateLayout(moves)
+}
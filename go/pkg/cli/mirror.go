@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type mirrorOpts struct {
+	repositoryURL string
+	mirrorURL     string
+	status        bool
+	delete        bool
+	watch         bool
+	interval      time.Duration
+}
+
+func newMirrorCommand() *cobra.Command {
+	var opts mirrorOpts
+
+	cmd := &cobra.Command{
+		Use:   "mirror",
+		Short: "Copy the repository to a mirror, for disaster recovery",
+		Long: `Copy the repository to a mirror, for disaster recovery.
+
+The mirror is the repository URL in 'mirror' in replicate.yaml, or the one passed with --to. It can be in another region, bucket, or cloud. New and changed experiments and checkpoints are copied to it. Files that have been deleted from the repository, e.g. by 'replicate prune', are left in the mirror unless --delete is passed, so a mistake in the repository can't also remove the mirror's copy.
+
+Use --watch to keep the mirror up to date continuously, and --status to see how far behind it is.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return mirror(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Mirror the repository every 5 minutes:
+replicate mirror --watch
+
+See what hasn't been mirrored yet:
+replicate mirror --status`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.mirrorURL, "to", "", "Repository URL of the mirror (default: 'mirror' in replicate.yaml)")
+	cmd.Flags().BoolVar(&opts.status, "status", false, "Show what hasn't been mirrored yet, without copying anything")
+	cmd.Flags().BoolVar(&opts.delete, "delete", false, "Also delete files from the mirror that have been deleted from the repository")
+	cmd.Flags().BoolVar(&opts.watch, "watch", false, "Keep mirroring until interrupted")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 5*time.Minute, "How often to mirror with --watch")
+
+	return cmd
+}
+
+func mirror(opts mirrorOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	mirrorURL := opts.mirrorURL
+	if mirrorURL == "" {
+		conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+		if err != nil {
+			return err
+		}
+		if conf.Mirror == "" {
+			return fmt.Errorf("No mirror is defined. Set 'mirror' in replicate.yaml to a repository URL, or pass one with --to")
+		}
+		mirrorURL = conf.Mirror
+	}
+
+	source, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	dest, err := repository.ForURL(mirrorURL, projectDir)
+	if err != nil {
+		return err
+	}
+	if source.RootURL() == dest.RootURL() {
+		return fmt.Errorf("The mirror can't be the same as the repository (%s)", source.RootURL())
+	}
+
+	if opts.status {
+		return mirrorStatus(source, dest, opts.delete, projectDir, time.Now().UTC(), out)
+	}
+	for {
+		err := mirrorOnce(source, dest, opts.delete)
+		if !opts.watch {
+			return err
+		}
+		// Keep going, in case the error was temporary
+		if err != nil {
+			console.Warn("Failed to mirror %s to %s: %v", source.RootURL(), dest.RootURL(), err)
+		}
+		time.Sleep(opts.interval)
+	}
+}
+
+func mirrorOnce(source, dest repository.Repository, deleteRemoved bool) error {
+	plan, err := planMirror(source, dest, deleteRemoved)
+	if err != nil {
+		return err
+	}
+	if len(plan.Copy) == 0 && len(plan.Delete) == 0 {
+		console.Info("%s is up to date", dest.RootURL())
+		return nil
+	}
+	if deleteRemoved {
+		console.Info("Copying %d files (%s) to %s, and deleting %d files from it...", len(plan.Copy), formatBytes(totalSize(plan.Copy)), dest.RootURL(), len(plan.Delete))
+	} else {
+		console.Info("Copying %d files (%s) to %s...", len(plan.Copy), formatBytes(totalSize(plan.Copy)), dest.RootURL())
+	}
+	if err := plan.Apply(); err != nil {
+		return err
+	}
+	console.Info("Mirrored %s to %s", source.RootURL(), dest.RootURL())
+	return nil
+}
+
+// mirrorStatus shows what hasn't been mirrored yet, and the lag, which is the
+// age of the oldest experiment or checkpoint that hasn't been mirrored
+func mirrorStatus(source, dest repository.Repository, deleteRemoved bool, projectDir string, now time.Time, out io.Writer) error {
+	plan, err := planMirror(source, dest, deleteRemoved)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Mirror of %s at %s\n", source.RootURL(), dest.RootURL())
+	if len(plan.Copy) == 0 && len(plan.Delete) == 0 {
+		fmt.Fprintln(out, "The mirror is up to date.")
+		return nil
+	}
+	fmt.Fprintf(out, "Files not mirrored yet: %d (%s)\n", len(plan.Copy), formatBytes(totalSize(plan.Copy)))
+	if deleteRemoved {
+		fmt.Fprintf(out, "Files to delete from the mirror: %d\n", len(plan.Delete))
+	}
+
+	proj := project.NewProject(source, projectDir)
+	oldest, description, err := oldestUnmirrored(proj, dest, plan)
+	if err != nil {
+		return err
+	}
+	if description != "" {
+		fmt.Fprintf(out, "Lag: %s, since %s\n", now.Sub(oldest).Round(time.Second), description)
+	}
+	return nil
+}
+
+// planMirror returns the changes that make dest match source. Heartbeats
+// aren't mirrored, because experiments in the mirror aren't running. Files
+// are only deleted from dest if deleteRemoved is set.
+func planMirror(source, dest repository.Repository, deleteRemoved bool) (*repository.SyncPlan, error) {
+	plan, err := repository.PlanSync(source, "", dest, "")
+	if err != nil {
+		return nil, err
+	}
+	files := []repository.ListResult{}
+	for _, f := range plan.Copy {
+		if !isHeartbeatPath(f.Path) {
+			files = append(files, f)
+		}
+	}
+	plan.Copy = files
+	paths := []string{}
+	for _, p := range plan.Delete {
+		if deleteRemoved && !isHeartbeatPath(p) {
+			paths = append(paths, p)
+		}
+	}
+	plan.Delete = paths
+	return plan, nil
+}
+
+func isHeartbeatPath(p string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(p, "/"), "metadata/heartbeats/")
+}
+
+// oldestUnmirrored returns when the oldest change that hasn't been mirrored
+// was made, and a description of it. If an experiment's metadata is in the
+// mirror but has changed, the change is taken to be its latest checkpoint.
+func oldestUnmirrored(proj *project.Project, dest repository.Repository, plan *repository.SyncPlan) (time.Time, string, error) {
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	mirroredPaths, err := dest.List("metadata/experiments")
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	mirroredMetadata := map[string]bool{}
+	for _, p := range mirroredPaths {
+		mirroredMetadata[p] = true
+	}
+	experimentsByID := map[string]*project.Experiment{}
+	checkpointsByID := map[string]*project.Checkpoint{}
+	for _, exp := range experiments {
+		experimentsByID[exp.ID] = exp
+		for _, chk := range exp.Checkpoints {
+			checkpointsByID[chk.ID] = chk
+		}
+	}
+
+	var oldest time.Time
+	description := ""
+	consider := func(t time.Time, desc string) {
+		if description == "" || t.Before(oldest) {
+			oldest, description = t, desc
+		}
+	}
+	for _, f := range plan.Copy {
+		p := strings.TrimPrefix(f.Path, "/")
+		switch {
+		case strings.HasPrefix(p, "metadata/experiments/"):
+			id := strings.TrimSuffix(strings.TrimPrefix(p, "metadata/experiments/"), ".json")
+			if exp, ok := experimentsByID[id]; ok {
+				if chk := exp.LatestCheckpoint(); chk != nil && mirroredMetadata[p] {
+					consider(chk.Created, "checkpoint "+chk.ShortID()+" was created")
+				} else {
+					consider(exp.Created, "experiment "+exp.ShortID()+" was created")
+				}
+			}
+		case strings.HasPrefix(p, "metadata/events/"):
+			// Events are written when checkpoints are added
+			id := path.Base(path.Dir(p))
+			if exp, ok := experimentsByID[id]; ok {
+				if chk := exp.LatestCheckpoint(); chk != nil {
+					consider(chk.Created, "checkpoint "+chk.ShortID()+" was created")
+				}
+			}
+		case strings.HasPrefix(p, "experiments/"):
+			id := strings.TrimSuffix(strings.TrimPrefix(p, "experiments/"), ".tar.gz")
+			if exp, ok := experimentsByID[id]; ok {
+				consider(exp.Created, "experiment "+exp.ShortID()+" was created")
+			}
+		case strings.HasPrefix(p, "checkpoints/"):
+			// Weights and artifacts are in checkpoints/<ID>.<tree>.tar.gz
+			id := strings.SplitN(strings.TrimPrefix(p, "checkpoints/"), ".", 2)[0]
+			if chk, ok := checkpointsByID[id]; ok {
+				consider(chk.Created, "checkpoint "+chk.ShortID()+" was created")
+			}
+		case strings.HasPrefix(p, "chunks/manifests/"):
+			id := strings.TrimSuffix(strings.TrimPrefix(p, "chunks/manifests/"), ".json")
+			if chk, ok := checkpointsByID[id]; ok {
+				consider(chk.Created, "checkpoint "+chk.ShortID()+" was created")
+			}
+		}
+	}
+	return oldest, description, nil
+}
+
+func totalSize(files []repository.ListResult) int64 {
+	var total int64
+	for _, f := range files {
+		total += f.Size
+	}
+	return total
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestMirror(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	source, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	dest, err := repository.NewDiskRepository(path.Join(workingDir, "mirror"))
+	require.NoError(t, err)
+	now, err := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	require.NoError(t, err)
+	for _, exp := range []*project.Experiment{
+		{ID: "1eeeeeeeee", Created: now.Add(-10 * time.Minute), Config: &config.Config{}},
+		{ID: "2eeeeeeeee", Created: now.Add(-1 * time.Minute), Config: &config.Config{}},
+	} {
+		require.NoError(t, exp.Save(source))
+	}
+	require.NoError(t, project.CreateHeartbeat(source, "1eeeeeeeee", now))
+
+	out := new(bytes.Buffer)
+	require.NoError(t, mirrorStatus(source, dest, true, workingDir, now, out))
+	require.Contains(t, out.String(), "Files not mirrored yet: 2 ")
+	require.Contains(t, out.String(), "Files to delete from the mirror: 0\n")
+	require.Contains(t, out.String(), "Lag: 10m0s, since experiment 1eeeeee was created\n")
+
+	require.NoError(t, mirrorOnce(source, dest, false))
+	_, err = dest.Get("metadata/experiments/1eeeeeeeee.json")
+	require.NoError(t, err)
+	_, err = dest.Get("metadata/heartbeats/1eeeeeeeee.json")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	out = new(bytes.Buffer)
+	require.NoError(t, mirrorStatus(source, dest, false, workingDir, now, out))
+	require.Contains(t, out.String(), "The mirror is up to date.\n")
+
+	// Deleted experiments are only deleted from the mirror with --delete
+	require.NoError(t, source.Delete("metadata/experiments/2eeeeeeeee.json"))
+	out = new(bytes.Buffer)
+	require.NoError(t, mirrorStatus(source, dest, false, workingDir, now, out))
+	require.Contains(t, out.String(), "The mirror is up to date.\n")
+	require.NoError(t, mirrorOnce(source, dest, false))
+	_, err = dest.Get("metadata/experiments/2eeeeeeeee.json")
+	require.NoError(t, err)
+	require.NoError(t, mirrorOnce(source, dest, true))
+	_, err = dest.Get("metadata/experiments/2eeeeeeeee.json")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	// Changed experiments lag from their latest checkpoint
+	exp := &project.Experiment{ID: "3eeeeeeeee", Created: now.Add(-30 * time.Minute)}
+	require.NoError(t, exp.Save(dest))
+	exp.Checkpoints = []*project.Checkpoint{{ID: "5ccccccccc", Created: now.Add(-1 * time.Minute)}}
+	require.NoError(t, exp.Save(source))
+	out = new(bytes.Buffer)
+	require.NoError(t, mirrorStatus(source, dest, false, workingDir, now, out))
+	require.Contains(t, out.String(), "Lag: 1m0s, since checkpoint 5cccccc was created\n")
+}
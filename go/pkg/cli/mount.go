@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/mount"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type mountOpts struct {
+	repositoryURL string
+	cacheDir      string
+	allowOther    bool
+}
+
+func newMountCommand() *cobra.Command {
+	var opts mountOpts
+
+	cmd := &cobra.Command{
+		Use:   "mount <directory>",
+		Short: "Mount the repository as a read-only filesystem",
+		Long: `Mount the repository as a read-only filesystem, so the files in experiments and checkpoints can be browsed and loaded with normal tools.
+
+The directory has an "experiments" directory in it, with a directory for each experiment, and a "checkpoints" directory, with a directory for each checkpoint that has its files overlaid on its experiment's, in the same way as "replicate checkout". Files are only downloaded when they are opened. Experiments and checkpoints that are saved after it is mounted appear when it is next mounted.
+
+It stays mounted until this is interrupted, or the directory is unmounted with "umount" (or "fusermount -u" on Linux).
+
+This needs FUSE to be installed, and Replicate to be built with the "fuse" build tag.`,
+		Example: `Mount the repository and load a checkpoint's weights:
+replicate mount /mnt/replicate
+python -c 'import torch; torch.load("/mnt/replicate/checkpoints/3ef2a1.../model.pth")'`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return mountRepository(opts, args[0])
+		}),
+		Args: cobra.ExactArgs(1),
+		// Interrupting it unmounts the directory
+		Annotations: map[string]string{handlesInterruptsAnnotation: "true"},
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.cacheDir, "cache-dir", "", "Directory to keep files in once they have been opened, which is kept after it is unmounted (defaults to a temporary directory)")
+	cmd.Flags().BoolVar(&opts.allowOther, "allow-other", false, "Let other users read the mounted directory. This needs 'user_allow_other' in /etc/fuse.conf.")
+
+	return cmd
+}
+
+func mountRepository(opts mountOpts, mountpoint string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	cacheDir := opts.cacheDir
+	if cacheDir == "" {
+		cacheDir, err = files.TempDir("mount")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(cacheDir)
+	} else if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	go func() {
+		for range sigc {
+			if err := mount.Unmount(mountpoint); err != nil {
+				console.Warn("Failed to unmount %s: %s", mountpoint, err)
+			}
+		}
+	}()
+
+	console.Info("Mounting %s at %s. Press Ctrl-C to unmount it.", repo.RootURL(), mountpoint)
+	return mount.Mount(proj, mountpoint, mount.Options{
+		CacheDir:   cacheDir,
+		AllowOther: opts.allowOther,
+	})
+}
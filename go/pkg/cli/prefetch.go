@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// PrefetchIntervalEnvVar is how often the daemon prefetches the latest
+// checkpoints of running experiments, as a duration like "1m". They aren't
+// prefetched if it isn't set.
+const PrefetchIntervalEnvVar = "REPLICATE_PREFETCH_INTERVAL"
+
+type prefetchOpts struct {
+	repositoryURL string
+	clear         bool
+}
+
+func newPrefetchCommand() *cobra.Command {
+	var opts prefetchOpts
+
+	cmd := &cobra.Command{
+		Use:   "prefetch <experiment or checkpoint ID...>",
+		Short: "Download experiments or checkpoints ahead of time, so checking them out is instant",
+		Long: `Download experiments or checkpoints ahead of time, so checking them out is instant.
+
+The files that 'replicate checkout' would download are saved to a cache on local disk, and checking out or copying files from the experiment or checkpoint reads them from there instead of the repository. For an experiment, its best and latest checkpoints are prefetched too.
+
+The cache is in "replicate/prefetch" in your user cache directory, or $` + repository.PrefetchDirEnvVar + ` if it is set. To delete what has been prefetched from the repository, pass --clear.
+
+Repositories on local disk don't need to be prefetched.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return prefetch(opts, args)
+		}),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.clear {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		ValidArgsFunction: completeIDs,
+		Example: `Prefetch the best and latest checkpoints of an experiment, to check them out later:
+replicate prefetch a1b2c3d4
+
+Delete everything that has been prefetched from the repository:
+replicate prefetch --clear`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.clear, "clear", false, "Delete everything that has been prefetched from the repository")
+
+	return cmd
+}
+
+func prefetch(opts prefetchOpts, prefixes []string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	prefetcher, ok := repository.AsPrefetching(repo)
+	if !ok {
+		console.Info("%s is on local disk, so it doesn't need to be prefetched", repo.RootURL())
+		return nil
+	}
+	if opts.clear {
+		return prefetcher.Clear()
+	}
+
+	proj := project.NewProject(repo, projectDir)
+	type target struct {
+		experiment *project.Experiment
+		checkpoint *project.Checkpoint
+	}
+	targets := []target{}
+	for _, prefix := range prefixes {
+		result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		exp := result.Experiment
+		if result.Checkpoint != nil {
+			targets = append(targets, target{exp, result.Checkpoint})
+			continue
+		}
+		// Checking out an experiment checks out its best checkpoint, or its
+		// latest if it doesn't have a primary metric
+		best, latest := exp.BestCheckpoint(), exp.LatestCheckpoint()
+		if best != nil {
+			targets = append(targets, target{exp, best})
+		}
+		if latest != nil && (best == nil || latest.ID != best.ID) {
+			targets = append(targets, target{exp, latest})
+		}
+		if best == nil && latest == nil {
+			targets = append(targets, target{exp, nil})
+		}
+	}
+
+	total := &project.PrefetchResult{}
+	for _, t := range targets {
+		if t.checkpoint != nil {
+			console.Info("Prefetching checkpoint %s of experiment %s...", t.checkpoint.ShortID(), t.experiment.ShortID())
+		} else {
+			console.Info("Prefetching experiment %s...", t.experiment.ShortID())
+		}
+		result, err := proj.Prefetch(t.experiment, t.checkpoint)
+		if err != nil {
+			return err
+		}
+		total.Files += result.Files
+		total.Bytes += result.Bytes
+	}
+	console.Info("Prefetched %d files (%s)", total.Files, formatBytes(total.Bytes))
+	return nil
+}
+
+// prefetchRunningExperiments prefetches the latest checkpoints of running
+// experiments every interval, for as long as the daemon runs. Failures are
+// only logged, because prefetching only makes checking out faster.
+func prefetchRunningExperiments(repositoryURL string, projectDir string, interval time.Duration) {
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		console.Debug("Not prefetching running experiments: %s", err)
+		return
+	}
+	prefetchDir := repository.PrefetchDirForRepository(repo.RootURL())
+	if !repository.NeedsCaching(repo) || prefetchDir == "" {
+		return
+	}
+	prefetchingRepo, err := repository.NewPrefetchingRepository(repo, prefetchDir)
+	if err != nil {
+		console.Debug("Not prefetching running experiments: %s", err)
+		return
+	}
+	proj := project.NewProject(prefetchingRepo, projectDir)
+	for {
+		result, err := proj.PrefetchRunning()
+		if err != nil {
+			console.Debug("Failed to prefetch running experiments: %s", err)
+		} else if result.Files > 0 {
+			console.Debug("Prefetched %d files (%s) of running experiments", result.Files, formatBytes(result.Bytes))
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type projectsOpts struct {
+	repositoryURL string
+}
+
+func newProjectsCommand() *cobra.Command {
+	var opts projectsOpts
+
+	cmd := &cobra.Command{
+		Use:   "projects",
+		Short: "List the projects that share this project's repository",
+		Long: `List the projects that share this project's repository.
+
+Several projects can share one repository, such as a team's bucket, by setting 'project' in replicate.yaml. Each project is stored under "` + config.ProjectsFolder + `/<project>/" in the repository, and every other command only sees the experiments in its own project.
+
+If --repository is passed, it is the shared repository, not a project's.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return listProjects(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func listProjects(opts projectsOpts, out io.Writer) error {
+	repositoryURL, projectDir, currentProject, err := getRootRepositoryURL(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	// Projects aren't in the metadata cache, which is per-project
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	projects, err := project.ListProjects(repo)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		console.Info("No projects found in %s", repo.RootURL())
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "PROJECT\tEXPERIMENTS\n")
+	for _, p := range projects {
+		name := p.Name
+		if name == currentProject {
+			name += " (current)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\n", name, p.NumExperiments)
+	}
+	return tw.Flush()
+}
+
+// getRootRepositoryURL returns the URL of the repository that projects
+// share, which is --repository if it is passed, and the name of the project
+// in replicate.yaml, if there is one
+func getRootRepositoryURL(repositoryURL string) (rootURL string, projectDir string, currentProject string, err error) {
+	if repositoryURL != "" {
+		if global.RepositoryName != "" {
+			return "", "", "", fmt.Errorf("--repository and --repository-name cannot both be passed")
+		}
+		return repositoryURL, global.ProjectDirectory, "", nil
+	}
+	conf, projectDir, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return "", "", "", err
+	}
+	rootURL, err = conf.RootRepositoryURL(global.RepositoryName)
+	if err != nil {
+		return "", "", "", err
+	}
+	return rootURL, projectDir, conf.Project, nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestListProjects(t *testing.T) {
+	repoDir, err := files.TempDir("test-projects")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	rootURL := "file://" + repoDir
+
+	for name, numExperiments := range map[string]int{"hotdog-detector": 2, "not-hotdog": 1} {
+		repo, err := repository.ForURL(config.ProjectRepositoryURL(rootURL, name), "")
+		require.NoError(t, err)
+		proj := project.NewProject(repo, "")
+		for i := 0; i < numExperiments; i++ {
+			_, err := proj.CreateExperiment(project.CreateExperimentArgs{}, false, nil, true)
+			require.NoError(t, err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	require.NoError(t, listProjects(projectsOpts{repositoryURL: rootURL}, out))
+	require.Equal(t, `PROJECT          EXPERIMENTS
+hotdog-detector  2
+not-hotdog       1
+`, out.String())
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type promoteOpts struct {
+	repositoryURL string
+	name          string
+	version       int
+	paths         []string
+	trees         []string
+	force         bool
+}
+
+func newPromoteCommand() *cobra.Command {
+	var opts promoteOpts
+
+	cmd := &cobra.Command{
+		Use:   "promote <experiment or checkpoint ID>",
+		Short: "Copy a checkpoint's files to a version of a model",
+		Long: `Copy a checkpoint's files to a version of a model.
+
+The files are copied to models/<name>/<version>/ in the repository, and the version is added to the index of the model's versions in models/<name>/versions.json, with the experiment and checkpoint it came from. Serving systems can read the index to find the latest version of a model, and download its files, without knowing about experiments and checkpoints.
+
+If an experiment ID is passed, its best or latest checkpoint is promoted. Only the checkpoint's files are copied, not the experiment's. The version is the one after the latest version, unless it is set with --version.`,
+		Example: `Promote the best checkpoint of an experiment to the next version of a model:
+replicate promote 3ef2a1 --name hotdog-detector
+
+Promote only the weights of a checkpoint to version 3:
+replicate promote 3ef2a1 --name hotdog-detector --version 3 --path weights/model.pt`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return promote(opts, args[0])
+		}),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNIDs(1),
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.name, "name", "", "Name of the model")
+	cmd.Flags().IntVar(&opts.version, "version", 0, "Version to promote the checkpoint to (default: the one after the latest version)")
+	cmd.Flags().StringSliceVar(&opts.paths, "path", nil, "Only promote these files or directories of the checkpoint (default: all of them)")
+	cmd.Flags().StringSliceVar(&opts.trees, "tree", nil, "Only promote these trees of the checkpoint: code, weights or artifacts (default: all of them)")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Replace the version if it already exists")
+	if err := cmd.MarkFlagRequired("name"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func promote(opts promoteOpts, prefix string) error {
+	if err := project.ValidateModelName(opts.name); err != nil {
+		return err
+	}
+	if opts.version < 0 {
+		return fmt.Errorf("Invalid version %d. Versions must be positive.", opts.version)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetWaitForRestore(true)
+	if err := proj.SetCheckoutTrees(opts.trees); err != nil {
+		return err
+	}
+
+	result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	experiment := result.Experiment
+	checkpoint := result.Checkpoint
+	if checkpoint == nil {
+		checkpoint = bestOrLatestCheckpoint(experiment)
+		if checkpoint == nil {
+			return fmt.Errorf("The experiment %s does not have any checkpoints to promote", experiment.ShortID())
+		}
+	}
+
+	console.Info("Promoting checkpoint %s of experiment %s to %s...", checkpoint.ShortID(), experiment.ShortID(), opts.name)
+	version, err := proj.PromoteCheckpoint(experiment, checkpoint, opts.name, project.PromoteOptions{
+		Version: opts.version,
+		Paths:   opts.paths,
+		Force:   opts.force,
+	})
+	if err != nil {
+		return err
+	}
+	console.Info("Promoted checkpoint %s to version %d of %s, with %d files, at %s/%s", checkpoint.ShortID(), version.Version, opts.name, len(version.Files), repo.RootURL(), version.Path)
+	return nil
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type pruneOpts struct {
+	repositoryURL string
+	dryRun        bool
+	force         bool
+	noInventory   bool
+}
+
+func newPruneCommand() *cobra.Command {
+	var opts pruneOpts
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete experiments and checkpoints according to the retention policy",
+		Long: `Delete experiments and checkpoints according to the retention policy.
+
+The retention policy is defined in the 'retention' section of replicate.yaml. Running experiments are never pruned.
+
+While it runs, the repository is locked, so other maintenance, like deleting checkpoints or emptying the trash, can't run at the same time, and experiments wait before they save anything. If it crashes, the lock expires after a couple of minutes.
+
+If replicate.yaml has an 'inventory' of the repository's bucket, the sizes of experiments and checkpoints are read from it instead of listing the bucket. Pass --no-inventory to list the bucket anyway.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return prune(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `See what would be deleted, and how much space it would free up:
+replicate prune --dry-run`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Delete without interactive prompt")
+	addNoInventoryFlagVar(cmd, &opts.noInventory)
+
+	return cmd
+}
+
+func prune(opts pruneOpts, out io.Writer) error {
+	conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return err
+	}
+	if conf.Retention == nil {
+		return fmt.Errorf("replicate.yaml doesn't have a 'retention' section, so there is nothing to prune. To define a retention policy, take a look at the replicate.yaml reference:\n%s/docs/reference/yaml", global.WebURL)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	if !opts.noInventory {
+		setInventory(proj)
+	}
+
+	items, err := proj.PlanPrune(conf.Retention, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Fprintln(out, "Nothing to prune.")
+		return nil
+	}
+
+	if opts.dryRun {
+		fmt.Fprintln(out, "This would delete:")
+	} else {
+		fmt.Fprintln(out, "You are about to delete:")
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+		if item.Checkpoint == nil {
+			fmt.Fprintf(out, "* Experiment %s and its %d checkpoints (%s): %s\n", item.Experiment.ShortID(), len(item.Experiment.Checkpoints), formatBytes(item.Size), item.Reason)
+		} else {
+			fmt.Fprintf(out, "* Checkpoint %s of experiment %s (%s): %s\n", item.Checkpoint.ShortID(), item.Experiment.ShortID(), formatBytes(item.Size), item.Reason)
+		}
+	}
+	fmt.Fprintf(out, "\nThis frees up %s.\n", formatBytes(total))
+
+	if opts.dryRun {
+		return nil
+	}
+	if !opts.force {
+		continuePrune, err := console.InteractiveBool{
+			Prompt:  "\nDo you want to continue?",
+			Default: false,
+		}.Read()
+		if err != nil {
+			return err
+		}
+		if !continuePrune {
+			return nil
+		}
+	}
+
+	console.Info("Pruning...")
+	return proj.Prune(items)
+}
+
+// formatBytes formats a number of bytes for humans, e.g. "1.5 MB"
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/shared"
+)
+
+// PublishTokenEnvVar is the token requests to `replicate publish` must
+// include, if --token isn't passed
+const PublishTokenEnvVar = "REPLICATE_PUBLISH_TOKEN"
+
+type publishOpts struct {
+	repositoryURL string
+	listen        string
+	token         string
+	tlsCert       string
+	tlsKey        string
+}
+
+func newPublishCommand() *cobra.Command {
+	var opts publishOpts
+
+	cmd := &cobra.Command{
+		Use:   "publish <experiment or checkpoint ID...>",
+		Short: "Serve the files of checkpoints over HTTP",
+		Long: `Serve the files of checkpoints over HTTP.
+
+This lets services that use your models download them with wget or curl, without Replicate or any cloud credentials. Each file is at /<checkpoint ID>/<path>, where the path is relative to the project directory, as it is in the output of "replicate show". The URLs don't change, because checkpoint IDs don't. /<checkpoint ID>/ lists the files in a checkpoint, and / lists the checkpoints that are published. If an experiment ID is passed, its best or latest checkpoint is published.
+
+Files are read from the repository when they are requested. Only the checkpoints that are passed are served, until this is interrupted.
+
+If --token or $` + PublishTokenEnvVar + ` is set, requests must include it, either in an "Authorization: Bearer <token>" header or as the "token" query parameter. Pass --tls-cert and --tls-key to serve over HTTPS, which you should do if there is a token and the server can be reached from outside the machine.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return publish(opts, args)
+		}),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeIDs,
+		Example: `Publish the best checkpoint of an experiment on port 8080 of every interface:
+replicate publish a1b2c3d4 --listen :8080
+
+Download its weights on another machine:
+wget http://<host>:8080/<checkpoint ID>/weights/model.pt`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.listen, "listen", "localhost:8080", "The address to listen on. Use ':8080' to listen on every interface")
+	cmd.Flags().StringVar(&opts.token, "token", os.Getenv(PublishTokenEnvVar), "A token that requests must include (default: $"+PublishTokenEnvVar+")")
+	cmd.Flags().StringVar(&opts.tlsCert, "tls-cert", "", "A certificate file to serve HTTPS with, along with --tls-key")
+	cmd.Flags().StringVar(&opts.tlsKey, "tls-key", "", "The private key of --tls-cert")
+
+	return cmd
+}
+
+func publish(opts publishOpts, prefixes []string) error {
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be passed together")
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	checkpoints := []*shared.PublishedCheckpoint{}
+	for _, prefix := range prefixes {
+		result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		checkpoint := result.Checkpoint
+		if checkpoint == nil {
+			if checkpoint = bestOrLatestCheckpoint(result.Experiment); checkpoint == nil {
+				return fmt.Errorf("Experiment %s doesn't have any checkpoints to publish", result.Experiment.ShortID())
+			}
+		}
+		checkpoints = append(checkpoints, &shared.PublishedCheckpoint{Experiment: result.Experiment, Checkpoint: checkpoint})
+	}
+
+	scheme := "http"
+	if opts.tlsCert != "" {
+		scheme = "https"
+	}
+	host := opts.listen
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	for _, published := range checkpoints {
+		console.Info("Publishing checkpoint %s of experiment %s at %s://%s/%s/", published.Checkpoint.ShortID(), published.Experiment.ShortID(), scheme, host, published.Checkpoint.ID)
+	}
+	if opts.token == "" {
+		console.Info("Anyone who can reach %s can download them. Pass --token to require a token.", opts.listen)
+	}
+
+	server := &http.Server{
+		Addr:    opts.listen,
+		Handler: shared.NewPublishHandler(proj, checkpoints, opts.token),
+	}
+	if opts.tlsCert != "" {
+		err = server.ListenAndServeTLS(opts.tlsCert, opts.tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	return fmt.Errorf("Failed to serve on %s: %w", opts.listen, err)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type pushOpts struct {
+	repositoryURL string
+}
+
+func newPushCommand() *cobra.Command {
+	var opts pushOpts
+
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Upload experiments and checkpoints that were saved while the repository couldn't be reached",
+		Long: `Upload experiments and checkpoints that were saved while the repository couldn't be reached.
+
+If the repository can't be reached when an experiment or checkpoint is saved, for example because the network is down, it is saved in "` + repository.SpoolDir + `" in the project directory instead. To save there without trying the repository, set the ` + repository.OfflineEnvVar + ` environment variable.
+
+What is saved there is uploaded the next time you run a replicate command, or when you run this command. Experiments and checkpoints keep the times they were created at.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return push(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func push(opts pushOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	// Not getRepository, which would push the spool itself
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	spoolingRepo, err := repository.NewSpoolingRepository(repo, repository.SpoolDirForRepository(projectDir, repo.RootURL()))
+	if err != nil {
+		return err
+	}
+	paths, err := spoolingRepo.SpooledPaths()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(out, "Nothing to upload.")
+		return nil
+	}
+	console.Info("Uploading %d objects to %q...", len(paths), repo.RootURL())
+	count, err := spoolingRepo.Push()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Uploaded %d objects.\n", count)
+	if count < len(paths) {
+		fmt.Fprintf(out, "%d objects were saved again while they were being uploaded, so run 'replicate push' again to upload them.\n", len(paths)-count)
+	}
+	return nil
+}
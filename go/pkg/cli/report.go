@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type reportOpts struct {
+	repositoryURL string
+	format        string
+	output        string
+}
+
+func newReportCommand() *cobra.Command {
+	var opts reportOpts
+
+	cmd := &cobra.Command{
+		Use:   "report <experiment ID> [experiment ID...]",
+		Short: "Generate a report about experiments",
+		Long: `Generate a report about experiments.
+
+The report has the experiment's command and params, the metrics of its best checkpoint (or latest checkpoint, if it doesn't have a primary metric), and a plot of each metric over the course of the experiment. Plots are embedded in the report as images, so it is a single self-contained file.`,
+		Example: `Write a markdown report about an experiment to report.md:
+replicate report 3ef2a1 -o report.md`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return report(opts, args, os.Stdout)
+		}),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeIDs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.format, "format", "md", "Report format. Only \"md\" (markdown) is supported")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "File to write the report to (default: stdout)")
+
+	return cmd
+}
+
+func report(opts reportOpts, prefixes []string, stdout io.Writer) error {
+	if opts.format != "md" {
+		return fmt.Errorf("Unknown report format: %s. Only \"md\" is supported", opts.format)
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+
+	experiments := []*project.Experiment{}
+	for _, prefix := range prefixes {
+		exp, err := proj.ExperimentFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		experiments = append(experiments, exp)
+	}
+
+	out := stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fmt.Errorf("Failed to create %s: %w", opts.output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	for i, exp := range experiments {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		writeMarkdownReport(out, exp)
+	}
+	return nil
+}
+
+func writeMarkdownReport(out io.Writer, exp *project.Experiment) {
+	fmt.Fprintf(out, "# Experiment %s\n\n", exp.ShortID())
+
+	fmt.Fprintf(out, "| | |\n|---|---|\n")
+	fmt.Fprintf(out, "| ID | `%s` |\n", exp.ID)
+	fmt.Fprintf(out, "| Created | %s |\n", exp.Created.In(timezone).Format(time.RFC1123))
+	if exp.Command != "" {
+		fmt.Fprintf(out, "| Command | `%s` |\n", markdownCell(exp.Command))
+	}
+	if exp.User != "" {
+		fmt.Fprintf(out, "| User | %s |\n", markdownCell(exp.User))
+	}
+	if exp.Host != "" {
+		fmt.Fprintf(out, "| Host | %s |\n", markdownCell(exp.Host))
+	}
+	if exp.PythonVersion != "" {
+		fmt.Fprintf(out, "| Python version | %s |\n", markdownCell(exp.PythonVersion))
+	}
+	fmt.Fprintf(out, "| Checkpoints | %d |\n", len(exp.Checkpoints))
+
+	if len(exp.Params) > 0 {
+		fmt.Fprintf(out, "\n## Params\n\n")
+		writeMarkdownValues(out, "Param", exp.Params)
+	}
+
+	checkpoint := bestOrLatestCheckpoint(exp)
+	if checkpoint == nil {
+		return
+	}
+	description := "latest"
+	if checkpoint == exp.BestCheckpoint() {
+		description = "best"
+	}
+	fmt.Fprintf(out, "\n## Metrics\n\n")
+	fmt.Fprintf(out, "From the %s checkpoint, %s (step %d).\n\n", description, checkpoint.ShortID(), checkpoint.Step)
+	writeMarkdownValues(out, "Metric", checkpoint.Metrics)
+
+	plots := metricPlots(exp)
+	if len(plots) > 0 {
+		fmt.Fprintf(out, "\n## Plots\n")
+		for _, plot := range plots {
+			fmt.Fprintf(out, "\n![%s](data:image/svg+xml;base64,%s)\n", plot.name, base64.StdEncoding.EncodeToString([]byte(plot.svg)))
+		}
+	}
+}
+
+func writeMarkdownValues(out io.Writer, heading string, values param.ValueMap) {
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "| %s | Value |\n|---|---|\n", heading)
+	for _, name := range names {
+		fmt.Fprintf(out, "| %s | %s |\n", markdownCell(name), markdownCell(values[name].String()))
+	}
+}
+
+// markdownCell escapes text so it can go in a markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+type metricPlot struct {
+	name string
+	svg  string
+}
+
+// metricPlots returns a plot of each numeric metric against step, for
+// metrics that have been recorded at least twice
+func metricPlots(exp *project.Experiment) []*metricPlot {
+	checkpoints := copyCheckpointsByStep(exp.Checkpoints)
+	names := map[string]bool{}
+	for _, chk := range checkpoints {
+		for name := range chk.Metrics {
+			names[name] = true
+		}
+	}
+	sortedNames := []string{}
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	plots := []*metricPlot{}
+	for _, name := range sortedNames {
+		xs, ys := []float64{}, []float64{}
+		for _, chk := range checkpoints {
+			v, ok := chk.Metrics[name]
+			if !ok {
+				continue
+			}
+			y, ok := metricFloat(v)
+			if !ok || math.IsNaN(y) || math.IsInf(y, 0) {
+				continue
+			}
+			xs = append(xs, float64(chk.Step))
+			ys = append(ys, y)
+		}
+		if len(xs) >= 2 {
+			plots = append(plots, &metricPlot{name: name, svg: plotSVG(name, xs, ys)})
+		}
+	}
+	return plots
+}
+
+// metricFloat returns the value of a numeric metric as a float64, or false
+// if it isn't a number
+func metricFloat(v param.Value) (float64, bool) {
+	switch v.Type() {
+	case param.TypeInt:
+		return float64(v.IntVal()), true
+	case param.TypeFloat:
+		return v.FloatVal(), true
+	}
+	return 0, false
+}
+
+func copyCheckpointsByStep(checkpoints []*project.Checkpoint) []*project.Checkpoint {
+	copied := make([]*project.Checkpoint, len(checkpoints))
+	copy(copied, checkpoints)
+	sort.SliceStable(copied, func(i, j int) bool {
+		if copied[i].Step == copied[j].Step {
+			return copied[i].Created.Before(copied[j].Created)
+		}
+		return copied[i].Step < copied[j].Step
+	})
+	return copied
+}
+
+// plotSVG draws a line chart of ys against xs as an SVG image
+func plotSVG(title string, xs, ys []float64) string {
+	const width, height = 480, 240
+	const left, right, top, bottom = 60, 20, 30, 30
+
+	minX, maxX := floatRange(xs)
+	minY, maxY := floatRange(ys)
+	scale := func(v, min, max, size float64) float64 {
+		if max == min {
+			return size / 2
+		}
+		return (v - min) / (max - min) * size
+	}
+	plotWidth := float64(width - left - right)
+	plotHeight := float64(height - top - bottom)
+
+	points := []string{}
+	for i := range xs {
+		x := float64(left) + scale(xs[i], minX, maxX, plotWidth)
+		y := float64(top) + plotHeight - scale(ys[i], minY, maxY, plotHeight)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', 4, 64)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`, width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="13">%s</text>`, left, html.EscapeString(title))
+	fmt.Fprintf(&b, `<polyline points="%d,%d %d,%d %d,%d" fill="none" stroke="#999"/>`, left, top, left, height-bottom, width-right, height-bottom)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, left-4, top+4, f(maxY))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, left-4, height-bottom, f(minY))
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, left, height-bottom+14, f(minX))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, width-right, height-bottom+14, f(maxX))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">step</text>`, left+(width-left-right)/2, height-bottom+14)
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#2563eb" stroke-width="2"/>`, strings.Join(points, " "))
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+func floatRange(values []float64) (min float64, max float64) {
+	min, max = values[0], values[0]
+	for _, v := range values[1:] {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	return min, max
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestReport(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	primaryMetric := &project.PrimaryMetric{Name: "metric-1", Goal: project.GoalMinimize}
+	experiments := []*project.Experiment{{
+		ID:            "1eeeeeeeee",
+		Created:       time.Date(2006, 1, 2, 14, 54, 5, 0, time.UTC),
+		Params:        param.ValueMap{"param-1": param.Int(100), "param-2": param.String("hello")},
+		Command:       "train.py --gamma=1.2 -x",
+		Host:          "10.1.1.1",
+		User:          "andreas",
+		Config:        &config.Config{},
+		PythonVersion: "3.4.5",
+		Checkpoints: []*project.Checkpoint{{
+			ID:            "1ccccccccc",
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.1), "metric-2": param.Int(2)},
+			PrimaryMetric: primaryMetric,
+			Step:          10,
+		}, {
+			ID:            "2ccccccccc",
+			Metrics:       param.ValueMap{"metric-1": param.Float(0.01), "metric-2": param.Int(3)},
+			PrimaryMetric: primaryMetric,
+			Step:          20,
+		}},
+	}, {
+		ID:     "2eeeeeeeee",
+		Config: &config.Config{},
+		Checkpoints: []*project.Checkpoint{{
+			ID:      "4ccccccccc",
+			Metrics: param.ValueMap{"metric-3": param.Float(0.5)},
+			Step:    5,
+		}},
+	}}
+	for _, exp := range experiments {
+		require.NoError(t, exp.Save(repo))
+	}
+	proj := project.NewProject(repo, workingDir)
+	exp, err := proj.ExperimentFromPrefix("1eee")
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	writeMarkdownReport(out, exp)
+	actual := out.String()
+
+	expected := `
+# Experiment 1eeeeee
+
+| | |
+|---|---|
+| ID | ` + "`1eeeeeeeee`" + ` |
+| Created | Mon, 02 Jan 2006 22:54:05 +08 |
+| Command | ` + "`train.py --gamma=1.2 -x`" + ` |
+| User | andreas |
+| Host | 10.1.1.1 |
+| Python version | 3.4.5 |
+| Checkpoints | 2 |
+
+## Params
+
+| Param | Value |
+|---|---|
+| param-1 | 100 |
+| param-2 | hello |
+
+## Metrics
+
+From the best checkpoint, 2cccccc (step 20).
+
+| Metric | Value |
+|---|---|
+| metric-1 | 0.01 |
+| metric-2 | 3 |
+
+## Plots
+`
+	require.True(t, strings.HasPrefix(actual, expected[1:]), actual)
+
+	images := regexp.MustCompile(`!\[(.*)\]\(data:image/svg\+xml;base64,(.*)\)`).FindAllStringSubmatch(actual, -1)
+	require.Len(t, images, 2)
+	require.Equal(t, "metric-1", images[0][1])
+	require.Equal(t, "metric-2", images[1][1])
+	svg, err := base64.StdEncoding.DecodeString(images[0][2])
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(svg), "<svg"))
+	require.Contains(t, string(svg), "metric-1")
+
+	// Experiments with a single checkpoint don't get plots
+	out = new(bytes.Buffer)
+	err = report(reportOpts{repositoryURL: "file://" + path.Join(workingDir, ".replicate"), format: "md"}, []string{"2eee"}, out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "From the latest checkpoint, 4cccccc (step 5).")
+	require.NotContains(t, out.String(), "## Plots")
+
+	err = report(reportOpts{format: "html"}, []string{"1eee"}, out)
+	require.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type restoreOpts struct {
+	repositoryURL string
+}
+
+func newRestoreCommand() *cobra.Command {
+	var opts restoreOpts
+
+	cmd := &cobra.Command{
+		Use:   "restore [experiment or checkpoint ID...]",
+		Short: "Restore experiments or checkpoints from the trash",
+		Long: `Restore experiments or checkpoints from the trash.
+
+When experiments and checkpoints are removed with 'replicate rm', they are moved to the trash, in the "` + project.TrashDir + `" directory of the repository. They are kept there for 7 days (or 'retention_days' in the 'trash' section of replicate.yaml) before they are deleted for good.
+
+To restore experiments or checkpoints, pass their IDs (or prefixes). To list what is in the trash, run this command without any IDs.
+
+A checkpoint can't be restored if its experiment has been removed since, unless the experiment is restored first.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return restore(opts, args, os.Stdout)
+		}),
+		Example: `List what is in the trash:
+replicate restore
+
+Restore an experiment and its checkpoints (where a1b2c3d4 is an experiment ID):
+replicate restore a1b2c3d4`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func restore(opts restoreOpts, prefixes []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	// replicate.yaml is optional if --repository is passed
+	if conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory); err == nil {
+		proj.SetTrash(conf.Trash)
+	}
+
+	if len(prefixes) == 0 {
+		return listTrash(proj, out)
+	}
+
+	entries := []*project.TrashEntry{}
+	for _, prefix := range prefixes {
+		entry, err := proj.TrashEntryFromPrefix(prefix)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	for _, entry := range entries {
+		if entry.Checkpoint != nil {
+			console.Info("Restoring checkpoint %s...", entry.ShortID())
+		} else {
+			console.Info("Restoring experiment %s and its checkpoints...", entry.ShortID())
+		}
+		if err := proj.RestoreFromTrash(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listTrash(proj *project.Project, out io.Writer) error {
+	entries, err := proj.TrashEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "The trash is empty.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "ID\tTYPE\tEXPERIMENT\tREMOVED\tDELETED ON\n")
+	for _, entry := range entries {
+		kind := "experiment"
+		if entry.Checkpoint != nil {
+			kind = "checkpoint"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.ShortID(), kind, entry.ExperimentID[:7], console.FormatTime(entry.Deleted), proj.TrashExpires(entry).In(timezone).Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
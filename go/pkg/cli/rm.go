@@ -2,10 +2,13 @@ package cli
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/replicate/go/pkg/config"
 	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
 	"github.com/replicate/replicate/go/pkg/project"
 )
 
@@ -16,11 +19,14 @@ func newRmCommand() *cobra.Command {
 		Long: `Remove experiments or checkpoints.
 
 To remove experiments or checkpoints, pass any number of IDs (or prefixes).
+
+They are moved to the trash, where they are kept for 7 days (or 'retention_days' in the 'trash' section of replicate.yaml) before they are deleted for good. Until then, they can be brought back with 'replicate restore'. Pass --permanent to delete them straight away.
 `,
-		Run:        handleErrors(removeExperimentOrCheckpoint),
-		Args:       cobra.MinimumNArgs(1),
-		Aliases:    []string{"delete"},
-		SuggestFor: []string{"remove"},
+		Run:               handleErrors(removeExperimentOrCheckpoint),
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeIDs,
+		Aliases:           []string{"delete"},
+		SuggestFor:        []string{"remove"},
 		Example: `Delete an experiment and its checkpoints
 (where a1b2c3d4 is an experiment ID):
 replicate rm a1b2c3d4
@@ -33,6 +39,7 @@ replicate rm $(replicate ls -q --filter "val_accuracy < 0.2")
 
 	addRepositoryURLFlag(cmd)
 	cmd.Flags().BoolP("force", "f", false, "Force delete without interactive prompt")
+	cmd.Flags().Bool("permanent", false, "Delete for good, rather than moving to the trash")
 
 	return cmd
 }
@@ -47,10 +54,16 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 		return err
 	}
 	proj := project.NewProject(repo, projectDir)
+	// replicate.yaml is optional if --repository is passed, in which case
+	// the trash has the default retention period
+	if conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory); err == nil {
+		proj.SetTrash(conf.Trash)
+	}
+	force, err := cmd.Flags().GetBool("force")
 	if err != nil {
 		return err
 	}
-	force, err := cmd.Flags().GetBool("force")
+	permanent, err := cmd.Flags().GetBool("permanent")
 	if err != nil {
 		return err
 	}
@@ -69,7 +82,11 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 	}
 
 	if !force {
-		fmt.Println("You are about to delete the following:")
+		if permanent {
+			fmt.Println("You are about to delete the following for good:")
+		} else {
+			fmt.Println("You are about to move the following to the trash:")
+		}
 		for _, comOrExp := range comOrExps {
 			if comOrExp.Experiment != nil {
 				fmt.Printf("* Experiment %s (%d checkpoints)\n", comOrExp.Experiment.ShortID(), len(comOrExp.Experiment.Checkpoints))
@@ -94,6 +111,12 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 		if err != nil {
 			return err
 		}
+		if !permanent {
+			if err := trashExperimentOrCheckpoint(proj, comOrExp); err != nil {
+				return err
+			}
+			continue
+		}
 		if comOrExp.Checkpoint != nil {
 			console.Info("Removing checkpoint %s...", comOrExp.Checkpoint.ShortID())
 			if err := proj.DeleteCheckpoint(comOrExp.Checkpoint); err != nil {
@@ -102,11 +125,8 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 		} else {
 			console.Info("Removing experiment %s and its checkpoints...", comOrExp.Experiment.ShortID())
 			experiment := comOrExp.Experiment
-			// This is slow, see https://github.com/replicate/replicate/issues/333
-			for _, checkpoint := range experiment.Checkpoints {
-				if err := proj.DeleteCheckpoint(checkpoint); err != nil {
-					return err
-				}
+			if err := proj.DeleteCheckpoints(experiment.Checkpoints); err != nil {
+				return err
 			}
 			if err := proj.DeleteExperiment(experiment); err != nil {
 				return err
@@ -114,5 +134,28 @@ func removeExperimentOrCheckpoint(cmd *cobra.Command, prefixes []string) error {
 		}
 	}
 
+	if count, err := proj.EmptyTrash(time.Now().UTC()); err != nil {
+		console.Warn("Failed to empty the trash: %s", err)
+	} else if count > 0 {
+		console.Debug("Deleted %d things from the trash that were older than its retention period", count)
+	}
+
+	return nil
+}
+
+func trashExperimentOrCheckpoint(proj *project.Project, comOrExp *project.CheckpointOrExperiment) error {
+	var entry *project.TrashEntry
+	var err error
+	if comOrExp.Checkpoint != nil {
+		console.Info("Moving checkpoint %s to the trash...", comOrExp.Checkpoint.ShortID())
+		entry, err = proj.TrashCheckpoint(comOrExp.Checkpoint, comOrExp.Experiment)
+	} else {
+		console.Info("Moving experiment %s and its checkpoints to the trash...", comOrExp.Experiment.ShortID())
+		entry, err = proj.TrashExperiment(comOrExp.Experiment)
+	}
+	if err != nil {
+		return err
+	}
+	console.Info("To restore it, run: replicate restore %s", entry.ShortID())
 	return nil
 }
@@ -4,8 +4,10 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/replicate/go/pkg/analytics"
+	"github.com/replicate/replicate/go/pkg/config"
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
 )
 
 func NewRootCommand() (*cobra.Command, error) {
@@ -21,10 +23,16 @@ To learn how to get started, go to ` + global.WebURL + `/docs/tutorial`,
 		// This stops errors being printed because we print them in cmd/replicate/main.go
 		SilenceErrors: true,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			if global.Verbose {
-				console.SetLevel(console.DebugLevel)
-			}
+			setLogging()
 			console.SetColor(global.Color)
+			if cmd.Annotations[handlesInterruptsAnnotation] == "" {
+				handleInterrupts()
+			}
+
+			// Commands report errors in replicate.yaml themselves
+			if conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory); err == nil {
+				project.ApplyGlobalSettings(conf)
+			}
 
 			if err := analytics.TrackCommand(cmd.Name()); err != nil {
 				console.Debug("analytics error: %s", err)
@@ -37,14 +45,43 @@ To learn how to get started, go to ` + global.WebURL + `/docs/tutorial`,
 
 	rootCmd.AddCommand(
 		newAnalyticsCommand(),
+		newArchiveCommand(),
+		newAuditCommand(),
+		newBenchmarkCommand(),
+		newCheckStorageCommand(),
 		newCheckoutCommand(),
+		newCompareCommand(),
+		newCompletionCommand(),
+		newCpCommand(),
 		newRmCommand(),
 		newDiffCommand(),
+		newDoctorCommand(),
+		newExportCommand(),
 		newFeedbackCommand(),
 		newGenerateDocsCommand(&rootCmd),
+		newImportCommand(),
+		newLifecycleCommand(),
 		newListCommand(),
+		newMigrateLayoutCommand(),
+		newMirrorCommand(),
+		newMountCommand(),
+		newProjectsCommand(),
+		newPrefetchCommand(),
+		newPromoteCommand(),
+		newPublishCommand(),
+		newPruneCommand(),
 		newPsCommand(),
+		newPushCommand(),
+		newReportCommand(),
+		newRestoreCommand(),
+		newServeCommand(),
 		newShowCommand(),
+		newSnapshotCommand(),
+		newStatsCommand(),
+		newStatusCommand(),
+		newSweepCommand(),
+		newVerifyCommand(),
+		newWatchCommand(),
 	)
 
 	return &rootCmd, nil
@@ -54,6 +91,24 @@ func setPersistentFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVar(&global.Color, "color", true, "Display color in output")
 	// FIXME (bfirsh): this noun needs standardizing. we use the term "working directory" in some places.
 	cmd.PersistentFlags().StringVarP(&global.ProjectDirectory, "project-directory", "D", "", "Project directory. Default: nearest parent directory with replicate.yaml")
-	cmd.PersistentFlags().BoolVarP(&global.Verbose, "verbose", "v", false, "Verbose output")
+	cmd.PersistentFlags().StringVar(&global.Profile, "profile", "", "Profile in replicate.yaml to use (default: $REPLICATE_PROFILE)")
+	cmd.PersistentFlags().StringVar(&global.RepositoryName, "repository-name", "", "Name of a repository under 'repositories' in replicate.yaml to use instead of the default repository")
+	cmd.PersistentFlags().BoolVarP(&global.Verbose, "verbose", "v", false, "Verbose output (the same as --log-level=debug)")
+	cmd.PersistentFlags().StringVar(&global.LogLevel, "log-level", "", "Level of messages to log: debug, info, warn or error (default: info)")
+	cmd.PersistentFlags().BoolVar(&global.LogJSON, "log-json", false, "Log messages as JSON objects, one per line")
+}
 
+// setLogging sets the log level and format from --verbose, --log-level and
+// --log-json
+func setLogging() {
+	console.SetJSON(global.LogJSON)
+	if global.LogLevel != "" {
+		level, err := console.ParseLevel(global.LogLevel)
+		if err != nil {
+			console.Fatal("--log-level must be debug, info, warn or error, not %q", global.LogLevel)
+		}
+		console.SetLevel(level)
+	} else if global.Verbose {
+		console.SetLevel(console.DebugLevel)
+	}
 }
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type serveOpts struct {
+	repositoryURL   string
+	outputDirectory string
+	port            int
+	dryRun          bool
+}
+
+func newServeCommand() *cobra.Command {
+	var opts serveOpts
+
+	cmd := &cobra.Command{
+		Use:   "serve <experiment or checkpoint ID>",
+		Short: "Run the container that serves the model in a checkpoint",
+		Long: `Run the container that serves the model in a checkpoint.
+
+The container is the one that was in 'serve' in replicate.yaml when the checkpoint was saved. The files the model needs are checked out, and mounted in the container's working directory, and the container is run with Docker until it stops or this is interrupted. If an experiment ID is passed, its best or latest checkpoint is served.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return serve(opts, args[0])
+		}),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNIDs(1),
+		Example: `Serve the best checkpoint of an experiment on port 5000:
+replicate serve --port 5000 a1b2c3d4`,
+		// The container is stopped by interrupting it, which Docker
+		// passes on to it
+		Annotations: map[string]string{handlesInterruptsAnnotation: "true"},
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVarP(&opts.outputDirectory, "output-directory", "o", "", "Directory to check the files out to, which is kept after the container stops (defaults to a temporary directory)")
+	cmd.Flags().IntVarP(&opts.port, "port", "p", 0, "Port on this machine to serve the model on (defaults to the port it is served on in the container)")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Check out the files and print the Docker command, without running it")
+
+	return cmd
+}
+
+func serve(opts serveOpts, prefix string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetWaitForRestore(true)
+	experiment, checkpoint, err := getExperimentAndCheckpoint(prefix, proj, projectDir)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil {
+		return fmt.Errorf("Experiment %s doesn't have any checkpoints to serve", experiment.ShortID())
+	}
+
+	dir := opts.outputDirectory
+	if dir == "" {
+		dir, err = files.TempDir("serve")
+		if err != nil {
+			return err
+		}
+		if !opts.dryRun {
+			defer os.RemoveAll(dir)
+		}
+	} else if err := validateOrCreateOutputDir(dir); err != nil {
+		return err
+	}
+	// Docker only mounts absolute paths
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := proj.CheckoutServeFiles(checkpoint, experiment, dir); err != nil {
+		return err
+	}
+
+	args := project.ServeArgs(checkpoint, experiment, dir, opts.port)
+	if opts.dryRun {
+		fmt.Println("docker " + strings.Join(args, " "))
+		return nil
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("Docker is needed to serve checkpoints, but 'docker' isn't on your PATH. Install it from https://docs.docker.com/get-docker/")
+	}
+
+	if checkpoint.Serve.Port != 0 {
+		port := opts.port
+		if port == 0 {
+			port = checkpoint.Serve.Port
+		}
+		console.Info("Serving checkpoint %s with %s on http://localhost:%d. Press Ctrl-C to stop it.", checkpoint.ShortID(), checkpoint.Serve.Image, port)
+	} else {
+		console.Info("Serving checkpoint %s with %s. Press Ctrl-C to stop it.", checkpoint.ShortID(), checkpoint.Serve.Image)
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to run Docker: %w", err)
+	}
+	// Interrupts from the terminal go to Docker too, which passes them on
+	// to the container, so wait for it to stop instead of exiting.
+	// Terminating this is passed on in the same way.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	go func() {
+		for sig := range sigc {
+			if sig == syscall.SIGTERM {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		// The container being stopped by an interrupt isn't an error
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 130 {
+			return nil
+		}
+		return fmt.Errorf("Failed to serve checkpoint %s: %w", checkpoint.ShortID(), err)
+	}
+	return nil
+}
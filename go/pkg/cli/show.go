@@ -1,13 +1,16 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
@@ -15,6 +18,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/param"
 	"github.com/replicate/replicate/go/pkg/project"
 )
 
@@ -23,6 +27,8 @@ var timezone = time.Local
 type showOpts struct {
 	json          bool
 	repositoryURL string
+	follow        bool
+	interval      time.Duration
 }
 
 func newShowCommand() *cobra.Command {
@@ -31,13 +37,26 @@ func newShowCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "show <experiment or checkpoint ID>",
 		Short: "View information about an experiment or checkpoint",
+		Long: `View information about an experiment or checkpoint.
+
+With --follow, the metrics, checkpoints and alerts a running experiment saves are shown as it saves them, until it stops or this is interrupted. They are read from the repository, so it works for experiments running on other machines. With --json, each of them is printed as a line of JSON.`,
 		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			if !opts.follow {
+				handleInterrupts()
+			}
 			return show(opts, args, os.Stdout)
 		}),
-		Args: cobra.ExactArgs(1),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeNIDs(1),
+		Example: `Watch the metrics of an experiment as it trains:
+replicate show --follow a1b2c3d4`,
+		// Following is stopped by interrupting it
+		Annotations: map[string]string{handlesInterruptsAnnotation: "true"},
 	}
 
 	cmd.Flags().BoolVar(&opts.json, "json", false, "Print output in JSON format")
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "Show what a running experiment saves as it saves it")
+	cmd.Flags().DurationVar(&opts.interval, "interval", project.DefaultFollowInterval, "How often to check for what a followed experiment has saved")
 	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
 
 	return cmd
@@ -59,10 +78,19 @@ func show(opts showOpts, args []string, out io.Writer) error {
 		return err
 	}
 
+	if opts.follow && result.Checkpoint != nil {
+		return fmt.Errorf("%s is a checkpoint, but only experiments can be followed", prefix)
+	}
+
 	au := getAurora()
 
 	if opts.json {
 		enc := json.NewEncoder(out)
+		if opts.follow {
+			return followExperiment(opts, proj, result.Experiment, func(event *project.FollowEvent) error {
+				return enc.Encode(event)
+			})
+		}
 		enc.SetIndent("", "  ")
 		if result.Checkpoint != nil {
 			return enc.Encode(result.Checkpoint)
@@ -73,7 +101,87 @@ func show(opts showOpts, args []string, out io.Writer) error {
 	if result.Checkpoint != nil {
 		return showCheckpoint(au, out, proj, result.Experiment, result.Checkpoint)
 	}
-	return showExperiment(au, out, proj, result.Experiment)
+	if err := showExperiment(au, out, proj, result.Experiment); err != nil {
+		return err
+	}
+	if opts.follow {
+		return followExperiment(opts, proj, result.Experiment, func(event *project.FollowEvent) error {
+			writeFollowEvent(au, out, event)
+			return nil
+		})
+	}
+	return nil
+}
+
+// followExperiment calls onEvent with what exp saves until it stops or this
+// is interrupted
+func followExperiment(opts showOpts, proj *project.Project, exp *project.Experiment, onEvent func(*project.FollowEvent) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	go func() {
+		select {
+		case <-sigc:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	running, err := proj.ExperimentIsRunning(exp.ID)
+	if err != nil {
+		return err
+	}
+	if !running {
+		console.Info("Experiment %s isn't running, so there is nothing to follow", exp.ShortID())
+		return nil
+	}
+	if !opts.json {
+		console.Info("Following experiment %s until it stops. Press Ctrl-C to stop following it.", exp.ShortID())
+	}
+	return proj.FollowExperiment(ctx, exp, opts.interval, onEvent)
+}
+
+// writeFollowEvent writes a line for event, or a line for each step for
+// metrics
+func writeFollowEvent(au aurora.Aurora, out io.Writer, event *project.FollowEvent) {
+	timestamp := au.Faint(event.Time.In(timezone).Format("15:04:05"))
+	switch {
+	case event.Metrics != nil:
+		values := map[int64][]string{}
+		steps := []int64{}
+		for _, name := range event.Metrics.Names() {
+			for _, point := range event.Metrics[name] {
+				if _, ok := values[point.Step]; !ok {
+					steps = append(steps, point.Step)
+				}
+				values[point.Step] = append(values[point.Step], fmt.Sprintf("%s=%s", name, param.Float(point.Value).ShortString(10, 5)))
+			}
+		}
+		sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+		for _, step := range steps {
+			fmt.Fprintf(out, "%s  step %d  %s\n", timestamp, step, strings.Join(values[step], "  "))
+		}
+	case event.Checkpoint != nil:
+		chk := event.Checkpoint
+		metrics := []string{}
+		for _, metric := range chk.SortedMetrics() {
+			metrics = append(metrics, fmt.Sprintf("%s=%s", metric.Name, metric.Value.ShortString(10, 5)))
+		}
+		line := fmt.Sprintf("%s  %s %s  step %d", timestamp, au.Bold("checkpoint"), chk.ShortID(), chk.Step)
+		if len(metrics) > 0 {
+			line += "  " + strings.Join(metrics, "  ")
+		}
+		if event.Best {
+			line += " (best)"
+		}
+		fmt.Fprintln(out, line)
+	case event.Alert != nil:
+		fmt.Fprintf(out, "%s  %s %s: %s\n", timestamp, au.Red("alert"), event.Alert.Name, event.Alert.Message)
+	case event.Status != "":
+		fmt.Fprintf(out, "%s  experiment %s\n", timestamp, event.Status)
+	}
 }
 
 func showCheckpoint(au aurora.Aurora, out io.Writer, proj *project.Project, exp *project.Experiment, com *project.Checkpoint) error {
@@ -88,6 +196,9 @@ func showCheckpoint(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 	fmt.Fprintf(w, "Created:\t%s\n", com.Created.In(timezone).Format(time.RFC1123))
 	fmt.Fprintf(w, "Path:\t%s\n", com.Path)
 	fmt.Fprintf(w, "Step:\t%d\n", com.Step)
+	if com.Serve != nil {
+		fmt.Fprintf(w, "Serve:\t%s\n", com.Serve.Image)
+	}
 
 	fmt.Fprintf(w, "\t\n")
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Experiment"))
@@ -155,17 +266,75 @@ func showExperiment(au aurora.Aurora, out io.Writer, proj *project.Project, exp
 		return err
 	}
 
+	series, err := proj.MetricSeries(exp)
+	if err != nil {
+		return err
+	}
+	if len(series) > 0 {
+		fmt.Fprintf(out, "\n%s\n", au.Bold("Metric series"))
+		sw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(sw, "NAME\tPOINTS\tSTEPS\tLAST\tMIN\tMAX\t\n")
+		for _, name := range series.Names() {
+			points := series[name]
+			if len(points) == 0 {
+				continue
+			}
+			min, max := points[0].Value, points[0].Value
+			for _, p := range points {
+				if p.Value < min {
+					min = p.Value
+				}
+				if p.Value > max {
+					max = p.Value
+				}
+			}
+			last := points[len(points)-1]
+			fmt.Fprintf(sw, "%s\t%d\t%d-%d\t%s\t%s\t%s\t%s\n", name, len(points), points[0].Step, last.Step,
+				param.Float(last.Value).ShortString(10, 5), param.Float(min).ShortString(10, 5), param.Float(max).ShortString(10, 5),
+				sparkline(project.Downsample(points, sparklineWidth), min, max))
+		}
+		if err := sw.Flush(); err != nil {
+			return err
+		}
+	}
+
 	fmt.Fprintf(out, "\n")
 	fmt.Fprintf(out, "To see more details about a checkpoint, run:\n")
 	fmt.Fprintf(out, "  replicate show <checkpoint ID>\n")
 	return nil
 }
 
+// sparklineWidth is how many points metric series are downsampled to for
+// their sparklines
+const sparklineWidth = 40
+
+// sparkline draws points as a line of block characters, from min at the
+// bottom to max at the top
+func sparkline(points []project.MetricPoint, min float64, max float64) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	var b strings.Builder
+	for _, p := range points {
+		level := 0
+		if max > min {
+			level = int((p.Value - min) / (max - min) * float64(len(blocks)-1))
+		}
+		b.WriteRune(blocks[level])
+	}
+	return b.String()
+}
+
 func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.Experiment, experimentRunning bool) {
+	if exp.Name != "" {
+		fmt.Fprintf(w, "Name:\t%s\n", exp.Name)
+	}
 	fmt.Fprintf(w, "Created:\t%s\n", exp.Created.In(timezone).Format(time.RFC1123))
-	if experimentRunning {
+	switch {
+	case experimentRunning:
 		fmt.Fprint(w, "Status:\trunning\n")
-	} else {
+	case exp.Archived != nil:
+		fmt.Fprint(w, "Status:\tarchived\n")
+		fmt.Fprintf(w, "Archived:\t%s (%s)\n", exp.Archived.Time.In(timezone).Format(time.RFC1123), exp.Archived.StorageClass)
+	default:
 		fmt.Fprint(w, "Status:\tstopped\n")
 	}
 	fmt.Fprintf(w, "Host:\t%s\n", exp.Host)
@@ -183,9 +352,27 @@ func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.E
 		fmt.Fprintf(w, "%s\t\n", au.Faint("(none)"))
 	}
 
+	if len(exp.Seeds) > 0 {
+		fmt.Fprintf(w, "\t\n")
+		fmt.Fprintf(w, "%s\t\n", au.Bold("Seeds"))
+		writeSortedMap(w, exp.Seeds)
+	}
+
 	fmt.Fprintf(w, "\t\n")
 	fmt.Fprintf(w, "%s\t\n", au.Bold("System"))
 	fmt.Fprintf(w, "Python version:\t%s\n", exp.PythonVersion)
+	if env := exp.HostEnvironment; env != nil {
+		fmt.Fprintf(w, "OS:\t%s/%s\n", env.OS, env.Arch)
+		if env.CUDAVersion != "" {
+			fmt.Fprintf(w, "CUDA version:\t%s\n", env.CUDAVersion)
+		}
+	}
+
+	if len(exp.Environment) > 0 {
+		fmt.Fprintf(w, "\t\n")
+		fmt.Fprintf(w, "%s\t\n", au.Bold("Environment"))
+		writeSortedMap(w, exp.Environment)
+	}
 
 	fmt.Fprintf(w, "\t\n")
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Python Packages"))
@@ -202,9 +389,37 @@ func writeExperimentCommon(au aurora.Aurora, w *tabwriter.Writer, exp *project.E
 		fmt.Fprintf(w, "%s\t\n", au.Faint("(none)"))
 	}
 
+	if len(exp.DVCOutputs) > 0 {
+		fmt.Fprintf(w, "\t\n")
+		fmt.Fprintf(w, "%s\t\n", au.Bold("DVC Outputs"))
+		for _, out := range exp.DVCOutputs {
+			fmt.Fprintf(w, "%s:\t%s\n", out.Path, out.MD5)
+		}
+	}
+
+	if len(exp.Datasets) > 0 {
+		fmt.Fprintf(w, "\t\n")
+		fmt.Fprintf(w, "%s\t\n", au.Bold("Datasets"))
+		for _, d := range exp.Datasets {
+			fmt.Fprintf(w, "%s:\t%s\n", d.Name, formatDataset(d))
+		}
+	}
+
 	fmt.Fprintf(w, "\t\n")
 }
 
+// writeSortedMap writes the keys and values of m, sorted by key
+func writeSortedMap(w *tabwriter.Writer, m map[string]string) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s:\t%s\n", key, m[key])
+	}
+}
+
 func writeCheckpointMetrics(au aurora.Aurora, w *tabwriter.Writer, proj *project.Project, com *project.Checkpoint) error {
 	fmt.Fprintf(w, "%s\t\n", au.Bold("Metrics"))
 	metrics := com.SortedMetrics()
@@ -221,3 +436,13 @@ func writeCheckpointMetrics(au aurora.Aurora, w *tabwriter.Writer, proj *project
 	}
 	return nil
 }
+
+// formatDataset returns the fingerprint of a dataset, followed by what is
+// known about it
+func formatDataset(d *project.DatasetFingerprint) string {
+	details := []string{d.Path, fmt.Sprintf("%d files", d.Files), formatBytes(d.Size)}
+	if d.Rows != nil {
+		details = append(details, fmt.Sprintf("%d rows", *d.Rows))
+	}
+	return fmt.Sprintf("%s (%s)", d.Fingerprint(), strings.Join(details, ", "))
+}
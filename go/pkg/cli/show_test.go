@@ -242,3 +242,38 @@ To see more details about a checkpoint, run:
 	require.Equal(t, "1ccccccccc", exp.Checkpoints[0].ID)
 
 }
+
+func TestShowExperimentMetricSeries(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(workingDir, ".replicate"))
+	require.NoError(t, err)
+	exp := &project.Experiment{ID: "1eeeeeeeee", Created: time.Now().UTC(), Config: &config.Config{}}
+	require.NoError(t, exp.Save(repo))
+	proj := project.NewProject(repo, workingDir)
+	result, err := proj.CheckpointOrExperimentFromPrefix("1eee")
+	require.NoError(t, err)
+
+	series := project.MetricSeries{}
+	for step := int64(0); step < 8; step++ {
+		require.NoError(t, series.Add(step, time.Now(), map[string]float64{"batch_loss": float64(8 - step)}))
+	}
+	require.NoError(t, proj.SaveMetricSeries(result.Experiment, series))
+
+	out := new(bytes.Buffer)
+	err = showExperiment(aurora.NewAurora(false), out, proj, result.Experiment)
+	require.NoError(t, err)
+	require.Contains(t, testutil.TrimRightLines(out.String()), `
+Metric series
+NAME        POINTS  STEPS  LAST  MIN  MAX
+batch_loss  8       0-7    1     1    8    █▇▆▅▄▃▂▁
+`)
+}
+
+func TestSparkline(t *testing.T) {
+	points := []project.MetricPoint{{Value: 0}, {Value: 5}, {Value: 10}}
+	require.Equal(t, "▁▄█", sparkline(points, 0, 10))
+	require.Equal(t, "▁▁▁", sparkline(points, 3, 3))
+}
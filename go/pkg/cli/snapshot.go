@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type snapshotOpts struct {
+	repositoryURL string
+	message       string
+	force         bool
+}
+
+func newSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Create, list, and restore snapshots of the repository",
+		Long: `Create, list, and restore snapshots of the repository.
+
+A snapshot is a copy of all of the metadata in the repository at a point in time, so the whole repository can be rolled back after a bad bulk delete or a botched migration. Snapshots are saved in the "` + project.SnapshotsDir + `" directory of the repository.
+
+The files of experiments and checkpoints aren't copied, because they never change once they are saved. A snapshot lists them instead, so if they have been deleted since it was made, restoring it moves them back out of the trash, or reports them as missing if they have been deleted for good.`,
+	}
+
+	cmd.AddCommand(
+		newSnapshotCreateCommand(),
+		newSnapshotListCommand(),
+		newSnapshotRestoreCommand(),
+	)
+
+	return cmd
+}
+
+func newSnapshotCreateCommand() *cobra.Command {
+	var opts snapshotOpts
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Snapshot the metadata in the repository",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return createSnapshot(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Snapshot the repository before a migration:
+replicate snapshot create -m "Before moving to the new bucket"`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVarP(&opts.message, "message", "m", "", "A message that describes the snapshot")
+
+	return cmd
+}
+
+func newSnapshotListCommand() *cobra.Command {
+	var opts snapshotOpts
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the snapshots of the repository",
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return listSnapshots(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func newSnapshotRestoreCommand() *cobra.Command {
+	var opts snapshotOpts
+
+	cmd := &cobra.Command{
+		Use:   "restore <snapshot ID>",
+		Short: "Roll the repository back to a snapshot",
+		Long: `Roll the repository back to a snapshot.
+
+The metadata in the snapshot is put back, and metadata that has been created since is deleted, so experiments and checkpoints that have been created since the snapshot disappear. Their files are left in the repository.
+
+Before anything is changed, the repository is snapshotted, so restoring can be undone by restoring that snapshot.
+
+While it runs, the repository is locked, so other maintenance can't run at the same time.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return restoreSnapshot(opts, args[0], os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+		Example: `Roll the repository back (where 20201015T093000Z-a1b2 is a snapshot ID, or a prefix of one):
+replicate snapshot restore 20201015T093000Z`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Restore without interactive prompt")
+
+	return cmd
+}
+
+// snapshotProject returns the project to snapshot. Like verify, it uses the
+// repository directly, not the metadata cache, so snapshots have what's
+// actually there.
+func snapshotProject(opts snapshotOpts) (*project.Project, error) {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return project.NewProject(repo, projectDir), nil
+}
+
+func createSnapshot(opts snapshotOpts, out io.Writer) error {
+	proj, err := snapshotProject(opts)
+	if err != nil {
+		return err
+	}
+	console.Info("Snapshotting the repository...")
+	snapshot, err := proj.CreateSnapshot(opts.message)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Created snapshot %s of %d experiments (%s of files).\n", snapshot.ID, snapshot.Experiments, formatBytes(snapshot.Size()))
+	return nil
+}
+
+func listSnapshots(opts snapshotOpts, out io.Writer) error {
+	proj, err := snapshotProject(opts)
+	if err != nil {
+		return err
+	}
+	snapshots, err := proj.Snapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Fprintln(out, "There are no snapshots.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "ID\tCREATED\tUSER\tEXPERIMENTS\tSIZE\tMESSAGE\n")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", snapshot.ID, console.FormatTime(snapshot.Created), snapshot.User, snapshot.Experiments, formatBytes(snapshot.Size()), snapshot.Message)
+	}
+	return tw.Flush()
+}
+
+func restoreSnapshot(opts snapshotOpts, prefix string, out io.Writer) error {
+	proj, err := snapshotProject(opts)
+	if err != nil {
+		return err
+	}
+	snapshot, err := proj.SnapshotFromPrefix(prefix)
+	if err != nil {
+		return err
+	}
+
+	if !opts.force {
+		fmt.Fprintf(out, "You are about to roll the repository back to snapshot %s of %d experiments, created %s.\n", snapshot.ID, snapshot.Experiments, console.FormatTime(snapshot.Created))
+		fmt.Fprintln(out, "Experiments and checkpoints created since then will be removed.")
+		continueRestore, err := console.InteractiveBool{
+			Prompt:  "\nDo you want to continue?",
+			Default: false,
+		}.Read()
+		if err != nil {
+			return err
+		}
+		if !continueRestore {
+			return nil
+		}
+	}
+
+	console.Info("Restoring snapshot %s...", snapshot.ID)
+	restore, err := proj.RestoreSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Restored %d metadata files, and removed %d that have been created since.\n", len(restore.Restored), len(restore.Removed))
+	if len(restore.Recovered) > 0 {
+		fmt.Fprintf(out, "Moved %d files back out of the trash.\n", len(restore.Recovered))
+	}
+	if len(restore.Missing) > 0 {
+		fmt.Fprintf(out, "%d files in the snapshot have been deleted for good, so they couldn't be restored:\n", len(restore.Missing))
+		for _, objectPath := range restore.Missing {
+			fmt.Fprintf(out, "  %s\n", objectPath)
+		}
+		fmt.Fprintln(out, "Run 'replicate verify' to see which experiments and checkpoints are affected.")
+	}
+	fmt.Fprintf(out, "To undo this, run 'replicate snapshot restore %s'.\n", restore.Backup.ID)
+	return nil
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type statsOpts struct {
+	repositoryURL string
+	format        string
+	since         string
+	noStorage     bool
+	noInventory   bool
+}
+
+func newStatsCommand() *cobra.Command {
+	var opts statsOpts
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show statistics about all the experiments in the project",
+		Long: `Show statistics about all the experiments in the project.
+
+For each week, this shows how many experiments were created, how long they trained for on average (from when they started to their latest checkpoint, for experiments that have stopped), how much storage their files use, and the best and mean values of each primary metric in their best checkpoints. If more than one person has created experiments, the people who have created the most are shown too.
+
+Storage is measured by listing the repository, which can be slow for big repositories. If replicate.yaml has an 'inventory' of the repository's bucket, the sizes are read from it instead. Pass --no-storage to skip measuring storage.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return stats(opts, os.Stdout)
+		}),
+		Args: cobra.NoArgs,
+		Example: `Show statistics about the experiments created this year:
+replicate stats --since 2021-01-01
+
+Save a row for each week to a CSV file, to chart it in a spreadsheet:
+replicate stats --format csv > stats.csv`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.format, "format", "table", "Output format: table, json, or csv. csv has a row for each week")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only count experiments created on or after this date, e.g. 2021-01-01")
+	cmd.Flags().BoolVar(&opts.noStorage, "no-storage", false, "Don't list the repository to measure how much storage experiments use")
+	addNoInventoryFlagVar(cmd, &opts.noInventory)
+
+	return cmd
+}
+
+func stats(opts statsOpts, out io.Writer) error {
+	if opts.format != "table" && opts.format != "json" && opts.format != "csv" {
+		return fmt.Errorf("Unknown format: %s. It must be one of: table, json, csv", opts.format)
+	}
+	var since time.Time
+	if opts.since != "" {
+		var err error
+		since, err = time.ParseInLocation("2006-01-02", opts.since, timezone)
+		if err != nil {
+			return fmt.Errorf("--since must be a date like 2021-01-01, not %s", opts.since)
+		}
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	if !opts.noInventory {
+		setInventory(proj)
+	}
+	s, err := proj.Stats(since, !opts.noStorage)
+	if err != nil {
+		return err
+	}
+
+	switch opts.format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case "csv":
+		return writeStatsCSV(out, s)
+	}
+	return writeStatsTable(out, s, !opts.noStorage)
+}
+
+func writeStatsTable(out io.Writer, s *project.Stats, showStorage bool) error {
+	if s.Experiments == 0 {
+		fmt.Fprintln(out, "No experiments found")
+		return nil
+	}
+	fmt.Fprintf(out, "Experiments: %d, with %d checkpoints\n", s.Experiments, s.Checkpoints)
+	fmt.Fprintf(out, "Average training time: %s\n", formatStatsDuration(s.AverageDurationSeconds))
+	if showStorage {
+		fmt.Fprintf(out, "Storage: %s\n", formatBytes(s.StorageBytes))
+	}
+
+	fmt.Fprintln(out)
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "WEEK\tEXPERIMENTS\tCHECKPOINTS\tAVERAGE TIME")
+	if showStorage {
+		fmt.Fprint(tw, "\tSTORAGE ADDED\tTOTAL STORAGE")
+	}
+	for _, name := range s.Metrics {
+		fmt.Fprintf(tw, "\tBEST %s\tMEAN %s", name, name)
+	}
+	fmt.Fprint(tw, "\n")
+	for _, week := range s.Weeks {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s", week.Start.Format("2006-01-02"), week.Experiments, week.Checkpoints, formatStatsDuration(week.AverageDurationSeconds))
+		if showStorage {
+			fmt.Fprintf(tw, "\t%s\t%s", formatBytes(week.StorageBytes), formatBytes(week.TotalStorageBytes))
+		}
+		for _, name := range s.Metrics {
+			if trend, ok := week.Metrics[name]; ok {
+				fmt.Fprintf(tw, "\t%s\t%s", formatStatsFloat(trend.Best), formatStatsFloat(trend.Mean))
+			} else {
+				fmt.Fprint(tw, "\t-\t-")
+			}
+		}
+		fmt.Fprint(tw, "\n")
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Everyone's experiments are their own if only one person uses the
+	// repository
+	if len(s.Users) < 2 {
+		return nil
+	}
+	fmt.Fprintf(out, "\nMost active users:\n")
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "USER\tEXPERIMENTS\tCHECKPOINTS")
+	if showStorage {
+		fmt.Fprint(tw, "\tSTORAGE")
+	}
+	fmt.Fprint(tw, "\tLATEST EXPERIMENT\n")
+	for _, user := range s.Users {
+		fmt.Fprintf(tw, "%s\t%d\t%d", user.User, user.Experiments, user.Checkpoints)
+		if showStorage {
+			fmt.Fprintf(tw, "\t%s", formatBytes(user.StorageBytes))
+		}
+		fmt.Fprintf(tw, "\t%s\n", user.LastExperiment.In(timezone).Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+// writeStatsCSV writes a row for each week, with a column for the best and
+// mean of each primary metric, so it can be charted in a spreadsheet
+func writeStatsCSV(out io.Writer, s *project.Stats) error {
+	w := csv.NewWriter(out)
+	header := []string{"week", "experiments", "checkpoints", "average_duration_seconds", "storage_bytes", "total_storage_bytes"}
+	for _, name := range s.Metrics {
+		header = append(header, name+"_best", name+"_mean")
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, week := range s.Weeks {
+		record := []string{
+			week.Start.Format("2006-01-02"),
+			strconv.Itoa(week.Experiments),
+			strconv.Itoa(week.Checkpoints),
+			strconv.FormatFloat(week.AverageDurationSeconds, 'f', 0, 64),
+			strconv.FormatInt(week.StorageBytes, 10),
+			strconv.FormatInt(week.TotalStorageBytes, 10),
+		}
+		for _, name := range s.Metrics {
+			if trend, ok := week.Metrics[name]; ok {
+				record = append(record, strconv.FormatFloat(trend.Best, 'g', -1, 64), strconv.FormatFloat(trend.Mean, 'g', -1, 64))
+			} else {
+				record = append(record, "", "")
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func formatStatsDuration(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return (time.Duration(seconds) * time.Second).Round(time.Minute).String()
+}
+
+func formatStatsFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestWriteStats(t *testing.T) {
+	week := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	s := &project.Stats{
+		Experiments:            3,
+		Checkpoints:            3,
+		AverageDurationSeconds: 3 * 60 * 60,
+		StorageBytes:           10,
+		Weeks: []*project.WeekStats{{
+			Start:                  week,
+			Experiments:            2,
+			Checkpoints:            3,
+			AverageDurationSeconds: 3 * 60 * 60,
+			StorageBytes:           10,
+			TotalStorageBytes:      10,
+			Metrics:                map[string]*project.MetricTrend{"loss": {Goal: project.GoalMinimize, Best: 0.2, Mean: 0.3, Experiments: 2}},
+		}, {
+			Start:             week.AddDate(0, 0, 7),
+			Experiments:       1,
+			TotalStorageBytes: 10,
+			Metrics:           map[string]*project.MetricTrend{},
+		}},
+		Users: []*project.UserStats{
+			{User: "andreas", Experiments: 2, Checkpoints: 2, StorageBytes: 4, LastExperiment: week.AddDate(0, 0, 8)},
+			{User: "ben", Experiments: 1, Checkpoints: 1, StorageBytes: 6, LastExperiment: week.AddDate(0, 0, 2)},
+		},
+		Metrics: []string{"loss"},
+	}
+
+	out := new(bytes.Buffer)
+	require.NoError(t, writeStatsCSV(out, s))
+	require.Equal(t, `week,experiments,checkpoints,average_duration_seconds,storage_bytes,total_storage_bytes,loss_best,loss_mean
+2021-03-01,2,3,10800,10,10,0.2,0.3
+2021-03-08,1,0,0,0,10,,
+`, out.String())
+
+	out = new(bytes.Buffer)
+	require.NoError(t, writeStatsTable(out, s, true))
+	require.Contains(t, out.String(), "Average training time: 3h0m0s\n")
+	require.Contains(t, out.String(), "WEEK        EXPERIMENTS  CHECKPOINTS  AVERAGE TIME  STORAGE ADDED  TOTAL STORAGE  BEST loss  MEAN loss\n")
+	require.Contains(t, out.String(), "2021-03-01  2            3            3h0m0s        10 B           10 B           0.2        0.3\n")
+	require.Contains(t, out.String(), "Most active users:\n")
+
+	// The users aren't shown if there is only one
+	s.Users = s.Users[:1]
+	out = new(bytes.Buffer)
+	require.NoError(t, writeStatsTable(out, s, false))
+	require.NotContains(t, out.String(), "Most active users")
+	require.NotContains(t, out.String(), "STORAGE")
+}
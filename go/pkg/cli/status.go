@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type statusOpts struct {
+	repositoryURL string
+	trees         []string
+	clearFailed   bool
+}
+
+func newStatusCommand() *cobra.Command {
+	var opts statusOpts
+
+	cmd := &cobra.Command{
+		Use:   "status [experiment or checkpoint ID]",
+		Short: "Show uploads that haven't finished and how the project has changed since the latest checkpoint",
+		Long: `Show uploads that haven't finished and how the project has changed since the latest checkpoint.
+
+This shows:
+
+- Experiments and checkpoints that were saved while the repository couldn't be reached, and are waiting to be uploaded with 'replicate push'
+- Files of experiments and checkpoints that are being uploaded in the background, and uploads that failed or were interrupted because the process exited
+- Uploads to the repository that were started but never finished, which are still stored (and paid for) until they are aborted
+- How much space is used by local data in the project's .replicate directory
+- How much storage the project uses, if there is a 'quota' in replicate.yaml
+- Files in the project directory that have been added, changed or deleted since the latest checkpoint, or the experiment or checkpoint passed
+
+To compare the files, the checkpoint is downloaded to a temporary directory. Pass --tree to only compare some of its trees, e.g. to skip downloading weights.
+
+Uploads that failed or were interrupted are shown until you pass --clear-failed. Their checkpoints don't have all their files, so save them again or delete them with 'replicate rm'.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return status(opts, args, os.Stdout)
+		}),
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.clearFailed, "clear-failed", false, "Forget uploads that failed or were interrupted, after showing them")
+	cmd.Flags().StringSliceVar(&opts.trees, "tree", nil, "Only compare these trees of the checkpoint: code, weights or artifacts (defaults to all of them)")
+
+	return cmd
+}
+
+func status(opts statusOpts, args []string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	var quota *config.Quota
+	// replicate.yaml is optional if --repository is passed
+	if conf, _, err := config.FindConfigInWorkingDir(global.ProjectDirectory); err == nil {
+		proj.SetExclude(conf.Exclude)
+		proj.SetTrees(conf.Trees)
+		proj.SetQuota(conf.Quota)
+		quota = conf.Quota
+	}
+	if err := proj.SetCheckoutTrees(opts.trees); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Repository: %s\n", repo.RootURL())
+	fmt.Fprintf(out, "Project directory: %s\n", projectDir)
+
+	if err := printSpoolStatus(out, repository.SpoolDirForRepository(projectDir, repo.RootURL())); err != nil {
+		return err
+	}
+	if err := printBackgroundUploads(out, projectDir, opts.clearFailed); err != nil {
+		return err
+	}
+	if err := printIncompleteUploads(out, repo); err != nil {
+		return err
+	}
+	if err := printLocalData(out, projectDir); err != nil {
+		return err
+	}
+	if quota != nil {
+		if err := printQuota(out, proj, quota); err != nil {
+			return err
+		}
+	}
+	prefix := ""
+	if len(args) > 0 {
+		prefix = args[0]
+	}
+	return printWorkingDirectoryChanges(out, proj, prefix)
+}
+
+func printSpoolStatus(out io.Writer, spoolDir string) error {
+	summary, err := project.SummarizeSpool(spoolDir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nWaiting to be uploaded:\n")
+	if summary.Objects == 0 {
+		fmt.Fprintf(out, "  Nothing\n")
+		return nil
+	}
+	fmt.Fprintf(out, "  %d experiments and %d checkpoints (%d objects, %s) were saved while the repository couldn't be reached. Run 'replicate push' to upload them.\n", len(summary.Experiments), len(summary.Checkpoints), summary.Objects, formatBytes(summary.Size))
+	for _, id := range summary.Experiments {
+		fmt.Fprintf(out, "    experiment %s\n", shortID(id))
+	}
+	for _, id := range summary.Checkpoints {
+		fmt.Fprintf(out, "    checkpoint %s\n", shortID(id))
+	}
+	return nil
+}
+
+func printBackgroundUploads(out io.Writer, projectDir string, clearFailed bool) error {
+	uploads, err := project.ListUploads(projectDir)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nBackground uploads:\n")
+	if len(uploads) == 0 {
+		fmt.Fprintf(out, "  None\n")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, upload := range uploads {
+		var state string
+		switch {
+		case upload.State == project.UploadInterrupted:
+			state = fmt.Sprintf("interrupted %s, because the process that was uploading it was asked to exit", console.FormatTime(*upload.Failed))
+		case upload.State == project.UploadFailed:
+			state = fmt.Sprintf("failed %s: %s", console.FormatTime(*upload.Failed), upload.Error)
+		case upload.Interrupted():
+			state = fmt.Sprintf("interrupted, the process that was uploading it (PID %d) exited", upload.PID)
+		case upload.State == project.UploadUploading:
+			state = "uploading, started " + console.FormatTime(*upload.Started)
+		default:
+			state = "queued " + console.FormatTime(upload.Queued)
+		}
+		fmt.Fprintf(tw, "  %s %s\t%s\t%s\n", upload.Type, upload.ShortID(), upload.Path, state)
+		if clearFailed && (upload.State == project.UploadFailed || upload.Interrupted()) {
+			if err := project.RemoveUpload(projectDir, upload.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+func printIncompleteUploads(out io.Writer, repo repository.Repository) error {
+	lister, ok := repository.AsIncompleteUploadLister(repo)
+	if !ok {
+		return nil
+	}
+	uploads, err := lister.ListIncompleteUploads()
+	if err != nil {
+		if repository.IsUnreachable(err) {
+			console.Warn("Failed to list incomplete uploads: %s", err)
+			return nil
+		}
+		return err
+	}
+	fmt.Fprintf(out, "\nIncomplete uploads:\n")
+	if len(uploads) == 0 {
+		fmt.Fprintf(out, "  None\n")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, upload := range uploads {
+		fmt.Fprintf(tw, "  %s\tstarted %s\n", upload.Path, console.FormatTime(upload.Initiated))
+	}
+	return tw.Flush()
+}
+
+// printQuota prints how much storage the project and the current user's
+// experiments use, against the limits in replicate.yaml. Usage is measured
+// again if it was last recorded more than project.UsageMaxAge ago.
+func printQuota(out io.Writer, proj *project.Project, quota *config.Quota) error {
+	usage, err := proj.LoadUsage()
+	if err != nil {
+		return err
+	}
+	if usage == nil || time.Since(usage.Measured) > project.UsageMaxAge {
+		if usage, err = proj.MeasureUsage(); err != nil {
+			return err
+		}
+	}
+	username := project.CurrentUsername()
+	fmt.Fprintf(out, "\nStorage quota (measured %s):\n", console.FormatTime(usage.Measured))
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  Project\t%s\t%s\n", formatBytes(usage.Bytes), formatQuotaLimits(quota.Project))
+	if quota.User != nil {
+		fmt.Fprintf(tw, "  Experiments by %s\t%s\t%s\n", username, formatBytes(usage.Users[username]), formatQuotaLimits(quota.User))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range proj.QuotaWarnings(usage, username) {
+		fmt.Fprintf(out, "  %s\n", warning)
+	}
+	return nil
+}
+
+func formatQuotaLimits(limits *config.QuotaLimits) string {
+	if limits == nil {
+		return "no limit"
+	}
+	parts := []string{}
+	if limits.SoftLimitGB > 0 {
+		parts = append(parts, fmt.Sprintf("soft limit %g GB", limits.SoftLimitGB))
+	}
+	if limits.HardLimitGB > 0 {
+		parts = append(parts, fmt.Sprintf("hard limit %g GB", limits.HardLimitGB))
+	}
+	if len(parts) == 0 {
+		return "no limit"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printLocalData prints the size of each directory in the project's
+// .replicate directory, such as the metadata cache and the spool
+func printLocalData(out io.Writer, projectDir string) error {
+	localDir := filepath.Join(projectDir, ".replicate")
+	fmt.Fprintf(out, "\nLocal data:\n")
+	entries, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(out, "  None\n")
+			return nil
+		}
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	total := int64(0)
+	for _, entry := range entries {
+		size, err := dirSize(filepath.Join(localDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		total += size
+		fmt.Fprintf(tw, "  %s\t%s\n", filepath.Join(".replicate", entry.Name()), formatBytes(size))
+	}
+	fmt.Fprintf(tw, "  total\t%s\n", formatBytes(total))
+	return tw.Flush()
+}
+
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Temporary files can be removed as this runs
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func printWorkingDirectoryChanges(out io.Writer, proj *project.Project, prefix string) error {
+	exp, chk, err := statusCheckpoint(proj, prefix)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nChanges in the project directory:\n")
+	if exp == nil {
+		fmt.Fprintf(out, "  There aren't any experiments to compare with\n")
+		return nil
+	}
+	description := "experiment " + exp.ShortID()
+	if chk != nil {
+		description = fmt.Sprintf("checkpoint %s of experiment %s", chk.ShortID(), exp.ShortID())
+	}
+	changes, err := proj.WorkingDirectoryChanges(exp, chk)
+	if err != nil {
+		return fmt.Errorf("Failed to compare the project directory with %s: %w", description, err)
+	}
+	if changes.Empty() {
+		fmt.Fprintf(out, "  No changes since %s\n", description)
+		return nil
+	}
+	fmt.Fprintf(out, "  Since %s:\n", description)
+	for _, c := range []struct {
+		label string
+		paths []string
+	}{{"added", changes.Added}, {"modified", changes.Modified}, {"deleted", changes.Deleted}} {
+		for _, p := range c.paths {
+			fmt.Fprintf(out, "    %-9s %s\n", c.label+":", p)
+		}
+	}
+	return nil
+}
+
+// statusCheckpoint returns the experiment or checkpoint with prefix, or the
+// latest checkpoint if prefix is empty. If there are no checkpoints, the
+// latest experiment is returned. If there aren't any experiments, it returns
+// nil.
+func statusCheckpoint(proj *project.Project, prefix string) (*project.Experiment, *project.Checkpoint, error) {
+	if prefix != "" {
+		result, err := proj.CheckpointOrExperimentFromPrefix(prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		return result.Experiment, result.Checkpoint, nil
+	}
+	experiments, err := proj.Experiments()
+	if err != nil {
+		return nil, nil, err
+	}
+	var latestExp *project.Experiment
+	var latestChk *project.Checkpoint
+	for _, exp := range experiments {
+		if chk := exp.LatestCheckpoint(); chk != nil {
+			if latestChk == nil || chk.Created.After(latestChk.Created) {
+				latestExp, latestChk = exp, chk
+			}
+		} else if latestChk == nil && (latestExp == nil || exp.Created.After(latestExp.Created)) {
+			latestExp = exp
+		}
+	}
+	return latestExp, latestChk, nil
+}
@@ -0,0 +1,293 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+type sweepOpts struct {
+	repositoryURL string
+	dryRun        bool
+	concurrency   int
+}
+
+func newSweepCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sweep",
+		Short: "Launch and follow parameter sweeps",
+		Long: `Launch and follow parameter sweeps.
+
+A sweep runs a command many times with different params, to find the params that give the best results. Sweeps are defined in the 'sweeps' section of replicate.yaml, as a grid of values to try every combination of, or ranges and lists to pick random values from.
+
+Each run is an experiment of its own, and the experiments of a sweep are linked to it, so 'replicate sweep status' can compare them.`,
+	}
+
+	cmd.AddCommand(
+		newSweepRunCommand(),
+		newSweepStatusCommand(),
+	)
+
+	return cmd
+}
+
+func newSweepRunCommand() *cobra.Command {
+	var opts sweepOpts
+
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Launch the runs of a sweep in replicate.yaml",
+		Long: `Launch the runs of a sweep in replicate.yaml.
+
+Each run's command is run in the project directory, with its params filled in. The runs are launched on this machine, --concurrency at a time. If a run fails, the others carry on.
+
+The experiment each run creates is named <sweep>-<run>, and is linked to the sweep with the environment variables ` + project.SweepIDEnvVar + ` and ` + project.SweepRunEnvVar + `. The run's params are also in ` + project.SweepParamsEnvVar + `, as JSON.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return runSweep(opts, args[0], os.Stdout)
+		}),
+		Args: cobra.ExactArgs(1),
+		Example: `See the commands of a sweep called "learning-rate" without running them:
+replicate sweep run learning-rate --dry-run
+
+Run the sweep, four runs at a time:
+replicate sweep run learning-rate --concurrency 4`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show the commands of the runs without running them")
+	cmd.Flags().IntVar(&opts.concurrency, "concurrency", 0, "How many runs to run at a time (default: 'concurrency' of the sweep in replicate.yaml, or 1)")
+
+	return cmd
+}
+
+func newSweepStatusCommand() *cobra.Command {
+	var opts sweepOpts
+
+	cmd := &cobra.Command{
+		Use:   "status [sweep ID or name]",
+		Short: "Show how the runs of a sweep are going, and which is best",
+		Long: `Show how the runs of a sweep are going, and which is best.
+
+Each run is shown with its params, its experiment, and the value of the primary metric at its best checkpoint. The best run is the one with the best value of the sweep's 'primary_metric', or if it doesn't have one, of the experiments' own primary metric.
+
+If a name is passed, the latest sweep with that name is shown. If nothing is passed, the latest sweep is shown.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			prefix := ""
+			if len(args) > 0 {
+				prefix = args[0]
+			}
+			return showSweepStatus(opts, prefix, os.Stdout)
+		}),
+		Args: cobra.MaximumNArgs(1),
+		Example: `Show the latest sweep called "learning-rate":
+replicate sweep status learning-rate`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+
+	return cmd
+}
+
+func runSweep(opts sweepOpts, name string, out io.Writer) error {
+	conf, workingDir, err := config.FindConfigInWorkingDir(global.ProjectDirectory)
+	if err != nil {
+		return err
+	}
+	sweepConf, ok := conf.Sweeps[name]
+	if !ok {
+		names := []string{}
+		for n := range conf.Sweeps {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("replicate.yaml doesn't have a 'sweeps' section. To define a sweep, take a look at the replicate.yaml reference:\n%s/docs/reference/yaml", global.WebURL)
+		}
+		return fmt.Errorf("There isn't a sweep called %q in replicate.yaml. The sweeps are: %s", name, strings.Join(names, ", "))
+	}
+	if opts.concurrency < 0 {
+		return fmt.Errorf("--concurrency can't be negative")
+	}
+	concurrency := opts.concurrency
+	if concurrency == 0 {
+		concurrency = sweepConf.ConcurrentRuns()
+	}
+
+	sweep, err := project.NewSweep(name, sweepConf)
+	if err != nil {
+		return err
+	}
+	if opts.dryRun {
+		fmt.Fprintf(out, "This would launch %d runs:\n", len(sweep.Runs))
+		for _, run := range sweep.Runs {
+			fmt.Fprintf(out, "  %d: %s\n", run.Run, run.Command)
+		}
+		return nil
+	}
+
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	if err := proj.SaveSweep(sweep); err != nil {
+		return err
+	}
+	console.Info("Launching %d runs of sweep %s (%s), %d at a time", len(sweep.Runs), sweep.Name, sweep.ShortID(), concurrency)
+
+	failed := []int{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, run := range sweep.Runs {
+		run := run
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := runSweepRun(sweep, run, workingDir); err != nil {
+				console.Warn("Run %d of sweep %s failed: %s", run.Run, sweep.Name, err)
+				mu.Lock()
+				failed = append(failed, run.Run)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	fmt.Fprintf(out, "To see how the runs did, run:\n  replicate sweep status %s\n", sweep.ShortID())
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		runs := []string{}
+		for _, run := range failed {
+			runs = append(runs, fmt.Sprintf("%d", run))
+		}
+		return fmt.Errorf("%d of %d runs failed: %s", len(failed), len(sweep.Runs), strings.Join(runs, ", "))
+	}
+	return nil
+}
+
+// runSweepRun runs the command of run in the project directory, and waits for
+// it to finish
+func runSweepRun(sweep *project.Sweep, run *project.SweepRun, dir string) error {
+	env, err := sweep.Env(run)
+	if err != nil {
+		return err
+	}
+	console.Info("Run %d: %s", run.Run, run.Command)
+	cmd := exec.Command("/bin/sh", "-c", run.Command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func showSweepStatus(opts sweepOpts, prefix string, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := getRepository(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	sweep, err := proj.SweepFromPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	statuses, best, err := proj.SweepStatus(sweep)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Sweep:    %s (%s)\n", sweep.Name, sweep.ID)
+	fmt.Fprintf(out, "Created:  %s\n", console.FormatTime(sweep.Created))
+	fmt.Fprintf(out, "Method:   %s\n", sweep.Method)
+	if sweep.PrimaryMetric != nil {
+		fmt.Fprintf(out, "Metric:   %s (%s)\n", sweep.PrimaryMetric.Name, sweep.PrimaryMetric.Goal)
+	}
+	fmt.Fprintln(out)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "RUN\tPARAMS\tEXPERIMENT\tSTATUS\tBEST\n")
+	for _, status := range statuses {
+		experiment := "-"
+		state := "not started"
+		if status.Experiment != nil {
+			experiment = status.Experiment.ShortID()
+			state = "stopped"
+			if status.Running {
+				state = "running"
+			}
+		}
+		run := fmt.Sprintf("%d", status.Run.Run)
+		if best != nil && status == best {
+			run += " (best)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", run, formatSweepParams(status.Run.Params), experiment, state, formatSweepBest(sweep, status.Best))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	if best == nil {
+		fmt.Fprintln(out, "None of the runs have a best checkpoint yet.")
+		return nil
+	}
+	fmt.Fprintf(out, "Best run is %d, with checkpoint %s of experiment %s: %s\n", best.Run.Run, best.Best.ShortID(), best.Experiment.ShortID(), formatSweepBest(sweep, best.Best))
+	return nil
+}
+
+func formatSweepParams(params param.ValueMap) string {
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, name+"="+params[name].ShortString(10, 5))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatSweepBest returns the metric a best checkpoint of sweep was picked
+// by, e.g. "loss=0.012"
+func formatSweepBest(sweep *project.Sweep, chk *project.Checkpoint) string {
+	if chk == nil {
+		return "-"
+	}
+	metric := sweep.PrimaryMetric
+	if metric == nil {
+		metric = chk.PrimaryMetric
+	}
+	if metric == nil {
+		return "-"
+	}
+	value, ok := chk.Metrics[metric.Name]
+	if !ok {
+		return "-"
+	}
+	return metric.Name + "=" + value.ShortString(10, 5)
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type verifyOpts struct {
+	repositoryURL string
+	quarantine    bool
+	noInventory   bool
+	signatures    bool
+}
+
+func newVerifyCommand() *cobra.Command {
+	var opts verifyOpts
+
+	cmd := &cobra.Command{
+		Use:   "verify [experiment or checkpoint ID...]",
+		Short: "Check the repository for missing or corrupt files",
+		Long: `Check the repository for missing or corrupt files.
+
+This reads all of the experiment metadata in the repository, and checks that the files for each experiment and checkpoint exist and can be read. Where the repository stores a checksum for a file, it is checked against the file's content.
+
+This downloads every file in the repository, so it can take a while for large repositories.
+
+If replicate.yaml has an 'inventory' of the repository's bucket, it is read instead of listing the bucket, and files that have been saved since it was made are looked for separately. Pass --no-inventory to list the bucket anyway.
+
+With --quarantine, corrupt files are moved into the "` + project.QuarantineDir + `" directory in the repository so Replicate no longer tries to read them.
+
+With --signatures, the signatures of checkpoints are checked instead, against the 'allowed_signers' or 'public_key' in 'signing' in replicate.yaml. This checks each checkpoint was signed by someone you trust, that its experiment, step, metrics, command and params are the ones that were signed, and that its files haven't changed since. Checkpoints that aren't signed are reported too. If IDs are passed, only those checkpoints, or the checkpoints of those experiments, are checked.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			if opts.signatures {
+				return verifySignatures(opts, args, os.Stdout)
+			}
+			if len(args) > 0 {
+				return fmt.Errorf("IDs can only be passed with --signatures")
+			}
+			return verify(opts, os.Stdout)
+		}),
+		Args: cobra.ArbitraryArgs,
+		Example: `Check a checkpoint was signed by someone in the allowed signers, and its files haven't changed:
+replicate verify --signatures 3ef2a1`,
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	addNoInventoryFlagVar(cmd, &opts.noInventory)
+	cmd.Flags().BoolVar(&opts.quarantine, "quarantine", false, "Move corrupt files into the "+project.QuarantineDir+" directory of the repository")
+	cmd.Flags().BoolVar(&opts.signatures, "signatures", false, "Check the signatures of checkpoints, instead of the files in the repository")
+
+	return cmd
+}
+
+func verify(opts verifyOpts, out io.Writer) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	// Use the repository directly, not the metadata cache, so we check what's actually there
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	if !opts.noInventory {
+		setInventory(proj)
+	}
+
+	console.Info("Verifying %s...", repo.RootURL())
+	problems, err := proj.Verify()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "No problems found.")
+		return nil
+	}
+
+	au := getAurora()
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%s %s: %s\n", au.Red(problem.Kind), problem.Path, problem.Description)
+	}
+
+	if opts.quarantine {
+		fmt.Fprintln(out)
+		for _, problem := range problems {
+			if problem.Kind != project.ProblemCorrupt {
+				continue
+			}
+			if err := proj.Quarantine(problem.Path); err != nil {
+				return fmt.Errorf("Failed to quarantine %s: %w", problem.Path, err)
+			}
+			fmt.Fprintf(out, "Moved %s to %s\n", problem.Path, path.Join(project.QuarantineDir, problem.Path))
+		}
+	}
+
+	if len(problems) == 1 {
+		return fmt.Errorf("Found 1 problem")
+	}
+	return fmt.Errorf("Found %d problems", len(problems))
+}
+
+func verifySignatures(opts verifyOpts, ids []string, out io.Writer) error {
+	if opts.quarantine {
+		return fmt.Errorf("--quarantine can't be used with --signatures")
+	}
+	conf, err := getProjectConfig(global.ProjectDirectory)
+	if err != nil {
+		return err
+	}
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.SetSigning(conf.Signing)
+
+	console.Info("Verifying the signatures of checkpoints in %s...", repo.RootURL())
+	problems, err := proj.VerifySignatures(ids)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "All signatures are valid.")
+		return nil
+	}
+
+	au := getAurora()
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%s %s: %s\n", au.Red(problem.Kind), problem.Path, problem.Description)
+	}
+	if len(problems) == 1 {
+		return fmt.Errorf("Found 1 problem")
+	}
+	return fmt.Errorf("Found %d problems", len(problems))
+}
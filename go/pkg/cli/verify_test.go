@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestVerify(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	repoDir, err := files.TempDir("test-verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	experiment := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Now(),
+		Config:  &config.Config{},
+		Path:    ".",
+		Checkpoints: []*project.Checkpoint{
+			{ID: "1ccccccccc", Created: time.Now(), Path: "."},
+			{ID: "2ccccccccc", Created: time.Now(), Path: "."},
+			{ID: "3ccccccccc", Created: time.Now(), Path: ""},
+		},
+	}
+	require.NoError(t, experiment.Save(repo))
+
+	codeDir, err := files.TempDir("test-verify-code")
+	require.NoError(t, err)
+	defer os.RemoveAll(codeDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, repo.PutPathTar(codeDir, "experiments/1eeeeeeeee.tar.gz", ""))
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/1ccccccccc.tar.gz", ""))
+
+	opts := verifyOpts{repositoryURL: "file://" + repoDir}
+
+	// 2ccccccccc is missing
+	out := new(bytes.Buffer)
+	err = verify(opts, out)
+	require.EqualError(t, err, "Found 1 problem")
+	require.Equal(t, "missing checkpoints/2ccccccccc.tar.gz: Files for checkpoint 2cccccc of experiment 1eeeeee do not exist\n", out.String())
+
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/2ccccccccc.tar.gz", ""))
+	out = new(bytes.Buffer)
+	require.NoError(t, verify(opts, out))
+	require.Equal(t, "No problems found.\n", out.String())
+
+	// corrupt tarball, bad metadata, and a tarball nothing refers to
+	require.NoError(t, repo.Put("checkpoints/1ccccccccc.tar.gz", []byte("not a tarball")))
+	require.NoError(t, repo.Put("metadata/experiments/2eeeeeeeee.json", []byte("{")))
+	require.NoError(t, repo.PutPathTar(codeDir, "experiments/3eeeeeeeee.tar.gz", ""))
+
+	out = new(bytes.Buffer)
+	opts.quarantine = true
+	err = verify(opts, out)
+	require.EqualError(t, err, "Found 3 problems")
+	require.Contains(t, out.String(), "corrupt checkpoints/1ccccccccc.tar.gz: Files for checkpoint 1cccccc of experiment 1eeeeee are corrupt")
+	require.Contains(t, out.String(), "corrupt metadata/experiments/2eeeeeeeee.json: Failed to parse experiment metadata")
+	require.Contains(t, out.String(), "unreferenced experiments/3eeeeeeeee.tar.gz: Not referenced by any experiment or checkpoint")
+	require.Contains(t, out.String(), "Moved checkpoints/1ccccccccc.tar.gz to quarantine/checkpoints/1ccccccccc.tar.gz")
+	require.Contains(t, out.String(), "Moved metadata/experiments/2eeeeeeeee.json to quarantine/metadata/experiments/2eeeeeeeee.json")
+
+	data, err := repo.Get("quarantine/checkpoints/1ccccccccc.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, "not a tarball", string(data))
+	exists, err := files.FileExists(path.Join(repoDir, "metadata/experiments/2eeeeeeeee.json"))
+	require.NoError(t, err)
+	require.False(t, exists)
+}
@@ -0,0 +1,386 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/replicate/go/pkg/client"
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+type watchOpts struct {
+	repositoryURL string
+	name          string
+	path          string
+	files         []string
+	metrics       string
+	interval      time.Duration
+}
+
+func newWatchCommand() *cobra.Command {
+	var opts watchOpts
+
+	cmd := &cobra.Command{
+		Use:   "watch [flags] [-- <command> [args...]]",
+		Short: "Create an experiment, and checkpoint files whenever they change",
+		Long: `Create an experiment, and checkpoint files whenever they change.
+
+This records experiments from training code that writes its models and metrics to disk, without changing the code. The files to watch are glob patterns, relative to the project directory, set with --files or 'paths' in 'watch' in replicate.yaml. When any of them are created or changed, and have stopped changing, a checkpoint of them is created. If there is a metrics file, its top-level values are recorded as the metrics of each checkpoint, and its "step" value, if it has one, as the step.
+
+If a command is given, it is run, and the experiment stops when it exits. Otherwise, the experiment stops when this is interrupted.`,
+		Run: handleErrors(func(cmd *cobra.Command, args []string) error {
+			return watch(opts, args)
+		}),
+		Args: cobra.ArbitraryArgs,
+		Example: `Checkpoint the models and metrics a training script saves:
+replicate watch --files 'outputs/*.pt' --metrics metrics.json -- python train.py`,
+		Annotations: map[string]string{handlesInterruptsAnnotation: "true"},
+	}
+
+	addRepositoryURLFlagVar(cmd, &opts.repositoryURL)
+	cmd.Flags().StringVar(&opts.name, "name", os.Getenv("REPLICATE_EXPERIMENT_NAME"), "Name of the experiment (default: $REPLICATE_EXPERIMENT_NAME, or a generated name)")
+	cmd.Flags().StringVar(&opts.path, "path", "", "File or directory to save with the experiment, such as your training code (default: nothing)")
+	cmd.Flags().StringSliceVar(&opts.files, "files", nil, "Glob patterns of files to checkpoint when they change (default: 'paths' in 'watch' in replicate.yaml)")
+	cmd.Flags().StringVar(&opts.metrics, "metrics", "", "JSON file of metrics to record with each checkpoint (default: 'metrics' in 'watch' in replicate.yaml)")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 0, "How often to look for changes (default: 'interval_seconds' in 'watch' in replicate.yaml, or 5s)")
+
+	return cmd
+}
+
+func watch(opts watchOpts, args []string) error {
+	repositoryURL, projectDir, err := getRepositoryURLFromStringOrConfig(opts.repositoryURL)
+	if err != nil {
+		return err
+	}
+	conf, err := getProjectConfig(projectDir)
+	if err != nil {
+		return err
+	}
+	watchConf := conf.Watch
+	if watchConf == nil {
+		watchConf = &config.Watch{}
+	}
+	if len(opts.files) > 0 {
+		watchConf.Paths = opts.files
+	}
+	if opts.metrics != "" {
+		watchConf.Metrics = opts.metrics
+	}
+	interval := watchConf.Interval()
+	if opts.interval > 0 {
+		interval = opts.interval
+	}
+	if len(watchConf.Paths) == 0 && watchConf.Metrics == "" {
+		return fmt.Errorf("Nothing to watch. Pass the files to watch with --files, or set 'paths' in 'watch' in replicate.yaml")
+	}
+
+	c, err := client.New(client.Options{ProjectDir: projectDir, RepositoryURL: repositoryURL, AsyncUploads: true})
+	if err != nil {
+		return err
+	}
+	w, err := newWatcher(projectDir, watchConf)
+	if err != nil {
+		return err
+	}
+
+	command := "replicate watch"
+	if len(args) > 0 {
+		command = strings.Join(args, " ")
+	}
+	exp, err := c.CreateExperiment(client.ExperimentOptions{Name: opts.name, Path: opts.path, Command: command})
+	if err != nil {
+		return err
+	}
+
+	// The first interrupt stops watching, and checkpoints what has changed.
+	// Interrupting again cancels the uploads.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	interrupted := make(chan struct{})
+	go func() {
+		<-sigc
+		close(interrupted)
+		<-sigc
+		console.Info("Stopping uploads...")
+		repository.CancelTransfers()
+	}()
+
+	stop := interrupted
+	var cmdErr error
+	if len(args) > 0 {
+		proc := exec.Command(args[0], args[1:]...)
+		proc.Stdin = os.Stdin
+		proc.Stdout = os.Stdout
+		proc.Stderr = os.Stderr
+		proc.Env = append(os.Environ(), "REPLICATE_EXPERIMENT_ID="+exp.ID)
+		if err := proc.Start(); err != nil {
+			return fmt.Errorf("Failed to run %s: %w", command, err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			cmdErr = proc.Wait()
+			close(exited)
+		}()
+		// The command gets interrupts itself, so it is left to exit
+		stop = exited
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for watching := true; watching; {
+		select {
+		case <-ticker.C:
+			changed, err := w.poll()
+			if err != nil {
+				console.Warn("Failed to look for changes: %s", err)
+				continue
+			}
+			if err := w.checkpoint(exp, changed); err != nil {
+				console.Warn("%s", err)
+			}
+		case <-stop:
+			watching = false
+		}
+	}
+
+	// Catch what was written just before the command exited
+	changed, err := w.flush()
+	if err != nil {
+		console.Warn("Failed to look for changes: %s", err)
+	} else if err := w.checkpoint(exp, changed); err != nil {
+		console.Warn("%s", err)
+	}
+	if err := exp.Stop(); err != nil {
+		return err
+	}
+	if exitErr, ok := cmdErr.(*exec.ExitError); ok {
+		// Exit with the command's exit code, like it was run directly
+		os.Exit(exitErr.ExitCode())
+	}
+	return cmdErr
+}
+
+// watchedFile is what is compared to see if a file has changed
+type watchedFile struct {
+	size    int64
+	modTime int64
+}
+
+// watcher polls files for changes. A change is only reported once two polls
+// in a row agree, so files aren't checkpointed while they are being written.
+type watcher struct {
+	projectDir string
+	conf       *config.Watch
+
+	// checkpointed are the files as they were when they were last
+	// checkpointed, or when watching started, by path relative to the
+	// project directory
+	checkpointed map[string]watchedFile
+	// pending are the files as they were at the last poll, if they had
+	// changed since they were checkpointed
+	pending map[string]watchedFile
+	// step is the step of the next checkpoint, if the metrics don't have one
+	step int64
+}
+
+func newWatcher(projectDir string, conf *config.Watch) (*watcher, error) {
+	w := &watcher{projectDir: projectDir, conf: conf}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.checkpointed = files
+	return w, nil
+}
+
+// scan returns the files that match the watched patterns. Directories that
+// match are watched recursively.
+func (w *watcher) scan() (map[string]watchedFile, error) {
+	patterns := w.conf.Paths
+	if w.conf.Metrics != "" {
+		patterns = append([]string{w.conf.Metrics}, patterns...)
+	}
+	files := map[string]watchedFile{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(w.projectDir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(p string, info os.FileInfo, err error) error {
+				if err != nil {
+					// It might have been deleted since it was matched
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if !info.Mode().IsRegular() {
+					return nil
+				}
+				rel, err := filepath.Rel(w.projectDir, p)
+				if err != nil {
+					return err
+				}
+				files[filepath.ToSlash(rel)] = watchedFile{size: info.Size(), modTime: info.ModTime().UnixNano()}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// poll returns the files that have been created or changed since they were
+// last checkpointed, once they have stopped changing
+func (w *watcher) poll() ([]string, error) {
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	if sameFiles(files, w.checkpointed) {
+		w.pending = nil
+		return nil, nil
+	}
+	if w.pending == nil || !sameFiles(files, w.pending) {
+		w.pending = files
+		return nil, nil
+	}
+	return w.changedSince(files), nil
+}
+
+// flush returns the files that have been created or changed since they were
+// last checkpointed, whether or not they have stopped changing
+func (w *watcher) flush() ([]string, error) {
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	return w.changedSince(files), nil
+}
+
+func (w *watcher) changedSince(files map[string]watchedFile) []string {
+	changed := []string{}
+	for p, f := range files {
+		if prev, ok := w.checkpointed[p]; !ok || prev != f {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	w.checkpointed = files
+	w.pending = nil
+	return changed
+}
+
+// checkpoint creates a checkpoint of exp with the files that changed, and
+// the metrics in the metrics file
+func (w *watcher) checkpoint(exp *client.Experiment, changed []string) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	paths := []string{}
+	for _, p := range changed {
+		if p != path.Clean(filepath.ToSlash(w.conf.Metrics)) {
+			paths = append(paths, p)
+		}
+	}
+	metrics, err := w.readMetrics()
+	if err != nil {
+		return err
+	}
+	opts := client.CheckpointOptions{
+		Path:    commonPath(paths),
+		Step:    w.step,
+		Metrics: metrics,
+	}
+	if step, ok := metrics["step"].(float64); ok {
+		opts.Step = int64(step)
+	}
+	if w.conf.PrimaryMetric != "" {
+		if _, ok := metrics[w.conf.PrimaryMetric]; ok {
+			opts.PrimaryMetric = w.conf.PrimaryMetric
+			opts.Goal = project.MetricGoal(w.conf.Goal)
+		} else {
+			console.Warn("The primary metric %q isn't in %s", w.conf.PrimaryMetric, w.conf.Metrics)
+		}
+	}
+	if _, err := exp.Checkpoint(opts); err != nil {
+		return fmt.Errorf("Failed to checkpoint %s: %w", strings.Join(changed, ", "), err)
+	}
+	w.step = opts.Step + 1
+	return nil
+}
+
+// readMetrics returns the top-level values in the metrics file, or nil if
+// there isn't one
+func (w *watcher) readMetrics() (map[string]interface{}, error) {
+	if w.conf.Metrics == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(w.projectDir, filepath.FromSlash(w.conf.Metrics)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	metrics := map[string]interface{}{}
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to parse %s, which must be a JSON object of metrics: %s", w.conf.Metrics, err))
+	}
+	return metrics, nil
+}
+
+// commonPath returns the deepest path that contains all of paths, which is
+// the path itself if there is only one, or "" if there are none
+func commonPath(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	if len(paths) == 1 {
+		return paths[0]
+	}
+	common := strings.Split(path.Dir(paths[0]), "/")
+	for _, p := range paths[1:] {
+		parts := strings.Split(path.Dir(p), "/")
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return "."
+	}
+	return strings.Join(common, "/")
+}
+
+func sameFiles(a, b map[string]watchedFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, f := range a {
+		if other, ok := b[p]; !ok || other != f {
+			return false
+		}
+	}
+	return true
+}
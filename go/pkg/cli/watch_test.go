@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/client"
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestWatcher(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	outputs := filepath.Join(projectDir, "outputs")
+	require.NoError(t, os.Mkdir(outputs, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputs, "old.pt"), []byte("old"), 0644))
+
+	c, err := client.New(client.Options{
+		ProjectDir:    projectDir,
+		RepositoryURL: "file://" + filepath.Join(projectDir, ".replicate"),
+	})
+	require.NoError(t, err)
+	exp, err := c.CreateExperiment(client.ExperimentOptions{DisableHeartbeat: true, Quiet: true})
+	require.NoError(t, err)
+
+	w, err := newWatcher(projectDir, &config.Watch{
+		Paths:         []string{"outputs/*.pt"},
+		Metrics:       "metrics.json",
+		PrimaryMetric: "loss",
+		Goal:          "minimize",
+	})
+	require.NoError(t, err)
+
+	// Files that were there when watching started aren't changes
+	changed, err := w.poll()
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	// Changes are reported once they have stopped changing
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputs, "model.pt"), []byte("weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "metrics.json"), []byte(`{"loss": 0.5, "step": 3}`), 0644))
+	changed, err = w.poll()
+	require.NoError(t, err)
+	require.Empty(t, changed)
+	changed, err = w.poll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"metrics.json", "outputs/model.pt"}, changed)
+
+	require.NoError(t, w.checkpoint(exp, changed))
+	require.Len(t, exp.Checkpoints, 1)
+	chk := exp.Checkpoints[0]
+	require.Equal(t, "outputs/model.pt", chk.Path)
+	require.Equal(t, int64(3), chk.Step)
+	require.Equal(t, 0.5, chk.Metrics["loss"].FloatVal())
+	require.Equal(t, &project.PrimaryMetric{Name: "loss", Goal: project.GoalMinimize}, chk.PrimaryMetric)
+
+	changed, err = w.poll()
+	require.NoError(t, err)
+	require.Empty(t, changed)
+
+	// Flushing doesn't wait for files to stop changing
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputs, "old.pt"), []byte("new weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputs, "model.pt"), []byte("more weights"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "metrics.json"), []byte(`{"loss": 0.25, "step": 4}`), 0644))
+	changed, err = w.flush()
+	require.NoError(t, err)
+	require.Equal(t, []string{"metrics.json", "outputs/model.pt", "outputs/old.pt"}, changed)
+	require.NoError(t, w.checkpoint(exp, changed))
+	require.Equal(t, "outputs", exp.Checkpoints[1].Path)
+	require.Equal(t, int64(4), exp.Checkpoints[1].Step)
+}
+
+func TestCommonPath(t *testing.T) {
+	require.Equal(t, "", commonPath(nil))
+	require.Equal(t, "outputs/model.pt", commonPath([]string{"outputs/model.pt"}))
+	require.Equal(t, "outputs", commonPath([]string{"outputs/a.pt", "outputs/b.pt"}))
+	require.Equal(t, "outputs", commonPath([]string{"outputs/a.pt", "outputs/epoch1/b.pt"}))
+	require.Equal(t, ".", commonPath([]string{"model.pt", "outputs/b.pt"}))
+}
@@ -0,0 +1,421 @@
+// Package client is a Go library for recording experiments, the same way the
+// Python library does. It can be used to record experiments from training
+// code or orchestration tools written in Go.
+//
+//	c, err := client.New(client.Options{})
+//	exp, err := c.CreateExperiment(client.ExperimentOptions{
+//	    Path:   ".",
+//	    Params: map[string]interface{}{"learning_rate": 0.01},
+//	})
+//	for step := 0; step < 10; step++ {
+//	    // ... train, logging the loss of each batch ...
+//	    err = exp.LogMetrics(int64(step), map[string]float64{"batch_loss": batchLoss})
+//	    _, err = exp.Checkpoint(client.CheckpointOptions{
+//	        Path:          "model.pth",
+//	        Step:          int64(step),
+//	        Metrics:       map[string]interface{}{"loss": loss},
+//	        PrimaryMetric: "loss",
+//	        Goal:          project.GoalMinimize,
+//	    })
+//	}
+//	err = exp.Stop()
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+	"github.com/replicate/replicate/go/pkg/shared"
+)
+
+// Options configures a Client
+type Options struct {
+	// ProjectDir is the project directory. Paths of experiments and
+	// checkpoints are relative to it. If it is empty, the nearest parent of
+	// the working directory with replicate.yaml in it is used.
+	ProjectDir string
+	// RepositoryURL is the repository to save experiments to. If it is
+	// empty, the repository in replicate.yaml is used.
+	RepositoryURL string
+	// AsyncUploads makes creating experiments and checkpoints return as soon
+	// as their files have been snapshotted, and uploads them in the
+	// background. Call Wait, or Experiment.Stop, to wait for them.
+	AsyncUploads bool
+}
+
+// Client records experiments in a project
+type Client struct {
+	project *project.Project
+
+	// workChan is the queue of uploads if AsyncUploads is set
+	workChan chan func() error
+	mu       sync.Mutex
+	// uploadErrors are the errors of uploads since Wait was last called
+	uploadErrors []error
+}
+
+// uploadQueueSize is how many uploads can be waiting before creating a
+// checkpoint blocks
+const uploadQueueSize = 10
+
+// New returns a client for the project configured by opts
+func New(opts Options) (*Client, error) {
+	repositoryURL := opts.RepositoryURL
+	projectDir := opts.ProjectDir
+	conf := &config.Config{}
+
+	foundConf, confProjectDir, err := config.FindConfigInWorkingDir(opts.ProjectDir)
+	if err != nil {
+		if !errors.IsConfigNotFound(err) || repositoryURL == "" {
+			return nil, err
+		}
+	} else {
+		conf = foundConf
+		if projectDir == "" {
+			projectDir = confProjectDir
+		}
+		if repositoryURL == "" {
+			if repositoryURL, err = conf.RepositoryURL(""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	projectDir, err = filepath.Abs(projectDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine absolute directory of '%s': %w", projectDir, err)
+	}
+	project.ApplyGlobalSettings(conf)
+	repo, err := repository.ForURL(repositoryURL, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	proj := project.NewProject(repo, projectDir)
+	proj.ApplySettings(conf)
+	c := &Client{project: proj}
+	if opts.AsyncUploads {
+		c.workChan = make(chan func() error, uploadQueueSize)
+		go c.runUploads()
+	}
+	return c, nil
+}
+
+func (c *Client) runUploads() {
+	for work := range c.workChan {
+		if err := work(); err != nil {
+			console.Error("%v", err)
+			c.mu.Lock()
+			c.uploadErrors = append(c.uploadErrors, err)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Wait waits for the uploads that have been queued to finish, if
+// AsyncUploads is set. It returns the first error of the uploads that failed
+// since it was last called.
+func (c *Client) Wait() error {
+	if c.workChan == nil {
+		return nil
+	}
+	// Uploads run in order, so when this runs the ones before it have
+	// finished
+	done := make(chan struct{})
+	c.workChan <- func() error {
+		close(done)
+		return nil
+	}
+	<-done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := c.uploadErrors
+	c.uploadErrors = nil
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) > 1 {
+		return fmt.Errorf("%w (and %d more uploads failed)", errs[0], len(errs)-1)
+	}
+	return errs[0]
+}
+
+// Project returns the underlying project, which can be used to read
+// experiments and checkpoints
+func (c *Client) Project() *project.Project {
+	return c.project
+}
+
+// ExperimentOptions are the options for CreateExperiment
+type ExperimentOptions struct {
+	// Name is a unique, human-readable name for the experiment, e.g.
+	// "resnet-baseline". If it is empty, a name is generated.
+	Name string
+	// Path is a file or directory, relative to the project directory, to
+	// save with the experiment. If it is empty, no files are saved.
+	Path string
+	// Params are the experiment's hyperparameters. Values can be numbers,
+	// strings, bools, nil, param.Values, or anything that can be encoded as
+	// JSON.
+	Params map[string]interface{}
+	// Command is the command used to run the experiment. It defaults to the
+	// command line of the current process.
+	Command string
+	// DisableHeartbeat stops the experiment from being shown as running
+	DisableHeartbeat bool
+	// Quiet disables the messages printed about what is being saved
+	Quiet bool
+}
+
+// Experiment is an experiment created by a Client
+type Experiment struct {
+	*project.Experiment
+
+	client    *Client
+	heartbeat *shared.HeartbeatProcess
+
+	// series are the metrics logged with LogMetrics that haven't been saved.
+	// They are saved every metricsSaveInterval, rather than every time a
+	// metric is logged.
+	series      project.MetricSeries
+	seriesSaved time.Time
+}
+
+// metricsSaveInterval is how often metrics logged with LogMetrics are saved
+const metricsSaveInterval = 10 * time.Second
+
+// CreateExperiment creates an experiment, saving its files and metadata to
+// the repository
+func (c *Client) CreateExperiment(opts ExperimentOptions) (*Experiment, error) {
+	params, err := valueMap(opts.Params)
+	if err != nil {
+		return nil, err
+	}
+	command := opts.Command
+	if command == "" {
+		command = strings.Join(os.Args, " ")
+	}
+	exp, err := c.project.CreateExperiment(project.CreateExperimentArgs{
+		Name:    opts.Name,
+		Path:    opts.Path,
+		Command: command,
+		Params:  params,
+	}, c.workChan != nil, c.workChan, opts.Quiet)
+	if err != nil {
+		return nil, err
+	}
+	e := &Experiment{Experiment: exp, client: c, series: project.MetricSeries{}, seriesSaved: time.Now()}
+	if !opts.DisableHeartbeat {
+		if err := c.project.RefreshHeartbeat(exp.ID); err != nil {
+			return nil, err
+		}
+		e.heartbeat = shared.StartHeartbeat(c.project, exp.ID)
+	}
+	return e, nil
+}
+
+// CheckpointOptions are the options for Experiment.Checkpoint
+type CheckpointOptions struct {
+	// Path is a file or directory, relative to the project directory, to
+	// save with the checkpoint. If it is empty, no files are saved.
+	Path string
+	// Step is the step of training, e.g. the epoch or iteration
+	Step int64
+	// Metrics are the values recorded at this step. Values can be any type
+	// that Params can be.
+	Metrics map[string]interface{}
+	// PrimaryMetric is the name of the metric that is used to pick the best
+	// checkpoint. If it is set, Goal must be set too.
+	PrimaryMetric string
+	Goal          project.MetricGoal
+	// Quiet disables the messages printed about what is being saved
+	Quiet bool
+}
+
+// Checkpoint creates a checkpoint of the experiment, saving its files and
+// adding it to the experiment's metadata
+func (e *Experiment) Checkpoint(opts CheckpointOptions) (*project.Checkpoint, error) {
+	metrics, err := valueMap(opts.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	var primaryMetric *project.PrimaryMetric
+	if opts.PrimaryMetric != "" {
+		if opts.Goal != project.GoalMaximize && opts.Goal != project.GoalMinimize {
+			return nil, fmt.Errorf("Goal must be %q or %q if PrimaryMetric is set", project.GoalMaximize, project.GoalMinimize)
+		}
+		if _, ok := metrics[opts.PrimaryMetric]; !ok {
+			return nil, fmt.Errorf("Primary metric %q is not one of the metrics", opts.PrimaryMetric)
+		}
+		primaryMetric = &project.PrimaryMetric{Name: opts.PrimaryMetric, Goal: opts.Goal}
+	}
+
+	if err := e.SaveMetrics(); err != nil {
+		return nil, err
+	}
+
+	chk, err := e.client.project.CreateCheckpoint(project.CreateCheckpointArgs{
+		Experiment:    e.Experiment,
+		Path:          opts.Path,
+		Step:          opts.Step,
+		Metrics:       metrics,
+		PrimaryMetric: primaryMetric,
+	}, e.client.workChan != nil, e.client.workChan, opts.Quiet)
+	if err != nil {
+		return nil, err
+	}
+	e.Checkpoints = append(e.Checkpoints, chk)
+	alerts := e.client.project.CheckAlerts(e.Experiment, chk)
+	if _, err := e.client.project.SaveExperiment(e.Experiment, opts.Quiet); err != nil {
+		return nil, err
+	}
+	// Alerts are sent straight away, rather than after the checkpoint's
+	// files have been uploaded
+	for _, alert := range alerts {
+		alert := alert
+		exp := e.Experiment
+		e.client.project.InBackground(func() error {
+			return e.client.project.RunAlertHook(exp, chk, alert)
+		})
+	}
+	if e.heartbeat != nil {
+		e.heartbeat.Refresh()
+	}
+	if e.client.workChan != nil {
+		// Run the hook once the checkpoint's files have been uploaded
+		exp := e.Experiment
+		e.client.workChan <- func() error {
+			e.runCheckpointHooks(exp, chk)
+			return nil
+		}
+	} else {
+		e.runCheckpointHooks(e.Experiment, chk)
+	}
+	return chk, nil
+}
+
+// runCheckpointHooks signs chk and runs the on_checkpoint hook for it. They
+// only warn if they fail, because the checkpoint has been saved.
+func (e *Experiment) runCheckpointHooks(exp *project.Experiment, chk *project.Checkpoint) {
+	// Signing and hooks are run in the background, so a slow one doesn't
+	// hold up training or the uploads after it
+	e.client.project.InBackground(func() error {
+		return e.client.project.SignCheckpoint(exp, chk)
+	})
+	e.client.project.InBackground(func() error {
+		return e.client.project.RunCheckpointHook(exp, chk)
+	})
+}
+
+// LogMetrics records the value of metrics at step, without creating a
+// checkpoint. It is cheap enough to call for every batch: metrics are saved
+// in a series apart from the experiment's metadata, every few seconds and
+// when a checkpoint is created or the experiment is stopped.
+func (e *Experiment) LogMetrics(step int64, metrics map[string]float64) error {
+	if err := e.series.Add(step, time.Now().UTC(), metrics); err != nil {
+		return err
+	}
+	if time.Since(e.seriesSaved) >= metricsSaveInterval {
+		return e.SaveMetrics()
+	}
+	return nil
+}
+
+// SaveMetrics saves the metrics logged with LogMetrics that haven't been
+// saved yet
+func (e *Experiment) SaveMetrics() error {
+	if len(e.series) == 0 {
+		return nil
+	}
+	if err := e.client.project.AppendMetricSeries(e.Experiment, e.series); err != nil {
+		return err
+	}
+	e.series = project.MetricSeries{}
+	e.seriesSaved = time.Now()
+	return nil
+}
+
+// Stop marks the experiment as no longer running. If AsyncUploads is set, it
+// waits for uploads to finish first.
+func (e *Experiment) Stop() error {
+	if err := e.SaveMetrics(); err != nil {
+		return err
+	}
+	if err := e.client.Wait(); err != nil {
+		return err
+	}
+	if e.heartbeat != nil {
+		e.heartbeat.Kill()
+		e.heartbeat = nil
+	}
+	// Events may be held to be batched, and nothing writes them once the
+	// program exits
+	if err := e.client.project.FlushEvents(); err != nil {
+		return err
+	}
+	if err := e.client.project.StopExperiment(e.ID); err != nil {
+		return err
+	}
+	// The on_experiment_end hook runs after the on_checkpoint hooks. Hooks
+	// time out, so this doesn't wait forever.
+	e.client.project.WaitForBackground()
+	if err := e.client.project.RunExperimentEndHook(e.Experiment); err != nil {
+		console.Warn("%v", err)
+	}
+	return nil
+}
+
+func valueMap(m map[string]interface{}) (param.ValueMap, error) {
+	result := param.ValueMap{}
+	for key, v := range m {
+		value, err := toValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for %q: %w", key, err)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func toValue(v interface{}) (param.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return param.None(), nil
+	case param.Value:
+		return v, nil
+	case bool:
+		return param.Bool(v), nil
+	case int:
+		return param.Int(int64(v)), nil
+	case int32:
+		return param.Int(int64(v)), nil
+	case int64:
+		return param.Int(v), nil
+	case float32:
+		return param.Float(float64(v)), nil
+	case float64:
+		return param.Float(v), nil
+	case string:
+		return param.String(v), nil
+	}
+	// Anything else is stored as it would be encoded as JSON
+	data, err := json.Marshal(v)
+	if err != nil {
+		return param.Value{}, err
+	}
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return param.Value{}, err
+	}
+	return param.Object(obj), nil
+}
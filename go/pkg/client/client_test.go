@@ -0,0 +1,160 @@
+package client
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+func TestCreateExperimentAndCheckpoint(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "train.go"), []byte("package main"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "model.bin"), []byte("weights"), 0644))
+
+	c, err := New(Options{
+		ProjectDir:    projectDir,
+		RepositoryURL: "file://" + filepath.Join(projectDir, ".replicate"),
+	})
+	require.NoError(t, err)
+
+	exp, err := c.CreateExperiment(ExperimentOptions{
+		Path:    "train.go",
+		Command: "go run train.go",
+		Params: map[string]interface{}{
+			"learning_rate": 0.01,
+			"epochs":        10,
+			"optimizer":     "adam",
+			"layers":        []int{64, 32},
+		},
+		Quiet: true,
+	})
+	require.NoError(t, err)
+
+	running, err := c.Project().ExperimentIsRunning(exp.ID)
+	require.NoError(t, err)
+	require.True(t, running)
+
+	_, err = exp.Checkpoint(CheckpointOptions{
+		Step:          1,
+		Metrics:       map[string]interface{}{"loss": 0.5},
+		PrimaryMetric: "accuracy",
+		Goal:          project.GoalMaximize,
+	})
+	require.EqualError(t, err, `Primary metric "accuracy" is not one of the metrics`)
+
+	chk, err := exp.Checkpoint(CheckpointOptions{
+		Path:          "model.bin",
+		Step:          1,
+		Metrics:       map[string]interface{}{"loss": 0.5},
+		PrimaryMetric: "loss",
+		Goal:          project.GoalMinimize,
+		Quiet:         true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, exp.Stop())
+
+	running, err = c.Project().ExperimentIsRunning(exp.ID)
+	require.NoError(t, err)
+	require.False(t, running)
+
+	saved, err := c.Project().ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "go run train.go", saved.Command)
+	require.Equal(t, param.Float(0.01), saved.Params["learning_rate"])
+	require.Equal(t, param.Int(10), saved.Params["epochs"])
+	require.Equal(t, param.String("adam"), saved.Params["optimizer"])
+	require.Equal(t, param.Object([]interface{}{64.0, 32.0}), saved.Params["layers"])
+	require.Len(t, saved.Checkpoints, 1)
+	require.Equal(t, chk.ID, saved.Checkpoints[0].ID)
+	require.Equal(t, param.Float(0.5), saved.Checkpoints[0].Metrics["loss"])
+
+	outputDir := filepath.Join(projectDir, "output")
+	require.NoError(t, c.Project().CheckoutCheckpoint(saved.Checkpoints[0], saved, outputDir, true))
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, "model.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(data))
+}
+
+func TestLogMetrics(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	c, err := New(Options{
+		ProjectDir:    projectDir,
+		RepositoryURL: "file://" + filepath.Join(projectDir, ".replicate"),
+	})
+	require.NoError(t, err)
+	exp, err := c.CreateExperiment(ExperimentOptions{DisableHeartbeat: true, Quiet: true})
+	require.NoError(t, err)
+
+	for step := int64(0); step < 100; step++ {
+		require.NoError(t, exp.LogMetrics(step, map[string]float64{"batch_loss": 1 / float64(step+1)}))
+	}
+	require.EqualError(t, exp.LogMetrics(100, map[string]float64{"batch_loss": math.NaN()}), `Value of metric "batch_loss" at step 100 is NaN, but it must be a finite number`)
+
+	// Saved when a checkpoint is created, without going in the experiment's metadata
+	_, err = exp.Checkpoint(CheckpointOptions{Step: 99, Quiet: true})
+	require.NoError(t, err)
+	series, err := c.Project().MetricSeries(exp.Experiment)
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch_loss"}, series.Names())
+	require.Len(t, series["batch_loss"], 100)
+	require.Equal(t, int64(99), series["batch_loss"][99].Step)
+	require.Equal(t, 0.01, series["batch_loss"][99].Value)
+	metadata, err := ioutil.ReadFile(filepath.Join(projectDir, ".replicate", exp.MetadataPath()))
+	require.NoError(t, err)
+	require.NotContains(t, string(metadata), "batch_loss")
+
+	// ...and when it is stopped
+	require.NoError(t, exp.LogMetrics(100, map[string]float64{"batch_loss": 0.001}))
+	require.NoError(t, exp.Stop())
+	series, err = c.Project().MetricSeries(exp.Experiment)
+	require.NoError(t, err)
+	require.Len(t, series["batch_loss"], 101)
+}
+
+func TestAsyncUploads(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "model.bin"), []byte("weights"), 0644))
+
+	c, err := New(Options{
+		ProjectDir:    projectDir,
+		RepositoryURL: "file://" + filepath.Join(projectDir, ".replicate", "repository"),
+		AsyncUploads:  true,
+	})
+	require.NoError(t, err)
+	exp, err := c.CreateExperiment(ExperimentOptions{Quiet: true, DisableHeartbeat: true})
+	require.NoError(t, err)
+	chk, err := exp.Checkpoint(CheckpointOptions{Path: "model.bin", Step: 1, Quiet: true})
+	require.NoError(t, err)
+
+	// The files were snapshotted, so changing them doesn't change the
+	// checkpoint
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "model.bin"), []byte("changed"), 0644))
+	require.NoError(t, exp.Stop())
+
+	uploads, err := project.ListUploads(projectDir)
+	require.NoError(t, err)
+	require.Empty(t, uploads)
+
+	saved, err := c.Project().ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	outputDir := filepath.Join(projectDir, "output")
+	require.NoError(t, c.Project().CheckoutCheckpoint(saved.Checkpoints[0], saved, outputDir, true))
+	require.Equal(t, chk.ID, saved.Checkpoints[0].ID)
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, "model.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(data))
+}
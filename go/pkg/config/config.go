@@ -1,13 +1,655 @@
 package config
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
 // Config is replicate.yaml
 type Config struct {
 	Repository string `json:"repository"`
 
+	// Repositories are additional named repositories that can be
+	// selected with --repository-name
+	Repositories map[string]string `json:"repositories,omitempty"`
+
+	// Project is the name of the project. If it is set, the project is
+	// stored in projects/<project>/ in the repository, so several projects
+	// can share one repository.
+	Project string `json:"project,omitempty"`
+
+	// RepositoryPrefix is used to make a repository URL for projects that
+	// don't set one, by appending the project directory's name. It is
+	// intended for the user's global config file.
+	RepositoryPrefix string `json:"repository_prefix,omitempty"`
+
+	// Exclude is a list of gitignore-style patterns for files that
+	// shouldn't be uploaded, in addition to .replicateignore
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Retention is the policy `replicate prune` applies
+	Retention *Retention `json:"retention,omitempty"`
+
+	// Lifecycle is the set of rules `replicate lifecycle` sets on the bucket
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+
+	// Mirror is the URL of a repository that `replicate mirror` copies the
+	// repository to
+	Mirror string `json:"mirror,omitempty"`
+
+	// Hooks are shell commands that are run when experiments are
+	// checkpointed or end, or trigger alerts
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// Alerts are rules that are checked against the metrics of each
+	// checkpoint
+	Alerts []*Alert `json:"alerts,omitempty"`
+
+	// Signing is how checkpoints are signed, so `replicate verify
+	// --signatures` can check they came from the experiments they say
+	Signing *Signing `json:"signing,omitempty"`
+
+	// Chunking stores large checkpoint files in content-defined chunks, so
+	// only the parts that have changed are uploaded
+	Chunking *Chunking `json:"chunking,omitempty"`
+
+	// LargeFiles stores large checkpoint files once each, by their
+	// contents, with small pointer files in checkpoints in their place
+	LargeFiles *LargeFiles `json:"large_files,omitempty"`
+
+	// Trees split the files in checkpoints into code, weights and
+	// artifacts, which are stored separately so they can be checked out
+	// separately
+	Trees *Trees `json:"trees,omitempty"`
+
+	// Trash is how long experiments and checkpoints that are removed are
+	// kept, so they can be restored
+	Trash *Trash `json:"trash,omitempty"`
+
+	// SpecialFiles is what happens to files that can't be saved, such as
+	// sockets and named pipes. They are skipped with a warning if it is
+	// SpecialFilesSkip (the default), and are an error if it is
+	// SpecialFilesError.
+	SpecialFiles string `json:"special_files,omitempty"`
+
+	// Timeouts bound how long operations on the repository can take
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+
+	// Downloads is how large objects are downloaded from the repository
+	Downloads *Downloads `json:"downloads,omitempty"`
+
+	// Scratch is where temporary files, such as tarballs that are being
+	// downloaded, are written
+	Scratch *Scratch `json:"scratch,omitempty"`
+
+	// Network is how S3 and Google Cloud Storage are connected to. It is
+	// intended for the user's global config file.
+	Network *Network `json:"network,omitempty"`
+
+	// Credentials are which of the user's cloud credentials are used to
+	// access repositories. It is intended for the user's global config
+	// file.
+	Credentials *Credentials `json:"credentials,omitempty"`
+
+	// Batching is how the metadata that running experiments write often,
+	// such as new checkpoints and heartbeats, is batched into fewer writes
+	Batching *Batching `json:"batching,omitempty"`
+
+	// Watch is what `replicate watch` checkpoints when it changes
+	Watch *Watch `json:"watch,omitempty"`
+
+	// Sweeps are sets of experiments, by name, that `replicate sweep run`
+	// launches with different params
+	Sweeps map[string]*Sweep `json:"sweeps,omitempty"`
+
+	// Inventory is an S3 Inventory or GCS Storage Insights listing of the
+	// repository's bucket, which `replicate prune` and `replicate verify`
+	// read instead of listing the bucket
+	Inventory *Inventory `json:"inventory,omitempty"`
+
+	// Datasets are the input data of experiments, which are fingerprinted
+	// when experiments are created
+	Datasets []*Dataset `json:"datasets,omitempty"`
+
+	// Environment is a list of glob patterns, such as "CUDA_*", for the
+	// environment variables that are recorded when experiments are created
+	Environment []string `json:"environment,omitempty"`
+
+	// Seeds are the names of params or environment variables that are
+	// random seeds, which are recorded when experiments are created
+	Seeds []string `json:"seeds,omitempty"`
+
+	// Layout is where the files of new experiments and checkpoints are
+	// stored in the repository
+	Layout *Layout `json:"layout,omitempty"`
+
+	// Quota limits how much storage the project, and each user's
+	// experiments in it, can use
+	Quota *Quota `json:"quota,omitempty"`
+
+	// Serve is how the models in checkpoints are served, which is recorded
+	// with each checkpoint so `replicate serve` can run it
+	Serve *Serve `json:"serve,omitempty"`
+
+	// Hash is the algorithm the contents of chunks, large files and
+	// datasets are hashed with. It is recorded in the repository when it is
+	// created, and it can't be changed after that.
+	Hash string `json:"hash,omitempty"`
+
 	Storage string `json:"storage"` // deprecated
 }
 
+const (
+	SpecialFilesSkip  = "skip"
+	SpecialFilesError = "error"
+)
+
+// Timeouts are in seconds. Zero values mean there is no limit.
+type Timeouts struct {
+	// ConnectSeconds is how long connecting to the repository can take
+	ConnectSeconds int `json:"connect_seconds,omitempty"`
+
+	// RequestSeconds is how long to wait for the response to each request
+	RequestSeconds int `json:"request_seconds,omitempty"`
+
+	// OverallSeconds is how long each file can take to be uploaded,
+	// downloaded or deleted, and how long each listing can take
+	OverallSeconds int `json:"overall_seconds,omitempty"`
+}
+
+// Connect returns how long connecting to the repository can take
+func (t *Timeouts) Connect() time.Duration {
+	return time.Duration(t.ConnectSeconds) * time.Second
+}
+
+// Request returns how long to wait for the response to each request
+func (t *Timeouts) Request() time.Duration {
+	return time.Duration(t.RequestSeconds) * time.Second
+}
+
+// Overall returns how long each file or listing can take
+func (t *Timeouts) Overall() time.Duration {
+	return time.Duration(t.OverallSeconds) * time.Second
+}
+
+// Downloads is how large objects are downloaded from S3 and GCS. Zero values
+// are the defaults.
+type Downloads struct {
+	// ChunkSizeMB is the size in megabytes of each range of an object that
+	// is downloaded. Objects no bigger than this are downloaded in a single
+	// request.
+	ChunkSizeMB int `json:"chunk_size_mb,omitempty"`
+
+	// Concurrency is how many ranges of each object are downloaded at once
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// ChunkSize returns the size in bytes of each range that is downloaded, or 0
+// for the default
+func (d *Downloads) ChunkSize() int64 {
+	return int64(d.ChunkSizeMB) * 1024 * 1024
+}
+
+// Network is how S3 and GCS are connected to. The environment variables that
+// set the same things take precedence.
+type Network struct {
+	// MaxWorkers is how many files are uploaded, downloaded or deleted at
+	// once. $REPLICATE_MAX_WORKERS takes precedence over it.
+	MaxWorkers int `json:"max_workers,omitempty"`
+
+	// Proxy is the URL of the HTTP proxy that requests are sent through.
+	// $HTTPS_PROXY and $HTTP_PROXY take precedence over it.
+	Proxy string `json:"proxy,omitempty"`
+
+	// CABundle is the path of a PEM file of CA certificates that are
+	// trusted as well as the system's, for proxies that intercept TLS.
+	// $REPLICATE_CA_BUNDLE takes precedence over it.
+	CABundle string `json:"ca_bundle,omitempty"`
+}
+
+// Credentials are which credentials are used to access repositories. The
+// environment variables that set the same things take precedence.
+type Credentials struct {
+	// AWSProfile is the profile in ~/.aws/config and ~/.aws/credentials
+	// that is used for S3. $AWS_PROFILE, or keys in $AWS_ACCESS_KEY_ID and
+	// $AWS_SECRET_ACCESS_KEY, take precedence over it.
+	AWSProfile string `json:"aws_profile,omitempty"`
+
+	// GCPCredentialsFile is the path of the service account key that is
+	// used for Google Cloud Storage. $GOOGLE_APPLICATION_CREDENTIALS takes
+	// precedence over it.
+	GCPCredentialsFile string `json:"gcp_credentials_file,omitempty"`
+}
+
+// The ways tarballs are downloaded from S3 and GCS
+const (
+	// SpillAuto downloads them to the scratch directory if there is room,
+	// and streams them otherwise
+	SpillAuto = "auto"
+	// SpillAlways downloads them to the scratch directory, and fails if
+	// there isn't room
+	SpillAlways = "always"
+	// SpillNever streams them
+	SpillNever = "never"
+)
+
+// Scratch is where temporary files are written. Zero values are the
+// defaults.
+type Scratch struct {
+	// Dir is the directory temporary files are written in. It defaults to
+	// the system's temporary directory, and $REPLICATE_TMPDIR takes
+	// precedence over it.
+	Dir string `json:"dir,omitempty"`
+
+	// MinFreeMB is how much space, in megabytes, to leave free on the disk
+	// Dir is on
+	MinFreeMB int `json:"min_free_mb,omitempty"`
+
+	// Spill is whether tarballs are downloaded to Dir before they are
+	// extracted, which downloads them faster, or streamed: SpillAuto (the
+	// default), SpillAlways or SpillNever
+	Spill string `json:"spill,omitempty"`
+}
+
+// MinFree returns how many bytes to leave free on the disk of the scratch
+// directory
+func (s *Scratch) MinFree() int64 {
+	return int64(s.MinFreeMB) * 1024 * 1024
+}
+
+// DefaultBatchIntervalSeconds is how long small metadata writes are held to
+// be written together, unless batching.interval_seconds says otherwise
+const DefaultBatchIntervalSeconds = 10
+
+// Batching is how small metadata writes are batched
+type Batching struct {
+	// IntervalSeconds is how long small metadata writes are held, to be
+	// written together with the ones that come after them. It defaults to
+	// DefaultBatchIntervalSeconds.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+
+	// Disabled writes each piece of metadata as soon as it is saved
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Interval returns how long small metadata writes are held, or 0 if they
+// aren't batched
+func (b *Batching) Interval() time.Duration {
+	if b.Disabled {
+		return 0
+	}
+	if b.IntervalSeconds == 0 {
+		return DefaultBatchIntervalSeconds * time.Second
+	}
+	return time.Duration(b.IntervalSeconds) * time.Second
+}
+
+// Watch is what `replicate watch` checkpoints when it changes
+type Watch struct {
+	// Paths are glob patterns, relative to the project directory, of files
+	// or directories to checkpoint when they change, such as "outputs/*.pt"
+	Paths []string `json:"paths,omitempty"`
+
+	// Metrics is a JSON file, relative to the project directory, whose
+	// top-level values are recorded as the metrics of each checkpoint
+	Metrics string `json:"metrics,omitempty"`
+
+	// PrimaryMetric is the metric in Metrics that picks the best
+	// checkpoint, and Goal is "maximize" or "minimize"
+	PrimaryMetric string `json:"primary_metric,omitempty"`
+	Goal          string `json:"goal,omitempty"`
+
+	// IntervalSeconds is how often to look for changes. It defaults to 5.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+// Interval returns how often to look for changes
+func (w *Watch) Interval() time.Duration {
+	if w.IntervalSeconds == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(w.IntervalSeconds) * time.Second
+}
+
+// DefaultInventoryMaxAgeHours is how old an inventory can be before it isn't
+// used, unless inventory.max_age_hours says otherwise
+const DefaultInventoryMaxAgeHours = 48
+
+// Inventory is a listing of the repository's bucket made by the bucket's
+// cloud provider
+type Inventory struct {
+	// URL is the URL of an inventory's manifest, or of the folder that
+	// inventories are written to, in which case the newest one is used
+	URL string `json:"url"`
+
+	// MaxAgeHours is how old an inventory can be before it isn't used, and
+	// the bucket is listed instead
+	MaxAgeHours int `json:"max_age_hours,omitempty"`
+}
+
+// MaxAge returns how old an inventory can be before it isn't used
+func (i *Inventory) MaxAge() time.Duration {
+	if i.MaxAgeHours == 0 {
+		return DefaultInventoryMaxAgeHours * time.Hour
+	}
+	return time.Duration(i.MaxAgeHours) * time.Hour
+}
+
+// Quota limits how much storage is used. Usage is measured when experiments
+// are created, so it lags behind what is being saved.
+type Quota struct {
+	// Project limits the storage that everything in the project uses
+	Project *QuotaLimits `json:"project,omitempty"`
+
+	// User limits the storage that the files of each user's experiments
+	// and checkpoints use
+	User *QuotaLimits `json:"user,omitempty"`
+}
+
+// QuotaLimits are sizes in gigabytes. Zero values mean no limit.
+type QuotaLimits struct {
+	// SoftLimitGB is how much can be used before `replicate ls`,
+	// `replicate status` and experiments warn about it
+	SoftLimitGB float64 `json:"soft_limit_gb,omitempty"`
+
+	// HardLimitGB is how much can be used before new checkpoints are
+	// rejected
+	HardLimitGB float64 `json:"hard_limit_gb,omitempty"`
+}
+
+// SoftLimit returns the soft limit in bytes, or 0 if there isn't one
+func (l *QuotaLimits) SoftLimit() int64 {
+	return int64(l.SoftLimitGB * 1e9)
+}
+
+// HardLimit returns the hard limit in bytes, or 0 if there isn't one
+func (l *QuotaLimits) HardLimit() int64 {
+	return int64(l.HardLimitGB * 1e9)
+}
+
+// Trash is the policy for the trash that `replicate rm` moves experiments
+// and checkpoints to
+type Trash struct {
+	// RetentionDays is the number of days things are kept in the trash
+	// before they are deleted for good. It defaults to 7.
+	RetentionDays int `json:"retention_days,omitempty"`
+}
+
+// Retention is a policy for which experiments and checkpoints to keep.
+// Zero values mean no limit.
+type Retention struct {
+	// KeepLastCheckpoints is the number of most recent checkpoints to keep
+	// for each experiment
+	KeepLastCheckpoints int `json:"keep_last_checkpoints,omitempty"`
+
+	// KeepBestCheckpoint keeps the best checkpoint of each experiment by its
+	// primary metric, even if it isn't one of the most recent ones
+	KeepBestCheckpoint bool `json:"keep_best_checkpoint,omitempty"`
+
+	// DeleteExperimentsAfterDays is the age in days after which experiments
+	// are deleted, along with all of their checkpoints
+	DeleteExperimentsAfterDays int `json:"delete_experiments_after_days,omitempty"`
+}
+
+// Lifecycle is a set of rules for moving the files of experiments and
+// checkpoints to cheaper storage classes as they get older. Metadata is never
+// moved, because it is read all the time.
+type Lifecycle struct {
+	Experiments *LifecycleTransitions `json:"experiments,omitempty"`
+	Checkpoints *LifecycleTransitions `json:"checkpoints,omitempty"`
+}
+
+// LifecycleTransitions are the ages in days at which files are moved to
+// cheaper storage classes. Zero values mean files are not moved.
+type LifecycleTransitions struct {
+	InfrequentAccessAfterDays int `json:"infrequent_access_after_days,omitempty"`
+	ArchiveAfterDays          int `json:"archive_after_days,omitempty"`
+}
+
+// DefaultChunkingMinFileSizeMB is the size of the smallest file that is
+// chunked, if it isn't set
+const DefaultChunkingMinFileSizeMB = 64
+
+// Chunking is the settings for storing large files in chunks
+type Chunking struct {
+	// MinFileSizeMB is the size in megabytes of the smallest file that is
+	// chunked. Smaller files are stored in the checkpoint's tarball.
+	MinFileSizeMB int `json:"min_file_size_mb,omitempty"`
+}
+
+// MinFileSize returns the size in bytes of the smallest file that is chunked
+func (c *Chunking) MinFileSize() int64 {
+	if c.MinFileSizeMB == 0 {
+		return DefaultChunkingMinFileSizeMB * 1024 * 1024
+	}
+	return int64(c.MinFileSizeMB) * 1024 * 1024
+}
+
+// DefaultLargeFilesMinFileSizeMB is the size of the smallest file that is
+// stored as a large file, unless large_files.min_file_size_mb says otherwise
+const DefaultLargeFilesMinFileSizeMB = 100
+
+// LargeFiles is the settings for storing large files outside of checkpoints'
+// tarballs, with pointer files in their place
+type LargeFiles struct {
+	// MinFileSizeMB is the size in megabytes of the smallest file that is
+	// stored as a large file. Smaller files are stored in the checkpoint's
+	// tarball.
+	MinFileSizeMB int `json:"min_file_size_mb,omitempty"`
+}
+
+// MinFileSize returns the size in bytes of the smallest file that is stored
+// as a large file
+func (l *LargeFiles) MinFileSize() int64 {
+	if l.MinFileSizeMB == 0 {
+		return DefaultLargeFilesMinFileSizeMB * 1024 * 1024
+	}
+	return int64(l.MinFileSizeMB) * 1024 * 1024
+}
+
+// Trees are gitignore-style patterns for the files in checkpoints that are
+// weights and artifacts. Files that match neither are code. A file that
+// matches both is weights.
+type Trees struct {
+	Weights   []string `json:"weights,omitempty"`
+	Artifacts []string `json:"artifacts,omitempty"`
+}
+
+// Serve is a container that serves the model in a checkpoint. The files of
+// the checkpoint are mounted in the container's working directory.
+type Serve struct {
+	// Image is the container image to run, such as
+	// "pytorch/torchserve:latest"
+	Image string `json:"image"`
+
+	// Entrypoint is the command to run in the container. If it is empty,
+	// the image's own entrypoint is run.
+	Entrypoint []string `json:"entrypoint,omitempty"`
+
+	// Port is the port the model is served on in the container
+	Port int `json:"port,omitempty"`
+
+	// Files are the paths of the files and directories in the checkpoint
+	// that the model needs, relative to the project directory. If it is
+	// empty, all of them are.
+	Files []string `json:"files,omitempty"`
+}
+
+// Hooks are shell commands run from the project directory, with metadata
+// about the experiment and checkpoint in REPLICATE_* environment variables
+type Hooks struct {
+	// OnCheckpoint is run after a checkpoint has been saved
+	OnCheckpoint string `json:"on_checkpoint,omitempty"`
+
+	// OnExperimentEnd is run after an experiment has been stopped
+	OnExperimentEnd string `json:"on_experiment_end,omitempty"`
+
+	// OnAlert is run when a checkpoint triggers an alert
+	OnAlert string `json:"on_alert,omitempty"`
+
+	// TimeoutSeconds is how long a hook can run before it is killed. It is
+	// DefaultHookTimeoutSeconds if it is zero.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// DefaultHookTimeoutSeconds is how long hooks can run if TimeoutSeconds
+// isn't set
+const DefaultHookTimeoutSeconds = 300
+
+// Timeout returns how long a hook can run before it is killed
+func (h *Hooks) Timeout() time.Duration {
+	if h.TimeoutSeconds == 0 {
+		return DefaultHookTimeoutSeconds * time.Second
+	}
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+// The tools checkpoints can be signed with
+const (
+	SigningSSH      = "ssh"
+	SigningMinisign = "minisign"
+)
+
+// Signing is how the manifests of checkpoints are signed and verified. Paths
+// are relative to the project directory.
+type Signing struct {
+	// Tool is SigningSSH, to sign with `ssh-keygen -Y sign` (the default),
+	// or SigningMinisign
+	Tool string `json:"tool,omitempty"`
+
+	// Key is the private key to sign with. If it isn't set, the
+	// REPLICATE_SIGNING_KEY environment variable is used, and if that
+	// isn't set either, checkpoints aren't signed.
+	Key string `json:"key,omitempty"`
+
+	// Identity is who is signing, such as an email address. For ssh, it
+	// must match a principal in AllowedSigners.
+	Identity string `json:"identity,omitempty"`
+
+	// AllowedSigners is the ssh allowed signers file that signatures made
+	// with ssh are verified against
+	AllowedSigners string `json:"allowed_signers,omitempty"`
+
+	// PublicKey is the minisign public key that signatures made with
+	// minisign are verified against
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// SigningTool returns the tool checkpoints are signed with
+func (s *Signing) SigningTool() string {
+	if s.Tool == "" {
+		return SigningSSH
+	}
+	return s.Tool
+}
+
+// Dataset is a file or directory of input data
+type Dataset struct {
+	// Name is used to refer to the dataset in filters, e.g. "train"
+	Name string `json:"name"`
+	// Path is relative to the project directory
+	Path string `json:"path"`
+}
+
+// Conditions of alerts
+const (
+	// AlertNaN triggers when the metric is NaN or infinite
+	AlertNaN = "nan"
+	// AlertAbove and AlertBelow trigger when the metric is above or below
+	// Value
+	AlertAbove = "above"
+	AlertBelow = "below"
+	// AlertNotImproved triggers when the metric hasn't improved, according
+	// to Goal, in the last Checkpoints checkpoints
+	AlertNotImproved = "not_improved"
+)
+
+// Alert is a rule that is checked against a metric of each checkpoint. It
+// triggers at most once per experiment.
+type Alert struct {
+	// Name identifies the alert. It defaults to the metric and condition,
+	// e.g. "loss-nan".
+	Name string `json:"name,omitempty"`
+
+	Metric    string  `json:"metric"`
+	Condition string  `json:"condition"`
+	Value     float64 `json:"value,omitempty"`
+
+	Checkpoints int    `json:"checkpoints,omitempty"`
+	Goal        string `json:"goal,omitempty"`
+}
+
+// DisplayName returns the name of the alert
+func (a *Alert) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Metric + "-" + strings.Replace(a.Condition, "_", "-", -1)
+}
+
 func getDefaultConfig(workingDir string) *Config {
 	// should match defaults in config.py
 	return &Config{}
 }
+
+// RepositoryURL returns the URL of the repository called name in
+// `repositories`, or the default `repository` if name is empty
+func (c *Config) RepositoryURL(name string) (string, error) {
+	url, err := c.RootRepositoryURL(name)
+	if err != nil {
+		return "", err
+	}
+	return ProjectRepositoryURL(url, c.Project), nil
+}
+
+// RootRepositoryURL is like RepositoryURL, but it isn't scoped to the
+// project, so it is the URL of the repository that all projects share
+func (c *Config) RootRepositoryURL(name string) (string, error) {
+	if name == "" {
+		if c.Repository == "" {
+			return "", fmt.Errorf("replicate.yaml doesn't define a default repository, so you need to pick one of the named repositories with --repository-name (%s)", strings.Join(c.repositoryNames(), ", "))
+		}
+		return c.Repository, nil
+	}
+	url, ok := c.Repositories[name]
+	if !ok {
+		if len(c.Repositories) == 0 {
+			return "", fmt.Errorf("Repository %q is not defined in replicate.yaml, because it doesn't have a 'repositories' section", name)
+		}
+		return "", fmt.Errorf("Repository %q is not defined in replicate.yaml. The named repositories are: %s", name, strings.Join(c.repositoryNames(), ", "))
+	}
+	return url, nil
+}
+
+// ProjectsFolder is the folder in a repository that projects are stored in
+const ProjectsFolder = "projects"
+
+// ProjectRepositoryURL returns the URL of the project called project within
+// the repository at repositoryURL. If project is empty, it is repositoryURL.
+func ProjectRepositoryURL(repositoryURL string, project string) string {
+	if project == "" {
+		return repositoryURL
+	}
+	return joinURLPath(repositoryURL, ProjectsFolder+"/"+project)
+}
+
+// joinURLPath appends elem to the path of repositoryURL
+func joinURLPath(repositoryURL string, elem string) string {
+	// Options such as an S3 role stay at the end of the URL
+	query := ""
+	if i := strings.Index(repositoryURL, "?"); i != -1 {
+		repositoryURL, query = repositoryURL[:i], repositoryURL[i:]
+	}
+	return strings.TrimSuffix(repositoryURL, "/") + "/" + elem + query
+}
+
+func (c *Config) repositoryNames() []string {
+	names := []string{}
+	for name := range c.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
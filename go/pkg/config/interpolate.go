@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ${VAR} is expanded in replicate.yaml values so that a single config file
+// can be committed and parameterized per developer or CI environment. Bare $VAR
+// isn't expanded because dollar signs turn up in URLs and paths.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateEnv expands ${VAR} in all the string values in obj, which is a
+// config decoded into generic maps and slices. It returns an error listing any
+// variables that aren't set.
+func interpolateEnv(obj interface{}) (interface{}, error) {
+	missing := map[string]bool{}
+	ret := interpolateValue(obj, missing)
+	if len(missing) > 0 {
+		names := []string{}
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("replicate.yaml uses environment variables that are not set: %s", strings.Join(names, ", "))
+	}
+	return ret, nil
+}
+
+func interpolateValue(obj interface{}, missing map[string]bool) interface{} {
+	switch v := obj.(type) {
+	case string:
+		return envVarPattern.ReplaceAllStringFunc(v, func(match string) string {
+			name := envVarPattern.FindStringSubmatch(match)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing[name] = true
+			}
+			return value
+		})
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = interpolateValue(val, missing)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = interpolateValue(val, missing)
+		}
+		return v
+	}
+	return obj
+}
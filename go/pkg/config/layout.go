@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// The layout variables that can be used in the templates in Layout
+const (
+	LayoutProject    = "project"
+	LayoutUser       = "user"
+	LayoutDate       = "date"
+	LayoutExperiment = "experiment"
+	LayoutName       = "name"
+	LayoutCheckpoint = "checkpoint"
+)
+
+// The templates that are used if they aren't set, which are the layout of
+// repositories without a layout
+const (
+	DefaultExperimentsLayout = "{" + LayoutExperiment + "}"
+	DefaultCheckpointsLayout = "{" + LayoutCheckpoint + "}"
+)
+
+var layoutVariablePattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Layout is where the files of experiments and checkpoints are stored in the
+// repository. Each is a template of a path relative to the experiments/ or
+// checkpoints/ directory of the repository, such as
+// "{project}/{experiment}/{date}/{checkpoint}", without an extension.
+//
+// Metadata records where each experiment and checkpoint is, so changing the
+// layout only moves new ones. `replicate migrate-layout` moves the others.
+type Layout struct {
+	Experiments string `json:"experiments,omitempty"`
+	Checkpoints string `json:"checkpoints,omitempty"`
+}
+
+// ExperimentsTemplate returns the template for the paths of experiments
+func (l *Layout) ExperimentsTemplate() string {
+	if l == nil || l.Experiments == "" {
+		return DefaultExperimentsLayout
+	}
+	return l.Experiments
+}
+
+// CheckpointsTemplate returns the template for the paths of checkpoints
+func (l *Layout) CheckpointsTemplate() string {
+	if l == nil || l.Checkpoints == "" {
+		return DefaultCheckpointsLayout
+	}
+	return l.Checkpoints
+}
+
+// RenderLayout replaces the variables in template with values. Slashes in
+// values are replaced, so a value can't add directories.
+func RenderLayout(template string, values map[string]string) string {
+	replacer := strings.NewReplacer("/", "-", `\`, "-")
+	return layoutVariablePattern.ReplaceAllStringFunc(template, func(variable string) string {
+		value := values[strings.Trim(variable, "{}")]
+		if value == "" {
+			value = "unknown"
+		}
+		return replacer.Replace(value)
+	})
+}
+
+// validateLayoutTemplate checks that template is a relative path whose last
+// part is exactly {last}, so the paths it makes are unique and end with an
+// ID, and that it only has the variables in allowed
+func validateLayoutTemplate(name string, template string, last string, allowed []string) error {
+	if template == "" {
+		return nil
+	}
+	if path.IsAbs(template) || path.Clean(template) != template || strings.HasPrefix(template, "../") || strings.Contains(template, `\`) {
+		return fmt.Errorf("'%s' in the 'layout' section of replicate.yaml must be a relative path like \"{%s}/{date}/{%s}\", not %q", name, LayoutProject, last, template)
+	}
+	if path.Base(template) != "{"+last+"}" {
+		return fmt.Errorf("'%s' in the 'layout' section of replicate.yaml must end with \"/{%s}\", so each path is unique, not %q", name, last, template)
+	}
+	for _, match := range layoutVariablePattern.FindAllStringSubmatch(template, -1) {
+		ok := false
+		for _, variable := range allowed {
+			ok = ok || match[1] == variable
+		}
+		if !ok {
+			return fmt.Errorf("%s in '%s' in the 'layout' section of replicate.yaml isn't a variable. It must be one of: {%s}", match[0], name, strings.Join(allowed, "}, {"))
+		}
+	}
+	return nil
+}
+
+func validateLayout(l *Layout) error {
+	experimentVariables := []string{LayoutProject, LayoutUser, LayoutDate, LayoutExperiment, LayoutName}
+	if err := validateLayoutTemplate("experiments", l.Experiments, LayoutExperiment, experimentVariables); err != nil {
+		return err
+	}
+	return validateLayoutTemplate("checkpoints", l.Checkpoints, LayoutCheckpoint, append(experimentVariables, LayoutCheckpoint))
+}
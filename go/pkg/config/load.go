@@ -5,21 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/ghodss/yaml"
+	"github.com/mitchellh/go-homedir"
 
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
 	"github.com/replicate/replicate/go/pkg/files"
 	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/hash"
 )
 
 const maxSearchDepth = 100
 const deprecatedRepositoryDir = ".replicate/storage"
 
+var projectNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Dataset names are used in filters, which don't allow dots
+var datasetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 // FindConfigInWorkingDir searches working directory and any parent directories
 // for replicate.yaml (or replicate.yml) and loads it.
 //
@@ -29,11 +38,11 @@ const deprecatedRepositoryDir = ".replicate/storage"
 // If overrideDir is passed, it uses that directory instead.
 func FindConfigInWorkingDir(overrideDir string) (conf *Config, projectDir string, err error) {
 	if overrideDir != "" {
-		conf, err := LoadConfig(path.Join(overrideDir, global.ConfigFilenames[0]))
+		conf, err := LoadConfig(filepath.Join(overrideDir, global.ConfigFilenames[0]))
 		if err != nil {
 			if errors.IsConfigNotFound(err) {
 				// Try to locate replicate.yml
-				conf, err := LoadConfig(path.Join(overrideDir, global.ConfigFilenames[1]))
+				conf, err := LoadConfig(filepath.Join(overrideDir, global.ConfigFilenames[1]))
 				if err != nil {
 					if os.IsNotExist(err) {
 						return getDefaultConfig(overrideDir), overrideDir, nil
@@ -79,7 +88,8 @@ repository: file://.replicate/storage`, deprecatedRepositoryProjectRoot)
 	return conf, filepath.Dir(configPath), nil
 }
 
-// LoadConfig reads and validates replicate.yaml
+// LoadConfig reads and validates replicate.yaml, merged over the user's
+// global config file
 func LoadConfig(configPath string) (conf *Config, err error) {
 	text, err := ioutil.ReadFile(configPath)
 	if err != nil {
@@ -88,7 +98,11 @@ func LoadConfig(configPath string) (conf *Config, err error) {
 		}
 		return nil, fmt.Errorf("Failed to read config file '%s': %w", configPath, err)
 	}
-	conf, err = Parse(text, path.Dir(configPath))
+	userText, err := readUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	conf, err = parse(text, userText, filepath.Dir(configPath))
 	if err != nil {
 		// FIXME (bfirsh): implement standard way of displaying config errors so this can be used in other places
 		msg := fmt.Sprintf("%v\n\n", err)
@@ -101,16 +115,45 @@ func LoadConfig(configPath string) (conf *Config, err error) {
 
 // Parse replicate.yaml
 func Parse(text []byte, dir string) (conf *Config, err error) {
+	return parse(text, nil, dir)
+}
+
+// parse replicate.yaml, using the settings in userText (the user's global
+// config file) for anything that replicate.yaml doesn't set
+func parse(text []byte, userText []byte, dir string) (conf *Config, err error) {
 	conf = getDefaultConfig(dir)
 
-	j, err := yaml.YAMLToJSON(text)
+	userRaw, err := decodeRaw(userText, userConfigDisplayPath)
 	if err != nil {
 		return nil, err
 	}
-	// If it's an empty file, don't decode, otherwise we get this weird null object that isn't nil
-	if string(j) == "null" {
+	raw, err := decodeRaw(text, "replicate.yaml")
+	if err != nil {
+		return nil, err
+	}
+	// If they're empty files, don't decode, otherwise we get this weird null object that isn't nil
+	if raw == nil && userRaw == nil {
 		return conf, nil
 	}
+	raw, err = mergeUserConfig(userRaw, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	profiled, err := applyProfile(raw, SelectedProfile())
+	if err != nil {
+		return nil, err
+	}
+	// Environment variables are expanded after the profile is applied, so
+	// profiles that aren't selected can use variables that aren't set
+	profiled, err = interpolateEnv(profiled)
+	if err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(profiled)
+	if err != nil {
+		return nil, err
+	}
 
 	decoder := json.NewDecoder(bytes.NewReader(j))
 	decoder.DisallowUnknownFields()
@@ -129,13 +172,250 @@ func Parse(text []byte, dir string) (conf *Config, err error) {
 		conf.Storage = ""
 	}
 
-	if conf.Repository == "" {
+	for name, url := range conf.Repositories {
+		if url == "" {
+			return nil, fmt.Errorf("Repository %q in replicate.yaml has no URL", name)
+		}
+	}
+
+	if r := conf.Retention; r != nil && (r.KeepLastCheckpoints < 0 || r.DeleteExperimentsAfterDays < 0) {
+		return nil, fmt.Errorf("The numbers in 'retention' in replicate.yaml can't be negative")
+	}
+
+	if l := conf.Lifecycle; l != nil {
+		for name, t := range map[string]*LifecycleTransitions{"experiments": l.Experiments, "checkpoints": l.Checkpoints} {
+			if t == nil {
+				continue
+			}
+			if t.InfrequentAccessAfterDays < 0 || t.ArchiveAfterDays < 0 {
+				return nil, fmt.Errorf("The numbers in 'lifecycle' in replicate.yaml can't be negative")
+			}
+			if t.InfrequentAccessAfterDays > 0 && t.ArchiveAfterDays > 0 && t.ArchiveAfterDays <= t.InfrequentAccessAfterDays {
+				return nil, fmt.Errorf("'archive_after_days' for %s in 'lifecycle' in replicate.yaml must be more than 'infrequent_access_after_days'", name)
+			}
+		}
+	}
+
+	if t := conf.Trash; t != nil && t.RetentionDays < 0 {
+		return nil, fmt.Errorf("'retention_days' in 'trash' in replicate.yaml can't be negative")
+	}
+
+	if c := conf.Chunking; c != nil && c.MinFileSizeMB < 0 {
+		return nil, fmt.Errorf("'min_file_size_mb' in 'chunking' in replicate.yaml can't be negative")
+	}
+
+	if l := conf.LargeFiles; l != nil && l.MinFileSizeMB < 0 {
+		return nil, fmt.Errorf("'min_file_size_mb' in 'large_files' in replicate.yaml can't be negative")
+	}
+
+	if t := conf.Timeouts; t != nil && (t.ConnectSeconds < 0 || t.RequestSeconds < 0 || t.OverallSeconds < 0) {
+		return nil, fmt.Errorf("The numbers in 'timeouts' in replicate.yaml can't be negative")
+	}
+
+	if d := conf.Downloads; d != nil && (d.ChunkSizeMB < 0 || d.Concurrency < 0) {
+		return nil, fmt.Errorf("The numbers in 'downloads' in replicate.yaml can't be negative")
+	}
+
+	if n := conf.Network; n != nil {
+		if n.MaxWorkers < 0 {
+			return nil, fmt.Errorf("'max_workers' in 'network' in replicate.yaml can't be negative")
+		}
+		if n.Proxy != "" {
+			if u, err := url.Parse(n.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("'proxy' in 'network' in replicate.yaml must be a URL like \"http://proxy.example.com:3128\", not %q", n.Proxy)
+			}
+		}
+		if n.CABundle, err = homedir.Expand(n.CABundle); err != nil {
+			return nil, fmt.Errorf("Failed to expand 'ca_bundle' in 'network' in replicate.yaml: %w", err)
+		}
+	}
+
+	if c := conf.Credentials; c != nil {
+		if c.GCPCredentialsFile, err = homedir.Expand(c.GCPCredentialsFile); err != nil {
+			return nil, fmt.Errorf("Failed to expand 'gcp_credentials_file' in 'credentials' in replicate.yaml: %w", err)
+		}
+	}
+
+	if sc := conf.Scratch; sc != nil {
+		if sc.MinFreeMB < 0 {
+			return nil, fmt.Errorf("'min_free_mb' in 'scratch' in replicate.yaml can't be negative")
+		}
+		if sc.Spill != "" && sc.Spill != SpillAuto && sc.Spill != SpillAlways && sc.Spill != SpillNever {
+			return nil, fmt.Errorf("'spill' in 'scratch' in replicate.yaml must be '%s', '%s' or '%s', not '%s'", SpillAuto, SpillAlways, SpillNever, sc.Spill)
+		}
+	}
+
+	if b := conf.Batching; b != nil && b.IntervalSeconds < 0 {
+		return nil, fmt.Errorf("'interval_seconds' in 'batching' in replicate.yaml can't be negative")
+	}
+
+	if w := conf.Watch; w != nil {
+		if w.IntervalSeconds < 0 {
+			return nil, fmt.Errorf("'interval_seconds' in 'watch' in replicate.yaml can't be negative")
+		}
+		if w.PrimaryMetric != "" && w.Goal != "maximize" && w.Goal != "minimize" {
+			return nil, fmt.Errorf("'goal' in 'watch' in replicate.yaml must be 'maximize' or 'minimize' if 'primary_metric' is set")
+		}
+	}
+
+	if sv := conf.Serve; sv != nil {
+		if sv.Image == "" {
+			return nil, fmt.Errorf("'serve' in replicate.yaml must have an 'image' to run")
+		}
+		if sv.Port < 0 || sv.Port > 65535 {
+			return nil, fmt.Errorf("'port' in 'serve' in replicate.yaml must be between 1 and 65535, not %d", sv.Port)
+		}
+		for _, f := range sv.Files {
+			if f == "" || filepath.IsAbs(f) {
+				return nil, fmt.Errorf("The 'files' in 'serve' in replicate.yaml must be paths relative to the project directory, not %q", f)
+			}
+		}
+	}
+
+	if inv := conf.Inventory; inv != nil {
+		if !strings.HasPrefix(inv.URL, "s3://") && !strings.HasPrefix(inv.URL, "gs://") {
+			return nil, fmt.Errorf("'url' in 'inventory' in replicate.yaml must be an s3:// or gs:// URL, not %q", inv.URL)
+		}
+		if inv.MaxAgeHours < 0 {
+			return nil, fmt.Errorf("'max_age_hours' in 'inventory' in replicate.yaml can't be negative")
+		}
+	}
+
+	for _, a := range conf.Alerts {
+		if err := validateAlert(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := conf.Signing; s != nil {
+		if tool := s.SigningTool(); tool != SigningSSH && tool != SigningMinisign {
+			return nil, fmt.Errorf("'tool' in 'signing' in replicate.yaml must be '%s' or '%s', not '%s'", SigningSSH, SigningMinisign, tool)
+		}
+		if s.SigningTool() == SigningSSH && s.Identity == "" {
+			return nil, fmt.Errorf("'signing' in replicate.yaml must have an 'identity' when signing with ssh, such as your email address")
+		}
+	}
+
+	for name, s := range conf.Sweeps {
+		if s == nil {
+			return nil, fmt.Errorf("The sweep %q in replicate.yaml must have a 'command' and 'params'", name)
+		}
+		if err := validateSweep(name, s); err != nil {
+			return nil, err
+		}
+	}
+
+	datasetNames := map[string]bool{}
+	for _, d := range conf.Datasets {
+		if !datasetNamePattern.MatchString(d.Name) {
+			return nil, fmt.Errorf("Datasets in replicate.yaml must have a 'name' that only contains letters, numbers, '_' and '-', not %q", d.Name)
+		}
+		if datasetNames[d.Name] {
+			return nil, fmt.Errorf("There is more than one dataset called %q in replicate.yaml", d.Name)
+		}
+		datasetNames[d.Name] = true
+		if d.Path == "" {
+			return nil, fmt.Errorf("The dataset %q in replicate.yaml must have a 'path'", d.Name)
+		}
+	}
+
+	for _, pattern := range conf.Environment {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q in 'environment' in replicate.yaml is not a valid pattern", pattern)
+		}
+	}
+	for _, seed := range conf.Seeds {
+		if seed == "" {
+			return nil, fmt.Errorf("The names in 'seeds' in replicate.yaml can't be empty")
+		}
+	}
+
+	if q := conf.Quota; q != nil {
+		for name, l := range map[string]*QuotaLimits{"project": q.Project, "user": q.User} {
+			if l == nil {
+				continue
+			}
+			if l.SoftLimitGB < 0 || l.HardLimitGB < 0 {
+				return nil, fmt.Errorf("The limits in 'quota.%s' in replicate.yaml can't be negative", name)
+			}
+			if l.SoftLimitGB > 0 && l.HardLimitGB > 0 && l.SoftLimitGB > l.HardLimitGB {
+				return nil, fmt.Errorf("'soft_limit_gb' in 'quota.%s' in replicate.yaml can't be more than 'hard_limit_gb'", name)
+			}
+		}
+	}
+
+	if conf.Layout != nil {
+		if err := validateLayout(conf.Layout); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := hash.Validate(conf.Hash); err != nil {
+		return nil, fmt.Errorf("'hash' in replicate.yaml must be one of: %s, not '%s'", strings.Join(hash.Algorithms, ", "), conf.Hash)
+	}
+
+	if conf.SpecialFiles != "" && conf.SpecialFiles != SpecialFilesSkip && conf.SpecialFiles != SpecialFilesError {
+		return nil, fmt.Errorf("'special_files' in replicate.yaml must be '%s' or '%s', not '%s'", SpecialFilesSkip, SpecialFilesError, conf.SpecialFiles)
+	}
+
+	if conf.Repository == "" && len(conf.Repositories) == 0 && conf.RepositoryPrefix != "" {
+		conf.Repository = joinURLPath(conf.RepositoryPrefix, filepath.Base(dir))
+	}
+
+	if conf.Project != "" && !projectNamePattern.MatchString(conf.Project) {
+		return nil, fmt.Errorf("'project' in replicate.yaml must only contain letters, numbers, '.', '_' and '-', and must start with a letter or number, not %q", conf.Project)
+	}
+
+	if conf.Repository == "" && len(conf.Repositories) == 0 {
 		return nil, fmt.Errorf("Missing required field in replicate.yaml: repository")
 	}
 
 	return conf, nil
 }
 
+func validateAlert(a *Alert) error {
+	if a.Metric == "" {
+		return fmt.Errorf("Alerts in replicate.yaml must have a 'metric'")
+	}
+	switch a.Condition {
+	case AlertNaN, AlertAbove, AlertBelow:
+	case AlertNotImproved:
+		if a.Checkpoints <= 0 {
+			return fmt.Errorf("The alert %q in replicate.yaml must have a positive number of 'checkpoints' to not have improved in", a.DisplayName())
+		}
+		if a.Goal != "maximize" && a.Goal != "minimize" {
+			return fmt.Errorf("The 'goal' of the alert %q in replicate.yaml must be 'maximize' or 'minimize'", a.DisplayName())
+		}
+	default:
+		return fmt.Errorf("The 'condition' of the alert on %q in replicate.yaml must be '%s', '%s', '%s' or '%s', not '%s'", a.Metric, AlertNaN, AlertAbove, AlertBelow, AlertNotImproved, a.Condition)
+	}
+	return nil
+}
+
+// decodeRaw decodes a YAML config file into generic maps and slices. It
+// returns nil if the file is empty.
+func decodeRaw(text []byte, name string) (map[string]interface{}, error) {
+	if text == nil {
+		return nil, nil
+	}
+	j, err := yaml.YAMLToJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	if string(j) == "null" {
+		return nil, nil
+	}
+	var raw interface{}
+	if err := json.Unmarshal(j, &raw); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", name, err)
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Failed to parse %s: it must be a mapping of settings", name)
+	}
+	return m, nil
+}
+
 func FindConfigPath(startFolder string) (configPath string, deprecatedRepositoryProjectRoot string, err error) {
 	folder := startFolder
 	for i := 0; i < maxSearchDepth; i++ {
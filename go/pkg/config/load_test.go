@@ -6,8 +6,13 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/global"
+	"github.com/replicate/replicate/go/pkg/param"
 )
 
 func TestFindConfigYaml(t *testing.T) {
@@ -126,3 +131,689 @@ func TestDeprecatedRepositoryBackwardsCompatible(t *testing.T) {
 	}, conf)
 	require.Equal(t, tmpDir, projectDir)
 }
+
+func TestNamedRepositories(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "file://.replicate"
+repositories:
+  fast: "file:///mnt/ssd/replicate"
+  archive: "s3://team-bucket"
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, &Config{
+		Repository: "file://.replicate",
+		Repositories: map[string]string{
+			"fast":    "file:///mnt/ssd/replicate",
+			"archive": "s3://team-bucket",
+		},
+	}, conf)
+
+	url, err := conf.RepositoryURL("")
+	require.NoError(t, err)
+	require.Equal(t, "file://.replicate", url)
+	url, err = conf.RepositoryURL("archive")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket", url)
+	_, err = conf.RepositoryURL("nope")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "archive, fast")
+
+	// Default repository is optional if there are named ones
+	conf, err = Parse([]byte(`
+repositories:
+  archive: "s3://team-bucket"
+`), "")
+	require.NoError(t, err)
+	_, err = conf.RepositoryURL("")
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`
+repositories:
+  archive: ""
+`), "")
+	require.Error(t, err)
+}
+
+func TestProject(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://team-bucket?role_arn=arn:aws:iam::123456789012:role/replicate"
+repositories:
+  fast: "file:///mnt/ssd/replicate/"
+project: hotdog-detector
+`), "")
+	require.NoError(t, err)
+
+	url, err := conf.RepositoryURL("")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket/projects/hotdog-detector?role_arn=arn:aws:iam::123456789012:role/replicate", url)
+	url, err = conf.RepositoryURL("fast")
+	require.NoError(t, err)
+	require.Equal(t, "file:///mnt/ssd/replicate/projects/hotdog-detector", url)
+	url, err = conf.RootRepositoryURL("")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket?role_arn=arn:aws:iam::123456789012:role/replicate", url)
+
+	for _, name := range []string{"../other", "a/b", "-hotdog"} {
+		_, err = Parse([]byte(`
+repository: "s3://team-bucket"
+project: "`+name+`"
+`), "")
+		require.Error(t, err, name)
+	}
+}
+
+func TestChunking(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+chunking: {}
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(DefaultChunkingMinFileSizeMB*1024*1024), conf.Chunking.MinFileSize())
+
+	conf, err = Parse([]byte(`
+repository: "s3://foobar"
+chunking:
+  min_file_size_mb: 16
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(16*1024*1024), conf.Chunking.MinFileSize())
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+chunking:
+  min_file_size_mb: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestLargeFiles(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+large_files: {}
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(DefaultLargeFilesMinFileSizeMB*1024*1024), conf.LargeFiles.MinFileSize())
+
+	conf, err = Parse([]byte(`
+repository: "s3://foobar"
+large_files:
+  min_file_size_mb: 500
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(500*1024*1024), conf.LargeFiles.MinFileSize())
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+large_files:
+  min_file_size_mb: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestSpecialFiles(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+special_files: error
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, SpecialFilesError, conf.SpecialFiles)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+special_files: ignore
+`), "")
+	require.Error(t, err)
+}
+
+func TestTrash(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+trash:
+  retention_days: 30
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, &Trash{RetentionDays: 30}, conf.Trash)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+trash:
+  retention_days: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+timeouts:
+  connect_seconds: 10
+  overall_seconds: 600
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, conf.Timeouts.Connect())
+	require.Equal(t, time.Duration(0), conf.Timeouts.Request())
+	require.Equal(t, 10*time.Minute, conf.Timeouts.Overall())
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+timeouts:
+  request_seconds: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestDownloads(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+downloads:
+  chunk_size_mb: 64
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(64*1024*1024), conf.Downloads.ChunkSize())
+	require.Equal(t, 0, conf.Downloads.Concurrency)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+downloads:
+  concurrency: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestNetworkAndCredentials(t *testing.T) {
+	home, err := homedir.Dir()
+	require.NoError(t, err)
+	conf, err := parse([]byte(`repository: "s3://foobar"`), []byte(`
+network:
+  max_workers: 16
+  proxy: "http://proxy.example.com:3128"
+  ca_bundle: "~/certs/ca.pem"
+credentials:
+  aws_profile: "hooli"
+  gcp_credentials_file: "/etc/gcp/key.json"
+`), "/code/hotdog")
+	require.NoError(t, err)
+	require.Equal(t, &Network{
+		MaxWorkers: 16,
+		Proxy:      "http://proxy.example.com:3128",
+		CABundle:   filepath.Join(home, "certs/ca.pem"),
+	}, conf.Network)
+	require.Equal(t, &Credentials{AWSProfile: "hooli", GCPCredentialsFile: "/etc/gcp/key.json"}, conf.Credentials)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+network:
+  max_workers: -1
+`), "")
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+network:
+  proxy: "proxy.example.com"
+`), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'proxy' in 'network'")
+}
+
+func TestBatching(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+batching:
+  interval_seconds: 30
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, conf.Batching.Interval())
+	require.Equal(t, 10*time.Second, (&Batching{}).Interval())
+	require.Equal(t, time.Duration(0), (&Batching{IntervalSeconds: 30, Disabled: true}).Interval())
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+batching:
+  interval_seconds: -1
+`), "")
+	require.Error(t, err)
+}
+
+func TestSigning(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+signing:
+  key: ~/.ssh/id_ed25519
+  identity: ci@example.com
+  allowed_signers: allowed_signers
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, SigningSSH, conf.Signing.SigningTool())
+	require.Equal(t, "ci@example.com", conf.Signing.Identity)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+signing:
+  key: ~/.ssh/id_ed25519
+`), "")
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+signing:
+  tool: gpg
+`), "")
+	require.Error(t, err)
+
+	conf, err = Parse([]byte(`
+repository: "s3://foobar"
+signing:
+  tool: minisign
+  public_key: minisign.pub
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, SigningMinisign, conf.Signing.SigningTool())
+}
+
+func TestSweeps(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+sweeps:
+  lr:
+    command: python train.py --lr {learning_rate} --optimizer {optimizer}
+    params:
+      learning_rate: [0.1, 0.01]
+      optimizer: adam
+  random:
+    command: python train.py --lr {learning_rate}
+    method: random
+    runs: 10
+    concurrency: 2
+    primary_metric: loss
+    goal: minimize
+    params:
+      learning_rate:
+        min: 0.0001
+        max: 0.1
+        log: true
+`), "")
+	require.NoError(t, err)
+	lr := conf.Sweeps["lr"]
+	require.Equal(t, SweepGrid, lr.Method)
+	require.Equal(t, []string{"learning_rate", "optimizer"}, lr.ParamNames())
+	require.Equal(t, []param.Value{param.Float(0.1), param.Float(0.01)}, lr.Params["learning_rate"].Values)
+	require.Equal(t, []param.Value{param.String("adam")}, lr.Params["optimizer"].Values)
+	require.Equal(t, 1, lr.ConcurrentRuns())
+	random := conf.Sweeps["random"]
+	require.True(t, random.Params["learning_rate"].IsRange())
+	require.Equal(t, 0.0001, *random.Params["learning_rate"].Min)
+	require.True(t, random.Params["learning_rate"].Log)
+	require.Equal(t, 2, random.ConcurrentRuns())
+
+	require.Equal(t, "python train.py --lr 0.1", RenderSweepCommand("python train.py --lr {learning_rate}", map[string]string{"learning_rate": "0.1"}))
+
+	for _, invalid := range []string{
+		// Not a param
+		`{command: "python train.py --lr {lr}", params: {learning_rate: [0.1]}}`,
+		// Ranges are only for random sweeps
+		`{command: "python train.py", params: {learning_rate: {min: 0.1, max: 1}}}`,
+		// Random sweeps need runs
+		`{command: "python train.py", method: random, params: {learning_rate: [0.1]}}`,
+		// Log ranges need a positive min
+		`{command: "python train.py", method: random, runs: 5, params: {learning_rate: {min: 0, max: 1, log: true}}}`,
+		// A metric needs a goal
+		`{command: "python train.py", primary_metric: loss, params: {learning_rate: [0.1]}}`,
+	} {
+		_, err = Parse([]byte(`
+repository: "s3://foobar"
+sweeps:
+  invalid: `+invalid+`
+`), "")
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestScratch(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+scratch:
+  dir: /mnt/nvme/tmp
+  min_free_mb: 1024
+  spill: never
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, "/mnt/nvme/tmp", conf.Scratch.Dir)
+	require.Equal(t, int64(1024*1024*1024), conf.Scratch.MinFree())
+	require.Equal(t, SpillNever, conf.Scratch.Spill)
+
+	for _, invalid := range []string{"{min_free_mb: -1}", "{spill: sometimes}"} {
+		_, err = Parse([]byte(`
+repository: "s3://foobar"
+scratch: `+invalid+`
+`), "")
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+watch:
+  paths: ["outputs/*.pt"]
+  metrics: metrics.json
+  primary_metric: loss
+  goal: minimize
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"outputs/*.pt"}, conf.Watch.Paths)
+	require.Equal(t, "metrics.json", conf.Watch.Metrics)
+	require.Equal(t, 5*time.Second, conf.Watch.Interval())
+
+	_, err = Parse([]byte(`
+repository: "s3://foobar"
+watch:
+  paths: ["outputs/*.pt"]
+  primary_metric: loss
+`), "")
+	require.Error(t, err)
+}
+
+func TestServe(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+serve:
+  image: pytorch/torchserve:latest
+  entrypoint: ["torchserve", "--start", "--model-store", "models"]
+  port: 8080
+  files: [models/, config.properties]
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, "pytorch/torchserve:latest", conf.Serve.Image)
+	require.Equal(t, []string{"torchserve", "--start", "--model-store", "models"}, conf.Serve.Entrypoint)
+	require.Equal(t, 8080, conf.Serve.Port)
+	require.Equal(t, []string{"models/", "config.properties"}, conf.Serve.Files)
+
+	for _, invalid := range []string{
+		"{port: 8080}",
+		"{image: foo, port: 100000}",
+		"{image: foo, files: [/models]}",
+	} {
+		_, err = Parse([]byte(`
+repository: "s3://foobar"
+serve: `+invalid+`
+`), "")
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+alerts:
+  - metric: loss
+    condition: nan
+  - name: stalled
+    metric: val_accuracy
+    condition: not_improved
+    checkpoints: 5
+    goal: maximize
+`), "")
+	require.NoError(t, err)
+	require.Len(t, conf.Alerts, 2)
+	require.Equal(t, "loss-nan", conf.Alerts[0].DisplayName())
+	require.Equal(t, "stalled", conf.Alerts[1].DisplayName())
+	require.Equal(t, 5, conf.Alerts[1].Checkpoints)
+
+	for _, alert := range []string{
+		"{metric: loss, condition: exploded}",
+		"{condition: nan}",
+		"{metric: val_accuracy, condition: not_improved, goal: maximize}",
+	} {
+		_, err = Parse([]byte("repository: \"s3://foobar\"\nalerts: ["+alert+"]\n"), "")
+		require.Error(t, err, alert)
+	}
+}
+
+func TestDatasets(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+datasets:
+  - name: train
+    path: data/train.csv
+  - name: images
+    path: data/images
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, []*Dataset{{Name: "train", Path: "data/train.csv"}, {Name: "images", Path: "data/images"}}, conf.Datasets)
+
+	for _, dataset := range []string{
+		"{path: data/train.csv}",
+		"{name: train.v2, path: data/train.csv}",
+		"{name: train}",
+		"{name: train, path: a}, {name: train, path: b}",
+	} {
+		_, err = Parse([]byte("repository: \"s3://foobar\"\ndatasets: ["+dataset+"]\n"), "")
+		require.Error(t, err, dataset)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+inventory:
+  url: "s3://foobar-inventory/foobar/daily/"
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, "s3://foobar-inventory/foobar/daily/", conf.Inventory.URL)
+	require.Equal(t, 48*time.Hour, conf.Inventory.MaxAge())
+
+	for _, inventory := range []string{
+		"{url: /tmp/inventory}",
+		"{url: \"s3://foobar-inventory/\", max_age_hours: -1}",
+	} {
+		_, err = Parse([]byte("repository: \"s3://foobar\"\ninventory: "+inventory+"\n"), "")
+		require.Error(t, err, inventory)
+	}
+}
+
+func TestEnvironmentAndSeeds(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+environment:
+  - "CUDA_*"
+  - OMP_NUM_THREADS
+seeds:
+  - seed
+  - PYTHONHASHSEED
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"CUDA_*", "OMP_NUM_THREADS"}, conf.Environment)
+	require.Equal(t, []string{"seed", "PYTHONHASHSEED"}, conf.Seeds)
+
+	_, err = Parse([]byte("repository: \"s3://foobar\"\nenvironment: [\"CUDA_[\"]\n"), "")
+	require.Error(t, err)
+	_, err = Parse([]byte("repository: \"s3://foobar\"\nseeds: [\"\"]\n"), "")
+	require.Error(t, err)
+}
+
+func TestLayout(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+layout:
+  experiments: "{project}/{date}/{experiment}"
+  checkpoints: "{project}/{experiment}/{date}/{checkpoint}"
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, DefaultExperimentsLayout, (&Layout{}).ExperimentsTemplate())
+	require.Equal(t, "{project}/{experiment}/{date}/{checkpoint}", conf.Layout.CheckpointsTemplate())
+	require.Equal(t, "my-project/a-b/unknown/abc", RenderLayout(conf.Layout.CheckpointsTemplate(), map[string]string{
+		LayoutProject:    "my-project",
+		LayoutExperiment: "a/b",
+		LayoutCheckpoint: "abc",
+	}))
+
+	for _, layout := range []string{
+		"{experiments: \"{experiment}/{date}\"}",
+		"{experiments: \"{date}/{checkpoint}/{experiment}\"}",
+		"{checkpoints: \"/{checkpoint}\"}",
+		"{checkpoints: \"../{checkpoint}\"}",
+		"{checkpoints: \"{host}/{checkpoint}\"}",
+		"{checkpoints: \"{date}//{checkpoint}\"}",
+	} {
+		_, err = Parse([]byte("repository: \"s3://foobar\"\nlayout: "+layout+"\n"), "")
+		require.Error(t, err, layout)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	conf, err := Parse([]byte(`
+repository: "s3://foobar"
+quota:
+  project:
+    soft_limit_gb: 80
+    hard_limit_gb: 100
+  user:
+    hard_limit_gb: 0.5
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, int64(80e9), conf.Quota.Project.SoftLimit())
+	require.Equal(t, int64(100e9), conf.Quota.Project.HardLimit())
+	require.Equal(t, int64(0), conf.Quota.User.SoftLimit())
+	require.Equal(t, int64(5e8), conf.Quota.User.HardLimit())
+
+	for _, quota := range []string{
+		"{project: {soft_limit_gb: -1}}",
+		"{user: {soft_limit_gb: 10, hard_limit_gb: 5}}",
+	} {
+		_, err = Parse([]byte("repository: \"s3://foobar\"\nquota: "+quota+"\n"), "")
+		require.Error(t, err, quota)
+	}
+}
+
+func TestHash(t *testing.T) {
+	conf, err := Parse([]byte("repository: \"s3://foobar\"\nhash: blake3\n"), "")
+	require.NoError(t, err)
+	require.Equal(t, "blake3", conf.Hash)
+
+	_, err = Parse([]byte("repository: \"s3://foobar\"\nhash: md5\n"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'hash' in replicate.yaml must be one of: sha256, blake3, xxh3")
+}
+
+func TestEnvironmentVariableInterpolation(t *testing.T) {
+	os.Setenv("REPLICATE_TEST_BUCKET", "team-bucket")
+	defer os.Unsetenv("REPLICATE_TEST_BUCKET")
+	os.Setenv("REPLICATE_TEST_USER", "ben")
+	defer os.Unsetenv("REPLICATE_TEST_USER")
+
+	conf, err := Parse([]byte(`
+repository: "s3://${REPLICATE_TEST_BUCKET}/${REPLICATE_TEST_USER}"
+repositories:
+  archive: "gs://${REPLICATE_TEST_BUCKET}-archive"
+  dollar: "file://$REPLICATE_TEST_USER"
+`), "")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket/ben", conf.Repository)
+	require.Equal(t, "gs://team-bucket-archive", conf.Repositories["archive"])
+	// Bare $VAR isn't expanded
+	require.Equal(t, "file://$REPLICATE_TEST_USER", conf.Repositories["dollar"])
+
+	_, err = Parse([]byte(`repository: "s3://${REPLICATE_TEST_UNSET_VARIABLE}"`), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "REPLICATE_TEST_UNSET_VARIABLE")
+}
+
+func TestProfiles(t *testing.T) {
+	text := []byte(`
+repository: "file://.replicate"
+profiles:
+  staging:
+    repository: "s3://hotdog-staging"
+  prod:
+    repository: "s3://hotdog-prod"
+    repositories:
+      archive: "s3://hotdog-archive"
+`)
+	conf, err := Parse(text, "")
+	require.NoError(t, err)
+	require.Equal(t, &Config{Repository: "file://.replicate"}, conf)
+
+	os.Setenv("REPLICATE_PROFILE", "staging")
+	defer os.Unsetenv("REPLICATE_PROFILE")
+	conf, err = Parse(text, "")
+	require.NoError(t, err)
+	require.Equal(t, &Config{Repository: "s3://hotdog-staging"}, conf)
+
+	// --profile takes precedence over the environment variable
+	global.Profile = "prod"
+	defer func() { global.Profile = "" }()
+	conf, err = Parse(text, "")
+	require.NoError(t, err)
+	require.Equal(t, &Config{
+		Repository:   "s3://hotdog-prod",
+		Repositories: map[string]string{"archive": "s3://hotdog-archive"},
+	}, conf)
+
+	global.Profile = "nope"
+	_, err = Parse(text, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "prod, staging")
+
+	// Typos in profiles are caught even if they aren't selected
+	global.Profile = ""
+	os.Unsetenv("REPLICATE_PROFILE")
+	_, err = Parse([]byte(`
+repository: "file://.replicate"
+profiles:
+  prod:
+    repostiory: "s3://hotdog-prod"
+`), "")
+	require.Error(t, err)
+
+	// Environment variables only have to be set if their profile is selected
+	text = []byte(`
+repository: "file://.replicate"
+profiles:
+  dev:
+    repository: "file://.replicate-dev"
+  prod:
+    repository: "s3://${REPLICATE_TEST_UNSET_VARIABLE}"
+`)
+	global.Profile = "dev"
+	conf, err = Parse(text, "")
+	require.NoError(t, err)
+	require.Equal(t, &Config{Repository: "file://.replicate-dev"}, conf)
+	global.Profile = "prod"
+	_, err = Parse(text, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "REPLICATE_TEST_UNSET_VARIABLE")
+}
+
+func TestUserConfig(t *testing.T) {
+	// replicate.yaml takes precedence
+	conf, err := parse([]byte(`repository: "s3://project-bucket"`), []byte(`repository: "s3://user-bucket"`), "/code/hotdog")
+	require.NoError(t, err)
+	require.Equal(t, "s3://project-bucket", conf.Repository)
+
+	// Empty replicate.yaml uses repository_prefix from the user config
+	conf, err = parse([]byte(""), []byte(`repository_prefix: "s3://team-bucket/"`), "/code/hotdog")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket/hotdog", conf.Repository)
+
+	conf, err = parse([]byte(""), []byte(`repository_prefix: "s3://team-bucket/?role_arn=arn:aws:iam::123456789012:role/replicate"`), "/code/hotdog")
+	require.NoError(t, err)
+	require.Equal(t, "s3://team-bucket/hotdog?role_arn=arn:aws:iam::123456789012:role/replicate", conf.Repository)
+
+	// Profiles in replicate.yaml override everything
+	os.Setenv("REPLICATE_PROFILE", "prod")
+	defer os.Unsetenv("REPLICATE_PROFILE")
+	conf, err = parse([]byte(`
+profiles:
+  prod:
+    repository: "s3://prod-bucket"
+`), []byte(`repository_prefix: "s3://team-bucket"`), "/code/hotdog")
+	require.NoError(t, err)
+	require.Equal(t, "s3://prod-bucket", conf.Repository)
+	os.Unsetenv("REPLICATE_PROFILE")
+
+	// Errors in the user config say where they are
+	_, err = parse([]byte(`repository: "s3://project-bucket"`), []byte(`unknown: "field"`), "/code/hotdog")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "config.yaml")
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/global"
+)
+
+// Profiles are named sections of replicate.yaml that override top-level
+// settings, so you can switch between e.g. a scratch bucket for testing and
+// the production bucket without editing the file:
+//
+//	repository: "file://.replicate"
+//	profiles:
+//	  prod:
+//	    repository: "s3://hotdog-prod"
+//
+// A profile is selected with --profile or the REPLICATE_PROFILE environment
+// variable. Keys in the profile replace the top-level keys of the same name.
+const profileEnvVar = "REPLICATE_PROFILE"
+
+// SelectedProfile returns the name of the profile to use, or "" for no profile
+func SelectedProfile() string {
+	if global.Profile != "" {
+		return global.Profile
+	}
+	return os.Getenv(profileEnvVar)
+}
+
+// applyProfile takes a decoded replicate.yaml, merges the profile called name
+// over the top-level settings, and removes the profiles section
+func applyProfile(raw interface{}, name string) (interface{}, error) {
+	conf, ok := raw.(map[string]interface{})
+	if !ok {
+		// Not a mapping, so let the decoder report the error
+		return raw, nil
+	}
+	profilesRaw, hasProfiles := conf["profiles"]
+	delete(conf, "profiles")
+
+	profiles := map[string]interface{}{}
+	if hasProfiles {
+		profiles, ok = profilesRaw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'profiles' in replicate.yaml must be a mapping of profile names to settings")
+		}
+	}
+	for profileName, profile := range profiles {
+		if err := validateProfile(profileName, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "" {
+		return conf, nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("The profile %q was selected, but replicate.yaml doesn't have a 'profiles' section", name)
+		}
+		names := []string{}
+		for profileName := range profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("The profile %q is not defined in replicate.yaml. The profiles are: %s", name, strings.Join(names, ", "))
+	}
+	if profile != nil {
+		for key, val := range profile.(map[string]interface{}) {
+			conf[key] = val
+		}
+	}
+	return conf, nil
+}
+
+// validateProfile checks a profile only contains settings that can go in
+// replicate.yaml, so typos are caught even when the profile isn't selected
+func validateProfile(name string, profile interface{}) error {
+	if profile == nil {
+		return nil
+	}
+	settings, ok := profile.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Profile %q in replicate.yaml must be a mapping of settings", name)
+	}
+	if _, ok := settings["profiles"]; ok {
+		return fmt.Errorf("Profile %q in replicate.yaml can't contain 'profiles'", name)
+	}
+	if err := checkSettings(settings); err != nil {
+		return fmt.Errorf("Failed to parse profile %q in replicate.yaml: %s", name, err)
+	}
+	return nil
+}
+
+// checkSettings returns an error if settings contains anything that isn't a
+// valid replicate.yaml setting
+func checkSettings(settings map[string]interface{}) error {
+	j, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&Config{})
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// The ways a sweep can pick the params of its experiments
+const (
+	SweepGrid   = "grid"
+	SweepRandom = "random"
+)
+
+var sweepParamPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Sweep is a set of experiments that `replicate sweep run` launches, each
+// with different params
+type Sweep struct {
+	// Command is run for each experiment. It is a template that the params
+	// are filled in to, such as "python train.py --lr {learning_rate}".
+	Command string `json:"command"`
+
+	// Method is SweepGrid, to run every combination of params (the
+	// default), or SweepRandom, to run Runs random combinations
+	Method string `json:"method,omitempty"`
+
+	// Params are the values each param can take
+	Params map[string]*SweepParam `json:"params"`
+
+	// Runs is how many experiments a random sweep runs
+	Runs int `json:"runs,omitempty"`
+
+	// Seed makes a random sweep pick the same params every time it is run,
+	// if it isn't 0
+	Seed int64 `json:"seed,omitempty"`
+
+	// Concurrency is how many experiments run at once. It defaults to 1.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// PrimaryMetric is the metric of the experiments' checkpoints that picks
+	// the best experiment, and Goal is "maximize" or "minimize". If it
+	// isn't set, each experiment's own primary metric is used.
+	PrimaryMetric string `json:"primary_metric,omitempty"`
+	Goal          string `json:"goal,omitempty"`
+}
+
+// SweepParam is the values a param of a sweep can take: either a list of
+// values, or, for random sweeps, a range of numbers
+type SweepParam struct {
+	Values []param.Value `json:"values,omitempty"`
+
+	// Min and Max are the range numbers are picked from. If Log is set,
+	// they are picked uniformly on a log scale, and if Int is set, they
+	// are rounded to whole numbers.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	Log bool     `json:"log,omitempty"`
+	Int bool     `json:"int,omitempty"`
+}
+
+// UnmarshalJSON reads a list of values, a single value, or an object with
+// values or a range
+func (p *SweepParam) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		return json.Unmarshal(data, &p.Values)
+	case bytes.HasPrefix(data, []byte("{")):
+		type plain SweepParam
+		return json.Unmarshal(data, (*plain)(p))
+	default:
+		value := param.Value{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		p.Values = []param.Value{value}
+		return nil
+	}
+}
+
+// IsRange returns whether the param is a range of numbers, rather than a
+// list of values
+func (p *SweepParam) IsRange() bool {
+	return len(p.Values) == 0
+}
+
+// ParamNames returns the names of the params, sorted
+func (s *Sweep) ParamNames() []string {
+	names := []string{}
+	for name := range s.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConcurrentRuns returns how many experiments run at once
+func (s *Sweep) ConcurrentRuns() int {
+	if s.Concurrency <= 0 {
+		return 1
+	}
+	return s.Concurrency
+}
+
+func validateSweep(name string, s *Sweep) error {
+	if s.Command == "" {
+		return fmt.Errorf("The sweep %q in replicate.yaml must have a 'command'", name)
+	}
+	if len(s.Params) == 0 {
+		return fmt.Errorf("The sweep %q in replicate.yaml must have some 'params'", name)
+	}
+	if s.Method == "" {
+		s.Method = SweepGrid
+	}
+	switch s.Method {
+	case SweepGrid:
+	case SweepRandom:
+		if s.Runs <= 0 {
+			return fmt.Errorf("The random sweep %q in replicate.yaml must have a positive number of 'runs'", name)
+		}
+	default:
+		return fmt.Errorf("The 'method' of the sweep %q in replicate.yaml must be '%s' or '%s', not '%s'", name, SweepGrid, SweepRandom, s.Method)
+	}
+	if s.Concurrency < 0 {
+		return fmt.Errorf("The 'concurrency' of the sweep %q in replicate.yaml can't be negative", name)
+	}
+	if s.PrimaryMetric != "" && s.Goal != "maximize" && s.Goal != "minimize" {
+		return fmt.Errorf("The 'goal' of the sweep %q in replicate.yaml must be 'maximize' or 'minimize' if 'primary_metric' is set", name)
+	}
+	for paramName, p := range s.Params {
+		if p == nil {
+			return fmt.Errorf("The param %q of the sweep %q in replicate.yaml must have some values", paramName, name)
+		}
+		if !p.IsRange() {
+			continue
+		}
+		if s.Method != SweepRandom {
+			return fmt.Errorf("The param %q of the sweep %q in replicate.yaml must be a list of values, because ranges can only be used in random sweeps", paramName, name)
+		}
+		if p.Min == nil || p.Max == nil || *p.Min > *p.Max {
+			return fmt.Errorf("The param %q of the sweep %q in replicate.yaml must have 'values', or a 'min' and a 'max' that isn't less than it", paramName, name)
+		}
+		if p.Log && *p.Min <= 0 {
+			return fmt.Errorf("The 'min' of the param %q of the sweep %q in replicate.yaml must be positive, because it is on a log scale", paramName, name)
+		}
+	}
+	for _, match := range sweepParamPattern.FindAllStringSubmatch(s.Command, -1) {
+		if _, ok := s.Params[match[1]]; !ok {
+			return fmt.Errorf("%s in the 'command' of the sweep %q in replicate.yaml isn't one of its params", match[0], name)
+		}
+	}
+	return nil
+}
+
+// RenderSweepCommand fills in the params in the template command with the
+// strings in values
+func RenderSweepCommand(command string, values map[string]string) string {
+	return sweepParamPattern.ReplaceAllStringFunc(command, func(variable string) string {
+		return values[variable[1:len(variable)-1]]
+	})
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/replicate/go/pkg/settings"
+)
+
+// The user's global config file has the same format as replicate.yaml and
+// sets defaults for all their projects. Settings are applied in this order,
+// with later ones taking precedence:
+//
+//  1. ~/.config/replicate/config.yaml
+//  2. replicate.yaml
+//  3. The profile selected in replicate.yaml
+//  4. Command-line options, such as --repository
+const userConfigDisplayPath = "~/.config/replicate/config.yaml"
+
+func userConfigPath() (string, error) {
+	dir, err := settings.UserSettingsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// readUserConfig returns the contents of the user's global config file, or
+// nil if it doesn't exist
+func readUserConfig() ([]byte, error) {
+	configPath, err := userConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	text, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+	return text, nil
+}
+
+// mergeUserConfig returns the project's settings with the user's settings
+// filled in for anything the project doesn't set
+func mergeUserConfig(user, project map[string]interface{}) (map[string]interface{}, error) {
+	if err := checkSettings(user); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", userConfigDisplayPath, err)
+	}
+	merged := map[string]interface{}{}
+	for key, val := range user {
+		merged[key] = val
+	}
+	for key, val := range project {
+		merged[key] = val
+	}
+	return merged, nil
+}
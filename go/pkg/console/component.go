@@ -0,0 +1,33 @@
+package console
+
+// Logger writes log messages tagged with the component of Replicate they are
+// from, such as "s3", so when debugging it is clear which part of Replicate
+// is doing what. In JSON output the component is its own field.
+type Logger struct {
+	component string
+}
+
+// Component returns a logger for messages from component
+func Component(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// Debug level message
+func (l *Logger) Debug(msg string, v ...interface{}) {
+	ConsoleInstance.logComponent(DebugLevel, l.component, msg, v...)
+}
+
+// Info level message
+func (l *Logger) Info(msg string, v ...interface{}) {
+	ConsoleInstance.logComponent(InfoLevel, l.component, msg, v...)
+}
+
+// Warn level message
+func (l *Logger) Warn(msg string, v ...interface{}) {
+	ConsoleInstance.logComponent(WarnLevel, l.component, msg, v...)
+}
+
+// Error level message
+func (l *Logger) Error(msg string, v ...interface{}) {
+	ConsoleInstance.logComponent(ErrorLevel, l.component, msg, v...)
+}
@@ -2,10 +2,12 @@
 package console
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 	"github.com/mitchellh/go-wordwrap"
@@ -19,7 +21,10 @@ type Console struct {
 	Color     bool
 	IsMachine bool
 	Level     Level
-	mu        sync.Mutex
+	// JSON writes log messages as JSON objects, one per line, instead of
+	// formatting them for people to read
+	JSON bool
+	mu   sync.Mutex
 }
 
 // Debug level message
@@ -76,15 +81,30 @@ func (c *Console) DebugOutput(line string) {
 }
 
 func (c *Console) log(level Level, msg string, v ...interface{}) {
+	c.logComponent(level, "", msg, v...)
+}
+
+// logComponent logs a message from component, which is "" for messages that
+// aren't from a particular component
+func (c *Console) logComponent(level Level, component string, msg string, v ...interface{}) {
 	if level < c.Level {
 		return
 	}
 
+	formattedMsg := fmt.Sprintf(msg, v...)
+	if c.JSON {
+		c.logJSON(level, component, formattedMsg)
+		return
+	}
+
+	// Components are only interesting when debugging
+	if component != "" && c.Level == DebugLevel {
+		formattedMsg = "[" + component + "] " + formattedMsg
+	}
+
 	prompt := "═══╡ "
 	continuationPrompt := "   │ "
 
-	formattedMsg := fmt.Sprintf(msg, v...)
-
 	// Word wrap
 	width, err := GetWidth()
 	if err != nil {
@@ -126,3 +146,25 @@ func (c *Console) log(level Level, msg string, v ...interface{}) {
 		fmt.Fprintln(os.Stderr, line)
 	}
 }
+
+type jsonMessage struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (c *Console) logJSON(level Level, component string, msg string) {
+	line, err := json.Marshal(jsonMessage{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     level.String(),
+		Component: component,
+		Message:   msg,
+	})
+	if err != nil {
+		panic(err) // should never happen
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintln(os.Stderr, string(line))
+}
@@ -18,6 +18,11 @@ func SetLevel(level Level) {
 	ConsoleInstance.Level = level
 }
 
+// SetJSON sets whether to write log messages as JSON
+func SetJSON(json bool) {
+	ConsoleInstance.JSON = json
+}
+
 // SetColor sets whether to print colors
 func SetColor(color bool) {
 	ConsoleInstance.Color = color
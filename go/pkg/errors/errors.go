@@ -1,6 +1,7 @@
 package errors
 
 import (
+	goerrors "errors"
 	"fmt"
 )
 
@@ -12,9 +13,25 @@ const (
 	CodeIncompatibleRepositoryVersion = "INCOMPATIBLE_REPOSITORY_VERSION"
 	CodeCorruptedRepositorySpec       = "CORRUPTED_REPOSITORY_SPEC"
 	CodeConfigNotFound                = "CONFIG_NOT_FOUND"
+	CodeRepositoryCredentialsError    = "REPOSITORY_CREDENTIALS_ERROR"
+	CodeArchived                      = "ARCHIVED"
+	CodeUnreachable                   = "UNREACHABLE"
+	CodeTimedOut                      = "TIMED_OUT"
+	CodeInterrupted                   = "INTERRUPTED"
+	CodeQuotaExceeded                 = "QUOTA_EXCEEDED"
+	CodePermissionDenied              = "PERMISSION_DENIED"
+	CodeTransient                     = "TRANSIENT"
+)
+
+// The classes of storage errors, to be compared with Is. Any error with the
+// same code is one of them, whatever its message.
+var (
+	ErrNotFound         error = &codedError{code: CodeDoesNotExist, msg: "not found"}
+	ErrPermissionDenied error = &codedError{code: CodePermissionDenied, msg: "permission denied"}
+	ErrQuotaExceeded    error = &codedError{code: CodeQuotaExceeded, msg: "quota exceeded"}
+	ErrTransient        error = &codedError{code: CodeTransient, msg: "transient error"}
 )
 
-// TODO: support wrapping https://blog.golang.org/go1.13-errors
 type CodedError interface {
 	Code() string
 }
@@ -22,6 +39,7 @@ type CodedError interface {
 type codedError struct {
 	code string
 	msg  string
+	err  error
 }
 
 func (e *codedError) Error() string {
@@ -32,6 +50,47 @@ func (e *codedError) Code() string {
 	return e.code
 }
 
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// Is makes errors with the same code match, so ErrNotFound and friends can
+// be used with Is. Credentials errors are also permission denied errors, and
+// a repository being unreachable is transient.
+func (e *codedError) Is(target error) bool {
+	t, ok := target.(*codedError)
+	if !ok {
+		return false
+	}
+	return t.code == e.code || t.code == classes[e.code]
+}
+
+// classes are the classes of storage errors that other codes belong to
+var classes = map[string]string{
+	CodeRepositoryCredentialsError: CodePermissionDenied,
+	CodeUnreachable:                CodeTransient,
+}
+
+// Is is errors.Is from the standard library
+func Is(err, target error) bool {
+	return goerrors.Is(err, target)
+}
+
+// As is errors.As from the standard library
+func As(err error, target interface{}) bool {
+	return goerrors.As(err, target)
+}
+
+// Unwrap is errors.Unwrap from the standard library
+func Unwrap(err error) error {
+	return goerrors.Unwrap(err)
+}
+
+// Wrap returns an error with code and msg, which wraps err
+func Wrap(code string, msg string, err error) error {
+	return &codedError{code: code, msg: msg, err: err}
+}
+
 func IsDoesNotExist(err error) bool {
 	return Code(err) == CodeDoesNotExist
 }
@@ -40,12 +99,54 @@ func IsConfigNotFound(err error) bool {
 	return Code(err) == CodeConfigNotFound
 }
 
+func IsArchived(err error) bool {
+	return Code(err) == CodeArchived
+}
+
+func IsTimedOut(err error) bool {
+	return Code(err) == CodeTimedOut
+}
+
+func IsInterrupted(err error) bool {
+	return Code(err) == CodeInterrupted
+}
+
+func IsQuotaExceeded(err error) bool {
+	return Code(err) == CodeQuotaExceeded
+}
+
+func IsPermissionDenied(err error) bool {
+	return Code(err) == CodePermissionDenied
+}
+
+func IsTransient(err error) bool {
+	return Code(err) == CodeTransient
+}
+
 func DoesNotExist(msg string) error { return &codedError{code: CodeDoesNotExist, msg: msg} }
 func ReadError(msg string) error    { return &codedError{code: CodeReadError, msg: msg} }
 func WriteError(msg string) error   { return &codedError{code: CodeWriteError, msg: msg} }
 func RepositoryConfigurationError(msg string) error {
 	return &codedError{code: CodeRepositoryConfigurationError, msg: msg}
 }
+func RepositoryCredentialsError(msg string) error {
+	return &codedError{code: CodeRepositoryCredentialsError, msg: msg}
+}
+func Archived(msg string) error { return &codedError{code: CodeArchived, msg: msg} }
+func Unreachable(msg string) error {
+	return &codedError{code: CodeUnreachable, msg: msg}
+}
+func TimedOut(msg string) error { return &codedError{code: CodeTimedOut, msg: msg} }
+func Interrupted(msg string) error {
+	return &codedError{code: CodeInterrupted, msg: msg}
+}
+func QuotaExceeded(msg string) error {
+	return &codedError{code: CodeQuotaExceeded, msg: msg}
+}
+func PermissionDenied(msg string) error {
+	return &codedError{code: CodePermissionDenied, msg: msg}
+}
+func Transient(msg string) error { return &codedError{code: CodeTransient, msg: msg} }
 
 func ConfigNotFound(msg string) error {
 	return &codedError{
@@ -79,9 +180,25 @@ where VERSION is an integer.`, rootURL, specPath, err),
 	}
 }
 
+// Code returns the code of err, or the first error it wraps that has one
 func Code(err error) string {
-	if cerr, ok := err.(CodedError); ok {
+	var cerr CodedError
+	if goerrors.As(err, &cerr) {
 		return cerr.Code()
 	}
 	return ""
 }
+
+// Remediation returns what the user can do about err, based on its code, or
+// an empty string if there isn't anything in general
+func Remediation(err error) string {
+	switch Code(err) {
+	case CodePermissionDenied:
+		return "Check that you are allowed to read and write the repository. For buckets, the credentials you are using need permission to get, put, list and delete objects in it. For directories, the files in them need to be readable and writable by you."
+	case CodeQuotaExceeded:
+		return "Free up some space in the repository, for example with 'replicate prune' or by removing experiments you don't need with 'replicate rm', or ask whoever looks after the repository for a bigger quota."
+	case CodeTransient:
+		return "This is probably a temporary problem with the storage service or the network, so try again in a few minutes."
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CloneFile copies src to dest. On filesystems with copy-on-write support
+// (e.g. Btrfs and XFS) the copy shares src's data until either file is
+// changed, so copying a large file is almost instant and takes no extra space.
+// On other filesystems, or if dest is on a different filesystem to src, the
+// bytes are copied.
+//
+// Unlike a hard link, changing src after it has been cloned doesn't change
+// dest, so this is safe for snapshotting files that are still being written to.
+func CloneFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %v", src, err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %v", src, err)
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("Failed to write to %s: %v", dest, err)
+	}
+	defer out.Close()
+
+	if err := reflink(in, out); err != nil {
+		// Not supported here, so fall back to copying
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("Failed to copy %s to %s: %v", src, dest, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("Failed to write to %s: %v", dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package files
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink isn't implemented on this platform, so files are always copied
+func reflink(in, out *os.File) error {
+	return errors.New("reflinks aren't supported on this platform")
+}
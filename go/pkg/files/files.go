@@ -7,8 +7,6 @@ import (
 	"os"
 )
 
-const tempFolder = "/tmp/replicate"
-
 func FileExists(filePath string) (bool, error) {
 	if _, err := os.Stat(filePath); err == nil {
 		return true, nil
@@ -30,6 +28,7 @@ func IsDir(dirPath string) (bool, error) {
 func TempDir(prefix string) (string, error) {
 	// FIXME(bfirsh): make this more unique (e.g. ai.replicate, like some OS X applications do)
 
+	tempFolder := TempFolder()
 	err := os.MkdirAll(tempFolder, 0755)
 	if err != nil {
 		return "", fmt.Errorf("Failed to create temporary directory %s: %w", tempFolder, err)
@@ -0,0 +1,11 @@
+// +build !linux,!darwin,!windows
+
+package files
+
+import "fmt"
+
+// FreeSpace returns the number of bytes that can be written to the disk dir
+// is on. It isn't supported on this operating system.
+func FreeSpace(dir string) (int64, error) {
+	return 0, fmt.Errorf("Finding out how much free space there is isn't supported on this operating system")
+}
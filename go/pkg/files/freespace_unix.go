@@ -0,0 +1,15 @@
+// +build linux darwin
+
+package files
+
+import "syscall"
+
+// FreeSpace returns the number of bytes that can be written to the disk dir
+// is on
+func FreeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
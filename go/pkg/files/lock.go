@@ -0,0 +1,64 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Several replicate commands can run in the same project at once, such as the
+// daemon of a training script and 'replicate ls' in another terminal. State
+// they keep in directories on local disk, like the spool and the metadata
+// cache, is guarded with an advisory lock on a file next to the directory, so
+// one doesn't remove or rewrite what another is in the middle of using. The
+// lock file is next to the directory, rather than in it, so the directory can
+// be removed while it is locked. Locks are released when the process exits,
+// however it exits.
+
+// Lock is a lock on a directory
+type Lock struct {
+	f *os.File
+}
+
+// LockDir takes an exclusive lock on dir, waiting until nobody else has a
+// lock on it
+func LockDir(dir string) (*Lock, error) {
+	return lockDir(dir, true, true)
+}
+
+// RLockDir takes a shared lock on dir, waiting until nobody has an exclusive
+// lock on it
+func RLockDir(dir string) (*Lock, error) {
+	return lockDir(dir, false, true)
+}
+
+// TryLockDir takes an exclusive lock on dir if nobody else has a lock on it.
+// If somebody does, it returns nil without waiting.
+func TryLockDir(dir string) (*Lock, error) {
+	return lockDir(dir, true, false)
+}
+
+func lockDir(dir string, exclusive bool, wait bool) (*Lock, error) {
+	lockPath := filepath.Clean(dir) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := lockFile(f, exclusive, wait)
+	if err != nil || !locked {
+		f.Close()
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDir(t *testing.T) {
+	tmpDir, err := TempDir("test-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "spool")
+
+	// Shared locks don't conflict with each other...
+	shared1, err := RLockDir(dir)
+	require.NoError(t, err)
+	shared2, err := RLockDir(dir)
+	require.NoError(t, err)
+
+	// ...but do with exclusive ones
+	lock, err := TryLockDir(dir)
+	require.NoError(t, err)
+	require.Nil(t, lock)
+	require.NoError(t, shared1.Unlock())
+	require.NoError(t, shared2.Unlock())
+	lock, err = TryLockDir(dir)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+
+	// The directory can be removed while it is locked
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.RemoveAll(dir))
+
+	// LockDir waits until the lock is released. require can't be called
+	// from other goroutines, so the result is sent back instead.
+	locked := make(chan error)
+	go func() {
+		other, err := LockDir(dir)
+		if err == nil {
+			err = other.Unlock()
+		}
+		locked <- err
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Took a lock that was already held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, lock.Unlock())
+	require.NoError(t, <-locked)
+}
@@ -0,0 +1,37 @@
+// +build !windows
+
+package files
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes a lock on f with flock. If wait is false and somebody else
+// has a lock that conflicts with it, it returns false straight away.
+func lockFile(f *os.File, exclusive bool, wait bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		switch err {
+		case nil:
+			return true, nil
+		case syscall.EINTR:
+			continue
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,85 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Temporary directories are created in a "replicate" directory in the
+// scratch directory, which is the system's temporary directory unless it is
+// set with $REPLICATE_TMPDIR or replicate.yaml. On many training machines,
+// /tmp is a small tmpfs, so tarballs and copies of checkpoints need to go
+// somewhere bigger.
+
+// TempDirEnvVar is the scratch directory, which takes precedence over the one
+// in replicate.yaml
+const TempDirEnvVar = "REPLICATE_TMPDIR"
+
+// ErrNotEnoughSpace is returned by EnsureFreeSpace when there isn't enough
+// free space
+var ErrNotEnoughSpace = errors.New("not enough free space")
+
+var (
+	scratchMu      sync.Mutex
+	scratchDir     string
+	minFreeSpace   int64
+	freeSpaceCheck = FreeSpace
+)
+
+// SetScratch sets the scratch directory, usually from replicate.yaml, and how
+// much space to leave free on the disk it is on. If dir is empty, it is the
+// system's temporary directory.
+func SetScratch(dir string, minFree int64) {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+	scratchDir = dir
+	minFreeSpace = minFree
+}
+
+// TempFolder returns the directory temporary directories are created in
+func TempFolder() string {
+	scratchMu.Lock()
+	dir := scratchDir
+	scratchMu.Unlock()
+	if env := os.Getenv(TempDirEnvVar); env != "" {
+		dir = env
+	}
+	if dir == "" {
+		// This isn't /tmp on Windows
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "replicate")
+}
+
+// EnsureFreeSpace returns an error that wraps ErrNotEnoughSpace if writing
+// size bytes to dir would leave less free space on its disk than was set
+// with SetScratch. dir doesn't have to exist yet. If the free space can't be
+// found out, it returns nil, so not knowing doesn't stop anything working.
+func EnsureFreeSpace(dir string, size int64) error {
+	scratchMu.Lock()
+	minFree := minFreeSpace
+	scratchMu.Unlock()
+
+	// Look at the disk of the nearest directory that exists
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeSpaceCheck(dir)
+	if err != nil {
+		return nil
+	}
+	if free-size < minFree {
+		return fmt.Errorf("%w in %s: %s is needed, but only %s is free. Set 'dir' in 'scratch' in replicate.yaml, or $%s, to a directory on a bigger disk", ErrNotEnoughSpace, dir, formatMB(size+minFree), formatMB(free), TempDirEnvVar)
+	}
+	return nil
+}
+
+func formatMB(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
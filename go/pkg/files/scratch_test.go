@@ -0,0 +1,53 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTempFolder(t *testing.T) {
+	defer SetScratch("", 0)
+	defer os.Setenv(TempDirEnvVar, os.Getenv(TempDirEnvVar))
+
+	os.Unsetenv(TempDirEnvVar)
+	require.Equal(t, filepath.Join(os.TempDir(), "replicate"), TempFolder())
+	SetScratch("/scratch", 0)
+	require.Equal(t, filepath.Join("/scratch", "replicate"), TempFolder())
+	os.Setenv(TempDirEnvVar, "/mnt/nvme")
+	require.Equal(t, filepath.Join("/mnt/nvme", "replicate"), TempFolder())
+}
+
+func TestEnsureFreeSpace(t *testing.T) {
+	const mb = 1024 * 1024
+	defer SetScratch("", 0)
+	defer func() { freeSpaceCheck = FreeSpace }()
+	checked := ""
+	freeSpaceCheck = func(dir string) (int64, error) {
+		checked = dir
+		return 100 * mb, nil
+	}
+	dir, err := TempDir("test-free-space")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Directories that don't exist yet are on the disk of their parent
+	require.NoError(t, EnsureFreeSpace(filepath.Join(dir, "tar", "foo"), 50*mb))
+	require.Equal(t, dir, checked)
+	err = EnsureFreeSpace(dir, 150*mb)
+	require.True(t, errors.Is(err, ErrNotEnoughSpace))
+	require.Contains(t, err.Error(), "150.0 MB is needed, but only 100.0 MB is free")
+
+	// Space can be left free
+	SetScratch("", 60*mb)
+	require.True(t, errors.Is(EnsureFreeSpace(dir, 50*mb), ErrNotEnoughSpace))
+
+	// Not knowing doesn't stop anything
+	freeSpaceCheck = func(dir string) (int64, error) {
+		return 0, errors.New("not supported")
+	}
+	require.NoError(t, EnsureFreeSpace(dir, 150*mb))
+}
@@ -5,9 +5,13 @@ var Environment = "development" // set in Makefile
 
 var ConfigFilenames [2]string = [2]string{"replicate.yaml", "replicate.yml"}
 var Verbose = false
+var LogLevel = ""
+var LogJSON = false
 var WebURL = "https://replicate.ai"
 var Color = true
 var ProjectDirectory = ""
+var RepositoryName = ""
+var Profile = ""
 var BugsEmail = "bugs@replicate.ai"
 var SegmentKey = "MKaYmSZ2hW6P8OegI9g0sufjZeUh28g7"
 
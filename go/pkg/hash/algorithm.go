@@ -0,0 +1,62 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	stdhash "hash"
+	"strings"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// Algorithms that the contents of files are hashed with, to deduplicate
+// them and check they haven't been corrupted. XXH3 isn't a cryptographic
+// hash, so it is only suitable for repositories that nobody would try to
+// put colliding files in.
+const (
+	SHA256 = "sha256"
+	BLAKE3 = "blake3"
+	XXH3   = "xxh3"
+)
+
+// DefaultAlgorithm is the algorithm of repositories that don't record one
+const DefaultAlgorithm = SHA256
+
+// Algorithms are the algorithms that can be used
+var Algorithms = []string{SHA256, BLAKE3, XXH3}
+
+// New returns a new hash.Hash for algorithm, or the default algorithm if it
+// is empty
+func New(algorithm string) (stdhash.Hash, error) {
+	switch algorithm {
+	case "", SHA256:
+		return sha256.New(), nil
+	case BLAKE3:
+		return blake3.New(), nil
+	case XXH3:
+		return &xxh3Hasher{xxh3.New()}, nil
+	}
+	return nil, fmt.Errorf("Unknown hash algorithm '%s', it must be one of: %s", algorithm, strings.Join(Algorithms, ", "))
+}
+
+// Validate returns an error if algorithm isn't one of Algorithms
+func Validate(algorithm string) error {
+	_, err := New(algorithm)
+	return err
+}
+
+// xxh3Hasher is XXH3 with a 128 bit output. xxh3.Hasher's Sum is the 64 bit
+// hash, which collides too easily to store files by.
+type xxh3Hasher struct {
+	*xxh3.Hasher
+}
+
+func (h *xxh3Hasher) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
+
+func (h *xxh3Hasher) Size() int {
+	return 16
+}
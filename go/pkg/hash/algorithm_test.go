@@ -0,0 +1,79 @@
+package hash
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXXH3(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	// From the reference implementation, at sizes either side of where
+	// XXH3 changes how it hashes input
+	for _, tt := range []struct {
+		size     int
+		expected string
+	}{
+		{0, "99aa06d3014798d86001c324468d497f"},
+		{1, "a6cd5e9392000f6ac44bdff4074eecdb"},
+		{3, "e3b55f57945a17cf5f4299fc161c9cbb"},
+		{4, "eb70bf5fc779e9e6a6111d53e80a3db5"},
+		{8, "e1e4432a62217fe4cfd50c61c8bb98c1"},
+		{9, "16c769d83e4aebce907931979dca3746"},
+		{16, "72950631827607e2842812cc870dcae2"},
+		{17, "685bc458b37d057fc06e233df7729217"},
+		{128, "14792fc3af88dc6c05321a0b64d67b41"},
+		{129, "dd5e74ac6b45f54ebc30b63382b09a3b"},
+		{240, "65b5be86da5540e7c92b68e16f83bbb6"},
+		{241, "1da1cb61bcb8a2a102e8cd95421c6d02"},
+		{1024, "d0ac1f7b93bf57b9e5d78bafa45b2aa5"},
+		{1025, "2882ebca04ec915ce95c42288f28186e"},
+		{2048, "a5141efedfefc1af25339063db861586"},
+		{100000, "54182c58bbb1337c42c23aeead96750d"},
+	} {
+		for _, writeSize := range []int{1, 63, 1000, len(data)} {
+			h, err := New(XXH3)
+			require.NoError(t, err)
+			for remaining := data[:tt.size]; len(remaining) > 0; {
+				n := writeSize
+				if n > len(remaining) {
+					n = len(remaining)
+				}
+				_, err := h.Write(remaining[:n])
+				require.NoError(t, err)
+				remaining = remaining[n:]
+			}
+			require.Equal(t, tt.expected, hex.EncodeToString(h.Sum(nil)), "size %d, written %d at a time", tt.size, writeSize)
+		}
+	}
+
+	h, err := New(XXH3)
+	require.NoError(t, err)
+	h.Write([]byte("abc"))
+	require.Equal(t, "06b05ab6733a618578af5f94892f3950", hex.EncodeToString(h.Sum(nil)))
+	require.Equal(t, 16, h.Size())
+	h.Reset()
+	require.Equal(t, "99aa06d3014798d86001c324468d497f", hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestBLAKE3(t *testing.T) {
+	h, err := New(BLAKE3)
+	require.NoError(t, err)
+	require.Equal(t, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", hex.EncodeToString(h.Sum(nil)))
+	h.Write([]byte("abc"))
+	require.Equal(t, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestNew(t *testing.T) {
+	h, err := New("")
+	require.NoError(t, err)
+	h.Write([]byte("abc"))
+	require.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hex.EncodeToString(h.Sum(nil)))
+
+	_, err = New("md5")
+	require.Error(t, err)
+}
@@ -0,0 +1,317 @@
+// Package metrics keeps counters, gauges and histograms of what Replicate is
+// doing, and serves them in the Prometheus text format so that long-running
+// processes like the daemon can be monitored.
+//
+// It only implements what Replicate needs, so the daemon doesn't have to
+// depend on the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// AddressEnvVar is the address to serve metrics on, such as ":9090", if it
+// isn't passed with --metrics-address
+const AddressEnvVar = "REPLICATE_METRICS_ADDRESS"
+
+// DefaultBuckets are the upper bounds of histogram buckets, in seconds. They
+// range from a quick request to a big upload.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]metric{}
+)
+
+// register adds m to the metrics that are served. Metrics are defined once,
+// in package-level variables, so a name being registered twice is a bug.
+func register(name string, m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("metric " + name + " is already registered")
+	}
+	registry[name] = m
+}
+
+// series is a set of values of a metric, keyed by their label values
+type series struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+func (s *series) key(labelValues []string) string {
+	if len(labelValues) != len(s.labelNames) {
+		panic(fmt.Sprintf("metric %s has labels %v, but was given %d values", s.name, s.labelNames, len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (s *series) writeHeader(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", s.name, s.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", s.name, kind)
+}
+
+// labels formats label values as {name="value",...}, with extra appended
+func (s *series) labels(key string, extra ...string) string {
+	pairs := []string{}
+	if len(s.labelNames) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, s.labelNames[i]+"="+quoteLabelValue(value))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quoteLabelValue(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a number that only goes up, such as the number of requests
+// made, broken down by its labels
+type Counter struct {
+	series
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter returns a counter called name, broken down by labelNames
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{series: series{name: name, help: help, labelNames: labelNames}, values: map[string]float64{}}
+	register(name, c)
+	return c
+}
+
+// Add adds v to the counter with labelValues
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+// Inc adds one to the counter with labelValues
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the value of the counter with labelValues
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(key), formatFloat(c.values[key]))
+	}
+}
+
+// Gauge is a number that goes up and down, such as the number of
+// experiments running
+type Gauge struct {
+	series
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge returns a gauge called name
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{series: series{name: name, help: help}}
+	register(name, g)
+	return g
+}
+
+// Add adds v, which can be negative, to the gauge
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += v
+}
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec takes one from the gauge
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value returns the value of the gauge
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.value))
+}
+
+// Histogram counts observations, such as how long requests take, in buckets
+// of how big they are, broken down by its labels
+type Histogram struct {
+	series
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	// counts are the number of observations in each bucket, not including
+	// the ones in smaller buckets
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a histogram called name with DefaultBuckets, broken
+// down by labelNames
+func NewHistogram(name, help string, labelNames ...string) *Histogram {
+	h := &Histogram{
+		series:  series{name: name, help: help, labelNames: labelNames},
+		buckets: DefaultBuckets,
+		values:  map[string]*histogramValue{},
+	}
+	register(name, h)
+	return h
+}
+
+// Observe adds v to the histogram with labelValues
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			value.counts[i]++
+			break
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+// Count returns the number of observations in the histogram with
+// labelValues
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if value, ok := h.values[key]; ok {
+		return value.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	keys := []string{}
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := h.values[key]
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += value.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatFloat(upperBound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(key), formatFloat(value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(key), value.count)
+	}
+}
+
+// Write writes all the metrics in the Prometheus text format
+func Write(w io.Writer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		registry[name].write(w)
+	}
+}
+
+// Handler serves all the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+}
+
+// Serve serves metrics at /metrics on address in the background. It returns
+// the address it is listening on, which is useful if the port in address is
+// 0, or an error if it can't listen on address.
+func Serve(address string) (string, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("Failed to serve metrics on %s: %w", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			console.Warn("Stopped serving metrics on %s: %s", listener.Addr(), err)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabelValue(value string) string {
+	return `"` + labelValueEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Requests.", "method", "code")
+	counter.Inc("GET", "200")
+	counter.Add(2, "PUT", "500")
+	counter.Inc("GET", "200")
+	gauge := NewGauge("test_running", "Running things.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram := NewHistogram("test_duration_seconds", "Durations.", "method")
+	histogram.Observe(0.003, "GET")
+	histogram.Observe(0.2, "GET")
+	histogram.Observe(1000, "GET")
+
+	require.Equal(t, float64(2), counter.Value("GET", "200"))
+	require.Equal(t, float64(1), gauge.Value())
+	require.Equal(t, uint64(3), histogram.Count("GET"))
+
+	buf := new(bytes.Buffer)
+	Write(buf)
+	out := buf.String()
+	require.Contains(t, out, `# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 2
+test_requests_total{method="PUT",code="500"} 2
+`)
+	require.Contains(t, out, `# TYPE test_running gauge
+test_running 1
+`)
+	require.Contains(t, out, `test_duration_seconds_bucket{method="GET",le="0.005"} 1
+`)
+	require.Contains(t, out, `test_duration_seconds_bucket{method="GET",le="0.25"} 2
+`)
+	require.Contains(t, out, `test_duration_seconds_bucket{method="GET",le="300"} 2
+test_duration_seconds_bucket{method="GET",le="+Inf"} 3
+test_duration_seconds_sum{method="GET"} 1000.203
+test_duration_seconds_count{method="GET"} 3
+`)
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	counter := NewCounter("test_escaped_total", "Escaped.", "path")
+	counter.Inc("a \"quoted\"\\path\n")
+	buf := new(bytes.Buffer)
+	counter.write(buf)
+	require.Contains(t, buf.String(), `test_escaped_total{path="a \"quoted\"\\path\n"} 1`)
+}
+
+func TestServe(t *testing.T) {
+	NewGauge("test_served", "Served.").Inc()
+	address, err := Serve("127.0.0.1:0")
+	require.NoError(t, err)
+	resp, err := http.Get("http://" + address + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "test_served 1\n")
+}
@@ -0,0 +1,331 @@
+// Package mlflow reads and writes runs in the layout of MLflow's file store,
+// which is what MLflow writes to the "mlruns" directory when it isn't
+// configured to use a tracking server.
+//
+// A run is a directory mlruns/<experiment ID>/<run ID> containing a
+// meta.yaml file, a file per param and tag, a file per metric with a line for
+// each recorded value, and an "artifacts" directory.
+package mlflow
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// Run statuses, as stored in meta.yaml
+const (
+	StatusRunning  = 1
+	StatusFinished = 3
+)
+
+// sourceTypeLocal is MLflow's SourceType.LOCAL
+const sourceTypeLocal = 4
+
+// Run is an MLflow run
+type Run struct {
+	ID           string
+	ExperimentID string
+	Name         string
+	User         string
+	Status       int
+	StartTime    time.Time
+	// EndTime is zero if the run hasn't finished
+	EndTime time.Time
+	Params  map[string]string
+	Metrics map[string][]*MetricPoint
+	Tags    map[string]string
+	// ArtifactsDir is the local directory containing the run's artifacts
+	ArtifactsDir string
+}
+
+// MetricPoint is a value of a metric at a step
+type MetricPoint struct {
+	Timestamp time.Time
+	Value     float64
+	Step      int64
+}
+
+type experimentMeta struct {
+	ArtifactLocation string `json:"artifact_location"`
+	ExperimentID     string `json:"experiment_id"`
+	LifecycleStage   string `json:"lifecycle_stage"`
+	Name             string `json:"name"`
+}
+
+type runMeta struct {
+	ArtifactURI    string        `json:"artifact_uri"`
+	EndTime        *int64        `json:"end_time"`
+	EntryPointName string        `json:"entry_point_name"`
+	ExperimentID   string        `json:"experiment_id"`
+	LifecycleStage string        `json:"lifecycle_stage"`
+	Name           string        `json:"name"`
+	RunID          string        `json:"run_id"`
+	RunUUID        string        `json:"run_uuid"`
+	SourceName     string        `json:"source_name"`
+	SourceType     int           `json:"source_type"`
+	SourceVersion  string        `json:"source_version"`
+	StartTime      int64         `json:"start_time"`
+	Status         int           `json:"status"`
+	Tags           []interface{} `json:"tags"`
+	UserID         string        `json:"user_id"`
+}
+
+// RunDir returns the directory of a run in an mlruns directory
+func RunDir(mlrunsDir, experimentID, runID string) string {
+	return filepath.Join(mlrunsDir, experimentID, runID)
+}
+
+// EnsureExperiment creates the meta.yaml for an MLflow experiment if it
+// doesn't already exist
+func EnsureExperiment(mlrunsDir, experimentID, name string) error {
+	dir := filepath.Join(mlrunsDir, experimentID)
+	metaPath := filepath.Join(dir, "meta.yaml")
+	if _, err := os.Stat(metaPath); err == nil {
+		return nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	return writeYAML(metaPath, &experimentMeta{
+		ArtifactLocation: "file://" + absDir,
+		ExperimentID:     experimentID,
+		LifecycleStage:   "active",
+		Name:             name,
+	})
+}
+
+// WriteRun writes a run's metadata, params, metrics, and tags to its run
+// directory in mlrunsDir, and returns the run directory. Artifacts should be
+// copied to the "artifacts" subdirectory of the run directory.
+func WriteRun(mlrunsDir string, run *Run) (string, error) {
+	dir := RunDir(mlrunsDir, run.ExperimentID, run.ID)
+	artifactsDir := filepath.Join(dir, "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create directory %s: %w", artifactsDir, err)
+	}
+	absArtifactsDir, err := filepath.Abs(artifactsDir)
+	if err != nil {
+		return "", err
+	}
+
+	meta := &runMeta{
+		ArtifactURI:    "file://" + absArtifactsDir,
+		ExperimentID:   run.ExperimentID,
+		LifecycleStage: "active",
+		Name:           run.Name,
+		RunID:          run.ID,
+		RunUUID:        run.ID,
+		SourceType:     sourceTypeLocal,
+		StartTime:      toMillis(run.StartTime),
+		Status:         run.Status,
+		Tags:           []interface{}{},
+		UserID:         run.User,
+	}
+	if !run.EndTime.IsZero() {
+		endTime := toMillis(run.EndTime)
+		meta.EndTime = &endTime
+	}
+	if err := writeYAML(filepath.Join(dir, "meta.yaml"), meta); err != nil {
+		return "", err
+	}
+
+	for key, value := range run.Params {
+		if err := writeFile(filepath.Join(dir, "params", key), value); err != nil {
+			return "", err
+		}
+	}
+	for key, value := range run.Tags {
+		if err := writeFile(filepath.Join(dir, "tags", key), value); err != nil {
+			return "", err
+		}
+	}
+	for key, points := range run.Metrics {
+		lines := []string{}
+		for _, point := range points {
+			lines = append(lines, fmt.Sprintf("%d %s %d", toMillis(point.Timestamp), strconv.FormatFloat(point.Value, 'g', -1, 64), point.Step))
+		}
+		if err := writeFile(filepath.Join(dir, "metrics", key), strings.Join(lines, "\n")+"\n"); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// ListRuns returns the run directories in dir. If dir is itself a run
+// directory, it is the only one returned, otherwise dir is assumed to be an
+// experiment directory and each of its runs is returned.
+func ListRuns(dir string) ([]string, error) {
+	if isRunDir(dir) {
+		return []string{dir}, nil
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", dir, err)
+	}
+	runDirs := []string{}
+	for _, info := range infos {
+		runDir := filepath.Join(dir, info.Name())
+		if info.IsDir() && isRunDir(runDir) {
+			runDirs = append(runDirs, runDir)
+		}
+	}
+	if len(runDirs) == 0 {
+		return nil, fmt.Errorf("%s is not an MLflow run or experiment directory", dir)
+	}
+	return runDirs, nil
+}
+
+func isRunDir(dir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "meta.yaml"))
+	if err != nil {
+		return false
+	}
+	meta := new(runMeta)
+	if err := yaml.Unmarshal(data, meta); err != nil {
+		return false
+	}
+	return meta.RunID != "" || meta.RunUUID != ""
+}
+
+// ReadRun reads a run from its run directory
+func ReadRun(dir string) (*Run, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "meta.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read MLflow run %s: %w", dir, err)
+	}
+	meta := new(runMeta)
+	if err := yaml.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", filepath.Join(dir, "meta.yaml"), err)
+	}
+
+	run := &Run{
+		ID:           meta.RunID,
+		ExperimentID: meta.ExperimentID,
+		Name:         meta.Name,
+		User:         meta.UserID,
+		Status:       meta.Status,
+		StartTime:    fromMillis(meta.StartTime),
+		Metrics:      map[string][]*MetricPoint{},
+		ArtifactsDir: filepath.Join(dir, "artifacts"),
+	}
+	if run.ID == "" {
+		run.ID = meta.RunUUID
+	}
+	if meta.EndTime != nil {
+		run.EndTime = fromMillis(*meta.EndTime)
+	}
+	if run.Params, err = readFiles(filepath.Join(dir, "params")); err != nil {
+		return nil, err
+	}
+	if run.Tags, err = readFiles(filepath.Join(dir, "tags")); err != nil {
+		return nil, err
+	}
+	metrics, err := readFiles(filepath.Join(dir, "metrics"))
+	if err != nil {
+		return nil, err
+	}
+	for key, content := range metrics {
+		points, err := parseMetric(content)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse metric %s in %s: %w", key, dir, err)
+		}
+		run.Metrics[key] = points
+	}
+	return run, nil
+}
+
+// parseMetric parses a metric file, which has a line for each value in the
+// format "<timestamp in milliseconds> <value> <step>". Old versions of
+// MLflow don't write the step.
+func parseMetric(content string) ([]*MetricPoint, error) {
+	points := []*MetricPoint{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("Invalid line: %q", scanner.Text())
+		}
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timestamp: %q", fields[0])
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value: %q", fields[1])
+		}
+		point := &MetricPoint{Timestamp: fromMillis(timestamp), Value: value}
+		if len(fields) == 3 {
+			if point.Step, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+				return nil, fmt.Errorf("Invalid step: %q", fields[2])
+			}
+		}
+		points = append(points, point)
+	}
+	return points, scanner.Err()
+}
+
+// readFiles reads every file under dir, keyed by its path relative to dir.
+// Keys can contain slashes, which MLflow stores as subdirectories.
+func readFiles(dir string) (map[string]string, error) {
+	result := map[string]string{}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return result, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(key)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", dir, err)
+	}
+	return result, nil
+}
+
+func writeFile(path string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeYAML(path string, obj interface{}) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, string(data))
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
@@ -0,0 +1,68 @@
+package mlflow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAndReadRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	run := &Run{
+		ID:           "abc123",
+		ExperimentID: "0",
+		Name:         "my-run",
+		User:         "andreas",
+		Status:       StatusFinished,
+		StartTime:    start,
+		EndTime:      start.Add(time.Minute),
+		Params:       map[string]string{"lr": "0.01"},
+		Metrics: map[string][]*MetricPoint{
+			"loss": {
+				{Timestamp: start.Add(time.Second), Value: 0.5, Step: 1},
+				{Timestamp: start.Add(2 * time.Second), Value: 0.25, Step: 2},
+			},
+		},
+		Tags: map[string]string{"mlflow.runName": "my-run"},
+	}
+	require.NoError(t, EnsureExperiment(dir, "0", "Default"))
+	runDir, err := WriteRun(dir, run)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "0", "abc123"), runDir)
+
+	data, err := ioutil.ReadFile(filepath.Join(runDir, "metrics", "loss"))
+	require.NoError(t, err)
+	require.Equal(t, "1577934246000 0.5 1\n1577934247000 0.25 2\n", string(data))
+
+	runs, err := ListRuns(filepath.Join(dir, "0"))
+	require.NoError(t, err)
+	require.Equal(t, []string{runDir}, runs)
+	runs, err = ListRuns(runDir)
+	require.NoError(t, err)
+	require.Equal(t, []string{runDir}, runs)
+
+	actual, err := ReadRun(runDir)
+	require.NoError(t, err)
+	run.ArtifactsDir = filepath.Join(runDir, "artifacts")
+	require.Equal(t, run, actual)
+}
+
+func TestParseMetric(t *testing.T) {
+	points, err := parseMetric("1577934246000 0.5 1\n1577934247000 2\n")
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	require.Equal(t, 0.5, points[0].Value)
+	require.Equal(t, int64(1), points[0].Step)
+	require.Equal(t, int64(0), points[1].Step)
+
+	_, err = parseMetric("1577934246000 nope 1\n")
+	require.Error(t, err)
+}
@@ -0,0 +1,225 @@
+// +build fuse
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+// Mount serves proj's experiments and checkpoints at mountpoint until it is
+// unmounted
+func Mount(proj *project.Project, mountpoint string, opts Options) error {
+	mountOptions := []fuse.MountOption{
+		fuse.ReadOnly(),
+		fuse.FSName("replicate"),
+		fuse.Subtype("replicate"),
+	}
+	if opts.AllowOther {
+		mountOptions = append(mountOptions, fuse.AllowOther())
+	}
+	conn, err := fuse.Mount(mountpoint, mountOptions...)
+	if err != nil {
+		return fmt.Errorf("Failed to mount %s: %w", mountpoint, err)
+	}
+	defer conn.Close()
+	if err := fs.Serve(conn, &filesystem{sources: newSources(proj, opts.CacheDir)}); err != nil {
+		return fmt.Errorf("Failed to serve %s: %w", mountpoint, err)
+	}
+	<-conn.Ready
+	return conn.MountError
+}
+
+// Unmount unmounts the repository at mountpoint, which makes Mount return
+func Unmount(mountpoint string) error {
+	return fuse.Unmount(mountpoint)
+}
+
+type filesystem struct {
+	sources *sources
+}
+
+func (f *filesystem) Root() (fs.Node, error) {
+	return rootDir{sources: f.sources}, nil
+}
+
+// rootDir has the experiments and checkpoints directories in it
+type rootDir struct {
+	sources *sources
+}
+
+func (d rootDir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Inode = 1
+	attr.Mode = os.ModeDir | 0555
+	return nil
+}
+
+func (d rootDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == experimentsDir || name == checkpointsDir {
+		return sourcesDir{sources: d.sources, name: name}, nil
+	}
+	return nil, fuse.ENOENT
+}
+
+func (d rootDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return []fuse.Dirent{
+		{Name: checkpointsDir, Type: fuse.DT_Dir},
+		{Name: experimentsDir, Type: fuse.DT_Dir},
+	}, nil
+}
+
+// sourcesDir has a directory in it for each experiment or checkpoint
+type sourcesDir struct {
+	sources *sources
+	name    string
+}
+
+func (d sourcesDir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = os.ModeDir | 0555
+	return nil
+}
+
+func (d sourcesDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	srcs, err := d.sources.list(d.name)
+	if err != nil {
+		return nil, readError(err)
+	}
+	src, ok := srcs[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return &dir{src: src}, nil
+}
+
+func (d sourcesDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	srcs, err := d.sources.list(d.name)
+	if err != nil {
+		return nil, readError(err)
+	}
+	dirents := make([]fuse.Dirent, 0, len(srcs))
+	for id := range srcs {
+		dirents = append(dirents, fuse.Dirent{Name: id, Type: fuse.DT_Dir})
+	}
+	return dirents, nil
+}
+
+// dir is a directory in an experiment or checkpoint. n is nil until its
+// files have been listed.
+type dir struct {
+	src *source
+	n   *node
+}
+
+func (d *dir) node() (*node, error) {
+	if d.n != nil {
+		return d.n, nil
+	}
+	return d.src.root()
+}
+
+func (d *dir) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = os.ModeDir | 0555
+	attr.Mtime = d.src.created()
+	return nil
+}
+
+func (d *dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	n, err := d.node()
+	if err != nil {
+		return nil, readError(err)
+	}
+	child, ok := n.children[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	if child.isDir() {
+		return &dir{src: d.src, n: child}, nil
+	}
+	return &file{src: d.src, n: child}, nil
+}
+
+func (d *dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	n, err := d.node()
+	if err != nil {
+		return nil, readError(err)
+	}
+	dirents := []fuse.Dirent{}
+	for _, name := range n.childNames() {
+		dirent := fuse.Dirent{Name: name, Type: fuse.DT_File}
+		if n.children[name].isDir() {
+			dirent.Type = fuse.DT_Dir
+		}
+		dirents = append(dirents, dirent)
+	}
+	return dirents, nil
+}
+
+// file is a file in an experiment or checkpoint
+type file struct {
+	src *source
+	n   *node
+}
+
+func (f *file) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = 0444
+	attr.Mtime = f.src.created()
+	// Files whose size isn't known are 0 bytes until they are opened
+	if size := f.src.size(f.n); size > 0 {
+		attr.Size = uint64(size)
+	}
+	return nil
+}
+
+func (f *file) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, fuse.Errno(syscall.EROFS)
+	}
+	sizeKnown := f.src.size(f.n) >= 0
+	localPath, err := f.src.fetch(f.n)
+	if err != nil {
+		return nil, readError(err)
+	}
+	fh, err := os.Open(localPath)
+	if err != nil {
+		return nil, readError(err)
+	}
+	// The kernel doesn't read past the size it was told, so reads of files
+	// whose size wasn't known go straight to the file
+	if !sizeKnown {
+		resp.Flags |= fuse.OpenDirectIO
+	}
+	return &fileHandle{f: fh}, nil
+}
+
+type fileHandle struct {
+	f *os.File
+}
+
+func (h *fileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	buf := make([]byte, req.Size)
+	n, err := h.f.ReadAt(buf, req.Offset)
+	if err != nil && err != io.EOF {
+		return readError(err)
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+func (h *fileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return h.f.Close()
+}
+
+// readError logs err, because programs reading the mount only see EIO
+func readError(err error) error {
+	console.Warn("%s", err)
+	return fuse.EIO
+}
@@ -0,0 +1,263 @@
+// Package mount serves a project's experiments and checkpoints as a
+// read-only filesystem, so their files can be browsed and loaded with normal
+// tools without checking everything out.
+//
+// The filesystem has a directory in experiments/ for each experiment, with
+// the files that were saved when it was created, and a directory in
+// checkpoints/ for each checkpoint, with its files overlaid on its
+// experiment's in the same way as `replicate checkout`. Listing a directory
+// only downloads the list of files. Each file is downloaded the first time it
+// is opened, which only downloads the parts of an indexed tarball that it is
+// in, and it is kept in the cache directory until the repository is
+// unmounted.
+//
+// The FUSE filesystem itself is only built with the fuse build tag, because
+// it needs FUSE to be installed to run.
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+const (
+	experimentsDir = "experiments"
+	checkpointsDir = "checkpoints"
+)
+
+// Options are how a repository is mounted
+type Options struct {
+	// CacheDir is where files are downloaded to when they are opened
+	CacheDir string
+	// AllowOther lets users other than the one who mounted it read it
+	AllowOther bool
+}
+
+// node is a directory or a file in an experiment's or checkpoint's directory
+type node struct {
+	// children is nil if the node is a file
+	children map[string]*node
+	// filePath is the path of a file in the experiment or checkpoint, and
+	// size is -1 if it isn't known
+	filePath string
+	size     int64
+}
+
+func (n *node) isDir() bool {
+	return n.children != nil
+}
+
+// childNames returns the names of the node's children, sorted
+func (n *node) childNames() []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTree returns the directories and files of the files with sizes
+func newTree(sizes map[string]int64) *node {
+	root := &node{children: map[string]*node{}}
+	for filePath, size := range sizes {
+		dir := root
+		parts := strings.Split(path.Clean(filePath), "/")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := dir.children[part]
+			if !ok || !child.isDir() {
+				child = &node{children: map[string]*node{}}
+				dir.children[part] = child
+			}
+			dir = child
+		}
+		name := parts[len(parts)-1]
+		// A file can't be a directory too, so the directory wins
+		if existing, ok := dir.children[name]; ok && existing.isDir() {
+			continue
+		}
+		dir.children[name] = &node{filePath: filePath, size: size}
+	}
+	return root
+}
+
+// source is an experiment or a checkpoint, whose files are in a directory
+type source struct {
+	proj       *project.Project
+	experiment *project.Experiment
+	// checkpoint is nil if it is the experiment's directory
+	checkpoint *project.Checkpoint
+	cacheDir   string
+
+	mu   sync.Mutex
+	tree *node
+	// fetching are the files that are being downloaded, which are closed
+	// when they are done
+	fetching map[string]chan struct{}
+}
+
+func newSource(proj *project.Project, experiment *project.Experiment, checkpoint *project.Checkpoint, cacheDir string) *source {
+	return &source{
+		proj:       proj,
+		experiment: experiment,
+		checkpoint: checkpoint,
+		cacheDir:   cacheDir,
+		fetching:   map[string]chan struct{}{},
+	}
+}
+
+func (s *source) id() string {
+	if s.checkpoint != nil {
+		return s.checkpoint.ID
+	}
+	return s.experiment.ID
+}
+
+// created is when the experiment or checkpoint was created
+func (s *source) created() time.Time {
+	if s.checkpoint != nil {
+		return s.checkpoint.Created
+	}
+	return s.experiment.Created
+}
+
+// root returns the directory of the source's files. The files are listed
+// the first time it is called.
+func (s *source) root() (*node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tree != nil {
+		return s.tree, nil
+	}
+	sizes, err := s.proj.CheckpointFileSizes(s.checkpoint, s.experiment)
+	if err != nil {
+		return nil, err
+	}
+	s.tree = newTree(sizes)
+	return s.tree, nil
+}
+
+// size returns the size of the file n, which is -1 if it isn't known until
+// it is downloaded
+func (s *source) size(n *node) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return n.size
+}
+
+// fetch returns the local path of the file n, downloading it if it hasn't
+// been already. If another read is already downloading it, it waits for that
+// instead.
+func (s *source) fetch(n *node) (string, error) {
+	localPath := filepath.Join(s.cacheDir, s.id(), filepath.FromSlash(n.filePath))
+	for {
+		s.mu.Lock()
+		if _, err := os.Stat(localPath); err == nil {
+			s.mu.Unlock()
+			return localPath, nil
+		}
+		done, ok := s.fetching[n.filePath]
+		if !ok {
+			done = make(chan struct{})
+			s.fetching[n.filePath] = done
+			s.mu.Unlock()
+			err := s.download(n, localPath)
+			s.mu.Lock()
+			delete(s.fetching, n.filePath)
+			close(done)
+			if err == nil {
+				// Now it is known, if it wasn't before
+				var info os.FileInfo
+				if info, err = os.Stat(localPath); err == nil {
+					n.size = info.Size()
+				}
+			}
+			s.mu.Unlock()
+			if err != nil {
+				return "", err
+			}
+			return localPath, nil
+		}
+		s.mu.Unlock()
+		<-done
+	}
+}
+
+// download writes the file n to localPath. It is written to a temporary file
+// first, so a file that failed to download isn't mistaken for a whole one.
+func (s *source) download(n *node, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	tempPath := localPath + ".download"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	err = s.proj.CopyFile(s.checkpoint, s.experiment, n.filePath, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("Failed to download %s: %w", n.filePath, err)
+	}
+	return os.Rename(tempPath, localPath)
+}
+
+// sources are the experiments and checkpoints in a project, each of which is
+// only made once, so their files are only listed once
+type sources struct {
+	proj     *project.Project
+	cacheDir string
+
+	mu   sync.Mutex
+	byID map[string]*source
+}
+
+func newSources(proj *project.Project, cacheDir string) *sources {
+	return &sources{proj: proj, cacheDir: cacheDir, byID: map[string]*source{}}
+}
+
+func (s *sources) get(experiment *project.Experiment, checkpoint *project.Checkpoint) *source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := experiment.ID
+	if checkpoint != nil {
+		id = checkpoint.ID
+	}
+	src, ok := s.byID[id]
+	if !ok {
+		src = newSource(s.proj, experiment, checkpoint, s.cacheDir)
+		s.byID[id] = src
+	}
+	return src
+}
+
+// list returns the sources in dir, which is experimentsDir or
+// checkpointsDir, by ID
+func (s *sources) list(dir string) (map[string]*source, error) {
+	experiments, err := s.proj.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]*source{}
+	for _, exp := range experiments {
+		if dir == experimentsDir {
+			result[exp.ID] = s.get(exp, nil)
+			continue
+		}
+		for _, chk := range exp.Checkpoints {
+			result[chk.ID] = s.get(exp, chk)
+		}
+	}
+	return result, nil
+}
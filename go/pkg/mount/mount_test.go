@@ -0,0 +1,100 @@
+package mount
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestNewTree(t *testing.T) {
+	root := newTree(map[string]int64{
+		"train.py":            10,
+		"model/weights.pt":    -1,
+		"model/config/a.json": 3,
+	})
+	require.Equal(t, []string{"model", "train.py"}, root.childNames())
+	require.False(t, root.children["train.py"].isDir())
+	require.Equal(t, int64(10), root.children["train.py"].size)
+
+	model := root.children["model"]
+	require.True(t, model.isDir())
+	require.Equal(t, []string{"config", "weights.pt"}, model.childNames())
+	require.Equal(t, "model/weights.pt", model.children["weights.pt"].filePath)
+	require.Equal(t, int64(-1), model.children["weights.pt"].size)
+	require.Equal(t, "model/config/a.json", model.children["config"].children["a.json"].filePath)
+}
+
+func TestSourceFetch(t *testing.T) {
+	projectDir, err := files.TempDir("test-mount")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	cacheDir, err := files.TempDir("test-mount-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := project.NewProject(repo, projectDir)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights"), 0644))
+	exp, err := proj.CreateExperiment(project.CreateExperimentArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(project.CreateCheckpointArgs{Experiment: exp, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	srcs := newSources(project.NewProject(repo, projectDir), cacheDir)
+	checkpoints, err := srcs.list(checkpointsDir)
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 1)
+	src := checkpoints[chk.ID]
+	require.NotNil(t, src)
+	// The same experiment or checkpoint is always the same source
+	require.Same(t, src, srcs.get(src.experiment, src.checkpoint))
+
+	// The checkpoint's files are overlaid on the experiment's
+	root, err := src.root()
+	require.NoError(t, err)
+	require.Contains(t, root.childNames(), "train.py")
+	require.Contains(t, root.childNames(), "model")
+
+	// Reads of the same file at the same time download it once
+	weights := root.children["model"].children["weights.pt"]
+	var wg sync.WaitGroup
+	localPaths := make([]string, 4)
+	for i := range localPaths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			localPath, err := src.fetch(weights)
+			require.NoError(t, err)
+			localPaths[i] = localPath
+		}(i)
+	}
+	wg.Wait()
+	for _, localPath := range localPaths {
+		require.Equal(t, filepath.Join(cacheDir, chk.ID, "model", "weights.pt"), localPath)
+	}
+	contents, err := ioutil.ReadFile(localPaths[0])
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(contents))
+	require.Equal(t, int64(len("weights")), src.size(weights))
+
+	// Files that aren't there fail without leaving anything in the cache
+	_, err = src.fetch(&node{filePath: "missing.txt", size: -1})
+	require.Error(t, err)
+	_, err = os.Stat(filepath.Join(cacheDir, chk.ID, "missing.txt.download"))
+	require.True(t, os.IsNotExist(err))
+}
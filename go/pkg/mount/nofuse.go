@@ -0,0 +1,21 @@
+// +build !fuse
+
+package mount
+
+import (
+	"fmt"
+
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+// Mount returns an error, because this version of Replicate was built
+// without FUSE
+func Mount(proj *project.Project, mountpoint string, opts Options) error {
+	return fmt.Errorf("This version of Replicate was built without FUSE support, so it can't mount repositories. Build it with 'make build TAGS=fuse' on Linux or macOS, which needs FUSE installed to run.")
+}
+
+// Unmount does nothing, because this version of Replicate can't mount
+// repositories
+func Unmount(mountpoint string) error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package project
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// Alert is an alert rule that an experiment's metrics triggered
+type Alert struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	// CheckpointID is the checkpoint whose metrics triggered it
+	CheckpointID string    `json:"checkpoint_id"`
+	Triggered    time.Time `json:"triggered"`
+}
+
+// SetAlerts sets the alert rules that are checked against the metrics of each
+// checkpoint
+func (p *Project) SetAlerts(rules []*config.Alert) {
+	p.alertRules = rules
+}
+
+// CheckAlerts checks the alert rules against chk, a new checkpoint of exp.
+// The alerts it triggers are added to exp.Alerts, so they are saved with it,
+// and returned, so the on_alert hook can be run for them. Rules that have
+// already triggered for exp aren't checked again.
+func (p *Project) CheckAlerts(exp *Experiment, chk *Checkpoint) []*Alert {
+	triggered := []*Alert{}
+	for _, rule := range p.alertRules {
+		name := rule.DisplayName()
+		if exp.HasAlert(name) {
+			continue
+		}
+		message, ok := checkAlert(rule, exp, chk)
+		if !ok {
+			continue
+		}
+		alert := &Alert{Name: name, Message: message, CheckpointID: chk.ID, Triggered: time.Now().UTC()}
+		console.Warn("Alert %s for experiment %s, checkpoint %s: %s", name, exp.ShortID(), chk.ShortID(), message)
+		exp.Alerts = append(exp.Alerts, alert)
+		triggered = append(triggered, alert)
+	}
+	return triggered
+}
+
+// HasAlert returns whether the alert called name has triggered for e
+func (e *Experiment) HasAlert(name string) bool {
+	for _, alert := range e.Alerts {
+		if alert.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RunAlertHook runs the on_alert hook, if there is one, for an alert that
+// chk triggered
+func (p *Project) RunAlertHook(exp *Experiment, chk *Checkpoint, alert *Alert) error {
+	if p.hooks == nil || p.hooks.OnAlert == "" {
+		return nil
+	}
+	env, err := p.experimentHookEnv(exp)
+	if err != nil {
+		return err
+	}
+	env = append(env,
+		"REPLICATE_CHECKPOINT_ID="+chk.ID,
+		"REPLICATE_CHECKPOINT_STEP="+strconv.FormatInt(chk.Step, 10),
+		"REPLICATE_ALERT_NAME="+alert.Name,
+		"REPLICATE_ALERT_MESSAGE="+alert.Message,
+	)
+	return p.runHook("on_alert", p.hooks.OnAlert, env)
+}
+
+// checkAlert returns whether rule is triggered by chk, and a message saying
+// why
+func checkAlert(rule *config.Alert, exp *Experiment, chk *Checkpoint) (string, bool) {
+	value, ok := metricFloat(chk.Metrics, rule.Metric)
+	if !ok {
+		return "", false
+	}
+	switch rule.Condition {
+	case config.AlertNaN:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Sprintf("%s is %s", rule.Metric, formatMetric(value)), true
+		}
+	case config.AlertAbove:
+		if value > rule.Value {
+			return fmt.Sprintf("%s is %s, above %s", rule.Metric, formatMetric(value), formatMetric(rule.Value)), true
+		}
+	case config.AlertBelow:
+		if value < rule.Value {
+			return fmt.Sprintf("%s is %s, below %s", rule.Metric, formatMetric(value), formatMetric(rule.Value)), true
+		}
+	case config.AlertNotImproved:
+		return checkNotImproved(rule, exp, chk)
+	}
+	return "", false
+}
+
+// checkNotImproved returns whether none of the last rule.Checkpoints
+// checkpoints of exp, up to chk, are better than the best one before them
+func checkNotImproved(rule *config.Alert, exp *Experiment, chk *Checkpoint) (string, bool) {
+	history := []float64{}
+	for _, c := range checkpointsUpTo(exp, chk) {
+		if value, ok := metricFloat(c.Metrics, rule.Metric); ok && !math.IsNaN(value) {
+			history = append(history, value)
+		}
+	}
+	if len(history) <= rule.Checkpoints {
+		return "", false
+	}
+	better := func(a, b float64) bool {
+		if MetricGoal(rule.Goal) == GoalMaximize {
+			return a > b
+		}
+		return a < b
+	}
+	before := history[:len(history)-rule.Checkpoints]
+	best := before[0]
+	for _, value := range before[1:] {
+		if better(value, best) {
+			best = value
+		}
+	}
+	for _, value := range history[len(history)-rule.Checkpoints:] {
+		if better(value, best) {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("%s hasn't improved on %s in %d checkpoints", rule.Metric, formatMetric(best), rule.Checkpoints), true
+}
+
+// checkpointsUpTo returns the checkpoints of exp created up to and including
+// chk, in the order they were created
+func checkpointsUpTo(exp *Experiment, chk *Checkpoint) []*Checkpoint {
+	checkpoints := []*Checkpoint{}
+	for _, c := range exp.Checkpoints {
+		if c.ID != chk.ID && !c.Created.After(chk.Created) {
+			checkpoints = append(checkpoints, c)
+		}
+	}
+	sort.SliceStable(checkpoints, func(i, j int) bool { return checkpoints[i].Created.Before(checkpoints[j].Created) })
+	return append(checkpoints, chk)
+}
+
+// metricFloat returns the metric called name as a float, if it is a number
+func metricFloat(metrics param.ValueMap, name string) (float64, bool) {
+	value, ok := metrics[name]
+	if !ok {
+		return 0, false
+	}
+	switch value.Type() {
+	case param.TypeInt:
+		return float64(value.IntVal()), true
+	case param.TypeFloat:
+		return value.FloatVal(), true
+	}
+	return 0, false
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,71 @@
+package project
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+func TestCheckAlerts(t *testing.T) {
+	proj := NewProject(nil, "")
+	proj.SetAlerts([]*config.Alert{
+		{Metric: "loss", Condition: config.AlertNaN},
+		{Name: "loss-too-high", Metric: "loss", Condition: config.AlertAbove, Value: 10},
+		{Metric: "accuracy", Condition: config.AlertNotImproved, Checkpoints: 2, Goal: "maximize"},
+	})
+	exp := &Experiment{ID: "1eeeeeeeee"}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	checkpoint := func(loss float64, accuracy float64) []*Alert {
+		chk := &Checkpoint{
+			ID:      created.Format("150405") + "cccc",
+			Created: created,
+			Metrics: param.ValueMap{"loss": param.Float(loss), "accuracy": param.Float(accuracy)},
+		}
+		created = created.Add(time.Minute)
+		exp.Checkpoints = append(exp.Checkpoints, chk)
+		return proj.CheckAlerts(exp, chk)
+	}
+
+	require.Empty(t, checkpoint(1, 0.5))
+	require.Empty(t, checkpoint(0.8, 0.6))
+
+	alerts := checkpoint(20, 0.7)
+	require.Len(t, alerts, 1)
+	require.Equal(t, "loss-too-high", alerts[0].Name)
+	require.Equal(t, "loss is 20, above 10", alerts[0].Message)
+	require.Equal(t, exp.Checkpoints[2].ID, alerts[0].CheckpointID)
+
+	// Rules only trigger once per experiment
+	require.Empty(t, checkpoint(30, 0.65))
+
+	alerts = checkpoint(math.NaN(), 0.6)
+	require.Len(t, alerts, 2)
+	require.Equal(t, "loss-nan", alerts[0].Name)
+	require.Equal(t, "loss is NaN", alerts[0].Message)
+	require.Equal(t, "accuracy-not-improved", alerts[1].Name)
+	require.Equal(t, "accuracy hasn't improved on 0.7 in 2 checkpoints", alerts[1].Message)
+
+	require.Len(t, exp.Alerts, 3)
+	require.True(t, exp.HasAlert("loss-nan"))
+	require.False(t, exp.HasAlert("loss-below"))
+}
+
+func TestCheckAlertsIgnoresMissingMetrics(t *testing.T) {
+	proj := NewProject(nil, "")
+	proj.SetAlerts([]*config.Alert{
+		{Metric: "loss", Condition: config.AlertBelow, Value: 0},
+	})
+	chk := &Checkpoint{ID: "2ccccccccc", Metrics: param.ValueMap{"loss": param.String("high")}}
+	exp := &Experiment{ID: "1eeeeeeeee", Checkpoints: []*Checkpoint{chk}}
+	require.Empty(t, proj.CheckAlerts(exp, chk))
+
+	chk = &Checkpoint{ID: "3ccccccccc"}
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	require.Empty(t, proj.CheckAlerts(exp, chk))
+	require.Empty(t, exp.Alerts)
+}
@@ -0,0 +1,95 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Experiments that aren't needed any more, but should be kept, can be
+// archived: the tarballs of the experiment and its checkpoints are moved to
+// an archive storage class, which is much cheaper to keep them in. Their
+// metadata stays where it is, so they are still listed and shown, and
+// checking them out restores them first if the storage class needs it.
+//
+// Chunks and large files are left where they are, because other checkpoints
+// might share them.
+
+// maxArchiveWorkers is how many files are archived at once
+const maxArchiveWorkers = 8
+
+// ArchiveRecord is when an experiment was archived, and the storage class
+// its files were moved to
+type ArchiveRecord struct {
+	Time         time.Time `json:"time"`
+	StorageClass string    `json:"storage_class"`
+}
+
+// ArchiveExperiment moves the tarballs of exp and its checkpoints to
+// storageClass, or the repository's default archive storage class if it is
+// empty, and records that it is archived in its metadata. It returns the
+// number of files that were archived.
+func (p *Project) ArchiveExperiment(exp *Experiment, storageClass string) (int, error) {
+	archiver, ok := repository.AsArchiver(p.repository)
+	if !ok {
+		return 0, fmt.Errorf("Only S3 and Google Cloud Storage repositories can be archived, and the repository is %s", p.repository.RootURL())
+	}
+	running, err := p.ExperimentIsRunning(exp.ID)
+	if err != nil {
+		return 0, err
+	}
+	if running {
+		return 0, fmt.Errorf("Experiment %s is running, so it can't be archived", exp.ShortID())
+	}
+	lock, err := p.lockForMaintenance("archiving experiment " + exp.ShortID())
+	if err != nil {
+		return 0, err
+	}
+	defer releaseLock(lock)
+
+	tarPaths := []string{exp.StorageTarPath()}
+	for _, chk := range exp.Checkpoints {
+		tarPaths = append(tarPaths, checkpointTarPaths(chk.StoragePath, chk.ID)...)
+	}
+	var mu sync.Mutex
+	archived := []string{}
+	movedTo := storageClass
+	queue := concurrency.NewWorkerQueue(context.Background(), maxArchiveWorkers)
+	for _, tarPath := range tarPaths {
+		// Variables used in closure
+		tarPath := tarPath
+		err := queue.Go(func() error {
+			class, err := archiver.Archive(tarPath, storageClass)
+			if err != nil {
+				// Not every experiment and checkpoint has files, or every tree
+				if errors.IsDoesNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			archived = append(archived, tarPath)
+			movedTo = class
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return 0, err
+	}
+
+	exp.Archived = &ArchiveRecord{Time: time.Now().UTC(), StorageClass: movedTo}
+	if _, err := p.SaveExperiment(exp, true); err != nil {
+		return 0, err
+	}
+	p.audit(&AuditRecord{Operation: AuditArchive, Experiments: []string{exp.ID}, Paths: archived})
+	return len(archived), nil
+}
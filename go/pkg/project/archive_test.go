@@ -0,0 +1,76 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// storageClassRepository is a disk repository that records the storage class
+// each object is moved to
+type storageClassRepository struct {
+	*repository.DiskRepository
+	mu      sync.Mutex
+	classes map[string]string
+}
+
+func (r *storageClassRepository) Archive(p string, storageClass string) (string, error) {
+	if _, err := r.Get(p); err != nil {
+		return "", err
+	}
+	if storageClass == "" {
+		storageClass = "GLACIER"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.classes[p] = storageClass
+	return storageClass, nil
+}
+
+func TestArchiveExperiment(t *testing.T) {
+	projectDir, err := files.TempDir("test-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	disk, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model.pt"), []byte("weights"), 0644))
+
+	// Repositories without archive storage classes can't be archived
+	proj := NewProject(disk, projectDir)
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model.pt"}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	_, err = proj.ArchiveExperiment(exp, "")
+	require.Error(t, err)
+
+	repo := &storageClassRepository{DiskRepository: disk, classes: map[string]string{}}
+	proj = NewProject(repo, projectDir)
+	exp, err = proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	n, err := proj.ArchiveExperiment(exp, "DEEP_ARCHIVE")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, map[string]string{
+		exp.StorageTarPath(): "DEEP_ARCHIVE",
+		chk.StorageTarPath(): "DEEP_ARCHIVE",
+	}, repo.classes)
+
+	// It is recorded in the metadata, which stays where it is
+	proj = NewProject(disk, projectDir)
+	exp, err = proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.NotNil(t, exp.Archived)
+	require.Equal(t, "DEEP_ARCHIVE", exp.Archived.StorageClass)
+	require.Len(t, exp.Checkpoints, 1)
+}
@@ -0,0 +1,108 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Operations that change what is in the repository are recorded in an audit
+// log, so teams can see who did what. Object storage can't append to files,
+// so each record is its own file, audit/<time>-<random>.json, and the log is
+// all of them in order of their names.
+
+// AuditDir is the directory in the repository that the audit log is in
+const AuditDir = "audit"
+
+// The operations recorded in the audit log
+const (
+	AuditCreateExperiment  = "create_experiment"
+	AuditDeleteExperiment  = "delete_experiment"
+	AuditDeleteCheckpoints = "delete_checkpoints"
+	AuditTrash             = "trash"
+	AuditRestore           = "restore"
+	AuditEmptyTrash        = "empty_trash"
+	AuditPrune             = "prune"
+	AuditQuarantine        = "quarantine"
+	AuditPromote           = "promote"
+	AuditSnapshot          = "snapshot"
+	AuditRestoreSnapshot   = "restore_snapshot"
+	AuditMigrateLayout     = "migrate_layout"
+	AuditArchive           = "archive"
+)
+
+// AuditRecord is an operation in the audit log
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Command   string    `json:"command"`
+	Operation string    `json:"operation"`
+
+	// The IDs of the experiments and checkpoints, and the paths of other
+	// objects, that the operation was on
+	Experiments []string `json:"experiments,omitempty"`
+	Checkpoints []string `json:"checkpoints,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// audit adds a record of an operation to the audit log. The operation has
+// already happened, so failing to record it is a warning, not an error.
+func (p *Project) audit(record *AuditRecord) {
+	record.Time = time.Now().UTC()
+	if currentUser, err := user.Current(); err == nil {
+		record.User = currentUser.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		record.Host = host
+	}
+	if record.Command == "" {
+		record.Command = strings.Join(os.Args, " ")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		console.Warn("Failed to record %s in the audit log: %s", record.Operation, err)
+		return
+	}
+	// The time comes first, so records sort in the order they happened
+	name := fmt.Sprintf("%s/%s-%s.json", AuditDir, record.Time.Format("20060102T150405.000000000Z"), generateRandomID()[:8])
+	if err := p.repository.Put(name, data); err != nil {
+		console.Warn("Failed to record %s in the audit log: %s", record.Operation, err)
+	}
+}
+
+// AuditLog returns the last limit records in the audit log, oldest first. If
+// limit is 0, all of them are returned.
+func (p *Project) AuditLog(limit int) ([]*AuditRecord, error) {
+	paths, err := p.repository.List(AuditDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	if limit > 0 && len(paths) > limit {
+		paths = paths[len(paths)-limit:]
+	}
+	records := []*AuditRecord{}
+	for _, recordPath := range paths {
+		record := &AuditRecord{}
+		if err := loadFromPath(p.repository, recordPath, record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func checkpointIDs(chks []*Checkpoint) []string {
+	ids := []string{}
+	for _, chk := range chks {
+		ids = append(ids, chk.ID)
+	}
+	return ids
+}
@@ -0,0 +1,68 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := files.TempDir("test-audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(path.Join(dir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, dir)
+
+	records, err := proj.AuditLog(0)
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{Command: "train.py"}, false, nil, true)
+	require.NoError(t, err)
+	chk := &Checkpoint{ID: "1ccccccccc", Created: time.Now().UTC()}
+	exp.Checkpoints = []*Checkpoint{chk}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	_, err = proj.TrashCheckpoint(chk, exp)
+	require.NoError(t, err)
+	entry, err := proj.TrashEntryFromPrefix(chk.ID)
+	require.NoError(t, err)
+	require.NoError(t, proj.RestoreFromTrash(entry))
+	require.NoError(t, proj.DeleteExperiment(exp))
+
+	records, err = proj.AuditLog(0)
+	require.NoError(t, err)
+	operations := []string{}
+	for _, r := range records {
+		operations = append(operations, r.Operation)
+		require.False(t, r.Time.IsZero())
+	}
+	require.Equal(t, []string{AuditCreateExperiment, AuditTrash, AuditRestore, AuditDeleteExperiment}, operations)
+	require.Equal(t, "train.py", records[0].Command)
+	require.Equal(t, []string{exp.ID}, records[0].Experiments)
+	require.Equal(t, []string{chk.ID}, records[1].Checkpoints)
+
+	records, err = proj.AuditLog(2)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, AuditRestore, records[0].Operation)
+
+	// Pruning is a single record
+	old := &Experiment{ID: "2eeeeeeeee", Created: time.Now().UTC().Add(-100 * 24 * time.Hour), Config: &config.Config{}}
+	require.NoError(t, old.Save(repo))
+	items, err := proj.PlanPrune(&config.Retention{DeleteExperimentsAfterDays: 30}, time.Now().UTC())
+	require.NoError(t, err)
+	require.NoError(t, proj.Prune(items))
+	records, err = proj.AuditLog(1)
+	require.NoError(t, err)
+	require.Equal(t, AuditPrune, records[0].Operation)
+	require.Equal(t, []string{old.ID}, records[0].Experiments)
+}
@@ -0,0 +1,188 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Running experiments write lots of tiny objects: an event every time a
+// checkpoint is saved or metrics are logged, and a heartbeat every few
+// seconds. On S3 and GCS, each write is a request that costs as much as
+// writing megabytes, so the daemon batches them. Events are held for the
+// batch interval and all the events for each experiment are written as a
+// single event, which readers merge like any other. Heartbeats are written
+// at most once every heartbeatRefreshInterval, because readers tolerate
+// heartbeatMissTolerance of them being missed.
+//
+// Events that are being held aren't seen by other processes until they are
+// written, which is at most the batch interval later. This project flushes
+// them before it reads metadata, and the daemon flushes them when it exits.
+
+// maxBatchSize is how many bytes of events are held before they are
+// written, however recently the last ones were
+const maxBatchSize = 1024 * 1024
+
+// SetBatching sets how small metadata writes are batched. If batching is
+// nil, they are batched with the default interval. Projects that don't call
+// it write everything straight away.
+func (p *Project) SetBatching(batching *config.Batching) {
+	if batching == nil {
+		batching = &config.Batching{}
+	}
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	p.events.batchInterval = batching.Interval()
+}
+
+// batchEvent adds the event data to the batch of events for dir, and writes
+// the batches if they have got too big. p.events.mu must be held.
+func (p *Project) batchEvent(dir string, data []byte) error {
+	if p.events.batches == nil {
+		p.events.batches = map[string][][]byte{}
+	}
+	p.events.batches[dir] = append(p.events.batches[dir], data)
+	p.events.batchSize += len(data)
+	if p.events.batchSize >= maxBatchSize {
+		return p.flushBatches()
+	}
+	p.scheduleFlush()
+	return nil
+}
+
+// scheduleFlush writes the batches when the batch interval is up, unless
+// they are already due to be. p.events.mu must be held.
+func (p *Project) scheduleFlush() {
+	if p.events.flushTimer != nil {
+		return
+	}
+	p.events.flushTimer = time.AfterFunc(p.events.batchInterval, func() {
+		p.events.mu.Lock()
+		defer p.events.mu.Unlock()
+		p.events.flushTimer = nil
+		if err := p.flushBatches(); err != nil {
+			// They are still in the batches, so they are tried again
+			console.Warn("Failed to write batched metadata: %s", err)
+		}
+	})
+}
+
+// FlushEvents writes the events that are being held to be batched
+func (p *Project) FlushEvents() error {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	return p.flushBatches()
+}
+
+// flushBatches writes each batch of events. If any of them fail, they are
+// tried again when the batch interval is next up. p.events.mu must be held.
+func (p *Project) flushBatches() error {
+	if p.events.flushTimer != nil {
+		p.events.flushTimer.Stop()
+		p.events.flushTimer = nil
+	}
+	dirs := []string{}
+	for dir := range p.events.batches {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := p.flushBatch(dir); err != nil {
+			p.scheduleFlush()
+			return err
+		}
+	}
+	return nil
+}
+
+// flushBatch writes the batch of events for dir, if there is one, as a
+// single event. p.events.mu must be held.
+func (p *Project) flushBatch(dir string) error {
+	batch := p.events.batches[dir]
+	if len(batch) == 0 {
+		return nil
+	}
+	event, err := mergeBatch(dir, batch)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := p.putEvent(dir, data); err != nil {
+		return err
+	}
+	p.dropBatch(dir)
+	return nil
+}
+
+// dropBatch forgets the batch of events for dir, because it has been written
+// or what is in it has been saved some other way. p.events.mu must be held.
+func (p *Project) dropBatch(dir string) {
+	for _, data := range p.events.batches[dir] {
+		p.events.batchSize -= len(data)
+	}
+	delete(p.events.batches, dir)
+}
+
+// mergeBatch returns a single event with everything that was added in the
+// events in batch, which were written to dir
+func mergeBatch(dir string, batch [][]byte) (interface{}, error) {
+	if strings.HasPrefix(dir, metricEventsFolder+"/") {
+		merged := &metricSeriesFile{Series: MetricSeries{}}
+		for _, data := range batch {
+			event := &metricSeriesFile{}
+			if err := json.Unmarshal(data, event); err != nil {
+				return nil, fmt.Errorf("Parse error: %s", err)
+			}
+			for metric, points := range event.Series {
+				merged.Series[metric] = append(merged.Series[metric], points...)
+			}
+		}
+		return merged, nil
+	}
+	merged := &experimentEvent{}
+	for _, data := range batch {
+		event := &experimentEvent{}
+		if err := json.Unmarshal(data, event); err != nil {
+			return nil, fmt.Errorf("Parse error: %s", err)
+		}
+		merged.Checkpoints = append(merged.Checkpoints, event.Checkpoints...)
+		merged.Alerts = append(merged.Alerts, event.Alerts...)
+	}
+	return merged, nil
+}
+
+// heartbeatDue returns whether the heartbeat of the experiment with ID
+// experimentID should be written at now. If writes are batched, it is only
+// written once every heartbeatRefreshInterval, however often it is
+// refreshed.
+func (p *Project) heartbeatDue(experimentID string, now time.Time) bool {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	if p.events.batchInterval <= 0 {
+		return true
+	}
+	if last, ok := p.events.heartbeats[experimentID]; ok && now.Sub(last) < heartbeatRefreshInterval {
+		return false
+	}
+	if p.events.heartbeats == nil {
+		p.events.heartbeats = map[string]time.Time{}
+	}
+	p.events.heartbeats[experimentID] = now
+	return true
+}
+
+// forgetHeartbeat forgets when the heartbeat of the experiment with ID
+// experimentID was written, because it has stopped
+func (p *Project) forgetHeartbeat(experimentID string) {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	delete(p.events.heartbeats, experimentID)
+}
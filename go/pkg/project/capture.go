@@ -0,0 +1,70 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// The environment variables and random seeds that a run used are recorded
+// when an experiment is created, alongside its command, so it can be run
+// again in the same way.
+
+// SetEnvironment sets the glob patterns, such as "CUDA_*", of the
+// environment variables that are recorded when experiments are created
+func (p *Project) SetEnvironment(patterns []string) {
+	p.environment = patterns
+}
+
+// SetSeeds sets the names of the params or environment variables that are
+// recorded as random seeds when experiments are created
+func (p *Project) SetSeeds(seeds []string) {
+	p.seeds = seeds
+}
+
+// captureEnvironment returns the environment variables that match the
+// patterns set with SetEnvironment. Only variables that match are recorded,
+// so secrets such as credentials aren't saved by accident.
+func (p *Project) captureEnvironment() map[string]string {
+	return matchEnvironment(os.Environ(), p.environment)
+}
+
+// matchEnvironment returns the variables in environ, in the form
+// "NAME=value", whose names match one of patterns
+func matchEnvironment(environ []string, patterns []string) map[string]string {
+	env := map[string]string{}
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, pattern := range patterns {
+			// Patterns are validated when the config is loaded
+			if matched, _ := filepath.Match(pattern, parts[0]); matched {
+				env[parts[0]] = parts[1]
+				break
+			}
+		}
+	}
+	return env
+}
+
+// captureSeeds returns the values of the random seeds set with SetSeeds. A
+// seed is looked up in params first, then in the environment. Seeds that
+// aren't set aren't recorded.
+func (p *Project) captureSeeds(params param.ValueMap) map[string]string {
+	seeds := map[string]string{}
+	for _, name := range p.seeds {
+		if value, ok := params[name]; ok {
+			seeds[name] = value.String()
+		} else if value, ok := os.LookupEnv(name); ok {
+			seeds[name] = value
+		} else {
+			console.Debug("Random seed %s isn't a param or environment variable, so it isn't recorded", name)
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,40 @@
+package project
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+func TestMatchEnvironment(t *testing.T) {
+	environ := []string{
+		"CUDA_VISIBLE_DEVICES=0,1",
+		"CUDA_LAUNCH_BLOCKING=1",
+		"OMP_NUM_THREADS=4",
+		"AWS_SECRET_ACCESS_KEY=hunter2",
+		"EQUALS=a=b",
+	}
+	require.Equal(t, map[string]string{
+		"CUDA_VISIBLE_DEVICES": "0,1",
+		"CUDA_LAUNCH_BLOCKING": "1",
+		"OMP_NUM_THREADS":      "4",
+		"EQUALS":               "a=b",
+	}, matchEnvironment(environ, []string{"CUDA_*", "OMP_NUM_THREADS", "EQUALS"}))
+	require.Equal(t, map[string]string{}, matchEnvironment(environ, []string{}))
+}
+
+func TestCaptureSeeds(t *testing.T) {
+	os.Setenv("REPLICATE_TEST_SEED", "1234")
+	defer os.Unsetenv("REPLICATE_TEST_SEED")
+
+	proj := NewProject(nil, "")
+	proj.SetSeeds([]string{"seed", "REPLICATE_TEST_SEED", "missing"})
+	seeds := proj.captureSeeds(param.ValueMap{
+		"seed":          param.Int(42),
+		"learning_rate": param.Float(0.01),
+	})
+	require.Equal(t, map[string]string{"seed": "42", "REPLICATE_TEST_SEED": "1234"}, seeds)
+}
@@ -2,10 +2,14 @@ package project
 
 import (
 	"fmt"
+	"io"
+	"path"
 	"path/filepath"
+	"sort"
 
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
 )
 
 func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experiment, outputDir string, quiet bool) error {
@@ -21,10 +25,14 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 		}
 	}
 
-	if experiment.Path != "" {
+	// The experiment's files are code
+	if experiment.Path != "" && p.checkingOutTree(TreeCode) {
 		if !quiet {
 			console.Info("Copying files from experiment %s to %q...", experiment.ShortID(), filepath.Join(outputDir, experiment.Path))
 		}
+		if err := p.ensureRestored(experiment.StorageTarPath()); err != nil {
+			return err
+		}
 		if err := p.repository.GetPathTar(experiment.StorageTarPath(), outputDir); err != nil {
 			if errors.IsDoesNotExist(err) {
 				return errors.DoesNotExist(fmt.Sprintf("Experiment %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", experiment.ShortID(), experiment.StorageTarPath()))
@@ -40,13 +48,8 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 			console.Info("Copying files from checkpoint %s to %q...", checkpoint.ShortID(), filepath.Join(outputDir, checkpoint.Path))
 		}
 
-		if err := p.repository.GetPathTar(checkpoint.StorageTarPath(), outputDir); err != nil {
-			if errors.IsDoesNotExist(err) {
-				return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", checkpoint.ShortID(), checkpoint.StorageTarPath()))
-			} else {
-				return err
-
-			}
+		if err := p.checkoutCheckpointFiles(checkpoint, outputDir); err != nil {
+			return err
 		}
 	}
 
@@ -60,13 +63,44 @@ func (p *Project) CheckoutCheckpoint(checkpoint *Checkpoint, experiment *Experim
 	return nil
 }
 
+// checkoutCheckpointFiles extracts the files of checkpoint, without the files
+// of its experiment, to outputDir
+func (p *Project) checkoutCheckpointFiles(checkpoint *Checkpoint, outputDir string) error {
+	for _, tree := range checkpoint.StoredTrees() {
+		if !p.checkingOutTree(tree) {
+			continue
+		}
+		tarPath := checkpoint.TreeTarPath(tree)
+		if err := p.ensureRestored(tarPath); err != nil {
+			return err
+		}
+		if err := p.repository.GetPathTar(tarPath, outputDir); err != nil {
+			if errors.IsDoesNotExist(err) {
+				return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s is supposed to have files associated with it, but could not find the files at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", checkpoint.ShortID(), tarPath))
+			}
+			return err
+		}
+	}
+	if _, err := p.checkoutChunkedFiles(checkpoint, outputDir, ""); err != nil {
+		return err
+	}
+	if _, err := p.checkoutReferences(checkpoint, outputDir, ""); err != nil {
+		return err
+	}
+	return p.checkoutPointerFiles(checkpoint, outputDir, "")
+}
+
 // checkout all the files from an experiment or checkpoint
 func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Experiment, outputDir string, checkoutPath string) error {
 	// Extract the tarfile
 	experimentFilesExist := true
 	checkpointFilesExist := true
 
-	if err := p.repository.GetPathItemTar(filepath.Join("experiments", experiment.ID+".tar.gz"), checkoutPath, outputDir); err != nil {
+	if !p.checkingOutTree(TreeCode) {
+		experimentFilesExist = false
+	} else if err := p.ensureRestored(experiment.StorageTarPath()); err != nil {
+		return err
+	} else if err := p.getPathItemTar(experiment.StorageTarPath(), checkoutPath, outputDir); err != nil {
 		// Ignore does not exist errors
 		if errors.IsDoesNotExist(err) {
 			console.Debug("No experiment data found")
@@ -80,19 +114,42 @@ func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Ex
 
 	// Overlay checkpoint on top of experiment
 	if checkpoint != nil {
-
-		if err := p.repository.GetPathItemTar(filepath.Join("checkpoints", checkpoint.ID+".tar.gz"), checkoutPath, outputDir); err != nil {
-			if errors.IsDoesNotExist(err) {
-				console.Debug("No checkpoint data found")
-				checkpointFilesExist = false
-			} else {
+		checkpointFilesExist = false
+		for _, tree := range checkpoint.StoredTrees() {
+			if !p.checkingOutTree(tree) {
+				continue
+			}
+			tarPath := checkpoint.TreeTarPath(tree)
+			if err := p.ensureRestored(tarPath); err != nil {
 				return err
-
 			}
-		} else {
+			if err := p.getPathItemTar(tarPath, checkoutPath, outputDir); err != nil {
+				if errors.IsDoesNotExist(err) {
+					console.Debug("No checkpoint data found in %s", tarPath)
+				} else {
+					return err
+				}
+			} else {
+				checkpointFilesExist = true
+			}
+		}
+		if checkpointFilesExist {
 			console.Info("Copied the path %s from checkpoint %s to %q", checkoutPath, checkpoint.ShortID(), filepath.Join(outputDir, checkpoint.Path))
 		}
-
+		chunkedCount, err := p.checkoutChunkedFiles(checkpoint, outputDir, checkoutPath)
+		if err != nil {
+			return err
+		}
+		count, err := p.checkoutReferences(checkpoint, outputDir, checkoutPath)
+		if err != nil {
+			return err
+		}
+		if chunkedCount+count > 0 {
+			checkpointFilesExist = true
+		}
+		if err := p.checkoutPointerFiles(checkpoint, outputDir, checkoutPath); err != nil {
+			return err
+		}
 	}
 
 	if !experimentFilesExist && !checkpointFilesExist {
@@ -110,3 +167,87 @@ func (p *Project) CheckoutFileOrDirectory(checkpoint *Checkpoint, experiment *Ex
 
 	return nil
 }
+
+// CopyFile writes the single file `filePath` from a checkpoint or experiment
+// to out. Checkpoint files take precedence over experiment files, in the same
+// way they are overlaid when checking out. checkpoint may be nil.
+func (p *Project) CopyFile(checkpoint *Checkpoint, experiment *Experiment, filePath string, out io.Writer) error {
+	if checkpoint != nil && checkpoint.Path != "" {
+		id := checkpoint.ID
+		if referencedID, ok := checkpoint.References[path.Clean(filePath)]; ok {
+			id = referencedID
+		}
+		if id != checkpoint.ID || len(checkpoint.ChunkedFiles) > 0 {
+			file, err := p.chunkedFile(id, path.Clean(filePath))
+			if err != nil {
+				return err
+			}
+			if file != nil {
+				return p.copyChunkedFile(file, out)
+			}
+		}
+		err := p.copyFileOrBlob(checkpoint, checkpoint.referencedTreeTarPath(id, checkpoint.TreeOf(path.Clean(filePath))), filePath, out)
+		if err == nil || !errors.IsDoesNotExist(err) {
+			return err
+		}
+		console.Debug("%s not found in checkpoint %s", filePath, checkpoint.ShortID())
+	}
+	if experiment.Path != "" {
+		err := repository.CopyFileFromTar(p.repository, experiment.StorageTarPath(), filePath, out)
+		if err == nil || !errors.IsDoesNotExist(err) {
+			return err
+		}
+		console.Debug("%s not found in experiment %s", filePath, experiment.ShortID())
+	}
+	if checkpoint == nil {
+		return errors.DoesNotExist(fmt.Sprintf("The experiment %s does not have the file %s associated with it", experiment.ShortID(), filePath))
+	}
+	return errors.DoesNotExist(fmt.Sprintf("Neither the checkpoint %s nor its experiment %s has the file %s associated with it", checkpoint.ShortID(), experiment.ShortID(), filePath))
+}
+
+// CheckpointFiles returns the paths of the files in a checkpoint, overlaid
+// on its experiment's files in the same way they are when checking out,
+// sorted. checkpoint may be nil.
+func (p *Project) CheckpointFiles(checkpoint *Checkpoint, experiment *Experiment) ([]string, error) {
+	stored, err := p.storedFiles(experiment, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	filePaths := make([]string, 0, len(stored))
+	for filePath := range stored {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	return filePaths, nil
+}
+
+// CheckpointFileSizes returns the size of each file in a checkpoint,
+// overlaid on its experiment's files in the same way as CheckpointFiles. A
+// size is -1 if it isn't known without downloading the file. checkpoint may
+// be nil.
+func (p *Project) CheckpointFileSizes(checkpoint *Checkpoint, experiment *Experiment) (map[string]int64, error) {
+	stored, err := p.storedFiles(experiment, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(stored))
+	for filePath, file := range stored {
+		sizes[filePath] = file.size
+	}
+	return sizes, nil
+}
+
+// getPathItemTar extracts itemPath from the tarball at tarPath to outputDir.
+// If the tarball is indexed, only the parts of it that itemPath is in are
+// downloaded.
+func (p *Project) getPathItemTar(tarPath, itemPath, outputDir string) error {
+	index := repository.LoadTarIndex(p.repository, tarPath)
+	if index == nil {
+		return p.repository.GetPathItemTar(tarPath, itemPath, outputDir)
+	}
+	filePaths := index.FilesIn(itemPath)
+	if len(filePaths) == 0 {
+		return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
+	}
+	return repository.ExtractFromIndexedTar(p.repository, tarPath, index, filePaths, outputDir)
+}
@@ -0,0 +1,113 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// When many checkpoints are checked out at once, they often have files in
+// common: large files stored once by their contents, chunked files made of
+// the same chunks, and unchanged files that several checkpoints reference
+// from an earlier checkpoint's tarball. A CheckoutCache downloads each of
+// them once, and clones them into every checkout that needs them.
+
+// CheckoutCache is a directory of files downloaded for checkouts, keyed by
+// what they are. It is safe to use from several checkouts at once.
+type CheckoutCache struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]*checkoutCacheEntry
+	// hits is the number of times a file was already in the cache
+	hits int64
+}
+
+type checkoutCacheEntry struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// NewCheckoutCache returns a cache that keeps files in dir. The caller is
+// responsible for removing dir.
+func NewCheckoutCache(dir string) *CheckoutCache {
+	return &CheckoutCache{dir: dir, entries: map[string]*checkoutCacheEntry{}}
+}
+
+// SetCheckoutCache sets the cache that files are downloaded to when checking
+// out, so checkouts that share it only download common files once. If cache
+// is nil, files are downloaded straight to where they are checked out.
+func (p *Project) SetCheckoutCache(cache *CheckoutCache) {
+	p.checkoutCache = cache
+}
+
+// Hits returns the number of times a file didn't need to be downloaded
+// because it was already in the cache
+func (c *CheckoutCache) Hits() int64 {
+	return atomic.LoadInt64(&c.hits)
+}
+
+// fetch returns the path in the cache of what key identifies, calling fill
+// to download it there if it isn't there yet. If several checkouts fetch the
+// same key at once, only one of them calls fill, and the rest wait for it.
+func (c *CheckoutCache) fetch(key string, fill func(cachePath string) error) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &checkoutCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	filled := false
+	entry.once.Do(func() {
+		filled = true
+		sum := sha256.Sum256([]byte(key))
+		entry.path = filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+		if entry.err = fill(entry.path); entry.err != nil {
+			os.RemoveAll(entry.path)
+		}
+	})
+	if !filled && entry.err == nil {
+		atomic.AddInt64(&c.hits, 1)
+	}
+	return entry.path, entry.err
+}
+
+// cloneFromCache copies the file at cachePath to dest. It is cloned next to
+// dest then renamed, so if dest is a pointer file, a failure leaves it.
+func cloneFromCache(cachePath string, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := files.CloneFile(cachePath, f.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// key returns a key that identifies the contents of file
+func (file *chunkedFile) key() string {
+	hashes := []string{}
+	for _, ref := range file.Chunks {
+		hashes = append(hashes, ref.Hash)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(hashes, ",")))
+	return "chunked:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestCheckoutCacheFetchesOnce(t *testing.T) {
+	dir, err := files.TempDir("test-checkout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache := NewCheckoutCache(dir)
+
+	var fills int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cachePath, err := cache.fetch("blob:abc", func(cachePath string) error {
+				atomic.AddInt64(&fills, 1)
+				return ioutil.WriteFile(cachePath, []byte("hello"), 0644)
+			})
+			require.NoError(t, err)
+			data, err := ioutil.ReadFile(cachePath)
+			require.NoError(t, err)
+			require.Equal(t, "hello", string(data))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), fills)
+	require.Equal(t, int64(9), cache.Hits())
+
+	dest := path.Join(dir, "out", "hello.txt")
+	cachePath, err := cache.fetch("blob:abc", nil)
+	require.NoError(t, err)
+	require.NoError(t, cloneFromCache(cachePath, dest))
+	data, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
+
+func TestCheckoutWithCache(t *testing.T) {
+	projectDir, err := files.TempDir("test-checkout-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-checkout-cache-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	// Modified in the past, so config.json is referenced from the first
+	// checkpoint by the others
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	for _, name := range []string{"config.json", "weights.pt"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", name), []byte(name+" 1"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), past, past))
+	}
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	checkpoints := []*Checkpoint{chk1}
+	for i := 2; i <= 3; i++ {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights.pt "+string(rune('0'+i))), 0644))
+		chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+		require.NoError(t, err)
+		require.Equal(t, chk1.ID, chk.References["model/config.json"])
+		checkpoints = append(checkpoints, chk)
+	}
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: checkpoints,
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	cacheDir, err := files.TempDir("test-checkout-cache-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	cache := NewCheckoutCache(cacheDir)
+	proj.SetCheckoutCache(cache)
+
+	outputDir, err := files.TempDir("test-checkout-cache-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	for i, chk := range checkpoints[1:] {
+		dir := path.Join(outputDir, chk.ShortID())
+		require.NoError(t, proj.CheckoutCheckpoint(chk, exp, dir, true))
+		data, err := ioutil.ReadFile(path.Join(dir, "model", "config.json"))
+		require.NoError(t, err)
+		require.Equal(t, "config.json 1", string(data))
+		data, err = ioutil.ReadFile(path.Join(dir, "model", "weights.pt"))
+		require.NoError(t, err)
+		require.Equal(t, "weights.pt "+string(rune('2'+i)), string(data))
+	}
+	// The first checkpoint's tarball was only extracted once
+	require.Equal(t, int64(1), cache.Hits())
+}
@@ -28,6 +28,31 @@ type Checkpoint struct {
 	Step          int64          `json:"step"`
 	Path          string         `json:"path"`
 	PrimaryMetric *PrimaryMetric `json:"primary_metric"`
+	// References are files that hadn't changed since an earlier checkpoint,
+	// so they aren't in this checkpoint's tarball. It maps the path of each
+	// file to the ID of the checkpoint whose tarball has it.
+	References map[string]string `json:"references,omitempty"`
+	// ChunkedFiles are large files that are stored in chunks instead of in
+	// this checkpoint's tarball. Their chunks are listed in the checkpoint's
+	// chunk manifest.
+	ChunkedFiles []string `json:"chunked_files,omitempty"`
+	// PointerFiles are large files that are stored once each in blobs/,
+	// with pointer files in their place in this checkpoint's tarballs
+	PointerFiles []string `json:"pointer_files,omitempty"`
+	// Trees are the files in this checkpoint that are weights or artifacts,
+	// by tree. Those that are stored in tarballs are in the tree's own
+	// tarball, rather than this checkpoint's tarball, which has the code.
+	Trees map[string][]string `json:"trees,omitempty"`
+	// StoragePath is where this checkpoint's tarballs are in the repository,
+	// without their extensions, if it was saved with a layout in
+	// replicate.yaml. If it is empty, they are in checkpoints/<ID>.
+	StoragePath string `json:"storage_path,omitempty"`
+	// ReferencedStoragePaths are the storage paths of the checkpoints in
+	// References that have them
+	ReferencedStoragePaths map[string]string `json:"referenced_storage_paths,omitempty"`
+	// Serve is the container that serves the model in this checkpoint, if
+	// replicate.yaml had one when it was saved
+	Serve *ServeSpec `json:"serve,omitempty"`
 }
 
 // NewCheckpoint creates a checkpoint with default values
@@ -55,5 +80,27 @@ func (c *Checkpoint) ShortID() string {
 }
 
 func (c *Checkpoint) StorageTarPath() string {
-	return "checkpoints/" + c.ID + ".tar.gz"
+	return c.TreeTarPath(TreeCode)
+}
+
+// ReferencedCheckpoints returns the IDs of earlier checkpoints that have
+// files in this checkpoint, mapped to the paths of those files
+func (c *Checkpoint) ReferencedCheckpoints() map[string][]string {
+	ret := map[string][]string{}
+	for filePath, id := range c.References {
+		ret[id] = append(ret[id], filePath)
+	}
+	for _, filePaths := range ret {
+		sort.Strings(filePaths)
+	}
+	return ret
+}
+
+// referencedStoragePath returns the storage path of the checkpoint with ID
+// id, which is this checkpoint or one it references
+func (c *Checkpoint) referencedStoragePath(id string) string {
+	if id == c.ID {
+		return c.StoragePath
+	}
+	return c.ReferencedStoragePaths[id]
 }
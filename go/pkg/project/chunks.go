@@ -0,0 +1,426 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/chunk"
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// With chunking turned on, large files in checkpoints are split into
+// content-defined chunks instead of going in the checkpoint's tarball. Chunks
+// are stored once in chunks/, named by their hash, so when a file has only
+// partly changed since the last checkpoint, only the chunks that changed are
+// uploaded. chunks/manifests/<checkpoint ID>.json lists the chunks of each
+// file in a checkpoint.
+
+// MaxChunkWorkers is how many chunks are uploaded or downloaded at once
+const MaxChunkWorkers = 8
+
+type chunkManifest struct {
+	Files map[string]*chunkedFile `json:"files"`
+}
+
+type chunkedFile struct {
+	Size   int64      `json:"size"`
+	Chunks []chunkRef `json:"chunks"`
+	// Algorithm is what the chunks are hashed with. It is SHA-256 if it is
+	// empty.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+type chunkRef struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// knownChunks is the chunks that are known to be in the repository, in each
+// directory in chunks/
+type knownChunks struct {
+	mu     sync.Mutex
+	shards map[string]map[string]bool
+}
+
+func chunkPath(hash string) string {
+	return path.Join("chunks", hash[:2], hash)
+}
+
+func chunkManifestPath(checkpointID string) string {
+	return "chunks/manifests/" + checkpointID + ".json"
+}
+
+// SetChunking sets the settings for storing large files in checkpoints in
+// chunks. Chunking is off if chunking is nil.
+func (p *Project) SetChunking(chunking *config.Chunking) {
+	p.chunking = chunking
+}
+
+// selectChunkedFiles sets chk.ChunkedFiles to the files in the snapshot in
+// tempDir that are big enough to be chunked. Files that are stored as large
+// files aren't chunked, because they are replaced with pointer files.
+func (p *Project) selectChunkedFiles(chk *Checkpoint, tempDir string) error {
+	if p.chunking == nil {
+		return nil
+	}
+	minSize := p.chunking.MinFileSize()
+	return filepath.Walk(filepath.Join(tempDir, chk.Path), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// The whole path is referenced from an earlier checkpoint
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() < minSize {
+			return nil
+		}
+		relPath, err := filepath.Rel(tempDir, currentPath)
+		if err != nil {
+			return err
+		}
+		if chk.isPointerFile(filepath.ToSlash(relPath)) {
+			return nil
+		}
+		chk.ChunkedFiles = append(chk.ChunkedFiles, filepath.ToSlash(relPath))
+		return nil
+	})
+}
+
+// putChunkedFiles uploads the chunks of chk.ChunkedFiles in the snapshot in
+// tempDir that aren't already in the repository, writes the checkpoint's chunk
+// manifest, and removes the files from the snapshot so they aren't put in the
+// tarball too
+func (p *Project) putChunkedFiles(chk *Checkpoint, tempDir string) error {
+	if len(chk.ChunkedFiles) == 0 {
+		return nil
+	}
+	manifest := &chunkManifest{Files: map[string]*chunkedFile{}}
+	uploaded := 0
+	for _, relPath := range chk.ChunkedFiles {
+		file, n, err := p.putChunkedFile(filepath.Join(tempDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			// Chunks that were meant to be uploaded might not have been
+			p.resetKnownChunks()
+			return fmt.Errorf("Failed to upload chunks of %s: %w", relPath, err)
+		}
+		manifest.Files[relPath] = file
+		uploaded += n
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := p.repository.Put(chunkManifestPath(chk.ID), data); err != nil {
+		return err
+	}
+	for _, relPath := range chk.ChunkedFiles {
+		if err := os.Remove(filepath.Join(tempDir, filepath.FromSlash(relPath))); err != nil {
+			return err
+		}
+	}
+	console.Debug("Uploaded %d new chunks for checkpoint %s", uploaded, chk.ShortID())
+	return nil
+}
+
+// putChunkedFile uploads the chunks of the file at localPath that aren't in
+// the repository yet, and returns the file's chunks and how many were uploaded
+func (p *Project) putChunkedFile(localPath string) (*chunkedFile, int, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	file := &chunkedFile{Chunks: []chunkRef{}, Algorithm: p.contentHash()}
+	uploaded := 0
+	queue := concurrency.NewWorkerQueue(context.Background(), MaxChunkWorkers)
+	err = chunk.Split(f, func(data []byte) error {
+		hash, err := hashBytes(file.Algorithm, data)
+		if err != nil {
+			return err
+		}
+		file.Chunks = append(file.Chunks, chunkRef{Hash: hash, Size: int64(len(data))})
+		file.Size += int64(len(data))
+
+		exists, err := p.chunkExists(hash)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		uploaded++
+		// data is reused by Split once this returns
+		data = append([]byte{}, data...)
+		return queue.Go(func() error {
+			return p.repository.Put(chunkPath(hash), data)
+		})
+	})
+	if waitErr := queue.Wait(); err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return file, uploaded, nil
+}
+
+// chunkExists returns whether a chunk is in the repository, marking it as
+// there if it isn't because the caller is about to upload it. The chunks in
+// each directory of chunks/ are listed the first time one of them is needed.
+func (p *Project) chunkExists(hash string) (bool, error) {
+	p.knownChunks.mu.Lock()
+	defer p.knownChunks.mu.Unlock()
+	if p.knownChunks.shards == nil {
+		p.knownChunks.shards = map[string]map[string]bool{}
+	}
+	shard, ok := p.knownChunks.shards[hash[:2]]
+	if !ok {
+		paths, err := p.repository.List(path.Join("chunks", hash[:2]))
+		if err != nil {
+			return false, err
+		}
+		shard = map[string]bool{}
+		for _, objectPath := range paths {
+			shard[path.Base(objectPath)] = true
+		}
+		p.knownChunks.shards[hash[:2]] = shard
+	}
+	if shard[hash] {
+		return true, nil
+	}
+	shard[hash] = true
+	return false, nil
+}
+
+// resetKnownChunks makes chunkExists list the chunks in the repository again
+func (p *Project) resetKnownChunks() {
+	p.knownChunks.mu.Lock()
+	defer p.knownChunks.mu.Unlock()
+	p.knownChunks.shards = nil
+}
+
+// loadChunkManifest returns the chunk manifest of a checkpoint, or nil if it
+// doesn't have one
+func (p *Project) loadChunkManifest(checkpointID string) (*chunkManifest, error) {
+	data, err := p.repository.Get(chunkManifestPath(checkpointID))
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	manifest := &chunkManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to parse %s: %v", chunkManifestPath(checkpointID), err))
+	}
+	return manifest, nil
+}
+
+// checkoutChunkedFiles writes the chunked files in chk to outputDir. If
+// includePath isn't empty, only files at or inside it are written. It returns
+// the number of files that were written.
+func (p *Project) checkoutChunkedFiles(chk *Checkpoint, outputDir string, includePath string) (int, error) {
+	if len(chk.ChunkedFiles) == 0 {
+		return 0, nil
+	}
+	filePaths := chk.ChunkedFiles
+	if includePath != "" {
+		filePaths = filterPaths(filePaths, path.Clean(includePath))
+	}
+	filePaths = p.filterCheckoutTrees(chk, filePaths)
+	if len(filePaths) == 0 {
+		return 0, nil
+	}
+	manifest, err := p.loadChunkManifest(chk.ID)
+	if err != nil {
+		return 0, err
+	}
+	if manifest == nil {
+		return 0, errors.DoesNotExist(fmt.Sprintf("Checkpoint %s has files that are stored in chunks, but could not find the list of chunks at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", chk.ShortID(), chunkManifestPath(chk.ID)))
+	}
+	for _, filePath := range filePaths {
+		file := manifest.Files[filePath]
+		if file == nil {
+			return 0, errors.ReadError(fmt.Sprintf("%s does not list the chunks of %s", chunkManifestPath(chk.ID), filePath))
+		}
+		if err := p.getChunkedFile(file, filepath.Join(outputDir, filepath.FromSlash(filePath))); err != nil {
+			return 0, fmt.Errorf("Failed to download chunks of %s: %w", filePath, err)
+		}
+	}
+	return len(filePaths), nil
+}
+
+// chunkedFile returns the chunks of filePath in the checkpoint with ID id, or
+// nil if it isn't chunked
+func (p *Project) chunkedFile(id string, filePath string) (*chunkedFile, error) {
+	manifest, err := p.loadChunkManifest(id)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	return manifest.Files[filePath], nil
+}
+
+// getChunkedFile downloads the chunks of file to dest, or copies it from the
+// checkout cache if it has already been downloaded
+func (p *Project) getChunkedFile(file *chunkedFile, dest string) error {
+	if p.checkoutCache == nil {
+		return p.downloadChunkedFile(file, dest)
+	}
+	cachePath, err := p.checkoutCache.fetch(file.key(), func(cachePath string) error {
+		return p.downloadChunkedFile(file, cachePath)
+	})
+	if err != nil {
+		return err
+	}
+	return cloneFromCache(cachePath, dest)
+}
+
+// downloadChunkedFile downloads the chunks of file to dest
+func (p *Project) downloadChunkedFile(file *chunkedFile, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(file.Size); err != nil {
+		return err
+	}
+	queue := concurrency.NewWorkerQueue(context.Background(), MaxChunkWorkers)
+	offset := int64(0)
+	for _, ref := range file.Chunks {
+		ref, chunkOffset := ref, offset
+		offset += ref.Size
+		err := queue.Go(func() error {
+			var buf bytes.Buffer
+			if err := p.readChunk(ref, file.Algorithm, &buf); err != nil {
+				return err
+			}
+			_, err := f.WriteAt(buf.Bytes(), chunkOffset)
+			return err
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// copyChunkedFile writes the chunks of file to out, in order
+func (p *Project) copyChunkedFile(file *chunkedFile, out io.Writer) error {
+	for _, ref := range file.Chunks {
+		if err := p.readChunk(ref, file.Algorithm, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readChunk writes a chunk to out, checking it hasn't been corrupted by
+// hashing it with algorithm
+func (p *Project) readChunk(ref chunkRef, algorithm string, out io.Writer) error {
+	reader, err := p.repository.GetReader(chunkPath(ref.Hash))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return errors.ReadError(fmt.Sprintf("Failed to read %s: %v", chunkPath(ref.Hash), err))
+	}
+	sum, err := hashBytes(algorithm, data)
+	if err != nil {
+		return err
+	}
+	if sum != ref.Hash {
+		return errors.ReadError(fmt.Sprintf("%s/%s is corrupt: its checksum doesn't match", p.repository.RootURL(), chunkPath(ref.Hash)))
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// deleteUnusedChunks deletes the chunk manifests of the checkpoints in
+// deleted, and the chunks in them that aren't used by the checkpoints in keep
+func (p *Project) deleteUnusedChunks(deleted []string, keep map[string]bool) error {
+	manifestPaths, err := p.repository.List("chunks/manifests")
+	if err != nil {
+		return err
+	}
+	hasManifest := map[string]bool{}
+	for _, manifestPath := range manifestPaths {
+		hasManifest[manifestPath] = true
+	}
+	deletedManifests := []*chunkManifest{}
+	for _, id := range deleted {
+		if !hasManifest[chunkManifestPath(id)] {
+			continue
+		}
+		manifest, err := p.loadChunkManifest(id)
+		if err != nil {
+			return err
+		}
+		if manifest != nil {
+			deletedManifests = append(deletedManifests, manifest)
+		}
+	}
+	if len(deletedManifests) == 0 {
+		return nil
+	}
+
+	used := map[string]bool{}
+	for id := range keep {
+		if !hasManifest[chunkManifestPath(id)] {
+			continue
+		}
+		manifest, err := p.loadChunkManifest(id)
+		if err != nil {
+			return err
+		}
+		for _, file := range manifest.Files {
+			for _, ref := range file.Chunks {
+				used[ref.Hash] = true
+			}
+		}
+	}
+
+	p.resetKnownChunks()
+	for _, manifest := range deletedManifests {
+		for _, file := range manifest.Files {
+			for _, ref := range file.Chunks {
+				if used[ref.Hash] {
+					continue
+				}
+				used[ref.Hash] = true
+				if err := p.repository.Delete(chunkPath(ref.Hash)); err != nil {
+					console.Warn("Failed to delete chunk %s: %s", chunkPath(ref.Hash), err)
+				}
+			}
+		}
+	}
+	for _, id := range deleted {
+		if hasManifest[chunkManifestPath(id)] {
+			if err := p.repository.Delete(chunkManifestPath(id)); err != nil {
+				console.Warn("Failed to delete chunk manifest %s: %s", chunkManifestPath(id), err)
+			}
+		}
+	}
+	return nil
+}
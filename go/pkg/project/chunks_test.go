@@ -0,0 +1,123 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func listChunks(t *testing.T, repoDir string) map[string]bool {
+	chunks := map[string]bool{}
+	results := make(chan repository.ListResult)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	go repo.ListRecursive(context.Background(), results, "chunks")
+	for result := range results {
+		require.NoError(t, result.Error)
+		if path.Dir(result.Path) != "chunks/manifests" {
+			chunks[result.Path] = true
+		}
+	}
+	return chunks
+}
+
+func TestCheckpointChunkedFiles(t *testing.T) {
+	projectDir, err := files.TempDir("test-chunks")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-chunks-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetChunking(&config.Chunking{MinFileSizeMB: 1})
+
+	weights := make([]byte, 16*1024*1024)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), weights, 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "config.json"), []byte("{}"), 0644))
+
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, chk1.ChunkedFiles)
+	tarFiles, err := repo.ListTarFile(chk1.StorageTarPath())
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/config.json"}, tarFiles)
+	chunks1 := listChunks(t, repoDir)
+	require.True(t, len(chunks1) > 1)
+
+	// Only the chunks around a change are uploaded
+	weights2 := append([]byte{}, weights...)
+	weights2[10*1024*1024] ^= 1
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), weights2, 0644))
+	// Nothing is referenced from the first checkpoint, so its chunks that
+	// aren't used any more can be deleted
+	future := time.Now().Add(time.Hour)
+	for _, name := range []string{"config.json", "weights.pt"} {
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), future, future))
+	}
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, chk2.ChunkedFiles)
+	require.Empty(t, chk2.References)
+	chunks2 := listChunks(t, repoDir)
+	require.True(t, len(chunks2)-len(chunks1) <= 2, "%d new chunks", len(chunks2)-len(chunks1))
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	outputDir, err := files.TempDir("test-chunks-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.CheckoutCheckpoint(chk1, exp, outputDir, true))
+	contents, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(weights, contents))
+	contents, err = ioutil.ReadFile(path.Join(outputDir, "model", "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(contents))
+
+	var buf bytes.Buffer
+	require.NoError(t, proj.CopyFile(chk2, exp, "model/weights.pt", &buf))
+	require.True(t, bytes.Equal(weights2, buf.Bytes()))
+
+	problems, err := proj.Verify()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// Chunks the second checkpoint uses are kept when the first is deleted
+	require.NoError(t, proj.DeleteCheckpoint(chk1))
+	exp.Checkpoints = []*Checkpoint{chk2}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	chunks3 := listChunks(t, repoDir)
+	require.True(t, len(chunks3) < len(chunks2))
+	buf.Reset()
+	require.NoError(t, proj.CopyFile(chk2, exp, "model/weights.pt", &buf))
+	require.True(t, bytes.Equal(weights2, buf.Bytes()))
+
+	require.NoError(t, proj.DeleteCheckpoint(chk2))
+	require.Empty(t, listChunks(t, repoDir))
+	exists, err := files.FileExists(path.Join(repoDir, chunkManifestPath(chk2.ID)))
+	require.NoError(t, err)
+	require.False(t, exists)
+}
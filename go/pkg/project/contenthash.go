@@ -0,0 +1,61 @@
+package project
+
+import (
+	"encoding/hex"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/hash"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// The contents of chunks, large files and datasets are hashed with the
+// algorithm recorded in the repository's repository.json. It is picked with
+// `hash` in replicate.yaml when the repository is created, and can't be
+// changed after that, because files are stored by their hash.
+
+// SetHash sets the algorithm that a new repository records to hash its files
+// with. It is the default algorithm if it is empty.
+func (p *Project) SetHash(algorithm string) {
+	p.hashAlgorithm = algorithm
+}
+
+// contentHash returns the algorithm recorded in the repository. If the
+// repository doesn't have a spec yet, or it can't be read, it is the
+// algorithm set with SetHash.
+func (p *Project) contentHash() string {
+	p.repositoryHashMu.Lock()
+	defer p.repositoryHashMu.Unlock()
+	if p.repositoryHash != "" {
+		return p.repositoryHash
+	}
+	configured := p.hashAlgorithm
+	if configured == "" {
+		configured = hash.DefaultAlgorithm
+	}
+	spec, err := repository.LoadSpec(p.repository)
+	if err != nil {
+		console.Debug("Failed to read the repository's hash algorithm, using %s: %s", configured, err)
+		return configured
+	}
+	if spec == nil {
+		return configured
+	}
+	p.repositoryHash = spec.Hash
+	if p.repositoryHash == "" {
+		p.repositoryHash = hash.DefaultAlgorithm
+	}
+	if p.hashAlgorithm != "" && p.hashAlgorithm != p.repositoryHash {
+		console.Warn("The files in %s are hashed with %s, so 'hash: %s' in replicate.yaml is ignored. It can only be set when a repository is created.", p.repository.RootURL(), p.repositoryHash, p.hashAlgorithm)
+	}
+	return p.repositoryHash
+}
+
+// hashBytes returns the hash of data
+func hashBytes(algorithm string, data []byte) (string, error) {
+	h, err := hash.New(algorithm)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
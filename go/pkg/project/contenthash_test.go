@@ -0,0 +1,71 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestContentHash(t *testing.T) {
+	projectDir, err := files.TempDir("test-content-hash")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-content-hash-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetHash("blake3")
+	proj.SetChunking(&config.Chunking{MinFileSizeMB: 1})
+	proj.SetLargeFiles(&config.LargeFiles{MinFileSizeMB: 1})
+
+	weights := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), weights, 0644))
+
+	// The algorithm is recorded when the repository is created
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	spec, err := repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, &repository.Spec{Version: 2, Hash: "blake3"}, spec)
+
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, chk.ChunkedFiles)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// A project that asks for another algorithm uses the repository's
+	other := NewProject(repo, projectDir)
+	other.SetHash("sha256")
+	require.Equal(t, "blake3", other.contentHash())
+	var buf bytes.Buffer
+	require.NoError(t, other.CopyFile(chk, exp, "model/weights.pt", &buf))
+	require.True(t, bytes.Equal(weights, buf.Bytes()))
+	problems, err := other.Verify()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// Large files are stored by their BLAKE3 hash too
+	ptr, _, err := other.putBlob(path.Join(projectDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.True(t, strings.Contains(ptr.String(), "\noid blake3:"))
+	require.Equal(t, ptr, parsePointer([]byte(ptr.String())))
+	buf.Reset()
+	require.NoError(t, other.copyBlob(ptr, &buf))
+	require.True(t, bytes.Equal(weights, buf.Bytes()))
+}
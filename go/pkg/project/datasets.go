@@ -0,0 +1,187 @@
+package project
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/hash"
+)
+
+// Datasets in replicate.yaml are fingerprinted when an experiment is
+// created, so it is possible to tell which experiments used which version of
+// the data, even if the data isn't saved with them.
+
+// DatasetFilterPrefix is prepended to the name of a dataset to filter
+// experiments by its fingerprint, e.g. "dataset_train = 3f2a1b9c0d4e"
+const DatasetFilterPrefix = "dataset_"
+
+// rowExtensions are the extensions of files that have a row on each line.
+// Rows are only counted if all the files in a dataset have one of them.
+var rowExtensions = map[string]bool{".csv": true, ".tsv": true, ".jsonl": true, ".ndjson": true, ".txt": true}
+
+// headerExtensions are the extensions of files whose first line is a header,
+// not a row
+var headerExtensions = map[string]bool{".csv": true, ".tsv": true}
+
+// DatasetFingerprint is what a dataset was like when an experiment was
+// created
+type DatasetFingerprint struct {
+	Name string `json:"name"`
+	// Path is relative to the project directory
+	Path string `json:"path"`
+	// Hash is the hash of the paths and contents of the files in the
+	// dataset
+	Hash string `json:"hash"`
+	// Algorithm is what Hash is hashed with. It is SHA-256 if it is empty.
+	Algorithm string `json:"algorithm,omitempty"`
+	Size      int64  `json:"size"`
+	Files     int    `json:"files"`
+	// Rows is the number of rows in the dataset, if it is made of text
+	// files with a row on each line, like CSV or JSON Lines
+	Rows *int64 `json:"rows,omitempty"`
+}
+
+// Fingerprint returns a short version of the hash, which is what is shown
+// and used in filters
+func (d *DatasetFingerprint) Fingerprint() string {
+	if len(d.Hash) < 12 {
+		return d.Hash
+	}
+	return d.Hash[:12]
+}
+
+// SetDatasets sets the datasets that are fingerprinted when experiments are
+// created
+func (p *Project) SetDatasets(datasets []*config.Dataset) {
+	p.datasets = datasets
+}
+
+// fingerprintDatasets fingerprints the datasets set with SetDatasets. A
+// dataset that can't be read is skipped with a warning, so experiments can
+// still be created.
+func (p *Project) fingerprintDatasets() []*DatasetFingerprint {
+	fingerprints := []*DatasetFingerprint{}
+	for _, dataset := range p.datasets {
+		fingerprint, err := FingerprintDataset(p.directory, dataset, p.contentHash())
+		if err != nil {
+			console.Warn("Failed to fingerprint the dataset %s: %s", dataset.Name, err)
+			continue
+		}
+		console.Debug("Dataset %s has fingerprint %s", dataset.Name, fingerprint.Fingerprint())
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints
+}
+
+// FingerprintDataset hashes the files in dataset with algorithm, and counts
+// their size and rows. The path of the dataset is relative to projectDir.
+func FingerprintDataset(projectDir string, dataset *config.Dataset, algorithm string) (*DatasetFingerprint, error) {
+	root := filepath.Join(projectDir, filepath.FromSlash(dataset.Path))
+	filePaths := []string{}
+	err := filepath.Walk(root, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			filePaths = append(filePaths, currentPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filePaths)
+
+	if algorithm == "" {
+		algorithm = hash.DefaultAlgorithm
+	}
+	h, err := hash.New(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := &DatasetFingerprint{Name: dataset.Name, Path: dataset.Path, Files: len(filePaths)}
+	if algorithm != hash.SHA256 {
+		fingerprint.Algorithm = algorithm
+	}
+	countRows := len(filePaths) > 0
+	for _, filePath := range filePaths {
+		if !rowExtensions[strings.ToLower(filepath.Ext(filePath))] {
+			countRows = false
+		}
+	}
+	var rows int64
+	for _, filePath := range filePaths {
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return nil, err
+		}
+		// Paths are included, so renaming a file changes the hash
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(relPath))
+		size, lines, err := hashDatasetFile(h, filePath)
+		if err != nil {
+			return nil, err
+		}
+		fingerprint.Size += size
+		if headerExtensions[strings.ToLower(filepath.Ext(filePath))] && lines > 0 {
+			lines--
+		}
+		rows += lines
+	}
+	fingerprint.Hash = hex.EncodeToString(h.Sum(nil))
+	if countRows {
+		fingerprint.Rows = &rows
+	}
+	return fingerprint, nil
+}
+
+// hashDatasetFile writes the contents of filePath, followed by its length, to
+// hash, and returns its size and the number of lines in it
+func hashDatasetFile(hash io.Writer, filePath string) (size int64, lines int64, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	buf := make([]byte, 1024*1024)
+	lastByte := byte('\n')
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			hash.Write(buf[:n])
+			size += int64(n)
+			lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+			lastByte = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	// The last line doesn't have to end with a newline
+	if lastByte != '\n' {
+		lines++
+	}
+	fmt.Fprintf(hash, "\x00%d\x00", size)
+	return size, lines, nil
+}
+
+// Dataset returns the fingerprint of the dataset called name that e used, or
+// nil if it didn't record one
+func (e *Experiment) Dataset(name string) *DatasetFingerprint {
+	for _, d := range e.Datasets {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
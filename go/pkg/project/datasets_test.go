@@ -0,0 +1,79 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestFingerprintDataset(t *testing.T) {
+	projectDir, err := files.TempDir("test-datasets")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "data", "images"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "data", "train.csv"), []byte("x,y\n1,2\n3,4"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "data", "val.jsonl"), []byte("{}\n{}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "data", "images", "cat.png"), []byte("meow"), 0644))
+
+	train, err := FingerprintDataset(projectDir, &config.Dataset{Name: "train", Path: "data/train.csv"}, "")
+	require.NoError(t, err)
+	require.Equal(t, "train", train.Name)
+	require.Equal(t, 1, train.Files)
+	require.Equal(t, int64(11), train.Size)
+	require.Equal(t, int64(2), *train.Rows)
+	require.Len(t, train.Hash, 64)
+	require.Equal(t, train.Hash[:12], train.Fingerprint())
+
+	// The same data has the same fingerprint
+	again, err := FingerprintDataset(projectDir, &config.Dataset{Name: "train", Path: "data/train.csv"}, "")
+	require.NoError(t, err)
+	require.Equal(t, train.Hash, again.Hash)
+
+	all, err := FingerprintDataset(projectDir, &config.Dataset{Name: "all", Path: "data"}, "")
+	require.NoError(t, err)
+	require.Equal(t, 3, all.Files)
+	require.Equal(t, int64(21), all.Size)
+	// Rows can't be counted in images
+	require.Nil(t, all.Rows)
+
+	// Renaming a file changes the fingerprint
+	require.NoError(t, os.Rename(path.Join(projectDir, "data", "images", "cat.png"), path.Join(projectDir, "data", "images", "dog.png")))
+	renamed, err := FingerprintDataset(projectDir, &config.Dataset{Name: "all", Path: "data"}, "")
+	require.NoError(t, err)
+	require.NotEqual(t, all.Hash, renamed.Hash)
+
+	// Changing data changes the fingerprint
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "data", "train.csv"), []byte("x,y\n1,2\n3,5"), 0644))
+	changed, err := FingerprintDataset(projectDir, &config.Dataset{Name: "train", Path: "data/train.csv"}, "")
+	require.NoError(t, err)
+	require.NotEqual(t, train.Hash, changed.Hash)
+
+	_, err = FingerprintDataset(projectDir, &config.Dataset{Name: "missing", Path: "data/missing"}, "")
+	require.Error(t, err)
+}
+
+func TestFingerprintDatasetsOnCreate(t *testing.T) {
+	projectDir, err := files.TempDir("test-datasets")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "train.csv"), []byte("x\n1\n"), 0644))
+
+	proj := NewProject(nil, projectDir)
+	proj.SetDatasets([]*config.Dataset{
+		{Name: "train", Path: "train.csv"},
+		{Name: "missing", Path: "missing.csv"},
+	})
+	// Datasets that can't be read are skipped
+	fingerprints := proj.fingerprintDatasets()
+	require.Len(t, fingerprints, 1)
+	exp := &Experiment{Datasets: fingerprints}
+	require.Equal(t, int64(1), *exp.Dataset("train").Rows)
+	require.Nil(t, exp.Dataset("missing"))
+}
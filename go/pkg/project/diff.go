@@ -0,0 +1,325 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// The files of two checkpoints are compared without downloading most of
+// them. A file whose contents hash the same, or that is stored in the same
+// place (e.g. because one checkpoint references it in the other), hasn't
+// changed. Only code files that might have changed are downloaded to compare
+// their contents.
+
+// MaxFileDiffSize is the biggest file whose contents are compared
+const MaxFileDiffSize = 1024 * 1024
+
+// FileChange is how a file differs between two checkpoints
+type FileChange string
+
+const (
+	FileAdded    FileChange = "added"
+	FileRemoved  FileChange = "removed"
+	FileModified FileChange = "modified"
+)
+
+// FileDiff is a file that differs between two checkpoints
+type FileDiff struct {
+	Path   string
+	Change FileChange
+	// Diff is a unified diff of the file's contents, if it was modified and
+	// could be compared
+	Diff string
+	// NotCompared is why the file's contents weren't compared, if it was
+	// modified and they weren't
+	NotCompared string
+}
+
+// storedFile is where a file in a checkpoint is stored
+type storedFile struct {
+	// location is the tarball the file is in and its path in it, or its
+	// chunks
+	location string
+	// hash is the hash of its contents, or "" if it isn't known
+	hash string
+	// size is -1 if it isn't known
+	size int64
+	tree string
+}
+
+func (f *storedFile) same(other *storedFile) bool {
+	if f.location == other.location {
+		return true
+	}
+	return f.hash != "" && f.hash == other.hash
+}
+
+// DiffFiles returns the files that differ between two checkpoints and their
+// experiments, sorted by path. If paths isn't empty, only files at or inside
+// them are compared. Either checkpoint may be nil, in which case only its
+// experiment's files are compared.
+func (p *Project) DiffFiles(exp1 *Experiment, chk1 *Checkpoint, exp2 *Experiment, chk2 *Checkpoint, paths []string) ([]*FileDiff, error) {
+	files1, err := p.storedFiles(exp1, chk1)
+	if err != nil {
+		return nil, err
+	}
+	files2, err := p.storedFiles(exp2, chk2)
+	if err != nil {
+		return nil, err
+	}
+
+	filePaths := []string{}
+	for filePath := range files1 {
+		filePaths = append(filePaths, filePath)
+	}
+	for filePath := range files2 {
+		if _, ok := files1[filePath]; !ok {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	if len(paths) > 0 {
+		included := []string{}
+		for _, includePath := range paths {
+			included = append(included, filterPaths(filePaths, path.Clean(includePath))...)
+		}
+		filePaths = uniqueStrings(included)
+	}
+	sort.Strings(filePaths)
+
+	diffs := []*FileDiff{}
+	for _, filePath := range filePaths {
+		file1, file2 := files1[filePath], files2[filePath]
+		switch {
+		case file1 == nil:
+			diffs = append(diffs, &FileDiff{Path: filePath, Change: FileAdded})
+		case file2 == nil:
+			diffs = append(diffs, &FileDiff{Path: filePath, Change: FileRemoved})
+		case !file1.same(file2):
+			diff, err := p.diffFile(exp1, chk1, file1, exp2, chk2, file2, filePath)
+			if err != nil {
+				return nil, err
+			}
+			if diff != nil {
+				diffs = append(diffs, diff)
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// diffFile compares the contents of a file that is stored in different
+// places in two checkpoints. It returns nil if they turn out to be the same.
+func (p *Project) diffFile(exp1 *Experiment, chk1 *Checkpoint, file1 *storedFile, exp2 *Experiment, chk2 *Checkpoint, file2 *storedFile, filePath string) (*FileDiff, error) {
+	diff := &FileDiff{Path: filePath, Change: FileModified}
+	if file1.tree != TreeCode || file2.tree != TreeCode {
+		diff.NotCompared = "it isn't code"
+		return diff, nil
+	}
+	if file1.size > MaxFileDiffSize || file2.size > MaxFileDiffSize {
+		diff.NotCompared = "it is too big"
+		return diff, nil
+	}
+	data1, err := p.readFileForDiff(exp1, chk1, filePath)
+	if err != nil {
+		return nil, err
+	}
+	data2, err := p.readFileForDiff(exp2, chk2, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if data1 == nil || data2 == nil {
+		diff.NotCompared = "it is too big"
+		return diff, nil
+	}
+	if bytes.Equal(data1, data2) {
+		return nil, nil
+	}
+	if isBinary(data1) || isBinary(data2) {
+		diff.NotCompared = "it is a binary file"
+		return diff, nil
+	}
+	diff.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(data1)),
+		B:        splitLines(string(data2)),
+		FromFile: diffLabel(exp1, chk1, filePath),
+		ToFile:   diffLabel(exp2, chk2, filePath),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// readFileForDiff returns the contents of filePath in a checkpoint, or nil if
+// it is bigger than MaxFileDiffSize
+func (p *Project) readFileForDiff(exp *Experiment, chk *Checkpoint, filePath string) ([]byte, error) {
+	out := &limitedBuffer{limit: MaxFileDiffSize}
+	if err := p.CopyFile(chk, exp, filePath, out); err != nil {
+		// Errors from writing are wrapped in read errors, so check whether
+		// the buffer filled up rather than what the error is
+		if out.exceeded {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// limitedBuffer is a bytes.Buffer that fails once more than limit bytes are
+// written to it, so a file doesn't have to be downloaded completely to find
+// out it's too big
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if b.Len()+len(data) > b.limit {
+		b.exceeded = true
+		return 0, fmt.Errorf("File is bigger than %d bytes", b.limit)
+	}
+	return b.Buffer.Write(data)
+}
+
+// isBinary returns whether data looks like it isn't text, in the same way git
+// decides: if it has a NUL byte near the start
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// splitLines splits s into lines that end in newlines, adding one to the last
+// line if it doesn't have one. difflib.SplitLines adds an empty line after a
+// trailing newline instead.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func diffLabel(exp *Experiment, chk *Checkpoint, filePath string) string {
+	if chk != nil {
+		return chk.ShortID() + "/" + filePath
+	}
+	return exp.ShortID() + "/" + filePath
+}
+
+// storedFiles returns where each file in a checkpoint is stored, overlaid on
+// its experiment's files in the same way they are when checking out. Only the
+// tarballs of code are listed. Where weights and artifacts are stored is known
+// from the checkpoint's metadata.
+func (p *Project) storedFiles(exp *Experiment, chk *Checkpoint) (map[string]*storedFile, error) {
+	files := map[string]*storedFile{}
+	if exp.Path != "" {
+		if err := p.addTarFiles(files, exp.StorageTarPath()); err != nil {
+			return nil, err
+		}
+	}
+	if chk == nil || chk.Path == "" {
+		return files, nil
+	}
+	if err := p.addTarFiles(files, chk.StorageTarPath()); err != nil {
+		return nil, err
+	}
+	for tree, filePaths := range chk.Trees {
+		for _, filePath := range filePaths {
+			files[filePath] = &storedFile{location: chk.TreeTarPath(tree) + ":" + filePath, size: -1, tree: tree}
+		}
+	}
+
+	manifests := map[string]*chunkManifest{}
+	loadManifest := func(id string) (*chunkManifest, error) {
+		if manifest, ok := manifests[id]; ok {
+			return manifest, nil
+		}
+		manifest, err := p.loadChunkManifest(id)
+		if err != nil {
+			return nil, err
+		}
+		manifests[id] = manifest
+		return manifest, nil
+	}
+	for id, filePaths := range chk.ReferencedCheckpoints() {
+		manifest, err := loadManifest(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, filePath := range filePaths {
+			tree := chk.TreeOf(filePath)
+			file := &storedFile{location: chk.referencedTreeTarPath(id, tree) + ":" + filePath, size: -1, tree: tree}
+			if manifest != nil && manifest.Files[filePath] != nil {
+				file = chunkedStoredFile(manifest.Files[filePath], tree)
+			}
+			files[filePath] = file
+		}
+	}
+	if len(chk.ChunkedFiles) > 0 {
+		manifest, err := loadManifest(chk.ID)
+		if err != nil {
+			return nil, err
+		}
+		if manifest == nil {
+			return nil, errors.DoesNotExist(fmt.Sprintf("Checkpoint %s has files that are stored in chunks, but could not find the list of chunks at %q.\nMaybe it hasn't been written yet, or the repository is corrupted?", chk.ShortID(), chunkManifestPath(chk.ID)))
+		}
+		for _, filePath := range chk.ChunkedFiles {
+			if file := manifest.Files[filePath]; file != nil {
+				files[filePath] = chunkedStoredFile(file, chk.TreeOf(filePath))
+			}
+		}
+	}
+	return files, nil
+}
+
+// addTarFiles adds the files in the tarball at tarPath to files
+func (p *Project) addTarFiles(files map[string]*storedFile, tarPath string) error {
+	if err := p.ensureRestored(tarPath); err != nil {
+		return err
+	}
+	tarFiles, err := repository.ListTarFiles(p.repository, tarPath)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range tarFiles {
+		files[f.Path] = &storedFile{location: tarPath + ":" + f.Path, hash: f.SHA256, size: f.Size, tree: TreeCode}
+	}
+	return nil
+}
+
+func chunkedStoredFile(file *chunkedFile, tree string) *storedFile {
+	hashes := make([]string, len(file.Chunks))
+	for i, chunk := range file.Chunks {
+		hashes[i] = chunk.Hash
+	}
+	location := "chunks:" + strings.Join(hashes, ",")
+	return &storedFile{location: location, size: file.Size, tree: tree}
+}
+
+func uniqueStrings(strs []string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, s := range strs {
+		if !seen[s] {
+			seen[s] = true
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
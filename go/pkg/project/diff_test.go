@@ -0,0 +1,81 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestDiffFiles(t *testing.T) {
+	projectDir, err := files.TempDir("test-diff")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-diff-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	writeFile := func(name string, contents string) {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", name), []byte(contents), 0644))
+		// Modified in the past, so unchanged files are referenced
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), past, past))
+	}
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	writeFile("params.yaml", "lr: 0.1\nlayers: 2\n")
+	writeFile("notes.txt", "notes")
+	writeFile("weights.bin", "weights\x001")
+	writeFile("referenced.txt", "referenced")
+	writeFile("rewritten.txt", "rewritten")
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+
+	writeFile("params.yaml", "lr: 0.01\nlayers: 2\n")
+	require.NoError(t, os.Remove(path.Join(projectDir, "model", "notes.txt")))
+	writeFile("new.txt", "new")
+	writeFile("weights.bin", "weights\x002")
+	// Written again with the same contents, so it is uploaded again
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "rewritten.txt"), []byte("rewritten"), 0644))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, chk1.ID, chk2.References["model/referenced.txt"])
+	require.Empty(t, chk2.References["model/rewritten.txt"])
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+
+	diffs, err := proj.DiffFiles(exp, chk1, exp, chk2, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*FileDiff{
+		{Path: "model/new.txt", Change: FileAdded},
+		{Path: "model/notes.txt", Change: FileRemoved},
+		{Path: "model/params.yaml", Change: FileModified, Diff: "--- " + chk1.ShortID() + "/model/params.yaml\n" +
+			"+++ " + chk2.ShortID() + "/model/params.yaml\n" +
+			"@@ -1,2 +1,2 @@\n" +
+			"-lr: 0.1\n" +
+			"+lr: 0.01\n" +
+			" layers: 2\n"},
+		{Path: "model/weights.bin", Change: FileModified, NotCompared: "it is a binary file"},
+	}, diffs)
+
+	// Only the paths asked for
+	diffs, err = proj.DiffFiles(exp, chk1, exp, chk2, []string{"model/notes.txt", "model/referenced.txt"})
+	require.NoError(t, err)
+	require.Equal(t, []*FileDiff{
+		{Path: "model/notes.txt", Change: FileRemoved},
+	}, diffs)
+}
@@ -0,0 +1,184 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// DVCOutput is a file or directory tracked by DVC, recorded when an
+// experiment is created so the exact version of the data it used can be
+// pulled again when it is checked out.
+type DVCOutput struct {
+	// Path is relative to the project directory
+	Path string `json:"path"`
+	MD5  string `json:"md5"`
+	// DVCFile is the .dvc file or dvc.lock that tracks the output, relative
+	// to the project directory
+	DVCFile string `json:"dvc_file"`
+}
+
+type dvcOut struct {
+	Path string `json:"path"`
+	MD5  string `json:"md5"`
+}
+
+type dvcFile struct {
+	Outs []*dvcOut `json:"outs"`
+}
+
+type dvcLockFile struct {
+	Stages map[string]struct {
+		Outs []*dvcOut `json:"outs"`
+	} `json:"stages"`
+}
+
+// IsDVCRepository returns true if dir is the root of a DVC repository
+func IsDVCRepository(dir string) (bool, error) {
+	exists, err := files.FileExists(filepath.Join(dir, ".dvc"))
+	if err != nil || !exists {
+		return false, err
+	}
+	return files.IsDir(filepath.Join(dir, ".dvc"))
+}
+
+// FindDVCOutputs returns the outputs tracked by .dvc and dvc.lock files in
+// projectDir
+func FindDVCOutputs(projectDir string) ([]*DVCOutput, error) {
+	outputs := []*DVCOutput{}
+	err := filepath.Walk(projectDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != projectDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if isVenv, _ := files.FileExists(filepath.Join(path, "pyvenv.cfg")); isVenv {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(info.Name(), ".dvc") && info.Name() != "dvc.lock" {
+			return nil
+		}
+		relPath, err := filepath.Rel(projectDir, path)
+		if err != nil {
+			return err
+		}
+		fileOutputs, err := readDVCFile(path)
+		if err != nil {
+			return err
+		}
+		for _, out := range fileOutputs {
+			outputs = append(outputs, &DVCOutput{
+				Path:    filepath.ToSlash(filepath.Join(filepath.Dir(relPath), out.Path)),
+				MD5:     out.MD5,
+				DVCFile: filepath.ToSlash(relPath),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find DVC files: %w", err)
+	}
+	return outputs, nil
+}
+
+// readDVCFile returns the outputs in a .dvc or dvc.lock file, with paths
+// relative to the directory of the file
+func readDVCFile(path string) ([]*dvcOut, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Base(path) == "dvc.lock" {
+		lock := new(dvcLockFile)
+		if err := yaml.Unmarshal(data, lock); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+		}
+		outs := []*dvcOut{}
+		for _, stage := range lock.Stages {
+			outs = append(outs, stage.Outs...)
+		}
+		return outs, nil
+	}
+	f := new(dvcFile)
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return f.Outs, nil
+}
+
+// PullDVCOutputs pulls the versions of an experiment's DVC outputs that were
+// recorded when it was created into outputDir, which must be in a DVC
+// repository with the remotes configured.
+//
+// If a .dvc file in outputDir is missing or tracks a different version, it
+// is rewritten to track the recorded version first. Outputs of pipeline
+// stages in dvc.lock can't be rewritten, so a warning is shown if they don't
+// match.
+func PullDVCOutputs(exp *Experiment, outputDir string) error {
+	if len(exp.DVCOutputs) == 0 {
+		return nil
+	}
+	targets := []string{}
+	for _, out := range exp.DVCOutputs {
+		dvcFilePath := filepath.Join(outputDir, filepath.FromSlash(out.DVCFile))
+		current := ""
+		if outs, err := readDVCFile(dvcFilePath); err == nil {
+			for _, o := range outs {
+				if filepath.ToSlash(filepath.Join(filepath.Dir(out.DVCFile), o.Path)) == out.Path {
+					current = o.MD5
+				}
+			}
+		}
+		if current != out.MD5 {
+			if filepath.Base(out.DVCFile) == "dvc.lock" {
+				console.Warn("%s in %s does not match the version used by experiment %s, so the wrong version of it might be pulled", out.Path, out.DVCFile, exp.ShortID())
+			} else if err := writeDVCFile(dvcFilePath, out); err != nil {
+				return err
+			}
+		}
+		targets = append(targets, out.Path)
+	}
+
+	console.Info("Pulling %d DVC outputs...", len(targets))
+	cmd := exec.Command("dvc", append([]string{"pull"}, targets...)...)
+	cmd.Dir = outputDir
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return fmt.Errorf("Failed to run dvc. Make sure DVC is installed: %w", err)
+		}
+		return fmt.Errorf("dvc pull failed: %w", err)
+	}
+	return nil
+}
+
+func writeDVCFile(path string, out *DVCOutput) error {
+	relPath, err := filepath.Rel(filepath.Dir(filepath.FromSlash(out.DVCFile)), filepath.FromSlash(out.Path))
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(&dvcFile{Outs: []*dvcOut{{Path: filepath.ToSlash(relPath), MD5: out.MD5}}})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDVCOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	isDVC, err := IsDVCRepository(dir)
+	require.NoError(t, err)
+	require.False(t, isDVC)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".dvc"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pipeline"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data.dvc"), []byte(`outs:
+- md5: 7b2b1b9b2e39b2e6d9bf6c0f3e0e8a1c.dir
+  size: 1234
+  nfiles: 2
+  path: data
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pipeline", "dvc.lock"), []byte(`schema: '2.0'
+stages:
+  train:
+    cmd: python train.py
+    deps:
+    - path: ../data
+      md5: 7b2b1b9b2e39b2e6d9bf6c0f3e0e8a1c.dir
+    outs:
+    - path: model.pkl
+      md5: 3f9c7e0d2a0b1c4e5f6a7b8c9d0e1f2a
+`), 0644))
+	// Hidden directories are skipped
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".dvc", "ignored.dvc"), []byte("outs:\n- md5: abc\n  path: foo\n"), 0644))
+
+	isDVC, err = IsDVCRepository(dir)
+	require.NoError(t, err)
+	require.True(t, isDVC)
+
+	outputs, err := FindDVCOutputs(dir)
+	require.NoError(t, err)
+	require.Equal(t, []*DVCOutput{{
+		Path:    "data",
+		MD5:     "7b2b1b9b2e39b2e6d9bf6c0f3e0e8a1c.dir",
+		DVCFile: "data.dvc",
+	}, {
+		Path:    "pipeline/model.pkl",
+		MD5:     "3f9c7e0d2a0b1c4e5f6a7b8c9d0e1f2a",
+		DVCFile: "pipeline/dvc.lock",
+	}}, outputs)
+
+	// A .dvc file can be rewritten from what was recorded
+	outputDir := filepath.Join(dir, "output")
+	require.NoError(t, writeDVCFile(filepath.Join(outputDir, "data.dvc"), outputs[0]))
+	outs, err := readDVCFile(filepath.Join(outputDir, "data.dvc"))
+	require.NoError(t, err)
+	require.Equal(t, []*dvcOut{{Path: "data", MD5: "7b2b1b9b2e39b2e6d9bf6c0f3e0e8a1c.dir"}}, outs)
+}
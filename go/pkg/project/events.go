@@ -0,0 +1,414 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// A running experiment doesn't rewrite its metadata in
+// metadata/experiments/<ID>.json every time it saves a checkpoint, or its
+// metric series in metrics/<ID>.json every time it saves logged metrics.
+// Rewriting the whole file wastes bandwidth as it grows, and overwrites
+// anything else that changed it in the meantime. Instead, it writes an event
+// with what changed to metadata/events/<ID>/ or metrics/events/<ID>/, and
+// readers merge the events into the file. Every eventsPerCompaction events,
+// and when the experiment is stopped, the events are compacted into the
+// file and deleted. The file records the last event in it, so events that
+// weren't deleted aren't merged twice.
+
+const (
+	experimentEventsFolder = "metadata/events"
+	metricEventsFolder     = "metrics/events"
+)
+
+// eventsPerCompaction is how many events are written before they are
+// compacted
+const eventsPerCompaction = 20
+
+// experimentEvent is what was added to an experiment's metadata when it was
+// saved
+type experimentEvent struct {
+	Checkpoints []*Checkpoint `json:"checkpoints,omitempty"`
+	Alerts      []*Alert      `json:"alerts,omitempty"`
+}
+
+// savedExperiment is an experiment as it was last saved by this project, to
+// find what was added the next time it is saved
+type savedExperiment struct {
+	data        []byte
+	checkpoints int
+	alerts      int
+}
+
+// projectEvents are the events this project has written
+type projectEvents struct {
+	mu    sync.Mutex
+	saved map[string]*savedExperiment
+	// pending is the number of events in each events directory that
+	// haven't been compacted, and lastEvents is the name of the last one
+	pending    map[string]int
+	lastEvents map[string]string
+	lastName   int64
+
+	// batchInterval is how long events are held before they are written,
+	// or 0 if they are written straight away. batches are the events that
+	// are being held for each events directory, which add up to batchSize
+	// bytes, and flushTimer writes them.
+	batchInterval time.Duration
+	batches       map[string][][]byte
+	batchSize     int
+	flushTimer    *time.Timer
+	// heartbeats are when the heartbeat of each experiment was last
+	// written
+	heartbeats map[string]time.Time
+}
+
+func eventsDir(folder string, experimentID string) string {
+	return folder + "/" + experimentID
+}
+
+// eventName returns the name of the event at eventPath. Names sort in the
+// order the events were written.
+func eventName(eventPath string) string {
+	return strings.TrimSuffix(path.Base(eventPath), ".json")
+}
+
+// writeEvent writes event to a new path in dir, or adds it to the batch of
+// events for dir if they are batched. p.events.mu must be held.
+func (p *Project) writeEvent(dir string, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if p.events.batchInterval > 0 {
+		return p.batchEvent(dir, data)
+	}
+	return p.putEvent(dir, data)
+}
+
+// putEvent writes the event data to a new path in dir. p.events.mu must be
+// held.
+func (p *Project) putEvent(dir string, data []byte) error {
+	// Names are nanosecond timestamps, and always go up, even if the
+	// clock doesn't
+	name := time.Now().UnixNano()
+	if name <= p.events.lastName {
+		name = p.events.lastName + 1
+	}
+	p.events.lastName = name
+	eventPath := fmt.Sprintf("%s/%020d.json", dir, name)
+	if err := p.requireVersion(repository.EventsVersion); err != nil {
+		return err
+	}
+	if err := p.repository.Put(eventPath, data); err != nil {
+		return err
+	}
+	if p.events.pending == nil {
+		p.events.pending = map[string]int{}
+		p.events.lastEvents = map[string]string{}
+	}
+	p.events.pending[dir]++
+	p.events.lastEvents[dir] = eventName(eventPath)
+	return nil
+}
+
+// listEvents returns the paths of the events in dir, in the order they were
+// written
+func listEvents(repo repository.Repository, dir string) ([]string, error) {
+	paths, err := repo.List(dir + "/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// listAllExperimentEvents returns the paths of the events of every
+// experiment, by experiment ID, in the order they were written
+func listAllExperimentEvents(repo repository.Repository) (map[string][]string, error) {
+	results, err := repository.ListRecursiveAll(context.Background(), repo, experimentEventsFolder)
+	if err != nil {
+		return nil, err
+	}
+	events := map[string][]string{}
+	for _, result := range results {
+		id := path.Base(path.Dir(result.Path))
+		events[id] = append(events[id], result.Path)
+	}
+	for _, paths := range events {
+		sort.Strings(paths)
+	}
+	return events, nil
+}
+
+// deleteEvents deletes the events in eventPaths up to and including the
+// one named lastEvent
+func (p *Project) deleteEvents(eventPaths []string, lastEvent string) {
+	for _, eventPath := range eventPaths {
+		if eventName(eventPath) > lastEvent {
+			continue
+		}
+		if err := p.repository.Delete(eventPath); err != nil {
+			console.Warn("Failed to delete %s: %s", eventPath, err)
+		}
+	}
+}
+
+// mergeExperimentEvents adds what was added in the events at eventPaths to
+// exp, skipping events that are already in it
+func mergeExperimentEvents(repo repository.Repository, exp *Experiment, eventPaths []string) error {
+	checkpointIDs := map[string]bool{}
+	for _, chk := range exp.Checkpoints {
+		checkpointIDs[chk.ID] = true
+	}
+	for _, eventPath := range eventPaths {
+		name := eventName(eventPath)
+		if name <= exp.LastEvent {
+			continue
+		}
+		event := new(experimentEvent)
+		if err := loadFromPath(repo, eventPath, event); err != nil {
+			// It was compacted since it was listed
+			if errors.IsDoesNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("Failed to load %s: %w", eventPath, err)
+		}
+		for _, chk := range event.Checkpoints {
+			if !checkpointIDs[chk.ID] {
+				checkpointIDs[chk.ID] = true
+				exp.Checkpoints = append(exp.Checkpoints, chk)
+			}
+		}
+		exp.Alerts = append(exp.Alerts, event.Alerts...)
+		exp.LastEvent = name
+	}
+	return nil
+}
+
+// experimentEventFor returns what was added to exp since saved, or nil if
+// anything else changed, so the whole experiment has to be saved
+func experimentEventFor(saved *savedExperiment, exp *Experiment) (*experimentEvent, error) {
+	if saved == nil || len(exp.Checkpoints) < saved.checkpoints || len(exp.Alerts) < saved.alerts {
+		return nil, nil
+	}
+	before := *exp
+	before.Checkpoints = exp.Checkpoints[:saved.checkpoints]
+	before.Alerts = exp.Alerts[:saved.alerts]
+	data, err := experimentData(&before)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data, saved.data) {
+		return nil, nil
+	}
+	return &experimentEvent{
+		Checkpoints: exp.Checkpoints[saved.checkpoints:],
+		Alerts:      exp.Alerts[saved.alerts:],
+	}, nil
+}
+
+// experimentData returns exp as JSON to compare with what was saved,
+// without the last event, which isn't kept when experiments are sent to
+// and from Python
+func experimentData(exp *Experiment) ([]byte, error) {
+	withoutEvent := *exp
+	withoutEvent.LastEvent = ""
+	return json.Marshal(&withoutEvent)
+}
+
+// saveExperimentWithEvents saves exp, writing an event if only checkpoints
+// and alerts have been added since this project last saved it, or the whole
+// experiment if anything else changed
+func (p *Project) saveExperimentWithEvents(exp *Experiment) error {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+
+	dir := eventsDir(experimentEventsFolder, exp.ID)
+	event, err := experimentEventFor(p.events.saved[exp.ID], exp)
+	if err != nil {
+		return err
+	}
+	switch {
+	case event == nil:
+		if err := p.saveExperimentAndDeleteEvents(exp); err != nil {
+			return err
+		}
+	case len(event.Checkpoints) > 0 || len(event.Alerts) > 0:
+		if err := p.writeEvent(dir, event); err != nil {
+			return err
+		}
+		if p.events.pending[dir] >= eventsPerCompaction {
+			if err := p.compactExperimentEvents(exp.ID); err != nil {
+				// The events are still there, so it is compacted next time
+				console.Warn("Failed to compact the metadata of experiment %s: %s", exp.ShortID(), err)
+			}
+		}
+	}
+
+	data, err := experimentData(exp)
+	if err != nil {
+		return err
+	}
+	if p.events.saved == nil {
+		p.events.saved = map[string]*savedExperiment{}
+	}
+	p.events.saved[exp.ID] = &savedExperiment{data: data, checkpoints: len(exp.Checkpoints), alerts: len(exp.Alerts)}
+	return nil
+}
+
+// saveExperimentAndDeleteEvents saves the whole of exp, and deletes the
+// events that are in it. p.events.mu must be held.
+func (p *Project) saveExperimentAndDeleteEvents(exp *Experiment) error {
+	dir := eventsDir(experimentEventsFolder, exp.ID)
+	// Anything in the batch is in exp
+	p.dropBatch(dir)
+	// Experiments sent from Python don't know about the events this
+	// project has written
+	if lastEvent := p.events.lastEvents[dir]; lastEvent > exp.LastEvent {
+		exp.LastEvent = lastEvent
+	}
+	if err := exp.Save(p.repository); err != nil {
+		return err
+	}
+	if exp.LastEvent == "" {
+		return nil
+	}
+	eventPaths, err := listEvents(p.repository, dir)
+	if err != nil {
+		return err
+	}
+	p.deleteEvents(eventPaths, exp.LastEvent)
+	delete(p.events.pending, dir)
+	return nil
+}
+
+// compactExperimentEvents merges the events of the experiment with ID
+// experimentID into its metadata, and deletes them. The metadata is loaded
+// from the repository, so anything else that changed it is kept. p.events.mu
+// must be held.
+func (p *Project) compactExperimentEvents(experimentID string) error {
+	dir := eventsDir(experimentEventsFolder, experimentID)
+	if err := p.flushBatch(dir); err != nil {
+		return err
+	}
+	eventPaths, err := listEvents(p.repository, dir)
+	if err != nil {
+		return err
+	}
+	if len(eventPaths) == 0 {
+		return nil
+	}
+	exp := &Experiment{ID: experimentID}
+	if err := loadFromPath(p.repository, exp.MetadataPath(), exp); err != nil {
+		return err
+	}
+	if err := mergeExperimentEvents(p.repository, exp, eventPaths); err != nil {
+		return err
+	}
+	if err := exp.Save(p.repository); err != nil {
+		return err
+	}
+	p.deleteEvents(eventPaths, exp.LastEvent)
+	delete(p.events.pending, dir)
+	return nil
+}
+
+// AppendMetricSeries adds series, the points that have been logged since
+// the metric series of exp were last saved, to them
+func (p *Project) AppendMetricSeries(exp *Experiment, series MetricSeries) error {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+
+	dir := eventsDir(metricEventsFolder, exp.ID)
+	if err := p.writeEvent(dir, &metricSeriesFile{Series: series}); err != nil {
+		return err
+	}
+	if p.events.pending[dir] >= eventsPerCompaction {
+		if err := p.compactMetricEvents(exp); err != nil {
+			console.Warn("Failed to compact the metric series of experiment %s: %s", exp.ShortID(), err)
+		}
+	}
+	return nil
+}
+
+// loadMetricSeries returns the metric series of exp, merged with their
+// events, and the paths of the events
+func (p *Project) loadMetricSeries(exp *Experiment) (*metricSeriesFile, []string, error) {
+	file := &metricSeriesFile{}
+	if err := loadFromPath(p.repository, exp.MetricsPath(), file); err != nil && !errors.IsDoesNotExist(err) {
+		return nil, nil, err
+	}
+	if file.Series == nil {
+		file.Series = MetricSeries{}
+	}
+	eventPaths, err := listEvents(p.repository, eventsDir(metricEventsFolder, exp.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, eventPath := range eventPaths {
+		name := eventName(eventPath)
+		if name <= file.LastEvent {
+			continue
+		}
+		event := &metricSeriesFile{}
+		if err := loadFromPath(p.repository, eventPath, event); err != nil {
+			if errors.IsDoesNotExist(err) {
+				continue
+			}
+			return nil, nil, fmt.Errorf("Failed to load %s: %w", eventPath, err)
+		}
+		for metric, points := range event.Series {
+			file.Series[metric] = append(file.Series[metric], points...)
+		}
+		file.LastEvent = name
+	}
+	return file, eventPaths, nil
+}
+
+// compactMetricEvents merges the events of the metric series of exp into
+// them, and deletes them. p.events.mu must be held.
+func (p *Project) compactMetricEvents(exp *Experiment) error {
+	if err := p.flushBatch(eventsDir(metricEventsFolder, exp.ID)); err != nil {
+		return err
+	}
+	file, eventPaths, err := p.loadMetricSeries(exp)
+	if err != nil {
+		return err
+	}
+	if len(eventPaths) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := p.repository.Put(exp.MetricsPath(), data); err != nil {
+		return err
+	}
+	p.deleteEvents(eventPaths, file.LastEvent)
+	delete(p.events.pending, eventsDir(metricEventsFolder, exp.ID))
+	return nil
+}
+
+// CompactEvents merges the events of the experiment with ID experimentID
+// into its metadata and metric series, and deletes them
+func (p *Project) CompactEvents(experimentID string) error {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	if err := p.compactExperimentEvents(experimentID); err != nil {
+		return err
+	}
+	return p.compactMetricEvents(&Experiment{ID: experimentID})
+}
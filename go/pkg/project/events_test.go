@@ -0,0 +1,197 @@
+package project
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestExperimentEvents(t *testing.T) {
+	projectDir, err := files.TempDir("test-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir := path.Join(projectDir, ".replicate")
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	savedMetadata := func(id string) *Experiment {
+		data, err := ioutil.ReadFile(path.Join(repoDir, "metadata", "experiments", id+".json"))
+		require.NoError(t, err)
+		exp := new(Experiment)
+		require.NoError(t, json.Unmarshal(data, exp))
+		return exp
+	}
+	countEvents := func(folder string, id string) int {
+		paths, err := repo.List(eventsDir(folder, id) + "/")
+		require.NoError(t, err)
+		return len(paths)
+	}
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 1}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk1)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// The checkpoint is added with an event, and readers merge it
+	require.Empty(t, savedMetadata(exp.ID).Checkpoints)
+	require.Equal(t, 1, countEvents(experimentEventsFolder, exp.ID))
+	other := NewProject(repo, projectDir)
+	loaded, err := other.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 1)
+	require.Equal(t, chk1.ID, loaded.Checkpoints[0].ID)
+
+	// Something else changes the metadata, which is kept when more
+	// checkpoints are added
+	loaded.Name = "renamed"
+	_, err = other.SaveExperiment(loaded, true)
+	require.NoError(t, err)
+	require.Equal(t, 0, countEvents(experimentEventsFolder, exp.ID))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 2}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk2)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	other = NewProject(repo, projectDir)
+	loaded, err = other.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "renamed", loaded.Name)
+	require.Len(t, loaded.Checkpoints, 2)
+
+	// Events are compacted when there are enough of them, counting the one
+	// that was compacted when it was renamed...
+	for i := 0; i < eventsPerCompaction-2; i++ {
+		chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: int64(i + 3)}, false, nil, true)
+		require.NoError(t, err)
+		exp.Checkpoints = append(exp.Checkpoints, chk)
+		_, err = proj.SaveExperiment(exp, true)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, countEvents(experimentEventsFolder, exp.ID))
+	saved := savedMetadata(exp.ID)
+	require.Len(t, saved.Checkpoints, eventsPerCompaction)
+	require.Equal(t, "renamed", saved.Name)
+
+	// ...and when the experiment is stopped
+	series := MetricSeries{}
+	require.NoError(t, series.Add(1, time.Now().UTC(), map[string]float64{"loss": 0.5}))
+	require.NoError(t, proj.AppendMetricSeries(exp, series))
+	series = MetricSeries{}
+	require.NoError(t, series.Add(2, time.Now().UTC(), map[string]float64{"loss": 0.25}))
+	require.NoError(t, proj.AppendMetricSeries(exp, series))
+	require.Equal(t, 2, countEvents(metricEventsFolder, exp.ID))
+	loadedSeries, err := other.MetricSeries(exp)
+	require.NoError(t, err)
+	require.Len(t, loadedSeries["loss"], 2)
+	require.Equal(t, 0.25, loadedSeries["loss"][1].Value)
+
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.StopExperiment(exp.ID))
+	require.Equal(t, 0, countEvents(experimentEventsFolder, exp.ID))
+	require.Equal(t, 0, countEvents(metricEventsFolder, exp.ID))
+	require.Len(t, savedMetadata(exp.ID).Checkpoints, eventsPerCompaction+1)
+	loadedSeries, err = other.MetricSeries(exp)
+	require.NoError(t, err)
+	require.Len(t, loadedSeries["loss"], 2)
+}
+
+func TestBatchedEvents(t *testing.T) {
+	projectDir, err := files.TempDir("test-batched-events")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetBatching(&config.Batching{IntervalSeconds: 3600})
+
+	countEvents := func(folder string, id string) int {
+		paths, err := repo.List(eventsDir(folder, id) + "/")
+		require.NoError(t, err)
+		return len(paths)
+	}
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: int64(i)}, false, nil, true)
+		require.NoError(t, err)
+		exp.Checkpoints = append(exp.Checkpoints, chk)
+		_, err = proj.SaveExperiment(exp, true)
+		require.NoError(t, err)
+		series := MetricSeries{}
+		require.NoError(t, series.Add(int64(i), time.Now().UTC(), map[string]float64{"loss": float64(i)}))
+		require.NoError(t, proj.AppendMetricSeries(exp, series))
+	}
+
+	// Nothing is written until the batch is flushed...
+	require.Equal(t, 0, countEvents(experimentEventsFolder, exp.ID))
+	require.Equal(t, 0, countEvents(metricEventsFolder, exp.ID))
+
+	// ...and then each experiment's events are written as one
+	require.NoError(t, proj.FlushEvents())
+	require.Equal(t, 1, countEvents(experimentEventsFolder, exp.ID))
+	require.Equal(t, 1, countEvents(metricEventsFolder, exp.ID))
+	other := NewProject(repo, projectDir)
+	loaded, err := other.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 3)
+	loadedSeries, err := other.MetricSeries(exp)
+	require.NoError(t, err)
+	require.Len(t, loadedSeries["loss"], 3)
+	require.Equal(t, 2.0, loadedSeries["loss"][2].Value)
+
+	// The project that holds a batch sees what is in it
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 3}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	proj.invalidateCache()
+	loaded, err = proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 4)
+
+	// Stopping the experiment writes and compacts its batch
+	chk, err = proj.CreateCheckpoint(CreateCheckpointArgs{Step: 4}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.StopExperiment(exp.ID))
+	require.Equal(t, 0, countEvents(experimentEventsFolder, exp.ID))
+	loaded, err = NewProject(repo, projectDir).ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 5)
+}
+
+func TestBatchedHeartbeats(t *testing.T) {
+	proj := NewProject(nil, "")
+	now := time.Now()
+	require.True(t, proj.heartbeatDue("abc", now))
+	require.True(t, proj.heartbeatDue("abc", now.Add(time.Second)))
+
+	proj.SetBatching(nil)
+	require.True(t, proj.heartbeatDue("abc", now))
+	require.False(t, proj.heartbeatDue("abc", now.Add(time.Second)))
+	require.True(t, proj.heartbeatDue("def", now.Add(time.Second)))
+	require.True(t, proj.heartbeatDue("abc", now.Add(heartbeatRefreshInterval)))
+	proj.forgetHeartbeat("abc")
+	require.True(t, proj.heartbeatDue("abc", now.Add(heartbeatRefreshInterval+time.Second)))
+}
@@ -16,6 +16,7 @@ import (
 // Experiment represents a training run
 type Experiment struct {
 	ID               string            `json:"id"`
+	Name             string            `json:"name,omitempty"`
 	Created          time.Time         `json:"created"`
 	Params           param.ValueMap    `json:"params"`
 	Host             string            `json:"host"`
@@ -27,6 +28,36 @@ type Experiment struct {
 	PythonPackages   map[string]string `json:"python_packages"`
 	Checkpoints      []*Checkpoint     `json:"checkpoints"`
 	ReplicateVersion string            `json:"replicate_version"`
+	DVCOutputs       []*DVCOutput      `json:"dvc_outputs,omitempty"`
+	// HostEnvironment is the operating system, architecture and CUDA
+	// version of the machine the experiment ran on
+	HostEnvironment *HostEnvironment `json:"host_environment,omitempty"`
+	// Datasets are the fingerprints of the datasets in replicate.yaml when
+	// the experiment was created
+	Datasets []*DatasetFingerprint `json:"datasets,omitempty"`
+	// Environment is the environment variables that matched the patterns
+	// in replicate.yaml when the experiment was created
+	Environment map[string]string `json:"environment,omitempty"`
+	// Seeds are the values of the random seeds in replicate.yaml
+	Seeds map[string]string `json:"seeds,omitempty"`
+	// Alerts are the alert rules that the experiment's checkpoints have
+	// triggered
+	Alerts []*Alert `json:"alerts,omitempty"`
+	// StoragePath is where the experiment's tarball is in the repository,
+	// without its extension, if it was saved with a layout in
+	// replicate.yaml. If it is empty, it is in experiments/<ID>.
+	StoragePath string `json:"storage_path,omitempty"`
+	// LastEvent is the name of the last event in metadata/events/<ID>/
+	// that has been merged into this metadata
+	LastEvent string `json:"last_event,omitempty"`
+	// Archived is set when the experiment's files have been moved to an
+	// archive storage class with `replicate archive`
+	Archived *ArchiveRecord `json:"archived,omitempty"`
+	// Sweep is the sweep the experiment was launched by, if it was
+	Sweep *SweepMembership `json:"sweep,omitempty"`
+	// Imported is where the experiment was imported from, if it was
+	// imported with `replicate import`
+	Imported *ImportRecord `json:"imported,omitempty"`
 }
 
 type NamedParam struct {
@@ -76,6 +107,9 @@ func (e *Experiment) HeartbeatPath() string {
 }
 
 func (e *Experiment) StorageTarPath() string {
+	if e.StoragePath != "" {
+		return e.StoragePath + ".tar.gz"
+	}
 	return "experiments/" + e.ID + ".tar.gz"
 }
 
@@ -98,14 +132,18 @@ func (e *Experiment) BestCheckpoint() *Checkpoint {
 	if len(e.Checkpoints) == 0 {
 		return nil
 	}
-	checkpoints := copyCheckpoints(e.Checkpoints)
-
 	// Use primary metric from first checkpoint
 	// TODO (bfirsh): warn if primary metric differs across checkpoints
-	primaryMetric := checkpoints[0].PrimaryMetric
-	if primaryMetric == nil {
+	return e.BestCheckpointBy(e.Checkpoints[0].PrimaryMetric)
+}
+
+// BestCheckpointBy returns the best checkpoint for an experiment according
+// to primaryMetric, or nil if it is nil or none of the checkpoints have it
+func (e *Experiment) BestCheckpointBy(primaryMetric *PrimaryMetric) *Checkpoint {
+	if len(e.Checkpoints) == 0 || primaryMetric == nil {
 		return nil
 	}
+	checkpoints := copyCheckpoints(e.Checkpoints)
 
 	sort.Slice(checkpoints, func(i, j int) bool {
 		iVal, iOK := checkpoints[i].Metrics[primaryMetric.Name]
@@ -145,10 +183,18 @@ func listExperiments(repo repository.Repository) ([]*Experiment, error) {
 	if err != nil {
 		return nil, err
 	}
+	events, err := listAllExperimentEvents(repo)
+	if err != nil {
+		return nil, err
+	}
 	experiments := []*Experiment{}
 	for _, p := range paths {
 		exp := new(Experiment)
-		if err := loadFromPath(repo, p, exp); err == nil {
+		err := loadFromPath(repo, p, exp)
+		if err == nil {
+			err = mergeExperimentEvents(repo, exp, events[exp.ID])
+		}
+		if err == nil {
 			experiments = append(experiments, exp)
 		} else {
 			// Should we complain more loudly? https://github.com/replicate/replicate/issues/347
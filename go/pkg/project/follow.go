@@ -0,0 +1,296 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Following a running experiment reports what it saves as it saves it. Every
+// interval, its metadata and the events of its metadata and metric series
+// (see events.go) are listed, and only the events that haven't been seen are
+// read. The metric series themselves can be large, so they are only read
+// again if the events that were listed have been compacted into them.
+
+// DefaultFollowInterval is how often a followed experiment is checked
+const DefaultFollowInterval = 2 * time.Second
+
+// FollowEvent is something a followed experiment did. One of its fields is
+// set.
+type FollowEvent struct {
+	Time time.Time `json:"time"`
+	// Metrics are the points that were logged, by metric name
+	Metrics MetricSeries `json:"metrics,omitempty"`
+	// Checkpoint was saved, and Best is whether it is now the best one
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	Best       bool        `json:"best,omitempty"`
+	Alert      *Alert      `json:"alert,omitempty"`
+	// Status is "stopped" when the experiment stops
+	Status string `json:"status,omitempty"`
+}
+
+// experimentFollower is what has been seen of a followed experiment
+type experimentFollower struct {
+	project     *Project
+	exp         *Experiment
+	checkpoints map[string]bool
+	alerts      int
+	// metadataEvents are the metadata events that have been read, by name
+	metadataEvents map[string]*experimentEvent
+	// metricPoints is how many points of each metric have been seen,
+	// lastMetricEvent is the name of the last metric event that was read,
+	// and newestMetricEvent is the newest one that was listed
+	metricPoints      map[string]int
+	lastMetricEvent   string
+	newestMetricEvent string
+}
+
+// FollowExperiment calls onEvent with what exp does until it stops or ctx is
+// done, checking every interval. exp is what has been seen of it already, as
+// it was loaded by this project. It returns straight away if exp isn't
+// running.
+func (p *Project) FollowExperiment(ctx context.Context, exp *Experiment, interval time.Duration, onEvent func(*FollowEvent) error) error {
+	running, err := p.followedExperimentIsRunning(exp.ID)
+	if err != nil || !running {
+		return err
+	}
+	f, err := p.newExperimentFollower(exp)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		running, err := p.followedExperimentIsRunning(exp.ID)
+		if err != nil {
+			return err
+		}
+		// Anything saved as it stopped is reported before it stopping
+		if err := f.poll(onEvent); err != nil {
+			return err
+		}
+		if !running {
+			return onEvent(&FollowEvent{Time: time.Now().UTC(), Status: "stopped"})
+		}
+	}
+}
+
+// newExperimentFollower returns a follower that has seen exp and its metric
+// series as they are now
+func (p *Project) newExperimentFollower(exp *Experiment) (*experimentFollower, error) {
+	f := &experimentFollower{
+		project:        p,
+		exp:            exp,
+		checkpoints:    map[string]bool{},
+		alerts:         len(exp.Alerts),
+		metadataEvents: map[string]*experimentEvent{},
+		metricPoints:   map[string]int{},
+	}
+	for _, chk := range exp.Checkpoints {
+		f.checkpoints[chk.ID] = true
+	}
+	if _, err := f.reloadMetricSeries(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// followedExperimentIsRunning reads the heartbeat of the experiment with ID
+// experimentID, rather than the heartbeats loaded with the project
+func (p *Project) followedExperimentIsRunning(experimentID string) (bool, error) {
+	heartbeat, err := loadHeartbeatFromPath(p.repository, heartbeatPath(experimentID))
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return heartbeat.IsRunning(), nil
+}
+
+// poll calls onEvent with what has been saved since it was last called
+func (f *experimentFollower) poll(onEvent func(*FollowEvent) error) error {
+	metrics, err := f.newMetricPoints()
+	if err != nil {
+		return err
+	}
+	if len(metrics) > 0 {
+		if err := onEvent(&FollowEvent{Time: lastPointTime(metrics), Metrics: metrics}); err != nil {
+			return err
+		}
+	}
+
+	exp, err := f.loadExperiment()
+	if err != nil {
+		return err
+	}
+	f.exp = exp
+	best := exp.BestCheckpoint()
+	for _, chk := range exp.Checkpoints {
+		if f.checkpoints[chk.ID] {
+			continue
+		}
+		f.checkpoints[chk.ID] = true
+		event := &FollowEvent{Time: chk.Created, Checkpoint: chk, Best: best != nil && best.ID == chk.ID}
+		if err := onEvent(event); err != nil {
+			return err
+		}
+	}
+	if len(exp.Alerts) > f.alerts {
+		for _, alert := range exp.Alerts[f.alerts:] {
+			if err := onEvent(&FollowEvent{Time: alert.Triggered, Alert: alert}); err != nil {
+				return err
+			}
+		}
+		f.alerts = len(exp.Alerts)
+	}
+	return nil
+}
+
+// loadExperiment loads the experiment's metadata and merges its events into
+// it, reading only the events that haven't been read before
+func (f *experimentFollower) loadExperiment() (*Experiment, error) {
+	repo := f.project.repository
+	exp := &Experiment{ID: f.exp.ID}
+	if err := loadFromPath(repo, exp.MetadataPath(), exp); err != nil {
+		return nil, err
+	}
+	eventPaths, err := listEvents(repo, eventsDir(experimentEventsFolder, exp.ID))
+	if err != nil {
+		return nil, err
+	}
+	checkpointIDs := map[string]bool{}
+	for _, chk := range exp.Checkpoints {
+		checkpointIDs[chk.ID] = true
+	}
+	listed := map[string]bool{}
+	for _, eventPath := range eventPaths {
+		name := eventName(eventPath)
+		listed[name] = true
+		if name <= exp.LastEvent {
+			continue
+		}
+		event, ok := f.metadataEvents[name]
+		if !ok {
+			event = new(experimentEvent)
+			if err := loadFromPath(repo, eventPath, event); err != nil {
+				// It was compacted since it was listed, so it is in
+				// the metadata next time
+				if errors.IsDoesNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("Failed to load %s: %w", eventPath, err)
+			}
+			f.metadataEvents[name] = event
+		}
+		for _, chk := range event.Checkpoints {
+			if !checkpointIDs[chk.ID] {
+				checkpointIDs[chk.ID] = true
+				exp.Checkpoints = append(exp.Checkpoints, chk)
+			}
+		}
+		exp.Alerts = append(exp.Alerts, event.Alerts...)
+		exp.LastEvent = name
+	}
+	// Forget events that have been deleted
+	for name := range f.metadataEvents {
+		if !listed[name] {
+			delete(f.metadataEvents, name)
+		}
+	}
+	return exp, nil
+}
+
+// newMetricPoints returns the metric points that have been logged since it
+// was last called
+func (f *experimentFollower) newMetricPoints() (MetricSeries, error) {
+	repo := f.project.repository
+	eventPaths, err := listEvents(repo, eventsDir(metricEventsFolder, f.exp.ID))
+	if err != nil {
+		return nil, err
+	}
+	// Events are only deleted when they are compacted, so if the newest
+	// one that was listed last time has gone, the events that were
+	// listed have been compacted, including any that weren't read
+	compacted := f.newestMetricEvent != ""
+	for _, eventPath := range eventPaths {
+		if eventName(eventPath) == f.newestMetricEvent {
+			compacted = false
+		}
+	}
+	if compacted {
+		return f.reloadMetricSeries()
+	}
+
+	newPoints := MetricSeries{}
+	for _, eventPath := range eventPaths {
+		name := eventName(eventPath)
+		if name <= f.lastMetricEvent {
+			continue
+		}
+		event := &metricSeriesFile{}
+		if err := loadFromPath(repo, eventPath, event); err != nil {
+			if errors.IsDoesNotExist(err) {
+				// It was compacted since it was listed
+				return f.reloadMetricSeries()
+			}
+			return nil, fmt.Errorf("Failed to load %s: %w", eventPath, err)
+		}
+		for name, points := range event.Series {
+			newPoints[name] = append(newPoints[name], points...)
+			f.metricPoints[name] += len(points)
+		}
+		f.lastMetricEvent = name
+	}
+	f.newestMetricEvent = newestEvent(eventPaths)
+	return newPoints, nil
+}
+
+// reloadMetricSeries reads the whole metric series, and returns the points
+// that haven't been seen
+func (f *experimentFollower) reloadMetricSeries() (MetricSeries, error) {
+	file, eventPaths, err := f.project.loadMetricSeries(f.exp)
+	if err != nil {
+		return nil, err
+	}
+	newPoints := MetricSeries{}
+	for name, points := range file.Series {
+		if n := f.metricPoints[name]; len(points) > n {
+			newPoints[name] = points[n:]
+		}
+		f.metricPoints[name] = len(points)
+	}
+	f.lastMetricEvent = file.LastEvent
+	f.newestMetricEvent = newestEvent(eventPaths)
+	return newPoints, nil
+}
+
+// newestEvent returns the name of the last of eventPaths, or an empty string
+// if there aren't any
+func newestEvent(eventPaths []string) string {
+	if len(eventPaths) == 0 {
+		return ""
+	}
+	return eventName(eventPaths[len(eventPaths)-1])
+}
+
+// lastPointTime returns the time the last of the points in series was logged
+func lastPointTime(series MetricSeries) time.Time {
+	var last time.Time
+	for _, points := range series {
+		for _, point := range points {
+			if point.Timestamp.After(last) {
+				last = point.Timestamp
+			}
+		}
+	}
+	return last
+}
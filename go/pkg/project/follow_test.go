@@ -0,0 +1,89 @@
+package project
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestFollowExperiment(t *testing.T) {
+	projectDir, err := files.TempDir("test-follow")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, CreateHeartbeat(repo, exp.ID, time.Now().UTC()))
+	logged := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := MetricSeries{}
+	require.NoError(t, series.Add(1, logged, map[string]float64{"loss": 0.5}))
+	require.NoError(t, proj.AppendMetricSeries(exp, series))
+
+	// What has been saved already isn't reported
+	viewer := NewProject(repo, projectDir)
+	followed, err := viewer.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	f, err := viewer.newExperimentFollower(followed)
+	require.NoError(t, err)
+	events := []*FollowEvent{}
+	onEvent := func(event *FollowEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	require.NoError(t, f.poll(onEvent))
+	require.Empty(t, events)
+
+	// New metrics and checkpoints are
+	series = MetricSeries{}
+	require.NoError(t, series.Add(2, logged.Add(time.Second), map[string]float64{"loss": 0.25}))
+	require.NoError(t, proj.AppendMetricSeries(exp, series))
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 2, Metrics: map[string]param.Value{"loss": param.Float(0.25)}}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.NoError(t, f.poll(onEvent))
+	require.Len(t, events, 2)
+	require.Equal(t, logged.Add(time.Second), events[0].Time)
+	require.Equal(t, []MetricPoint{{Step: 2, Timestamp: logged.Add(time.Second), Value: 0.25}}, events[0].Metrics["loss"])
+	require.Equal(t, chk.ID, events[1].Checkpoint.ID)
+
+	// Points that were compacted before they were read are reported once
+	events = nil
+	series = MetricSeries{}
+	require.NoError(t, series.Add(3, logged.Add(2*time.Second), map[string]float64{"loss": 0.125}))
+	require.NoError(t, proj.AppendMetricSeries(exp, series))
+	require.NoError(t, proj.CompactEvents(exp.ID))
+	require.NoError(t, f.poll(onEvent))
+	require.Len(t, events, 1)
+	require.Equal(t, []MetricPoint{{Step: 3, Timestamp: logged.Add(2 * time.Second), Value: 0.125}}, events[0].Metrics["loss"])
+	events = nil
+	require.NoError(t, f.poll(onEvent))
+	require.Empty(t, events)
+
+	// Following stops when the experiment does
+	require.NoError(t, proj.StopExperiment(exp.ID))
+	events = nil
+	require.NoError(t, viewer.FollowExperiment(context.Background(), followed, time.Millisecond, onEvent))
+	require.Empty(t, events)
+	require.NoError(t, CreateHeartbeat(repo, exp.ID, time.Now().UTC()))
+	done := make(chan error)
+	go func() {
+		done <- viewer.FollowExperiment(context.Background(), followed, 10*time.Millisecond, onEvent)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, DeleteHeartbeat(repo, exp.ID))
+	require.NoError(t, <-done)
+	require.Equal(t, "stopped", events[len(events)-1].Status)
+}
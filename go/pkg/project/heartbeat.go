@@ -31,11 +31,15 @@ func CreateHeartbeat(repo repository.Repository, experimentID string, t time.Tim
 	if err != nil {
 		return err
 	}
-	return repo.Put(path.Join("metadata", "heartbeats", experimentID+".json"), data)
+	return repo.Put(heartbeatPath(experimentID), data)
 }
 
 func DeleteHeartbeat(repo repository.Repository, experimentID string) error {
-	return repo.Delete(path.Join("metadata", "heartbeats", experimentID+".json"))
+	return repo.Delete(heartbeatPath(experimentID))
+}
+
+func heartbeatPath(experimentID string) string {
+	return path.Join("metadata", "heartbeats", experimentID+".json")
 }
 
 func listHeartbeats(repo repository.Repository) ([]*Heartbeat, error) {
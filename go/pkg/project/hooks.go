@@ -0,0 +1,135 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// SetHooks sets the shell commands that are run when experiments are
+// checkpointed or end
+func (p *Project) SetHooks(hooks *config.Hooks) {
+	p.hooks = hooks
+}
+
+// InBackground runs work on its own goroutine, so slow hooks and signing
+// don't hold up the uploads queued after them. If it fails, a warning is
+// shown, because whatever it is run for has been saved already.
+// WaitForBackground waits for it to finish.
+func (p *Project) InBackground(work func() error) {
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+		if err := work(); err != nil {
+			console.Warn("%v", err)
+		}
+	}()
+}
+
+// WaitForBackground waits for everything started with InBackground to
+// finish
+func (p *Project) WaitForBackground() {
+	p.background.Wait()
+}
+
+// RunCheckpointHook runs the on_checkpoint hook, if there is one, for a
+// checkpoint of exp. It should be called after the checkpoint's files have
+// been saved.
+func (p *Project) RunCheckpointHook(exp *Experiment, chk *Checkpoint) error {
+	if p.hooks == nil || p.hooks.OnCheckpoint == "" {
+		return nil
+	}
+	env, err := p.experimentHookEnv(exp)
+	if err != nil {
+		return err
+	}
+	metrics, err := json.Marshal(chk.Metrics)
+	if err != nil {
+		return err
+	}
+	env = append(env,
+		"REPLICATE_CHECKPOINT_ID="+chk.ID,
+		"REPLICATE_CHECKPOINT_STEP="+strconv.FormatInt(chk.Step, 10),
+		"REPLICATE_CHECKPOINT_PATH="+chk.Path,
+		"REPLICATE_CHECKPOINT_METRICS="+string(metrics),
+	)
+	if chk.PrimaryMetric != nil {
+		env = append(env,
+			"REPLICATE_CHECKPOINT_PRIMARY_METRIC="+chk.PrimaryMetric.Name,
+			"REPLICATE_CHECKPOINT_PRIMARY_METRIC_GOAL="+string(chk.PrimaryMetric.Goal),
+		)
+	}
+	return p.runHook("on_checkpoint", p.hooks.OnCheckpoint, env)
+}
+
+// RunExperimentEndHook runs the on_experiment_end hook, if there is one
+func (p *Project) RunExperimentEndHook(exp *Experiment) error {
+	if p.hooks == nil || p.hooks.OnExperimentEnd == "" {
+		return nil
+	}
+	env, err := p.experimentHookEnv(exp)
+	if err != nil {
+		return err
+	}
+	env = append(env, "REPLICATE_EXPERIMENT_NUM_CHECKPOINTS="+strconv.Itoa(len(exp.Checkpoints)))
+	if chk := exp.LatestCheckpoint(); chk != nil {
+		env = append(env, "REPLICATE_LATEST_CHECKPOINT_ID="+chk.ID)
+	}
+	if chk := exp.BestCheckpoint(); chk != nil {
+		env = append(env, "REPLICATE_BEST_CHECKPOINT_ID="+chk.ID)
+	}
+	return p.runHook("on_experiment_end", p.hooks.OnExperimentEnd, env)
+}
+
+func (p *Project) experimentHookEnv(exp *Experiment) ([]string, error) {
+	params, err := json.Marshal(exp.Params)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"REPLICATE_PROJECT_DIR=" + p.directory,
+		"REPLICATE_REPOSITORY=" + p.repository.RootURL(),
+		"REPLICATE_EXPERIMENT_ID=" + exp.ID,
+		"REPLICATE_EXPERIMENT_NAME=" + exp.Name,
+		"REPLICATE_EXPERIMENT_COMMAND=" + exp.Command,
+		"REPLICATE_EXPERIMENT_USER=" + exp.User,
+		"REPLICATE_EXPERIMENT_PARAMS=" + string(params),
+	}, nil
+}
+
+// runHook runs command with the shell, killing it if it takes longer than
+// the hooks' timeout
+func (p *Project) runHook(name string, command string, env []string) error {
+	console.Debug("Running %s hook: %s", name, command)
+	timeout := p.hooks.Timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = p.directory
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("The %s hook was stopped because it took longer than %s. Set 'timeout_seconds' in 'hooks' in replicate.yaml to give it longer.", name, timeout)
+		}
+		return fmt.Errorf("The %s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// shellCommand returns a command that runs command with the shell, which is
+// cmd on Windows and sh everywhere else
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
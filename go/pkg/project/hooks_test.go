@@ -0,0 +1,100 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestHooks(t *testing.T) {
+	projectDir, err := files.TempDir("test-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	chk := &Checkpoint{
+		ID:            "2ccccccccc",
+		Step:          3,
+		Path:          "model.pth",
+		Metrics:       param.ValueMap{"loss": param.Float(0.5)},
+		PrimaryMetric: &PrimaryMetric{Name: "loss", Goal: GoalMinimize},
+	}
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Name:        "brave-falcon-42",
+		Command:     "train.py",
+		Params:      param.ValueMap{"lr": param.Float(0.01)},
+		Checkpoints: []*Checkpoint{chk},
+	}
+
+	// No hooks
+	require.NoError(t, proj.RunCheckpointHook(exp, chk))
+	require.NoError(t, proj.RunExperimentEndHook(exp))
+
+	proj.SetHooks(&config.Hooks{
+		OnCheckpoint:    "env | grep ^REPLICATE_ | LC_ALL=C sort > checkpoint.txt",
+		OnExperimentEnd: "env | grep ^REPLICATE_ | LC_ALL=C sort > end.txt",
+	})
+	require.NoError(t, proj.RunCheckpointHook(exp, chk))
+	require.NoError(t, proj.RunExperimentEndHook(exp))
+
+	data, err := ioutil.ReadFile(path.Join(projectDir, "checkpoint.txt"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"REPLICATE_CHECKPOINT_ID=2ccccccccc",
+		`REPLICATE_CHECKPOINT_METRICS={"loss":0.5}`,
+		"REPLICATE_CHECKPOINT_PATH=model.pth",
+		"REPLICATE_CHECKPOINT_PRIMARY_METRIC=loss",
+		"REPLICATE_CHECKPOINT_PRIMARY_METRIC_GOAL=minimize",
+		"REPLICATE_CHECKPOINT_STEP=3",
+		"REPLICATE_EXPERIMENT_COMMAND=train.py",
+		"REPLICATE_EXPERIMENT_ID=1eeeeeeeee",
+		"REPLICATE_EXPERIMENT_NAME=brave-falcon-42",
+		`REPLICATE_EXPERIMENT_PARAMS={"lr":0.01}`,
+		"REPLICATE_EXPERIMENT_USER=",
+		"REPLICATE_PROJECT_DIR=" + projectDir,
+		"REPLICATE_REPOSITORY=file://" + path.Join(projectDir, ".replicate"),
+	}, strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+	data, err = ioutil.ReadFile(path.Join(projectDir, "end.txt"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "REPLICATE_EXPERIMENT_ID=1eeeeeeeee\n")
+	require.Contains(t, string(data), "REPLICATE_EXPERIMENT_NUM_CHECKPOINTS=1\n")
+	require.Contains(t, string(data), "REPLICATE_BEST_CHECKPOINT_ID=2ccccccccc\n")
+	require.Contains(t, string(data), "REPLICATE_LATEST_CHECKPOINT_ID=2ccccccccc\n")
+
+	proj.SetHooks(&config.Hooks{OnCheckpoint: "exit 1"})
+	require.EqualError(t, proj.RunCheckpointHook(exp, chk), "The on_checkpoint hook failed: exit status 1")
+
+	// Hooks that take too long are killed
+	proj.SetHooks(&config.Hooks{OnCheckpoint: "sleep 10", TimeoutSeconds: 1})
+	start := time.Now()
+	err = proj.RunCheckpointHook(exp, chk)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "took longer than 1s")
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	// Hooks run in the background don't block
+	proj.SetHooks(&config.Hooks{OnCheckpoint: "sleep 1 && touch background.txt"})
+	proj.InBackground(func() error {
+		return proj.RunCheckpointHook(exp, chk)
+	})
+	_, err = os.Stat(path.Join(projectDir, "background.txt"))
+	require.True(t, os.IsNotExist(err))
+	proj.WaitForBackground()
+	_, err = os.Stat(path.Join(projectDir, "background.txt"))
+	require.NoError(t, err)
+}
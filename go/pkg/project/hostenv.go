@@ -0,0 +1,167 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The operating system, architecture and CUDA version of the machine an
+// experiment ran on are recorded when it is created. When a checkpoint is
+// checked out, they are compared with the machine it is checked out on,
+// along with the Python version, because a model saved with one often can't
+// be loaded with another.
+
+// HostEnvironment is what the machine an experiment ran on had that can stop
+// its models being loaded elsewhere
+type HostEnvironment struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// CUDAVersion is empty if the machine doesn't have CUDA
+	CUDAVersion string `json:"cuda_version,omitempty"`
+}
+
+// hostCommandTimeout is how long nvidia-smi and python can take to say what
+// version they are
+const hostCommandTimeout = 10 * time.Second
+
+var (
+	currentHostEnvironmentOnce sync.Once
+	currentHostEnvironment     *HostEnvironment
+)
+
+// CurrentHostEnvironment returns the environment of this machine
+func CurrentHostEnvironment() *HostEnvironment {
+	currentHostEnvironmentOnce.Do(func() {
+		currentHostEnvironment = &HostEnvironment{
+			OS:          runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			CUDAVersion: detectCUDAVersion(),
+		}
+	})
+	return currentHostEnvironment
+}
+
+var (
+	cudaVersionTextRegexp = regexp.MustCompile(`CUDA Version:? *([0-9]+(\.[0-9]+)*)`)
+	pythonVersionRegexp   = regexp.MustCompile(`Python ([0-9]+(\.[0-9]+)*)`)
+)
+
+// detectCUDAVersion returns the version of CUDA on this machine, or "" if it
+// doesn't have it. It is the version NVIDIA's images set in $CUDA_VERSION,
+// the version of the toolkit in /usr/local/cuda, or the version the driver
+// supports, whichever is found first.
+func detectCUDAVersion() string {
+	if v := os.Getenv("CUDA_VERSION"); v != "" {
+		return v
+	}
+	if data, err := ioutil.ReadFile("/usr/local/cuda/version.json"); err == nil {
+		if v := parseCUDAVersionJSON(data); v != "" {
+			return v
+		}
+	}
+	if data, err := ioutil.ReadFile("/usr/local/cuda/version.txt"); err == nil {
+		if v := parseCUDAVersionText(string(data)); v != "" {
+			return v
+		}
+	}
+	if out, err := hostCommandOutput("nvidia-smi"); err == nil {
+		return parseCUDAVersionText(out)
+	}
+	return ""
+}
+
+// parseCUDAVersionJSON returns the version in the version.json file of a
+// CUDA toolkit
+func parseCUDAVersionJSON(data []byte) string {
+	version := struct {
+		CUDA struct {
+			Version string `json:"version"`
+		} `json:"cuda"`
+	}{}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return ""
+	}
+	return version.CUDA.Version
+}
+
+// parseCUDAVersionText returns the version in the version.txt file of a CUDA
+// toolkit, or in the output of nvidia-smi
+func parseCUDAVersionText(s string) string {
+	if match := cudaVersionTextRegexp.FindStringSubmatch(s); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// CurrentPythonVersion returns the version of the Python on this machine's
+// path, or "" if there isn't one
+func CurrentPythonVersion() string {
+	for _, name := range []string{"python", "python3"} {
+		out, err := hostCommandOutput(name, "--version")
+		if err != nil {
+			continue
+		}
+		if match := pythonVersionRegexp.FindStringSubmatch(out); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// hostCommandOutput returns the output of a command that says what version
+// something is, including what it writes to stderr, because Python 2 writes
+// its version there
+func hostCommandOutput(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hostCommandTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	return string(out), err
+}
+
+// HostEnvironmentMismatches returns the differences between the machine exp
+// ran on and this one, with the environment current and Python version
+// pythonVersion, that are likely to stop exp's models being loaded. Anything
+// that wasn't recorded, or that isn't known about this machine, isn't
+// compared.
+func HostEnvironmentMismatches(exp *Experiment, current *HostEnvironment, pythonVersion string) []string {
+	mismatches := []string{}
+	if recorded := exp.HostEnvironment; recorded != nil {
+		if recorded.OS != current.OS || recorded.Arch != current.Arch {
+			mismatches = append(mismatches, fmt.Sprintf("Experiment %s ran on %s/%s, but this machine is %s/%s", exp.ShortID(), recorded.OS, recorded.Arch, current.OS, current.Arch))
+		}
+		switch {
+		case recorded.CUDAVersion == "":
+		case current.CUDAVersion == "":
+			mismatches = append(mismatches, fmt.Sprintf("Experiment %s ran with CUDA %s, but this machine doesn't have CUDA, so models saved on a GPU have to be loaded onto the CPU", exp.ShortID(), recorded.CUDAVersion))
+		case majorVersion(recorded.CUDAVersion) != majorVersion(current.CUDAVersion):
+			mismatches = append(mismatches, fmt.Sprintf("Experiment %s ran with CUDA %s, but this machine has CUDA %s", exp.ShortID(), recorded.CUDAVersion, current.CUDAVersion))
+		}
+	}
+	if exp.PythonVersion != "" && pythonVersion != "" && minorVersion(exp.PythonVersion) != minorVersion(pythonVersion) {
+		mismatches = append(mismatches, fmt.Sprintf("Experiment %s ran with Python %s, but this machine has Python %s", exp.ShortID(), exp.PythonVersion, pythonVersion))
+	}
+	return mismatches
+}
+
+// majorVersion returns the major part of a version like "11.2.1"
+func majorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
+
+// minorVersion returns the major and minor parts of a version like "3.8.5"
+func minorVersion(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
@@ -0,0 +1,39 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCUDAVersion(t *testing.T) {
+	require.Equal(t, "11.2.1", parseCUDAVersionJSON([]byte(`{"cuda": {"name": "CUDA SDK", "version": "11.2.1"}}`)))
+	require.Equal(t, "", parseCUDAVersionJSON([]byte(`not json`)))
+	require.Equal(t, "10.2.89", parseCUDAVersionText("CUDA Version 10.2.89\n"))
+	require.Equal(t, "11.2", parseCUDAVersionText("| NVIDIA-SMI 460.32.03    Driver Version: 460.32.03    CUDA Version: 11.2     |"))
+	require.Equal(t, "", parseCUDAVersionText("command not found"))
+}
+
+func TestHostEnvironmentMismatches(t *testing.T) {
+	exp := &Experiment{
+		ID:              "1eeeeeeeee",
+		PythonVersion:   "3.8.5",
+		HostEnvironment: &HostEnvironment{OS: "linux", Arch: "amd64", CUDAVersion: "11.2.1"},
+	}
+
+	// Patch versions don't matter
+	require.Empty(t, HostEnvironmentMismatches(exp, &HostEnvironment{OS: "linux", Arch: "amd64", CUDAVersion: "11.0"}, "3.8.10"))
+	// Nor does anything that isn't known about this machine
+	require.Empty(t, HostEnvironmentMismatches(exp, &HostEnvironment{OS: "linux", Arch: "amd64", CUDAVersion: "11.1"}, ""))
+
+	mismatches := HostEnvironmentMismatches(exp, &HostEnvironment{OS: "darwin", Arch: "arm64"}, "3.9.1")
+	require.Equal(t, []string{
+		"Experiment 1eeeeee ran on linux/amd64, but this machine is darwin/arm64",
+		"Experiment 1eeeeee ran with CUDA 11.2.1, but this machine doesn't have CUDA, so models saved on a GPU have to be loaded onto the CPU",
+		"Experiment 1eeeeee ran with Python 3.8.5, but this machine has Python 3.9.1",
+	}, mismatches)
+	require.Len(t, HostEnvironmentMismatches(exp, &HostEnvironment{OS: "linux", Arch: "amd64", CUDAVersion: "10.2"}, "3.8.5"), 1)
+
+	// Experiments from before it was recorded only have a Python version
+	require.Empty(t, HostEnvironmentMismatches(&Experiment{ID: "2eeeeeeeee"}, &HostEnvironment{OS: "darwin", Arch: "arm64"}, "3.9.1"))
+}
@@ -0,0 +1,38 @@
+package project
+
+import (
+	"fmt"
+)
+
+// ImportRecord is the run in another tool that an experiment was imported
+// from
+type ImportRecord struct {
+	// Source is the tool the run was imported from, e.g. "wandb"
+	Source string `json:"source"`
+	RunID  string `json:"run_id"`
+	// State is the state of the run when it was imported, if the tool
+	// records one, e.g. "running" or "finished"
+	State string `json:"state,omitempty"`
+}
+
+// ImportExperiment saves an experiment that was created outside of
+// replicate, e.g. converted from another tool. If filesDir is not empty, the
+// files in it are saved as the experiment's files.
+//
+// It returns an error if an experiment with the same ID already exists.
+func (p *Project) ImportExperiment(exp *Experiment, filesDir string) error {
+	if err := p.ensureSpec(); err != nil {
+		return err
+	}
+	if existing, err := p.ExperimentByID(exp.ID); err == nil && existing != nil {
+		return fmt.Errorf("Experiment %s already exists", exp.ShortID())
+	}
+	if filesDir != "" {
+		exp.Path = "."
+		if err := p.repository.PutPathTar(filesDir, exp.StorageTarPath(), exp.Path); err != nil {
+			return err
+		}
+	}
+	_, err := p.SaveExperiment(exp, true)
+	return err
+}
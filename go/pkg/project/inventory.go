@@ -0,0 +1,56 @@
+package project
+
+import (
+	"context"
+	"path"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// SetInventory makes maintenance that needs to know everything in the
+// repository, like Verify and PlanPrune, read inv instead of listing the
+// repository. If inv is nil, the repository is listed.
+func (p *Project) SetInventory(inv *repository.Inventory) {
+	p.inventory = inv
+}
+
+// listRecursiveAll lists the files in each of folders, from the inventory if
+// there is one
+func (p *Project) listRecursiveAll(folders ...string) ([]repository.ListResult, error) {
+	if p.inventory != nil {
+		return p.inventory.ListRecursiveAll(p.repository.RootURL(), folders...)
+	}
+	return repository.ListRecursiveAll(context.Background(), p.repository, folders...)
+}
+
+// isListed returns whether objectPath is in checksums, which are the results
+// of listRecursiveAll. An inventory doesn't have the objects saved since it
+// was made, so if there is one, objects that aren't in it are looked for in
+// the repository. If that fails, the object is assumed to be there, so
+// reading it finds out.
+func (p *Project) isListed(checksums map[string][]byte, objectPath string) bool {
+	if _, ok := checksums[objectPath]; ok {
+		return true
+	}
+	if p.inventory == nil {
+		return false
+	}
+	return p.objectExists(objectPath, true)
+}
+
+// objectExists returns whether objectPath is in the repository, or
+// otherwise if it can't be listed
+func (p *Project) objectExists(objectPath string, otherwise bool) bool {
+	paths, err := p.repository.List(path.Dir(objectPath))
+	if err != nil {
+		console.Debug("Failed to look for %s: %s", objectPath, err)
+		return otherwise
+	}
+	for _, listedPath := range paths {
+		if listedPath == objectPath {
+			return true
+		}
+	}
+	return false
+}
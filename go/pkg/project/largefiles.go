@@ -0,0 +1,460 @@
+package project
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/hash"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// With large files turned on, files in checkpoints above a size are stored
+// once each in blobs/, named by the hash of their contents, in the same way
+// as Git LFS. The checkpoint's tarball has a small pointer file in place of
+// each of them, so tarballs stay small and quick to download, and a file that
+// is the same in several checkpoints is only stored once. Pointer files are
+// replaced with the files they point to when they are checked out, unless the
+// project is set to leave them.
+
+// pointerVersion is the first line of a pointer file
+const pointerVersion = "https://replicate.ai/spec/large-file/v1"
+
+// maxPointerSize is the biggest a pointer file can be. Bigger files aren't
+// read to find out whether they are one.
+const maxPointerSize = 1024
+
+// pointer is the contents of a pointer file
+type pointer struct {
+	algorithm string
+	hash      string
+	size      int64
+}
+
+func blobPath(hash string) string {
+	return path.Join("blobs", hash[:2], hash)
+}
+
+func (ptr *pointer) String() string {
+	return fmt.Sprintf("version %s\noid %s:%s\nsize %d\n", pointerVersion, ptr.algorithm, ptr.hash, ptr.size)
+}
+
+// parsePointer returns the pointer in data, or nil if it isn't a pointer file
+func parsePointer(data []byte) *pointer {
+	if len(data) > maxPointerSize {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "version "+pointerVersion {
+		return nil
+	}
+	if !strings.HasPrefix(lines[1], "oid ") || !strings.HasPrefix(lines[2], "size ") {
+		return nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(lines[1], "oid "), ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	algorithm, oid := parts[0], parts[1]
+	h, err := hash.New(algorithm)
+	if err != nil {
+		return nil
+	}
+	if _, err := hex.DecodeString(oid); err != nil || len(oid) != 2*h.Size() {
+		return nil
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(lines[2], "size "), 10, 64)
+	if err != nil || size < 0 {
+		return nil
+	}
+	return &pointer{algorithm: algorithm, hash: oid, size: size}
+}
+
+// SetLargeFiles sets the settings for storing large files in checkpoints as
+// pointer files. Large files are stored in checkpoints' tarballs if largeFiles
+// is nil.
+func (p *Project) SetLargeFiles(largeFiles *config.LargeFiles) {
+	p.largeFiles = largeFiles
+}
+
+// SetCheckoutPointers leaves pointer files in place of large files when
+// checkpoints are checked out, rather than downloading the files
+func (p *Project) SetCheckoutPointers(checkoutPointers bool) {
+	p.checkoutPointers = checkoutPointers
+}
+
+// selectPointerFiles sets chk.PointerFiles to the files in the snapshot in
+// tempDir that are big enough to be stored as large files. It is called
+// before unchanged files are removed from the snapshot, so files that are
+// referenced in earlier checkpoints are included.
+func (p *Project) selectPointerFiles(chk *Checkpoint, tempDir string) error {
+	if p.largeFiles == nil {
+		return nil
+	}
+	minSize := p.largeFiles.MinFileSize()
+	return filepath.Walk(filepath.Join(tempDir, chk.Path), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() < minSize {
+			return nil
+		}
+		relPath, err := filepath.Rel(tempDir, currentPath)
+		if err != nil {
+			return err
+		}
+		chk.PointerFiles = append(chk.PointerFiles, filepath.ToSlash(relPath))
+		return nil
+	})
+}
+
+// isPointerFile returns whether filePath is stored as a large file in chk
+func (c *Checkpoint) isPointerFile(filePath string) bool {
+	for _, p := range c.PointerFiles {
+		if p == filePath {
+			return true
+		}
+	}
+	return false
+}
+
+// putPointerFiles uploads the files in chk.PointerFiles that are in the
+// snapshot in tempDir to blobs/, unless they are already there, and replaces
+// them in the snapshot with pointer files
+func (p *Project) putPointerFiles(chk *Checkpoint, tempDir string) error {
+	if len(chk.PointerFiles) == 0 {
+		return nil
+	}
+	if err := p.requireVersion(repository.LargeFilesVersion); err != nil {
+		return err
+	}
+	uploaded := 0
+	for _, relPath := range chk.PointerFiles {
+		localPath := filepath.Join(tempDir, filepath.FromSlash(relPath))
+		if exists, err := files.FileExists(localPath); err != nil {
+			return err
+		} else if !exists {
+			// It hasn't changed since an earlier checkpoint, which has
+			// the pointer file
+			continue
+		}
+		ptr, didUpload, err := p.putBlob(localPath)
+		if err != nil {
+			return fmt.Errorf("Failed to upload %s: %w", relPath, err)
+		}
+		if didUpload {
+			uploaded++
+		}
+		if err := ioutil.WriteFile(localPath, []byte(ptr.String()), 0644); err != nil {
+			return err
+		}
+	}
+	if uploaded > 0 {
+		console.Debug("Uploaded %d large files for checkpoint %s", uploaded, chk.ShortID())
+	}
+	return nil
+}
+
+// putBlob uploads the file at localPath to blobs/ if it isn't there already,
+// and returns a pointer to it and whether it was uploaded
+func (p *Project) putBlob(localPath string) (*pointer, bool, error) {
+	ptr, err := hashFile(localPath, p.contentHash())
+	if err != nil {
+		return nil, false, err
+	}
+	paths, err := p.repository.List(path.Dir(blobPath(ptr.hash)))
+	if err != nil {
+		return nil, false, err
+	}
+	for _, objectPath := range paths {
+		if objectPath == blobPath(ptr.hash) {
+			return ptr, false, nil
+		}
+	}
+	if err := p.repository.PutPath(localPath, blobPath(ptr.hash)); err != nil {
+		return nil, false, err
+	}
+	return ptr, true, nil
+}
+
+func hashFile(localPath string, algorithm string) (*pointer, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := hash.New(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &pointer{algorithm: algorithm, hash: hex.EncodeToString(h.Sum(nil)), size: size}, nil
+}
+
+// checkoutPointerFiles replaces the pointer files in chk that have been
+// checked out to outputDir with the files they point to. If includePath isn't
+// empty, only files at or inside it are replaced. Files that aren't pointer
+// files are left alone, because they were saved before large files were
+// turned on.
+func (p *Project) checkoutPointerFiles(chk *Checkpoint, outputDir string, includePath string) error {
+	if p.checkoutPointers || len(chk.PointerFiles) == 0 {
+		return nil
+	}
+	filePaths := chk.PointerFiles
+	if includePath != "" {
+		filePaths = filterPaths(filePaths, path.Clean(includePath))
+	}
+	filePaths = p.filterCheckoutTrees(chk, filePaths)
+	for _, filePath := range filePaths {
+		localPath := filepath.Join(outputDir, filepath.FromSlash(filePath))
+		ptr, err := readPointerFile(localPath)
+		if err != nil {
+			return err
+		}
+		if ptr == nil {
+			continue
+		}
+		if err := p.getBlob(ptr, localPath); err != nil {
+			return fmt.Errorf("Failed to download %s: %w", filePath, err)
+		}
+	}
+	return nil
+}
+
+// readPointerFile returns the pointer in the file at localPath, or nil if it
+// doesn't exist or isn't a pointer file
+func readPointerFile(localPath string) (*pointer, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() > maxPointerSize {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return parsePointer(data), nil
+}
+
+// getBlob downloads the file ptr points to over dest, or copies it from the
+// checkout cache if it has already been downloaded
+func (p *Project) getBlob(ptr *pointer, dest string) error {
+	if p.checkoutCache == nil {
+		return p.downloadBlob(ptr, dest)
+	}
+	cachePath, err := p.checkoutCache.fetch("blob:"+ptr.hash, func(cachePath string) error {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+			return err
+		}
+		return p.downloadBlob(ptr, cachePath)
+	})
+	if err != nil {
+		return err
+	}
+	return cloneFromCache(cachePath, dest)
+}
+
+// downloadBlob downloads the file ptr points to over dest
+func (p *Project) downloadBlob(ptr *pointer, dest string) error {
+	// Downloaded next to dest then renamed, so a failed download leaves the
+	// pointer file
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Downloaded with GetPath rather than read, so large files in buckets
+	// are downloaded as several ranges at once
+	blob := blobPath(ptr.hash)
+	if err := p.repository.GetPath(blob, f.Name()); err != nil {
+		return err
+	}
+	downloaded, err := hashFile(f.Name(), ptr.algorithm)
+	if err != nil {
+		return err
+	}
+	// Buckets download nothing if the object doesn't exist
+	if downloaded.size == 0 && ptr.size != 0 {
+		return errors.DoesNotExist(fmt.Sprintf("%s/%s does not exist", p.repository.RootURL(), blob))
+	}
+	if downloaded.size != ptr.size || downloaded.hash != ptr.hash {
+		return errors.ReadError(fmt.Sprintf("%s/%s is corrupt: its checksum doesn't match", p.repository.RootURL(), blob))
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// copyBlob writes the file ptr points to to out, checking it hasn't been
+// corrupted
+func (p *Project) copyBlob(ptr *pointer, out io.Writer) error {
+	reader, err := p.repository.GetReader(blobPath(ptr.hash))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	h, err := hash.New(ptr.algorithm)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(io.MultiWriter(out, h), reader)
+	if err != nil {
+		return errors.ReadError(fmt.Sprintf("Failed to read %s: %v", blobPath(ptr.hash), err))
+	}
+	if size != ptr.size || hex.EncodeToString(h.Sum(nil)) != ptr.hash {
+		return errors.ReadError(fmt.Sprintf("%s/%s is corrupt: its checksum doesn't match", p.repository.RootURL(), blobPath(ptr.hash)))
+	}
+	return nil
+}
+
+// copyFileOrBlob writes filePath from the tarball at tarPath to out, or the
+// file it points to if it is a pointer file in chk
+func (p *Project) copyFileOrBlob(chk *Checkpoint, tarPath string, filePath string, out io.Writer) error {
+	if p.checkoutPointers || !chk.isPointerFile(path.Clean(filePath)) {
+		return repository.CopyFileFromTar(p.repository, tarPath, filePath, out)
+	}
+	var buf bytes.Buffer
+	if err := repository.CopyFileFromTar(p.repository, tarPath, filePath, &buf); err != nil {
+		return err
+	}
+	if ptr := parsePointer(buf.Bytes()); ptr != nil {
+		return p.copyBlob(ptr, out)
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// checkpointPointers returns the pointers in the pointer files of chk, keyed
+// by their paths. The pointer files are read from the tarballs that have them.
+// If trashDir isn't empty, chk is in the trash, and its tarballs are looked
+// for in trashDir first.
+func (p *Project) checkpointPointers(chk *Checkpoint, trashDir string) (map[string]*pointer, error) {
+	pointers := map[string]*pointer{}
+	for _, filePath := range chk.PointerFiles {
+		id := chk.ID
+		if referencedID, ok := chk.References[filePath]; ok {
+			id = referencedID
+		}
+		tarPath := chk.referencedTreeTarPath(id, chk.TreeOf(filePath))
+		tarPaths := []string{tarPath}
+		if trashDir != "" {
+			tarPaths = []string{trashDir + "/" + tarPath, tarPath}
+		}
+		for _, tarPath := range tarPaths {
+			out := &limitedBuffer{limit: maxPointerSize}
+			err := repository.CopyFileFromTar(p.repository, tarPath, filePath, out)
+			if err == nil {
+				if ptr := parsePointer(out.Bytes()); ptr != nil {
+					pointers[filePath] = ptr
+				}
+				break
+			}
+			// Too big to be a pointer file, so it was saved before large
+			// files were turned on
+			if out.exceeded {
+				break
+			}
+			if !errors.IsDoesNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	return pointers, nil
+}
+
+// unusedBlobs returns the paths of the blobs that the checkpoints in chks
+// point to and no other checkpoint does, including those in the trash. It
+// must be called before the tarballs of chks are deleted, because the
+// pointers are read from them. trashDir is where chks are if they are in the
+// trash.
+func (p *Project) unusedBlobs(chks []*Checkpoint, trashDir string) ([]string, error) {
+	deleting := map[string]bool{}
+	unused := map[string]bool{}
+	for _, chk := range chks {
+		deleting[chk.ID] = true
+		pointers, err := p.checkpointPointers(chk, trashDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, ptr := range pointers {
+			unused[blobPath(ptr.hash)] = true
+		}
+	}
+	if len(unused) == 0 {
+		return []string{}, nil
+	}
+
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+	markUsed := func(chks []*Checkpoint, trashDir string) error {
+		for _, chk := range chks {
+			if deleting[chk.ID] || len(chk.PointerFiles) == 0 {
+				continue
+			}
+			pointers, err := p.checkpointPointers(chk, trashDir)
+			if err != nil {
+				return err
+			}
+			for _, ptr := range pointers {
+				delete(unused, blobPath(ptr.hash))
+			}
+		}
+		return nil
+	}
+	for _, exp := range experiments {
+		if err := markUsed(exp.Checkpoints, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range entries {
+		if err := markUsed(entry.checkpoints(), entry.dir()); err != nil {
+			return nil, err
+		}
+	}
+
+	blobPaths := []string{}
+	for blobPath := range unused {
+		blobPaths = append(blobPaths, blobPath)
+	}
+	sort.Strings(blobPaths)
+	return blobPaths, nil
+}
+
+// deleteBlobs deletes the blobs at blobPaths, warning if they can't be
+func (p *Project) deleteBlobs(blobPaths []string) {
+	for _, blobPath := range blobPaths {
+		if err := p.repository.Delete(blobPath); err != nil {
+			console.Warn("Failed to delete large file %s: %s", blobPath, err)
+		}
+	}
+}
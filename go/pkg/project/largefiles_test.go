@@ -0,0 +1,145 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func listBlobs(t *testing.T, repoDir string) []string {
+	blobs := []string{}
+	results := make(chan repository.ListResult)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	go repo.ListRecursive(context.Background(), results, "blobs")
+	for result := range results {
+		require.NoError(t, result.Error)
+		blobs = append(blobs, result.Path)
+	}
+	return blobs
+}
+
+func TestCheckpointLargeFiles(t *testing.T) {
+	projectDir, err := files.TempDir("test-large-files")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-large-files-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetLargeFiles(&config.LargeFiles{MinFileSizeMB: 1})
+
+	weights := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), weights, 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "config.json"), []byte("{}"), 0644))
+
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, chk1.PointerFiles)
+	blobs := listBlobs(t, repoDir)
+	require.Len(t, blobs, 1)
+
+	// The tarball has a pointer file in place of the weights
+	var buf bytes.Buffer
+	require.NoError(t, repository.CopyFileFromTar(repo, chk1.StorageTarPath(), "model/weights.pt", &buf))
+	ptr := parsePointer(buf.Bytes())
+	require.NotNil(t, ptr)
+	require.Equal(t, int64(len(weights)), ptr.size)
+	require.Equal(t, blobPath(ptr.hash), blobs[0])
+
+	// The same weights saved again aren't stored again
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path.Join(projectDir, "model", "weights.pt"), future, future))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, chk2.PointerFiles)
+	require.Empty(t, chk2.References["model/weights.pt"])
+	require.Equal(t, blobs, listBlobs(t, repoDir))
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// Checking out replaces pointer files with the files they point to
+	outputDir, err := files.TempDir("test-large-files-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.CheckoutCheckpoint(chk2, exp, outputDir, true))
+	contents, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(weights, contents))
+	contents, err = ioutil.ReadFile(path.Join(outputDir, "model", "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(contents))
+
+	buf.Reset()
+	require.NoError(t, proj.CopyFile(chk2, exp, "model/weights.pt", &buf))
+	require.True(t, bytes.Equal(weights, buf.Bytes()))
+
+	problems, err := proj.Verify()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// ...unless pointer files are asked for
+	pointersDir, err := files.TempDir("test-large-files-pointers")
+	require.NoError(t, err)
+	defer os.RemoveAll(pointersDir)
+	proj.SetCheckoutPointers(true)
+	require.NoError(t, proj.CheckoutCheckpoint(chk2, exp, pointersDir, true))
+	contents, err = ioutil.ReadFile(path.Join(pointersDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.Equal(t, ptr.String(), string(contents))
+	proj.SetCheckoutPointers(false)
+
+	// Blobs the second checkpoint uses are kept when the first is deleted,
+	// and deleted along with the last checkpoint that uses them
+	require.NoError(t, proj.DeleteCheckpoint(chk1))
+	exp.Checkpoints = []*Checkpoint{chk2}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.Equal(t, blobs, listBlobs(t, repoDir))
+
+	require.NoError(t, proj.DeleteCheckpoint(chk2))
+	require.Empty(t, listBlobs(t, repoDir))
+}
+
+func TestParsePointer(t *testing.T) {
+	ptr := &pointer{algorithm: "sha256", hash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", size: 4}
+	require.Equal(t, ptr, parsePointer([]byte(ptr.String())))
+	ptr = &pointer{algorithm: "blake3", hash: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", size: 3}
+	require.Equal(t, ptr, parsePointer([]byte(ptr.String())))
+	ptr = &pointer{algorithm: "xxh3", hash: "06b05ab6733a618578af5f94892f3950", size: 3}
+	require.Equal(t, ptr, parsePointer([]byte(ptr.String())))
+
+	for _, data := range []string{
+		"",
+		"{}",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\nsize 4\n",
+		"version " + pointerVersion + "\noid sha256:abc\nsize 4\n",
+		"version " + pointerVersion + "\noid xxh3:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\nsize 4\n",
+		"version " + pointerVersion + "\noid md5:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\nsize 4\n",
+		"version " + pointerVersion + "\noid sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\nsize -1\n",
+	} {
+		require.Nil(t, parsePointer([]byte(data)), data)
+	}
+}
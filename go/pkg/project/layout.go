@@ -0,0 +1,227 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// With a layout in replicate.yaml, the files of experiments and checkpoints
+// are stored at paths made from templates, such as
+// checkpoints/<project>/<experiment ID>/<date>/<checkpoint ID>.tar.gz, rather
+// than checkpoints/<checkpoint ID>.tar.gz. Where each experiment and
+// checkpoint is stored is recorded in its metadata as its StoragePath, so
+// changing the layout doesn't lose track of files that are already saved,
+// and MigrateLayout moves them.
+
+// SetLayout sets the layout that new experiments and checkpoints are stored
+// in. projectName is the value of {project}, or the name of the project
+// directory if it is empty.
+func (p *Project) SetLayout(layout *config.Layout, projectName string) {
+	p.layout = layout
+	p.projectName = projectName
+}
+
+func (p *Project) layoutValues(exp *Experiment) map[string]string {
+	projectName := p.projectName
+	if projectName == "" {
+		projectName = filepath.Base(p.directory)
+	}
+	return map[string]string{
+		config.LayoutProject:    projectName,
+		config.LayoutUser:       exp.User,
+		config.LayoutDate:       exp.Created.Format("2006-01-02"),
+		config.LayoutExperiment: exp.ID,
+		config.LayoutName:       exp.Name,
+	}
+}
+
+// experimentStoragePath returns the StoragePath of exp in the layout, which
+// is empty in the default layout
+func (p *Project) experimentStoragePath(exp *Experiment) string {
+	template := p.layout.ExperimentsTemplate()
+	if template == config.DefaultExperimentsLayout {
+		return ""
+	}
+	return "experiments/" + config.RenderLayout(template, p.layoutValues(exp))
+}
+
+// checkpointStoragePath returns the StoragePath of chk in the layout, which
+// is empty in the default layout. If the experiment isn't known, the
+// checkpoint is stored in the default layout.
+func (p *Project) checkpointStoragePath(exp *Experiment, chk *Checkpoint) string {
+	template := p.layout.CheckpointsTemplate()
+	if template == config.DefaultCheckpointsLayout || exp == nil {
+		return ""
+	}
+	values := p.layoutValues(exp)
+	values[config.LayoutCheckpoint] = chk.ID
+	return "checkpoints/" + config.RenderLayout(template, values)
+}
+
+// LayoutMove is an experiment or checkpoint whose files MigrateLayout moves
+type LayoutMove struct {
+	Experiment *Experiment
+	// Checkpoint is nil if the experiment's own files are being moved
+	Checkpoint *Checkpoint
+	// From and To are the paths of the tarball, before and after
+	From string
+	To   string
+
+	// storagePath is the new StoragePath, and paths maps the paths of the
+	// objects that are moved to their new paths
+	storagePath string
+	paths       map[string]string
+}
+
+// PlanLayoutMigration returns the experiments and checkpoints that aren't
+// stored in the layout set with SetLayout.
+//
+// Running experiments aren't moved, because they would put their old
+// storage paths back in their metadata the next time they save a
+// checkpoint.
+func (p *Project) PlanLayoutMigration() ([]*LayoutMove, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	moves := []*LayoutMove{}
+	for _, exp := range experiments {
+		running, err := p.ExperimentIsRunning(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		if running {
+			console.Debug("Not moving experiment %s because it is running", exp.ShortID())
+			continue
+		}
+		if exp.Path != "" {
+			storagePath := p.experimentStoragePath(exp)
+			if storagePath != exp.StoragePath {
+				to := &Experiment{ID: exp.ID, StoragePath: storagePath}
+				moves = append(moves, &LayoutMove{
+					Experiment:  exp,
+					From:        exp.StorageTarPath(),
+					To:          to.StorageTarPath(),
+					storagePath: storagePath,
+					paths:       layoutPaths([]string{exp.StorageTarPath()}, []string{to.StorageTarPath()}),
+				})
+			}
+		}
+		for _, chk := range exp.Checkpoints {
+			if chk.Path == "" {
+				continue
+			}
+			storagePath := p.checkpointStoragePath(exp, chk)
+			if storagePath == chk.StoragePath {
+				continue
+			}
+			moves = append(moves, &LayoutMove{
+				Experiment:  exp,
+				Checkpoint:  chk,
+				From:        chk.StorageTarPath(),
+				To:          checkpointTreeTarPath(storagePath, chk.ID, TreeCode),
+				storagePath: storagePath,
+				paths:       layoutPaths(checkpointTarPaths(chk.StoragePath, chk.ID), checkpointTarPaths(storagePath, chk.ID)),
+			})
+		}
+	}
+	return moves, nil
+}
+
+// layoutPaths maps each of the tarballs in from, and their indexes, to the
+// ones in to
+func layoutPaths(from []string, to []string) map[string]string {
+	from, to = withTarIndexPaths(from), withTarIndexPaths(to)
+	paths := map[string]string{}
+	for i := range from {
+		paths[from[i]] = to[i]
+	}
+	return paths
+}
+
+// MigrateLayout moves the files of the experiments and checkpoints returned
+// by PlanLayoutMigration. The files are copied first, then the metadata is
+// updated, then the old files are deleted, so if it is interrupted, nothing
+// is lost. Running it again moves what wasn't moved, and Verify reports old
+// files that weren't deleted as unreferenced.
+func (p *Project) MigrateLayout(moves []*LayoutMove) error {
+	lock, err := p.lockForMaintenance("migrating the layout")
+	if err != nil {
+		return err
+	}
+	defer releaseLock(lock)
+
+	for _, move := range moves {
+		if err := p.requirePathVersion(move.storagePath); err != nil {
+			return err
+		}
+	}
+	copied := []string{}
+	for _, move := range moves {
+		for src, dest := range move.paths {
+			if err := p.repository.Copy(src, dest); err != nil {
+				// Not every checkpoint has every tree, or an index
+				if errors.IsDoesNotExist(err) {
+					continue
+				}
+				return fmt.Errorf("Failed to copy %s to %s: %w", src, dest, err)
+			}
+			copied = append(copied, src)
+		}
+	}
+
+	// Checkpoints in the same experiment reference each other's tarballs,
+	// so the experiments' metadata is updated together
+	experiments := []*Experiment{}
+	storagePaths := map[*Experiment]map[string]string{}
+	record := &AuditRecord{Operation: AuditMigrateLayout}
+	for _, move := range moves {
+		if _, ok := storagePaths[move.Experiment]; !ok {
+			storagePaths[move.Experiment] = map[string]string{}
+			experiments = append(experiments, move.Experiment)
+			record.Experiments = append(record.Experiments, move.Experiment.ID)
+		}
+		if move.Checkpoint == nil {
+			move.Experiment.StoragePath = move.storagePath
+		} else {
+			move.Checkpoint.StoragePath = move.storagePath
+			storagePaths[move.Experiment][move.Checkpoint.ID] = move.storagePath
+			record.Checkpoints = append(record.Checkpoints, move.Checkpoint.ID)
+		}
+		record.Paths = append(record.Paths, move.To)
+	}
+	for _, exp := range experiments {
+		for _, chk := range exp.Checkpoints {
+			for _, id := range chk.References {
+				storagePath, ok := storagePaths[exp][id]
+				if !ok || id == chk.ID {
+					continue
+				}
+				if storagePath == "" {
+					delete(chk.ReferencedStoragePaths, id)
+					continue
+				}
+				if chk.ReferencedStoragePaths == nil {
+					chk.ReferencedStoragePaths = map[string]string{}
+				}
+				chk.ReferencedStoragePaths[id] = storagePath
+			}
+		}
+		if _, err := p.SaveExperiment(exp, true); err != nil {
+			return err
+		}
+	}
+
+	for _, objectPath := range copied {
+		if err := p.repository.Delete(objectPath); err != nil {
+			console.Warn("Failed to delete %s: %s", objectPath, err)
+		}
+	}
+	p.resetCheckpointFiles()
+	p.audit(record)
+	return nil
+}
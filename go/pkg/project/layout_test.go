@@ -0,0 +1,115 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestMigrateLayout(t *testing.T) {
+	projectDir, err := files.TempDir("test-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-layout-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	for _, name := range []string{"config.json", "weights.pt"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", name), []byte(name+" 1"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), past, past))
+	}
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights.pt 2"), 0644))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, chk1.ID, chk2.References["model/config.json"])
+	require.Equal(t, "", chk1.StoragePath)
+	exp.Checkpoints = []*Checkpoint{chk1, chk2}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	proj.SetLayout(&config.Layout{Checkpoints: "{project}/{experiment}/{checkpoint}"}, "my-project")
+	moves, err := proj.PlanLayoutMigration()
+	require.NoError(t, err)
+	require.Len(t, moves, 2)
+	require.Equal(t, "checkpoints/"+chk1.ID+".tar.gz", moves[0].From)
+	require.Equal(t, "checkpoints/my-project/"+exp.ID+"/"+chk1.ID+".tar.gz", moves[0].To)
+	require.NoError(t, proj.MigrateLayout(moves))
+
+	exists, err := files.FileExists(path.Join(repoDir, "checkpoints", chk1.ID+".tar.gz"))
+	require.NoError(t, err)
+	require.False(t, exists)
+	loaded, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	loaded1, loaded2 := loaded.Checkpoints[0], loaded.Checkpoints[1]
+	require.Equal(t, "checkpoints/my-project/"+exp.ID+"/"+chk1.ID, loaded1.StoragePath)
+	require.Equal(t, map[string]string{chk1.ID: loaded1.StoragePath}, loaded2.ReferencedStoragePaths)
+
+	// Referenced files are found in their new place
+	outputDir, err := files.TempDir("test-layout-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.CheckoutCheckpoint(loaded2, loaded, outputDir, true))
+	contents, err := ioutil.ReadFile(path.Join(outputDir, "model", "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "config.json 1", string(contents))
+	problems, err := proj.Verify()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// New checkpoints are saved in the layout
+	chk3, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, "checkpoints/my-project/"+exp.ID+"/"+chk3.ID, chk3.StoragePath)
+	exists, err = files.FileExists(path.Join(repoDir, chk3.StorageTarPath()))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	moves, err = proj.PlanLayoutMigration()
+	require.NoError(t, err)
+	require.Empty(t, moves)
+}
+
+func TestCheckpointLayoutWithSeveralExperiments(t *testing.T) {
+	projectDir, err := files.TempDir("test-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-layout-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetLayout(&config.Layout{Checkpoints: "{experiment}/{checkpoint}"}, "my-project")
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights"), 0644))
+
+	// Checkpoints are stored with their own experiment, not the one that was
+	// created last
+	exp1, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	exp2, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp1, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, "checkpoints/"+exp1.ID+"/"+chk1.ID, chk1.StoragePath)
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp2, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, "checkpoints/"+exp2.ID+"/"+chk2.ID, chk2.StoragePath)
+}
@@ -0,0 +1,106 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Maintenance operations that delete things, like pruning and deleting
+// chunks that nothing uses, hold the maintenance lock so they don't run at
+// the same time as each other. Experiments wait for it before they write
+// anything, so a chunk or tarball isn't deleted just as a new checkpoint
+// starts to use it. Experiments that were already running when it was taken
+// might be in the middle of saving something, so maintenance refuses to run
+// while any of them have a live heartbeat.
+
+// MaintenanceLock is the name of the lock that maintenance operations hold
+const MaintenanceLock = "maintenance"
+
+// maintenancePollInterval is how often experiments check whether the
+// maintenance lock has been released
+var maintenancePollInterval = 5 * time.Second
+
+// lockForMaintenance takes the maintenance lock for operation. It fails if
+// any experiments are running.
+func (p *Project) lockForMaintenance(operation string) (*repository.Lock, error) {
+	lock, err := repository.AcquireLock(p.repository, MaintenanceLock, operation)
+	if err != nil {
+		return nil, err
+	}
+	// This is checked after the lock is taken, because experiments that start
+	// after that wait for it
+	running, err := p.runningExperimentIDs()
+	if err != nil {
+		releaseLock(lock)
+		return nil, err
+	}
+	if len(running) > 0 {
+		releaseLock(lock)
+		return nil, fmt.Errorf("Can't start %s while experiments are running (%s), because it might delete files they are saving. Try again when they have stopped.", operation, strings.Join(running, ", "))
+	}
+	return lock, nil
+}
+
+// runningExperimentIDs returns the short IDs of experiments that have a live
+// heartbeat. They are read from the repository rather than what has been
+// loaded, because experiments might have started since.
+func (p *Project) runningExperimentIDs() ([]string, error) {
+	heartbeats, err := listHeartbeats(p.repository)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check for running experiments: %w", err)
+	}
+	ids := []string{}
+	for _, hb := range heartbeats {
+		if !hb.IsRunning() {
+			continue
+		}
+		id := hb.ExperimentID
+		if len(id) > 7 {
+			id = id[:7]
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func releaseLock(lock *repository.Lock) {
+	if err := lock.Release(); err != nil {
+		console.Warn("Failed to release lock: %s", err)
+	}
+}
+
+// waitForMaintenance blocks while somebody holds the maintenance lock. A
+// failure to read the lock is only a warning, so experiments carry on.
+func (p *Project) waitForMaintenance() {
+	waited := false
+	for {
+		lease, err := repository.ReadLock(p.repository, MaintenanceLock)
+		if err != nil {
+			// Nobody can be doing maintenance on what is being saved to the
+			// spool
+			if !repository.IsUnreachable(err) {
+				console.Warn("Failed to read the maintenance lock: %s", err)
+			}
+			return
+		}
+		if lease == nil || lease.Expired(time.Now().UTC()) {
+			break
+		}
+		if !waited {
+			console.Info("Waiting for %s to finish %s in the repository...", lease.Holder(), lease.Operation)
+			waited = true
+		}
+		time.Sleep(maintenancePollInterval)
+	}
+	if waited {
+		// Chunks and tarballs that were known about might have been deleted
+		p.resetKnownChunks()
+		p.resetCheckpointFiles()
+	}
+}
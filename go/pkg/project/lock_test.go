@@ -0,0 +1,64 @@
+package project
+
+import (
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestMaintenanceLock(t *testing.T) {
+	dir, err := files.TempDir("test-maintenance-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(path.Join(dir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, dir)
+
+	oldSettleTime, oldPollInterval := repository.LockSettleTime, maintenancePollInterval
+	repository.LockSettleTime = 0
+	maintenancePollInterval = 10 * time.Millisecond
+	defer func() { repository.LockSettleTime, maintenancePollInterval = oldSettleTime, oldPollInterval }()
+
+	lock, err := proj.lockForMaintenance("pruning")
+	require.NoError(t, err)
+
+	// Maintenance can't run while somebody else is doing maintenance
+	err = proj.DeleteCheckpoints([]*Checkpoint{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "locked")
+
+	// Experiments wait until it's finished
+	var releasing int32
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&releasing, 1)
+		released <- lock.Release()
+	}()
+	proj.waitForMaintenance()
+	require.Equal(t, int32(1), atomic.LoadInt32(&releasing), "waitForMaintenance returned while the lock was held")
+	require.NoError(t, <-released)
+
+	require.NoError(t, proj.DeleteCheckpoints([]*Checkpoint{}))
+
+	// Maintenance can't run while experiments are running, because they
+	// might be saving files it would delete
+	require.NoError(t, CreateHeartbeat(repo, "1eeeeeeeee", time.Now().UTC()))
+	err = proj.DeleteCheckpoints([]*Checkpoint{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "experiments are running (1eeeeee)")
+	lease, err := repository.ReadLock(repo, MaintenanceLock)
+	require.NoError(t, err)
+	require.Nil(t, lease)
+
+	// Experiments whose heartbeat has stopped aren't running
+	require.NoError(t, CreateHeartbeat(repo, "1eeeeeeeee", time.Now().UTC().Add(-time.Hour)))
+	require.NoError(t, proj.DeleteCheckpoints([]*Checkpoint{}))
+}
@@ -0,0 +1,162 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Metric series are metrics logged at every step of training, such as the
+// loss of each batch, rather than only when a checkpoint is saved. They are
+// stored in metrics/<experiment ID>.json, apart from the experiment's
+// metadata, so logging thousands of points doesn't slow down loading
+// experiments. Points are added to them with events, as described in
+// events.go.
+
+// MetricPoint is the value of a metric at a step
+type MetricPoint struct {
+	Step      int64     `json:"step"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// MetricSeries are the points logged for each metric, by name, in the order
+// they were logged
+type MetricSeries map[string][]MetricPoint
+
+type metricSeriesFile struct {
+	Series MetricSeries `json:"series"`
+	// LastEvent is the name of the last event in metrics/events/<ID>/ that
+	// has been merged into the series
+	LastEvent string `json:"last_event,omitempty"`
+}
+
+// Names returns the names of the metrics, sorted
+func (s MetricSeries) Names() []string {
+	names := []string{}
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add appends a point to each metric in metrics. Values must be finite,
+// because they are stored as JSON.
+func (s MetricSeries) Add(step int64, timestamp time.Time, metrics map[string]float64) error {
+	for name, value := range metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("Value of metric %q at step %d is %v, but it must be a finite number", name, step, value)
+		}
+	}
+	for name, value := range metrics {
+		s[name] = append(s[name], MetricPoint{Step: step, Timestamp: timestamp, Value: value})
+	}
+	return nil
+}
+
+func (e *Experiment) MetricsPath() string {
+	return "metrics/" + e.ID + ".json"
+}
+
+// MetricSeries returns the metric series logged for exp. It is empty if none
+// have been logged.
+func (p *Project) MetricSeries(exp *Experiment) (MetricSeries, error) {
+	if err := p.FlushEvents(); err != nil {
+		console.Warn("Failed to write batched metadata: %s", err)
+	}
+	file, _, err := p.loadMetricSeries(exp)
+	if err != nil {
+		return nil, err
+	}
+	return file.Series, nil
+}
+
+// SaveMetricSeries replaces the metric series of exp with series. To add
+// points to them, use AppendMetricSeries.
+func (p *Project) SaveMetricSeries(exp *Experiment, series MetricSeries) error {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+
+	// The series replace what is in the batch
+	p.dropBatch(eventsDir(metricEventsFolder, exp.ID))
+	eventPaths, err := listEvents(p.repository, eventsDir(metricEventsFolder, exp.ID))
+	if err != nil {
+		return err
+	}
+	file := metricSeriesFile{Series: series}
+	if len(eventPaths) > 0 {
+		file.LastEvent = eventName(eventPaths[len(eventPaths)-1])
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := p.repository.Put(exp.MetricsPath(), data); err != nil {
+		return err
+	}
+	p.deleteEvents(eventPaths, file.LastEvent)
+	delete(p.events.pending, eventsDir(metricEventsFolder, exp.ID))
+	return nil
+}
+
+// Downsample reduces points to at most n points for display, keeping the
+// shape of the curve with the largest-triangle-three-buckets algorithm. The
+// first and last points are always kept, and the rest are picked one from
+// each of n-2 buckets of steps, choosing the point that makes the largest
+// triangle with the points picked either side of it. Spikes survive, where
+// averaging would flatten them.
+func Downsample(points []MetricPoint, n int) []MetricPoint {
+	if n >= len(points) {
+		return append([]MetricPoint{}, points...)
+	}
+	if n <= 0 {
+		return []MetricPoint{}
+	}
+	if n == 1 {
+		return []MetricPoint{points[len(points)-1]}
+	}
+	if n == 2 {
+		return []MetricPoint{points[0], points[len(points)-1]}
+	}
+
+	result := make([]MetricPoint, 0, n)
+	result = append(result, points[0])
+	// Points between the first and last are split into n-2 buckets
+	bucketSize := float64(len(points)-2) / float64(n-2)
+	picked := 0
+	for bucket := 0; bucket < n-2; bucket++ {
+		start := int(float64(bucket)*bucketSize) + 1
+		end := int(float64(bucket+1)*bucketSize) + 1
+
+		// The third point of the triangle is the average of the next
+		// bucket, or the last point if this is the last bucket
+		nextStart, nextEnd := end, int(float64(bucket+2)*bucketSize)+1
+		if bucket == n-3 {
+			nextStart, nextEnd = len(points)-1, len(points)
+		}
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += float64(p.Step)
+			avgY += p.Value
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		a := points[picked]
+		best, bestArea := start, -1.0
+		for i := start; i < end; i++ {
+			area := math.Abs((float64(a.Step)-avgX)*(points[i].Value-a.Value) - (float64(a.Step)-float64(points[i].Step))*(avgY-a.Value))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		result = append(result, points[best])
+		picked = best
+	}
+	return append(result, points[len(points)-1])
+}
@@ -0,0 +1,80 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func metricPoints(values ...float64) []MetricPoint {
+	result := []MetricPoint{}
+	for i, v := range values {
+		result = append(result, MetricPoint{Step: int64(i), Value: v})
+	}
+	return result
+}
+
+func pointSteps(points []MetricPoint) []int64 {
+	result := []int64{}
+	for _, p := range points {
+		result = append(result, p.Step)
+	}
+	return result
+}
+
+func TestDownsample(t *testing.T) {
+	// Fewer points than asked for are returned as they are
+	require.Equal(t, metricPoints(1, 2, 3), Downsample(metricPoints(1, 2, 3), 10))
+	require.Equal(t, []int64{2}, pointSteps(Downsample(metricPoints(1, 2, 3), 1)))
+	require.Equal(t, []int64{0, 2}, pointSteps(Downsample(metricPoints(1, 2, 3), 2)))
+
+	// The first and last are kept, and spikes aren't smoothed away
+	values := make([]float64, 1000)
+	for i := range values {
+		values[i] = 1
+	}
+	values[500] = 100
+	values[700] = -100
+	downsampled := Downsample(metricPoints(values...), 50)
+	require.Len(t, downsampled, 50)
+	require.Equal(t, int64(0), downsampled[0].Step)
+	require.Equal(t, int64(999), downsampled[49].Step)
+	require.Contains(t, pointSteps(downsampled), int64(500))
+	require.Contains(t, pointSteps(downsampled), int64(700))
+	for i := 1; i < len(downsampled); i++ {
+		require.True(t, downsampled[i].Step > downsampled[i-1].Step)
+	}
+}
+
+func TestMetricSeriesSaveAndLoad(t *testing.T) {
+	projectDir, err := files.TempDir("test-metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	exp := NewExperiment(nil)
+
+	series, err := proj.MetricSeries(exp)
+	require.NoError(t, err)
+	require.Empty(t, series)
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, series.Add(1, created, map[string]float64{"loss": 0.5, "accuracy": 0.1}))
+	require.NoError(t, series.Add(2, created, map[string]float64{"loss": 0.25}))
+	require.NoError(t, proj.SaveMetricSeries(exp, series))
+
+	loaded, err := proj.MetricSeries(exp)
+	require.NoError(t, err)
+	require.Equal(t, []string{"accuracy", "loss"}, loaded.Names())
+	require.Equal(t, []MetricPoint{
+		{Step: 1, Timestamp: created, Value: 0.5},
+		{Step: 2, Timestamp: created, Value: 0.25},
+	}, loaded["loss"])
+}
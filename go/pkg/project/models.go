@@ -0,0 +1,265 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Promoting a checkpoint copies its files to models/<name>/<version>/ in the
+// repository, where they are plain files that don't change, and records the
+// version in models/<name>/versions.json. Serving systems can read the index
+// to find the latest version of a model, and download its files, without
+// knowing anything about experiments and checkpoints.
+
+// ModelsDir is the directory in the repository that models are in
+const ModelsDir = "models"
+
+var modelNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ModelVersion is a checkpoint that has been promoted to a version of a model
+type ModelVersion struct {
+	Version      int            `json:"version"`
+	ExperimentID string         `json:"experiment_id"`
+	CheckpointID string         `json:"checkpoint_id"`
+	Step         int64          `json:"step"`
+	Metrics      param.ValueMap `json:"metrics"`
+	Promoted     time.Time      `json:"promoted"`
+	User         string         `json:"user"`
+	// Path is where the version's files are in the repository
+	Path string `json:"path"`
+	// Files are the paths of the version's files, relative to Path
+	Files []string `json:"files"`
+}
+
+// ModelIndex is the versions of a model
+type ModelIndex struct {
+	Name string `json:"name"`
+	// Latest is the highest version
+	Latest   int             `json:"latest"`
+	Versions []*ModelVersion `json:"versions"`
+}
+
+// Version returns the version called version, or nil if there isn't one
+func (m *ModelIndex) Version(version int) *ModelVersion {
+	for _, v := range m.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// PromoteOptions are the options for PromoteCheckpoint
+type PromoteOptions struct {
+	// Version is the version to promote to, or 0 for the version after the
+	// latest one
+	Version int
+	// Paths are the files and directories of the checkpoint to promote,
+	// relative to the project directory. If it is empty, all of them are.
+	Paths []string
+	// Force replaces the version if it already exists
+	Force bool
+}
+
+// ValidateModelName returns an error if name can't be used as the name of a
+// model
+func ValidateModelName(name string) error {
+	if !modelNameRegexp.MatchString(name) {
+		return fmt.Errorf("Invalid model name %q. It must only have letters, numbers, '.', '_' and '-' in it, and start with a letter or number.", name)
+	}
+	return nil
+}
+
+func modelIndexPath(name string) string {
+	return path.Join(ModelsDir, name, "versions.json")
+}
+
+func modelVersionPath(name string, version int) string {
+	return path.Join(ModelsDir, name, strconv.Itoa(version))
+}
+
+// ModelIndex returns the versions of the model called name. It returns a
+// DoesNotExist error if nothing has been promoted to it.
+func (p *Project) ModelIndex(name string) (*ModelIndex, error) {
+	index := &ModelIndex{}
+	if err := loadFromPath(p.repository, modelIndexPath(name), index); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, errors.DoesNotExist(fmt.Sprintf("The model %s does not exist", name))
+		}
+		return nil, err
+	}
+	return index, nil
+}
+
+// PromoteCheckpoint copies the files of chk, a checkpoint of exp, to a
+// version of the model called name, and adds it to the model's index
+func (p *Project) PromoteCheckpoint(exp *Experiment, chk *Checkpoint, name string, opts PromoteOptions) (*ModelVersion, error) {
+	if err := ValidateModelName(name); err != nil {
+		return nil, err
+	}
+	if chk.Path == "" {
+		return nil, errors.DoesNotExist(fmt.Sprintf("The checkpoint %s does not have any files associated with it. You need to pass the 'path' argument to 'checkpoint()' to promote it.", chk.ShortID()))
+	}
+
+	// Two promotions of the same model at the same time would overwrite
+	// each other's changes to the index
+	lock, err := p.lockModel(name)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLock(lock)
+
+	index, err := p.ModelIndex(name)
+	if err != nil {
+		if !errors.IsDoesNotExist(err) {
+			return nil, err
+		}
+		index = &ModelIndex{Name: name}
+	}
+	version := opts.Version
+	if version == 0 {
+		version = index.Latest + 1
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("Invalid version %d. Versions must be positive.", version)
+	}
+	if existing := index.Version(version); existing != nil && !opts.Force {
+		return nil, fmt.Errorf("Version %d of %s already exists, promoted from checkpoint %s. Pass --force to replace it.", version, name, existing.CheckpointID[:7])
+	}
+
+	tempDir, err := files.TempDir("promote")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := p.checkoutCheckpointFiles(chk, tempDir); err != nil {
+		return nil, err
+	}
+	fileList, err := selectModelFiles(tempDir, opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileList) == 0 {
+		return nil, errors.DoesNotExist(fmt.Sprintf("The checkpoint %s does not have any files to promote", chk.ShortID()))
+	}
+
+	versionPath := modelVersionPath(name, version)
+	for _, f := range append([]string{versionPath}, fileList...) {
+		if err := p.requirePathVersion(f); err != nil {
+			return nil, err
+		}
+	}
+	// Replaced versions shouldn't keep files that aren't in them any more
+	if err := p.repository.Delete(versionPath); err != nil && !errors.IsDoesNotExist(err) {
+		return nil, err
+	}
+	if err := p.repository.PutPath(tempDir, versionPath); err != nil {
+		return nil, err
+	}
+
+	modelVersion := &ModelVersion{
+		Version:      version,
+		ExperimentID: exp.ID,
+		CheckpointID: chk.ID,
+		Step:         chk.Step,
+		Metrics:      chk.Metrics,
+		Promoted:     time.Now().UTC(),
+		Path:         versionPath,
+		Files:        fileList,
+	}
+	if currentUser, err := user.Current(); err == nil {
+		modelVersion.User = currentUser.Username
+	}
+	versions := []*ModelVersion{modelVersion}
+	for _, v := range index.Versions {
+		if v.Version != version {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	index.Versions = versions
+	index.Latest = versions[len(versions)-1].Version
+
+	// The index is written last, so a version isn't listed until all of its
+	// files are there
+	data, err := json.MarshalIndent(index, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.repository.Put(modelIndexPath(name), data); err != nil {
+		return nil, err
+	}
+	p.audit(&AuditRecord{Operation: AuditPromote, Experiments: []string{exp.ID}, Checkpoints: []string{chk.ID}, Paths: []string{versionPath}})
+	return modelVersion, nil
+}
+
+// lockModel takes the lock on the index of the model called name
+func (p *Project) lockModel(name string) (*repository.Lock, error) {
+	return repository.AcquireLock(p.repository, "model-"+name, "promoting a checkpoint to "+name)
+}
+
+// selectModelFiles removes the files in dir that aren't in paths, and returns
+// the rest, relative to dir and slash-separated. If paths is empty, all of
+// the files in dir are kept.
+func selectModelFiles(dir string, paths []string) ([]string, error) {
+	fileList := []string{}
+	err := filepath.Walk(dir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, currentPath)
+		if err != nil {
+			return err
+		}
+		fileList = append(fileList, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return fileList, nil
+	}
+	selected := map[string]bool{}
+	for _, p := range paths {
+		p = strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "/")
+		found := false
+		for _, f := range fileList {
+			if f == p || strings.HasPrefix(f, p+"/") {
+				selected[f] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.DoesNotExist(fmt.Sprintf("The checkpoint does not have the path %s", p))
+		}
+	}
+	kept := []string{}
+	for _, f := range fileList {
+		if !selected[f] {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, nil
+}
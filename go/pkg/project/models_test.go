@@ -0,0 +1,109 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestPromoteCheckpoint(t *testing.T) {
+	oldSettleTime := repository.LockSettleTime
+	repository.LockSettleTime = 0
+	defer func() { repository.LockSettleTime = oldSettleTime }()
+
+	projectDir, err := files.TempDir("test-promote")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-promote-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	// Modified in the past, so config.json is referenced from the first
+	// checkpoint by the second
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	for _, name := range []string{"config.json", "weights.pt"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", name), []byte(name+" 1"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), past, past))
+	}
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 1, Metrics: param.ValueMap{"loss": param.Float(0.5)}}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights.pt 2"), 0644))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 2}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, chk1.ID, chk2.References["model/config.json"])
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	_, err = proj.ModelIndex("hotdog")
+	require.Error(t, err)
+
+	v1, err := proj.PromoteCheckpoint(exp, chk1, "hotdog", PromoteOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, v1.Version)
+	require.Equal(t, "models/hotdog/1", v1.Path)
+	require.Equal(t, []string{"model/config.json", "model/weights.pt"}, v1.Files)
+	require.Equal(t, param.Float(0.5), v1.Metrics["loss"])
+
+	// Only some files
+	v2, err := proj.PromoteCheckpoint(exp, chk2, "hotdog", PromoteOptions{Paths: []string{"model/weights.pt"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, v2.Version)
+	require.Equal(t, []string{"model/weights.pt"}, v2.Files)
+	data, err := repo.Get("models/hotdog/2/model/weights.pt")
+	require.NoError(t, err)
+	require.Equal(t, "weights.pt 2", string(data))
+	_, err = repo.Get("models/hotdog/2/model/config.json")
+	require.Error(t, err)
+
+	index, err := proj.ModelIndex("hotdog")
+	require.NoError(t, err)
+	require.Equal(t, "hotdog", index.Name)
+	require.Equal(t, 2, index.Latest)
+	require.Len(t, index.Versions, 2)
+	require.Equal(t, chk2.ID, index.Version(2).CheckpointID)
+
+	// Versions aren't replaced without Force
+	_, err = proj.PromoteCheckpoint(exp, chk2, "hotdog", PromoteOptions{Version: 1})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Version 1 of hotdog already exists")
+	_, err = proj.PromoteCheckpoint(exp, chk2, "hotdog", PromoteOptions{Version: 1, Force: true})
+	require.NoError(t, err)
+	data, err = repo.Get("models/hotdog/1/model/weights.pt")
+	require.NoError(t, err)
+	require.Equal(t, "weights.pt 2", string(data))
+	data, err = repo.Get("models/hotdog/1/model/config.json")
+	require.NoError(t, err)
+	require.Equal(t, "config.json 1", string(data))
+
+	// Versions can skip ahead, and the latest is the highest
+	_, err = proj.PromoteCheckpoint(exp, chk1, "hotdog", PromoteOptions{Version: 10})
+	require.NoError(t, err)
+	index, err = proj.ModelIndex("hotdog")
+	require.NoError(t, err)
+	require.Equal(t, 10, index.Latest)
+	require.Equal(t, []int{1, 2, 10}, []int{index.Versions[0].Version, index.Versions[1].Version, index.Versions[2].Version})
+
+	_, err = proj.PromoteCheckpoint(exp, chk1, "hotdog", PromoteOptions{Paths: []string{"missing.pt"}})
+	require.Error(t, err)
+	_, err = proj.PromoteCheckpoint(exp, chk1, "../hotdog", PromoteOptions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package project
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+)
+
+// Experiments have a name as well as an ID, such as "brave-falcon-42", so
+// people can refer to them in conversation and scripts without pasting
+// hashes. Names are unique within a repository and can be used anywhere an
+// ID prefix can.
+
+var nameAdjectives = []string{
+	"agile", "bold", "brave", "bright", "calm", "clever", "cosmic", "crisp",
+	"daring", "eager", "fancy", "fuzzy", "gentle", "glad", "golden", "happy",
+	"hidden", "jolly", "keen", "kind", "lively", "lucky", "mellow", "merry",
+	"mighty", "misty", "noble", "polite", "proud", "quick", "quiet", "rapid",
+	"rustic", "shiny", "silent", "sleek", "smooth", "snowy", "solar", "spicy",
+	"steady", "sunny", "swift", "tidy", "vivid", "warm", "wild", "witty",
+}
+
+var nameAnimals = []string{
+	"badger", "beaver", "bison", "cobra", "condor", "cougar", "coyote", "crane",
+	"dingo", "dolphin", "eagle", "falcon", "ferret", "gazelle", "gecko", "heron",
+	"hippo", "hornet", "ibis", "jaguar", "koala", "lemur", "lion", "llama",
+	"lynx", "mantis", "marmot", "moose", "newt", "otter", "owl", "panda",
+	"parrot", "pelican", "penguin", "puffin", "python", "quokka", "raven", "robin",
+	"salmon", "seal", "sloth", "stork", "tapir", "tiger", "walrus", "wombat",
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+var hexPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// maxNameAttempts is how many generated names are tried before giving up
+// because they are all taken
+const maxNameAttempts = 100
+
+// generateName returns a random name, e.g. "brave-falcon-42"
+func generateName() string {
+	return fmt.Sprintf("%s-%s-%d",
+		nameAdjectives[rand.Intn(len(nameAdjectives))],
+		nameAnimals[rand.Intn(len(nameAnimals))],
+		rand.Intn(99)+1)
+}
+
+// ValidateName returns an error if name can't be used as an experiment name.
+// Names are lowercase letters, numbers and hyphens, and can't look like an ID
+// prefix, otherwise it would be ambiguous which one was meant.
+func ValidateName(name string) error {
+	if len(name) > 64 {
+		return fmt.Errorf("Experiment name %q is too long. It must be 64 characters or less.", name)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("Experiment name %q is not valid. It must only contain lowercase letters, numbers and hyphens, and it can't start or end with a hyphen.", name)
+	}
+	if hexPattern.MatchString(name) {
+		return fmt.Errorf("Experiment name %q is not valid, because it could be mistaken for an ID. It must contain a hyphen or a letter other than a-f.", name)
+	}
+	return nil
+}
+
+// ExperimentByName returns the experiment called name, or nil if there isn't
+// one
+func (p *Project) ExperimentByName(name string) (*Experiment, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	for _, exp := range p.experimentsByID {
+		if exp.Name == name {
+			return exp, nil
+		}
+	}
+	return nil, nil
+}
+
+// experimentName returns name if it is valid and not taken by another
+// experiment, or a new generated name if name is empty
+func (p *Project) experimentName(name string) (string, error) {
+	if err := p.ensureLoaded(); err != nil {
+		return "", err
+	}
+	taken := map[string]bool{}
+	for _, exp := range p.experimentsByID {
+		if exp.Name != "" {
+			taken[exp.Name] = true
+		}
+	}
+	if name != "" {
+		if err := ValidateName(name); err != nil {
+			return "", err
+		}
+		if taken[name] {
+			return "", fmt.Errorf("There is already an experiment called %q. Experiment names must be unique.", name)
+		}
+		return name, nil
+	}
+	for i := 0; i < maxNameAttempts; i++ {
+		if name := generateName(); !taken[name] {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("Failed to generate a unique experiment name after %d attempts. Pass a name to the experiment instead.", maxNameAttempts)
+}
@@ -0,0 +1,64 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"brave-falcon-42", "resnet", "lr-0", "g"} {
+		require.NoError(t, ValidateName(name), name)
+	}
+	for _, name := range []string{"", "Brave", "brave_falcon", "-brave", "brave-", "brave--falcon", "beef", "1e2"} {
+		require.Error(t, ValidateName(name), name)
+	}
+	for i := 0; i < 100; i++ {
+		require.NoError(t, ValidateName(generateName()))
+	}
+}
+
+func TestExperimentNames(t *testing.T) {
+	projectDir, err := files.TempDir("test-names")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	generated, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, ValidateName(generated.Name))
+
+	named, err := proj.CreateExperiment(CreateExperimentArgs{Name: "resnet-baseline"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, "resnet-baseline", named.Name)
+
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Name: "resnet-baseline"}, false, nil, true)
+	require.EqualError(t, err, `There is already an experiment called "resnet-baseline". Experiment names must be unique.`)
+	_, err = proj.CreateExperiment(CreateExperimentArgs{Name: "Not Valid"}, false, nil, true)
+	require.Error(t, err)
+
+	// Names can be used wherever an ID prefix can
+	exp, err := proj.ExperimentFromPrefix("resnet-baseline")
+	require.NoError(t, err)
+	require.Equal(t, named.ID, exp.ID)
+	result, err := proj.CheckpointOrExperimentFromPrefix(generated.Name)
+	require.NoError(t, err)
+	require.Equal(t, generated.ID, result.Experiment.ID)
+	require.Nil(t, result.Checkpoint)
+
+	// IDs still work
+	exp, err = proj.ExperimentFromPrefix(named.ID[:7])
+	require.NoError(t, err)
+	require.Equal(t, "resnet-baseline", exp.Name)
+
+	exp, err = proj.ExperimentByName("no-such-experiment")
+	require.NoError(t, err)
+	require.Nil(t, exp)
+}
@@ -0,0 +1,163 @@
+package project
+
+import (
+	"context"
+	"sort"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// maxPrefetchWorkers is how many objects are prefetched at once
+const maxPrefetchWorkers = 8
+
+// PrefetchResult is what was downloaded by prefetching
+type PrefetchResult struct {
+	Files int
+	Bytes int64
+}
+
+// Prefetch downloads the objects that checking out exp and chk would read to
+// local disk, so checking them out later doesn't download them. chk can be
+// nil to only prefetch the experiment's files. Nothing is downloaded if the
+// repository isn't a PrefetchingRepository, such as a repository on local
+// disk.
+func (p *Project) Prefetch(exp *Experiment, chk *Checkpoint) (*PrefetchResult, error) {
+	result := &PrefetchResult{}
+	prefetcher, ok := repository.AsPrefetching(p.repository)
+	if !ok {
+		return result, nil
+	}
+
+	// Tarballs and chunk manifests are prefetched first, because the chunks
+	// and large files are found by reading them
+	tarPaths := []string{}
+	if exp.Path != "" {
+		tarPaths = append(tarPaths, exp.StorageTarPath())
+	}
+	if chk != nil && chk.Path != "" {
+		for _, tree := range chk.StoredTrees() {
+			tarPaths = append(tarPaths, chk.TreeTarPath(tree))
+		}
+		referenced := []string{}
+		for tarPath := range chk.referencedTarPaths() {
+			referenced = append(referenced, tarPath)
+		}
+		sort.Strings(referenced)
+		tarPaths = append(tarPaths, referenced...)
+	}
+	paths := withTarIndexPaths(tarPaths)
+	if chk != nil && len(chk.ChunkedFiles) > 0 {
+		paths = append(paths, chunkManifestPath(chk.ID))
+	}
+	if err := prefetchPaths(prefetcher, paths, result); err != nil {
+		return nil, err
+	}
+	if chk == nil {
+		return result, nil
+	}
+
+	paths = []string{}
+	seen := map[string]bool{}
+	if len(chk.ChunkedFiles) > 0 {
+		manifest, err := p.loadChunkManifest(chk.ID)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			for _, file := range manifest.Files {
+				for _, ref := range file.Chunks {
+					if !seen[ref.Hash] {
+						seen[ref.Hash] = true
+						paths = append(paths, chunkPath(ref.Hash))
+					}
+				}
+			}
+		}
+	}
+	if len(chk.PointerFiles) > 0 {
+		pointers, err := p.checkpointPointers(chk, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, ptr := range pointers {
+			if !seen[ptr.hash] {
+				seen[ptr.hash] = true
+				paths = append(paths, blobPath(ptr.hash))
+			}
+		}
+	}
+	if err := prefetchPaths(prefetcher, paths, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prefetchPaths prefetches paths, adding what was downloaded to result.
+// Objects that don't exist are skipped, because tarballs only have indexes
+// if they have lots of files in them.
+func prefetchPaths(prefetcher *repository.PrefetchingRepository, paths []string, result *PrefetchResult) error {
+	sizes := make([]int64, len(paths))
+	downloaded := make([]bool, len(paths))
+	queue := concurrency.NewWorkerQueue(context.Background(), maxPrefetchWorkers)
+	for i, objectPath := range paths {
+		i, objectPath := i, objectPath
+		if prefetcher.IsPrefetched(objectPath) {
+			continue
+		}
+		err := queue.Go(func() error {
+			size, err := prefetcher.Prefetch(objectPath)
+			if err != nil {
+				if errors.IsDoesNotExist(err) {
+					console.Debug("Not prefetching %s, because it doesn't exist", objectPath)
+					return nil
+				}
+				return err
+			}
+			sizes[i], downloaded[i] = size, true
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return err
+	}
+	for i, size := range sizes {
+		if downloaded[i] {
+			result.Files++
+			result.Bytes += size
+		}
+	}
+	return nil
+}
+
+// PrefetchRunning prefetches the latest checkpoints of the experiments that
+// are running, and the experiments' files
+func (p *Project) PrefetchRunning() (*PrefetchResult, error) {
+	p.invalidateCache()
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	result := &PrefetchResult{}
+	for _, exp := range experiments {
+		running, err := p.ExperimentIsRunning(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !running {
+			continue
+		}
+		prefetched, err := p.Prefetch(exp, exp.LatestCheckpoint())
+		if err != nil {
+			return nil, err
+		}
+		result.Files += prefetched.Files
+		result.Bytes += prefetched.Bytes
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestPrefetch(t *testing.T) {
+	projectDir, err := files.TempDir("test-prefetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-prefetch-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	prefetchDir, err := files.TempDir("test-prefetch-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(prefetchDir)
+	disk, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	repo, err := repository.NewPrefetchingRepository(disk, prefetchDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetLargeFiles(&config.LargeFiles{MinFileSizeMB: 1})
+
+	weights := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(1)).Read(weights)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), weights, 0644))
+
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{Path: "train.py"}, false, nil, true)
+	require.NoError(t, err)
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	result, err := proj.Prefetch(exp, chk)
+	require.NoError(t, err)
+	// The experiment's and checkpoint's tarballs, and the weights
+	require.Equal(t, 3, result.Files)
+	require.True(t, result.Bytes > int64(len(weights)))
+	result, err = proj.Prefetch(exp, chk)
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Files)
+
+	// Checking out doesn't need the repository's copies
+	for _, folder := range []string{"experiments", "checkpoints", "blobs"} {
+		require.NoError(t, os.RemoveAll(path.Join(repoDir, folder)))
+	}
+	outputDir, err := files.TempDir("test-prefetch-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.CheckoutCheckpoint(chk, exp, outputDir, true))
+	contents, err := ioutil.ReadFile(path.Join(outputDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(weights, contents))
+	contents, err = ioutil.ReadFile(path.Join(outputDir, "train.py"))
+	require.NoError(t, err)
+	require.Equal(t, "print(1)", string(contents))
+}
@@ -0,0 +1,20 @@
+// +build !windows
+
+package project
+
+import (
+	"os"
+	"syscall"
+)
+
+// processRunning returns whether the process with pid is running
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signal 0 checks the process exists without signalling it. EPERM means
+	// it exists but belongs to somebody else.
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
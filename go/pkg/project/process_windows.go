@@ -0,0 +1,17 @@
+package project
+
+import (
+	"os"
+)
+
+// processRunning returns whether the process with pid is running
+func processRunning(pid int) bool {
+	// FindProcess opens a handle to the process on Windows, so it fails if
+	// the process has exited
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+	return true
+}
@@ -6,12 +6,15 @@ import (
 	"math/rand"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/replicate/replicate/go/pkg/config"
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
 	"github.com/replicate/replicate/go/pkg/global"
 	"github.com/replicate/replicate/go/pkg/param"
 	"github.com/replicate/replicate/go/pkg/repository"
@@ -24,19 +27,98 @@ const IDLength = 64
 type Project struct {
 	repository        repository.Repository
 	directory         string
+	exclude           []string
+	hooks             *config.Hooks
+	background        sync.WaitGroup
+	alertRules        []*config.Alert
+	datasets          []*config.Dataset
+	environment       []string
+	seeds             []string
+	quota             *config.Quota
+	projectQuota      projectQuota
+	layout            *config.Layout
+	projectName       string
+	checkoutCache     *CheckoutCache
+	inventory         *repository.Inventory
+	waitForRestore    bool
 	experimentsByID   map[string]*Experiment
 	heartbeatsByExpID map[string]*Heartbeat
 	hasLoaded         bool
+
+	// events are the events this project has written to save experiments'
+	// metadata and metric series without rewriting them
+	events projectEvents
+
+	// checkpointManifests are the files in the last checkpoint of each
+	// experiment and path, to find the files that haven't changed since
+	checkpointManifestsMu sync.Mutex
+	checkpointManifests   map[checkpointManifestKey]*checkpointManifest
+
+	// chunking is nil if large files aren't stored in chunks
+	chunking    *config.Chunking
+	knownChunks knownChunks
+
+	// largeFiles is nil if large files are stored in checkpoints'
+	// tarballs, and checkoutPointers leaves pointer files in place of large
+	// files when checking out
+	largeFiles       *config.LargeFiles
+	checkoutPointers bool
+
+	// treeMatchers pick which files in checkpoints are weights and
+	// artifacts, and checkoutTrees are the trees that are checked out, or
+	// all of them if it is empty
+	treeMatchers  []treeMatcher
+	checkoutTrees []string
+
+	// hashAlgorithm is the algorithm set with SetHash, and repositoryHash
+	// is the one recorded in the repository, once it has been read
+	hashAlgorithm    string
+	repositoryHashMu sync.Mutex
+	repositoryHash   string
+
+	// spec is the repository's spec, once it has been read or written
+	specMu sync.Mutex
+	spec   *repository.Spec
+
+	// trashRetention is how long things are kept in the trash
+	trashRetention time.Duration
+
+	// signing is nil if checkpoints aren't signed, and signingHashes are
+	// the hashes of the files of checkpoints that are waiting to be signed
+	signing         *config.Signing
+	signingHashesMu sync.Mutex
+	signingHashes   map[string]map[string]string
+
+	// serve is the container that is recorded with new checkpoints to
+	// serve their models, or nil if there isn't one
+	serve *config.Serve
+
+	// errorOnSpecialFiles fails saving files, instead of skipping them, if
+	// there are sockets, named pipes, etc in them
+	errorOnSpecialFiles bool
 }
 
 func NewProject(repo repository.Repository, directory string) *Project {
 	return &Project{
-		repository: repo,
-		directory:  directory,
-		hasLoaded:  false,
+		repository:     repo,
+		directory:      directory,
+		hasLoaded:      false,
+		trashRetention: defaultTrashRetentionDays * 24 * time.Hour,
 	}
 }
 
+// SetExclude sets gitignore-style patterns for files that shouldn't be
+// uploaded with experiments and checkpoints, in addition to .replicateignore
+func (p *Project) SetExclude(patterns []string) {
+	p.exclude = patterns
+}
+
+// SetSpecialFiles sets what happens to files that can't be saved, such as
+// sockets and named pipes. It is one of the config.SpecialFiles values.
+func (p *Project) SetSpecialFiles(policy string) {
+	p.errorOnSpecialFiles = policy == config.SpecialFilesError
+}
+
 // Experiments returns all experiments in this project
 func (p *Project) Experiments() ([]*Experiment, error) {
 	if err := p.ensureLoaded(); err != nil {
@@ -64,10 +146,11 @@ func (p *Project) ExperimentIsRunning(experimentID string) (bool, error) {
 	return heartbeat.IsRunning(), nil
 }
 
-// ExperimentFromPrefix returns an experiment that matches a given ID prefix.
+// ExperimentFromPrefix returns an experiment that matches a given ID prefix,
+// or the experiment with the given name.
 func (p *Project) ExperimentFromPrefix(prefix string) (*Experiment, error) {
-	if err := p.ensureLoaded(); err != nil {
-		return nil, err
+	if exp, err := p.ExperimentByName(prefix); err != nil || exp != nil {
+		return exp, err
 	}
 
 	matches := []*Experiment{}
@@ -142,10 +225,13 @@ type CheckpointOrExperiment struct {
 
 // CheckpointOrExperimentFromPrefix returns a checkpoint/experiment given a
 // prefix. This is a single function so we can detect ambiguities
-// across both checkpoints and experiments.
+// across both checkpoints and experiments. prefix can also be the name of an
+// experiment.
 func (p *Project) CheckpointOrExperimentFromPrefix(prefix string) (*CheckpointOrExperiment, error) {
-	if err := p.ensureLoaded(); err != nil {
+	if exp, err := p.ExperimentByName(prefix); err != nil {
 		return nil, err
+	} else if exp != nil {
+		return &CheckpointOrExperiment{Experiment: exp}, nil
 	}
 
 	matches := []*CheckpointOrExperiment{}
@@ -171,15 +257,20 @@ func (p *Project) CheckpointOrExperimentFromPrefix(prefix string) (*CheckpointOr
 	return matches[0], nil
 }
 
+// DeleteCheckpoint deletes the files of chk. See DeleteCheckpoints.
 func (p *Project) DeleteCheckpoint(chk *Checkpoint) error {
-	if err := p.repository.Delete(chk.StorageTarPath()); err != nil {
-		console.Warn("Failed to delete checkpoint storage directory %s: %s", chk.StorageTarPath(), err)
+	return p.DeleteCheckpoints([]*Checkpoint{chk})
+}
+
+func (p *Project) DeleteExperiment(exp *Experiment) error {
+	if err := p.deleteExperiment(exp); err != nil {
+		return err
 	}
-	p.invalidateCache()
+	p.audit(&AuditRecord{Operation: AuditDeleteExperiment, Experiments: []string{exp.ID}})
 	return nil
 }
 
-func (p *Project) DeleteExperiment(exp *Experiment) error {
+func (p *Project) deleteExperiment(exp *Experiment) error {
 	console.Debug("Deleting experiment: %s", exp.ShortID())
 	if err := p.repository.Delete(exp.HeartbeatPath()); err != nil {
 		console.Warn("Failed to delete heartbeat file %s: %s", exp.HeartbeatPath(), err)
@@ -187,14 +278,27 @@ func (p *Project) DeleteExperiment(exp *Experiment) error {
 	if err := p.repository.Delete(exp.StorageTarPath()); err != nil {
 		console.Warn("Failed to delete experiment storage directory %s: %s", exp.StorageTarPath(), err)
 	}
+	if err := p.repository.Delete(repository.TarIndexPath(exp.StorageTarPath())); err != nil {
+		console.Warn("Failed to delete experiment index %s: %s", repository.TarIndexPath(exp.StorageTarPath()), err)
+	}
+	if err := p.repository.Delete(exp.MetricsPath()); err != nil {
+		console.Warn("Failed to delete experiment metrics file %s: %s", exp.MetricsPath(), err)
+	}
 	if err := p.repository.Delete(exp.MetadataPath()); err != nil {
 		console.Warn("Failed to delete experiment metadata file %s: %s", exp.MetadataPath(), err)
 	}
+	for _, folder := range []string{experimentEventsFolder, metricEventsFolder} {
+		if err := p.repository.Delete(eventsDir(folder, exp.ID)); err != nil {
+			console.Warn("Failed to delete experiment events %s: %s", eventsDir(folder, exp.ID), err)
+		}
+	}
 	p.invalidateCache()
 	return nil
 }
 
 type CreateExperimentArgs struct {
+	// Name is the experiment's name. If it is empty, a name is generated.
+	Name           string
 	Path           string
 	Command        string
 	Params         map[string]param.Value
@@ -202,17 +306,10 @@ type CreateExperimentArgs struct {
 }
 
 func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workChan chan func() error, quiet bool) (*Experiment, error) {
-	spec, err := repository.LoadSpec(p.repository)
-	if err != nil {
+	if err := p.ensureSpec(); err != nil {
 		return nil, err
 	}
-	if spec == nil {
-		if err := repository.WriteSpec(p.repository); err != nil {
-			return nil, err
-		}
-	} else if spec.Version > repository.Version {
-		return nil, errors.IncompatibleRepositoryVersion(p.repository.RootURL())
-	}
+	p.waitForMaintenance()
 
 	host := "" // currently disabled and unused
 	currentUser, err := user.Current()
@@ -224,8 +321,14 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 	}
 	conf := &config.Config{Repository: p.repository.RootURL()}
 
+	name, err := p.experimentName(args.Name)
+	if err != nil {
+		return nil, err
+	}
+
 	exp := &Experiment{
 		ID:               generateRandomID(),
+		Name:             name,
 		Created:          time.Now().UTC(),
 		Params:           args.Params,
 		Host:             host,
@@ -235,27 +338,57 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 		Path:             args.Path,
 		PythonPackages:   args.PythonPackages,
 		ReplicateVersion: global.Version,
+		HostEnvironment:  CurrentHostEnvironment(),
+		Sweep:            sweepMembershipFromEnv(),
+	}
+	exp.StoragePath = p.experimentStoragePath(exp)
+	if err := p.requirePathVersion(exp.StoragePath); err != nil {
+		return nil, err
+	}
+
+	if isDVC, err := IsDVCRepository(p.directory); err != nil {
+		console.Warn("Failed to check for DVC repository: %s", err)
+	} else if isDVC {
+		outputs, err := FindDVCOutputs(p.directory)
+		if err != nil {
+			console.Warn("Failed to record DVC outputs: %s", err)
+		} else {
+			exp.DVCOutputs = outputs
+		}
+	}
+	if len(p.datasets) > 0 {
+		exp.Datasets = p.fingerprintDatasets()
+	}
+	if len(p.environment) > 0 {
+		exp.Environment = p.captureEnvironment()
+	}
+	if len(p.seeds) > 0 {
+		exp.Seeds = p.captureSeeds(exp.Params)
 	}
 
 	// save json synchronously to uncover repository write issues
 	if _, err := p.SaveExperiment(exp, false); err != nil {
 		return nil, err
 	}
+	p.audit(&AuditRecord{Operation: AuditCreateExperiment, Command: exp.Command, Experiments: []string{exp.ID}})
+	if p.quota != nil {
+		p.measureQuota()
+	}
 
 	if exp.Path == "" {
 		if !quiet {
-			console.Info("Creating experiment %s...", exp.ShortID())
+			console.Info("Creating experiment %s (%s)...", exp.ShortID(), exp.Name)
 		}
 		return exp, nil
 	}
 
-	tempDir, err := repository.CopyToTempDir(p.directory, exp.Path)
+	tempDir, err := repository.CopyToTempDir(p.directory, exp.Path, p.exclude, p.errorOnSpecialFiles)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to copy files to temporary directory: %v", err)
 	}
 
 	if !quiet {
-		console.Info("Creating experiment %s, copying '%s' to '%s' in the background...", exp.ShortID(), exp.Path, p.repository.RootURL())
+		console.Info("Creating experiment %s (%s), copying '%s' to '%s' in the background...", exp.ShortID(), exp.Name, exp.Path, p.repository.RootURL())
 	}
 
 	work := func() error {
@@ -269,7 +402,7 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 	}
 
 	if async {
-		workChan <- work
+		p.queueUpload(workChan, "experiment", exp.ID, exp.Path, work)
 	} else {
 		if err := work(); err != nil {
 			return nil, err
@@ -279,6 +412,9 @@ func (p *Project) CreateExperiment(args CreateExperimentArgs, async bool, workCh
 }
 
 type CreateCheckpointArgs struct {
+	// Experiment is the experiment the checkpoint belongs to. If it is nil,
+	// the checkpoint is stored in the default layout.
+	Experiment    *Experiment
 	Path          string
 	Step          int64
 	Metrics       map[string]param.Value
@@ -293,6 +429,13 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 		Step:          args.Step,
 		Path:          args.Path,
 		PrimaryMetric: args.PrimaryMetric,
+		Serve:         p.serveSpec(),
+	}
+	if chk.Path != "" {
+		chk.StoragePath = p.checkpointStoragePath(args.Experiment, chk)
+		if err := p.requirePathVersion(chk.StoragePath); err != nil {
+			return nil, err
+		}
 	}
 
 	// if path is empty (i.e. it was None in python), just return
@@ -304,26 +447,77 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 		return chk, nil
 	}
 
+	p.waitForMaintenance()
+	if err := p.checkQuota(); err != nil {
+		return nil, err
+	}
+
 	if !quiet {
 		console.Info("Creating checkpoint %s, copying '%s' to '%s' in the background...", chk.ShortID(), chk.Path, p.repository.RootURL())
 	}
 
-	tempDir, err := repository.CopyToTempDir(p.directory, chk.Path)
+	manifest, err := p.statCheckpointFiles(chk)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read files in %s: %v", chk.Path, err)
+	}
+	tempDir, err := repository.CopyToTempDir(p.directory, chk.Path, p.exclude, p.errorOnSpecialFiles)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to copy files to temporary directory: %v", err)
 	}
+	if err := p.hashCheckpointFiles(chk, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Failed to hash files in %s to sign them: %v", chk.Path, err)
+	}
+	if err := p.selectTreeFiles(chk, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Failed to read files in %s: %v", chk.Path, err)
+	}
+	if err := p.selectPointerFiles(chk, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Failed to read files in %s: %v", chk.Path, err)
+	}
+	if err := p.referenceUnchangedFiles(args.Experiment, chk, tempDir, manifest); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Failed to compare files with the last checkpoint: %v", err)
+	}
+	if err := p.selectChunkedFiles(chk, tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("Failed to read files in %s: %v", chk.Path, err)
+	}
+	if p.quota != nil {
+		p.addQuotaUsage(manifest.uploadedSize(chk))
+	}
 
 	work := func() error {
 		defer os.RemoveAll(tempDir)
 		start := time.Now()
-		if err := p.repository.PutPathTar(tempDir, chk.StorageTarPath(), chk.Path); err != nil {
+		if err := p.putPointerFiles(chk, tempDir); err != nil {
+			p.forgetCheckpointFiles(args.Experiment, chk)
+			return err
+		}
+		if err := p.putChunkedFiles(chk, tempDir); err != nil {
+			p.forgetCheckpointFiles(args.Experiment, chk)
+			return err
+		}
+		if err := p.putTreeFiles(chk, tempDir); err != nil {
+			p.forgetCheckpointFiles(args.Experiment, chk)
+			return err
+		}
+		includePath := chk.Path
+		if exists, _ := files.FileExists(filepath.Join(tempDir, chk.Path)); !exists {
+			// The path is a file that hasn't changed, is chunked or is in
+			// another tree, so the tarball is empty
+			includePath = ""
+		}
+		if err := p.repository.PutPathTar(tempDir, chk.StorageTarPath(), includePath); err != nil {
+			p.forgetCheckpointFiles(args.Experiment, chk)
 			return err
 		}
 		console.Debug("Copied files for checkpoint %s from '%s' to '%s/%s' (took %.3f seconds)", chk.ShortID(), chk.Path, p.repository.RootURL(), chk.StorageTarPath(), time.Since(start).Seconds())
 		return nil
 	}
 	if async {
-		workChan <- work
+		p.queueUpload(workChan, "checkpoint", chk.ID, chk.Path, work)
 	} else {
 		if err := work(); err != nil {
 			return nil, err
@@ -335,7 +529,7 @@ func (p *Project) CreateCheckpoint(args CreateCheckpointArgs, async bool, workCh
 
 func (p *Project) SaveExperiment(exp *Experiment, quiet bool) (*Experiment, error) {
 	// TODO(andreas): use quiet flag
-	if err := exp.Save(p.repository); err != nil {
+	if err := p.saveExperimentWithEvents(exp); err != nil {
 		return nil, err
 	}
 	p.invalidateCache()
@@ -343,13 +537,22 @@ func (p *Project) SaveExperiment(exp *Experiment, quiet bool) (*Experiment, erro
 }
 
 func (p *Project) RefreshHeartbeat(experimentID string) error {
-	return CreateHeartbeat(p.repository, experimentID, time.Now().UTC())
+	now := time.Now().UTC()
+	if !p.heartbeatDue(experimentID, now) {
+		return nil
+	}
+	return CreateHeartbeat(p.repository, experimentID, now)
 }
 
 func (p *Project) StopExperiment(experimentID string) error {
+	p.forgetHeartbeat(experimentID)
+	p.forgetExperimentCheckpointFiles(experimentID)
 	if err := DeleteHeartbeat(p.repository, experimentID); err != nil {
 		return err
 	}
+	if err := p.CompactEvents(experimentID); err != nil {
+		console.Warn("Failed to compact the metadata of experiment %s: %s", experimentID, err)
+	}
 	p.invalidateCache()
 	return nil
 }
@@ -365,6 +568,12 @@ func (p *Project) ensureLoaded() error {
 	if p.hasLoaded {
 		return nil
 	}
+	if err := p.checkSpec(); err != nil {
+		return err
+	}
+	if err := p.FlushEvents(); err != nil {
+		console.Warn("Failed to write batched metadata: %s", err)
+	}
 	experiments, err := listExperiments(p.repository)
 	if err != nil {
 		return err
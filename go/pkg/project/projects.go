@@ -0,0 +1,49 @@
+package project
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// ProjectSummary is a project stored in a repository that is shared between
+// projects. See config.Config.Project.
+type ProjectSummary struct {
+	Name           string
+	NumExperiments int
+}
+
+// ListProjects returns the projects in the repository repo, sorted by name.
+// repo is the repository that the projects share, not one of the projects.
+// Projects are found by their repository spec, which is written when the
+// first experiment in them is created.
+func ListProjects(repo repository.Repository) ([]*ProjectSummary, error) {
+	results := make(chan repository.ListResult)
+	go repo.MatchFilenamesRecursive(context.Background(), results, config.ProjectsFolder, repository.SpecPath)
+	names := []string{}
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		// Only projects/<name>/repository.json, not files with the
+		// same name deeper in a project
+		parts := strings.Split(strings.TrimPrefix(result.Path, config.ProjectsFolder+"/"), "/")
+		if len(parts) == 2 {
+			names = append(names, parts[0])
+		}
+	}
+	sort.Strings(names)
+
+	summaries := []*ProjectSummary{}
+	for _, name := range names {
+		paths, err := repo.List(config.ProjectsFolder + "/" + name + "/metadata/experiments/")
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &ProjectSummary{Name: name, NumExperiments: len(paths)})
+	}
+	return summaries, nil
+}
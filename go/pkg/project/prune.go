@@ -0,0 +1,181 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// PruneItem is an experiment or checkpoint that Prune will delete
+type PruneItem struct {
+	Experiment *Experiment
+	// Checkpoint is nil if the whole experiment is being deleted
+	Checkpoint *Checkpoint
+	// Size is the number of bytes of files that will be deleted
+	Size   int64
+	Reason string
+}
+
+// PlanPrune returns the experiments and checkpoints that the retention
+// policy says should be deleted, as of now.
+//
+// Checkpoints of running experiments are never pruned, because the running
+// experiment would add them back to its metadata the next time it saves a
+// checkpoint.
+func (p *Project) PlanPrune(policy *config.Retention, now time.Time) ([]*PruneItem, error) {
+	items := []*PruneItem{}
+	if policy == nil {
+		return items, nil
+	}
+
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(experiments, func(i, j int) bool {
+		return experiments[i].Created.Before(experiments[j].Created)
+	})
+
+	sizes, err := p.objectSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exp := range experiments {
+		running, err := p.ExperimentIsRunning(exp.ID)
+		if err != nil {
+			return nil, err
+		}
+		if running {
+			console.Debug("Not pruning experiment %s because it is running", exp.ShortID())
+			continue
+		}
+
+		if policy.DeleteExperimentsAfterDays > 0 && now.Sub(exp.Created) > time.Duration(policy.DeleteExperimentsAfterDays)*24*time.Hour {
+			size := sizes[exp.StorageTarPath()] + sizes[exp.MetricsPath()]
+			for _, chk := range exp.Checkpoints {
+				size += checkpointSize(sizes, chk)
+			}
+			items = append(items, &PruneItem{
+				Experiment: exp,
+				Size:       size,
+				Reason:     fmt.Sprintf("older than %d days", policy.DeleteExperimentsAfterDays),
+			})
+			continue
+		}
+
+		if policy.KeepLastCheckpoints == 0 || len(exp.Checkpoints) <= policy.KeepLastCheckpoints {
+			continue
+		}
+		checkpoints := copyCheckpoints(exp.Checkpoints)
+		sort.SliceStable(checkpoints, func(i, j int) bool {
+			return checkpoints[i].Created.Before(checkpoints[j].Created)
+		})
+		var best *Checkpoint
+		if policy.KeepBestCheckpoint {
+			best = exp.BestCheckpoint()
+		}
+		for _, chk := range checkpoints[:len(checkpoints)-policy.KeepLastCheckpoints] {
+			if chk == best {
+				continue
+			}
+			items = append(items, &PruneItem{
+				Experiment: exp,
+				Checkpoint: chk,
+				Size:       checkpointSize(sizes, chk),
+				Reason:     fmt.Sprintf("not one of the last %d checkpoints", policy.KeepLastCheckpoints),
+			})
+		}
+	}
+	return items, nil
+}
+
+// Prune deletes the experiments and checkpoints returned by PlanPrune.
+// Pruned checkpoints are removed from their experiment's metadata.
+func (p *Project) Prune(items []*PruneItem) error {
+	lock, err := p.lockForMaintenance("pruning")
+	if err != nil {
+		return err
+	}
+	defer releaseLock(lock)
+
+	prunedCheckpoints := map[*Experiment]map[string]bool{}
+	experiments := []*Experiment{}
+
+	// Checkpoints are deleted together so tarballs that are only referenced
+	// by pruned checkpoints are deleted too
+	checkpoints := []*Checkpoint{}
+	for _, item := range items {
+		if item.Checkpoint == nil {
+			checkpoints = append(checkpoints, item.Experiment.Checkpoints...)
+		} else {
+			checkpoints = append(checkpoints, item.Checkpoint)
+		}
+	}
+	if err := p.deleteCheckpoints(checkpoints); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.Checkpoint == nil {
+			if err := p.deleteExperiment(item.Experiment); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := prunedCheckpoints[item.Experiment]; !ok {
+			prunedCheckpoints[item.Experiment] = map[string]bool{}
+			experiments = append(experiments, item.Experiment)
+		}
+		prunedCheckpoints[item.Experiment][item.Checkpoint.ID] = true
+	}
+
+	for _, exp := range experiments {
+		checkpoints := []*Checkpoint{}
+		for _, chk := range exp.Checkpoints {
+			if !prunedCheckpoints[exp][chk.ID] {
+				checkpoints = append(checkpoints, chk)
+			}
+		}
+		exp.Checkpoints = checkpoints
+		if _, err := p.SaveExperiment(exp, true); err != nil {
+			return err
+		}
+	}
+
+	record := &AuditRecord{Operation: AuditPrune}
+	for _, item := range items {
+		if item.Checkpoint == nil {
+			record.Experiments = append(record.Experiments, item.Experiment.ID)
+		}
+	}
+	record.Checkpoints = checkpointIDs(checkpoints)
+	p.audit(record)
+	return nil
+}
+
+// objectSizes returns the size of each experiment and checkpoint tarball
+func (p *Project) objectSizes() (map[string]int64, error) {
+	results, err := p.listRecursiveAll("experiments", "checkpoints", "metrics")
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, result := range results {
+		sizes[result.Path] = result.Size
+	}
+	return sizes, nil
+}
+
+// checkpointSize returns the size of the tarballs of chk, from the sizes that
+// objectSizes returned
+func checkpointSize(sizes map[string]int64, chk *Checkpoint) int64 {
+	var size int64
+	for _, tarPath := range checkpointTarPaths(chk.StoragePath, chk.ID) {
+		size += sizes[tarPath]
+	}
+	return size
+}
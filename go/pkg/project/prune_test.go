@@ -0,0 +1,98 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestPrune(t *testing.T) {
+	dir, err := files.TempDir("test-prune")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := repository.NewDiskRepository(path.Join(dir, ".replicate"))
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	day := 24 * time.Hour
+	primaryMetric := &PrimaryMetric{Name: "loss", Goal: GoalMinimize}
+
+	old := &Experiment{
+		ID:      "1eeeeeeeee",
+		Created: now.Add(-40 * day),
+		Config:  &config.Config{},
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Created: now.Add(-40 * day)},
+		},
+	}
+	require.NoError(t, old.Save(repo))
+	require.NoError(t, repo.Put("checkpoints/1ccccccccc.tar.gz", []byte("12345")))
+
+	recent := &Experiment{
+		ID:      "2eeeeeeeee",
+		Created: now.Add(-1 * day),
+		Config:  &config.Config{},
+	}
+	for i, loss := range []float64{0.1, 0.5, 0.4, 0.3} {
+		chk := &Checkpoint{
+			ID:            string('a'+rune(i)) + "cccccccccc",
+			Created:       now.Add(-time.Duration(10-i) * time.Hour),
+			Metrics:       param.ValueMap{"loss": param.Float(loss)},
+			PrimaryMetric: primaryMetric,
+			Path:          "weights",
+		}
+		recent.Checkpoints = append(recent.Checkpoints, chk)
+		require.NoError(t, repo.Put(chk.StorageTarPath(), []byte("123")))
+	}
+	require.NoError(t, recent.Save(repo))
+
+	proj := NewProject(repo, dir)
+
+	// No policy, nothing to prune
+	items, err := proj.PlanPrune(nil, now)
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	policy := &config.Retention{
+		KeepLastCheckpoints:        2,
+		KeepBestCheckpoint:         true,
+		DeleteExperimentsAfterDays: 30,
+	}
+	items, err = proj.PlanPrune(policy, now)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, "1eeeeeeeee", items[0].Experiment.ID)
+	require.Nil(t, items[0].Checkpoint)
+	require.Equal(t, int64(5), items[0].Size)
+	// acccccccccc is the best, and ccccccccccc and dcccccccccc are the last two
+	require.Equal(t, "bcccccccccc", items[1].Checkpoint.ID)
+	require.Equal(t, int64(3), items[1].Size)
+
+	require.NoError(t, proj.Prune(items))
+
+	experiments, err := proj.Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	ids := []string{}
+	for _, chk := range experiments[0].Checkpoints {
+		ids = append(ids, chk.ID)
+	}
+	require.Equal(t, []string{"acccccccccc", "ccccccccccc", "dcccccccccc"}, ids)
+	exists, err := files.FileExists(path.Join(dir, ".replicate/checkpoints/bcccccccccc.tar.gz"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Running again prunes nothing
+	items, err = proj.PlanPrune(policy, now)
+	require.NoError(t, err)
+	require.Empty(t, items)
+}
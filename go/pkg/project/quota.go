@@ -0,0 +1,215 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// With a quota in replicate.yaml, how much storage the project uses, and how
+// much the files of each user's experiments use, is measured when
+// experiments are created, and recorded in metadata/usage.json, so `replicate
+// ls` and `replicate status` can warn about it without listing the whole
+// repository. Past the hard limit, new checkpoints are rejected.
+
+const usagePath = "metadata/usage.json"
+
+// UsageMaxAge is how old the recorded usage can be before `replicate status`
+// measures it again
+const UsageMaxAge = time.Hour
+
+// usageFolders are the folders that count towards the project's usage
+var usageFolders = []string{"metadata", "metrics", "experiments", "checkpoints", "chunks", "blobs", ModelsDir, TrashDir, SnapshotsDir}
+
+// Usage is how much storage the project uses
+type Usage struct {
+	Measured time.Time `json:"measured"`
+
+	// Bytes is the size of everything in the project
+	Bytes int64 `json:"bytes"`
+
+	// Users is the size of the files of each user's experiments and
+	// checkpoints. Chunks and large files can be shared by several users'
+	// checkpoints, so they only count towards Bytes.
+	Users map[string]int64 `json:"users"`
+}
+
+// QuotaWarning is a limit that usage is past
+type QuotaWarning struct {
+	// User is empty if it is the project's limit
+	User  string
+	Used  int64
+	Limit int64
+	// Hard is whether it is the hard limit
+	Hard bool
+}
+
+func (w *QuotaWarning) String() string {
+	whose := "The project uses"
+	if w.User != "" {
+		whose = fmt.Sprintf("Experiments by %s use", w.User)
+	}
+	if w.Hard {
+		return fmt.Sprintf("%s %s, which is past the quota of %s in replicate.yaml, so new checkpoints can't be saved. Remove experiments or checkpoints with 'replicate rm' to free up space.", whose, formatGB(w.Used), formatGB(w.Limit))
+	}
+	return fmt.Sprintf("%s %s, which is past the soft quota of %s in replicate.yaml.", whose, formatGB(w.Used), formatGB(w.Limit))
+}
+
+func formatGB(n int64) string {
+	return fmt.Sprintf("%.1f GB", float64(n)/1e9)
+}
+
+// projectQuota is the usage that new checkpoints are checked against
+type projectQuota struct {
+	mu    sync.Mutex
+	usage *Usage
+	// added is the size of the files of checkpoints saved since usage was
+	// measured, before they are compressed
+	added int64
+}
+
+// SetQuota sets the limits on how much storage the project can use
+func (p *Project) SetQuota(quota *config.Quota) {
+	p.quota = quota
+}
+
+// MeasureUsage lists the repository to find how much storage it uses, and
+// records it
+func (p *Project) MeasureUsage() (*Usage, error) {
+	results, err := p.listRecursiveAll(usageFolders...)
+	if err != nil {
+		return nil, err
+	}
+	usage := &Usage{Measured: time.Now().UTC(), Users: map[string]int64{}}
+	sizes := map[string]int64{}
+	for _, result := range results {
+		usage.Bytes += result.Size
+		sizes[result.Path] = result.Size
+	}
+
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	for _, exp := range experiments {
+		usage.Users[exp.User] += experimentSize(sizes, exp)
+	}
+
+	data, err := json.MarshalIndent(usage, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.repository.Put(usagePath, data); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// experimentSize returns the size of the files of exp and its checkpoints
+// in sizes, which are the sizes of objects by path
+func experimentSize(sizes map[string]int64, exp *Experiment) int64 {
+	size := sizes[exp.StorageTarPath()] + sizes[exp.MetricsPath()]
+	for _, chk := range exp.Checkpoints {
+		size += checkpointSize(sizes, chk)
+	}
+	return size
+}
+
+// LoadUsage returns the usage that was last recorded, or nil if it hasn't
+// been measured
+func (p *Project) LoadUsage() (*Usage, error) {
+	usage := new(Usage)
+	if err := loadFromPath(p.repository, usagePath, usage); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return usage, nil
+}
+
+// QuotaWarnings returns the limits that usage is past, for the project and
+// for username. Only the hard limit is returned if both are past.
+func (p *Project) QuotaWarnings(usage *Usage, username string) []*QuotaWarning {
+	warnings := []*QuotaWarning{}
+	if p.quota == nil || usage == nil {
+		return warnings
+	}
+	check := func(limits *config.QuotaLimits, user string, used int64) {
+		if limits == nil {
+			return
+		}
+		if limit := limits.HardLimit(); limit > 0 && used >= limit {
+			warnings = append(warnings, &QuotaWarning{User: user, Used: used, Limit: limit, Hard: true})
+		} else if limit := limits.SoftLimit(); limit > 0 && used >= limit {
+			warnings = append(warnings, &QuotaWarning{User: user, Used: used, Limit: limit})
+		}
+	}
+	check(p.quota.Project, "", usage.Bytes)
+	check(p.quota.User, username, usage.Users[username])
+	return warnings
+}
+
+// measureQuota measures usage when an experiment is created, and warns if it
+// is past a limit. A failure to measure it is only a warning, so
+// experiments carry on.
+func (p *Project) measureQuota() {
+	usage, err := p.MeasureUsage()
+	if err != nil {
+		console.Warn("Failed to measure how much storage the project uses: %s", err)
+		return
+	}
+	p.projectQuota.mu.Lock()
+	p.projectQuota.usage = usage
+	p.projectQuota.added = 0
+	p.projectQuota.mu.Unlock()
+	for _, warning := range p.QuotaWarnings(usage, CurrentUsername()) {
+		console.Warn("%s", warning)
+	}
+}
+
+// checkQuota returns an error if the project or the current user is past a
+// hard limit, counting the checkpoints saved since usage was measured
+func (p *Project) checkQuota() error {
+	p.projectQuota.mu.Lock()
+	defer p.projectQuota.mu.Unlock()
+	if p.projectQuota.usage == nil {
+		return nil
+	}
+	username := CurrentUsername()
+	usage := &Usage{
+		Bytes: p.projectQuota.usage.Bytes + p.projectQuota.added,
+		Users: map[string]int64{username: p.projectQuota.usage.Users[username] + p.projectQuota.added},
+	}
+	for _, warning := range p.QuotaWarnings(usage, username) {
+		if warning.Hard {
+			return errors.QuotaExceeded(warning.String())
+		}
+	}
+	return nil
+}
+
+// addQuotaUsage counts the files of a checkpoint towards the usage that new
+// checkpoints are checked against. size is the size of the files that are
+// uploaded, before they are compressed, so it errs on the side of too much.
+func (p *Project) addQuotaUsage(size int64) {
+	p.projectQuota.mu.Lock()
+	defer p.projectQuota.mu.Unlock()
+	p.projectQuota.added += size
+}
+
+// CurrentUsername returns the name of the user running this, which is who
+// experiments are created by
+func CurrentUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return currentUser.Username
+}
@@ -0,0 +1,57 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestQuota(t *testing.T) {
+	projectDir, err := files.TempDir("test-quota")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-quota-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "weights.pt"), make([]byte, 1000), 0644))
+
+	// No usage is recorded without a quota
+	_, err = proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	usage, err := proj.LoadUsage()
+	require.NoError(t, err)
+	require.Nil(t, usage)
+
+	proj.SetQuota(&config.Quota{Project: &config.QuotaLimits{SoftLimitGB: 1e-9}})
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	usage, err = proj.LoadUsage()
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	require.Greater(t, usage.Bytes, int64(0))
+	require.Contains(t, usage.Users, exp.User)
+
+	warnings := proj.QuotaWarnings(usage, exp.User)
+	require.Len(t, warnings, 1)
+	require.False(t, warnings[0].Hard)
+	require.Equal(t, "", warnings[0].User)
+
+	// The first checkpoint fits, and puts the project past the hard limit
+	proj.quota.Project.HardLimitGB = float64(usage.Bytes+500) / 1e9
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pt"}, false, nil, true)
+	require.NoError(t, err)
+	_, err = proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pt"}, false, nil, true)
+	require.Error(t, err)
+	require.True(t, errors.IsQuotaExceeded(err))
+}
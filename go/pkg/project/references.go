@@ -0,0 +1,443 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Most of the files in a checkpoint are usually the same as in the one before,
+// e.g. a config file and a tokenizer saved alongside the weights. Files that
+// haven't changed since the last checkpoint of the same experiment with the
+// same path aren't uploaded again. The checkpoint references the tarball that
+// has them instead. Checkpoints never reference another experiment's files,
+// because that experiment could be deleted.
+
+// checkpointManifestKey is the experiment and path of checkpoints whose
+// files can be referenced by the next checkpoint with the same key.
+// Checkpoints whose experiment isn't known have an empty experimentID, so
+// they only reference each other.
+type checkpointManifestKey struct {
+	experimentID string
+	path         string
+}
+
+func newCheckpointManifestKey(exp *Experiment, chk *Checkpoint) checkpointManifestKey {
+	key := checkpointManifestKey{path: chk.Path}
+	if exp != nil {
+		key.experimentID = exp.ID
+	}
+	return key
+}
+
+// checkpointFile is a file in the last checkpoint of an experiment and path
+type checkpointFile struct {
+	size    int64
+	modTime time.Time
+	// checkpointID is the checkpoint whose tarball has the file, and
+	// storagePath is that checkpoint's StoragePath
+	checkpointID string
+	storagePath  string
+}
+
+// checkpointManifest is the files in the last checkpoint of an experiment
+// and path
+type checkpointManifest struct {
+	// started is when the files were looked at. A file that changed in the
+	// same instant could still have the same modification time afterwards,
+	// so only files modified before this are trusted to be unchanged.
+	started time.Time
+	files   map[string]checkpointFile
+}
+
+// statCheckpointFiles returns the size and modification time of each file in
+// chk.Path, keyed by their path relative to the project directory. This is
+// done before the files are copied, so a file that changes while it is copied
+// won't match next time.
+func (p *Project) statCheckpointFiles(chk *Checkpoint) (*checkpointManifest, error) {
+	manifest := &checkpointManifest{started: time.Now(), files: map[string]checkpointFile{}}
+	err := filepath.Walk(filepath.Join(p.directory, chk.Path), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Other snapshots in .replicate/tmp can be removed as this runs
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() && info.Name() == ".replicate" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(p.directory, currentPath)
+		if err != nil {
+			return err
+		}
+		manifest.files[filepath.ToSlash(relPath)] = checkpointFile{size: info.Size(), modTime: info.ModTime(), checkpointID: chk.ID, storagePath: chk.StoragePath}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// referenceUnchangedFiles removes files from the snapshot in tempDir that
+// haven't changed since the last checkpoint of exp with the same path, and
+// adds references to them to chk. manifest is what statCheckpointFiles
+// returned, and becomes the last checkpoint of the experiment and path.
+func (p *Project) referenceUnchangedFiles(exp *Experiment, chk *Checkpoint, tempDir string, manifest *checkpointManifest) error {
+	p.checkpointManifestsMu.Lock()
+	defer p.checkpointManifestsMu.Unlock()
+	if p.checkpointManifests == nil {
+		p.checkpointManifests = map[checkpointManifestKey]*checkpointManifest{}
+	}
+	key := newCheckpointManifestKey(exp, chk)
+	previous := p.checkpointManifests[key]
+	p.checkpointManifests[key] = manifest
+	if previous == nil {
+		return nil
+	}
+
+	for relPath, file := range manifest.files {
+		prev, ok := previous.files[relPath]
+		if !ok || prev.size != file.size || !prev.modTime.Equal(file.modTime) || !prev.modTime.Before(previous.started) {
+			continue
+		}
+		snapshotPath := filepath.Join(tempDir, filepath.FromSlash(relPath))
+		if exists, err := files.FileExists(snapshotPath); err != nil {
+			return err
+		} else if !exists {
+			// Excluded, so it isn't part of the checkpoint
+			continue
+		}
+		if err := os.Remove(snapshotPath); err != nil {
+			return err
+		}
+		if chk.References == nil {
+			chk.References = map[string]string{}
+		}
+		chk.References[relPath] = prev.checkpointID
+		if prev.storagePath != "" {
+			if chk.ReferencedStoragePaths == nil {
+				chk.ReferencedStoragePaths = map[string]string{}
+			}
+			chk.ReferencedStoragePaths[prev.checkpointID] = prev.storagePath
+		}
+		file.checkpointID = prev.checkpointID
+		file.storagePath = prev.storagePath
+		manifest.files[relPath] = file
+	}
+	if len(chk.References) > 0 {
+		console.Debug("%d files in checkpoint %s haven't changed since the last checkpoint", len(chk.References), chk.ShortID())
+	}
+	return nil
+}
+
+// uploadedSize returns the size of the files in manifest that are uploaded
+// with chk, rather than referenced
+func (m *checkpointManifest) uploadedSize(chk *Checkpoint) int64 {
+	var size int64
+	for _, file := range m.files {
+		if file.checkpointID == chk.ID {
+			size += file.size
+		}
+	}
+	return size
+}
+
+// forgetCheckpointFiles makes the next checkpoint of exp with chk's path
+// upload all its files, because this checkpoint's tarball failed to upload
+func (p *Project) forgetCheckpointFiles(exp *Experiment, chk *Checkpoint) {
+	p.checkpointManifestsMu.Lock()
+	defer p.checkpointManifestsMu.Unlock()
+	delete(p.checkpointManifests, newCheckpointManifestKey(exp, chk))
+}
+
+// forgetExperimentCheckpointFiles forgets the files in the checkpoints of
+// an experiment that has stopped
+func (p *Project) forgetExperimentCheckpointFiles(experimentID string) {
+	p.checkpointManifestsMu.Lock()
+	defer p.checkpointManifestsMu.Unlock()
+	for key := range p.checkpointManifests {
+		if key.experimentID == experimentID {
+			delete(p.checkpointManifests, key)
+		}
+	}
+}
+
+// resetCheckpointFiles stops checkpoints referencing files in checkpoints
+// made before it was called, because they might have been moved or deleted
+func (p *Project) resetCheckpointFiles() {
+	p.checkpointManifestsMu.Lock()
+	defer p.checkpointManifestsMu.Unlock()
+	p.checkpointManifests = nil
+}
+
+// checkoutReferences copies the files chk references from earlier checkpoints
+// to outputDir. If includePath isn't empty, only files at or inside it are
+// copied. It returns the number of files that were copied.
+func (p *Project) checkoutReferences(chk *Checkpoint, outputDir string, includePath string) (int, error) {
+	count := 0
+	for id, filePaths := range chk.ReferencedCheckpoints() {
+		if includePath != "" {
+			filePaths = filterPaths(filePaths, path.Clean(includePath))
+		}
+		filePaths = p.filterCheckoutTrees(chk, filePaths)
+		if len(filePaths) == 0 {
+			continue
+		}
+		if err := p.checkoutReferencedFiles(chk, id, filePaths, outputDir); err != nil {
+			return count, err
+		}
+		count += len(filePaths)
+	}
+	return count, nil
+}
+
+// checkoutReferencedFiles copies filePaths from the checkpoint with ID id to
+// outputDir, from its chunks if they are chunked and the tarballs of their
+// trees if not
+func (p *Project) checkoutReferencedFiles(chk *Checkpoint, id string, filePaths []string, outputDir string) error {
+	manifest, err := p.loadChunkManifest(id)
+	if err != nil {
+		return err
+	}
+	tarFilePaths := []string{}
+	for _, filePath := range filePaths {
+		if manifest != nil && manifest.Files[filePath] != nil {
+			if err := p.getChunkedFile(manifest.Files[filePath], filepath.Join(outputDir, filepath.FromSlash(filePath))); err != nil {
+				return fmt.Errorf("Failed to download chunks of %s: %w", filePath, err)
+			}
+			continue
+		}
+		tarFilePaths = append(tarFilePaths, filePath)
+	}
+	tarFilePathsByTree := map[string][]string{}
+	for _, filePath := range tarFilePaths {
+		tree := chk.TreeOf(filePath)
+		tarFilePathsByTree[tree] = append(tarFilePathsByTree[tree], filePath)
+	}
+	for _, tree := range TreeNames {
+		if len(tarFilePathsByTree[tree]) == 0 {
+			continue
+		}
+		if err := p.checkoutReferencedTar(chk, chk.referencedTreeTarPath(id, tree), tarFilePathsByTree[tree], outputDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutReferencedTar copies filePaths from the tarball of an earlier
+// checkpoint at tarPath to outputDir
+func (p *Project) checkoutReferencedTar(chk *Checkpoint, tarPath string, filePaths []string, outputDir string) error {
+	if err := p.ensureRestored(tarPath); err != nil {
+		return err
+	}
+	var tarDir string
+	if p.checkoutCache != nil {
+		// Other checkpoints being checked out are likely to reference the
+		// same tarball, so all of it is extracted once
+		cachePath, err := p.checkoutCache.fetch("tar:"+tarPath, func(cachePath string) error {
+			return p.getReferencedTar(chk, tarPath, cachePath)
+		})
+		if err != nil {
+			return err
+		}
+		tarDir = cachePath
+	} else {
+		if index := repository.LoadTarIndex(p.repository, tarPath); index != nil {
+			return repository.ExtractFromIndexedTar(p.repository, tarPath, index, filePaths, outputDir)
+		}
+		tempDir, err := files.TempDir("checkout-references")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempDir)
+		if err := p.getReferencedTar(chk, tarPath, tempDir); err != nil {
+			return err
+		}
+		tarDir = tempDir
+	}
+	for _, filePath := range filePaths {
+		dest := filepath.Join(outputDir, filepath.FromSlash(filePath))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := files.CloneFile(filepath.Join(tarDir, filepath.FromSlash(filePath)), dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getReferencedTar extracts the tarball at tarPath, which has files that chk
+// references, to dir
+func (p *Project) getReferencedTar(chk *Checkpoint, tarPath string, dir string) error {
+	if err := p.repository.GetPathTar(tarPath, dir); err != nil {
+		if errors.IsDoesNotExist(err) {
+			return errors.DoesNotExist(fmt.Sprintf("Checkpoint %s has files that are stored with an earlier checkpoint at %q, but it could not be found.\nMaybe it has been deleted, or the repository is corrupted?", chk.ShortID(), tarPath))
+		}
+		return err
+	}
+	return nil
+}
+
+// filterPaths returns the paths that are includePath or inside it
+func filterPaths(paths []string, includePath string) []string {
+	ret := []string{}
+	for _, p := range paths {
+		if includePath == "." || p == includePath || strings.HasPrefix(p, includePath+"/") {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// DeleteCheckpoints deletes the files of chks. A checkpoint's tarball is kept
+// if checkpoints that aren't being deleted reference files in it, and deleted
+// along with the last checkpoint that references it. Chunks are deleted when
+// no checkpoint that is left uses them.
+//
+// Checkpoints should be removed from their experiment's metadata too, but
+// that's up to the caller.
+func (p *Project) DeleteCheckpoints(chks []*Checkpoint) error {
+	lock, err := p.lockForMaintenance("deleting checkpoints")
+	if err != nil {
+		return err
+	}
+	defer releaseLock(lock)
+	if err := p.deleteCheckpoints(chks); err != nil {
+		return err
+	}
+	if len(chks) > 0 {
+		p.audit(&AuditRecord{Operation: AuditDeleteCheckpoints, Checkpoints: checkpointIDs(chks)})
+	}
+	return nil
+}
+
+// deleteCheckpoints is DeleteCheckpoints, without recording it in the audit
+// log
+func (p *Project) deleteCheckpoints(chks []*Checkpoint) error {
+	toDelete, deletedIDs, keep, err := p.checkpointObjects(chks)
+	if err != nil {
+		return err
+	}
+	blobPaths, err := p.unusedBlobs(chks, "")
+	if err != nil {
+		console.Warn("Failed to find large files to delete: %s", err)
+	}
+	for _, tarPath := range toDelete {
+		if err := p.repository.Delete(tarPath); err != nil {
+			console.Warn("Failed to delete checkpoint storage directory %s: %s", tarPath, err)
+		}
+		if err := p.repository.Delete(repository.TarIndexPath(tarPath)); err != nil {
+			console.Warn("Failed to delete checkpoint index %s: %s", repository.TarIndexPath(tarPath), err)
+		}
+	}
+	if err := p.deleteUnusedChunks(deletedIDs, keep); err != nil {
+		console.Warn("Failed to delete chunks: %s", err)
+	}
+	p.deleteBlobs(blobPaths)
+	p.invalidateCache()
+	return nil
+}
+
+// keptCheckpointIDs returns the IDs of the checkpoints that are left if the
+// checkpoints in deleting are deleted, and of the checkpoints whose tarballs
+// they reference. Checkpoints in the trash are kept too, so they can still
+// be restored.
+func (p *Project) keptCheckpointIDs(deleting map[string]bool) (map[string]bool, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := []*Checkpoint{}
+	for _, exp := range experiments {
+		checkpoints = append(checkpoints, exp.Checkpoints...)
+	}
+	for _, entry := range entries {
+		checkpoints = append(checkpoints, entry.checkpoints()...)
+	}
+	keep := map[string]bool{}
+	for _, chk := range checkpoints {
+		if deleting[chk.ID] {
+			continue
+		}
+		keep[chk.ID] = true
+		for _, id := range chk.References {
+			keep[id] = true
+		}
+	}
+	return keep, nil
+}
+
+// checkpointObjects returns the tarballs that are deleted along with chks,
+// the IDs of the checkpoints whose tarballs they are, and the IDs of the
+// checkpoints that are kept. See DeleteCheckpoints.
+func (p *Project) checkpointObjects(chks []*Checkpoint) (toDelete []string, deletedIDs []string, keep map[string]bool, err error) {
+	deleting := map[string]bool{}
+	for _, chk := range chks {
+		deleting[chk.ID] = true
+	}
+	keep, err = p.keptCheckpointIDs(deleting)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	toDelete = []string{}
+	deletedIDs = []string{}
+	seenIDs := map[string]bool{}
+	seenTarPaths := map[string]bool{}
+	for _, chk := range chks {
+		// Tarballs of checkpoints that have already been deleted, which
+		// were kept because this checkpoint referenced them. Their metadata
+		// is gone, so it isn't known which trees they have, and the
+		// tarballs of all of them are deleted.
+		ids := []string{chk.ID}
+		tarPaths := map[string][]string{}
+		for _, tree := range chk.StoredTrees() {
+			tarPaths[chk.ID] = append(tarPaths[chk.ID], chk.TreeTarPath(tree))
+		}
+		for _, id := range chk.References {
+			ids = append(ids, id)
+			if id != chk.ID {
+				tarPaths[id] = checkpointTarPaths(chk.ReferencedStoragePaths[id], id)
+			}
+		}
+		for _, id := range ids {
+			if keep[id] {
+				if !seenIDs[id] {
+					console.Debug("Keeping %s, because other checkpoints have files in it", chk.referencedTreeTarPath(id, TreeCode))
+				}
+				seenIDs[id] = true
+				continue
+			}
+			if !seenIDs[id] {
+				deletedIDs = append(deletedIDs, id)
+			}
+			seenIDs[id] = true
+			for _, tarPath := range tarPaths[id] {
+				if !seenTarPaths[tarPath] {
+					seenTarPaths[tarPath] = true
+					toDelete = append(toDelete, tarPath)
+				}
+			}
+		}
+	}
+	return toDelete, deletedIDs, keep, nil
+}
@@ -0,0 +1,155 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestCheckpointReferencesUnchangedFiles(t *testing.T) {
+	projectDir, err := files.TempDir("test-references")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-references-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	// Modified in the past, so they aren't modified in the same instant as
+	// the checkpoint is made
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	for _, name := range []string{"config.json", "weights.pt"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", name), []byte(name+" 1"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(projectDir, "model", name), past, past))
+	}
+
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, chk1.References)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights.pt 2"), 0644))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"model/config.json": chk1.ID}, chk2.References)
+	tarFiles, err := repo.ListTarFile(chk2.StorageTarPath())
+	require.NoError(t, err)
+	require.Equal(t, []string{"model/weights.pt"}, tarFiles)
+
+	// References point at the tarball that has the file, not the last checkpoint
+	chk3, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, chk1.ID, chk3.References["model/config.json"])
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2, chk3},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// Checking out puts referenced files back
+	outputDir, err := files.TempDir("test-references-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.CheckoutCheckpoint(chk2, exp, outputDir, true))
+	contents, err := ioutil.ReadFile(path.Join(outputDir, "model", "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "config.json 1", string(contents))
+	contents, err = ioutil.ReadFile(path.Join(outputDir, "model", "weights.pt"))
+	require.NoError(t, err)
+	require.Equal(t, "weights.pt 2", string(contents))
+
+	// The first checkpoint's tarball is kept while other checkpoints refer to it
+	require.NoError(t, proj.DeleteCheckpoint(chk1))
+	exp.Checkpoints = []*Checkpoint{chk2, chk3}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	exists, err := files.FileExists(path.Join(repoDir, chk1.StorageTarPath()))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// ...and deleted with the last of them
+	require.NoError(t, proj.DeleteCheckpoints([]*Checkpoint{chk2, chk3}))
+	for _, chk := range []*Checkpoint{chk1, chk2, chk3} {
+		exists, err := files.FileExists(path.Join(repoDir, chk.StorageTarPath()))
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+}
+
+func TestCheckpointReferencesSingleFile(t *testing.T) {
+	projectDir, err := files.TempDir("test-references")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "weights.pt"), []byte("weights"), 0644))
+	require.NoError(t, os.Chtimes(path.Join(projectDir, "weights.pt"), past, past))
+
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pt"}, false, nil, true)
+	require.NoError(t, err)
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "weights.pt"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"weights.pt": chk1.ID}, chk2.References)
+
+	tarFiles, err := repo.ListTarFile(chk2.StorageTarPath())
+	require.NoError(t, err)
+	require.Empty(t, tarFiles)
+}
+
+func TestCheckpointReferencesOnlyTheSameExperiment(t *testing.T) {
+	projectDir, err := files.TempDir("test-references")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "config.json"), []byte("config"), 0644))
+	require.NoError(t, os.Chtimes(path.Join(projectDir, "model", "config.json"), past, past))
+
+	exp1, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp1, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+
+	// Another experiment doesn't reference the first one's files, which
+	// could be deleted with it...
+	exp2, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp2, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, chk2.References)
+
+	// ...and creating it doesn't stop the first one referencing its own
+	chk3, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp1, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"model/config.json": chk1.ID}, chk3.References)
+	chk4, err := proj.CreateCheckpoint(CreateCheckpointArgs{Experiment: exp2, Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"model/config.json": chk2.ID}, chk4.References)
+
+	// Stopped experiments are forgotten
+	require.NoError(t, proj.StopExperiment(exp1.ID))
+	proj.checkpointManifestsMu.Lock()
+	require.Len(t, proj.checkpointManifests, 1)
+	proj.checkpointManifestsMu.Unlock()
+}
@@ -0,0 +1,71 @@
+package project
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// restoreDays is how long restored copies of archived files are kept for
+const restoreDays = 7
+
+// restorePollInterval is how often archived files are checked while waiting
+// for them to be restored
+var restorePollInterval = time.Minute
+
+// SetWaitForRestore sets whether checking out files that are in an archive
+// storage class waits for them to be restored. If it doesn't, a restore is
+// requested and an error is returned.
+func (p *Project) SetWaitForRestore(wait bool) {
+	p.waitForRestore = wait
+}
+
+// ensureRestored makes sure the tarball at tarPath can be read, requesting a
+// restore if it is in an archive storage class
+func (p *Project) ensureRestored(tarPath string) error {
+	// Prefetched copies are read instead, even if it has been archived since
+	if prefetcher, ok := repository.AsPrefetching(p.repository); ok && prefetcher.IsPrefetched(tarPath) {
+		return nil
+	}
+	restorer, ok := repository.AsRestorer(p.repository)
+	if !ok {
+		return nil
+	}
+	status, err := restorer.ArchiveStatus(tarPath)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			// Let the caller report it
+			return nil
+		}
+		return err
+	}
+	if !status.Archived {
+		return nil
+	}
+
+	url := p.repository.RootURL() + "/" + tarPath
+	if !status.Restoring {
+		console.Info("%s is in the %s storage class, so it needs to be restored before it can be checked out. Requesting a restore...", url, status.StorageClass)
+		if err := restorer.Restore(tarPath, restoreDays); err != nil {
+			return err
+		}
+	}
+	if !p.waitForRestore {
+		return errors.Archived(fmt.Sprintf("%s is being restored from the %s storage class, which usually takes %s. Try again when it has finished.", url, status.StorageClass, status.RestoreTime))
+	}
+
+	console.Info("Waiting for %s to be restored, which usually takes %s. You can press Ctrl-C and run this command again later, and the restore will carry on.", url, status.RestoreTime)
+	start := time.Now()
+	for status.Archived {
+		time.Sleep(restorePollInterval)
+		if status, err = restorer.ArchiveStatus(tarPath); err != nil {
+			return err
+		}
+		console.Debug("Still waiting for %s to be restored (%s so far)", url, time.Since(start).Round(time.Second))
+	}
+	console.Info("Restored %s", url)
+	return nil
+}
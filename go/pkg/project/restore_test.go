@@ -0,0 +1,65 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// archiveRepository is a disk repository where every object is archived
+// until it has been polled restoreAfter times after a restore was requested
+type archiveRepository struct {
+	*repository.DiskRepository
+	restoreRequested bool
+	restoreAfter     int
+}
+
+func (r *archiveRepository) ArchiveStatus(p string) (*repository.ArchiveStatus, error) {
+	status := &repository.ArchiveStatus{StorageClass: "GLACIER", RestoreTime: "3-5 hours"}
+	if r.restoreRequested {
+		r.restoreAfter--
+		status.Restoring = r.restoreAfter > 0
+	}
+	status.Archived = !r.restoreRequested || status.Restoring
+	return status, nil
+}
+
+func (r *archiveRepository) Restore(p string, days int) error {
+	r.restoreRequested = true
+	return nil
+}
+
+func TestEnsureRestored(t *testing.T) {
+	projectDir, err := files.TempDir("test-restore")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+
+	disk, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+
+	// Repositories without archive storage classes don't need restoring
+	proj := NewProject(disk, projectDir)
+	require.NoError(t, proj.ensureRestored("checkpoints/1ccc.tar.gz"))
+
+	// Without waiting, a restore is requested and an error is returned
+	repo := &archiveRepository{DiskRepository: disk, restoreAfter: 3}
+	proj = NewProject(repo, projectDir)
+	err = proj.ensureRestored("checkpoints/1ccc.tar.gz")
+	require.True(t, errors.IsArchived(err))
+	require.Contains(t, err.Error(), "usually takes 3-5 hours")
+	require.True(t, repo.restoreRequested)
+
+	// Waiting polls until the restore has finished
+	restorePollInterval = time.Millisecond
+	defer func() { restorePollInterval = time.Minute }()
+	proj.SetWaitForRestore(true)
+	require.NoError(t, proj.ensureRestored("checkpoints/1ccc.tar.gz"))
+	require.Equal(t, 0, repo.restoreAfter)
+}
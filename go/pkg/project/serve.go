@@ -0,0 +1,91 @@
+package project
+
+import (
+	"fmt"
+
+	"github.com/replicate/replicate/go/pkg/config"
+)
+
+// With serve in replicate.yaml, each checkpoint records the container that
+// serves its model, so `replicate serve` can check out the files the model
+// needs and run it, however long ago the checkpoint was saved and whatever
+// replicate.yaml says now.
+
+// ServeWorkingDir is where the files of a checkpoint are mounted in the
+// container that serves it, which is also its working directory
+const ServeWorkingDir = "/replicate"
+
+// ServeSpec is the container that serves the model in a checkpoint
+type ServeSpec struct {
+	Image      string   `json:"image"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Port       int      `json:"port,omitempty"`
+	Files      []string `json:"files,omitempty"`
+}
+
+// SetServe sets the container that is recorded with new checkpoints. If
+// serve is nil, none is.
+func (p *Project) SetServe(serve *config.Serve) {
+	p.serve = serve
+}
+
+// serveSpec returns the container to record with a new checkpoint, or nil if
+// there isn't one
+func (p *Project) serveSpec() *ServeSpec {
+	if p.serve == nil {
+		return nil
+	}
+	return &ServeSpec{
+		Image:      p.serve.Image,
+		Entrypoint: append([]string{}, p.serve.Entrypoint...),
+		Port:       p.serve.Port,
+		Files:      append([]string{}, p.serve.Files...),
+	}
+}
+
+// CheckoutServeFiles checks out the files of checkpoint that its model needs
+// to outputDir
+func (p *Project) CheckoutServeFiles(checkpoint *Checkpoint, experiment *Experiment, outputDir string) error {
+	if checkpoint.Serve == nil {
+		return fmt.Errorf("Checkpoint %s doesn't say how to serve it. Add 'serve' to replicate.yaml to record it with new checkpoints.", checkpoint.ShortID())
+	}
+	if len(checkpoint.Serve.Files) == 0 {
+		return p.CheckoutCheckpoint(checkpoint, experiment, outputDir, true)
+	}
+	for _, path := range checkpoint.Serve.Files {
+		if err := p.CheckoutFileOrDirectory(checkpoint, experiment, outputDir, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeArgs returns the arguments to docker that run the container that
+// serves checkpoint, with its files in dir. The port the model is served on
+// is published on hostPort, or the same port if it is 0.
+func ServeArgs(checkpoint *Checkpoint, experiment *Experiment, dir string, hostPort int) []string {
+	spec := checkpoint.Serve
+	args := []string{
+		"run", "--rm", "--init",
+		"--volume", dir + ":" + ServeWorkingDir,
+		"--workdir", ServeWorkingDir,
+		"--env", "REPLICATE_EXPERIMENT_ID=" + experiment.ID,
+		"--env", "REPLICATE_CHECKPOINT_ID=" + checkpoint.ID,
+	}
+	if spec.Port != 0 {
+		if hostPort == 0 {
+			hostPort = spec.Port
+		}
+		args = append(args, "--publish", fmt.Sprintf("%d:%d", hostPort, spec.Port))
+	}
+	// docker's --entrypoint is only the program, and the rest of the
+	// command goes after the image
+	if len(spec.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", spec.Entrypoint[0])
+	}
+	args = append(args, spec.Image)
+	if len(spec.Entrypoint) > 1 {
+		args = append(args, spec.Entrypoint[1:]...)
+	}
+	return args
+}
@@ -0,0 +1,93 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestServe(t *testing.T) {
+	projectDir, err := files.TempDir("test-serve")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-serve-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "models"), 0755))
+	for _, name := range []string{"train.py", "models/model.pt", "config.properties"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, name), []byte(name), 0644))
+	}
+
+	// Checkpoints without serve in replicate.yaml can't be served
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	require.Nil(t, chk1.Serve)
+
+	proj.SetServe(&config.Serve{
+		Image:      "pytorch/torchserve:latest",
+		Entrypoint: []string{"torchserve", "--start", "--model-store", "models"},
+		Port:       8080,
+		Files:      []string{"models", "config.properties"},
+	})
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, &ServeSpec{
+		Image:      "pytorch/torchserve:latest",
+		Entrypoint: []string{"torchserve", "--start", "--model-store", "models"},
+		Port:       8080,
+		Files:      []string{"models", "config.properties"},
+	}, chk2.Serve)
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	outputDir, err := files.TempDir("test-serve-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.Error(t, proj.CheckoutServeFiles(chk1, exp, outputDir))
+
+	// Only the files the model needs are checked out
+	require.NoError(t, proj.CheckoutServeFiles(chk2, exp, outputDir))
+	for name, expected := range map[string]bool{"models/model.pt": true, "config.properties": true, "train.py": false} {
+		exists, err := files.FileExists(path.Join(outputDir, name))
+		require.NoError(t, err)
+		require.Equal(t, expected, exists, name)
+	}
+
+	require.Equal(t, []string{
+		"run", "--rm", "--init",
+		"--volume", outputDir + ":/replicate",
+		"--workdir", "/replicate",
+		"--env", "REPLICATE_EXPERIMENT_ID=1eeeeeeeee",
+		"--env", "REPLICATE_CHECKPOINT_ID=" + chk2.ID,
+		"--publish", "5000:8080",
+		"--entrypoint", "torchserve",
+		"pytorch/torchserve:latest",
+		"--start", "--model-store", "models",
+	}, ServeArgs(chk2, exp, outputDir, 5000))
+
+	// Without an entrypoint or a port, the image is run as it is
+	chk2.Serve = &ServeSpec{Image: "my-model"}
+	args := ServeArgs(chk2, exp, outputDir, 5000)
+	require.Equal(t, "my-model", args[len(args)-1])
+	require.NotContains(t, args, "--publish")
+	require.NotContains(t, args, "--entrypoint")
+}
@@ -0,0 +1,65 @@
+package project
+
+import (
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// ApplyGlobalSettings sets the process-wide settings in replicate.yaml: the
+// timeouts of storage operations, how large objects are downloaded, where
+// they are downloaded to, and how and with which credentials repositories
+// are connected to. It must be called before the first repository connects.
+func ApplyGlobalSettings(conf *config.Config) {
+	if t := conf.Timeouts; t != nil {
+		repository.SetTimeouts(repository.Timeouts{
+			Connect: t.Connect(),
+			Request: t.Request(),
+			Overall: t.Overall(),
+		})
+	}
+	if d := conf.Downloads; d != nil {
+		repository.SetDownloads(repository.Downloads{
+			ChunkSize:   d.ChunkSize(),
+			Concurrency: d.Concurrency,
+		})
+	}
+	if sc := conf.Scratch; sc != nil {
+		files.SetScratch(sc.Dir, sc.MinFree())
+		repository.SetSpill(repository.Spill(sc.Spill))
+	}
+	if n := conf.Network; n != nil {
+		repository.SetNetwork(repository.Network{
+			MaxWorkers: n.MaxWorkers,
+			Proxy:      n.Proxy,
+			CABundle:   n.CABundle,
+		})
+	}
+	if c := conf.Credentials; c != nil {
+		repository.SetCredentials(repository.Credentials{
+			AWSProfile:         c.AWSProfile,
+			GCPCredentialsFile: c.GCPCredentialsFile,
+		})
+	}
+}
+
+// ApplySettings sets everything in replicate.yaml that the project uses
+// when it saves experiments and checkpoints
+func (p *Project) ApplySettings(conf *config.Config) {
+	p.SetExclude(conf.Exclude)
+	p.SetSpecialFiles(conf.SpecialFiles)
+	p.SetHooks(conf.Hooks)
+	p.SetSigning(conf.Signing)
+	p.SetAlerts(conf.Alerts)
+	p.SetDatasets(conf.Datasets)
+	p.SetEnvironment(conf.Environment)
+	p.SetSeeds(conf.Seeds)
+	p.SetLayout(conf.Layout, conf.Project)
+	p.SetQuota(conf.Quota)
+	p.SetHash(conf.Hash)
+	p.SetChunking(conf.Chunking)
+	p.SetLargeFiles(conf.LargeFiles)
+	p.SetTrees(conf.Trees)
+	p.SetServe(conf.Serve)
+	p.SetBatching(conf.Batching)
+}
@@ -0,0 +1,465 @@
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/hash"
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// Checkpoints can be signed, so people who use their files can check they
+// came from the experiment they say they did. When a checkpoint is saved,
+// the files in it are hashed, and once they have been uploaded, a manifest
+// of the checkpoint, its experiment and the hashes is signed with
+// `ssh-keygen -Y sign` or minisign. The manifest and signature are stored
+// in metadata/signatures/<checkpoint ID>/, as the tools write them, so they
+// can also be checked by hand.
+
+// SigningKeyEnvVar is the private key checkpoints are signed with, if
+// 'signing' in replicate.yaml doesn't have a 'key'. It lets CI systems sign
+// with a key from their secrets.
+const SigningKeyEnvVar = "REPLICATE_SIGNING_KEY"
+
+// signingNamespace is the namespace of ssh signatures, so signatures made for
+// other purposes with the same key can't be passed off as checkpoints'
+const signingNamespace = "replicate-checkpoint"
+
+// signatureManifestVersion is the version of SignedManifest
+const signatureManifestVersion = 1
+
+// SignedManifest is what is signed when a checkpoint is signed
+type SignedManifest struct {
+	Version    int            `json:"version"`
+	Experiment string         `json:"experiment"`
+	Checkpoint string         `json:"checkpoint"`
+	Created    time.Time      `json:"created"`
+	Step       int64          `json:"step"`
+	Metrics    param.ValueMap `json:"metrics"`
+	Command    string         `json:"command"`
+	Params     param.ValueMap `json:"params"`
+	User       string         `json:"user"`
+	Host       string         `json:"host"`
+	// Signer is the identity in replicate.yaml of who signed the manifest
+	Signer string `json:"signer"`
+	// Files are the SHA-256 hashes of the files in the checkpoint, by
+	// path
+	Files map[string]string `json:"files"`
+}
+
+func signatureDir(checkpointID string) string {
+	return path.Join("metadata/signatures", checkpointID)
+}
+
+func signatureManifestPath(checkpointID string) string {
+	return path.Join(signatureDir(checkpointID), "manifest.json")
+}
+
+// signatureExtensions are the extensions each tool gives signatures
+var signatureExtensions = map[string]string{
+	config.SigningSSH:      ".sig",
+	config.SigningMinisign: ".minisig",
+}
+
+// SetSigning sets how checkpoints are signed and verified. If it is nil,
+// they aren't signed.
+func (p *Project) SetSigning(signing *config.Signing) {
+	p.signing = signing
+}
+
+// signingKey returns the private key checkpoints are signed with, or "" if
+// they aren't signed
+func (p *Project) signingKey() string {
+	if p.signing == nil {
+		return ""
+	}
+	key := p.signing.Key
+	if key == "" {
+		key = os.Getenv(SigningKeyEnvVar)
+	}
+	if key == "" {
+		return ""
+	}
+	return p.signingPath(key)
+}
+
+// signingPath returns a path in the signing config, relative to the project
+// directory
+func (p *Project) signingPath(filePath string) string {
+	if expanded, err := homedir.Expand(filePath); err == nil {
+		filePath = expanded
+	}
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(p.directory, filePath)
+	}
+	return filePath
+}
+
+// hashCheckpointFiles records the hashes of the files of chk in tempDir, a
+// copy of them, to sign once they have been uploaded. It must be called
+// before any of the files are moved out of tempDir.
+func (p *Project) hashCheckpointFiles(chk *Checkpoint, tempDir string) error {
+	if p.signingKey() == "" {
+		return nil
+	}
+	hashes, err := hashDirectory(tempDir)
+	if err != nil {
+		return err
+	}
+	p.signingHashesMu.Lock()
+	defer p.signingHashesMu.Unlock()
+	if p.signingHashes == nil {
+		p.signingHashes = map[string]map[string]string{}
+	}
+	p.signingHashes[chk.ID] = hashes
+	return nil
+}
+
+// SignCheckpoint signs the manifest of chk, a checkpoint of exp, if signing
+// is set up in replicate.yaml. It should be called after the checkpoint's
+// files have been saved.
+func (p *Project) SignCheckpoint(exp *Experiment, chk *Checkpoint) error {
+	key := p.signingKey()
+	if key == "" {
+		return nil
+	}
+	p.signingHashesMu.Lock()
+	hashes, ok := p.signingHashes[chk.ID]
+	delete(p.signingHashes, chk.ID)
+	p.signingHashesMu.Unlock()
+	if !ok {
+		if chk.Path != "" {
+			return fmt.Errorf("Failed to sign checkpoint %s: its files weren't hashed when it was saved", chk.ShortID())
+		}
+		hashes = map[string]string{}
+	}
+
+	manifest := newSignedManifest(exp, chk, hashes)
+	manifest.Signer = p.signing.Identity
+	data, err := json.MarshalIndent(manifest, "", " ")
+	if err != nil {
+		return err
+	}
+	signature, err := p.runSigningTool(key, data)
+	if err != nil {
+		return fmt.Errorf("Failed to sign checkpoint %s: %w", chk.ShortID(), err)
+	}
+	// The signature is written first, so a manifest is never without one
+	manifestPath := signatureManifestPath(chk.ID)
+	if err := p.repository.Put(manifestPath+signatureExtensions[p.signing.SigningTool()], signature); err != nil {
+		return err
+	}
+	if err := p.repository.Put(manifestPath, data); err != nil {
+		return err
+	}
+	console.Debug("Signed checkpoint %s as %s", chk.ShortID(), manifest.Signer)
+	return nil
+}
+
+func newSignedManifest(exp *Experiment, chk *Checkpoint, hashes map[string]string) *SignedManifest {
+	return &SignedManifest{
+		Version:    signatureManifestVersion,
+		Experiment: exp.ID,
+		Checkpoint: chk.ID,
+		Created:    chk.Created,
+		Step:       chk.Step,
+		Metrics:    chk.Metrics,
+		Command:    exp.Command,
+		Params:     exp.Params,
+		User:       exp.User,
+		Host:       exp.Host,
+		Files:      hashes,
+	}
+}
+
+// runSigningTool signs data with key, and returns the signature
+func (p *Project) runSigningTool(key string, data []byte) ([]byte, error) {
+	dir, err := files.TempDir("sign")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := ioutil.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	var cmd *exec.Cmd
+	tool := p.signing.SigningTool()
+	signaturePath := manifestPath + signatureExtensions[tool]
+	switch tool {
+	case config.SigningSSH:
+		cmd = exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", signingNamespace, manifestPath)
+	case config.SigningMinisign:
+		cmd = exec.Command("minisign", "-S", "-s", key, "-m", manifestPath, "-x", signaturePath, "-t", "replicate checkpoint signed by "+p.signing.Identity)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w\n%s", cmd.Path, err, strings.TrimSpace(string(out)))
+	}
+	return ioutil.ReadFile(signaturePath)
+}
+
+// VerifySignatures checks the signatures of checkpoints against the allowed
+// signers or public key in replicate.yaml, and checks that each checkpoint's
+// metadata and files match its signed manifest. If ids is empty, all of the
+// checkpoints in the project are checked, otherwise the checkpoints or
+// experiments with those IDs are. The files of each checkpoint are
+// downloaded to check them. Checkpoints that aren't signed are problems too.
+func (p *Project) VerifySignatures(ids []string) ([]*Problem, error) {
+	if p.signing == nil || (p.signing.AllowedSigners == "" && p.signing.PublicKey == "") {
+		return nil, fmt.Errorf("To verify signatures, 'signing' in replicate.yaml must have the 'allowed_signers' of ssh signatures, or the 'public_key' of minisign signatures")
+	}
+
+	type target struct {
+		exp *Experiment
+		chk *Checkpoint
+	}
+	targets := []target{}
+	if len(ids) == 0 {
+		experiments, err := p.Experiments()
+		if err != nil {
+			return nil, err
+		}
+		for _, exp := range experiments {
+			for _, chk := range exp.Checkpoints {
+				targets = append(targets, target{exp, chk})
+			}
+		}
+	}
+	for _, id := range ids {
+		result, err := p.CheckpointOrExperimentFromPrefix(id)
+		if err != nil {
+			return nil, err
+		}
+		if result.Checkpoint != nil {
+			targets = append(targets, target{result.Experiment, result.Checkpoint})
+			continue
+		}
+		for _, chk := range result.Experiment.Checkpoints {
+			targets = append(targets, target{result.Experiment, chk})
+		}
+	}
+
+	problems := []*Problem{}
+	for _, t := range targets {
+		if problem := p.verifySignature(t.exp, t.chk); problem != nil {
+			problems = append(problems, problem)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+	return problems, nil
+}
+
+// verifySignature checks the signature of chk, a checkpoint of exp
+func (p *Project) verifySignature(exp *Experiment, chk *Checkpoint) *Problem {
+	manifestPath := signatureManifestPath(chk.ID)
+	description := fmt.Sprintf("checkpoint %s of experiment %s", chk.ShortID(), exp.ShortID())
+	console.Debug("Verifying the signature of %s", description)
+	data, err := p.repository.Get(manifestPath)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return &Problem{Kind: ProblemUnsigned, Path: manifestPath, Description: fmt.Sprintf("%s is not signed", strings.Title(description))}
+		}
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("Failed to read the signed manifest of %s: %s", description, err)}
+	}
+	manifest := new(SignedManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("Failed to parse the signed manifest of %s: %s", description, err)}
+	}
+
+	if err := p.checkSignature(manifestPath, data, manifest.Signer); err != nil {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("The signature of %s is not valid: %s", description, err)}
+	}
+
+	// The signature is good, so check the manifest is of this checkpoint
+	// and its files haven't changed since it was signed
+	expected := newSignedManifest(exp, chk, manifest.Files)
+	if field := differentManifestField(manifest, expected); field != "" {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("The %s of %s does not match its signed manifest", field, description)}
+	}
+	if chk.Path == "" {
+		if len(manifest.Files) > 0 {
+			return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("The signed manifest of %s has files, but the checkpoint does not", description)}
+		}
+		return nil
+	}
+	dir, err := files.TempDir("verify-signature")
+	if err != nil {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: err.Error()}
+	}
+	defer os.RemoveAll(dir)
+	if err := p.checkoutCheckpointFiles(chk, dir); err != nil {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("Failed to download the files of %s to check them: %s", description, err)}
+	}
+	hashes, err := hashDirectory(dir)
+	if err != nil {
+		return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("Failed to hash the files of %s: %s", description, err)}
+	}
+	for _, filePath := range unionKeys(hashes, manifest.Files) {
+		switch {
+		case manifest.Files[filePath] == "":
+			return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("%s in %s is not in its signed manifest", filePath, description)}
+		case hashes[filePath] == "":
+			return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("%s in the signed manifest of %s is missing", filePath, description)}
+		case hashes[filePath] != manifest.Files[filePath]:
+			return &Problem{Kind: ProblemBadSignature, Path: manifestPath, Description: fmt.Sprintf("%s in %s has changed since it was signed", filePath, description)}
+		}
+	}
+	return nil
+}
+
+// checkSignature checks the signature of data, the manifest at manifestPath
+// in the repository, was made by signer
+func (p *Project) checkSignature(manifestPath string, data []byte, signer string) error {
+	tool := ""
+	var signature []byte
+	for _, t := range []string{config.SigningSSH, config.SigningMinisign} {
+		sig, err := p.repository.Get(manifestPath + signatureExtensions[t])
+		if err == nil {
+			tool = t
+			signature = sig
+			break
+		}
+		if !errors.IsDoesNotExist(err) {
+			return err
+		}
+	}
+	if tool == "" {
+		return fmt.Errorf("it has no signature")
+	}
+
+	dir, err := files.TempDir("verify-signature")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	localPath := filepath.Join(dir, "manifest.json")
+	signaturePath := localPath + signatureExtensions[tool]
+	if err := ioutil.WriteFile(localPath, data, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(signaturePath, signature, 0644); err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+	switch tool {
+	case config.SigningSSH:
+		if p.signing.AllowedSigners == "" {
+			return fmt.Errorf("it is signed with ssh, but 'signing' in replicate.yaml doesn't have 'allowed_signers'")
+		}
+		cmd = exec.Command("ssh-keygen", "-Y", "verify", "-f", p.signingPath(p.signing.AllowedSigners), "-I", signer, "-n", signingNamespace, "-s", signaturePath)
+		cmd.Stdin = bytes.NewReader(data)
+	case config.SigningMinisign:
+		if p.signing.PublicKey == "" {
+			return fmt.Errorf("it is signed with minisign, but 'signing' in replicate.yaml doesn't have 'public_key'")
+		}
+		cmd = exec.Command("minisign", "-V", "-q", "-p", p.signingPath(p.signing.PublicKey), "-m", localPath, "-x", signaturePath)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+		}
+		return err
+	}
+	return nil
+}
+
+// differentManifestField returns the name of the first field of the signed
+// manifest that doesn't match the metadata it should have, or "" if they all
+// match. Files and the signer aren't compared.
+func differentManifestField(signed, expected *SignedManifest) string {
+	switch {
+	case signed.Experiment != expected.Experiment:
+		return "experiment"
+	case !signed.Created.Equal(expected.Created):
+		return "creation time"
+	case signed.Step != expected.Step:
+		return "step"
+	case signed.Command != expected.Command:
+		return "command"
+	case signed.User != expected.User || signed.Host != expected.Host:
+		return "user"
+	case !sameJSON(signed.Metrics, expected.Metrics):
+		return "metrics"
+	case !sameJSON(signed.Params, expected.Params):
+		return "params"
+	}
+	return ""
+}
+
+// sameJSON returns whether a and b are the same when they are serialized, so
+// values that were read from JSON compare equal to the values they were
+// written from
+func sameJSON(a, b param.ValueMap) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return false
+	}
+	var aValue, bValue interface{}
+	if json.Unmarshal(aData, &aValue) != nil || json.Unmarshal(bData, &bValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(aValue, bValue)
+}
+
+// hashDirectory returns the SHA-256 hashes of the regular files in dir, by
+// their slash-separated paths relative to dir
+func hashDirectory(dir string) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.Walk(dir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, currentPath)
+		if err != nil {
+			return err
+		}
+		ptr, err := hashFile(currentPath, hash.SHA256)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(relPath)] = ptr.hash
+		return nil
+	})
+	return hashes, err
+}
+
+// unionKeys returns the keys that are in either a or b, sorted
+func unionKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
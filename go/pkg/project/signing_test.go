@@ -0,0 +1,98 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestSignCheckpoint(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen isn't installed")
+	}
+
+	projectDir, err := files.TempDir("test-sign")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-sign-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	keyPath := path.Join(projectDir, "signing-key")
+	out, err := exec.Command("ssh-keygen", "-t", "ed25519", "-N", "", "-q", "-f", keyPath).CombinedOutput()
+	require.NoError(t, err, string(out))
+	publicKey, err := ioutil.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "allowed_signers"), append([]byte("ci@example.com "), publicKey...), 0644))
+
+	proj := NewProject(repo, projectDir)
+	proj.SetExclude([]string{"signing-key*", "allowed_signers"})
+	proj.SetSigning(&config.Signing{Key: "signing-key", Identity: "ci@example.com", AllowedSigners: "allowed_signers"})
+
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "model"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "model", "weights.pt"), []byte("weights"), 0644))
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 1, Metrics: param.ValueMap{"loss": param.Float(0.5)}}, false, nil, true)
+	require.NoError(t, err)
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model", Step: 2, Metrics: param.ValueMap{"loss": param.Float(0.4)}}, false, nil, true)
+	require.NoError(t, err)
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Command:     "train.py",
+		Params:      param.ValueMap{"learning_rate": param.Float(0.01)},
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	require.NoError(t, proj.SignCheckpoint(exp, chk1))
+
+	// A consumer that only has the allowed signers, which reads the
+	// metadata afresh each time
+	verify := func(ids []string) ([]*Problem, error) {
+		verifier := NewProject(repo, projectDir)
+		verifier.SetSigning(&config.Signing{Identity: "ci@example.com", AllowedSigners: "allowed_signers"})
+		return verifier.VerifySignatures(ids)
+	}
+	problems, err := verify([]string{chk1.ID})
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	problems, err = verify(nil)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Equal(t, ProblemUnsigned, problems[0].Kind)
+	require.Equal(t, "metadata/signatures/"+chk2.ID+"/manifest.json", problems[0].Path)
+
+	// Changing the metrics breaks the signature
+	chk1.Metrics["loss"] = param.Float(0.1)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	problems, err = verify([]string{chk1.ID})
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Equal(t, ProblemBadSignature, problems[0].Kind)
+	require.Contains(t, problems[0].Description, "metrics")
+
+	// So does a signer that isn't allowed
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "allowed_signers"), append([]byte("someone@example.com "), publicKey...), 0644))
+	chk1.Metrics["loss"] = param.Float(0.5)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	problems, err = verify([]string{chk1.ID})
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Contains(t, problems[0].Description, "not valid")
+}
@@ -0,0 +1,426 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// A snapshot is a copy of the metadata of a repository at a point in time,
+// so the whole repository can be rolled back after a bad bulk delete or a
+// botched migration. Not every backend has object versions, so the metadata
+// is copied into snapshots/<snapshot ID>/metadata.tar.gz, and
+// snapshots/<snapshot ID>/snapshot.json lists it along with the other
+// objects that were in the repository.
+//
+// The files of experiments and checkpoints aren't copied, because they are
+// big and never change once they are saved. If they have been deleted since
+// a snapshot was made, restoring it can only get them back if they are still
+// in the trash.
+
+// SnapshotsDir is the directory in the repository that snapshots are in
+const SnapshotsDir = "snapshots"
+
+const snapshotFilename = "snapshot.json"
+
+// snapshotWorkers is the number of metadata objects that are copied at once
+const snapshotWorkers = 16
+
+// snapshotMetadataFolders are the folders of metadata that snapshots copy.
+// Model indexes are copied too, but the models they index aren't.
+var snapshotMetadataFolders = []string{"metadata/experiments", experimentEventsFolder, "metrics", "chunks/manifests", ModelsDir}
+
+// snapshotObjectFolders are the folders of files that snapshots list, but
+// don't copy
+var snapshotObjectFolders = []string{"experiments", "checkpoints", "chunks", "blobs", ModelsDir}
+
+// Snapshot is the metadata of a repository at a point in time
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	User    string    `json:"user"`
+	Message string    `json:"message,omitempty"`
+
+	// Experiments is the number of experiments in the repository
+	Experiments int `json:"experiments"`
+
+	// Metadata are the paths of the metadata objects that were copied
+	Metadata []string `json:"metadata"`
+
+	// Objects are the other objects that were in the repository
+	Objects []*SnapshotObject `json:"objects"`
+}
+
+// SnapshotObject is an object that was in the repository when a snapshot was
+// made
+type SnapshotObject struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Size returns the total size of the objects that were in the repository
+func (s *Snapshot) Size() int64 {
+	var size int64
+	for _, object := range s.Objects {
+		size += object.Size
+	}
+	return size
+}
+
+func (s *Snapshot) dir() string {
+	return SnapshotsDir + "/" + s.ID
+}
+
+func (s *Snapshot) metadataPath() string {
+	return s.dir() + "/" + snapshotFilename
+}
+
+func (s *Snapshot) metadataTarPath() string {
+	return s.dir() + "/metadata.tar.gz"
+}
+
+// SnapshotRestore is what restoring a snapshot changed
+type SnapshotRestore struct {
+	// Backup is a snapshot of the repository before it was restored, so
+	// restoring can be undone
+	Backup *Snapshot
+
+	// Restored are the metadata objects that were put back, and Removed are
+	// those that were deleted because they weren't in the snapshot
+	Restored []string
+	Removed  []string
+
+	// Recovered are the objects that were moved back out of the trash
+	Recovered []string
+
+	// Missing are the objects that were in the snapshot, but have been
+	// deleted for good since
+	Missing []string
+}
+
+// isSnapshotMetadata returns whether objectPath is metadata that snapshots
+// copy
+func isSnapshotMetadata(objectPath string) bool {
+	if strings.HasPrefix(objectPath, ModelsDir+"/") {
+		return path.Base(objectPath) == "versions.json"
+	}
+	for _, folder := range snapshotMetadataFolders {
+		if strings.HasPrefix(objectPath, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listSnapshotObjects returns the metadata objects and the other objects in
+// the repository, each sorted by path. The repository is always listed,
+// rather than read from an inventory, so new objects aren't missed.
+func (p *Project) listSnapshotObjects() (metadata []string, objects []*SnapshotObject, err error) {
+	results, err := repository.ListRecursiveAll(context.Background(), p.repository, snapshotMetadataFolders...)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata = []string{}
+	for _, result := range results {
+		if isSnapshotMetadata(result.Path) {
+			metadata = append(metadata, result.Path)
+		}
+	}
+	sort.Strings(metadata)
+
+	results, err = repository.ListRecursiveAll(context.Background(), p.repository, snapshotObjectFolders...)
+	if err != nil {
+		return nil, nil, err
+	}
+	objects = []*SnapshotObject{}
+	seen := map[string]bool{}
+	for _, result := range results {
+		// chunks/ has the chunk manifests in it, and models/ has the model
+		// indexes, which are metadata
+		if isSnapshotMetadata(result.Path) {
+			continue
+		}
+		if !seen[result.Path] {
+			seen[result.Path] = true
+			objects = append(objects, &SnapshotObject{Path: result.Path, Size: result.Size})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	return metadata, objects, nil
+}
+
+// CreateSnapshot copies the metadata in the repository into a new snapshot.
+// message describes it, and can be empty.
+func (p *Project) CreateSnapshot(message string) (*Snapshot, error) {
+	now := time.Now().UTC()
+	snapshot := &Snapshot{
+		ID:      now.Format("20060102T150405Z") + "-" + generateRandomID()[:4],
+		Created: now,
+		Message: message,
+	}
+	if currentUser, err := user.Current(); err == nil {
+		snapshot.User = currentUser.Username
+	}
+
+	metadata, objects, err := p.listSnapshotObjects()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Metadata = metadata
+	snapshot.Objects = objects
+	for _, metadataPath := range metadata {
+		if strings.HasPrefix(metadataPath, "metadata/experiments/") {
+			snapshot.Experiments++
+		}
+	}
+
+	tempDir, err := files.TempDir("snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	queue := concurrency.NewWorkerQueue(context.Background(), snapshotWorkers)
+	for _, metadataPath := range metadata {
+		metadataPath := metadataPath
+		if err := queue.Go(func() error {
+			data, err := p.repository.Get(metadataPath)
+			if err != nil {
+				return fmt.Errorf("Failed to read %s: %w", metadataPath, err)
+			}
+			localPath := filepath.Join(tempDir, filepath.FromSlash(metadataPath))
+			if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(localPath, data, 0644)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return nil, err
+	}
+	if err := p.repository.PutPathTar(tempDir, snapshot.metadataTarPath(), ""); err != nil {
+		return nil, err
+	}
+
+	// The snapshot's metadata is saved last, so it isn't listed until all of
+	// it is saved
+	data, err := json.MarshalIndent(snapshot, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.repository.Put(snapshot.metadataPath(), data); err != nil {
+		return nil, err
+	}
+	p.audit(&AuditRecord{Operation: AuditSnapshot, Paths: []string{snapshot.dir()}})
+	return snapshot, nil
+}
+
+// Snapshots returns the snapshots in the repository, oldest first
+func (p *Project) Snapshots() ([]*Snapshot, error) {
+	results := make(chan repository.ListResult)
+	go p.repository.MatchFilenamesRecursive(context.Background(), results, SnapshotsDir, snapshotFilename)
+	snapshots := []*Snapshot{}
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		snapshot := &Snapshot{}
+		if err := loadFromPath(p.repository, result.Path, snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// SnapshotFromPrefix returns the snapshot whose ID starts with prefix
+func (p *Project) SnapshotFromPrefix(prefix string) (*Snapshot, error) {
+	snapshots, err := p.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*Snapshot{}
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.ID, prefix) {
+			matches = append(matches, snapshot)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.DoesNotExist("Snapshot not found: " + prefix)
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("Prefix is ambiguous: %s (%d matching snapshots)", prefix, len(matches))
+	}
+	return matches[0], nil
+}
+
+// RestoreSnapshot rolls the metadata in the repository back to snapshot.
+// First, the repository is snapshotted, so this can be undone. Then, objects
+// in the snapshot that are in the trash are moved back out of it, the
+// metadata in the snapshot is put back, and metadata that has been created
+// since is deleted.
+//
+// Experiments and checkpoints created since the snapshot are removed from
+// the metadata, but their files are left, because another snapshot might
+// need them.
+func (p *Project) RestoreSnapshot(snapshot *Snapshot) (*SnapshotRestore, error) {
+	lock, err := p.lockForMaintenance("restoring a snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLock(lock)
+
+	restore := &SnapshotRestore{Restored: []string{}, Removed: []string{}, Recovered: []string{}, Missing: []string{}}
+	restore.Backup, err = p.CreateSnapshot("Before restoring snapshot " + snapshot.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to snapshot the repository before restoring: %w", err)
+	}
+	currentMetadata := map[string]bool{}
+	for _, metadataPath := range restore.Backup.Metadata {
+		currentMetadata[metadataPath] = true
+	}
+	current := map[string]bool{}
+	for _, object := range restore.Backup.Objects {
+		current[object.Path] = true
+	}
+
+	// Files are put back before the metadata that refers to them, so
+	// experiments don't appear without their files
+	recovered, err := p.recoverSnapshotObjects(snapshot, current)
+	if err != nil {
+		return nil, err
+	}
+	restore.Recovered = recovered
+	for _, objectPath := range recovered {
+		current[objectPath] = true
+	}
+	for _, object := range snapshot.Objects {
+		if !current[object.Path] {
+			restore.Missing = append(restore.Missing, object.Path)
+		}
+	}
+
+	tempDir, err := files.TempDir("snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := p.repository.GetPathTar(snapshot.metadataTarPath(), tempDir); err != nil {
+		return nil, fmt.Errorf("Failed to read snapshot %s: %w", snapshot.ID, err)
+	}
+	var mu sync.Mutex
+	queue := concurrency.NewWorkerQueue(context.Background(), snapshotWorkers)
+	for _, metadataPath := range snapshot.Metadata {
+		metadataPath := metadataPath
+		if err := queue.Go(func() error {
+			data, err := ioutil.ReadFile(filepath.Join(tempDir, filepath.FromSlash(metadataPath)))
+			if err != nil {
+				return fmt.Errorf("Failed to read %s from snapshot %s: %w", metadataPath, snapshot.ID, err)
+			}
+			if err := p.repository.Put(metadataPath, data); err != nil {
+				return err
+			}
+			mu.Lock()
+			restore.Restored = append(restore.Restored, metadataPath)
+			mu.Unlock()
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Strings(restore.Restored)
+
+	inSnapshot := map[string]bool{}
+	for _, metadataPath := range snapshot.Metadata {
+		inSnapshot[metadataPath] = true
+	}
+	for _, metadataPath := range restore.Backup.Metadata {
+		if inSnapshot[metadataPath] {
+			continue
+		}
+		if err := p.repository.Delete(metadataPath); err != nil {
+			return nil, err
+		}
+		restore.Removed = append(restore.Removed, metadataPath)
+	}
+
+	p.invalidateCache()
+	p.resetKnownChunks()
+	p.resetCheckpointFiles()
+	p.audit(&AuditRecord{Operation: AuditRestoreSnapshot, Paths: []string{snapshot.dir(), restore.Backup.dir()}})
+	return restore, nil
+}
+
+// recoverSnapshotObjects moves the objects in snapshot that aren't in current
+// out of the trash, and returns their paths. Only trash entries that were
+// wholly in the snapshot are recovered, and they are removed from the trash,
+// because what they removed is back.
+func (p *Project) recoverSnapshotObjects(snapshot *Snapshot, current map[string]bool) ([]string, error) {
+	inSnapshot := map[string]bool{}
+	for _, metadataPath := range snapshot.Metadata {
+		inSnapshot[metadataPath] = true
+	}
+	for _, object := range snapshot.Objects {
+		inSnapshot[object.Path] = true
+	}
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+	recovered := []string{}
+	for _, entry := range entries {
+		wholly := true
+		for _, objectPath := range entry.Paths {
+			// Tarballs saved before they had indexes are in the trash
+			// without them
+			if !inSnapshot[objectPath] && !inSnapshot[strings.TrimSuffix(objectPath, repository.TarIndexPath(""))] {
+				wholly = false
+				break
+			}
+		}
+		if !wholly {
+			continue
+		}
+		for _, objectPath := range entry.Paths {
+			// Metadata is put back from the snapshot
+			if current[objectPath] || !inSnapshot[objectPath] || isSnapshotMetadata(objectPath) {
+				continue
+			}
+			if err := p.repository.Move(entry.dir()+"/"+objectPath, objectPath); err != nil {
+				if errors.IsDoesNotExist(err) {
+					continue
+				}
+				return nil, fmt.Errorf("Failed to restore %s from the trash: %w", objectPath, err)
+			}
+			recovered = append(recovered, objectPath)
+		}
+		if err := p.repository.Delete(entry.dir()); err != nil {
+			console.Warn("Failed to delete %s from the trash: %s", entry.dir(), err)
+		}
+	}
+	return recovered, nil
+}
@@ -0,0 +1,83 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestSnapshots(t *testing.T) {
+	dir, err := files.TempDir("test-snapshots")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repoDir := path.Join(dir, ".replicate")
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	exp1 := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     now,
+		Config:      &config.Config{},
+		Path:        ".",
+		Checkpoints: []*Checkpoint{{ID: "1ccccccccc", Created: now, Path: "."}},
+	}
+	require.NoError(t, exp1.Save(repo))
+	for _, p := range []string{exp1.StorageTarPath(), "checkpoints/1ccccccccc.tar.gz"} {
+		require.NoError(t, repo.Put(p, []byte(p)))
+	}
+	requireExists := func(p string, expected bool) {
+		exists, err := files.FileExists(path.Join(repoDir, p))
+		require.NoError(t, err)
+		require.Equal(t, expected, exists, p)
+	}
+
+	proj := NewProject(repo, dir)
+	snapshot, err := proj.CreateSnapshot("before")
+	require.NoError(t, err)
+	require.Equal(t, 1, snapshot.Experiments)
+	require.Equal(t, []string{exp1.MetadataPath()}, snapshot.Metadata)
+	require.Len(t, snapshot.Objects, 2)
+
+	// A bad bulk delete, and an experiment created since
+	exp2 := &Experiment{ID: "2eeeeeeeee", Created: now.Add(time.Minute), Config: &config.Config{}, Path: "."}
+	require.NoError(t, exp2.Save(repo))
+	_, err = proj.TrashExperiment(exp1)
+	require.NoError(t, err)
+	requireExists(exp1.MetadataPath(), false)
+	requireExists("checkpoints/1ccccccccc.tar.gz", false)
+
+	loaded, err := proj.SnapshotFromPrefix(snapshot.ID)
+	require.NoError(t, err)
+	require.Equal(t, "before", loaded.Message)
+
+	restore, err := proj.RestoreSnapshot(loaded)
+	require.NoError(t, err)
+	require.Equal(t, []string{exp1.MetadataPath()}, restore.Restored)
+	require.Equal(t, []string{exp2.MetadataPath()}, restore.Removed)
+	require.ElementsMatch(t, []string{exp1.StorageTarPath(), "checkpoints/1ccccccccc.tar.gz"}, restore.Recovered)
+	require.Empty(t, restore.Missing)
+	requireExists("checkpoints/1ccccccccc.tar.gz", true)
+
+	experiments, err := proj.Experiments()
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	require.Equal(t, exp1.ID, experiments[0].ID)
+	entries, err := proj.TrashEntries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Restoring can be undone
+	snapshots, err := proj.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, restore.Backup.ID, snapshots[1].ID)
+	require.Equal(t, 1, snapshots[1].Experiments)
+}
@@ -0,0 +1,106 @@
+package project
+
+import (
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// ensureSpec writes the repository spec if the repository is new, or
+// returns an error if the repository was written by a newer version
+func (p *Project) ensureSpec() error {
+	p.specMu.Lock()
+	defer p.specMu.Unlock()
+	spec, err := p.loadSpec()
+	if err != nil {
+		// Experiments are saved to the spool while the repository can't be
+		// reached, so the spec is checked the next time it can
+		if repository.IsUnreachable(err) {
+			console.Debug("Skipping repository version check: %s", err)
+			return nil
+		}
+		return err
+	}
+	if spec == nil {
+		spec = repository.NewSpec(p.hashAlgorithm)
+		if err := repository.WriteSpec(p.repository, spec); err != nil {
+			return err
+		}
+	}
+	p.spec = spec
+	return nil
+}
+
+// checkSpec returns an error if the repository was written by a newer
+// version, which this version might misread. The spec is only read once.
+func (p *Project) checkSpec() error {
+	p.specMu.Lock()
+	defer p.specMu.Unlock()
+	if p.spec != nil {
+		return nil
+	}
+	spec, err := p.loadSpec()
+	if err != nil {
+		if repository.IsUnreachable(err) {
+			console.Debug("Skipping repository version check: %s", err)
+			return nil
+		}
+		return err
+	}
+	p.spec = spec
+	return nil
+}
+
+// requireVersion raises the version in the repository's spec to version, if
+// it is older, so versions of Replicate that would misread what is about to
+// be written refuse to use the repository. If the repository can't be
+// reached, it is tried again the next time something is written.
+func (p *Project) requireVersion(version int) error {
+	p.specMu.Lock()
+	defer p.specMu.Unlock()
+	if p.spec != nil && p.spec.Version >= version {
+		return nil
+	}
+	spec, err := p.loadSpec()
+	if err != nil {
+		if repository.IsUnreachable(err) {
+			console.Debug("Skipping repository version upgrade: %s", err)
+			return nil
+		}
+		return err
+	}
+	if spec == nil {
+		spec = repository.NewSpec(p.hashAlgorithm)
+	}
+	if spec.Version < version {
+		spec.Version = version
+		if err := repository.WriteSpec(p.repository, spec); err != nil {
+			return err
+		}
+	}
+	p.spec = spec
+	return nil
+}
+
+// requirePathVersion raises the version of the repository if path has to be
+// escaped to be stored in it
+func (p *Project) requirePathVersion(path string) error {
+	if !repository.NeedsEscaping(path) {
+		return nil
+	}
+	return p.requireVersion(repository.EscapedPathsVersion)
+}
+
+// loadSpec reads the repository's spec, which is nil if it doesn't have one
+// yet, and returns an error if it was written by a newer version.
+// p.specMu must be held.
+func (p *Project) loadSpec() (*repository.Spec, error) {
+	spec, err := repository.LoadSpec(p.repository)
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil && spec.Version > repository.Version {
+		return nil, errors.IncompatibleRepositoryVersion(p.repository.RootURL())
+	}
+	return spec, nil
+}
@@ -0,0 +1,67 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestSpecVersion(t *testing.T) {
+	projectDir, err := files.TempDir("test-spec-version")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	// A new repository is the version older versions of Replicate wrote
+	exp, err := proj.CreateExperiment(CreateExperimentArgs{}, false, nil, true)
+	require.NoError(t, err)
+	spec, err := repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, &repository.Spec{Version: 1}, spec)
+
+	// Until a checkpoint is saved as an event
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Step: 1}, false, nil, true)
+	require.NoError(t, err)
+	exp.Checkpoints = append(exp.Checkpoints, chk)
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+	spec, err = repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, &repository.Spec{Version: repository.EventsVersion}, spec)
+
+	// Repositories written by newer versions can't be read
+	raw := fmt.Sprintf(`{"version":%d}`, repository.Version+1)
+	require.NoError(t, repo.Put(repository.SpecPath, []byte(raw)))
+	other := NewProject(repo, projectDir)
+	_, err = other.ExperimentByID(exp.ID)
+	require.Error(t, err)
+	require.Equal(t, errors.CodeIncompatibleRepositoryVersion, errors.Code(err))
+}
+
+func TestSpecVersionEscapedPaths(t *testing.T) {
+	projectDir, err := files.TempDir("test-spec-version-escaped")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repo, err := repository.NewDiskRepository(path.Join(projectDir, ".replicate"))
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+
+	require.NoError(t, proj.requirePathVersion("experiments/lr=0.01/abc123"))
+	spec, err := repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Nil(t, spec)
+
+	require.NoError(t, proj.requirePathVersion("experiments/100%/abc123"))
+	spec, err = repository.LoadSpec(repo)
+	require.NoError(t, err)
+	require.Equal(t, &repository.Spec{Version: repository.EscapedPathsVersion}, spec)
+}
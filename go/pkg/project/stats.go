@@ -0,0 +1,236 @@
+package project
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// Stats are figures about all the experiments in a project, week by week,
+// for looking back at how a team has been training
+type Stats struct {
+	Experiments int `json:"experiments"`
+	Checkpoints int `json:"checkpoints"`
+	// AverageDurationSeconds is the average time from an experiment
+	// starting to its latest checkpoint, for experiments that have stopped
+	// and have checkpoints
+	AverageDurationSeconds float64 `json:"average_duration_seconds"`
+	// StorageBytes is the size of the files of the experiments and their
+	// checkpoints. Chunks and large files can be shared by several
+	// checkpoints, so they aren't counted. It is 0 if storage wasn't
+	// measured.
+	StorageBytes int64 `json:"storage_bytes"`
+
+	// Weeks are the weeks from the first experiment to the last, including
+	// weeks without any
+	Weeks []*WeekStats `json:"weeks"`
+	// Users are the users who created experiments, the most active first
+	Users []*UserStats `json:"users"`
+	// Metrics are the names of the primary metrics of the experiments,
+	// sorted by name
+	Metrics []string `json:"metrics"`
+}
+
+// WeekStats are figures about the experiments created in a week
+type WeekStats struct {
+	// Start is midnight UTC on the Monday the week starts on
+	Start                  time.Time `json:"start"`
+	Experiments            int       `json:"experiments"`
+	Checkpoints            int       `json:"checkpoints"`
+	AverageDurationSeconds float64   `json:"average_duration_seconds"`
+	// StorageBytes is the size of the files of the week's experiments, and
+	// TotalStorageBytes is the size of those of all experiments up to the
+	// end of the week
+	StorageBytes      int64 `json:"storage_bytes"`
+	TotalStorageBytes int64 `json:"total_storage_bytes"`
+	// Metrics are the values of each primary metric in the best
+	// checkpoints of the week's experiments, by name
+	Metrics map[string]*MetricTrend `json:"metrics"`
+}
+
+// MetricTrend is a summary of the values of a primary metric in the best
+// checkpoints of a week's experiments
+type MetricTrend struct {
+	Goal        MetricGoal `json:"goal"`
+	Best        float64    `json:"best"`
+	Mean        float64    `json:"mean"`
+	Experiments int        `json:"experiments"`
+}
+
+// UserStats are figures about the experiments created by a user
+type UserStats struct {
+	User           string    `json:"user"`
+	Experiments    int       `json:"experiments"`
+	Checkpoints    int       `json:"checkpoints"`
+	StorageBytes   int64     `json:"storage_bytes"`
+	LastExperiment time.Time `json:"last_experiment"`
+}
+
+// statsFolders are the folders that the files of experiments and
+// checkpoints are in, in any layout
+var statsFolders = []string{"metrics", "experiments", "checkpoints"}
+
+// Stats returns figures about the experiments created since since, or all of
+// them if it is zero. If measureStorage is true, the repository is listed to
+// find how much storage they use.
+func (p *Project) Stats(since time.Time, measureStorage bool) (*Stats, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	if measureStorage {
+		results, err := p.listRecursiveAll(statsFolders...)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			sizes[result.Path] = result.Size
+		}
+	}
+
+	selected := []*Experiment{}
+	for _, exp := range experiments {
+		if !exp.Created.Before(since) {
+			selected = append(selected, exp)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Created.Before(selected[j].Created)
+	})
+
+	stats := &Stats{Weeks: []*WeekStats{}, Users: []*UserStats{}, Metrics: []string{}}
+	users := map[string]*UserStats{}
+	metrics := map[string]bool{}
+	var totalDuration, weekDuration time.Duration
+	var durations, weekDurations int
+	var week *WeekStats
+	for _, exp := range selected {
+		start := weekStart(exp.Created)
+		for week == nil || week.Start.Before(start) {
+			next := start
+			if week != nil {
+				week.AverageDurationSeconds = averageSeconds(weekDuration, weekDurations)
+				weekDuration, weekDurations = 0, 0
+				next = week.Start.AddDate(0, 0, 7)
+			}
+			week = &WeekStats{Start: next, TotalStorageBytes: stats.StorageBytes, Metrics: map[string]*MetricTrend{}}
+			stats.Weeks = append(stats.Weeks, week)
+		}
+
+		size := experimentSize(sizes, exp)
+		stats.Experiments++
+		stats.Checkpoints += len(exp.Checkpoints)
+		stats.StorageBytes += size
+		week.Experiments++
+		week.Checkpoints += len(exp.Checkpoints)
+		week.StorageBytes += size
+		week.TotalStorageBytes += size
+
+		user := users[exp.User]
+		if user == nil {
+			user = &UserStats{User: exp.User}
+			users[exp.User] = user
+			stats.Users = append(stats.Users, user)
+		}
+		user.Experiments++
+		user.Checkpoints += len(exp.Checkpoints)
+		user.StorageBytes += size
+		user.LastExperiment = exp.Created
+
+		if duration, ok := p.experimentDuration(exp); ok {
+			totalDuration += duration
+			durations++
+			weekDuration += duration
+			weekDurations++
+		}
+
+		if name, goal, value, ok := bestPrimaryMetric(exp); ok {
+			metrics[name] = true
+			trend := week.Metrics[name]
+			if trend == nil {
+				trend = &MetricTrend{Goal: goal, Best: value}
+				week.Metrics[name] = trend
+			}
+			if (goal == GoalMaximize && value > trend.Best) || (goal != GoalMaximize && value < trend.Best) {
+				trend.Best = value
+			}
+			trend.Experiments++
+			trend.Mean += (value - trend.Mean) / float64(trend.Experiments)
+		}
+	}
+	if week != nil {
+		week.AverageDurationSeconds = averageSeconds(weekDuration, weekDurations)
+	}
+	stats.AverageDurationSeconds = averageSeconds(totalDuration, durations)
+
+	sort.SliceStable(stats.Users, func(i, j int) bool {
+		if stats.Users[i].Experiments == stats.Users[j].Experiments {
+			return stats.Users[i].LastExperiment.After(stats.Users[j].LastExperiment)
+		}
+		return stats.Users[i].Experiments > stats.Users[j].Experiments
+	})
+	for name := range metrics {
+		stats.Metrics = append(stats.Metrics, name)
+	}
+	sort.Strings(stats.Metrics)
+	return stats, nil
+}
+
+// experimentDuration returns how long exp trained for, which is from when it
+// was created to its latest checkpoint. It returns false if exp is still
+// running or doesn't have any checkpoints.
+func (p *Project) experimentDuration(exp *Experiment) (time.Duration, bool) {
+	latest := exp.LatestCheckpoint()
+	if latest == nil {
+		return 0, false
+	}
+	if running, err := p.ExperimentIsRunning(exp.ID); err != nil || running {
+		return 0, false
+	}
+	return latest.Created.Sub(exp.Created), true
+}
+
+// bestPrimaryMetric returns the name, goal and value of the primary metric in
+// the best checkpoint of exp. It returns false if exp doesn't have a primary
+// metric, or its value isn't a number.
+func bestPrimaryMetric(exp *Experiment) (string, MetricGoal, float64, bool) {
+	best := exp.BestCheckpoint()
+	if best == nil || best.PrimaryMetric == nil {
+		return "", "", 0, false
+	}
+	v, ok := best.Metrics[best.PrimaryMetric.Name]
+	if !ok {
+		return "", "", 0, false
+	}
+	var value float64
+	switch v.Type() {
+	case param.TypeInt:
+		value = float64(v.IntVal())
+	case param.TypeFloat:
+		value = v.FloatVal()
+	default:
+		return "", "", 0, false
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", "", 0, false
+	}
+	return best.PrimaryMetric.Name, best.PrimaryMetric.Goal, value, true
+}
+
+// weekStart returns midnight UTC on the Monday of the week t is in
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	// Weekday is 0 on Sunday
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+func averageSeconds(total time.Duration, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return total.Seconds() / float64(n)
+}
@@ -0,0 +1,93 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestStats(t *testing.T) {
+	dir, err := files.TempDir("test-stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(path.Join(dir, ".replicate"))
+	require.NoError(t, err)
+
+	monday := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	wednesday := monday.AddDate(0, 0, 2)
+	primaryMetric := &PrimaryMetric{Name: "loss", Goal: GoalMinimize}
+	experiments := []*Experiment{{
+		ID:      "1eeeeeeeee",
+		Created: wednesday,
+		User:    "andreas",
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Created: wednesday.Add(time.Hour), Metrics: param.ValueMap{"loss": param.Float(0.5)}, PrimaryMetric: primaryMetric},
+			{ID: "2ccccccccc", Created: wednesday.Add(2 * time.Hour), Metrics: param.ValueMap{"loss": param.Float(0.4)}, PrimaryMetric: primaryMetric},
+		},
+	}, {
+		ID:      "2eeeeeeeee",
+		Created: wednesday.Add(time.Hour),
+		User:    "ben",
+		Checkpoints: []*Checkpoint{
+			{ID: "3ccccccccc", Created: wednesday.Add(5 * time.Hour), Metrics: param.ValueMap{"loss": param.Float(0.2)}, PrimaryMetric: primaryMetric},
+		},
+	}, {
+		// Two weeks later, with no checkpoints
+		ID:      "3eeeeeeeee",
+		Created: wednesday.AddDate(0, 0, 14),
+		User:    "andreas",
+	}}
+	for _, exp := range experiments {
+		exp.Config = &config.Config{}
+		require.NoError(t, exp.Save(repo))
+	}
+	require.NoError(t, repo.Put("experiments/1eeeeeeeee.tar.gz", []byte("1234")))
+	require.NoError(t, repo.Put("checkpoints/3ccccccccc.tar.gz", []byte("123456")))
+
+	proj := NewProject(repo, dir)
+	stats, err := proj.Stats(time.Time{}, true)
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Experiments)
+	require.Equal(t, 3, stats.Checkpoints)
+	require.Equal(t, int64(10), stats.StorageBytes)
+	// 2 hours and 4 hours
+	require.Equal(t, float64(3*60*60), stats.AverageDurationSeconds)
+	require.Equal(t, []string{"loss"}, stats.Metrics)
+
+	// The week without experiments is included
+	require.Len(t, stats.Weeks, 3)
+	require.Equal(t, monday, stats.Weeks[0].Start)
+	require.Equal(t, monday.AddDate(0, 0, 7), stats.Weeks[1].Start)
+	require.Equal(t, 2, stats.Weeks[0].Experiments)
+	require.Equal(t, 0, stats.Weeks[1].Experiments)
+	require.Equal(t, 1, stats.Weeks[2].Experiments)
+	require.Equal(t, int64(10), stats.Weeks[0].StorageBytes)
+	require.Equal(t, int64(10), stats.Weeks[1].TotalStorageBytes)
+	require.Equal(t, int64(0), stats.Weeks[2].StorageBytes)
+	trend := stats.Weeks[0].Metrics["loss"]
+	require.Equal(t, 0.2, trend.Best)
+	require.InDelta(t, 0.3, trend.Mean, 1e-9)
+	require.Equal(t, 2, trend.Experiments)
+	require.Empty(t, stats.Weeks[2].Metrics)
+
+	require.Len(t, stats.Users, 2)
+	require.Equal(t, "andreas", stats.Users[0].User)
+	require.Equal(t, 2, stats.Users[0].Experiments)
+	require.Equal(t, int64(4), stats.Users[0].StorageBytes)
+	require.Equal(t, "ben", stats.Users[1].User)
+
+	// Experiments from before since aren't counted
+	stats, err = proj.Stats(monday.AddDate(0, 0, 7), false)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Experiments)
+	require.Len(t, stats.Weeks, 1)
+	require.Equal(t, int64(0), stats.StorageBytes)
+}
@@ -0,0 +1,207 @@
+package project
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// SpoolSummary is what is in a spool, waiting to be uploaded
+type SpoolSummary struct {
+	Objects int
+	Size    int64
+	// The IDs of the experiments and checkpoints that have metadata or
+	// files in the spool
+	Experiments []string
+	Checkpoints []string
+}
+
+// SummarizeSpool returns what is in the spool at spoolDir
+func SummarizeSpool(spoolDir string) (*SpoolSummary, error) {
+	paths, err := repository.SpooledPaths(spoolDir)
+	if err != nil {
+		return nil, err
+	}
+	summary := &SpoolSummary{Experiments: []string{}, Checkpoints: []string{}}
+	experiments := map[string]bool{}
+	checkpoints := map[string]bool{}
+	for _, objectPath := range paths {
+		summary.Objects++
+		if info, err := os.Stat(filepath.Join(spoolDir, filepath.FromSlash(objectPath))); err == nil {
+			summary.Size += info.Size()
+		}
+		// e.g. checkpoints/<ID>.weights.tar.gz or chunks/manifests/<ID>.json
+		id := strings.SplitN(path.Base(objectPath), ".", 2)[0]
+		switch {
+		case strings.HasPrefix(objectPath, experimentEventsFolder+"/"):
+			// metadata/events/<ID>/<event>.json
+			experiments[path.Base(path.Dir(objectPath))] = true
+		case strings.HasPrefix(objectPath, "metadata/experiments/"), strings.HasPrefix(objectPath, "experiments/"):
+			experiments[id] = true
+		case strings.HasPrefix(objectPath, "checkpoints/"), strings.HasPrefix(objectPath, "chunks/manifests/"):
+			checkpoints[id] = true
+		}
+	}
+	for id := range experiments {
+		summary.Experiments = append(summary.Experiments, id)
+	}
+	for id := range checkpoints {
+		summary.Checkpoints = append(summary.Checkpoints, id)
+	}
+	sort.Strings(summary.Experiments)
+	sort.Strings(summary.Checkpoints)
+	return summary, nil
+}
+
+// FileChanges are the differences between the project directory and a
+// checkpoint. Paths are relative to the project directory.
+type FileChanges struct {
+	// Added are files that aren't in the checkpoint
+	Added []string
+	// Modified are files whose contents are different to the checkpoint's
+	Modified []string
+	// Deleted are files in the checkpoint that aren't in the project
+	// directory any more
+	Deleted []string
+}
+
+// Empty returns whether there aren't any changes
+func (c *FileChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// WorkingDirectoryChanges compares the files in the project directory with
+// checkpoint, or exp if checkpoint is nil. The checkpoint is checked out to
+// a temporary directory to compare them, so only the trees being checked out
+// are compared. Excluded files are ignored.
+func (p *Project) WorkingDirectoryChanges(exp *Experiment, checkpoint *Checkpoint) (*FileChanges, error) {
+	tempDir, err := files.TempDir("status")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := p.CheckoutCheckpoint(checkpoint, exp, tempDir, true); err != nil {
+		return nil, err
+	}
+	checkedOut, err := repository.ListLocalFiles(tempDir, nil)
+	if err != nil {
+		return nil, err
+	}
+	local, err := repository.ListLocalFiles(p.directory, p.exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only files in the paths that were saved are compared
+	savedPaths := []string{}
+	if exp.Path != "" {
+		savedPaths = append(savedPaths, exp.Path)
+	}
+	if checkpoint != nil && checkpoint.Path != "" {
+		savedPaths = append(savedPaths, checkpoint.Path)
+	}
+	isSaved := func(relPath string) bool {
+		for _, savedPath := range savedPaths {
+			savedPath = path.Clean(filepath.ToSlash(savedPath))
+			if savedPath == "." || relPath == savedPath || strings.HasPrefix(relPath, savedPath+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	changes := &FileChanges{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	inCheckpoint := map[string]bool{}
+	for _, relPath := range checkedOut {
+		inCheckpoint[relPath] = true
+	}
+	inProject := map[string]bool{}
+	for _, relPath := range local {
+		if !isSaved(relPath) || !p.checkingOutTree(p.treeOfPath(relPath)) {
+			continue
+		}
+		inProject[relPath] = true
+		if !inCheckpoint[relPath] {
+			changes.Added = append(changes.Added, relPath)
+			continue
+		}
+		same, err := sameContents(filepath.Join(p.directory, filepath.FromSlash(relPath)), filepath.Join(tempDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			changes.Modified = append(changes.Modified, relPath)
+		}
+	}
+	for _, relPath := range checkedOut {
+		if !inProject[relPath] && p.checkingOutTree(p.treeOfPath(relPath)) {
+			changes.Deleted = append(changes.Deleted, relPath)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changes, nil
+}
+
+// treeOfPath returns the tree that a file in the project directory would be
+// saved in
+func (p *Project) treeOfPath(relPath string) string {
+	for _, m := range p.treeMatchers {
+		if m.ignore.MatchesPath(relPath) {
+			return m.tree
+		}
+	}
+	return TreeCode
+}
+
+// sameContents returns whether the files at path1 and path2 have the same
+// contents
+func sameContents(path1, path2 string) (bool, error) {
+	info1, err := os.Stat(path1)
+	if err != nil {
+		return false, err
+	}
+	info2, err := os.Stat(path2)
+	if err != nil {
+		return false, err
+	}
+	if info1.Size() != info2.Size() {
+		return false, nil
+	}
+	f1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer f1.Close()
+	f2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer f2.Close()
+	buf1 := make([]byte, 64*1024)
+	buf2 := make([]byte, 64*1024)
+	for {
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+		if n1 != n2 || !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF, nil
+		}
+		if err1 != nil {
+			return false, err1
+		}
+		if err2 != nil {
+			return false, err2
+		}
+	}
+}
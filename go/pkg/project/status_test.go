@@ -0,0 +1,110 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestWorkingDirectoryChanges(t *testing.T) {
+	projectDir, err := files.TempDir("test-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-status-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetExclude([]string{"*.log"})
+
+	write := func(name, contents string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path.Join(projectDir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, name), []byte(contents), 0644))
+	}
+	write("train.py", "train")
+	write("data.csv", "data")
+	write("model/weights.pt", "weights 1")
+
+	chk, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "model"}, false, nil, true)
+	require.NoError(t, err)
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Path:        ".",
+		Checkpoints: []*Checkpoint{chk},
+	}
+	require.NoError(t, repo.PutPathTar(projectDir, exp.StorageTarPath(), "."))
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	changes, err := proj.WorkingDirectoryChanges(exp, chk)
+	require.NoError(t, err)
+	require.True(t, changes.Empty())
+
+	write("train.py", "train 2")
+	write("model/weights.pt", "weights 2")
+	write("evaluate.py", "evaluate")
+	write("train.log", "excluded")
+	require.NoError(t, os.Remove(path.Join(projectDir, "data.csv")))
+
+	changes, err = proj.WorkingDirectoryChanges(exp, chk)
+	require.NoError(t, err)
+	require.Equal(t, &FileChanges{
+		Added:    []string{"evaluate.py"},
+		Modified: []string{"model/weights.pt", "train.py"},
+		Deleted:  []string{"data.csv"},
+	}, changes)
+
+	// Only the trees being checked out are compared
+	proj.SetTrees(&config.Trees{Weights: []string{"*.pt"}})
+	require.NoError(t, proj.SetCheckoutTrees([]string{TreeCode}))
+	changes, err = proj.WorkingDirectoryChanges(exp, chk)
+	require.NoError(t, err)
+	require.Equal(t, &FileChanges{
+		Added:    []string{"evaluate.py"},
+		Modified: []string{"train.py"},
+		Deleted:  []string{"data.csv"},
+	}, changes)
+}
+
+func TestSummarizeSpool(t *testing.T) {
+	spoolDir, err := files.TempDir("test-spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(spoolDir)
+
+	summary, err := SummarizeSpool(path.Join(spoolDir, "does-not-exist"))
+	require.NoError(t, err)
+	require.Equal(t, 0, summary.Objects)
+
+	spool, err := repository.NewDiskRepository(spoolDir)
+	require.NoError(t, err)
+	for _, p := range []string{
+		"metadata/experiments/1eeeeeeeee.json",
+		"experiments/1eeeeeeeee.tar.gz",
+		"checkpoints/1ccccccccc.tar.gz",
+		"checkpoints/1ccccccccc.weights.tar.gz",
+		"chunks/manifests/2ccccccccc.json",
+		"chunks/ab/abcdef",
+	} {
+		require.NoError(t, spool.Put(p, []byte("1234")))
+	}
+	summary, err = SummarizeSpool(spoolDir)
+	require.NoError(t, err)
+	require.Equal(t, &SpoolSummary{
+		Objects:     6,
+		Size:        24,
+		Experiments: []string{"1eeeeeeeee"},
+		Checkpoints: []string{"1ccccccccc", "2ccccccccc"},
+	}, summary)
+}
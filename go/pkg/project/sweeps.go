@@ -0,0 +1,362 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/param"
+)
+
+// A sweep is a set of experiments that `replicate sweep run` launches from a
+// sweep in replicate.yaml, each with different params. The sweep and the
+// params of each of its runs are recorded in metadata/sweeps/<ID>.json. Each
+// run is told which sweep it belongs to with the environment variables
+// SweepIDEnvVar and SweepRunEnvVar, and its experiment records them, so the
+// experiments of a sweep can be found and compared.
+
+const (
+	SweepIDEnvVar     = "REPLICATE_SWEEP_ID"
+	SweepRunEnvVar    = "REPLICATE_SWEEP_RUN"
+	SweepParamsEnvVar = "REPLICATE_SWEEP_PARAMS"
+)
+
+// maxSweepRuns is the most runs a sweep can have, so a grid of too many
+// params isn't launched by mistake
+const maxSweepRuns = 10000
+
+// Sweep is a set of experiments launched with different params
+type Sweep struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	User    string    `json:"user"`
+	Method  string    `json:"method"`
+	// PrimaryMetric picks the best run. If it is nil, each experiment's
+	// own primary metric is used.
+	PrimaryMetric *PrimaryMetric `json:"primary_metric,omitempty"`
+	Runs          []*SweepRun    `json:"runs"`
+}
+
+// SweepRun is one of the experiments of a sweep
+type SweepRun struct {
+	// Run is the number of the run, starting at 1
+	Run     int            `json:"run"`
+	Params  param.ValueMap `json:"params"`
+	Command string         `json:"command"`
+}
+
+// SweepMembership is the sweep an experiment was launched by
+type SweepMembership struct {
+	ID  string `json:"id"`
+	Run int    `json:"run"`
+}
+
+func (s *Sweep) ShortID() string {
+	return s.ID[:7]
+}
+
+func sweepPath(id string) string {
+	return "metadata/sweeps/" + id + ".json"
+}
+
+// sweepMembershipFromEnv returns the sweep this process was launched by, or
+// nil if it wasn't
+func sweepMembershipFromEnv() *SweepMembership {
+	id := os.Getenv(SweepIDEnvVar)
+	if id == "" {
+		return nil
+	}
+	run, err := strconv.Atoi(os.Getenv(SweepRunEnvVar))
+	if err != nil {
+		console.Warn("$%s is set, but $%s isn't a number, so the experiment isn't recorded as part of a sweep", SweepIDEnvVar, SweepRunEnvVar)
+		return nil
+	}
+	return &SweepMembership{ID: id, Run: run}
+}
+
+// NewSweep returns a sweep of the runs of conf, the sweep called name in
+// replicate.yaml
+func NewSweep(name string, conf *config.Sweep) (*Sweep, error) {
+	params, err := sweepParams(conf)
+	if err != nil {
+		return nil, err
+	}
+	username := ""
+	if currentUser, err := user.Current(); err == nil {
+		username = currentUser.Username
+	}
+	sweep := &Sweep{
+		ID:      generateRandomID(),
+		Name:    name,
+		Created: time.Now().UTC(),
+		User:    username,
+		Method:  conf.Method,
+		Runs:    []*SweepRun{},
+	}
+	if conf.PrimaryMetric != "" {
+		sweep.PrimaryMetric = &PrimaryMetric{Name: conf.PrimaryMetric, Goal: MetricGoal(conf.Goal)}
+	}
+	for i, runParams := range params {
+		values := map[string]string{}
+		for paramName, value := range runParams {
+			values[paramName] = shellQuote(value.String())
+		}
+		sweep.Runs = append(sweep.Runs, &SweepRun{
+			Run:     i + 1,
+			Params:  runParams,
+			Command: config.RenderSweepCommand(conf.Command, values),
+		})
+	}
+	return sweep, nil
+}
+
+// Env returns the environment variables that tell run's experiment which
+// sweep it belongs to, and what its params are
+func (s *Sweep) Env(run *SweepRun) ([]string, error) {
+	params, err := json.Marshal(run.Params)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		SweepIDEnvVar + "=" + s.ID,
+		SweepRunEnvVar + "=" + strconv.Itoa(run.Run),
+		SweepParamsEnvVar + "=" + string(params),
+		fmt.Sprintf("REPLICATE_EXPERIMENT_NAME=%s-%d", s.Name, run.Run),
+	}, nil
+}
+
+// sweepParams returns the params of each run of conf: every combination of
+// them for grid sweeps, and Runs random combinations for random sweeps
+func sweepParams(conf *config.Sweep) ([]param.ValueMap, error) {
+	names := conf.ParamNames()
+	if conf.Method == config.SweepRandom {
+		seed := conf.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		rng := rand.New(rand.NewSource(seed))
+		runs := []param.ValueMap{}
+		for i := 0; i < conf.Runs; i++ {
+			run := param.ValueMap{}
+			for _, name := range names {
+				run[name] = randomSweepValue(conf.Params[name], rng)
+			}
+			runs = append(runs, run)
+		}
+		return runs, nil
+	}
+
+	total := 1
+	for _, name := range names {
+		total *= len(conf.Params[name].Values)
+		if total > maxSweepRuns {
+			return nil, fmt.Errorf("The sweep has more than %d combinations of params, which is too many to run", maxSweepRuns)
+		}
+	}
+	// The first param changes slowest, like nested loops
+	runs := []param.ValueMap{{}}
+	for _, name := range names {
+		next := []param.ValueMap{}
+		for _, run := range runs {
+			for _, value := range conf.Params[name].Values {
+				combined := param.ValueMap{}
+				for k, v := range run {
+					combined[k] = v
+				}
+				combined[name] = value
+				next = append(next, combined)
+			}
+		}
+		runs = next
+	}
+	return runs, nil
+}
+
+// randomSweepValue picks a value of p
+func randomSweepValue(p *config.SweepParam, rng *rand.Rand) param.Value {
+	if !p.IsRange() {
+		return p.Values[rng.Intn(len(p.Values))]
+	}
+	min, max := *p.Min, *p.Max
+	var f float64
+	if p.Log {
+		f = math.Exp(math.Log(min) + rng.Float64()*(math.Log(max)-math.Log(min)))
+	} else {
+		f = min + rng.Float64()*(max-min)
+	}
+	if p.Int {
+		return param.Int(int64(math.Round(f)))
+	}
+	return param.Float(f)
+}
+
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9_.,:/=+@%-]+$`)
+
+// shellQuote quotes s so the shell passes it as a single argument
+func shellQuote(s string) string {
+	if shellSafePattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// SaveSweep saves sweep to the repository
+func (p *Project) SaveSweep(sweep *Sweep) error {
+	data, err := json.MarshalIndent(sweep, "", " ")
+	if err != nil {
+		return err
+	}
+	return p.repository.Put(sweepPath(sweep.ID), data)
+}
+
+// Sweeps returns the sweeps in the project, oldest first
+func (p *Project) Sweeps() ([]*Sweep, error) {
+	paths, err := p.repository.List("metadata/sweeps/")
+	if err != nil {
+		return nil, err
+	}
+	sweeps := []*Sweep{}
+	for _, sweepPath := range paths {
+		sweep := new(Sweep)
+		if err := loadFromPath(p.repository, sweepPath, sweep); err != nil {
+			console.Warn("Failed to load metadata from %q: %s", sweepPath, err)
+			continue
+		}
+		sweeps = append(sweeps, sweep)
+	}
+	sort.Slice(sweeps, func(i, j int) bool {
+		return sweeps[i].Created.Before(sweeps[j].Created)
+	})
+	return sweeps, nil
+}
+
+// SweepFromPrefix returns the sweep whose ID starts with prefix, or the
+// latest sweep called prefix. If prefix is empty, it returns the latest
+// sweep.
+func (p *Project) SweepFromPrefix(prefix string) (*Sweep, error) {
+	sweeps, err := p.Sweeps()
+	if err != nil {
+		return nil, err
+	}
+	if len(sweeps) == 0 {
+		return nil, errors.DoesNotExist("There aren't any sweeps. Run 'replicate sweep run <name>' to start one.")
+	}
+	if prefix == "" {
+		return sweeps[len(sweeps)-1], nil
+	}
+	for i := len(sweeps) - 1; i >= 0; i-- {
+		if sweeps[i].Name == prefix {
+			return sweeps[i], nil
+		}
+	}
+	matches := []*Sweep{}
+	for _, sweep := range sweeps {
+		if strings.HasPrefix(sweep.ID, prefix) {
+			matches = append(matches, sweep)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.DoesNotExist("Sweep not found: " + prefix)
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("Prefix is ambiguous: %s (%d matching sweeps)", prefix, len(matches))
+	}
+	return matches[0], nil
+}
+
+// SweepRunStatus is how a run of a sweep is going
+type SweepRunStatus struct {
+	Run *SweepRun
+	// Experiment is nil if the run hasn't created an experiment yet
+	Experiment *Experiment
+	Running    bool
+	// Best is the run's best checkpoint, by the sweep's primary metric or
+	// the experiment's own
+	Best *Checkpoint
+}
+
+// SweepStatus returns how each run of sweep is going, and the run with the
+// best checkpoint, or nil if none of them have a best checkpoint yet
+func (p *Project) SweepStatus(sweep *Sweep) ([]*SweepRunStatus, *SweepRunStatus, error) {
+	experiments, err := p.Experiments()
+	if err != nil {
+		return nil, nil, err
+	}
+	// If a run was launched more than once, its latest experiment is used
+	byRun := map[int]*Experiment{}
+	for _, exp := range experiments {
+		if exp.Sweep == nil || exp.Sweep.ID != sweep.ID {
+			continue
+		}
+		if other := byRun[exp.Sweep.Run]; other == nil || exp.Created.After(other.Created) {
+			byRun[exp.Sweep.Run] = exp
+		}
+	}
+
+	statuses := []*SweepRunStatus{}
+	var best *SweepRunStatus
+	var bestMetric *PrimaryMetric
+	for _, run := range sweep.Runs {
+		status := &SweepRunStatus{Run: run, Experiment: byRun[run.Run]}
+		statuses = append(statuses, status)
+		if status.Experiment == nil {
+			continue
+		}
+		if status.Running, err = p.ExperimentIsRunning(status.Experiment.ID); err != nil {
+			return nil, nil, err
+		}
+		metric := sweep.PrimaryMetric
+		if metric == nil {
+			status.Best = status.Experiment.BestCheckpoint()
+			if status.Best != nil {
+				metric = status.Best.PrimaryMetric
+			}
+		} else {
+			status.Best = status.Experiment.BestCheckpointBy(metric)
+		}
+		if status.Best == nil {
+			continue
+		}
+		if best == nil || betterCheckpoint(status.Best, best.Best, bestMetric) {
+			best = status
+			bestMetric = metric
+		}
+	}
+	return statuses, best, nil
+}
+
+// betterCheckpoint returns whether chk has a better value of metric than
+// other
+func betterCheckpoint(chk *Checkpoint, other *Checkpoint, metric *PrimaryMetric) bool {
+	value, ok := chk.Metrics[metric.Name]
+	if !ok {
+		return false
+	}
+	otherValue, ok := other.Metrics[metric.Name]
+	if !ok {
+		return true
+	}
+	var better bool
+	var err error
+	if metric.Goal == GoalMaximize {
+		better, err = value.GreaterThan(otherValue)
+	} else {
+		better, err = value.LessThan(otherValue)
+	}
+	if err != nil {
+		console.Warn("Got error when comparing metrics: %s", err)
+	}
+	return better
+}
@@ -0,0 +1,153 @@
+package project
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/param"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestNewGridSweep(t *testing.T) {
+	sweep, err := NewSweep("lr", &config.Sweep{
+		Command: "python train.py --lr {learning_rate} --optimizer {optimizer}",
+		Method:  config.SweepGrid,
+		Params: map[string]*config.SweepParam{
+			"learning_rate": {Values: []param.Value{param.Float(0.1), param.Float(0.01)}},
+			"optimizer":     {Values: []param.Value{param.String("adam"), param.String("sgd with momentum")}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "lr", sweep.Name)
+	require.Nil(t, sweep.PrimaryMetric)
+	require.Len(t, sweep.Runs, 4)
+	require.Equal(t, &SweepRun{
+		Run:     1,
+		Params:  param.ValueMap{"learning_rate": param.Float(0.1), "optimizer": param.String("adam")},
+		Command: "python train.py --lr 0.1 --optimizer adam",
+	}, sweep.Runs[0])
+	require.Equal(t, "python train.py --lr 0.1 --optimizer 'sgd with momentum'", sweep.Runs[1].Command)
+	require.Equal(t, "python train.py --lr 0.01 --optimizer adam", sweep.Runs[2].Command)
+	require.Equal(t, 4, sweep.Runs[3].Run)
+
+	env, err := sweep.Env(sweep.Runs[2])
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"REPLICATE_SWEEP_ID=" + sweep.ID,
+		"REPLICATE_SWEEP_RUN=3",
+		`REPLICATE_SWEEP_PARAMS={"learning_rate":0.01,"optimizer":"adam"}`,
+		"REPLICATE_EXPERIMENT_NAME=lr-3",
+	}, env)
+}
+
+func TestNewRandomSweep(t *testing.T) {
+	min, max := 0.0001, 0.1
+	minLayers, maxLayers := 1.0, 8.0
+	conf := &config.Sweep{
+		Command:       "python train.py",
+		Method:        config.SweepRandom,
+		Runs:          20,
+		Seed:          42,
+		PrimaryMetric: "loss",
+		Goal:          "minimize",
+		Params: map[string]*config.SweepParam{
+			"learning_rate": {Min: &min, Max: &max, Log: true},
+			"layers":        {Min: &minLayers, Max: &maxLayers, Int: true},
+			"optimizer":     {Values: []param.Value{param.String("adam"), param.String("sgd")}},
+		},
+	}
+	sweep, err := NewSweep("random", conf)
+	require.NoError(t, err)
+	require.Equal(t, &PrimaryMetric{Name: "loss", Goal: GoalMinimize}, sweep.PrimaryMetric)
+	require.Len(t, sweep.Runs, 20)
+	for _, run := range sweep.Runs {
+		lr := run.Params["learning_rate"].FloatVal()
+		require.True(t, lr >= min && lr <= max)
+		require.Equal(t, param.TypeInt, run.Params["layers"].Type())
+		layers := run.Params["layers"].IntVal()
+		require.True(t, layers >= 1 && layers <= 8)
+		require.Contains(t, []string{"adam", "sgd"}, run.Params["optimizer"].StringVal())
+	}
+
+	// The same seed picks the same params
+	again, err := NewSweep("random", conf)
+	require.NoError(t, err)
+	for i, run := range sweep.Runs {
+		require.Equal(t, run.Params, again.Runs[i].Params)
+	}
+}
+
+func TestSweepStatus(t *testing.T) {
+	repoDir, err := files.TempDir("test-sweep-status")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, repoDir)
+
+	_, err = proj.SweepFromPrefix("")
+	require.Error(t, err)
+
+	sweep, err := NewSweep("lr", &config.Sweep{
+		Command:       "python train.py --lr {lr}",
+		Method:        config.SweepGrid,
+		PrimaryMetric: "accuracy",
+		Goal:          "maximize",
+		Params: map[string]*config.SweepParam{
+			"lr": {Values: []param.Value{param.Float(0.1), param.Float(0.01), param.Float(0.001)}},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, proj.SaveSweep(sweep))
+
+	created := time.Now().UTC()
+	for _, exp := range []*Experiment{{
+		ID:      "1eeeeeeeee",
+		Created: created,
+		Sweep:   &SweepMembership{ID: sweep.ID, Run: 1},
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Step: 1, Metrics: param.ValueMap{"accuracy": param.Float(0.7)}},
+			{ID: "2ccccccccc", Step: 2, Metrics: param.ValueMap{"accuracy": param.Float(0.8)}},
+		},
+	}, {
+		ID:      "2eeeeeeeee",
+		Created: created,
+		Sweep:   &SweepMembership{ID: sweep.ID, Run: 2},
+		Checkpoints: []*Checkpoint{
+			{ID: "3ccccccccc", Step: 1, Metrics: param.ValueMap{"accuracy": param.Float(0.9)}},
+		},
+	}, {
+		// Not part of the sweep
+		ID:      "3eeeeeeeee",
+		Created: created,
+		Checkpoints: []*Checkpoint{
+			{ID: "4ccccccccc", Step: 1, Metrics: param.ValueMap{"accuracy": param.Float(1.0)}},
+		},
+	}} {
+		exp.Config = &config.Config{}
+		_, err := proj.SaveExperiment(exp, false)
+		require.NoError(t, err)
+	}
+
+	found, err := proj.SweepFromPrefix("lr")
+	require.NoError(t, err)
+	require.Equal(t, sweep.ID, found.ID)
+	found, err = proj.SweepFromPrefix(sweep.ID[:5])
+	require.NoError(t, err)
+	require.Equal(t, sweep.ID, found.ID)
+
+	statuses, best, err := proj.SweepStatus(sweep)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	require.Equal(t, "1eeeeeeeee", statuses[0].Experiment.ID)
+	require.Equal(t, "2ccccccccc", statuses[0].Best.ID)
+	require.Equal(t, "2eeeeeeeee", statuses[1].Experiment.ID)
+	require.Nil(t, statuses[2].Experiment)
+	require.Nil(t, statuses[2].Best)
+	require.Equal(t, statuses[1], best)
+}
@@ -0,0 +1,379 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Experiments and checkpoints that are removed are moved to the trash, so
+// they can be restored if they were removed by accident. Each thing that is
+// removed is an entry in the trash, in .trash/<entry ID>/. The entry's
+// metadata is in entry.json, and the objects that were removed are moved
+// into the entry's directory at the same paths they had in the repository.
+//
+// Chunks stay where they are, because other checkpoints might share them,
+// and are deleted when the entry is. Entries are deleted for good when they
+// are older than the trash's retention period.
+
+// TrashDir is the directory in the repository that the trash is in
+const TrashDir = ".trash"
+
+const defaultTrashRetentionDays = 7
+
+const trashEntryFilename = "entry.json"
+
+// TrashEntry is an experiment or checkpoint in the trash
+type TrashEntry struct {
+	ID      string    `json:"id"`
+	Deleted time.Time `json:"deleted"`
+
+	// ExperimentID is the experiment that was removed, or the experiment
+	// that the checkpoint was removed from
+	ExperimentID string `json:"experiment_id"`
+
+	// Experiment is set if an experiment was removed, and Checkpoint is set
+	// if a checkpoint was removed
+	Experiment *Experiment `json:"experiment,omitempty"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+
+	// Paths are the objects that were moved into the trash
+	Paths []string `json:"paths"`
+}
+
+// ShortID returns the short ID of what was removed
+func (e *TrashEntry) ShortID() string {
+	if e.Checkpoint != nil {
+		return e.Checkpoint.ShortID()
+	}
+	return e.Experiment.ShortID()
+}
+
+func (e *TrashEntry) checkpoints() []*Checkpoint {
+	if e.Checkpoint != nil {
+		return []*Checkpoint{e.Checkpoint}
+	}
+	return e.Experiment.Checkpoints
+}
+
+// auditRecord returns a record of operation on the experiment or checkpoint
+// in e
+func (e *TrashEntry) auditRecord(operation string) *AuditRecord {
+	record := &AuditRecord{Operation: operation, Checkpoints: checkpointIDs(e.checkpoints())}
+	if e.Checkpoint == nil {
+		record.Experiments = []string{e.ExperimentID}
+	}
+	return record
+}
+
+func (e *TrashEntry) dir() string {
+	return TrashDir + "/" + e.ID
+}
+
+func (e *TrashEntry) metadataPath() string {
+	return e.dir() + "/" + trashEntryFilename
+}
+
+// SetTrash sets how long things are kept in the trash. If trash is nil, the
+// default is used.
+func (p *Project) SetTrash(trash *config.Trash) {
+	days := defaultTrashRetentionDays
+	if trash != nil && trash.RetentionDays > 0 {
+		days = trash.RetentionDays
+	}
+	p.trashRetention = time.Duration(days) * 24 * time.Hour
+}
+
+// TrashExpires returns when entry will be deleted for good
+func (p *Project) TrashExpires(entry *TrashEntry) time.Time {
+	return entry.Deleted.Add(p.trashRetention)
+}
+
+// TrashExperiment moves exp and its checkpoints to the trash
+func (p *Project) TrashExperiment(exp *Experiment) (*TrashEntry, error) {
+	tarPaths, _, _, err := p.checkpointObjects(exp.Checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	entry := &TrashEntry{
+		ID:           generateRandomID(),
+		Deleted:      time.Now().UTC(),
+		ExperimentID: exp.ID,
+		Experiment:   exp,
+	}
+	// Metadata is moved first, so if moving is interrupted, the experiment
+	// is in the trash and can be restored, rather than left without files
+	entry.Paths = append(entry.Paths, exp.MetadataPath(), exp.MetricsPath())
+	for _, folder := range []string{experimentEventsFolder, metricEventsFolder} {
+		eventPaths, err := listEvents(p.repository, eventsDir(folder, exp.ID))
+		if err != nil {
+			return nil, err
+		}
+		entry.Paths = append(entry.Paths, eventPaths...)
+	}
+	entry.Paths = append(entry.Paths, withTarIndexPaths([]string{exp.StorageTarPath()})...)
+	entry.Paths = append(entry.Paths, withTarIndexPaths(tarPaths)...)
+
+	if err := p.moveToTrash(entry); err != nil {
+		return nil, err
+	}
+	if err := p.repository.Delete(exp.HeartbeatPath()); err != nil {
+		console.Warn("Failed to delete heartbeat file %s: %s", exp.HeartbeatPath(), err)
+	}
+	p.audit(&AuditRecord{Operation: AuditTrash, Experiments: []string{exp.ID}, Checkpoints: checkpointIDs(exp.Checkpoints)})
+	return entry, nil
+}
+
+// TrashCheckpoint removes chk from exp and moves it to the trash
+func (p *Project) TrashCheckpoint(chk *Checkpoint, exp *Experiment) (*TrashEntry, error) {
+	tarPaths, _, _, err := p.checkpointObjects([]*Checkpoint{chk})
+	if err != nil {
+		return nil, err
+	}
+	entry := &TrashEntry{
+		ID:           generateRandomID(),
+		Deleted:      time.Now().UTC(),
+		ExperimentID: exp.ID,
+		Checkpoint:   chk,
+		Paths:        withTarIndexPaths(tarPaths),
+	}
+	checkpoints := []*Checkpoint{}
+	for _, c := range exp.Checkpoints {
+		if c.ID != chk.ID {
+			checkpoints = append(checkpoints, c)
+		}
+	}
+	exp.Checkpoints = checkpoints
+	if _, err := p.SaveExperiment(exp, true); err != nil {
+		return nil, err
+	}
+	if err := p.moveToTrash(entry); err != nil {
+		return nil, err
+	}
+	p.audit(&AuditRecord{Operation: AuditTrash, Checkpoints: []string{chk.ID}})
+	return entry, nil
+}
+
+// moveToTrash writes entry's metadata, then moves the objects in it into the
+// trash. Objects that don't exist are left out.
+func (p *Project) moveToTrash(entry *TrashEntry) error {
+	if err := p.saveTrashEntry(entry); err != nil {
+		return err
+	}
+	moved := []string{}
+	for _, objectPath := range entry.Paths {
+		if err := p.repository.Move(objectPath, entry.dir()+"/"+objectPath); err != nil {
+			if errors.IsDoesNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("Failed to move %s to the trash: %w. To delete it without moving it to the trash, pass --permanent.", objectPath, err)
+		}
+		moved = append(moved, objectPath)
+	}
+	entry.Paths = moved
+	p.invalidateCache()
+	return p.saveTrashEntry(entry)
+}
+
+func (p *Project) saveTrashEntry(entry *TrashEntry) error {
+	data, err := json.MarshalIndent(entry, "", " ")
+	if err != nil {
+		return err
+	}
+	return p.repository.Put(entry.metadataPath(), data)
+}
+
+// TrashEntries returns what is in the trash, most recently removed first
+func (p *Project) TrashEntries() ([]*TrashEntry, error) {
+	results := make(chan repository.ListResult)
+	go p.repository.MatchFilenamesRecursive(context.Background(), results, TrashDir, trashEntryFilename)
+	entries := []*TrashEntry{}
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		// Only .trash/<entry ID>/entry.json, not files with the same name
+		// that were moved into an entry
+		if strings.Count(strings.TrimPrefix(result.Path, TrashDir+"/"), "/") != 1 {
+			continue
+		}
+		entry := &TrashEntry{}
+		if err := loadFromPath(p.repository, result.Path, entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Deleted.After(entries[j].Deleted)
+	})
+	return entries, nil
+}
+
+// TrashEntryFromPrefix returns the entry in the trash for the experiment or
+// checkpoint with the given ID prefix, or the experiment with the given name
+func (p *Project) TrashEntryFromPrefix(prefix string) (*TrashEntry, error) {
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*TrashEntry{}
+	for _, entry := range entries {
+		if entry.Checkpoint != nil {
+			if strings.HasPrefix(entry.Checkpoint.ID, prefix) {
+				matches = append(matches, entry)
+			}
+		} else if strings.HasPrefix(entry.ExperimentID, prefix) || (entry.Experiment.Name != "" && entry.Experiment.Name == prefix) {
+			matches = append(matches, entry)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.DoesNotExist("Checkpoint/experiment not found in the trash: " + prefix)
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("Prefix is ambiguous: %s (%d matching checkpoints/experiments in the trash)", prefix, len(matches))
+	}
+	return matches[0], nil
+}
+
+// RestoreFromTrash moves the experiment or checkpoint in entry out of the
+// trash. A checkpoint can only be restored if its experiment hasn't been
+// removed.
+func (p *Project) RestoreFromTrash(entry *TrashEntry) error {
+	if entry.Checkpoint != nil {
+		exp, err := p.ExperimentByID(entry.ExperimentID)
+		if err != nil {
+			return fmt.Errorf("Checkpoint %s can't be restored, because its experiment %s has been removed. Restore the experiment first.", entry.Checkpoint.ShortID(), entry.ExperimentID[:7])
+		}
+		if err := p.moveFromTrash(entry); err != nil {
+			return err
+		}
+		exp.Checkpoints = append(exp.Checkpoints, entry.Checkpoint)
+		sort.SliceStable(exp.Checkpoints, func(i, j int) bool {
+			return exp.Checkpoints[i].Created.Before(exp.Checkpoints[j].Created)
+		})
+		if _, err := p.SaveExperiment(exp, true); err != nil {
+			return err
+		}
+	} else {
+		if exp, err := p.ExperimentByID(entry.ExperimentID); err == nil && exp != nil {
+			return fmt.Errorf("Experiment %s can't be restored, because it already exists", exp.ShortID())
+		}
+		if name := entry.Experiment.Name; name != "" {
+			if exp, err := p.ExperimentByName(name); err != nil {
+				return err
+			} else if exp != nil {
+				return fmt.Errorf("Experiment %s can't be restored, because there is already another experiment called %q", entry.Experiment.ShortID(), name)
+			}
+		}
+		if err := p.moveFromTrash(entry); err != nil {
+			return err
+		}
+	}
+	if err := p.repository.Delete(entry.dir()); err != nil {
+		console.Warn("Failed to delete %s from the trash: %s", entry.dir(), err)
+	}
+	p.invalidateCache()
+	p.audit(entry.auditRecord(AuditRestore))
+	return nil
+}
+
+// moveFromTrash moves the objects in entry back to where they were. The
+// experiment's metadata is moved last, so the experiment doesn't appear
+// until its files are back.
+func (p *Project) moveFromTrash(entry *TrashEntry) error {
+	for i := len(entry.Paths) - 1; i >= 0; i-- {
+		objectPath := entry.Paths[i]
+		if err := p.repository.Move(entry.dir()+"/"+objectPath, objectPath); err != nil {
+			if errors.IsDoesNotExist(err) {
+				console.Warn("%s is missing from the trash, so it can't be restored", objectPath)
+				continue
+			}
+			return fmt.Errorf("Failed to restore %s from the trash: %w", objectPath, err)
+		}
+	}
+	return nil
+}
+
+// EmptyTrash deletes the entries in the trash that are older than the
+// trash's retention period, and returns how many were deleted
+func (p *Project) EmptyTrash(now time.Time) (int, error) {
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return 0, err
+	}
+	expired := []*TrashEntry{}
+	for _, entry := range entries {
+		if !now.Before(p.TrashExpires(entry)) {
+			expired = append(expired, entry)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	lock, err := p.lockForMaintenance("emptying the trash")
+	if err != nil {
+		return 0, err
+	}
+	defer releaseLock(lock)
+
+	count := 0
+	for _, entry := range expired {
+		if err := p.deleteTrashEntry(entry); err != nil {
+			return count, err
+		}
+		p.audit(entry.auditRecord(AuditEmptyTrash))
+		count++
+	}
+	return count, nil
+}
+
+// deleteTrashEntry deletes entry for good, along with the chunks and large
+// files of its checkpoints that nothing else uses
+func (p *Project) deleteTrashEntry(entry *TrashEntry) error {
+	console.Debug("Deleting %s from the trash", entry.ShortID())
+	blobPaths, err := p.unusedBlobs(entry.checkpoints(), entry.dir())
+	if err != nil {
+		console.Warn("Failed to find large files to delete: %s", err)
+	}
+	if err := p.repository.Delete(entry.metadataPath()); err != nil {
+		return err
+	}
+	if err := p.repository.Delete(entry.dir()); err != nil {
+		console.Warn("Failed to delete %s from the trash: %s", entry.dir(), err)
+	}
+	// Tarballs that were kept when the entry was moved to the trash, because
+	// other checkpoints referenced them, might not be referenced any more
+	toDelete, deletedIDs, keep, err := p.checkpointObjects(entry.checkpoints())
+	if err != nil {
+		return err
+	}
+	for _, objectPath := range withTarIndexPaths(toDelete) {
+		if err := p.repository.Delete(objectPath); err != nil {
+			console.Warn("Failed to delete %s: %s", objectPath, err)
+		}
+	}
+	if err := p.deleteUnusedChunks(deletedIDs, keep); err != nil {
+		console.Warn("Failed to delete chunks: %s", err)
+	}
+	p.deleteBlobs(blobPaths)
+	p.invalidateCache()
+	return nil
+}
+
+// withTarIndexPaths returns tarPaths with the paths of their indexes after
+// each of them
+func withTarIndexPaths(tarPaths []string) []string {
+	ret := []string{}
+	for _, tarPath := range tarPaths {
+		ret = append(ret, tarPath, repository.TarIndexPath(tarPath))
+	}
+	return ret
+}
@@ -0,0 +1,113 @@
+package project
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestTrash(t *testing.T) {
+	dir, err := files.TempDir("test-trash")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repoDir := path.Join(dir, ".replicate")
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	exp := &Experiment{
+		ID:      "1eeeeeeeee",
+		Name:    "brave-falcon-42",
+		Created: now,
+		Config:  &config.Config{},
+		Path:    ".",
+		Checkpoints: []*Checkpoint{
+			{ID: "1ccccccccc", Created: now, Path: "."},
+			{ID: "2ccccccccc", Created: now.Add(time.Minute), Path: "."},
+		},
+	}
+	require.NoError(t, exp.Save(repo))
+	for _, p := range []string{exp.StorageTarPath(), "checkpoints/1ccccccccc.tar.gz", "checkpoints/2ccccccccc.tar.gz"} {
+		require.NoError(t, repo.Put(p, []byte(p)))
+	}
+	requireExists := func(p string, expected bool) {
+		exists, err := files.FileExists(path.Join(repoDir, p))
+		require.NoError(t, err)
+		require.Equal(t, expected, exists, p)
+	}
+
+	proj := NewProject(repo, dir)
+
+	// Checkpoint
+	entry, err := proj.TrashCheckpoint(exp.Checkpoints[0], exp)
+	require.NoError(t, err)
+	require.Equal(t, []string{"checkpoints/1ccccccccc.tar.gz"}, entry.Paths)
+	requireExists("checkpoints/1ccccccccc.tar.gz", false)
+	requireExists(".trash/"+entry.ID+"/checkpoints/1ccccccccc.tar.gz", true)
+	loaded, err := proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Checkpoints, 1)
+
+	// Experiment
+	expEntry, err := proj.TrashExperiment(loaded)
+	require.NoError(t, err)
+	requireExists(exp.MetadataPath(), false)
+	requireExists(exp.StorageTarPath(), false)
+	requireExists("checkpoints/2ccccccccc.tar.gz", false)
+	experiments, err := proj.Experiments()
+	require.NoError(t, err)
+	require.Empty(t, experiments)
+
+	entries, err := proj.TrashEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// The checkpoint can't be restored without its experiment
+	entry, err = proj.TrashEntryFromPrefix("1cc")
+	require.NoError(t, err)
+	require.Error(t, proj.RestoreFromTrash(entry))
+
+	// Experiments can be found by name
+	entry, err = proj.TrashEntryFromPrefix("brave-falcon-42")
+	require.NoError(t, err)
+	require.Equal(t, expEntry.ID, entry.ID)
+	require.NoError(t, proj.RestoreFromTrash(entry))
+	requireExists(exp.StorageTarPath(), true)
+	requireExists("checkpoints/2ccccccccc.tar.gz", true)
+
+	entry, err = proj.TrashEntryFromPrefix("1cc")
+	require.NoError(t, err)
+	require.NoError(t, proj.RestoreFromTrash(entry))
+	requireExists("checkpoints/1ccccccccc.tar.gz", true)
+	loaded, err = proj.ExperimentByID(exp.ID)
+	require.NoError(t, err)
+	require.Equal(t, "1ccccccccc", loaded.Checkpoints[0].ID)
+	require.Equal(t, "2ccccccccc", loaded.Checkpoints[1].ID)
+
+	entries, err = proj.TrashEntries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Entries are deleted for good after the retention period
+	_, err = proj.TrashExperiment(loaded)
+	require.NoError(t, err)
+	proj.SetTrash(&config.Trash{RetentionDays: 2})
+	count, err := proj.EmptyTrash(now.Add(24 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	count, err = proj.EmptyTrash(now.Add(49 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	entries, err = proj.TrashEntries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	_, err = proj.TrashEntryFromPrefix("1ee")
+	require.Error(t, err)
+}
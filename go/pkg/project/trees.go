@@ -0,0 +1,269 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// With trees in replicate.yaml, the files in a checkpoint are split into
+// code, weights and artifacts. Weights and artifacts go in their own tarballs,
+// checkpoints/<checkpoint ID>.<tree>.tar.gz (or the checkpoint's storage path
+// with the tree's extension, see layout.go), and code goes in the
+// checkpoint's tarball as usual, so code can be checked out without
+// downloading gigabytes of weights.
+
+const (
+	TreeCode      = "code"
+	TreeWeights   = "weights"
+	TreeArtifacts = "artifacts"
+)
+
+// TreeNames are the names of the trees, in the order they are checked out
+var TreeNames = []string{TreeCode, TreeWeights, TreeArtifacts}
+
+type treeMatcher struct {
+	tree   string
+	ignore *gitignore.GitIgnore
+}
+
+// SetTrees sets the patterns for which files in checkpoints are weights and
+// artifacts. If trees is nil, every file is code.
+func (p *Project) SetTrees(trees *config.Trees) {
+	p.treeMatchers = nil
+	if trees == nil {
+		return
+	}
+	// Weights come first so they win if a file matches both
+	for _, t := range []struct {
+		name     string
+		patterns []string
+	}{{TreeWeights, trees.Weights}, {TreeArtifacts, trees.Artifacts}} {
+		if len(t.patterns) == 0 {
+			continue
+		}
+		// This only fails when reading a file, so it can't here
+		ignore, _ := gitignore.CompileIgnoreLines(t.patterns...)
+		p.treeMatchers = append(p.treeMatchers, treeMatcher{tree: t.name, ignore: ignore})
+	}
+}
+
+// SetCheckoutTrees sets which trees of checkpoints are checked out. If trees
+// is empty, all of them are.
+func (p *Project) SetCheckoutTrees(trees []string) error {
+	if err := ValidateTrees(trees); err != nil {
+		return err
+	}
+	p.checkoutTrees = trees
+	return nil
+}
+
+// ValidateTrees returns an error if trees contains anything that isn't the
+// name of a tree
+func ValidateTrees(trees []string) error {
+	for _, tree := range trees {
+		if !isTreeName(tree) {
+			return fmt.Errorf("%q is not a tree. It must be one of: %s", tree, strings.Join(TreeNames, ", "))
+		}
+	}
+	return nil
+}
+
+func isTreeName(tree string) bool {
+	for _, name := range TreeNames {
+		if tree == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkingOutTree returns whether the files in tree are checked out
+func (p *Project) checkingOutTree(tree string) bool {
+	if len(p.checkoutTrees) == 0 {
+		return true
+	}
+	for _, t := range p.checkoutTrees {
+		if t == tree {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCheckoutTrees returns the paths of files in chk that are in the trees
+// being checked out
+func (p *Project) filterCheckoutTrees(chk *Checkpoint, filePaths []string) []string {
+	if len(p.checkoutTrees) == 0 {
+		return filePaths
+	}
+	ret := []string{}
+	for _, filePath := range filePaths {
+		if p.checkingOutTree(chk.TreeOf(filePath)) {
+			ret = append(ret, filePath)
+		}
+	}
+	return ret
+}
+
+// selectTreeFiles records which of the files in the snapshot in tempDir are
+// weights and artifacts in chk.Trees. It is called before unchanged files are
+// removed from the snapshot, so references to them can be found in the right
+// tarball.
+func (p *Project) selectTreeFiles(chk *Checkpoint, tempDir string) error {
+	if len(p.treeMatchers) == 0 {
+		return nil
+	}
+	return filepath.Walk(filepath.Join(tempDir, chk.Path), func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(tempDir, currentPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, m := range p.treeMatchers {
+			if m.ignore.MatchesPath(relPath) {
+				if chk.Trees == nil {
+					chk.Trees = map[string][]string{}
+				}
+				chk.Trees[m.tree] = append(chk.Trees[m.tree], relPath)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// moveTreeFiles moves the files in tree out of the snapshot in tempDir into a
+// new directory, so they can be put in the tree's tarball. Files that have
+// been removed from the snapshot, because they are unchanged or chunked, are
+// skipped.
+func moveTreeFiles(chk *Checkpoint, tempDir string, tree string) (treeDir string, err error) {
+	treeDir, err = files.TempDir("checkpoint-" + tree)
+	if err != nil {
+		return "", err
+	}
+	for _, relPath := range chk.Trees[tree] {
+		src := filepath.Join(tempDir, filepath.FromSlash(relPath))
+		if exists, err := files.FileExists(src); err != nil {
+			os.RemoveAll(treeDir)
+			return "", err
+		} else if !exists {
+			continue
+		}
+		dest := filepath.Join(treeDir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			os.RemoveAll(treeDir)
+			return "", err
+		}
+		if err := os.Rename(src, dest); err != nil {
+			os.RemoveAll(treeDir)
+			return "", err
+		}
+	}
+	return treeDir, nil
+}
+
+// TreeOf returns the tree that filePath is in
+func (c *Checkpoint) TreeOf(filePath string) string {
+	for tree, filePaths := range c.Trees {
+		for _, p := range filePaths {
+			if p == filePath {
+				return tree
+			}
+		}
+	}
+	return TreeCode
+}
+
+// StoredTrees returns the trees that this checkpoint has tarballs for. There
+// is always a tarball for code, even if it's empty.
+func (c *Checkpoint) StoredTrees() []string {
+	ret := []string{}
+	for _, tree := range TreeNames {
+		if tree == TreeCode || len(c.Trees[tree]) > 0 {
+			ret = append(ret, tree)
+		}
+	}
+	return ret
+}
+
+// TreeTarPath returns the path of the tarball for tree
+func (c *Checkpoint) TreeTarPath(tree string) string {
+	return checkpointTreeTarPath(c.StoragePath, c.ID, tree)
+}
+
+// referencedTreeTarPath returns the path of the tarball for tree of the
+// checkpoint with ID id, which is this checkpoint or one it references
+func (c *Checkpoint) referencedTreeTarPath(id string, tree string) string {
+	return checkpointTreeTarPath(c.referencedStoragePath(id), id, tree)
+}
+
+// checkpointTreeTarPath returns the path of the tarball for tree of the
+// checkpoint with ID id, which is stored at storagePath, or in checkpoints/
+// if it is empty
+func checkpointTreeTarPath(storagePath string, id string, tree string) string {
+	if storagePath == "" {
+		storagePath = "checkpoints/" + id
+	}
+	if tree == TreeCode {
+		return storagePath + ".tar.gz"
+	}
+	return storagePath + "." + tree + ".tar.gz"
+}
+
+// checkpointTarPaths returns the paths of every tarball the checkpoint with
+// ID id, stored at storagePath, might have
+func checkpointTarPaths(storagePath string, id string) []string {
+	ret := []string{}
+	for _, tree := range TreeNames {
+		ret = append(ret, checkpointTreeTarPath(storagePath, id, tree))
+	}
+	return ret
+}
+
+// referencedTarPaths returns the tarballs of earlier checkpoints that chk has
+// files in, mapped to the paths of those files
+func (c *Checkpoint) referencedTarPaths() map[string][]string {
+	ret := map[string][]string{}
+	for filePath, id := range c.References {
+		tarPath := c.referencedTreeTarPath(id, c.TreeOf(filePath))
+		ret[tarPath] = append(ret[tarPath], filePath)
+	}
+	for _, filePaths := range ret {
+		sort.Strings(filePaths)
+	}
+	return ret
+}
+
+// putTreeFiles moves the weights and artifacts out of the snapshot in tempDir
+// and puts them in their own tarballs
+func (p *Project) putTreeFiles(chk *Checkpoint, tempDir string) error {
+	for _, tree := range chk.StoredTrees() {
+		if tree == TreeCode {
+			continue
+		}
+		treeDir, err := moveTreeFiles(chk, tempDir, tree)
+		if err != nil {
+			return fmt.Errorf("Failed to copy %s to temporary directory: %w", tree, err)
+		}
+		err = p.repository.PutPathTar(treeDir, chk.TreeTarPath(tree), "")
+		os.RemoveAll(treeDir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
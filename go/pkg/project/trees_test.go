@@ -0,0 +1,117 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestCheckpointTrees(t *testing.T) {
+	projectDir, err := files.TempDir("test-trees")
+	require.NoError(t, err)
+	defer os.RemoveAll(projectDir)
+	repoDir, err := files.TempDir("test-trees-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+	proj := NewProject(repo, projectDir)
+	proj.SetTrees(&config.Trees{
+		Weights:   []string{"*.pt"},
+		Artifacts: []string{"plots/"},
+	})
+
+	// Modified in the past, so they can be referenced by the next checkpoint
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.MkdirAll(path.Join(projectDir, "plots"), 0755))
+	for _, name := range []string{"train.py", "weights.pt", "plots/loss.png"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(projectDir, name), []byte(name+" 1"), 0644))
+		require.NoError(t, os.Chtimes(path.Join(projectDir, name), past, past))
+	}
+
+	chk1, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		TreeWeights:   {"weights.pt"},
+		TreeArtifacts: {"plots/loss.png"},
+	}, chk1.Trees)
+	require.Equal(t, TreeNames, chk1.StoredTrees())
+	for tree, expected := range map[string][]string{
+		TreeCode:      {"train.py"},
+		TreeWeights:   {"weights.pt"},
+		TreeArtifacts: {"plots/loss.png"},
+	} {
+		tarFiles, err := repo.ListTarFile(chk1.TreeTarPath(tree))
+		require.NoError(t, err)
+		require.Equal(t, expected, tarFiles, tree)
+	}
+
+	// Unchanged weights are referenced in the first checkpoint's weights
+	require.NoError(t, ioutil.WriteFile(path.Join(projectDir, "train.py"), []byte("train.py 2"), 0644))
+	chk2, err := proj.CreateCheckpoint(CreateCheckpointArgs{Path: "."}, false, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, chk1.ID, chk2.References["weights.pt"])
+
+	exp := &Experiment{
+		ID:          "1eeeeeeeee",
+		Created:     time.Now().UTC(),
+		Config:      &config.Config{},
+		Checkpoints: []*Checkpoint{chk1, chk2},
+	}
+	_, err = proj.SaveExperiment(exp, true)
+	require.NoError(t, err)
+
+	// Only code
+	outputDir, err := files.TempDir("test-trees-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	require.NoError(t, proj.SetCheckoutTrees([]string{TreeCode}))
+	require.NoError(t, proj.CheckoutCheckpoint(chk2, exp, outputDir, true))
+	for name, expected := range map[string]bool{"train.py": true, "weights.pt": false, "plots": false} {
+		exists, err := files.FileExists(path.Join(outputDir, name))
+		require.NoError(t, err)
+		require.Equal(t, expected, exists, name)
+	}
+
+	// Everything, including referenced files
+	require.NoError(t, proj.SetCheckoutTrees(nil))
+	require.NoError(t, proj.CheckoutCheckpoint(chk2, exp, outputDir, true))
+	for name, expected := range map[string]string{
+		"train.py":       "train.py 2",
+		"weights.pt":     "weights.pt 1",
+		"plots/loss.png": "plots/loss.png 1",
+	} {
+		contents, err := ioutil.ReadFile(path.Join(outputDir, name))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(contents))
+	}
+
+	out := new(bytes.Buffer)
+	require.NoError(t, proj.CopyFile(chk2, exp, "plots/loss.png", out))
+	require.Equal(t, "plots/loss.png 1", out.String())
+
+	problems, err := proj.Verify()
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	require.EqualError(t, proj.SetCheckoutTrees([]string{"data"}), `"data" is not a tree. It must be one of: code, weights, artifacts`)
+
+	// Every tree is deleted
+	require.NoError(t, proj.DeleteCheckpoints([]*Checkpoint{chk1, chk2}))
+	for _, chk := range []*Checkpoint{chk1, chk2} {
+		for _, tarPath := range checkpointTarPaths(chk.StoragePath, chk.ID) {
+			exists, err := files.FileExists(path.Join(repoDir, tarPath))
+			require.NoError(t, err)
+			require.False(t, exists, tarPath)
+		}
+	}
+}
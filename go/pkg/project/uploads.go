@@ -0,0 +1,170 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Files saved with experiments and checkpoints are snapshotted to a temporary
+// directory straight away, then uploaded in the background. While an upload is
+// queued or running, a record of it is kept in UploadsDir in the project
+// directory, so `replicate status` can show uploads that haven't finished,
+// failed, or were interrupted because the process exited.
+
+// UploadsDir is where the records of background uploads are kept, relative to
+// the project directory
+const UploadsDir = ".replicate/uploads"
+
+// UploadState is the state of a background upload
+type UploadState string
+
+const (
+	UploadQueued    UploadState = "queued"
+	UploadUploading UploadState = "uploading"
+	UploadFailed    UploadState = "failed"
+	// The process uploading it was asked to exit, so it stopped part of the
+	// way through
+	UploadInterrupted UploadState = "interrupted"
+)
+
+// Upload is a record of a background upload of an experiment's or a
+// checkpoint's files
+type Upload struct {
+	// Type is "experiment" or "checkpoint"
+	Type    string      `json:"type"`
+	ID      string      `json:"id"`
+	Path    string      `json:"path"`
+	State   UploadState `json:"state"`
+	PID     int         `json:"pid"`
+	Queued  time.Time   `json:"queued"`
+	Started *time.Time  `json:"started,omitempty"`
+	Failed  *time.Time  `json:"failed,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func (u *Upload) ShortID() string {
+	return u.ID[:7]
+}
+
+// Interrupted returns whether the process that was uploading it exited before
+// the upload finished
+func (u *Upload) Interrupted() bool {
+	return u.State == UploadInterrupted || (u.State != UploadFailed && !processRunning(u.PID))
+}
+
+// ListUploads returns the background uploads of the project in projectDir
+// that haven't finished, oldest first
+func ListUploads(projectDir string) ([]*Upload, error) {
+	dir := filepath.Join(projectDir, UploadsDir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Upload{}, nil
+		}
+		return nil, err
+	}
+	uploads := []*Upload{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			// It might have finished while we were listing
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		upload := new(Upload)
+		if err := json.Unmarshal(data, upload); err != nil {
+			console.Warn("Failed to parse %s: %s", filepath.Join(UploadsDir, entry.Name()), err)
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].Queued.Before(uploads[j].Queued)
+	})
+	return uploads, nil
+}
+
+// RemoveUpload removes the record of the upload of the experiment or
+// checkpoint with id, e.g. once a failed upload has been dealt with
+func RemoveUpload(projectDir string, id string) error {
+	err := os.Remove(filepath.Join(projectDir, UploadsDir, id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// queueUpload sends work to workChan, keeping a record of it in UploadsDir
+// until it has finished. If the queue is full, it warns and waits for room.
+func (p *Project) queueUpload(workChan chan func() error, uploadType string, id string, path string, work func() error) {
+	upload := &Upload{
+		Type:   uploadType,
+		ID:     id,
+		Path:   path,
+		State:  UploadQueued,
+		PID:    os.Getpid(),
+		Queued: time.Now().UTC(),
+	}
+	p.saveUpload(upload)
+	queued := func() error {
+		started := time.Now().UTC()
+		upload.State = UploadUploading
+		upload.Started = &started
+		p.saveUpload(upload)
+		if err := work(); err != nil {
+			failed := time.Now().UTC()
+			upload.State = UploadFailed
+			if repository.TransfersCancelled() {
+				upload.State = UploadInterrupted
+			}
+			upload.Failed = &failed
+			upload.Error = err.Error()
+			p.saveUpload(upload)
+			return fmt.Errorf("Failed to upload files for %s %s: %w", uploadType, upload.ShortID(), err)
+		}
+		if err := RemoveUpload(p.directory, id); err != nil {
+			console.Warn("Failed to remove upload record: %s", err)
+		}
+		return nil
+	}
+	select {
+	case workChan <- queued:
+	default:
+		console.Warn("There are already %d uploads waiting to finish, so training will wait for them. Save checkpoints less often, or save smaller files, to avoid this.", cap(workChan))
+		workChan <- queued
+	}
+}
+
+// saveUpload writes the record of upload. Failing to write it is only a
+// warning, so the upload itself still happens.
+func (p *Project) saveUpload(upload *Upload) {
+	dir := filepath.Join(p.directory, UploadsDir)
+	data, err := json.MarshalIndent(upload, "", " ")
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		// Write then rename, so `replicate status` never reads half a record
+		tempPath := filepath.Join(dir, "."+upload.ID+".json.tmp")
+		if err = ioutil.WriteFile(tempPath, data, 0644); err == nil {
+			err = os.Rename(tempPath, filepath.Join(dir, upload.ID+".json"))
+		}
+	}
+	if err != nil {
+		console.Warn("Failed to save the status of the upload of %s %s: %s", upload.Type, upload.ShortID(), err)
+	}
+}
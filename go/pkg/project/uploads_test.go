@@ -0,0 +1,79 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestQueueUpload(t *testing.T) {
+	dir, err := files.TempDir("test-uploads")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := repository.NewDiskRepository(path.Join(dir, ".replicate/repository"))
+	require.NoError(t, err)
+	proj := NewProject(repo, dir)
+
+	workChan := make(chan func() error, 2)
+	started := make(chan struct{})
+	finish := make(chan error)
+	proj.queueUpload(workChan, "checkpoint", "1ccccccccc", "model.pth", func() error {
+		close(started)
+		return <-finish
+	})
+	proj.queueUpload(workChan, "checkpoint", "2ccccccccc", "model.pth", func() error {
+		return fmt.Errorf("bucket is full")
+	})
+
+	uploads, err := ListUploads(dir)
+	require.NoError(t, err)
+	require.Len(t, uploads, 2)
+	require.Equal(t, "1ccccccccc", uploads[0].ID)
+	require.Equal(t, UploadQueued, uploads[0].State)
+	require.Equal(t, os.Getpid(), uploads[0].PID)
+	require.False(t, uploads[0].Interrupted())
+
+	// Run the queue like the daemon does
+	errs := make(chan error, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			errs <- (<-workChan)()
+		}
+	}()
+	<-started
+	uploads, err = ListUploads(dir)
+	require.NoError(t, err)
+	require.Equal(t, UploadUploading, uploads[0].State)
+	require.NotNil(t, uploads[0].Started)
+
+	finish <- nil
+	require.NoError(t, <-errs)
+	err = <-errs
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bucket is full")
+
+	// Finished uploads are removed, and failed ones are kept
+	uploads, err = ListUploads(dir)
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	require.Equal(t, "2ccccccccc", uploads[0].ID)
+	require.Equal(t, UploadFailed, uploads[0].State)
+	require.Equal(t, "bucket is full", uploads[0].Error)
+	require.False(t, uploads[0].Interrupted())
+
+	// Uploads of processes that have exited were interrupted
+	uploads[0].State = UploadUploading
+	uploads[0].PID = 1 << 22
+	require.True(t, uploads[0].Interrupted())
+
+	require.NoError(t, RemoveUpload(dir, "2ccccccccc"))
+	uploads, err = ListUploads(dir)
+	require.NoError(t, err)
+	require.Empty(t, uploads)
+}
@@ -0,0 +1,355 @@
+package project
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// QuarantineDir is where Quarantine moves corrupt objects to
+const QuarantineDir = "quarantine"
+
+type ProblemKind string
+
+const (
+	// ProblemMissing is an object that metadata refers to, but doesn't exist
+	ProblemMissing ProblemKind = "missing"
+	// ProblemCorrupt is an object that exists but can't be read
+	ProblemCorrupt ProblemKind = "corrupt"
+	// ProblemUnreferenced is an object that no metadata refers to
+	ProblemUnreferenced ProblemKind = "unreferenced"
+	// ProblemUnsigned is a checkpoint that isn't signed
+	ProblemUnsigned ProblemKind = "unsigned"
+	// ProblemBadSignature is a checkpoint whose signature isn't valid, or
+	// doesn't match its metadata or files
+	ProblemBadSignature ProblemKind = "bad-signature"
+)
+
+// Problem is something wrong with the repository found by Verify
+type Problem struct {
+	Kind        ProblemKind
+	Path        string
+	Description string
+}
+
+// Verify walks all the experiment metadata in the repository, checks that
+// the experiment and checkpoint tarballs it refers to exist, and reads each
+// tarball in full to check it isn't corrupt. Chunked files are checked
+// against the hashes of their chunks, and large files against their hashes. If the repository records an
+// MD5 checksum for an object, that is checked against its content too.
+//
+// It doesn't use the project's loaded metadata, so metadata that fails to
+// load is reported too. Problems are returned sorted by path.
+func (p *Project) Verify() ([]*Problem, error) {
+	problems := []*Problem{}
+
+	results, err := p.listRecursiveAll("experiments", "checkpoints", "chunks", "blobs")
+	if err != nil {
+		return nil, err
+	}
+	checksums := map[string][]byte{}
+	for _, result := range results {
+		checksums[result.Path] = result.MD5
+	}
+
+	metadataPaths, err := p.repository.List("metadata/experiments/")
+	if err != nil {
+		return nil, err
+	}
+	events, err := listAllExperimentEvents(p.repository)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	// Tarballs that checkpoints have files in, which might belong to
+	// checkpoints that have been deleted
+	referencedByCheckpoints := map[string]string{}
+	// IDs of checkpoints that might have chunk manifests, and of those that
+	// must have one because they have chunked files
+	chunkedCheckpoints := map[string]string{}
+	requiredManifests := map[string]bool{}
+	// Checkpoints that have large files, and their descriptions
+	pointerCheckpoints := []*Checkpoint{}
+	pointerDescriptions := map[string]string{}
+	for _, metadataPath := range metadataPaths {
+		exp, problem := p.verifyMetadata(metadataPath)
+		if problem != nil {
+			problems = append(problems, problem)
+			continue
+		}
+		if err := mergeExperimentEvents(p.repository, exp, events[exp.ID]); err != nil {
+			problems = append(problems, &Problem{Kind: ProblemCorrupt, Path: eventsDir(experimentEventsFolder, exp.ID), Description: err.Error()})
+			continue
+		}
+		console.Debug("Verifying experiment %s", exp.ShortID())
+		if exp.Path != "" {
+			referenced[exp.StorageTarPath()] = true
+			problem := p.verifyTar(exp.StorageTarPath(), checksums, fmt.Sprintf("experiment %s", exp.ShortID()))
+			if problem != nil {
+				problems = append(problems, problem)
+			}
+		}
+		for _, chk := range exp.Checkpoints {
+			if chk.Path == "" {
+				continue
+			}
+			description := fmt.Sprintf("checkpoint %s of experiment %s", chk.ShortID(), exp.ShortID())
+			for _, tree := range chk.StoredTrees() {
+				tarDescription := description
+				if tree != TreeCode {
+					tarDescription = fmt.Sprintf("%s of %s", tree, description)
+				}
+				referenced[chk.TreeTarPath(tree)] = true
+				problem := p.verifyTar(chk.TreeTarPath(tree), checksums, tarDescription)
+				if problem != nil {
+					problems = append(problems, problem)
+				}
+			}
+			if len(chk.ChunkedFiles) > 0 {
+				chunkedCheckpoints[chk.ID] = description
+				requiredManifests[chk.ID] = true
+			}
+			if len(chk.PointerFiles) > 0 {
+				pointerCheckpoints = append(pointerCheckpoints, chk)
+				pointerDescriptions[chk.ID] = description
+			}
+			for tarPath := range chk.referencedTarPaths() {
+				referencedByCheckpoints[tarPath] = description
+			}
+			for id := range chk.ReferencedCheckpoints() {
+				if _, ok := chunkedCheckpoints[id]; !ok {
+					chunkedCheckpoints[id] = fmt.Sprintf("unchanged files in %s", description)
+				}
+			}
+		}
+	}
+	for tarPath, description := range referencedByCheckpoints {
+		if referenced[tarPath] {
+			continue
+		}
+		referenced[tarPath] = true
+		problem := p.verifyTar(tarPath, checksums, fmt.Sprintf("unchanged files in %s", description))
+		if problem != nil {
+			problems = append(problems, problem)
+		}
+	}
+
+	for id, description := range chunkedCheckpoints {
+		manifestPath := chunkManifestPath(id)
+		if !p.isListed(checksums, manifestPath) {
+			if requiredManifests[id] {
+				problems = append(problems, &Problem{Kind: ProblemMissing, Path: manifestPath, Description: fmt.Sprintf("Chunks for %s are not listed", description)})
+			}
+			continue
+		}
+		referenced[manifestPath] = true
+		problems = append(problems, p.verifyChunks(id, checksums, referenced, description)...)
+	}
+
+	for _, chk := range pointerCheckpoints {
+		problems = append(problems, p.verifyBlobs(chk, checksums, referenced, pointerDescriptions[chk.ID])...)
+	}
+	// Large files of checkpoints in the trash are still needed to restore
+	// them
+	if err := p.referenceTrashBlobs(referenced); err != nil {
+		return nil, err
+	}
+
+	// Indexes of tarballs are referenced by the tarballs
+	tarPaths := []string{}
+	for tarPath := range referenced {
+		tarPaths = append(tarPaths, tarPath)
+	}
+	for _, tarPath := range tarPaths {
+		referenced[repository.TarIndexPath(tarPath)] = true
+	}
+
+	for objectPath := range checksums {
+		// Objects in an inventory might have been deleted since it was
+		// made
+		if !referenced[objectPath] && (p.inventory == nil || p.objectExists(objectPath, true)) {
+			problems = append(problems, &Problem{
+				Kind:        ProblemUnreferenced,
+				Path:        objectPath,
+				Description: "Not referenced by any experiment or checkpoint",
+			})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+	return problems, nil
+}
+
+func (p *Project) verifyMetadata(metadataPath string) (*Experiment, *Problem) {
+	data, err := p.repository.Get(metadataPath)
+	if err != nil {
+		return nil, &Problem{Kind: ProblemCorrupt, Path: metadataPath, Description: fmt.Sprintf("Failed to read experiment metadata: %s", err)}
+	}
+	exp := new(Experiment)
+	if err := json.Unmarshal(data, exp); err != nil {
+		return nil, &Problem{Kind: ProblemCorrupt, Path: metadataPath, Description: fmt.Sprintf("Failed to parse experiment metadata: %s", err)}
+	}
+	if exp.MetadataPath() != metadataPath {
+		return nil, &Problem{Kind: ProblemCorrupt, Path: metadataPath, Description: fmt.Sprintf("Experiment metadata has the wrong ID: %q", exp.ID)}
+	}
+	return exp, nil
+}
+
+// verifyTar checks the tarball at tarPath exists and can be read all the way
+// through. description is what the tarball belongs to, for error messages.
+func (p *Project) verifyTar(tarPath string, checksums map[string][]byte, description string) *Problem {
+	if !p.isListed(checksums, tarPath) {
+		return &Problem{Kind: ProblemMissing, Path: tarPath, Description: fmt.Sprintf("Files for %s do not exist", description)}
+	}
+
+	reader, err := p.repository.GetReader(tarPath)
+	if err != nil {
+		return &Problem{Kind: ProblemCorrupt, Path: tarPath, Description: fmt.Sprintf("Failed to read files for %s: %s", description, err)}
+	}
+	defer reader.Close()
+
+	hash := md5.New()
+	if err := readTar(io.TeeReader(reader, hash)); err != nil {
+		return &Problem{Kind: ProblemCorrupt, Path: tarPath, Description: fmt.Sprintf("Files for %s are corrupt: %s", description, err)}
+	}
+
+	// S3 multipart uploads and GCS composite objects don't have an MD5
+	expectedMD5 := checksums[tarPath]
+	if len(expectedMD5) == md5.Size && !bytes.Equal(hash.Sum(nil), expectedMD5) {
+		return &Problem{Kind: ProblemCorrupt, Path: tarPath, Description: fmt.Sprintf("Files for %s do not match their checksum", description)}
+	}
+	return nil
+}
+
+// verifyChunks checks the chunks in the chunk manifest of the checkpoint with
+// ID id exist and match their hashes. Chunks that are already in referenced
+// have been checked, and the chunks that are checked are added to it.
+func (p *Project) verifyChunks(id string, checksums map[string][]byte, referenced map[string]bool, description string) []*Problem {
+	manifest, err := p.loadChunkManifest(id)
+	if err != nil {
+		return []*Problem{{Kind: ProblemCorrupt, Path: chunkManifestPath(id), Description: fmt.Sprintf("Failed to read chunks for %s: %s", description, err)}}
+	}
+	problems := []*Problem{}
+	for _, file := range manifest.Files {
+		for _, ref := range file.Chunks {
+			objectPath := chunkPath(ref.Hash)
+			if referenced[objectPath] {
+				continue
+			}
+			referenced[objectPath] = true
+			if !p.isListed(checksums, objectPath) {
+				problems = append(problems, &Problem{Kind: ProblemMissing, Path: objectPath, Description: fmt.Sprintf("Chunk of %s does not exist", description)})
+				continue
+			}
+			if err := p.readChunk(ref, file.Algorithm, ioutil.Discard); err != nil {
+				problems = append(problems, &Problem{Kind: ProblemCorrupt, Path: objectPath, Description: fmt.Sprintf("Chunk of %s is corrupt: %s", description, err)})
+			}
+		}
+	}
+	return problems
+}
+
+// verifyBlobs checks the large files that chk's pointer files point to exist
+// and match their hashes. Blobs that are already in referenced have been
+// checked, and the blobs that are checked are added to it.
+func (p *Project) verifyBlobs(chk *Checkpoint, checksums map[string][]byte, referenced map[string]bool, description string) []*Problem {
+	pointers, err := p.checkpointPointers(chk, "")
+	if err != nil {
+		// The tarballs the pointer files are in are checked already
+		console.Debug("Failed to read pointer files of %s: %s", description, err)
+		return nil
+	}
+	problems := []*Problem{}
+	for filePath, ptr := range pointers {
+		objectPath := blobPath(ptr.hash)
+		if referenced[objectPath] {
+			continue
+		}
+		referenced[objectPath] = true
+		if !p.isListed(checksums, objectPath) {
+			problems = append(problems, &Problem{Kind: ProblemMissing, Path: objectPath, Description: fmt.Sprintf("%s in %s does not exist", filePath, description)})
+			continue
+		}
+		if err := p.copyBlob(ptr, ioutil.Discard); err != nil {
+			problems = append(problems, &Problem{Kind: ProblemCorrupt, Path: objectPath, Description: fmt.Sprintf("%s in %s is corrupt: %s", filePath, description, err)})
+		}
+	}
+	return problems
+}
+
+// referenceTrashBlobs adds the large files of checkpoints in the trash to
+// referenced
+func (p *Project) referenceTrashBlobs(referenced map[string]bool) error {
+	entries, err := p.TrashEntries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		for _, chk := range entry.checkpoints() {
+			pointers, err := p.checkpointPointers(chk, entry.dir())
+			if err != nil {
+				console.Debug("Failed to read pointer files of checkpoint %s in the trash: %s", chk.ShortID(), err)
+				continue
+			}
+			for _, ptr := range pointers {
+				referenced[blobPath(ptr.hash)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// readTar reads a tarball to the end, returning an error if it is corrupt
+func readTar(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return err
+		}
+	}
+	// Read to the end of the gzip stream so its checksum is checked, then
+	// any trailing data so the whole object is checksummed
+	if _, err := io.Copy(ioutil.Discard, gz); err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// Quarantine moves an object into the quarantine/ directory of the
+// repository, so it is no longer read, but can be recovered by hand
+func (p *Project) Quarantine(objectPath string) error {
+	if strings.HasPrefix(objectPath, QuarantineDir+"/") {
+		return fmt.Errorf("%s is already in quarantine", objectPath)
+	}
+	if err := p.repository.Move(objectPath, path.Join(QuarantineDir, objectPath)); err != nil {
+		return err
+	}
+	p.invalidateCache()
+	p.audit(&AuditRecord{Operation: AuditQuarantine, Paths: []string{objectPath}})
+	return nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+// ArchiveStatus is the storage status of an object in a repository that can
+// move objects to archive storage classes
+type ArchiveStatus struct {
+	StorageClass string
+
+	// Archived is true if the object has to be restored before it can be read
+	Archived bool
+
+	// Restoring is true if a restore has been requested and hasn't finished
+	Restoring bool
+
+	// RestoreTime is a human-readable estimate of how long a restore takes,
+	// e.g. "3-5 hours"
+	RestoreTime string
+}
+
+// Restorer is implemented by repositories that can hold objects in archive
+// storage classes which have to be restored before they can be read, like S3
+// Glacier
+type Restorer interface {
+	// ArchiveStatus returns the storage status of the object at path
+	ArchiveStatus(path string) (*ArchiveStatus, error)
+
+	// Restore requests that the archived object at path is restored. days is
+	// how long the restored copy is kept for, if the storage class has
+	// temporary restores. It is not an error to call it while a restore is
+	// in progress.
+	Restore(path string, days int) error
+}
+
+// AsRestorer returns repo as a Restorer, if it can hold archived objects
+func AsRestorer(repo Repository) (Restorer, bool) {
+	restorer, ok := unwrap(repo).(Restorer)
+	return restorer, ok
+}
+
+// Archiver is implemented by repositories that can move objects to archive
+// storage classes, which are cheaper to keep objects in but slower or more
+// expensive to read them from
+type Archiver interface {
+	// Archive moves the object at path to storageClass, or to the
+	// repository's default archive storage class if it is empty, and
+	// returns the storage class it is in
+	Archive(path string, storageClass string) (string, error)
+}
+
+// AsArchiver returns repo as an Archiver, if it can move objects to archive
+// storage classes
+func AsArchiver(repo Repository) (Archiver, bool) {
+	archiver, ok := unwrap(repo).(Archiver)
+	return archiver, ok
+}
+
+// unwrap returns the repository that a CachedRepository,
+// SpoolingRepository, PrefetchingRepository or FaultyRepository wraps, so its
+// optional interfaces can be checked for
+func unwrap(repo Repository) Repository {
+	for {
+		switch r := repo.(type) {
+		case *CachedRepository:
+			repo = r.repository
+		case *SpoolingRepository:
+			repo = r.repository
+		case *PrefetchingRepository:
+			repo = r.repository
+		case *FaultyRepository:
+			repo = r.repository
+		default:
+			return repo
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3ArchiveStatus(t *testing.T) {
+	require.Equal(t, &ArchiveStatus{StorageClass: "STANDARD", RestoreTime: "3-5 hours"}, s3ArchiveStatus("", "", ""))
+	require.Equal(t, &ArchiveStatus{StorageClass: "GLACIER", Archived: true, RestoreTime: "3-5 hours"}, s3ArchiveStatus("GLACIER", "", ""))
+	require.Equal(t, &ArchiveStatus{StorageClass: "GLACIER", Archived: true, Restoring: true, RestoreTime: "3-5 hours"}, s3ArchiveStatus("GLACIER", "", `ongoing-request="true"`))
+	require.Equal(t, &ArchiveStatus{StorageClass: "DEEP_ARCHIVE", RestoreTime: "up to 12 hours"}, s3ArchiveStatus("DEEP_ARCHIVE", "", `ongoing-request="false", expiry-date="Fri, 23 Dec 2022 00:00:00 GMT"`))
+	require.Equal(t, &ArchiveStatus{StorageClass: "INTELLIGENT_TIERING", Archived: true, RestoreTime: "up to 12 hours"}, s3ArchiveStatus("INTELLIGENT_TIERING", "DEEP_ARCHIVE_ACCESS", ""))
+	require.Equal(t, &ArchiveStatus{StorageClass: "INTELLIGENT_TIERING", RestoreTime: "3-5 hours"}, s3ArchiveStatus("INTELLIGENT_TIERING", "", ""))
+}
+
+func TestAsRestorer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	disk, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	_, ok := AsRestorer(disk)
+	require.False(t, ok)
+
+	s3Repo, err := NewS3Repository("my-bucket", "")
+	require.NoError(t, err)
+	cached, err := NewCachedMetadataRepository(dir, s3Repo)
+	require.NoError(t, err)
+	restorer, ok := AsRestorer(cached)
+	require.True(t, ok)
+	require.Equal(t, s3Repo, restorer)
+}
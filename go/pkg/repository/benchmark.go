@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/hash"
+)
+
+// smallObjectSize is the size of the objects used to measure latency
+const smallObjectSize = 1024
+
+// BenchmarkOptions configures Benchmark
+type BenchmarkOptions struct {
+	// Concurrency is the number of transfers run at once for each round
+	Concurrency []int
+	// LargeObjectSize is the size of the objects used to measure throughput
+	LargeObjectSize int64
+	// LargeObjects is how many large objects are uploaded and downloaded in
+	// each round. If it is less than the concurrency, the concurrency is used
+	// so every worker has something to do.
+	LargeObjects int
+	// SmallObjects is how many small objects are uploaded and downloaded in
+	// each round
+	SmallObjects int
+	// Progress, if set, is called with a description of each step
+	Progress func(string)
+}
+
+// BenchmarkResult is what Benchmark measured at one level of concurrency
+type BenchmarkResult struct {
+	Concurrency int
+	// UploadThroughput and DownloadThroughput are in bytes per second
+	UploadThroughput   float64
+	DownloadThroughput float64
+	// PutLatency and GetLatency are the median time to put and get a small
+	// object
+	PutLatency time.Duration
+	GetLatency time.Duration
+	// SmallObjectsPerSecond is how many small objects were put per second
+	SmallObjectsPerSecond float64
+}
+
+// Benchmark measures the throughput and latency of a repository at each
+// level of concurrency in opts. It writes objects under a scratch folder in
+// the repository, which is deleted afterwards.
+func Benchmark(r Repository, opts BenchmarkOptions) ([]BenchmarkResult, error) {
+	if len(opts.Concurrency) == 0 {
+		return nil, fmt.Errorf("No concurrency levels to benchmark")
+	}
+	for _, c := range opts.Concurrency {
+		if c <= 0 {
+			return nil, fmt.Errorf("Concurrency must be positive, not %d", c)
+		}
+	}
+	if opts.LargeObjectSize <= 0 || opts.LargeObjects <= 0 || opts.SmallObjects <= 0 {
+		return nil, fmt.Errorf("The object size and number of objects must be positive")
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	scratch := "benchmark/" + hash.Random()[0:10]
+	defer func() {
+		progress("Cleaning up " + scratch + "...")
+		_ = r.Delete(scratch)
+	}()
+
+	large := make([]byte, opts.LargeObjectSize)
+	if _, err := rand.Read(large); err != nil {
+		return nil, err
+	}
+	small := make([]byte, smallObjectSize)
+	if _, err := rand.Read(small); err != nil {
+		return nil, err
+	}
+
+	results := []BenchmarkResult{}
+	for _, c := range opts.Concurrency {
+		result, err := benchmarkConcurrency(r, fmt.Sprintf("%s/%d", scratch, c), c, large, small, opts, progress)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func benchmarkConcurrency(r Repository, folder string, c int, large []byte, small []byte, opts BenchmarkOptions, progress func(string)) (*BenchmarkResult, error) {
+	result := &BenchmarkResult{Concurrency: c}
+
+	numLarge := opts.LargeObjects
+	if numLarge < c {
+		numLarge = c
+	}
+	largeBytes := float64(numLarge) * float64(len(large))
+
+	progress(fmt.Sprintf("Uploading %d objects with concurrency %d...", numLarge, c))
+	elapsed, _, err := runBenchmarkOps(c, numLarge, func(i int) error {
+		return r.Put(fmt.Sprintf("%s/large/%d", folder, i), large)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.UploadThroughput = largeBytes / elapsed.Seconds()
+
+	progress(fmt.Sprintf("Downloading %d objects with concurrency %d...", numLarge, c))
+	elapsed, _, err = runBenchmarkOps(c, numLarge, func(i int) error {
+		reader, err := r.GetReader(fmt.Sprintf("%s/large/%d", folder, i))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(ioutil.Discard, reader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.DownloadThroughput = largeBytes / elapsed.Seconds()
+
+	progress(fmt.Sprintf("Putting %d small objects with concurrency %d...", opts.SmallObjects, c))
+	elapsed, latencies, err := runBenchmarkOps(c, opts.SmallObjects, func(i int) error {
+		return r.Put(fmt.Sprintf("%s/small/%d", folder, i), small)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.PutLatency = medianDuration(latencies)
+	result.SmallObjectsPerSecond = float64(opts.SmallObjects) / elapsed.Seconds()
+
+	progress(fmt.Sprintf("Getting %d small objects with concurrency %d...", opts.SmallObjects, c))
+	_, latencies, err = runBenchmarkOps(c, opts.SmallObjects, func(i int) error {
+		_, err := r.Get(fmt.Sprintf("%s/small/%d", folder, i))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.GetLatency = medianDuration(latencies)
+
+	return result, nil
+}
+
+// runBenchmarkOps runs op n times, c at a time, and returns how long it took
+// altogether and how long each op took
+func runBenchmarkOps(c int, n int, op func(i int) error) (time.Duration, []time.Duration, error) {
+	latencies := make([]time.Duration, n)
+	var mu sync.Mutex
+	queue := concurrency.NewWorkerQueue(context.Background(), c)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		i := i
+		err := queue.Go(func() error {
+			opStart := time.Now()
+			if err := op(i); err != nil {
+				return err
+			}
+			mu.Lock()
+			latencies[i] = time.Since(opStart)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := queue.Wait(); err != nil {
+		return 0, nil, err
+	}
+	elapsed := time.Since(start)
+	// Guard against dividing by zero on clocks with coarse resolution
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return elapsed, latencies, nil
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
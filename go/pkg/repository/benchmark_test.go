@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	steps := []string{}
+	results, err := Benchmark(repository, BenchmarkOptions{
+		Concurrency:     []int{1, 4},
+		LargeObjectSize: 64 * 1024,
+		LargeObjects:    2,
+		SmallObjects:    5,
+		Progress:        func(s string) { steps = append(steps, s) },
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for i, concurrency := range []int{1, 4} {
+		require.Equal(t, concurrency, results[i].Concurrency)
+		require.True(t, results[i].UploadThroughput > 0)
+		require.True(t, results[i].DownloadThroughput > 0)
+		require.True(t, results[i].SmallObjectsPerSecond > 0)
+	}
+	require.Contains(t, steps, "Uploading 4 objects with concurrency 4...")
+
+	// Everything it wrote is cleaned up
+	paths, err := repository.List("benchmark")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	_, err = Benchmark(repository, BenchmarkOptions{Concurrency: []int{0}, LargeObjectSize: 1, LargeObjects: 1, SmallObjects: 1})
+	require.EqualError(t, err, "Concurrency must be positive, not 0")
+}
@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
 )
 
 // CachedRepository wraps another repository, caching a prefix in a local directory.
@@ -49,6 +53,20 @@ func (s *CachedRepository) Get(p string) ([]byte, error) {
 	return s.repository.Get(p)
 }
 
+func (s *CachedRepository) GetReader(p string) (io.ReadCloser, error) {
+	if strings.HasPrefix(p, s.cachePrefix) {
+		return s.cacheRepository.GetReader(p)
+	}
+	return s.repository.GetReader(p)
+}
+
+func (s *CachedRepository) GetRangeReader(p string, offset, length int64) (io.ReadCloser, error) {
+	if strings.HasPrefix(p, s.cachePrefix) {
+		return s.cacheRepository.GetRangeReader(p, offset, length)
+	}
+	return s.repository.GetRangeReader(p, offset, length)
+}
+
 func (s *CachedRepository) Put(p string, data []byte) error {
 	// FIXME: potential for cache and remote to get out of sync on error
 	if strings.HasPrefix(p, s.cachePrefix) {
@@ -115,20 +133,20 @@ func (s *CachedRepository) ListTarFile(p string) ([]string, error) {
 	return s.repository.ListTarFile(p)
 }
 
-func (s *CachedRepository) ListRecursive(results chan<- ListResult, path string) {
+func (s *CachedRepository) ListRecursive(ctx context.Context, results chan<- ListResult, path string) {
 	if strings.HasPrefix(path, s.cachePrefix) {
-		s.cacheRepository.ListRecursive(results, path)
+		s.cacheRepository.ListRecursive(ctx, results, path)
 		return
 	}
-	s.repository.ListRecursive(results, path)
+	s.repository.ListRecursive(ctx, results, path)
 }
 
-func (s *CachedRepository) MatchFilenamesRecursive(results chan<- ListResult, path string, filename string) {
+func (s *CachedRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, path string, filename string) {
 	if strings.HasPrefix(path, s.cachePrefix) {
-		s.cacheRepository.MatchFilenamesRecursive(results, path, filename)
+		s.cacheRepository.MatchFilenamesRecursive(ctx, results, path, filename)
 		return
 	}
-	s.repository.MatchFilenamesRecursive(results, path, filename)
+	s.repository.MatchFilenamesRecursive(ctx, results, path, filename)
 }
 
 func (s *CachedRepository) Delete(p string) error {
@@ -140,11 +158,53 @@ func (s *CachedRepository) Delete(p string) error {
 	return s.repository.Delete(p)
 }
 
+func (s *CachedRepository) Copy(src, dest string) error {
+	if err := s.repository.Copy(src, dest); err != nil {
+		return err
+	}
+	return s.cacheCopy(src, dest)
+}
+
+func (s *CachedRepository) Move(src, dest string) error {
+	if err := s.repository.Move(src, dest); err != nil {
+		return err
+	}
+	if err := s.cacheCopy(src, dest); err != nil {
+		return err
+	}
+	if strings.HasPrefix(src, s.cachePrefix) {
+		return s.cacheRepository.Delete(src)
+	}
+	return nil
+}
+
+// cacheCopy puts dest in the cache after src has been copied to it in the
+// repository, if dest is cached
+func (s *CachedRepository) cacheCopy(src, dest string) error {
+	if !strings.HasPrefix(dest, s.cachePrefix) {
+		return nil
+	}
+	if strings.HasPrefix(src, s.cachePrefix) {
+		return s.cacheRepository.Copy(src, dest)
+	}
+	data, err := s.repository.Get(dest)
+	if err != nil {
+		return err
+	}
+	return s.cacheRepository.Put(dest, data)
+}
+
 func (s *CachedRepository) RootURL() string {
 	return s.repository.RootURL()
 }
 
 func (s *CachedRepository) SyncCache() error {
+	// Other commands in the same project sync the same cache
+	lock, err := files.LockDir(s.cacheDir)
+	if err != nil {
+		return fmt.Errorf("Failed to lock %s: %w", s.cacheDir, err)
+	}
+	defer lock.Unlock()
 	console.Debug("Syncing %s/%s to %s/%s", s.repository.RootURL(), s.cachePrefix, s.cacheRepository.RootURL(), s.cachePrefix)
 	return Sync(s.repository, s.cachePrefix, s.cacheRepository, s.cachePrefix)
 }
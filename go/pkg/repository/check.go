@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/hash"
+)
+
+// StorageCheck is the result of one of the operations CheckStorage tries
+type StorageCheck struct {
+	// Operation is what was tried, e.g. "write"
+	Operation string
+	// Duration is how long it took
+	Duration time.Duration
+	// Bytes is how much data was transferred, or 0 if it doesn't transfer
+	// any
+	Bytes int64
+	// Error is why it failed, or nil if it succeeded
+	Error error
+}
+
+// Throughput returns the bytes per second transferred, or 0 if it doesn't
+// transfer any
+func (c *StorageCheck) Throughput() float64 {
+	if c.Bytes == 0 || c.Duration <= 0 {
+		return 0
+	}
+	return float64(c.Bytes) / c.Duration.Seconds()
+}
+
+// CheckStorage writes, reads, lists and deletes objects in a scratch folder in
+// the repository, to check that the credentials allow everything Replicate
+// does, and to measure how long each operation takes. size is the size of the
+// object used to measure throughput. Every operation is tried, even if earlier
+// ones fail, and the scratch folder is always deleted afterwards.
+func CheckStorage(r Repository, size int64) ([]*StorageCheck, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("The object size must be positive")
+	}
+	small := make([]byte, smallObjectSize)
+	if _, err := rand.Read(small); err != nil {
+		return nil, err
+	}
+	large := make([]byte, size)
+	if _, err := rand.Read(large); err != nil {
+		return nil, err
+	}
+
+	scratch := "check-storage/" + hash.Random()[0:10]
+	smallPath := scratch + "/small"
+	largePath := scratch + "/large"
+	defer func() {
+		_ = r.Delete(scratch)
+	}()
+
+	checks := []*StorageCheck{}
+	try := func(operation string, transferred int64, fn func() error) {
+		start := time.Now()
+		err := fn()
+		check := &StorageCheck{Operation: operation, Duration: time.Since(start), Error: err}
+		if err == nil {
+			check.Bytes = transferred
+		}
+		checks = append(checks, check)
+	}
+
+	try("write", 0, func() error {
+		return r.Put(smallPath, small)
+	})
+	try("upload", size, func() error {
+		return r.Put(largePath, large)
+	})
+	try("read", 0, func() error {
+		return checkStorageRead(r, smallPath, small)
+	})
+	try("download", size, func() error {
+		return checkStorageRead(r, largePath, large)
+	})
+	try("list", 0, func() error {
+		results, err := ListRecursiveAll(context.Background(), r, scratch)
+		if err != nil {
+			return err
+		}
+		if len(results) != 2 {
+			return fmt.Errorf("Listed %d objects in %s/%s, but expected 2", len(results), r.RootURL(), scratch)
+		}
+		return nil
+	})
+	try("delete", 0, func() error {
+		if err := r.Delete(smallPath); err != nil {
+			return err
+		}
+		if _, err := r.Get(smallPath); !errors.IsDoesNotExist(err) {
+			return fmt.Errorf("%s/%s still exists after deleting it", r.RootURL(), smallPath)
+		}
+		return nil
+	})
+	return checks, nil
+}
+
+// checkStorageRead reads the object at path and checks it is what was written
+func checkStorageRead(r Repository, path string, expected []byte) error {
+	reader, err := r.GetReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, expected) {
+		return fmt.Errorf("%s/%s is different to what was written", r.RootURL(), path)
+	}
+	return nil
+}
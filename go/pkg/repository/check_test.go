@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// noDeleteRepository is a repository that the credentials can't delete from
+type noDeleteRepository struct {
+	Repository
+}
+
+func (r *noDeleteRepository) Delete(path string) error {
+	return errors.RepositoryCredentialsError("Access denied")
+}
+
+func TestCheckStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	checks, err := CheckStorage(repository, 64*1024)
+	require.NoError(t, err)
+	operations := []string{}
+	for _, check := range checks {
+		require.NoError(t, check.Error, check.Operation)
+		operations = append(operations, check.Operation)
+	}
+	require.Equal(t, []string{"write", "upload", "read", "download", "list", "delete"}, operations)
+	require.Equal(t, int64(64*1024), checks[1].Bytes)
+	require.True(t, checks[1].Throughput() > 0)
+	require.Equal(t, float64(0), checks[0].Throughput())
+
+	// Everything it wrote is cleaned up
+	paths, err := repository.List("check-storage")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	checks, err = CheckStorage(&noDeleteRepository{repository}, 1024)
+	require.NoError(t, err)
+	require.Equal(t, "delete", checks[5].Operation)
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(checks[5].Error))
+	for _, check := range checks[:5] {
+		require.NoError(t, check.Error, check.Operation)
+	}
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Errors from disk, S3 and GCS are wrapped in an error with the class of the
+// problem (errors.ErrNotFound, errors.ErrPermissionDenied,
+// errors.ErrQuotaExceeded or errors.ErrTransient) if it has one, or a read or
+// write error if it doesn't. The underlying error is kept, so it can still be
+// inspected with errors.As.
+
+// readError returns an error with msg for a read that failed with err
+func readError(err error, msg string) error {
+	return classifiedError(errors.CodeReadError, err, msg)
+}
+
+// writeError returns an error with msg for a write that failed with err
+func writeError(err error, msg string) error {
+	return classifiedError(errors.CodeWriteError, err, msg)
+}
+
+// listError returns an error with msg for a listing that failed with err. A
+// file that disappears while a folder is being listed isn't the folder not
+// existing, so it is a read error.
+func listError(err error, msg string) error {
+	if errorClass(err) == errors.CodeDoesNotExist {
+		return errors.Wrap(errors.CodeReadError, msg, err)
+	}
+	return readError(err, msg)
+}
+
+func classifiedError(code string, err error, msg string) error {
+	if class := errorClass(err); class != "" {
+		code = class
+	}
+	return errors.Wrap(code, msg, err)
+}
+
+// errorClass returns the code of the class of storage error err is, or an
+// empty string if it isn't one
+func errorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	switch errors.Code(err) {
+	case errors.CodeDoesNotExist, errors.CodePermissionDenied, errors.CodeQuotaExceeded, errors.CodeTransient:
+		return errors.Code(err)
+	}
+
+	// Disk
+	switch {
+	case os.IsNotExist(err):
+		return errors.CodeDoesNotExist
+	case os.IsPermission(err):
+		return errors.CodePermissionDenied
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return errors.CodeQuotaExceeded
+	}
+
+	// S3
+	if class := s3ErrorClass(err); class != "" {
+		return class
+	}
+
+	// GCS
+	if err == storage.ErrObjectNotExist || err == storage.ErrBucketNotExist {
+		return errors.CodeDoesNotExist
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		for _, item := range gerr.Errors {
+			if item.Reason == "quotaExceeded" {
+				return errors.CodeQuotaExceeded
+			}
+		}
+		if class := httpStatusClass(gerr.Code); class != "" {
+			return class
+		}
+	}
+
+	// Networks
+	if errors.Is(err, io.ErrUnexpectedEOF) || IsUnreachable(err) {
+		return errors.CodeTransient
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Temporary() {
+		return errors.CodeTransient
+	}
+	return ""
+}
+
+// s3ErrorClass returns the class of an error from the AWS SDK, which doesn't
+// support errors.As
+func s3ErrorClass(err error) string {
+	if _, ok := err.(awserr.Error); !ok {
+		return ""
+	}
+	switch awsErrorCode(err) {
+	case "NoSuchKey", "NoSuchBucket", "NoSuchUpload", "NotFound":
+		return errors.CodeDoesNotExist
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return errors.CodePermissionDenied
+	case "QuotaExceeded", "ServiceQuotaExceededException":
+		return errors.CodeQuotaExceeded
+	case "RequestTimeout", "RequestTimeTooSkewed", "InternalError", "ServiceUnavailable":
+		return errors.CodeTransient
+	}
+	if s3Throttled(err) || request.IsErrorRetryable(err) {
+		return errors.CodeTransient
+	}
+	for e := err; e != nil; {
+		if rerr, ok := e.(awserr.RequestFailure); ok {
+			return httpStatusClass(rerr.StatusCode())
+		}
+		aerr, ok := e.(awserr.Error)
+		if !ok {
+			break
+		}
+		e = aerr.OrigErr()
+	}
+	return ""
+}
+
+// httpStatusClass returns the class of an HTTP error response with status
+func httpStatusClass(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return errors.CodeDoesNotExist
+	case status == http.StatusForbidden:
+		return errors.CodePermissionDenied
+	case status == http.StatusTooManyRequests, status == http.StatusRequestTimeout, status >= 500:
+		return errors.CodeTransient
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+func TestErrorClass(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		expected error
+	}{
+		{&os.PathError{Op: "open", Path: "foo", Err: syscall.ENOENT}, errors.ErrNotFound},
+		{&os.PathError{Op: "open", Path: "foo", Err: syscall.EACCES}, errors.ErrPermissionDenied},
+		{&os.PathError{Op: "write", Path: "foo", Err: syscall.ENOSPC}, errors.ErrQuotaExceeded},
+		{awserr.NewRequestFailure(awserr.New("NoSuchKey", "The specified key does not exist.", nil), 404, "1"), errors.ErrNotFound},
+		{awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "1"), errors.ErrPermissionDenied},
+		{awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "1"), errors.ErrTransient},
+		{awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error.", nil), 500, "1"), errors.ErrTransient},
+		{storage.ErrObjectNotExist, errors.ErrNotFound},
+		{&googleapi.Error{Code: 403, Message: "Forbidden"}, errors.ErrPermissionDenied},
+		{&googleapi.Error{Code: 429, Message: "Too many requests"}, errors.ErrTransient},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}, errors.ErrQuotaExceeded},
+		{fmt.Errorf("Failed to read: %w", io.ErrUnexpectedEOF), errors.ErrTransient},
+		{fmt.Errorf("dial tcp: lookup bucket.s3.amazonaws.com: no such host"), errors.ErrTransient},
+		{&InjectedFault{Operation: "PUT", Key: "foo"}, errors.ErrTransient},
+	} {
+		err := readError(tt.err, "Failed to read foo")
+		require.True(t, errors.Is(err, tt.expected), "%v should be %v, not %s", tt.err, tt.expected, errors.Code(err))
+		require.Equal(t, "Failed to read foo", err.Error())
+		require.Equal(t, tt.err, errors.Unwrap(err))
+	}
+
+	// Anything else is a read or write error
+	err := readError(fmt.Errorf("oh no"), "Failed to read foo")
+	require.Equal(t, errors.CodeReadError, errors.Code(err))
+	err = writeError(fmt.Errorf("oh no"), "Failed to write foo")
+	require.Equal(t, errors.CodeWriteError, errors.Code(err))
+	for _, class := range []error{errors.ErrNotFound, errors.ErrPermissionDenied, errors.ErrQuotaExceeded, errors.ErrTransient} {
+		require.False(t, errors.Is(err, class))
+	}
+
+	// Files going missing while listing aren't folders not existing
+	err = listError(&os.PathError{Op: "open", Path: "foo", Err: syscall.ENOENT}, "Failed to list foo")
+	require.Equal(t, errors.CodeReadError, errors.Code(err))
+}
+
+func TestErrorClassesAcrossRepositories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	disk, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	fake, closeServer := newFakeS3Repository(t, newFakeS3(0), "root")
+	defer closeServer()
+
+	for _, repo := range []Repository{disk, fake} {
+		_, err = repo.Get("nonexistent")
+		require.True(t, errors.Is(err, errors.ErrNotFound), "%s: %v", repo.RootURL(), err)
+		_, err = repo.GetReader("nonexistent")
+		require.True(t, errors.Is(err, errors.ErrNotFound), "%s: %v", repo.RootURL(), err)
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("Can't make a directory unwritable")
+	}
+	require.NoError(t, disk.Put("readonly/foo", []byte("foo")))
+	require.NoError(t, os.Chmod(filepath.Join(dir, "readonly"), 0555))
+	defer os.Chmod(filepath.Join(dir, "readonly"), 0755)
+	err = disk.Put("readonly/bar", []byte("bar"))
+	require.True(t, errors.Is(err, errors.ErrPermissionDenied), err)
+	require.Contains(t, errors.Remediation(err), "allowed to read and write")
+}
@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Creating S3 sessions and GCS clients is not free: each one gets its own HTTP
+// transport, so a new one per operation throws away warmed TLS sessions and
+// keep-alive connections. These are cached for the lifetime of the process so
+// that sequential operations within a command share connections.
+var (
+	clientsMu     sync.Mutex
+	s3Sessions    = make(map[string]*session.Session)
+	s3Credentials = make(map[string]*credentials.Credentials)
+	gcsClients    = make(map[string]*storage.Client)
+)
+
+// Environment variables for networks with TLS-intercepting proxies. The proxy
+// itself is set with HTTPS_PROXY and NO_PROXY, which the transport reads. They
+// take precedence over the network settings in replicate.yaml.
+const (
+	caBundleEnvVar           = "REPLICATE_CA_BUNDLE"
+	insecureSkipVerifyEnvVar = "REPLICATE_INSECURE_SKIP_TLS_VERIFY"
+)
+
+var (
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+	httpClientErr  error
+)
+
+// getHTTPClient returns the HTTP client shared by all S3 sessions and GCS
+// clients. The default transport only keeps two idle connections per host,
+// which means most connections get thrown away when maxWorkers uploads are
+// running at the same time.
+func getHTTPClient() (*http.Client, error) {
+	httpClientOnce.Do(func() {
+		var transport http.RoundTripper
+		transport, httpClientErr = newTransport()
+		if httpClientErr != nil {
+			return
+		}
+		var faults *Faults
+		faults, httpClientErr = faultsFromEnv()
+		if httpClientErr != nil {
+			return
+		}
+		if faults != nil {
+			console.Warn("Simulating network failures of requests to S3 and Google Cloud Storage, because $%s is set", FaultsEnvVar)
+			transport = NewFaultyTransport(transport, *faults)
+		}
+		httpClient = &http.Client{Transport: &metricsTransport{transport: transport}}
+	})
+	return httpClient, httpClientErr
+}
+
+func newTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxWorkers
+	transport.MaxIdleConnsPerHost = maxWorkers
+	n := currentNetwork()
+	tlsConfig, err := tlsConfigFromEnv(n.CABundle)
+	if err != nil {
+		return nil, errors.RepositoryConfigurationError(err.Error())
+	}
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy, err = proxyFunc(n.Proxy)
+	if err != nil {
+		return nil, errors.RepositoryConfigurationError(err.Error())
+	}
+	t := currentTimeouts()
+	if t.Connect > 0 {
+		dialer := &net.Dialer{Timeout: t.Connect, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = t.Connect
+	}
+	if t.Request > 0 {
+		transport.ResponseHeaderTimeout = t.Request
+	}
+	return transport, nil
+}
+
+// tlsConfigFromEnv returns the TLS settings in the environment, using
+// caBundlePath if the environment doesn't set a CA bundle. The CA bundle is
+// trusted as well as the system's certificates, so hosts the proxy doesn't
+// intercept keep working.
+func tlsConfigFromEnv(caBundlePath string) (*tls.Config, error) {
+	conf := &tls.Config{}
+	caBundleSource := "'ca_bundle' in 'network'"
+	if path := os.Getenv(caBundleEnvVar); path != "" {
+		caBundlePath, caBundleSource = path, caBundleEnvVar
+	}
+	if caBundlePath != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := ioutil.ReadFile(caBundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the CA bundle in %s: %w", caBundleSource, err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("The CA bundle in %s (%s) doesn't have any PEM-encoded certificates", caBundleSource, caBundlePath)
+		}
+		conf.RootCAs = pool
+	}
+	if value := os.Getenv(insecureSkipVerifyEnvVar); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", insecureSkipVerifyEnvVar)
+		}
+		if insecure {
+			console.Warn("%s is set, so TLS certificates aren't checked. Anyone on your network could read or change your data.", insecureSkipVerifyEnvVar)
+			conf.InsecureSkipVerify = true
+		}
+	}
+	return conf, nil
+}
+
+// canPromptForMFA is whether the user can be asked for MFA codes on the
+// terminal. See DisableMFAPrompt.
+var canPromptForMFA = true
+
+// DisableMFAPrompt makes repositories that assume roles with MFA fail with an
+// error, instead of asking for a code on the terminal. It is called in the
+// daemon, whose stdin belongs to the Python process that started it, so
+// nobody would see the prompt.
+func DisableMFAPrompt() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	canPromptForMFA = false
+}
+
+// getS3Session returns a session for region, reusing an existing one if the
+// credentials in the environment haven't changed. If opts has a role, the
+// session uses credentials for that role.
+func getS3Session(region string, opts S3Options) (*session.Session, error) {
+	// Roles are assumed with STS, so its endpoint is part of the key too
+	credentialsKey := awsEnvironment() + "|" + opts.RoleARN + "|" + opts.ExternalID + "|" + opts.MFASerial + "|" + strconv.FormatBool(opts.Anonymous) + "|" + opts.Region + "|" + strconv.FormatBool(opts.FIPS)
+	// Credential helpers can give out different credentials for each bucket
+	helper := ""
+	if !opts.Anonymous {
+		helper = credentialHelper(opts.CredentialHelper)
+	}
+	if helper != "" {
+		credentialsKey += "|" + helper + "|" + opts.bucket
+	}
+	// The key has secrets in it, so only its hash is kept
+	sum := sha256.Sum256([]byte(credentialsKey))
+	credentialsKey = hex.EncodeToString(sum[:])
+	key := region + "|" + opts.Endpoint + "|" + credentialsKey
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if opts.MFASerial != "" && !canPromptForMFA {
+		return nil, errors.RepositoryConfigurationError(`The repository URL has mfa_serial, which can't be used from the Python library, because there isn't a terminal to ask for the MFA code on.
+
+Assume the role before you start the experiment, and put its credentials in the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, or get them from a credential helper with credential_helper. Then remove role_arn and mfa_serial from the repository URL.`)
+	}
+	if sess, ok := s3Sessions[key]; ok {
+		return sess, nil
+	}
+	client, err := getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	conf := &aws.Config{
+		CredentialsChainVerboseErrors: aws.Bool(true),
+		HTTPClient:                    client,
+	}
+	// Leave region unset when it isn't known yet so it is picked up from the environment
+	if region == "" {
+		region = opts.Region
+	}
+	if region != "" {
+		conf.Region = aws.String(region)
+	}
+	if opts.Region != "" {
+		// The global endpoints might not be reachable, e.g. in a VPC without
+		// internet access, so only use the region's own endpoints
+		conf.STSRegionalEndpoint = endpoints.RegionalSTSEndpoint
+		conf.S3UsEast1RegionalEndpoint = endpoints.RegionalS3UsEast1Endpoint
+	}
+	if opts.Endpoint != "" || opts.FIPS {
+		conf.EndpointResolver = s3EndpointResolver(opts)
+	}
+	if opts.Anonymous {
+		// Requests with these credentials aren't signed
+		conf.Credentials = credentials.AnonymousCredentials
+	} else if helper != "" {
+		helperKey := "helper|" + helper + "|" + opts.bucket
+		creds, ok := s3Credentials[helperKey]
+		if !ok {
+			creds = credentials.NewCredentials(&credentialHelperProvider{helper: helper, bucket: opts.bucket})
+			s3Credentials[helperKey] = creds
+		}
+		conf.Credentials = creds
+	} else if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		// Keys in the environment take precedence over the profile, like
+		// they do in the SDK's default credential chain
+		profile, err := loadSSOProfile()
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			ssoKey := "sso|" + profile.name
+			creds, ok := s3Credentials[ssoKey]
+			if !ok {
+				creds = credentials.NewCredentials(&ssoProvider{profile: profile})
+				s3Credentials[ssoKey] = creds
+			}
+			conf.Credentials = creds
+		}
+	}
+	sess, err := session.NewSession(conf)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RoleARN != "" {
+		// Sessions for each region share credentials, so the role is only
+		// assumed (and the MFA code asked for) once
+		creds, ok := s3Credentials[credentialsKey]
+		if !ok {
+			creds = assumeRoleCredentials(sess, opts)
+			s3Credentials[credentialsKey] = creds
+		}
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+	s3Sessions[key] = sess
+	return sess, nil
+}
+
+// awsEnvironmentVariables are the environment variables that the AWS SDK
+// reads credentials, and where to find them, from
+var awsEnvironmentVariables = []string{
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_ACCESS_KEY",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SECRET_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_CONFIG_FILE",
+	"AWS_SDK_LOAD_CONFIG",
+	"AWS_ROLE_ARN",
+	"AWS_ROLE_SESSION_NAME",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+}
+
+// awsEnvironment returns the values of awsEnvironmentVariables, so a session
+// is only reused while all of them are the same, and e.g. a new session token
+// for the same access key gets a new session
+func awsEnvironment() string {
+	values := make([]string, len(awsEnvironmentVariables))
+	for i, name := range awsEnvironmentVariables {
+		values[i] = name + "=" + os.Getenv(name)
+	}
+	return strings.Join(values, "|")
+}
+
+// s3EndpointResolver resolves the S3 endpoint to the endpoint in opts, or S3
+// and STS to their FIPS endpoints. Other services use the default endpoints.
+func s3EndpointResolver(opts S3Options) endpoints.Resolver {
+	return endpoints.ResolverFunc(func(service, region string, optFns ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+		resolved, err := endpoints.DefaultResolver().EndpointFor(service, region, optFns...)
+		if err != nil {
+			return resolved, err
+		}
+		switch {
+		case opts.Endpoint != "" && service == endpoints.S3ServiceID:
+			resolved.URL = opts.Endpoint
+		case opts.FIPS && (service == endpoints.S3ServiceID || service == endpoints.StsServiceID):
+			resolved.URL = fmt.Sprintf("https://%s-fips.%s.amazonaws.com", service, region)
+		}
+		return resolved, nil
+	})
+}
+
+// assumeRoleCredentials returns credentials for the role in opts, which are
+// fetched from STS using the credentials of sess and refreshed when they expire
+func assumeRoleCredentials(sess *session.Session, opts S3Options) *credentials.Credentials {
+	// STS needs a region, but the bucket's region isn't known yet the first
+	// time credentials are needed
+	stsSess := sess
+	if aws.StringValue(sess.Config.Region) == "" {
+		stsSess = sess.Copy(&aws.Config{Region: aws.String("us-east-1")})
+	}
+	return stscreds.NewCredentials(stsSess, opts.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = "replicate"
+		if opts.ExternalID != "" {
+			p.ExternalID = aws.String(opts.ExternalID)
+		}
+		if opts.MFASerial != "" {
+			p.SerialNumber = aws.String(opts.MFASerial)
+			p.TokenProvider = mfaTokenProvider
+		}
+	})
+}
+
+// mfaTokenProvider asks for an MFA code on the terminal, and fails instead of
+// waiting forever if there isn't one, e.g. in CI
+func mfaTokenProvider() (string, error) {
+	if !console.IsTerminal() {
+		return "", fmt.Errorf("The role requires an MFA code, but there isn't a terminal to ask for it on. Run the command in a terminal, or assume the role before you run it and remove role_arn and mfa_serial from the repository URL.")
+	}
+	return stscreds.StdinTokenProvider()
+}
+
+// getGCSClient returns a Google Cloud Storage client, reusing an existing one if
+// the credentials in the environment haven't changed
+func getGCSClient(opts GCSOptions) (*storage.Client, error) {
+	credentialsKey := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON") + "|" + os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") + "|" + opts.ImpersonateServiceAccount + "|" + strconv.FormatBool(opts.Anonymous)
+	if helper := credentialHelper(opts.CredentialHelper); helper != "" && !opts.Anonymous {
+		credentialsKey += "|" + helper + "|" + opts.bucket
+	}
+	sum := sha256.Sum256([]byte(credentialsKey))
+	key := hex.EncodeToString(sum[:])
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := gcsClients[key]; ok {
+		return client, nil
+	}
+	httpClient, err := getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	// Tokens are fetched with the shared client too, so they go through the
+	// same proxy and trust the same CAs
+	ctx := context.WithValue(context.TODO(), oauth2.HTTPClient, httpClient)
+	transport := httpClient.Transport
+	if !opts.Anonymous {
+		tokenSource, err := gcsTokenSource(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		transport = &oauth2.Transport{Source: tokenSource, Base: transport}
+	}
+	client, err := storage.NewClient(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, err
+	}
+	gcsClients[key] = client
+	return client, nil
+}
@@ -0,0 +1,33 @@
+package repository_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/repository"
+	"github.com/replicate/replicate/go/pkg/repository/storagetest"
+)
+
+// S3 and Google Cloud Storage are in-process fakes, so these don't need
+// credentials. The real services are tested with -tags=external.
+
+func TestDiskConformance(t *testing.T) {
+	storagetest.TestConformance(t, func(t *testing.T) (repository.Repository, func()) {
+		dir, err := ioutil.TempDir("", "replicate-test")
+		require.NoError(t, err)
+		r, err := repository.NewDiskRepository(dir)
+		require.NoError(t, err)
+		return r, func() { os.RemoveAll(dir) }
+	})
+}
+
+func TestS3Conformance(t *testing.T) {
+	storagetest.TestConformance(t, repository.NewFakeS3Repository)
+}
+
+func TestGCSConformance(t *testing.T) {
+	storagetest.TestConformance(t, repository.NewFakeGCSRepository)
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/oauth2"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Credential helpers are programs that print short-lived credentials, so
+// organizations with their own way of handing them out (a vault, an OIDC
+// login, ...) can plug it in without Replicate knowing about it. Like Docker's
+// credential helpers, a helper called "vault" is the program
+// replicate-credential-vault on the PATH. It is run with the argument "get",
+// and the request on stdin:
+//
+//     {"Version": 1, "Service": "s3", "Bucket": "bucket"}
+//
+// Service is "s3" or "gcs". For S3, it prints credentials in the same format
+// as AWS's credential_process:
+//
+//     {"Version": 1, "AccessKeyId": "...", "SecretAccessKey": "...", "SessionToken": "...", "Expiration": "2020-01-01T00:00:00Z"}
+//
+// Or an OAuth2 access token for Google Cloud Storage:
+//
+//     {"Version": 1, "AccessToken": "...", "Expiration": "2020-01-01T00:00:00Z"}
+//
+// The helper is run again when the credentials expire. Credentials without an
+// expiration are used for as long as the process runs.
+
+// CredentialHelperEnvVar is the credential helper for S3 and GCS repositories
+// that don't set one with credential_helper in their URL
+const CredentialHelperEnvVar = "REPLICATE_CREDENTIAL_HELPER"
+
+// credentialHelperPrefix is put before the names of credential helpers to
+// get the program to run
+const credentialHelperPrefix = "replicate-credential-"
+
+// credentialHelperTimeout is how long a credential helper can take. It is
+// long enough for helpers that ask the user to log in in a browser.
+const credentialHelperTimeout = 2 * time.Minute
+
+// errCodeCredentialHelper is the code of errors from credential helpers, so
+// s3CredentialsError can recognize them
+const errCodeCredentialHelper = "CredentialHelperError"
+
+type credentialHelperRequest struct {
+	Version int    `json:"Version"`
+	Service string `json:"Service"`
+	Bucket  string `json:"Bucket"`
+}
+
+type credentialHelperResponse struct {
+	Version         int        `json:"Version"`
+	AccessKeyID     string     `json:"AccessKeyId"`
+	SecretAccessKey string     `json:"SecretAccessKey"`
+	SessionToken    string     `json:"SessionToken"`
+	AccessToken     string     `json:"AccessToken"`
+	Expiration      *time.Time `json:"Expiration"`
+}
+
+// credentialHelperError is returned when a credential helper can't be run or
+// doesn't print credentials
+type credentialHelperError struct {
+	helper string
+	msg    string
+}
+
+func (e *credentialHelperError) Error() string {
+	return fmt.Sprintf("The credential helper %q failed: %s", e.helper, e.msg)
+}
+
+// credentialHelper returns the credential helper for a repository with
+// option set to the credential_helper in its URL
+func credentialHelper(option string) string {
+	if option != "" {
+		return option
+	}
+	return os.Getenv(CredentialHelperEnvVar)
+}
+
+// credentialHelperProgram returns the path of the program for helper, which
+// is either a name or the path to a program
+func credentialHelperProgram(helper string) (string, error) {
+	if strings.ContainsAny(helper, `/\`) {
+		return helper, nil
+	}
+	path, err := exec.LookPath(credentialHelperPrefix + helper)
+	if err != nil {
+		return "", &credentialHelperError{helper: helper, msg: fmt.Sprintf("%s isn't on your PATH", credentialHelperPrefix+helper)}
+	}
+	return path, nil
+}
+
+// runCredentialHelper runs helper to get credentials for bucket, in service
+func runCredentialHelper(helper string, service string, bucket string) (*credentialHelperResponse, error) {
+	program, err := credentialHelperProgram(helper)
+	if err != nil {
+		return nil, err
+	}
+	request, err := json.Marshal(credentialHelperRequest{Version: 1, Service: service, Bucket: bucket})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, program, "get")
+	cmd.Stdin = bytes.NewReader(request)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, &credentialHelperError{helper: helper, msg: fmt.Sprintf("it took longer than %s", credentialHelperTimeout)}
+		}
+		msg := err.Error()
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			msg += ": " + output
+		}
+		return nil, &credentialHelperError{helper: helper, msg: msg}
+	}
+
+	response := new(credentialHelperResponse)
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return nil, &credentialHelperError{helper: helper, msg: fmt.Sprintf("it didn't print credentials as JSON: %s", err)}
+	}
+	if response.Version != 1 {
+		return nil, &credentialHelperError{helper: helper, msg: fmt.Sprintf("it printed credentials with version %d, but only version 1 is supported", response.Version)}
+	}
+	if response.Expiration != nil && time.Now().After(*response.Expiration) {
+		return nil, &credentialHelperError{helper: helper, msg: fmt.Sprintf("it printed credentials that expired at %s", response.Expiration.Format(time.RFC3339))}
+	}
+	return response, nil
+}
+
+// asCredentialHelperError returns the credentialHelperError err was caused
+// by, or nil if it wasn't. Errors from the AWS SDK are looked through too.
+func asCredentialHelperError(err error) *credentialHelperError {
+	for err != nil {
+		var herr *credentialHelperError
+		if errors.As(err, &herr) {
+			return herr
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return nil
+		}
+		err = aerr.OrigErr()
+	}
+	return nil
+}
+
+// credentialHelperRepositoryError returns the error for a credential helper
+// failing to get credentials for url
+func credentialHelperRepositoryError(herr *credentialHelperError, url string) error {
+	return errors.RepositoryCredentialsError(fmt.Sprintf(`%s, so %s can't be accessed.
+
+Credential helpers are set with credential_helper in the repository URL, or $%s. Check that %s%s is installed and that you are logged in to whatever it gets credentials from.`, herr, url, CredentialHelperEnvVar, credentialHelperPrefix, herr.helper))
+}
+
+// credentialHelperProvider is a credentials.Provider that runs a credential
+// helper
+type credentialHelperProvider struct {
+	credentials.Expiry
+	helper string
+	bucket string
+}
+
+func (p *credentialHelperProvider) Retrieve() (credentials.Value, error) {
+	response, err := runCredentialHelper(p.helper, "s3", p.bucket)
+	if err != nil {
+		return credentials.Value{}, awserr.New(errCodeCredentialHelper, "Failed to get credentials from a credential helper", err)
+	}
+	if response.AccessKeyID == "" || response.SecretAccessKey == "" {
+		err := &credentialHelperError{helper: p.helper, msg: "it didn't print AccessKeyId and SecretAccessKey"}
+		return credentials.Value{}, awserr.New(errCodeCredentialHelper, "Failed to get credentials from a credential helper", err)
+	}
+	if response.Expiration != nil {
+		p.SetExpiration(*response.Expiration, time.Minute)
+	}
+	return credentials.Value{
+		AccessKeyID:     response.AccessKeyID,
+		SecretAccessKey: response.SecretAccessKey,
+		SessionToken:    response.SessionToken,
+		ProviderName:    "CredentialHelperProvider",
+	}, nil
+}
+
+// credentialHelperTokenSource is an oauth2.TokenSource that runs a
+// credential helper
+type credentialHelperTokenSource struct {
+	helper string
+	bucket string
+}
+
+func (ts *credentialHelperTokenSource) Token() (*oauth2.Token, error) {
+	response, err := runCredentialHelper(ts.helper, "gcs", ts.bucket)
+	if err != nil {
+		return nil, err
+	}
+	if response.AccessToken == "" {
+		return nil, &credentialHelperError{helper: ts.helper, msg: "it didn't print an AccessToken"}
+	}
+	token := &oauth2.Token{AccessToken: response.AccessToken, TokenType: "Bearer"}
+	if response.Expiration != nil {
+		token.Expiry = *response.Expiration
+	}
+	return token, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// writeCredentialHelper writes a credential helper to dir that saves its
+// arguments and request in dir, and runs script
+func writeCredentialHelper(t *testing.T, dir string, name string, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("Credential helpers in tests are shell scripts")
+	}
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(`#!/bin/sh
+echo "$@" > "`+dir+`/args"
+cat > "`+dir+`/request"
+`+script), 0755))
+	return path
+}
+
+func TestCredentialHelperProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	writeCredentialHelper(t, dir, credentialHelperPrefix+"vault", `echo '{"Version": 1, "AccessKeyId": "AKIA", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "`+expiration+`"}'`)
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	creds := credentials.NewCredentials(&credentialHelperProvider{helper: "vault", bucket: "hotdogs"})
+	value, err := creds.Get()
+	require.NoError(t, err)
+	require.Equal(t, "AKIA", value.AccessKeyID)
+	require.Equal(t, "secret", value.SecretAccessKey)
+	require.Equal(t, "token", value.SessionToken)
+	require.False(t, creds.IsExpired())
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	require.Equal(t, "get", strings.TrimSpace(string(args)))
+	request, err := ioutil.ReadFile(filepath.Join(dir, "request"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Version": 1, "Service": "s3", "Bucket": "hotdogs"}`, string(request))
+}
+
+func TestCredentialHelperTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := writeCredentialHelper(t, dir, "helper", `echo '{"Version": 1, "AccessToken": "ya29.token"}'`)
+
+	token, err := (&credentialHelperTokenSource{helper: path, bucket: "hotdogs"}).Token()
+	require.NoError(t, err)
+	require.Equal(t, "ya29.token", token.AccessToken)
+	require.True(t, token.Expiry.IsZero())
+	request, err := ioutil.ReadFile(filepath.Join(dir, "request"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Version": 1, "Service": "gcs", "Bucket": "hotdogs"}`, string(request))
+
+	// S3 credentials aren't an access token
+	path = writeCredentialHelper(t, dir, "s3-helper", `echo '{"Version": 1, "AccessKeyId": "AKIA", "SecretAccessKey": "secret"}'`)
+	_, err = (&credentialHelperTokenSource{helper: path, bucket: "hotdogs"}).Token()
+	require.Error(t, err)
+}
+
+func TestCredentialHelperErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	creds := credentials.NewCredentials(&credentialHelperProvider{helper: "nonexistent", bucket: "hotdogs"})
+	_, err = creds.Get()
+	cerr := s3CredentialsError(err, "s3://hotdogs")
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(cerr))
+	require.Contains(t, cerr.Error(), credentialHelperPrefix+"nonexistent isn't on your PATH")
+
+	for _, tt := range []struct {
+		script   string
+		expected string
+	}{
+		{"echo 'vault is sealed' >&2; exit 1", "vault is sealed"},
+		{"echo 'not json'", "didn't print credentials as JSON"},
+		{`echo '{"Version": 2, "AccessToken": "ya29.token"}'`, "only version 1 is supported"},
+		{`echo '{"Version": 1, "AccessToken": "ya29.token", "Expiration": "2020-01-01T00:00:00Z"}'`, "expired"},
+	} {
+		path := writeCredentialHelper(t, dir, "helper", tt.script)
+		_, err := (&credentialHelperTokenSource{helper: path, bucket: "hotdogs"}).Token()
+		cerr := gcsCredentialsError(err, "gs://hotdogs")
+		require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(cerr), tt.script)
+		require.Contains(t, cerr.Error(), tt.expected)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Credentials are looked up the first time a repository actually talks to S3 or
+// GCS, not when it is created, so commands that never touch the repository don't
+// fail because credentials are missing. The functions in this file turn the
+// errors the SDKs return when credentials are missing, expired, or don't have
+// permission into something that tells the user how to fix it.
+
+// s3CredentialsError returns an actionable error if err was caused by a problem
+// with AWS credentials, or nil if it wasn't
+func s3CredentialsError(err error, url string) error {
+	if cerr := certificateError(err, url); cerr != nil {
+		return cerr
+	}
+	if herr := asCredentialHelperError(err); herr != nil {
+		return credentialHelperRepositoryError(herr, url)
+	}
+	code := awsErrorCode(err)
+	switch code {
+	case "NoCredentialProviders":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`No AWS credentials were found, which are needed to access %s.
+
+To set up credentials, run 'aws configure', or set the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables. If the bucket is public, you can read it without credentials by adding '?anonymous=true' to the repository URL.`, url))
+	case "SharedCredsLoad", "SharedConfigProfileNotExistsError":
+		profile := os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`The AWS profile %q could not be loaded, which is needed to access %s.
+
+Check that the AWS_PROFILE environment variable names a profile in ~/.aws/credentials, or run 'aws configure --profile %s' to create it.`, profile, url, profile))
+	case errCodeSSOTokenExpired:
+		login := "aws sso login"
+		if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+			login += " --profile " + profile
+		}
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`You aren't logged in to AWS SSO, or your session has expired, so %s can't be accessed.
+
+Run '%s' to log in, then try again.`, url, login))
+	case "ExpiredToken", "ExpiredTokenException", "TokenRefreshRequired", "RequestExpired":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`Your AWS credentials have expired, so %s can't be accessed.
+
+Refresh your credentials (for example, by logging in again with 'aws sso login') and try again.`, url))
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch", "InvalidToken":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`Your AWS credentials were rejected when accessing %s (%s).
+
+Check the values of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or the profile in ~/.aws/credentials.`, url, code))
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`Access was denied to %s.
+
+Check that your AWS user or role has permission to read and write to this bucket.`, url))
+	}
+	return nil
+}
+
+// s3AssumeRoleError returns an actionable error for a failure to assume
+// roleARN, which is needed to access url
+func s3AssumeRoleError(err error, roleARN string, url string) error {
+	switch code := awsErrorCode(err); code {
+	case "AccessDenied":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`You aren't allowed to assume the role %s, which is needed to access %s.
+
+Check that the role's trust policy allows your AWS user or role to assume it, and that external_id and mfa_serial in the repository URL are what the role requires.`, roleARN, url))
+	case "AssumeRoleTokenProviderNotSetError":
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`The role %s requires MFA, which is needed to access %s.
+
+Add mfa_serial to the repository URL with the serial number or ARN of your MFA device.`, roleARN, url))
+	}
+	if cerr := s3CredentialsError(err, url); cerr != nil {
+		return cerr
+	}
+	return errors.RepositoryCredentialsError(fmt.Sprintf("Failed to assume the role %s to access %s: %s", roleARN, url, err))
+}
+
+// certificateError returns an actionable error if err was caused by a TLS
+// certificate that couldn't be verified, which usually means a corporate proxy
+// is intercepting TLS, or nil if it wasn't
+func certificateError(err error, url string) error {
+	if err == nil || !strings.Contains(err.Error(), "x509: ") {
+		return nil
+	}
+	return errors.RepositoryConfigurationError(fmt.Sprintf(`The TLS certificate of %s couldn't be verified: %v
+
+If you're behind a proxy that intercepts TLS, set %s to the path of a PEM file with your organization's CA certificates.`, url, err, caBundleEnvVar))
+}
+
+// readOnlyError is returned when writing to a repository that is accessed
+// anonymously
+func readOnlyError(url string) error {
+	return errors.WriteError(fmt.Sprintf("%s can't be written to, because it is accessed anonymously. To write to it with your credentials, remove 'anonymous=true' from the repository URL.", url))
+}
+
+// awsErrorCode returns the code of the innermost AWS error that explains err.
+// The SDK wraps credential errors (e.g. in a RequestError), so the outer code
+// is often something generic.
+func awsErrorCode(err error) string {
+	code := ""
+	for err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			break
+		}
+		if code == "" || isGenericAWSErrorCode(code) {
+			code = aerr.Code()
+		}
+		if batchErr, ok := err.(awserr.BatchedErrors); ok && len(batchErr.OrigErrs()) > 0 {
+			err = batchErr.OrigErrs()[0]
+		} else {
+			err = aerr.OrigErr()
+		}
+	}
+	return code
+}
+
+func isGenericAWSErrorCode(code string) bool {
+	switch code {
+	case "RequestError", "RequestCanceled", "SerializationError", "MultipartUpload", "BatchedDeleteIncomplete", "BatchedDownloadIncomplete":
+		return true
+	}
+	return false
+}
+
+// gcsCredentialsError returns an actionable error if err was caused by a problem
+// with Google Cloud credentials, or nil if it wasn't
+func gcsCredentialsError(err error, url string) error {
+	if err == nil {
+		return nil
+	}
+	if cerr := certificateError(err, url); cerr != nil {
+		return cerr
+	}
+	if herr := asCredentialHelperError(err); herr != nil {
+		return credentialHelperRepositoryError(herr, url)
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "could not find default credentials"):
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`No Google Cloud credentials were found, which are needed to access %s.
+
+To set up credentials, run 'gcloud auth application-default login', or set GOOGLE_APPLICATION_CREDENTIALS to the path of a service account key file. If the bucket is public, you can read it without credentials by adding '?anonymous=true' to the repository URL.`, url))
+	case strings.Contains(msg, "invalid_grant") || strings.Contains(msg, "invalid_rapt"):
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`Your Google Cloud credentials have expired or been revoked, so %s can't be accessed.
+
+Run 'gcloud auth application-default login' to refresh them.`, url))
+	case strings.Contains(msg, "oauth2: cannot fetch token"):
+		return errors.RepositoryCredentialsError(fmt.Sprintf(`Failed to get an access token for Google Cloud, which is needed to access %s: %v
+
+Run 'gcloud auth application-default login' to refresh your credentials.`, url, err))
+	}
+	if gerr, ok := err.(*googleapi.Error); ok {
+		switch gerr.Code {
+		case 401:
+			return errors.RepositoryCredentialsError(fmt.Sprintf(`Your Google Cloud credentials were rejected when accessing %s.
+
+Run 'gcloud auth application-default login' to refresh them.`, url))
+		case 403:
+			hint := "Check that your Google Cloud account or service account has permission to read and write to this bucket."
+			if strings.Contains(strings.ToLower(gerr.Message), "project") {
+				hint = "Check that the GOOGLE_CLOUD_PROJECT environment variable, or the project set with 'gcloud config set project', is the project the bucket belongs to."
+			}
+			return errors.RepositoryCredentialsError(fmt.Sprintf("Access was denied to %s: %s\n\n%s", url, gerr.Message, hint))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+func TestS3CredentialsError(t *testing.T) {
+	// Wrapped in a generic request error, like the SDK does
+	err := awserr.New("RequestError", "send request failed", awserr.New("NoCredentialProviders", "no valid providers in chain", nil))
+	cerr := s3CredentialsError(err, "s3://my-bucket")
+	require.Error(t, cerr)
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(cerr))
+	require.Contains(t, cerr.Error(), "No AWS credentials were found")
+	require.Contains(t, cerr.Error(), "s3://my-bucket")
+
+	err = awserr.New("ExpiredToken", "The provided token has expired.", nil)
+	cerr = s3CredentialsError(err, "s3://my-bucket")
+	require.Contains(t, cerr.Error(), "have expired")
+
+	// Errors that aren't about credentials are left alone
+	require.NoError(t, s3CredentialsError(awserr.New("NoSuchKey", "not found", nil), "s3://my-bucket"))
+	require.NoError(t, s3CredentialsError(fmt.Errorf("something else"), "s3://my-bucket"))
+}
+
+func TestGCSCredentialsError(t *testing.T) {
+	err := fmt.Errorf("dialing: google: could not find default credentials. See https://developers.google.com/accounts/docs/application-default-credentials for more information.")
+	cerr := gcsCredentialsError(err, "gs://my-bucket")
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(cerr))
+	require.Contains(t, cerr.Error(), "gcloud auth application-default login")
+
+	err = &googleapi.Error{Code: 403, Message: "The project to be billed is associated with a closed billing account."}
+	cerr = gcsCredentialsError(err, "gs://my-bucket")
+	require.Contains(t, cerr.Error(), "GOOGLE_CLOUD_PROJECT")
+
+	require.NoError(t, gcsCredentialsError(&googleapi.Error{Code: 500}, "gs://my-bucket"))
+	require.NoError(t, gcsCredentialsError(nil, "gs://my-bucket"))
+}
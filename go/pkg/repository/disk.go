@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -8,10 +9,13 @@ import (
 	"os"
 	pathpkg "path"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/otiai10/copy"
 
+	"github.com/replicate/replicate/go/pkg/concurrency"
 	"github.com/replicate/replicate/go/pkg/errors"
 	"github.com/replicate/replicate/go/pkg/files"
 )
@@ -27,22 +31,58 @@ func NewDiskRepository(rootDir string) (*DiskRepository, error) {
 }
 
 func (s *DiskRepository) RootURL() string {
-	return "file://" + s.rootDir
+	return "file://" + filepath.ToSlash(s.rootDir)
+}
+
+// fullPath returns the path on disk of path in the repository. Paths in the
+// repository are always slash-separated, whatever the OS.
+func (s *DiskRepository) fullPath(path string) string {
+	return filepath.Join(s.rootDir, filepath.FromSlash(diskPath(path)))
 }
 
 // Get data at path
 func (s *DiskRepository) Get(path string) ([]byte, error) {
-	data, err := ioutil.ReadFile(pathpkg.Join(s.rootDir, path))
-	if err != nil && os.IsNotExist(err) {
-		return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", path))
+	data, err := ioutil.ReadFile(s.fullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", path))
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to read %s: %v", path, err))
+	}
+	return data, nil
+}
+
+func (s *DiskRepository) GetReader(path string) (io.ReadCloser, error) {
+	f, err := os.Open(s.fullPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.DoesNotExist(fmt.Sprintf("GetReader: path does not exist: %v", path))
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to open %s: %v", path, err))
 	}
-	return data, err
+	return f, nil
+}
+
+func (s *DiskRepository) GetRangeReader(path string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := s.GetReader(path)
+	if err != nil {
+		return nil, err
+	}
+	f := reader.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, readError(err, fmt.Sprintf("Failed to read %s: %v", path, err))
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
 }
 
 // GetPath recursively copies repoDir to localDir
 func (s *DiskRepository) GetPath(repoDir string, localDir string) error {
-	if err := copy.Copy(pathpkg.Join(s.rootDir, repoDir), localDir); err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to copy directory from %s to %s: %v", repoDir, localDir, err))
+	if err := copy.Copy(s.fullPath(repoDir), localDir); err != nil {
+		return readError(err, fmt.Sprintf("Failed to copy directory from %s to %s: %v", repoDir, localDir, err))
 	}
 	return nil
 }
@@ -51,7 +91,7 @@ func (s *DiskRepository) GetPath(repoDir string, localDir string) error {
 //
 // See repository.go for full documentation.
 func (s *DiskRepository) GetPathTar(tarPath, localPath string) error {
-	fullTarPath := pathpkg.Join(s.rootDir, tarPath)
+	fullTarPath := s.fullPath(tarPath)
 	exists, err := files.FileExists(fullTarPath)
 	if err != nil {
 		return err
@@ -66,7 +106,7 @@ func (s *DiskRepository) GetPathTar(tarPath, localPath string) error {
 }
 
 func (s *DiskRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
-	fullTarPath := pathpkg.Join(s.rootDir, tarPath)
+	fullTarPath := s.fullPath(tarPath)
 	exists, err := files.FileExists(fullTarPath)
 	if err != nil {
 		return err
@@ -79,31 +119,49 @@ func (s *DiskRepository) GetPathItemTar(tarPath, itemPath, localPath string) err
 
 // Put data at path
 func (s *DiskRepository) Put(path string, data []byte) error {
-	fullPath := pathpkg.Join(s.rootDir, path)
+	fullPath := s.fullPath(path)
 	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
+	}
+	// Written to a temporary file and renamed, so, like an object in a
+	// bucket, it is replaced in one go and readers never see half of it
+	tempFile, err := ioutil.TempFile(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+".tmp")
+	if err != nil {
+		return writeError(err, err.Error())
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return writeError(err, err.Error())
+	}
+	if err := tempFile.Close(); err != nil {
+		return writeError(err, err.Error())
 	}
-	if err := ioutil.WriteFile(fullPath, data, 0644); err != nil {
-		return errors.WriteError(err.Error())
+	if err := os.Chmod(tempFile.Name(), 0644); err != nil {
+		return writeError(err, err.Error())
+	}
+	if err := os.Rename(tempFile.Name(), fullPath); err != nil {
+		return writeError(err, err.Error())
 	}
 	return nil
 }
 
 // PutPath recursively puts the local `localPath` directory into path `repoPath` in the repository
 func (s *DiskRepository) PutPath(localPath string, repoPath string) error {
-	files, err := getListOfFilesToPut(localPath, repoPath)
+	filesToPut, err := getListOfFilesToPut(localPath, repoPath, nil, false)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
-	for _, file := range files {
-		data, err := ioutil.ReadFile(file.Source)
-		if err != nil {
-			return errors.WriteError(err.Error())
+	for _, file := range filesToPut {
+		fullPath := s.fullPath(file.Dest)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return writeError(err, err.Error())
 		}
-		err = s.Put(file.Dest, data)
-		if err != nil {
-			return errors.WriteError(err.Error())
+		// Cloned rather than read into memory, so large files on the same
+		// filesystem are put without copying their data
+		if err := files.CloneFile(file.Source, fullPath); err != nil {
+			return writeError(err, err.Error())
 		}
 	}
 	return nil
@@ -118,34 +176,69 @@ func (s *DiskRepository) PutPathTar(localPath, tarPath, includePath string) erro
 		return errors.WriteError("PutPathTar: tarPath must end with .tar.gz")
 	}
 
-	fullPath := pathpkg.Join(s.rootDir, tarPath)
+	fullPath := s.fullPath(tarPath)
 	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
 
 	tarFile, err := os.Create(fullPath)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
 	defer tarFile.Close()
 
-	if err := putPathTar(localPath, tarFile, filepath.Base(tarPath), includePath); err != nil {
+	index, err := putPathTar(localPath, tarFile, pathpkg.Base(tarPath), includePath)
+	if err != nil {
 		return err
 	}
 
 	// Explicitly call Close() on success to capture error
 	if err := tarFile.Close(); err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
-	return nil
+	return putTarIndex(s, tarPath, index)
 }
 
 // Delete deletes path. If path is a directory, it recursively deletes
 // all everything under path
 func (s *DiskRepository) Delete(pathToDelete string) error {
-	if err := os.RemoveAll(pathpkg.Join(s.rootDir, pathToDelete)); err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.rootDir, pathToDelete, err))
+	if err := os.RemoveAll(s.fullPath(pathToDelete)); err != nil {
+		return writeError(err, fmt.Sprintf("Failed to delete %s/%s: %v", s.rootDir, pathToDelete, err))
+	}
+	return nil
+}
+
+// Copy copies the object at src to dest. It is cloned rather than read into
+// memory, like PutPath.
+func (s *DiskRepository) Copy(src, dest string) error {
+	srcPath, destPath := s.fullPath(src), s.fullPath(dest)
+	if _, err := os.Stat(srcPath); err != nil {
+		if os.IsNotExist(err) {
+			return errors.DoesNotExist(fmt.Sprintf("Copy: path does not exist: %v", src))
+		}
+		return readError(err, fmt.Sprintf("Failed to read %s: %v", src, err))
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return writeError(err, err.Error())
+	}
+	if err := files.CloneFile(srcPath, destPath); err != nil {
+		return writeError(err, err.Error())
+	}
+	return nil
+}
+
+// Move moves the object at src to dest by renaming it
+func (s *DiskRepository) Move(src, dest string) error {
+	destPath := s.fullPath(dest)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return writeError(err, err.Error())
+	}
+	if err := os.Rename(s.fullPath(src), destPath); err != nil {
+		if os.IsNotExist(err) {
+			return errors.DoesNotExist(fmt.Sprintf("Move: path does not exist: %v", src))
+		}
+		return writeError(err, fmt.Sprintf("Failed to move %s to %s: %v", src, dest, err))
 	}
 	return nil
 }
@@ -156,24 +249,24 @@ func (s *DiskRepository) Delete(pathToDelete string) error {
 // Directories are not listed.
 // If path does not exist, an empty list will be returned.
 func (s *DiskRepository) List(path string) ([]string, error) {
-	files, err := ioutil.ReadDir(pathpkg.Join(s.rootDir, path))
+	files, err := ioutil.ReadDir(s.fullPath(path))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []string{}, nil
 		}
-		return nil, errors.ReadError(err.Error())
+		return nil, readError(err, err.Error())
 	}
 	result := []string{}
 	for _, f := range files {
 		if !f.IsDir() {
-			result = append(result, pathpkg.Join(path, f.Name()))
+			result = append(result, pathpkg.Join(path, pathFromDisk(f.Name())))
 		}
 	}
 	return result, nil
 }
 
 func (s *DiskRepository) ListTarFile(tarPath string) ([]string, error) {
-	fullTarPath := pathpkg.Join(s.rootDir, tarPath)
+	fullTarPath := s.fullPath(tarPath)
 	exists, err := files.FileExists(fullTarPath)
 	if err != nil {
 		return nil, err
@@ -187,7 +280,7 @@ func (s *DiskRepository) ListTarFile(tarPath string) ([]string, error) {
 		return nil, err
 	}
 
-	tarname := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
+	tarname := pathpkg.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
 	for idx := range files {
 		files[idx] = strings.TrimPrefix(files[idx], tarname+"/")
 	}
@@ -195,62 +288,129 @@ func (s *DiskRepository) ListTarFile(tarPath string) ([]string, error) {
 	return files, nil
 }
 
-func (s *DiskRepository) ListRecursive(results chan<- ListResult, folder string) {
-	err := filepath.Walk(pathpkg.Join(s.rootDir, folder), func(path string, info os.FileInfo, err error) error {
+// ListRecursive lists the files in folder along with their MD5s. Files are
+// hashed in parallel, and files that haven't changed since they were last
+// listed aren't read again, so listing large directories is quick.
+func (s *DiskRepository) ListRecursive(ctx context.Context, results chan<- ListResult, folder string) {
+	defer close(results)
+
+	type walkedFile struct {
+		relPath string
+		path    string
+		info    os.FileInfo
+	}
+	// Before any file is looked at, so files modified while they are hashed
+	// aren't trusted next time
+	started := time.Now()
+	walked := []walkedFile{}
+	err := filepath.Walk(s.fullPath(folder), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			relPath, err := filepath.Rel(s.rootDir, path)
 			if err != nil {
 				return err
 			}
-
-			md5sum, err := md5File(path)
-			if err != nil {
-				return err
-			}
-			results <- ListResult{Path: relPath, MD5: md5sum}
+			walked = append(walked, walkedFile{relPath: pathFromDisk(filepath.ToSlash(relPath)), path: path, info: info})
 		}
 		return nil
 	})
 	if err != nil {
 		// If directory does not exist, treat this as empty. This is consistent with how blob storage
 		// would behave
-		if os.IsNotExist(err) {
-			close(results)
+		if !os.IsNotExist(err) && ctx.Err() == nil {
+			sendListResult(ctx, results, ListResult{Error: listError(err, err.Error())})
+		}
+		return
+	}
+
+	cache := loadHashCache(s.rootDir)
+	// Stops hashing if a file can't be read or the caller stops listing
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := concurrency.NewWorkerQueue(ctx, runtime.NumCPU())
+	// Results are sent in the order the files were walked
+	hashed := make([]chan ListResult, len(walked))
+	entries := make([]hashCacheEntry, len(walked))
+	for i := range hashed {
+		hashed[i] = make(chan ListResult, 1)
+	}
+	go func() {
+		for i, file := range walked {
+			// Variables used in closure
+			i, file := i, file
+			if md5sum, ok := cache.get(file.relPath, file.info); ok {
+				entries[i] = cache.entries[file.relPath]
+				hashed[i] <- ListResult{Path: file.relPath, MD5: md5sum, Size: file.info.Size()}
+				continue
+			}
+			err := queue.Go(func() error {
+				md5sum, err := md5File(file.path)
+				if err != nil {
+					hashed[i] <- ListResult{Error: listError(err, err.Error())}
+					return err
+				}
+				entries[i] = newHashCacheEntry(file.info, md5sum, started)
+				hashed[i] <- ListResult{Path: file.relPath, MD5: md5sum, Size: file.info.Size()}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var totalSize int64
+	for i, file := range walked {
+		var result ListResult
+		select {
+		case result = <-hashed[i]:
+		case <-ctx.Done():
 			return
 		}
-		results <- ListResult{Error: errors.ReadError(err.Error())}
+		if !sendListResult(ctx, results, result) || result.Error != nil {
+			return
+		}
+		totalSize += file.info.Size()
+	}
+
+	if len(walked) < minHashCacheFiles && totalSize < minHashCacheSize {
+		// Quicker to hash again than to save
+		return
 	}
-	close(results)
+	updated := make(map[string]hashCacheEntry, len(walked))
+	for i, file := range walked {
+		updated[file.relPath] = entries[i]
+	}
+	cache.replace(folder, updated)
 }
 
-func (s *DiskRepository) MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string) {
-	err := filepath.Walk(pathpkg.Join(s.rootDir, folder), func(path string, info os.FileInfo, err error) error {
+func (s *DiskRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	defer close(results)
+	err := filepath.Walk(s.fullPath(folder), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if filepath.Base(path) == filename {
+		if pathFromDisk(filepath.Base(path)) == filename {
 			relPath, err := filepath.Rel(s.rootDir, path)
 			if err != nil {
 				return err
 			}
-			results <- ListResult{Path: relPath}
+			if !sendListResult(ctx, results, ListResult{Path: pathFromDisk(filepath.ToSlash(relPath))}) {
+				return ctx.Err()
+			}
 		}
 		return nil
 	})
-	if err != nil {
-		// If directory does not exist, treat this as empty. This is consistent with how blob storage
-		// would behave
-		if os.IsNotExist(err) {
-			close(results)
-			return
-		}
-
-		results <- ListResult{Error: errors.ReadError(err.Error())}
+	// If directory does not exist, treat this as empty. This is consistent with how blob storage
+	// would behave
+	if err != nil && !os.IsNotExist(err) && ctx.Err() == nil {
+		sendListResult(ctx, results, ListResult{Error: listError(err, err.Error())})
 	}
-	close(results)
 }
 
 func md5File(path string) ([]byte, error) {
@@ -1,11 +1,16 @@
 package repository
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -105,6 +110,59 @@ func TestDiskGetPathItemTar(t *testing.T) {
 	require.True(t, errors.IsDoesNotExist(err))
 }
 
+func TestDiskPutPathTarIndexed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Enough files for the tarball to be indexed, and enough data for it to
+	// have several blocks
+	fileDir := path.Join(dir, "files")
+	require.NoError(t, os.MkdirAll(path.Join(fileDir, "data"), 0755))
+	contents := map[string][]byte{}
+	for i := 0; i < minIndexedTarFiles; i++ {
+		name := fmt.Sprintf("data/%03d.txt", i)
+		contents[name] = []byte(strings.Repeat(name, 4000))
+		require.NoError(t, ioutil.WriteFile(path.Join(fileDir, name), contents[name], 0644))
+	}
+
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	require.NoError(t, repository.PutPathTar(fileDir, "temp.tar.gz", ""))
+	index := LoadTarIndex(repository, "temp.tar.gz")
+	require.NotNil(t, index)
+	require.True(t, len(index.Blocks) > 1)
+	require.Len(t, index.Files, minIndexedTarFiles)
+
+	// It's still an ordinary tarball
+	tmpDir, err := files.TempDir("test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	require.NoError(t, repository.GetPathTar("temp.tar.gz", tmpDir))
+	for name, data := range contents {
+		content, err := ioutil.ReadFile(path.Join(tmpDir, name))
+		require.NoError(t, err)
+		require.Equal(t, data, content)
+	}
+
+	// Files can be read from just their block
+	var buf bytes.Buffer
+	require.NoError(t, CopyFileFromTar(repository, "temp.tar.gz", "data/099.txt", &buf))
+	require.Equal(t, contents["data/099.txt"], buf.Bytes())
+	err = CopyFileFromTar(repository, "temp.tar.gz", "data/nope.txt", &buf)
+	require.True(t, errors.IsDoesNotExist(err))
+
+	extractDir, err := files.TempDir("test")
+	require.NoError(t, err)
+	defer os.RemoveAll(extractDir)
+	require.NoError(t, ExtractFromIndexedTar(repository, "temp.tar.gz", index, []string{"data/000.txt", "data/050.txt"}, extractDir))
+	content, err := ioutil.ReadFile(path.Join(extractDir, "data/050.txt"))
+	require.NoError(t, err)
+	require.Equal(t, contents["data/050.txt"], content)
+	_, err = os.Stat(path.Join(extractDir, "data/001.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
 func TestDiskRepositoryPut(t *testing.T) {
 	dir, err := ioutil.TempDir("", "replicate-test")
 	require.NoError(t, err)
@@ -231,21 +289,72 @@ func TestDiskListRecursive(t *testing.T) {
 	repository, err := NewDiskRepository(dir)
 	require.NoError(t, err)
 	results := make(chan ListResult)
-	go repository.ListRecursive(results, "checkpoints")
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
 	require.Empty(t, <-results)
 
 	// Lists stuff!
 	require.NoError(t, repository.Put("checkpoints/abc123.json", []byte("yep")))
 	require.NoError(t, repository.Put("experiments/def456.json", []byte("nope")))
 	results = make(chan ListResult)
-	go repository.ListRecursive(results, "checkpoints")
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
 	require.Equal(t, ListResult{
 		Path: "checkpoints/abc123.json",
 		MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
+		Size: 3,
 	}, <-results)
 	require.Empty(t, <-results)
 }
 
+func TestDiskListRecursiveHashCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheDir, err := ioutil.TempDir("", "replicate-test-hashes")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	os.Setenv("REPLICATE_HASH_CACHE_DIR", cacheDir)
+	defer os.Unsetenv("REPLICATE_HASH_CACHE_DIR")
+
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Hour)
+	paths := []string{}
+	for i := 0; i < minHashCacheFiles; i++ {
+		p := fmt.Sprintf("checkpoints/%04d", i)
+		require.NoError(t, repository.Put(p, []byte("hello")))
+		require.NoError(t, os.Chtimes(path.Join(dir, p), past, past))
+		paths = append(paths, p)
+	}
+	list := func() []ListResult {
+		results := make(chan ListResult)
+		go repository.ListRecursive(context.Background(), results, "checkpoints")
+		ret := []ListResult{}
+		for result := range results {
+			require.NoError(t, result.Error)
+			ret = append(ret, result)
+		}
+		return ret
+	}
+
+	// Files are listed in order, even though they are hashed in parallel
+	results := list()
+	require.Len(t, results, len(paths))
+	for i, result := range results {
+		require.Equal(t, paths[i], result.Path)
+		require.Equal(t, []byte{0x5d, 0x41, 0x40, 0x2a, 0xbc, 0x4b, 0x2a, 0x76, 0xb9, 0x71, 0x9d, 0x91, 0x10, 0x17, 0xc5, 0x92}, result.MD5)
+	}
+
+	// A file with the same size and modification time isn't hashed again...
+	require.NoError(t, repository.Put(paths[0], []byte("jello")))
+	require.NoError(t, os.Chtimes(path.Join(dir, paths[0]), past, past))
+	require.Equal(t, results[0].MD5, list()[0].MD5)
+
+	// ...but is if either changes
+	later := past.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path.Join(dir, paths[0]), later, later))
+	require.NotEqual(t, results[0].MD5, list()[0].MD5)
+}
+
 func TestDiskMatchFilenamesRecursive(t *testing.T) {
 	dir, err := ioutil.TempDir("", "replicate-test")
 	require.NoError(t, err)
@@ -255,7 +364,7 @@ func TestDiskMatchFilenamesRecursive(t *testing.T) {
 	repository, err := NewDiskRepository(dir)
 	require.NoError(t, err)
 	results := make(chan ListResult)
-	go repository.MatchFilenamesRecursive(results, "checkpoints", "replicate-metadata.json")
+	go repository.MatchFilenamesRecursive(context.Background(), results, "checkpoints", "replicate-metadata.json")
 	v := <-results
 	require.Empty(t, v)
 }
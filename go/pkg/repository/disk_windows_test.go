@@ -0,0 +1,59 @@
+// +build windows
+
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskRepositoryWindowsPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Backslashes and drive letters work in file:// URLs
+	repository, err := ForURL("file://"+dir, "")
+	require.NoError(t, err)
+	require.Equal(t, "file://"+filepath.ToSlash(dir), repository.RootURL())
+	repository, err = ForURL("file:///"+filepath.ToSlash(dir), "")
+	require.NoError(t, err)
+
+	// Paths in the repository are slash-separated
+	require.NoError(t, repository.Put("checkpoints/abc123/data.json", []byte("yep")))
+	_, err = os.Stat(filepath.Join(dir, "checkpoints", "abc123", "data.json"))
+	require.NoError(t, err)
+	content, err := repository.Get("checkpoints/abc123/data.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("yep"), content)
+
+	results := make(chan ListResult)
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
+	result := <-results
+	require.NoError(t, result.Error)
+	require.Equal(t, "checkpoints/abc123/data.json", result.Path)
+	require.Empty(t, <-results)
+
+	results = make(chan ListResult)
+	go repository.MatchFilenamesRecursive(context.Background(), results, "checkpoints", "data.json")
+	require.Equal(t, ListResult{Path: "checkpoints/abc123/data.json"}, <-results)
+	require.Empty(t, <-results)
+}
+
+func TestGetListOfFilesToPutWindowsPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "model", "weights"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "model", "weights", "a.pt"), []byte("a"), 0644))
+
+	filesToPut, err := getListOfFilesToPut(dir, "checkpoints/abc123", nil, false)
+	require.NoError(t, err)
+	require.Len(t, filesToPut, 1)
+	require.Equal(t, "checkpoints/abc123/model/weights/a.pt", filesToPut[0].Dest)
+}
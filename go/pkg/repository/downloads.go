@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+)
+
+// Large objects on S3 and GCS are downloaded as several ranges at once,
+// rather than as a single stream, so downloading one big file can use all of
+// a fast connection. The ranges are written to their place in the local file,
+// and the whole file is checked against the checksum the storage service has
+// for the object once they have all been downloaded.
+
+// Downloads is how large objects are downloaded
+type Downloads struct {
+	// ChunkSize is the size in bytes of each range that is downloaded.
+	// Objects no bigger than this are downloaded in a single request.
+	ChunkSize int64
+	// Concurrency is how many ranges of each object are downloaded at once
+	Concurrency int
+}
+
+const (
+	DefaultDownloadChunkSize   = 16 * 1024 * 1024
+	DefaultDownloadConcurrency = 8
+)
+
+var (
+	downloadsMu sync.Mutex
+	downloads   Downloads
+)
+
+// SetDownloads sets how large objects are downloaded, usually from
+// replicate.yaml. Zero values are the defaults.
+func SetDownloads(d Downloads) {
+	downloadsMu.Lock()
+	defer downloadsMu.Unlock()
+	downloads = d
+}
+
+// currentDownloads returns the settings set with SetDownloads, with the
+// defaults in place of zero values
+func currentDownloads() Downloads {
+	downloadsMu.Lock()
+	d := downloads
+	downloadsMu.Unlock()
+	if d.ChunkSize <= 0 {
+		d.ChunkSize = DefaultDownloadChunkSize
+	}
+	if d.Concurrency <= 0 {
+		d.Concurrency = DefaultDownloadConcurrency
+	}
+	return d
+}
+
+// rangeGetter returns a reader for length bytes of an object, starting at
+// offset
+type rangeGetter func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// downloadRanges downloads an object of size bytes to f, getting ranges of
+// it in parallel. It fails if any range is shorter or longer than it should
+// be, which would leave a hole in f or write over the next range.
+func downloadRanges(ctx context.Context, f io.WriterAt, size int64, getRange rangeGetter) error {
+	d := currentDownloads()
+	queue := concurrency.NewWorkerQueue(ctx, d.Concurrency)
+	for offset := int64(0); offset < size; offset += d.ChunkSize {
+		// Variables used in closure
+		offset := offset
+		length := d.ChunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		err := queue.Go(func() error {
+			reader, err := getRange(ctx, offset, length)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+			n, err := io.Copy(&offsetWriter{w: f, offset: offset}, io.LimitReader(reader, length+1))
+			if err != nil {
+				return err
+			}
+			if n != length {
+				return fmt.Errorf("Got %d bytes of the range at %d, expected %d", n, offset, length)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return queue.Wait()
+}
+
+// offsetWriter writes to w sequentially, starting at offset
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
+
+// fileChecksum returns the sum h gives for length bytes of the file at path,
+// starting at offset. If length is negative, the rest of the file is read.
+func fileChecksum(path string, offset, length int64, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var reader io.Reader = io.NewSectionReader(f, offset, 1<<62)
+	if length >= 0 {
+		reader = io.LimitReader(reader, length)
+	}
+	if _, err := io.Copy(h, reader); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentDownloads(t *testing.T) {
+	require.Equal(t, Downloads{ChunkSize: DefaultDownloadChunkSize, Concurrency: DefaultDownloadConcurrency}, currentDownloads())
+	SetDownloads(Downloads{Concurrency: 2})
+	defer SetDownloads(Downloads{})
+	require.Equal(t, Downloads{ChunkSize: DefaultDownloadChunkSize, Concurrency: 2}, currentDownloads())
+}
+
+func TestS3GetPathRanges(t *testing.T) {
+	SetDownloads(Downloads{ChunkSize: 1024 * 1024, Concurrency: 4})
+	defer SetDownloads(Downloads{})
+	fake := newFakeS3(int(s3manager.DefaultUploadPartSize))
+	var corrupt int32
+	repository, closeServer := newFakeS3Repository(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The second range is served from the start of the object instead
+		if atomic.LoadInt32(&corrupt) == 1 && r.Header.Get("Range") == "bytes=1048576-2097151" {
+			r.Header.Set("Range", "bytes=0-1048575")
+		}
+		fake.ServeHTTP(w, r)
+	}), "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	large := make([]byte, 2*s3manager.DefaultUploadPartSize+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large.bin"), large, 0644))
+	require.NoError(t, repository.PutPath(filepath.Join(dir, "large.bin"), "blobs/large.bin"))
+	require.NoError(t, repository.Put("blobs/small.bin", large[:1000]))
+	require.Equal(t, 1, fake.multipartPuts)
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, repository.GetPath("blobs", out))
+	data, err := ioutil.ReadFile(filepath.Join(out, "large.bin"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(large, data))
+	data, err = ioutil.ReadFile(filepath.Join(out, "small.bin"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(large[:1000], data))
+
+	// A range with the wrong content fails the download
+	atomic.StoreInt32(&corrupt, 1)
+	err = repository.GetPath("blobs/large.bin", filepath.Join(dir, "corrupt.bin"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "corrupted while it was being downloaded")
+}
+
+func TestGCSGetPathRanges(t *testing.T) {
+	SetDownloads(Downloads{ChunkSize: 1024 * 1024, Concurrency: 4})
+	defer SetDownloads(Downloads{})
+	repository, closeServer := newFakeGCSRepository(t, newFakeGCS(), "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	large := make([]byte, 5*1024*1024+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	require.NoError(t, repository.Put("blobs/large.bin", large))
+
+	out := filepath.Join(dir, "large.bin")
+	require.NoError(t, repository.GetPath("blobs/large.bin", out))
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(large, data))
+}
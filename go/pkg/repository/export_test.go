@@ -0,0 +1,14 @@
+package repository
+
+import "testing"
+
+// Fakes for conformance_test.go, which is in repository_test so it can use
+// storagetest without an import cycle
+
+func NewFakeS3Repository(t *testing.T) (Repository, func()) {
+	return newFakeS3Repository(t, newFakeS3(0), "root")
+}
+
+func NewFakeGCSRepository(t *testing.T) (Repository, func()) {
+	return newFakeGCSRepository(t, newFakeGCS(), "root")
+}
@@ -0,0 +1,397 @@
+package repository
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+// fakeGCS is an in-memory Google Cloud Storage that does just enough for
+// GCSRepository: getting bucket metadata, listing, uploading, reading,
+// copying and deleting objects. Listings are paged, and can be limited to a range of
+// names with startOffset and endOffset. The client uses the JSON API for most
+// things and the XML API for reads, so it serves both.
+type fakeGCS struct {
+	mu sync.Mutex
+	// buckets are the objects in each bucket, by name
+	buckets map[string]map[string][]byte
+	// uploads are the resumable uploads in progress, by upload ID
+	uploads      map[string]*fakeGCSUpload
+	nextUploadID int
+	listRequests int
+}
+
+type fakeGCSUpload struct {
+	bucket string
+	name   string
+	data   []byte
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{
+		buckets: map[string]map[string][]byte{},
+		uploads: map[string]*fakeGCSUpload{},
+	}
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := r.URL.Path
+	switch {
+	case p == "/storage/v1/b" && r.Method == http.MethodPost:
+		f.createBucket(w, r)
+	case strings.HasPrefix(p, "/upload/storage/v1/b/"):
+		bucketName := strings.SplitN(strings.TrimPrefix(p, "/upload/storage/v1/b/"), "/", 2)[0]
+		f.upload(w, r, bucketName)
+	case strings.HasPrefix(p, "/storage/v1/b/"):
+		parts := strings.SplitN(strings.TrimPrefix(p, "/storage/v1/b/"), "/", 3)
+		bucket, ok := f.buckets[parts[0]]
+		if !ok {
+			writeGCSError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			writeGCSJSON(w, map[string]string{"kind": "storage#bucket", "name": parts[0]})
+		case len(parts) == 2 && parts[1] == "o" && r.Method == http.MethodGet:
+			f.listObjects(w, r, parts[0], bucket)
+		case len(parts) == 3 && parts[1] == "o" && r.Method == http.MethodPost && strings.Contains(parts[2], "/rewriteTo/b/"):
+			f.rewrite(w, bucket, parts[2])
+		case len(parts) == 3 && parts[1] == "o":
+			data, ok := bucket[parts[2]]
+			if !ok {
+				writeGCSError(w, http.StatusNotFound, "No such object")
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				writeGCSJSON(w, gcsObjectResource(parts[0], parts[2], data))
+			case http.MethodDelete:
+				delete(bucket, parts[2])
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.Error(w, "not implemented", http.StatusNotImplemented)
+			}
+		default:
+			http.Error(w, "not implemented", http.StatusNotImplemented)
+		}
+	case r.Method == http.MethodGet:
+		f.read(w, r)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// rewrite copies an object, for a path of
+// <object>/rewriteTo/b/<bucket>/o/<object>
+func (f *fakeGCS) rewrite(w http.ResponseWriter, srcBucket map[string][]byte, p string) {
+	parts := strings.SplitN(p, "/rewriteTo/b/", 2)
+	data, ok := srcBucket[parts[0]]
+	if !ok {
+		writeGCSError(w, http.StatusNotFound, "No such object")
+		return
+	}
+	dest := strings.SplitN(parts[1], "/o/", 2)
+	destBucket, ok := f.buckets[dest[0]]
+	if !ok || len(dest) != 2 {
+		writeGCSError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	destBucket[dest[1]] = append([]byte{}, data...)
+	writeGCSJSON(w, map[string]interface{}{
+		"kind":                "storage#rewriteResponse",
+		"totalBytesRewritten": strconv.Itoa(len(data)),
+		"objectSize":          strconv.Itoa(len(data)),
+		"done":                true,
+		"resource":            gcsObjectResource(dest[0], dest[1], data),
+	})
+}
+
+func (f *fakeGCS) createBucket(w http.ResponseWriter, r *http.Request) {
+	attrs := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+		writeGCSError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := f.buckets[attrs.Name]; ok {
+		writeGCSError(w, http.StatusConflict, "Bucket already exists")
+		return
+	}
+	f.buckets[attrs.Name] = map[string][]byte{}
+	writeGCSJSON(w, map[string]string{"kind": "storage#bucket", "name": attrs.Name})
+}
+
+func (f *fakeGCS) listObjects(w http.ResponseWriter, r *http.Request, bucketName string, bucket map[string][]byte) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startOffset := query.Get("startOffset")
+	endOffset := query.Get("endOffset")
+	// The page token is the last name in the page before
+	pageToken := query.Get("pageToken")
+	maxResults := 1000
+	if n, err := strconv.Atoi(query.Get("maxResults")); err == nil && n > 0 {
+		maxResults = n
+	}
+	f.listRequests++
+	names := []string{}
+	for name := range bucket {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := []map[string]string{}
+	prefixes := []string{}
+	seenPrefixes := map[string]bool{}
+	nextPageToken := ""
+	last := ""
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || name < startOffset || (endOffset != "" && name >= endOffset) || name <= pageToken {
+			continue
+		}
+		if len(items)+len(prefixes) >= maxResults {
+			nextPageToken = last
+			break
+		}
+		last = name
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				p := name[:len(prefix)+i+len(delimiter)]
+				if !seenPrefixes[p] {
+					seenPrefixes[p] = true
+					prefixes = append(prefixes, p)
+				}
+				continue
+			}
+		}
+		items = append(items, gcsObjectResource(bucketName, name, bucket[name]))
+	}
+	writeGCSJSON(w, map[string]interface{}{
+		"kind":          "storage#objects",
+		"items":         items,
+		"prefixes":      prefixes,
+		"nextPageToken": nextPageToken,
+	})
+}
+
+// upload handles uploads. Small objects are uploaded in one multipart
+// request, and bigger ones in chunks with a resumable upload.
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request, bucketName string) {
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		writeGCSError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	query := r.URL.Query()
+	switch query.Get("uploadType") {
+	case "multipart":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		metadata, err := reader.NextPart()
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		name, err := gcsUploadName(query, metadata)
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		media, err := reader.NextPart()
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		data, err := ioutil.ReadAll(media)
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bucket[name] = data
+		writeGCSJSON(w, gcsObjectResource(bucketName, name, data))
+	case "resumable":
+		if uploadID := query.Get("upload_id"); uploadID != "" {
+			f.uploadChunk(w, r, uploadID)
+			return
+		}
+		name, err := gcsUploadName(query, r.Body)
+		if err != nil {
+			writeGCSError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.nextUploadID++
+		id := strconv.Itoa(f.nextUploadID)
+		f.uploads[id] = &fakeGCSUpload{bucket: bucketName, name: name}
+		location := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: "uploadType=resumable&upload_id=" + id}
+		w.Header().Set("Location", location.String())
+	default:
+		writeGCSError(w, http.StatusBadRequest, "Unsupported upload type")
+	}
+}
+
+// uploadChunk appends a chunk to a resumable upload, and finishes the upload
+// if it is the last chunk, which is when the total size is known
+func (f *fakeGCS) uploadChunk(w http.ResponseWriter, r *http.Request, uploadID string) {
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		writeGCSError(w, http.StatusNotFound, "No such upload")
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeGCSError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	upload.data = append(upload.data, data...)
+	// e.g. "bytes 0-99/*", "bytes 100-149/150" or "bytes */150"
+	contentRange := r.Header.Get("Content-Range")
+	if strings.HasSuffix(contentRange, "/*") {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload.data)-1))
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	delete(f.uploads, uploadID)
+	f.buckets[upload.bucket][upload.name] = upload.data
+	writeGCSJSON(w, gcsObjectResource(upload.bucket, upload.name, upload.data))
+}
+
+// read serves reads from the XML API, which are /<bucket>/<object>
+func (f *fakeGCS) read(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+	data, ok := f.buckets[parts[0]][parts[1]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	status := http.StatusOK
+	if byteRange := r.Header.Get("Range"); byteRange != "" {
+		start, end, ok := parseByteRange(byteRange, int64(len(data)))
+		if !ok {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// gcsUploadName returns the name of an object being uploaded, which is
+// either in the query string or the JSON metadata
+func gcsUploadName(query url.Values, metadata io.Reader) (string, error) {
+	if name := query.Get("name"); name != "" {
+		return name, nil
+	}
+	attrs := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(metadata).Decode(&attrs); err != nil {
+		return "", err
+	}
+	if attrs.Name == "" {
+		return "", fmt.Errorf("Object has no name")
+	}
+	return attrs.Name, nil
+}
+
+func gcsObjectResource(bucket, name string, data []byte) map[string]string {
+	sum := md5.Sum(data)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	return map[string]string{
+		"kind":       "storage#object",
+		"bucket":     bucket,
+		"name":       name,
+		"size":       strconv.Itoa(len(data)),
+		"md5Hash":    base64.StdEncoding.EncodeToString(sum[:]),
+		"crc32c":     base64.StdEncoding.EncodeToString(crc),
+		"generation": "1",
+	}
+}
+
+func writeGCSJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeGCSError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
+
+// fakeGCSTransport sends every request to the fake server, whichever
+// Google host it was meant for
+type fakeGCSTransport struct {
+	url *url.URL
+}
+
+func (t *fakeGCSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.url.Scheme
+	req.URL.Host = t.url.Host
+	req.Host = t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newFakeGCSRepository starts a server for fake, and returns a repository
+// that uses a bucket in it, along with a function that stops the server
+func newFakeGCSRepository(t *testing.T, fake *fakeGCS, root string) (*GCSRepository, func()) {
+	server := httptest.NewServer(fake)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client, err := storage.NewClient(context.Background(), option.WithHTTPClient(&http.Client{
+		Transport: &fakeGCSTransport{url: serverURL},
+	}))
+	require.NoError(t, err)
+	fake.mu.Lock()
+	if _, ok := fake.buckets["bucket"]; !ok {
+		fake.buckets["bucket"] = map[string][]byte{}
+	}
+	fake.mu.Unlock()
+	// Already connected, so connect() doesn't look for credentials
+	return &GCSRepository{
+		bucketName: "bucket",
+		root:       root,
+		client:     client,
+		pacer:      newPacer(gcsThrottled),
+	}, server.Close
+}
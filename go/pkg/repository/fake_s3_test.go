@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-memory S3 that does just enough for S3Repository: buckets,
+// getting, putting, copying and deleting objects, multipart uploads, and
+// listing objects with both versions of the API. Requests use path-style URLs.
+//
+// If maxPutSize is set, single PUTs bigger than it are rejected, like S3
+// does above 5GB. If throttle is set, that many listings are rejected with
+// SlowDown, like S3 does when a prefix gets too many requests.
+type fakeS3 struct {
+	maxPutSize int
+	throttle   int
+
+	mu sync.Mutex
+	// buckets are the objects in each bucket, by key
+	buckets map[string]map[string]fakeS3Object
+	// parts are the parts of multipart uploads that are in progress, by
+	// upload ID and part number
+	parts          map[string]map[int][]byte
+	puts           int
+	multipartPuts  int
+	partsUploaded  int
+	nextUploadID   int
+	rejectedUpload bool
+	listRequests   int
+}
+
+type fakeS3Object struct {
+	data []byte
+	etag string
+	// partSize and parts are the size of the first part and the number of
+	// parts of objects that were uploaded in parts
+	partSize int
+	parts    int
+}
+
+func newFakeS3(maxPutSize int) *fakeS3 {
+	return &fakeS3{
+		maxPutSize: maxPutSize,
+		buckets:    map[string]map[string]fakeS3Object{},
+		parts:      map[string]map[int][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucketName := parts[0]
+	key := ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	query := r.URL.Query()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if key == "" && r.Method == http.MethodPut {
+		if _, ok := f.buckets[bucketName]; !ok {
+			f.buckets[bucketName] = map[string]fakeS3Object{}
+		}
+		return
+	}
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" && r.Method == http.MethodGet {
+		f.listRequests++
+		if f.throttle > 0 {
+			f.throttle--
+			writeS3Error(w, http.StatusServiceUnavailable, "SlowDown")
+			return
+		}
+	}
+	if key == "" {
+		switch {
+		case r.Method == http.MethodGet && query.Get("list-type") == "2":
+			f.listObjectsV2(w, bucket, query)
+		case r.Method == http.MethodGet:
+			f.listObjects(w, bucket, query)
+		case r.Method == http.MethodPost && query["delete"] != nil:
+			f.deleteObjects(w, bucket, body)
+		case r.Method == http.MethodHead:
+		default:
+			http.Error(w, "not implemented", http.StatusNotImplemented)
+		}
+		return
+	}
+
+	// Copies are PUTs with the object to copy in a header instead of a body
+	copySource := r.Header.Get("X-Amz-Copy-Source")
+	if copySource != "" {
+		source, ok := f.copySource(copySource, r.Header.Get("X-Amz-Copy-Source-Range"))
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		body = source
+	}
+
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		f.nextUploadID++
+		id := strconv.Itoa(f.nextUploadID)
+		f.parts[id] = map[int][]byte{}
+		writeS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucketName, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && uploadID != "":
+		if f.maxPutSize > 0 && len(body) > f.maxPutSize {
+			f.rejectedUpload = true
+			writeS3Error(w, http.StatusBadRequest, "EntityTooLarge")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		f.parts[uploadID][partNumber] = body
+		f.partsUploaded++
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, partNumber))
+		if copySource != "" {
+			writeS3XML(w, struct {
+				XMLName xml.Name `xml:"CopyPartResult"`
+				ETag    string
+			}{ETag: fmt.Sprintf(`"%d"`, partNumber)})
+		}
+	case r.Method == http.MethodPost && uploadID != "":
+		numbers := []int{}
+		for n := range f.parts[uploadID] {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		data := []byte{}
+		sums := []byte{}
+		for _, n := range numbers {
+			data = append(data, f.parts[uploadID][n]...)
+			sum := md5.Sum(f.parts[uploadID][n])
+			sums = append(sums, sum[:]...)
+		}
+		// Like S3, the ETag of a multipart upload isn't the MD5 of its
+		// content, but the MD5 of the MD5s of its parts
+		sum := md5.Sum(sums)
+		bucket[key] = fakeS3Object{data: data, etag: fmt.Sprintf(`"%x-%d"`, sum, len(numbers)), partSize: len(f.parts[uploadID][numbers[0]]), parts: len(numbers)}
+		f.multipartPuts++
+		delete(f.parts, uploadID)
+		writeS3XML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+		}{Bucket: bucketName, Key: key})
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.parts, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		if f.maxPutSize > 0 && len(body) > f.maxPutSize {
+			f.rejectedUpload = true
+			writeS3Error(w, http.StatusBadRequest, "EntityTooLarge")
+			return
+		}
+		sum := md5.Sum(body)
+		bucket[key] = fakeS3Object{data: body, etag: `"` + hex.EncodeToString(sum[:]) + `"`}
+		f.puts++
+		w.Header().Set("ETag", bucket[key].etag)
+		if copySource != "" {
+			writeS3XML(w, struct {
+				XMLName xml.Name `xml:"CopyObjectResult"`
+				ETag    string
+			}{ETag: bucket[key].etag})
+		}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := bucket[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", object.etag)
+		data := object.data
+		status := http.StatusOK
+		if r.Method == http.MethodHead && query.Get("partNumber") == "1" && object.parts > 0 {
+			w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(object.parts))
+			data = data[:object.partSize]
+			status = http.StatusPartialContent
+		}
+		if byteRange := r.Header.Get("Range"); byteRange != "" {
+			start, end, ok := parseByteRange(byteRange, int64(len(data)))
+			if !ok {
+				writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data = data[start : end+1]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+// copySource returns the data of the object in an x-amz-copy-source header,
+// or the range of it in an x-amz-copy-source-range header
+func (f *fakeS3) copySource(header string, byteRange string) ([]byte, bool) {
+	source, err := url.PathUnescape(strings.TrimPrefix(header, "/"))
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	object, ok := f.buckets[parts[0]][parts[1]]
+	if !ok {
+		return nil, false
+	}
+	data := object.data
+	if byteRange != "" {
+		start, end, ok := parseByteRange(byteRange, int64(len(data)))
+		if !ok {
+			return nil, false
+		}
+		data = data[start : end+1]
+	}
+	return data, true
+}
+
+type fakeS3Contents struct {
+	Key  string
+	ETag string
+	Size int
+}
+
+// listKeys returns the keys in bucket after marker that start with prefix,
+// and the common prefixes of the keys that have delimiter after prefix,
+// up to maxKeys of them in total
+func (f *fakeS3) listKeys(bucket map[string]fakeS3Object, prefix, delimiter, marker string, maxKeys int) (keys []string, commonPrefixes []string, truncated bool) {
+	sorted := []string{}
+	for key := range bucket {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	seenPrefixes := map[string]bool{}
+	for _, key := range sorted {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+		if len(keys)+len(commonPrefixes) >= maxKeys {
+			return keys, commonPrefixes, true
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix := key[:len(prefix)+i+len(delimiter)]
+				if !seenPrefixes[commonPrefix] {
+					seenPrefixes[commonPrefix] = true
+					commonPrefixes = append(commonPrefixes, commonPrefix)
+				}
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, commonPrefixes, false
+}
+
+func (f *fakeS3) contents(bucket map[string]fakeS3Object, keys []string, encodingType string) []fakeS3Contents {
+	contents := []fakeS3Contents{}
+	for _, key := range keys {
+		listedKey := key
+		if encodingType == s3.EncodingTypeUrl {
+			listedKey = url.QueryEscape(key)
+		}
+		contents = append(contents, fakeS3Contents{Key: listedKey, ETag: bucket[key].etag, Size: len(bucket[key].data)})
+	}
+	return contents
+}
+
+func (f *fakeS3) listObjects(w http.ResponseWriter, bucket map[string]fakeS3Object, query url.Values) {
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil {
+		maxKeys = n
+	}
+	keys, commonPrefixes, truncated := f.listKeys(bucket, query.Get("prefix"), query.Get("delimiter"), query.Get("marker"), maxKeys)
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		IsTruncated    bool
+		NextMarker     string `xml:",omitempty"`
+		Contents       []fakeS3Contents
+		CommonPrefixes []commonPrefix
+	}{
+		IsTruncated: truncated,
+		Contents:    f.contents(bucket, keys, query.Get("encoding-type")),
+	}
+	for _, p := range commonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: p})
+	}
+	// Like the keys, the marker is encoded if they asked for it to be
+	if truncated {
+		last := ""
+		if len(keys) > 0 {
+			last = keys[len(keys)-1]
+		}
+		if len(commonPrefixes) > 0 && commonPrefixes[len(commonPrefixes)-1] > last {
+			last = commonPrefixes[len(commonPrefixes)-1]
+		}
+		result.NextMarker = last
+		if query.Get("encoding-type") == s3.EncodingTypeUrl {
+			result.NextMarker = url.QueryEscape(last)
+		}
+	}
+	writeS3XML(w, result)
+}
+
+func (f *fakeS3) listObjectsV2(w http.ResponseWriter, bucket map[string]fakeS3Object, query url.Values) {
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil {
+		maxKeys = n
+	}
+	keys, _, truncated := f.listKeys(bucket, query.Get("prefix"), "", query.Get("continuation-token"), maxKeys)
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		KeyCount              int
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []fakeS3Contents
+	}{
+		IsTruncated: truncated,
+		KeyCount:    len(keys),
+		Contents:    f.contents(bucket, keys, query.Get("encoding-type")),
+	}
+	if truncated {
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	writeS3XML(w, result)
+}
+
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, bucket map[string]fakeS3Object, body []byte) {
+	type object struct {
+		Key string
+	}
+	request := struct {
+		Objects []object `xml:"Object"`
+	}{}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	result := struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []object
+	}{}
+	for _, obj := range request.Objects {
+		delete(bucket, obj.Key)
+		result.Deleted = append(result.Deleted, obj)
+	}
+	writeS3XML(w, result)
+}
+
+// parseByteRange parses an HTTP Range header with a single range of bytes
+// in an object that is size bytes long
+func parseByteRange(header string, size int64) (start, end int64, ok bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if spec == header || len(parts) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if parts[1] != "" {
+		if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
+
+func writeS3XML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(data)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// newFakeS3Repository starts a server for fake, and returns a repository
+// that uses a bucket in it, along with a function that stops the server
+func newFakeS3Repository(t *testing.T, fake http.Handler, root string) (*S3Repository, func()) {
+	return newFakeS3RepositoryWithTransport(t, fake, root, http.DefaultTransport)
+}
+
+// newFakeS3RepositoryWithTransport is newFakeS3Repository, with requests made
+// with transport
+func newFakeS3RepositoryWithTransport(t *testing.T, fake http.Handler, root string, transport http.RoundTripper) (*S3Repository, func()) {
+	server := httptest.NewServer(fake)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		S3ForcePathStyle: aws.Bool(true),
+		HTTPClient:       &http.Client{Transport: transport},
+	})
+	require.NoError(t, err)
+	svc := s3.New(sess)
+	// The bucket is created without faults, so they only affect the test
+	_, err = s3.New(sess, &aws.Config{HTTPClient: http.DefaultClient}).CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+	// Already connected, so connect() doesn't look for the bucket
+	return &S3Repository{
+		bucketName: "bucket",
+		root:       root,
+		sess:       sess,
+		svc:        svc,
+		uploader:   newS3Uploader(svc),
+		downloader: s3manager.NewDownloaderWithClient(svc),
+		pacer:      newPacer(s3Throttled),
+	}, server.Close
+}
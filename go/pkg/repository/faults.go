@@ -0,0 +1,460 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Network failures can be simulated, to test that uploads and downloads are
+// retried and resumed properly. A FaultyRepository wraps any repository and
+// fails its operations, and a FaultyTransport wraps an HTTP transport and
+// fails the requests S3 and GCS repositories make, such as the parts of
+// multipart uploads.
+//
+// Which requests fail is decided by hashing the seed, the request and how many
+// times it has been tried, not by the order requests are made in, so the same
+// requests fail every time even when they are made concurrently.
+
+// FaultsEnvVar turns on simulated failures of the requests made to S3 and GCS,
+// for testing. It is a comma-separated list of settings, such as
+// "drop=0.1,latency=200ms,truncate=0.05,seed=42,op=PUT".
+const FaultsEnvVar = "REPLICATE_FAULTS"
+
+// Faults are the network failures to simulate
+type Faults struct {
+	// DropRate is the fraction of requests, from 0 to 1, that fail without
+	// being made
+	DropRate float64
+
+	// Latency is added to every request
+	Latency time.Duration
+
+	// TruncateRate is the fraction of responses, from 0 to 1, whose data
+	// ends early with io.ErrUnexpectedEOF
+	TruncateRate float64
+
+	// Seed picks which requests fail
+	Seed int64
+
+	// Operations are the operations faults are simulated for, such as "Put"
+	// for a FaultyRepository or "PUT" for a FaultyTransport. If it is
+	// empty, they are simulated for all of them.
+	Operations []string
+}
+
+// FaultStats is how many failures have been simulated
+type FaultStats struct {
+	Requests  int
+	Dropped   int
+	Truncated int
+}
+
+// InjectedFault is the error of a request that was dropped on purpose. Like
+// the network errors it simulates, it is temporary, so it is retried.
+type InjectedFault struct {
+	Operation string
+	Key       string
+}
+
+func (e *InjectedFault) Error() string {
+	return fmt.Sprintf("simulated network failure: %s %s was dropped", e.Operation, e.Key)
+}
+
+func (e *InjectedFault) Temporary() bool { return true }
+
+func (e *InjectedFault) Timeout() bool { return false }
+
+// faultInjector decides which requests fail
+type faultInjector struct {
+	faults Faults
+
+	mu       sync.Mutex
+	attempts map[string]int
+	stats    FaultStats
+}
+
+func newFaultInjector(faults Faults) *faultInjector {
+	return &faultInjector{faults: faults, attempts: map[string]int{}}
+}
+
+func (f *faultInjector) applies(op string) bool {
+	if len(f.faults.Operations) == 0 {
+		return true
+	}
+	for _, o := range f.faults.Operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// before is called before a request is made. It waits for the latency, then
+// returns an InjectedFault if the request should be dropped. It also returns
+// the attempt number of the request, to pass to truncateAt.
+func (f *faultInjector) before(ctx context.Context, op, key string) (int, error) {
+	if !f.applies(op) {
+		return 0, nil
+	}
+	f.mu.Lock()
+	attempt := f.attempts[op+" "+key]
+	f.attempts[op+" "+key]++
+	f.stats.Requests++
+	drop := f.roll("drop", op, key, attempt) < f.faults.DropRate
+	if drop {
+		f.stats.Dropped++
+	}
+	f.mu.Unlock()
+
+	if f.faults.Latency > 0 {
+		select {
+		case <-time.After(f.faults.Latency):
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		}
+	}
+	if drop {
+		console.Debug("Simulating a network failure of %s %s (attempt %d)", op, key, attempt+1)
+		return attempt, &InjectedFault{Operation: op, Key: key}
+	}
+	return attempt, nil
+}
+
+// unknownTruncateSize is the size that responses whose size isn't known are
+// truncated within
+const unknownTruncateSize = 64 * 1024
+
+// truncateAt returns how many bytes of the response to a request are read
+// before it ends early, or -1 if it isn't truncated. size is the size of the
+// response, or -1 if it isn't known.
+func (f *faultInjector) truncateAt(op, key string, attempt int, size int64) int64 {
+	if !f.applies(op) {
+		return -1
+	}
+	if f.roll("truncate", op, key, attempt) >= f.faults.TruncateRate {
+		return -1
+	}
+	f.mu.Lock()
+	f.stats.Truncated++
+	f.mu.Unlock()
+	if size < 0 {
+		size = unknownTruncateSize
+	}
+	return int64(f.roll("truncate-at", op, key, attempt) * float64(size))
+}
+
+// roll returns a number from 0 to 1 that is the same every time it is called
+// with the same arguments
+func (f *faultInjector) roll(kind, op, key string, attempt int) float64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(f.faults.Seed))
+	h.Write(buf[:])
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d", kind, op, key, attempt)
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+func (f *faultInjector) Stats() FaultStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// truncatedReader ends with io.ErrUnexpectedEOF after remaining bytes
+type truncatedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *truncatedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func truncateReader(reader io.ReadCloser, at int64) io.ReadCloser {
+	if at < 0 {
+		return reader
+	}
+	return &truncatedReader{ReadCloser: reader, remaining: at}
+}
+
+// FaultyRepository wraps another repository, simulating network failures of
+// its operations. Operations on directories and tarballs fail as a whole;
+// wrap the HTTP transport with a FaultyTransport to fail the requests they
+// are made of.
+type FaultyRepository struct {
+	repository Repository
+	faults     *faultInjector
+}
+
+func NewFaultyRepository(repo Repository, faults Faults) *FaultyRepository {
+	return &FaultyRepository{repository: repo, faults: newFaultInjector(faults)}
+}
+
+// Stats returns how many failures have been simulated
+func (r *FaultyRepository) Stats() FaultStats {
+	return r.faults.Stats()
+}
+
+func (r *FaultyRepository) RootURL() string {
+	return r.repository.RootURL()
+}
+
+func (r *FaultyRepository) Get(path string) ([]byte, error) {
+	attempt, err := r.faults.before(context.Background(), "Get", path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.repository.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if at := r.faults.truncateAt("Get", path, attempt, int64(len(data))); at >= 0 {
+		return nil, fmt.Errorf("Failed to read %s: %w", path, io.ErrUnexpectedEOF)
+	}
+	return data, nil
+}
+
+func (r *FaultyRepository) GetReader(path string) (io.ReadCloser, error) {
+	attempt, err := r.faults.before(context.Background(), "GetReader", path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := r.repository.GetReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return truncateReader(reader, r.faults.truncateAt("GetReader", path, attempt, -1)), nil
+}
+
+func (r *FaultyRepository) GetRangeReader(path string, offset, length int64) (io.ReadCloser, error) {
+	key := fmt.Sprintf("%s[%d:%d]", path, offset, offset+length)
+	attempt, err := r.faults.before(context.Background(), "GetRangeReader", key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := r.repository.GetRangeReader(path, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return truncateReader(reader, r.faults.truncateAt("GetRangeReader", key, attempt, length)), nil
+}
+
+func (r *FaultyRepository) GetPath(repoPath, localPath string) error {
+	if _, err := r.faults.before(context.Background(), "GetPath", repoPath); err != nil {
+		return err
+	}
+	return r.repository.GetPath(repoPath, localPath)
+}
+
+func (r *FaultyRepository) GetPathTar(tarPath, localPath string) error {
+	if _, err := r.faults.before(context.Background(), "GetPathTar", tarPath); err != nil {
+		return err
+	}
+	return r.repository.GetPathTar(tarPath, localPath)
+}
+
+func (r *FaultyRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	if _, err := r.faults.before(context.Background(), "GetPathItemTar", tarPath+":"+itemPath); err != nil {
+		return err
+	}
+	return r.repository.GetPathItemTar(tarPath, itemPath, localPath)
+}
+
+func (r *FaultyRepository) Put(path string, data []byte) error {
+	if _, err := r.faults.before(context.Background(), "Put", path); err != nil {
+		return err
+	}
+	return r.repository.Put(path, data)
+}
+
+func (r *FaultyRepository) PutPath(localPath, repoPath string) error {
+	if _, err := r.faults.before(context.Background(), "PutPath", repoPath); err != nil {
+		return err
+	}
+	return r.repository.PutPath(localPath, repoPath)
+}
+
+func (r *FaultyRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	if _, err := r.faults.before(context.Background(), "PutPathTar", tarPath); err != nil {
+		return err
+	}
+	return r.repository.PutPathTar(localPath, tarPath, includePath)
+}
+
+func (r *FaultyRepository) Delete(path string) error {
+	if _, err := r.faults.before(context.Background(), "Delete", path); err != nil {
+		return err
+	}
+	return r.repository.Delete(path)
+}
+
+func (r *FaultyRepository) Copy(src, dest string) error {
+	if _, err := r.faults.before(context.Background(), "Copy", src); err != nil {
+		return err
+	}
+	return r.repository.Copy(src, dest)
+}
+
+func (r *FaultyRepository) Move(src, dest string) error {
+	if _, err := r.faults.before(context.Background(), "Move", src); err != nil {
+		return err
+	}
+	return r.repository.Move(src, dest)
+}
+
+func (r *FaultyRepository) List(path string) ([]string, error) {
+	if _, err := r.faults.before(context.Background(), "List", path); err != nil {
+		return nil, err
+	}
+	return r.repository.List(path)
+}
+
+func (r *FaultyRepository) ListTarFile(path string) ([]string, error) {
+	if _, err := r.faults.before(context.Background(), "ListTarFile", path); err != nil {
+		return nil, err
+	}
+	return r.repository.ListTarFile(path)
+}
+
+func (r *FaultyRepository) ListRecursive(ctx context.Context, results chan<- ListResult, folder string) {
+	if _, err := r.faults.before(ctx, "ListRecursive", folder); err != nil {
+		results <- ListResult{Error: err}
+		close(results)
+		return
+	}
+	r.repository.ListRecursive(ctx, results, folder)
+}
+
+func (r *FaultyRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	if _, err := r.faults.before(ctx, "MatchFilenamesRecursive", folder+":"+filename); err != nil {
+		results <- ListResult{Error: err}
+		close(results)
+		return
+	}
+	r.repository.MatchFilenamesRecursive(ctx, results, folder, filename)
+}
+
+// FaultyTransport wraps an HTTP transport, simulating network failures of the
+// requests made with it. Operations are HTTP methods.
+type FaultyTransport struct {
+	transport http.RoundTripper
+	faults    *faultInjector
+}
+
+func NewFaultyTransport(transport http.RoundTripper, faults Faults) *FaultyTransport {
+	return &FaultyTransport{transport: transport, faults: newFaultInjector(faults)}
+}
+
+// Stats returns how many failures have been simulated
+func (t *FaultyTransport) Stats() FaultStats {
+	return t.faults.Stats()
+}
+
+func (t *FaultyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := faultKey(req)
+	attempt, err := t.faults.before(req.Context(), req.Method, key)
+	if err != nil {
+		// RoundTrip must always close the body
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if at := t.faults.truncateAt(req.Method, key, attempt, resp.ContentLength); at >= 0 {
+		resp.Body = truncateReader(resp.Body, at)
+	}
+	return resp, nil
+}
+
+// faultKey returns what identifies the request, so retries of it are
+// recognized. The IDs of uploads are left out, because they are different
+// each time.
+func faultKey(req *http.Request) string {
+	query := req.URL.Query()
+	names := []string{}
+	for name := range query {
+		if !strings.Contains(strings.ToLower(name), "upload") && !strings.HasPrefix(name, "X-Amz-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, name+"="+strings.Join(query[name], ","))
+	}
+	if req.Header.Get("Range") != "" {
+		parts = append(parts, "range="+req.Header.Get("Range"))
+	}
+	return req.URL.Path + "?" + strings.Join(parts, "&")
+}
+
+// faultsFromEnv returns the faults in FaultsEnvVar, or nil if it isn't set
+func faultsFromEnv() (*Faults, error) {
+	value := os.Getenv(FaultsEnvVar)
+	if value == "" {
+		return nil, nil
+	}
+	faults := &Faults{}
+	for _, setting := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(setting), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("$%s must be a list of settings like 'drop=0.1', not %q", FaultsEnvVar, value)
+		}
+		name, v := parts[0], parts[1]
+		var err error
+		switch name {
+		case "drop":
+			faults.DropRate, err = parseFaultRate(v)
+		case "truncate":
+			faults.TruncateRate, err = parseFaultRate(v)
+		case "latency":
+			faults.Latency, err = time.ParseDuration(v)
+		case "seed":
+			faults.Seed, err = strconv.ParseInt(v, 10, 64)
+		case "op":
+			faults.Operations = append(faults.Operations, strings.ToUpper(v))
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %q in $%s: %s", setting, FaultsEnvVar, err)
+		}
+	}
+	return faults, nil
+}
+
+func parseFaultRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 || math.IsNaN(rate) {
+		return 0, fmt.Errorf("it must be from 0 to 1")
+	}
+	return rate, nil
+}
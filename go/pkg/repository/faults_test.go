@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	disk, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	putAll := func(r *FaultyRepository) {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("objects/%d", i)
+			var err error
+			for attempt := 0; attempt < 20; attempt++ {
+				if err = r.Put(key, []byte(key)); err == nil {
+					break
+				}
+				require.IsType(t, &InjectedFault{}, err)
+			}
+			require.NoError(t, err)
+		}
+	}
+	faults := Faults{DropRate: 0.3, Seed: 42, Operations: []string{"Put"}}
+	r := NewFaultyRepository(disk, faults)
+	putAll(r)
+	stats := r.Stats()
+	require.True(t, stats.Dropped > 0)
+	require.Equal(t, 100+stats.Dropped, stats.Requests)
+
+	// The same requests fail with the same seed
+	again := NewFaultyRepository(disk, faults)
+	putAll(again)
+	require.Equal(t, stats, again.Stats())
+
+	// Only Put is faulty
+	for i := 0; i < 100; i++ {
+		data, err := r.Get(fmt.Sprintf("objects/%d", i))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("objects/%d", i), string(data))
+	}
+
+	// Truncated reads end early
+	require.NoError(t, disk.Put("large", bytes.Repeat([]byte("x"), 1000)))
+	r = NewFaultyRepository(disk, Faults{TruncateRate: 1})
+	_, err = r.Get("large")
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	reader, err := r.GetRangeReader("large", 100, 500)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.True(t, len(data) < 500)
+	require.Equal(t, 2, r.Stats().Truncated)
+
+	// Latency is added to every request
+	r = NewFaultyRepository(disk, Faults{Latency: 50 * time.Millisecond})
+	start := time.Now()
+	_, err = r.List("objects/")
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestFaultyTransportMultipartUpload(t *testing.T) {
+	transport := NewFaultyTransport(http.DefaultTransport, Faults{DropRate: 0.2, Seed: 7, Operations: []string{"PUT", "POST"}})
+	fake := newFakeS3(int(s3manager.DefaultUploadPartSize))
+	repository, closeServer := newFakeS3RepositoryWithTransport(t, fake, "root", transport)
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	large := make([]byte, 3*s3manager.DefaultUploadPartSize+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large.bin"), large, 0644))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("small-%d.txt", i)), []byte("small"), 0644))
+	}
+
+	// Dropped requests, including parts of the multipart upload, are
+	// retried
+	require.NoError(t, repository.PutPath(dir, "checkpoints/abc123"))
+	require.True(t, transport.Stats().Dropped > 0)
+	require.Equal(t, 1, fake.multipartPuts)
+
+	data, err := repository.Get("checkpoints/abc123/large.bin")
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(large, data))
+	for i := 0; i < 20; i++ {
+		data, err = repository.Get(fmt.Sprintf("checkpoints/abc123/small-%d.txt", i))
+		require.NoError(t, err)
+		require.Equal(t, "small", string(data))
+	}
+}
+
+func TestFaultsFromEnv(t *testing.T) {
+	os.Setenv(FaultsEnvVar, "drop=0.1,latency=200ms,truncate=0.05,seed=42,op=put,op=GET")
+	defer os.Unsetenv(FaultsEnvVar)
+	faults, err := faultsFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, &Faults{DropRate: 0.1, Latency: 200 * time.Millisecond, TruncateRate: 0.05, Seed: 42, Operations: []string{"PUT", "GET"}}, faults)
+
+	for _, invalid := range []string{"drop=2", "drop", "explode=1", "latency=soon"} {
+		os.Setenv(FaultsEnvVar, invalid)
+		_, err = faultsFromEnv()
+		require.Error(t, err, invalid)
+	}
+
+	os.Unsetenv(FaultsEnvVar)
+	faults, err = faultsFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, faults)
+}
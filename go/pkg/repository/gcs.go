@@ -2,52 +2,145 @@ package repository
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	pathpkg "path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
-	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
 
 	"github.com/replicate/replicate/go/pkg/concurrency"
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
-	"github.com/replicate/replicate/go/pkg/files"
 )
 
+// GCSOptions are set with query parameters in the repository URL, e.g.
+// gs://bucket?impersonate_service_account=replicate@my-project.iam.gserviceaccount.com
+type GCSOptions struct {
+	// ImpersonateServiceAccount is the email of a service account to act as,
+	// using your own credentials
+	ImpersonateServiceAccount string
+	// Anonymous reads a public bucket without credentials. The repository
+	// is read-only.
+	Anonymous bool
+	// CredentialHelper is the name of, or path to, a program that prints
+	// access tokens. See credential_helper.go.
+	CredentialHelper string
+
+	// bucket is the bucket the options are for, which is passed to the
+	// credential helper
+	bucket string
+}
+
+var gcsLog = console.Component("gcs")
+
 type GCSRepository struct {
 	projectID  string
 	bucketName string
 	root       string
-	client     *storage.Client
+	options    GCSOptions
+
+	// Set by connect() on first use
+	mu     sync.Mutex
+	client *storage.Client
+
+	// bucketExists is set once the bucket is known to exist, so it is only
+	// checked once per repository. It is cleared if the bucket turns out to
+	// have been deleted.
+	bucketMu     sync.Mutex
+	bucketExists bool
+
+	pacer     *pacer
+	listCache *listCache
 }
 
 func NewGCSRepository(bucket, root string) (*GCSRepository, error) {
-	applicationCredentialsJSON := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON")
-	options := []option.ClientOption{}
-	if applicationCredentialsJSON != "" {
-		jwtConfig, err := google.JWTConfigFromJSON([]byte(applicationCredentialsJSON), storage.ScopeReadWrite)
-		if err != nil {
-			return nil, errors.RepositoryConfigurationError(err.Error())
+	return NewGCSRepositoryWithOptions(bucket, root, GCSOptions{})
+}
+
+func NewGCSRepositoryWithOptions(bucket, root string, options GCSOptions) (*GCSRepository, error) {
+	options.bucket = bucket
+	s := &GCSRepository{
+		bucketName: bucket,
+		root:       root,
+		options:    options,
+		pacer:      newPacer(gcsThrottled),
+	}
+	s.listCache = newListCache(s.RootURL())
+	return s, nil
+}
+
+// gcsOptionsFromURL reads GCSOptions from the query parameters of repositoryURL
+func gcsOptionsFromURL(repositoryURL string) (GCSOptions, error) {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return GCSOptions{}, err
+	}
+	options := GCSOptions{}
+	for name, values := range u.Query() {
+		value := values[len(values)-1]
+		switch name {
+		case "impersonate_service_account":
+			options.ImpersonateServiceAccount = value
+		case "anonymous":
+			options.Anonymous, err = strconv.ParseBool(value)
+			if err != nil {
+				return GCSOptions{}, errors.RepositoryConfigurationError(fmt.Sprintf("The value of anonymous in repository URL %s must be true or false", repositoryURL))
+			}
+		case "credential_helper":
+			options.CredentialHelper = value
+		default:
+			return GCSOptions{}, errors.RepositoryConfigurationError(fmt.Sprintf("Unknown option %q in repository URL %s. The options for Google Cloud Storage repositories are impersonate_service_account, anonymous, and credential_helper.", name, repositoryURL))
 		}
-		options = append(options, option.WithTokenSource(jwtConfig.TokenSource(context.TODO())))
 	}
-	client, err := storage.NewClient(context.TODO(), options...)
+	if options.Anonymous && options.ImpersonateServiceAccount != "" {
+		return GCSOptions{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s can't be anonymous and impersonate a service account", repositoryURL))
+	}
+	if options.Anonymous && options.CredentialHelper != "" {
+		return GCSOptions{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s can't be anonymous and have a credential helper", repositoryURL))
+	}
+	return options, nil
+}
+
+// connect looks up credentials and sets up the client. Every operation calls
+// this first, and it only does any work until it has succeeded once.
+func (s *GCSRepository) connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return nil
+	}
+	client, err := getGCSClient(s.options)
 	if err != nil {
-		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to Google Cloud Storage: %v", err))
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to Google Cloud Storage: %v", err))
 	}
+	s.client = client
+	return nil
+}
 
-	return &GCSRepository{
-		bucketName: bucket,
-		root:       root,
-		client:     client,
-	}, nil
+// connectForWriting is connect for operations that change the bucket, which
+// anonymous repositories can't do
+func (s *GCSRepository) connectForWriting() error {
+	if s.options.Anonymous {
+		return readOnlyError(s.RootURL())
+	}
+	return s.connect()
 }
 
 func (s *GCSRepository) RootURL() string {
@@ -59,136 +152,251 @@ func (s *GCSRepository) RootURL() string {
 }
 
 func (s *GCSRepository) Get(path string) ([]byte, error) {
-	key := filepath.Join(s.root, path)
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	key := objectKey(s.root, path)
 	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	reader, err := obj.NewReader(context.TODO())
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	reader, err := obj.NewReader(ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
 			return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %s", pathString))
 		}
-		return nil, errors.ReadError(fmt.Sprintf("Failed to open %s: %s", pathString, err))
+		if stopped(ctx) {
+			return nil, stoppedError("downloading", pathString, nil)
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to open %s: %s", pathString, err))
 	}
 	// FIXME: unhandled error
 	defer reader.Close()
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read %s: %s", pathString, err))
+		if stopped(ctx) {
+			return nil, stoppedError("downloading", pathString, nil)
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to read %s: %s", pathString, err))
 	}
 
 	return data, nil
 }
 
+func (s *GCSRepository) GetReader(path string) (io.ReadCloser, error) {
+	return s.GetRangeReader(path, 0, -1)
+}
+
+// GetRangeReader returns a reader for length bytes of the object at path,
+// starting at offset. If length is negative, the rest of the object is read.
+func (s *GCSRepository) GetRangeReader(path string, offset, length int64) (io.ReadCloser, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	key := objectKey(s.root, path)
+	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
+	reader, err := s.client.Bucket(s.bucketName).Object(key).NewRangeReader(context.TODO(), offset, length)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, errors.DoesNotExist(fmt.Sprintf("GetReader: path does not exist: %s", pathString))
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to open %s: %s", pathString, err))
+	}
+	return reader, nil
+}
+
 // Delete deletes path. If path is a directory, it recursively deletes
 // all everything under path
 func (s *GCSRepository) Delete(path string) error {
-	console.Debug("Deleting %s/%s...", s.RootURL(), path)
-	prefix := filepath.Join(s.root, path)
-	err := s.applyRecursive(prefix, func(obj *storage.ObjectHandle) error {
-		return obj.Delete(context.TODO())
+	gcsLog.Debug("Deleting %s/%s...", s.RootURL(), path)
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.clear()
+	prefix := objectKey(s.root, path)
+	progress := newTransferProgress(-1)
+	err := s.applyRecursive(prefix, func(obj *storage.ObjectHandle, attrs *storage.ObjectAttrs) error {
+		ctx, cancel := withOverallTimeout(transferContext())
+		defer cancel()
+		if err := obj.Delete(ctx); err != nil {
+			if stopped(ctx) {
+				return stoppedError("deleting", fmt.Sprintf("gs://%s/%s", s.bucketName, obj.ObjectName()), progress)
+			}
+			return err
+		}
+		progress.add()
+		return nil
 	})
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
+		if isStoppedError(err) {
+			return err
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
 	}
 	return nil
 }
 
 // Put data at path
 func (s *GCSRepository) Put(path string, data []byte) error {
-	key := filepath.Join(s.root, path)
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(path)
+	key := objectKey(s.root, path)
 	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	writer := obj.NewWriter(context.TODO())
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	writer := obj.NewWriter(ctx)
 	_, err := writer.Write(data)
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+		if stopped(ctx) {
+			return stoppedError("uploading", pathString, nil)
+		}
+		return writeError(err, fmt.Sprintf("Failed to write %q: %v", pathString, err))
 	}
 	if err := writer.Close(); err != nil {
+		if stopped(ctx) {
+			return stoppedError("uploading", pathString, nil)
+		}
 		if strings.Contains(err.Error(), "notFound") {
+			// The bucket might have been deleted since we last checked
+			s.forgetBucketExists()
 			if err := s.ensureBucketExists(); err != nil {
 				return err
 			}
-			writer := obj.NewWriter(context.TODO())
+			writer := obj.NewWriter(ctx)
 			_, err := writer.Write(data)
 			if err != nil {
-				return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+				return writeError(err, fmt.Sprintf("Failed to write %q: %v", pathString, err))
 			}
 			if err := writer.Close(); err != nil {
-				return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+				return writeError(err, fmt.Sprintf("Failed to write %q: %v", pathString, err))
 			}
 			return nil
 		}
-		return errors.WriteError(fmt.Sprintf("Failed to write %q: %v", pathString, err))
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to write %q: %v", pathString, err))
 	}
 	return nil
 }
 
 func (s *GCSRepository) PutPath(localPath string, repoPath string) error {
-	files, err := getListOfFilesToPut(localPath, filepath.Join(s.root, repoPath))
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(repoPath)
+	files, err := getListOfFilesToPut(localPath, pathpkg.Join(s.root, repoPath), nil, false)
 	if err != nil {
 		return err
 	}
 	bucket := s.client.Bucket(s.bucketName)
 	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	progress := newTransferProgress(len(files))
 	for _, file := range files {
 		// Variables used in closure
 		file := file
 		err := queue.Go(func() error {
-			writer := bucket.Object(file.Dest).NewWriter(context.TODO())
+			start := time.Now()
+			ctx, cancel := withOverallTimeout(transferContext())
+			defer cancel()
+			writer := bucket.Object(encodeKey(file.Dest)).NewWriter(ctx)
 
 			reader, err := os.Open(file.Source)
 			if err != nil {
 				return err
 			}
-			if _, err := io.Copy(writer, reader); err != nil {
-				return err
+			_, err = io.Copy(writer, reader)
+			if err == nil {
+				err = reader.Close()
 			}
-			if err := reader.Close(); err != nil {
-				return err
+			if err == nil {
+				err = writer.Close()
 			}
-			if err := writer.Close(); err != nil {
+			if err != nil {
+				if stopped(ctx) {
+					return stoppedError("uploading", fmt.Sprintf("gs://%s/%s", s.bucketName, file.Dest), progress)
+				}
 				return err
 			}
+			gcsLog.Debug("Uploaded %s to gs://%s/%s (%d bytes, took %.3f seconds)", file.Source, s.bucketName, file.Dest, file.Info.Size(), time.Since(start).Seconds())
+			progress.add()
 			return nil
 		})
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, err.Error())
 		}
 	}
 	if err := queue.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		if isStoppedError(err) {
+			return err
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, err.Error())
 	}
 	return nil
 }
 
 func (s *GCSRepository) PutPathTar(localPath, tarPath, includePath string) error {
 	if !strings.HasSuffix(tarPath, ".tar.gz") {
-		return fmt.Errorf("PutPathTar: tarPath must end with .tar.gz")
+		return errors.WriteError("PutPathTar: tarPath must end with .tar.gz")
+	}
+	if err := s.connectForWriting(); err != nil {
+		return err
 	}
 	if err := s.ensureBucketExists(); err != nil {
 		return err
 	}
+	s.listCache.invalidate(tarPath)
 
-	key := filepath.Join(s.root, tarPath)
+	key := objectKey(s.root, tarPath)
 	bucket := s.client.Bucket(s.bucketName)
 	obj := bucket.Object(key)
-	writer := obj.NewWriter(context.TODO())
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	writer := obj.NewWriter(ctx)
 
-	if err := putPathTar(localPath, writer, filepath.Base(tarPath), includePath); err != nil {
-		return errors.WriteError(err.Error())
+	index, err := putPathTar(localPath, writer, pathpkg.Base(tarPath), includePath)
+	if err != nil {
+		if stopped(ctx) {
+			return stoppedError("uploading", s.RootURL()+"/"+tarPath, nil)
+		}
+		return writeError(err, err.Error())
 	}
 	if err := writer.Close(); err != nil {
-		return errors.WriteError(err.Error())
+		if stopped(ctx) {
+			return stoppedError("uploading", s.RootURL()+"/"+tarPath, nil)
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, err.Error())
 	}
-	return nil
+	return putTarIndex(s, tarPath, index)
 }
 
 // List files in a path non-recursively
 func (s *GCSRepository) List(dir string) ([]string, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
 	results := []string{}
-	prefix := filepath.Join(s.root, dir)
+	prefix := objectKey(s.root, dir)
 
 	// prefixes must end with / and must not end with /
 	if !strings.HasSuffix(prefix, "/") {
@@ -197,7 +405,9 @@ func (s *GCSRepository) List(dir string) ([]string, error) {
 	prefix = strings.TrimPrefix(prefix, "/")
 
 	bucket := s.client.Bucket(s.bucketName)
-	it := bucket.Objects(context.TODO(), &storage.Query{
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	it := bucket.Objects(ctx, &storage.Query{
 		Prefix:    prefix,
 		Delimiter: "/",
 	})
@@ -207,13 +417,15 @@ func (s *GCSRepository) List(dir string) ([]string, error) {
 			break
 		}
 		if err != nil {
-			return nil, errors.ReadError(fmt.Sprintf("Failed to list %s/%s: %s", s.RootURL(), dir, err))
-		}
-		p := attrs.Name
-		if s.root != "" {
-			p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+			if stopped(ctx) {
+				return nil, stoppedError("listing", s.RootURL()+"/"+dir, nil)
+			}
+			if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+				return nil, cerr
+			}
+			return nil, listError(err, fmt.Sprintf("Failed to list %s/%s: %s", s.RootURL(), dir, err))
 		}
-		if p != "" {
+		if p := objectPath(s.root, attrs.Name); p != "" {
 			results = append(results, p)
 		}
 	}
@@ -221,185 +433,256 @@ func (s *GCSRepository) List(dir string) ([]string, error) {
 }
 
 func (s *GCSRepository) ListTarFile(tarPath string) ([]string, error) {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
-	if err != nil {
-		return nil, err
-	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return nil, err
-	}
-	exists, err := files.FileExists(tmptarball)
-	if err != nil {
-		return []string{}, err
-	}
-	if !exists {
-		return nil, errors.DoesNotExist("Path does not exist: " + tmptarball)
-	}
-
-	files, err := getListOfFilesInTar(tmptarball)
-	if err != nil {
-		return []string{}, err
-	}
-
-	tarname := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
-	for idx := range files {
-		files[idx] = strings.TrimPrefix(files[idx], tarname+"/")
-	}
-
-	return files, nil
+	return listTarFile(s, tarPath)
 }
 
 // List files in a path recursively
-func (s *GCSRepository) ListRecursive(results chan<- ListResult, dir string) {
-	s.listRecursive(results, dir, func(_ string) bool { return true })
+func (s *GCSRepository) ListRecursive(ctx context.Context, results chan<- ListResult, dir string) {
+	s.listRecursive(ctx, results, dir, func(_ string) bool { return true })
 }
 
-func (s *GCSRepository) MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string) {
-	s.listRecursive(results, folder, func(key string) bool {
-		return filepath.Base(key) == filename
+func (s *GCSRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	s.listRecursive(ctx, results, folder, func(key string) bool {
+		return pathpkg.Base(key) == filename
 	})
 }
 
-func (s *GCSRepository) listRecursive(results chan<- ListResult, dir string, filter func(string) bool) {
-	prefix := filepath.Join(s.root, dir)
+func (s *GCSRepository) listRecursive(ctx context.Context, results chan<- ListResult, dir string, filter func(string) bool) {
+	defer close(results)
+	if cached, ok := s.listCache.get(dir); ok {
+		for _, result := range cached {
+			if filter(result.Path) && !sendListResult(ctx, results, result) {
+				return
+			}
+		}
+		return
+	}
+	if err := s.connect(); err != nil {
+		sendListResult(ctx, results, ListResult{Error: err})
+		return
+	}
+	prefix := objectKey(s.root, dir)
 	// prefixes must end with / and must not end with /
 	if !strings.HasSuffix(prefix, "/") {
 		prefix += "/"
 	}
 	prefix = strings.TrimPrefix(prefix, "/")
 
-	bucket := s.client.Bucket(s.bucketName)
-	it := bucket.Objects(context.TODO(), &storage.Query{
-		Prefix: prefix,
-	})
-	for {
-		attrs, err := it.Next()
-		if err == iterator.Done {
-			break
+	// Everything listed is kept for the cache, before it is filtered
+	listed := time.Now()
+	var mu sync.Mutex
+	all := []ListResult{}
+	send := func(result ListResult) bool {
+		if s.listCache != nil {
+			mu.Lock()
+			all = append(all, result)
+			mu.Unlock()
 		}
-		if err != nil {
-			// Treat non-existent buckets as empty
-			// Can't figure out how to check this error more strongly
-			if strings.Contains(err.Error(), "storage: bucket doesn't exist") {
-				break
-			}
+		if filter(result.Path) {
+			return sendListResult(ctx, results, result)
+		}
+		return true
+	}
 
-			results <- ListResult{Error: fmt.Errorf("Failed to list gs://%s/%s: %s", s.bucketName, prefix, err)}
-			break
+	// If it doesn't fit in one page, list the rest in shards
+	last, more, err := s.listRange(ctx, prefix, keyRange{}, 1, send)
+	if err == nil && more {
+		err = listShardsAtOnce(ctx, listShards(prefix, last), func(ctx context.Context, r keyRange) error {
+			_, _, err := s.listRange(ctx, prefix, r, 0, send)
+			return err
+		})
+	}
+	// Stopped by the caller, so there's nobody to tell
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		// Treat non-existent buckets as empty
+		// Can't figure out how to check this error more strongly
+		if strings.Contains(err.Error(), "storage: bucket doesn't exist") {
+			s.forgetBucketExists()
+			return
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			sendListResult(ctx, results, ListResult{Error: cerr})
+			return
+		}
+		sendListResult(ctx, results, ListResult{Error: listError(err, fmt.Sprintf("Failed to list gs://%s/%s: %s", s.bucketName, prefix, err))})
+		return
+	}
+	s.listCache.set(dir, listed, all)
+}
+
+// gcsListPageSize is the most objects GCS returns in a page of a listing
+const gcsListPageSize = 1000
+
+// listRange lists the objects in r that start with prefix, a page at a time,
+// calling send with each one until it returns false. If maxPages isn't 0, it
+// stops after that many pages, and returns the last key listed and whether
+// there are more.
+func (s *GCSRepository) listRange(ctx context.Context, prefix string, r keyRange, maxPages int, send func(ListResult) bool) (last string, more bool, err error) {
+	query := &storage.Query{Prefix: prefix}
+	if r.Until != "" {
+		// EndOffset is exclusive, and nothing comes between a key and the
+		// key with a NUL on the end
+		query.EndOffset = r.Until + "\x00"
+	}
+	last = r.After
+	var pager *iterator.Pager
+	for pages := 1; ; pages++ {
+		var page []*storage.ObjectAttrs
+		var token string
+		if err := s.pacer.call(ctx, func() (err error) {
+			// An iterator that has failed keeps failing, so a new one is
+			// started after the last key listed
+			if pager == nil {
+				if last != "" {
+					query.StartOffset = last + "\x00"
+				}
+				pager = iterator.NewPager(s.client.Bucket(s.bucketName).Objects(ctx, query), gcsListPageSize, "")
+			}
+			if token, err = pager.NextPage(&page); err != nil {
+				pager = nil
+			}
+			return err
+		}); err != nil {
+			return "", false, err
 		}
-		if filter(attrs.Name) {
-			p := attrs.Name
-			if s.root != "" {
-				p = strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+		for _, attrs := range page {
+			last = attrs.Name
+			if !send(ListResult{Path: objectPath(s.root, attrs.Name), MD5: attrs.MD5, Size: attrs.Size, ETag: attrs.Etag}) {
+				return "", false, ctx.Err()
 			}
-			results <- ListResult{Path: p, MD5: attrs.MD5}
+		}
+		if token == "" {
+			return "", false, nil
+		}
+		if maxPages > 0 && pages >= maxPages {
+			return last, true, nil
 		}
 	}
-	close(results)
+}
+
+// gcsThrottled returns whether err means GCS is getting too many requests
+func gcsThrottled(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return gerr.Code == http.StatusTooManyRequests || gerr.Code == http.StatusServiceUnavailable
+	}
+	return false
 }
 
 // GetPath recursively copies repoDir to localDir
 func (s *GCSRepository) GetPath(repoDir string, localDir string) error {
-	prefix := filepath.Join(s.root, repoDir)
-	err := s.applyRecursive(prefix, func(obj *storage.ObjectHandle) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+	prefix := pathpkg.Join(s.root, repoDir)
+	progress := newTransferProgress(-1)
+	err := s.applyRecursive(encodeKey(prefix), func(obj *storage.ObjectHandle, attrs *storage.ObjectAttrs) error {
 		gcsPathString := fmt.Sprintf("gs://%s/%s", s.bucketName, obj.ObjectName())
-		reader, err := obj.NewReader(context.TODO())
-		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to open %s: %v", gcsPathString, err))
-		}
-		defer reader.Close()
+		ctx, cancel := withOverallTimeout(transferContext())
+		defer cancel()
 
-		relPath, err := filepath.Rel(prefix, obj.ObjectName())
-		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to determine directory of %s relative to %s: %v", obj.ObjectName(), repoDir, err))
-		}
-		localPath := filepath.Join(localDir, relPath)
+		localPath := filepath.Join(localDir, filepath.FromSlash(objectPath(prefix, obj.ObjectName())))
 		localDir := filepath.Dir(localPath)
 		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to create directory %s: %v", localDir, err))
+			return readError(err, fmt.Sprintf("Failed to create directory %s: %v", localDir, err))
 		}
 
 		f, err := os.Create(localPath)
 		if err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to create file %s: %v", localPath, err))
+			return readError(err, fmt.Sprintf("Failed to create file %s: %v", localPath, err))
 		}
 		defer f.Close()
 
-		console.Debug("Downloading %s to %s", gcsPathString, localPath)
-		if _, err := io.Copy(f, reader); err != nil {
-			return errors.ReadError(fmt.Sprintf("Failed to copy %s to %s: %v", gcsPathString, localPath, err))
+		gcsLog.Debug("Downloading %s to %s", gcsPathString, localPath)
+		start := time.Now()
+		size, err := s.download(ctx, obj, attrs, f)
+		if err != nil {
+			if stopped(ctx) {
+				return stoppedError("downloading", gcsPathString, progress)
+			}
+			return readError(err, fmt.Sprintf("Failed to download %s to %s: %v", gcsPathString, localPath, err))
 		}
+		gcsLog.Debug("Downloaded %s (%d bytes, took %.3f seconds)", gcsPathString, size, time.Since(start).Seconds())
+		progress.add()
 		return nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("Failed to copy gs://%s/%s to %s: %v", s.bucketName, repoDir, localDir, err)
+		if isStoppedError(err) {
+			return err
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return readError(err, fmt.Sprintf("Failed to copy gs://%s/%s to %s: %v", s.bucketName, repoDir, localDir, err))
 	}
 	return nil
 }
 
-func (s *GCSRepository) GetPathTar(tarPath, localPath string) error {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
-	if err != nil {
-		return err
+// objectSize returns the size in bytes of the object at path
+func (s *GCSRepository) objectSize(path string) (int64, error) {
+	if err := s.connect(); err != nil {
+		return 0, err
 	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return err
-	}
-	exists, err := files.FileExists(tmptarball)
+	attrs, err := s.client.Bucket(s.bucketName).Object(objectKey(s.root, path)).Attrs(context.TODO())
 	if err != nil {
-		return err
-	}
-	if !exists {
-		return errors.DoesNotExist(fmt.Sprintf("Path does not exist: %s", tmptarball))
+		if err == storage.ErrObjectNotExist {
+			return 0, errors.DoesNotExist(fmt.Sprintf("Path does not exist: %s/%s", s.RootURL(), path))
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return 0, cerr
+		}
+		return 0, readError(err, fmt.Sprintf("Failed to get the size of %s/%s: %s", s.RootURL(), path, err))
 	}
-	return extractTar(tmptarball, localPath)
+	return attrs.Size, nil
+}
+
+func (s *GCSRepository) GetPathTar(tarPath, localPath string) error {
+	return getPathTar(s, tarPath, "", localPath)
 }
 
 func (s *GCSRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
-	if err != nil {
-		return err
-	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return err
-	}
-	exists, err := files.FileExists(tmptarball)
-	if err != nil {
-		return err
-	}
-	if !exists {
-		return errors.DoesNotExist("Path does not exist: " + tmptarball)
-	}
-	return extractTarItem(tmptarball, itemPath, localPath)
+	return getPathTar(s, tarPath, itemPath, localPath)
 }
 
-func (s *GCSRepository) bucketExists() (bool, error) {
+func (s *GCSRepository) checkBucketExists() (bool, error) {
+	s.bucketMu.Lock()
+	exists := s.bucketExists
+	s.bucketMu.Unlock()
+	if exists {
+		return true, nil
+	}
 	bucket := s.client.Bucket(s.bucketName)
 	_, err := bucket.Attrs(context.TODO())
 	if err == nil {
+		s.setBucketExists()
 		return true, nil
 	}
 	if err == storage.ErrBucketNotExist {
 		return false, nil
 	}
+	if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+		return false, cerr
+	}
 	return false, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to determine if bucket gs://%s exists: %v", s.bucketName, err))
 }
 
+func (s *GCSRepository) setBucketExists() {
+	s.bucketMu.Lock()
+	defer s.bucketMu.Unlock()
+	s.bucketExists = true
+}
+
+func (s *GCSRepository) forgetBucketExists() {
+	s.bucketMu.Lock()
+	defer s.bucketMu.Unlock()
+	s.bucketExists = false
+}
+
 func (s *GCSRepository) ensureBucketExists() error {
-	exists, err := s.bucketExists()
+	exists, err := s.checkBucketExists()
 	if err != nil {
 		return err
 	}
@@ -410,19 +693,175 @@ func (s *GCSRepository) ensureBucketExists() error {
 }
 
 func (s *GCSRepository) CreateBucket() error {
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
 	projectID, err := s.getProjectID()
 	if err != nil {
 		return err
 	}
 	bucket := s.client.Bucket(s.bucketName)
 	if err := bucket.Create(context.TODO(), projectID, nil); err != nil {
-		return fmt.Errorf("Failed to create bucket gs://%s: %v", s.bucketName, err)
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to create bucket gs://%s: %v", s.bucketName, err))
 	}
+	s.setBucketExists()
 	return nil
 }
 
+// Archive rewrites the object at path in storageClass, which is ARCHIVE if it
+// is empty. Unlike S3 Glacier, objects in GCS's archive storage classes can be
+// read straight away, so they never have to be restored.
+func (s *GCSRepository) Archive(path string, storageClass string) (string, error) {
+	if storageClass == "" {
+		storageClass = "ARCHIVE"
+	}
+	if err := s.connectForWriting(); err != nil {
+		return "", err
+	}
+	key := objectKey(s.root, path)
+	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, key)
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	obj := s.client.Bucket(s.bucketName).Object(key)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return "", errors.DoesNotExist(fmt.Sprintf("Archive: path does not exist: %s", pathString))
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return "", cerr
+		}
+		return "", readError(err, fmt.Sprintf("Failed to get status of %s: %s", pathString, err))
+	}
+	if attrs.StorageClass == storageClass {
+		return storageClass, nil
+	}
+
+	gcsLog.Debug("Moving %s to %s", pathString, storageClass)
+	// The object's metadata is replaced by the copier's, so it is copied over
+	copier := obj.CopierFrom(obj.Generation(attrs.Generation))
+	copier.ContentType = attrs.ContentType
+	copier.ContentEncoding = attrs.ContentEncoding
+	copier.CacheControl = attrs.CacheControl
+	copier.Metadata = attrs.Metadata
+	copier.StorageClass = storageClass
+	if _, err := copier.Run(ctx); err != nil {
+		if stopped(ctx) {
+			return "", stoppedError("archiving", pathString, nil)
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return "", cerr
+		}
+		return "", writeError(err, fmt.Sprintf("Failed to move %s to %s: %s", pathString, storageClass, err))
+	}
+	return storageClass, nil
+}
+
+// Copy copies the object at src to dest inside the bucket, by rewriting it
+// with CopierFrom, which doesn't download it. Its storage class and metadata
+// are kept.
+func (s *GCSRepository) Copy(src, dest string) error {
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(dest)
+	srcKey, destKey := objectKey(s.root, src), objectKey(s.root, dest)
+	pathString := fmt.Sprintf("gs://%s/%s", s.bucketName, srcKey)
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	bucket := s.client.Bucket(s.bucketName)
+	srcObj := bucket.Object(srcKey)
+	attrs, err := srcObj.Attrs(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return errors.DoesNotExist(fmt.Sprintf("Copy: path does not exist: %s", pathString))
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return readError(err, fmt.Sprintf("Failed to get status of %s: %s", pathString, err))
+	}
+
+	gcsLog.Debug("Copying %s to %s", pathString, dest)
+	// The object's metadata is replaced by the copier's, so it is copied over
+	copier := bucket.Object(destKey).CopierFrom(srcObj.Generation(attrs.Generation))
+	copier.ContentType = attrs.ContentType
+	copier.ContentEncoding = attrs.ContentEncoding
+	copier.CacheControl = attrs.CacheControl
+	copier.Metadata = attrs.Metadata
+	copier.StorageClass = attrs.StorageClass
+	if _, err := copier.Run(ctx); err != nil {
+		if stopped(ctx) {
+			return stoppedError("copying", pathString, nil)
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to copy %s to %s: %s", pathString, dest, err))
+	}
+	return nil
+}
+
+// Move copies the object at src to dest, then deletes src. GCS can't rename
+// objects.
+func (s *GCSRepository) Move(src, dest string) error {
+	if err := s.Copy(src, dest); err != nil {
+		return err
+	}
+	s.listCache.invalidate(src)
+	key := objectKey(s.root, src)
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	if err := s.client.Bucket(s.bucketName).Object(key).Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+		if stopped(ctx) {
+			return stoppedError("deleting", fmt.Sprintf("gs://%s/%s", s.bucketName, key), nil)
+		}
+		if cerr := gcsCredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), src, err))
+	}
+	return nil
+}
+
+// download downloads obj to f and returns its size. Objects bigger than the
+// download chunk size are downloaded as several ranges at once, and checked
+// against their CRC32C checksum once they have been.
+func (s *GCSRepository) download(ctx context.Context, obj *storage.ObjectHandle, attrs *storage.ObjectAttrs, f *os.File) (int64, error) {
+	// Objects stored compressed are decompressed as they are read, so ranges
+	// of them can't be read
+	if attrs.Size <= currentDownloads().ChunkSize || attrs.ContentEncoding == "gzip" {
+		reader, err := obj.NewReader(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer reader.Close()
+		return io.Copy(f, reader)
+	}
+	// Every range is read from the same generation, in case the object is
+	// overwritten while it is being downloaded
+	obj = obj.Generation(attrs.Generation)
+	err := downloadRanges(ctx, f, attrs.Size, func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return obj.NewRangeReader(ctx, offset, length)
+	})
+	if err != nil {
+		return 0, err
+	}
+	sum, err := fileChecksum(f.Name(), 0, -1, crc32.New(crc32.MakeTable(crc32.Castagnoli)))
+	if err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(sum) != attrs.CRC32C {
+		return 0, errors.Transient("The downloaded file doesn't match the object's CRC32C checksum, so it was corrupted while it was being downloaded")
+	}
+	return attrs.Size, nil
+}
+
 // Note: prefix does not include s.root
-func (s *GCSRepository) applyRecursive(prefix string, fn func(obj *storage.ObjectHandle) error) error {
+func (s *GCSRepository) applyRecursive(prefix string, fn func(obj *storage.ObjectHandle, attrs *storage.ObjectAttrs) error) error {
 	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
 
 	bucket := s.client.Bucket(s.bucketName)
@@ -440,7 +879,7 @@ func (s *GCSRepository) applyRecursive(prefix string, fn func(obj *storage.Objec
 
 		err = queue.Go(func() error {
 			obj := bucket.Object(attrs.Name)
-			return fn(obj)
+			return fn(obj, attrs)
 		})
 		if err != nil {
 			return err
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCSBucketExistsIsPerRepository(t *testing.T) {
+	fake := newFakeGCS()
+	first, closeFirst := newFakeGCSRepository(t, fake, "first")
+	defer closeFirst()
+	second, closeSecond := newFakeGCSRepository(t, fake, "second")
+	defer closeSecond()
+
+	exists, err := first.checkBucketExists()
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// The bucket is deleted behind both repositories' backs. The first
+	// remembers that it existed, but the second didn't learn that from it,
+	// so it finds out it has gone.
+	fake.mu.Lock()
+	delete(fake.buckets, "bucket")
+	fake.mu.Unlock()
+	exists, err = first.checkBucketExists()
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = second.checkBucketExists()
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestGCSBucketNotFoundForgetsBucketExists(t *testing.T) {
+	fake := newFakeGCS()
+	repo, closeServer := newFakeGCSRepository(t, fake, "root")
+	defer closeServer()
+
+	exists, err := repo.checkBucketExists()
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	fake.mu.Lock()
+	delete(fake.buckets, "bucket")
+	fake.mu.Unlock()
+
+	// Listing finds out the bucket has gone, so it is checked again
+	require.Empty(t, listedPaths(t, repo, "checkpoints"))
+	exists, err = repo.checkBucketExists()
+	require.NoError(t, err)
+	require.False(t, exists)
+}
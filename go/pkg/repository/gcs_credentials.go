@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Google Cloud credentials that don't need a downloaded service account key:
+// impersonating a service account with your own credentials, and workload
+// identity federation, where a token from another identity provider (e.g. the
+// OIDC token of a CI job) is exchanged for Google credentials. The version of
+// the oauth2 library we use doesn't support either, so the token exchanges are
+// done here.
+
+const (
+	cloudPlatformScope     = "https://www.googleapis.com/auth/cloud-platform"
+	generateAccessTokenURL = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken"
+)
+
+// gcsTokenSource returns the token source for Google Cloud Storage clients.
+// Tokens are fetched with the HTTP client in ctx.
+func gcsTokenSource(ctx context.Context, options GCSOptions) (oauth2.TokenSource, error) {
+	// Impersonation needs the base credentials to be able to call the IAM API
+	scope := storage.ScopeReadWrite
+	if options.ImpersonateServiceAccount != "" {
+		scope = cloudPlatformScope
+	}
+
+	var base oauth2.TokenSource
+	if helper := credentialHelper(options.CredentialHelper); helper != "" {
+		base = oauth2.ReuseTokenSource(nil, &credentialHelperTokenSource{helper: helper, bucket: options.bucket})
+	} else if applicationCredentialsJSON := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON"); applicationCredentialsJSON != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(applicationCredentialsJSON), scope)
+		if err != nil {
+			return nil, err
+		}
+		base = jwtConfig.TokenSource(ctx)
+	} else if credentialsPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); credentialsPath != "" {
+		data, err := ioutil.ReadFile(credentialsPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+		}
+		account := new(externalAccount)
+		if err := json.Unmarshal(data, account); err == nil && account.Type == "external_account" {
+			if err := account.validate(); err != nil {
+				return nil, err
+			}
+			base = oauth2.ReuseTokenSource(nil, &externalAccountTokenSource{ctx: ctx, account: account, scope: scope})
+		}
+	}
+
+	if base == nil {
+		var err error
+		base, err = google.DefaultTokenSource(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.ImpersonateServiceAccount == "" {
+		return base, nil
+	}
+	return oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+		ctx:   ctx,
+		base:  base,
+		url:   fmt.Sprintf(generateAccessTokenURL, url.PathEscape(options.ImpersonateServiceAccount)),
+		scope: storage.ScopeReadWrite,
+	}), nil
+}
+
+// impersonatedTokenSource gets tokens for a service account from the IAM
+// Credentials API, using the credentials of base
+type impersonatedTokenSource struct {
+	ctx   context.Context
+	base  oauth2.TokenSource
+	url   string
+	scope string
+}
+
+func (ts *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    []string{ts.scope},
+		"lifetime": "3600s",
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", ts.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+		ExpireTime  string `json:"expireTime"`
+	}
+	if err := doTokenRequest(oauth2.NewClient(ts.ctx, ts.base), req.WithContext(ts.ctx), &resp); err != nil {
+		return nil, fmt.Errorf("Failed to impersonate service account: %w", err)
+	}
+	expiry, err := time.Parse(time.RFC3339, resp.ExpireTime)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to impersonate service account: invalid expiry time %q", resp.ExpireTime)
+	}
+	return &oauth2.Token{AccessToken: resp.AccessToken, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// externalAccount is a credential configuration file for workload identity
+// federation, as made by `gcloud iam workload-identity-pools create-cred-config`
+type externalAccount struct {
+	Type                           string `json:"type"`
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	TokenURL                       string `json:"token_url"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		EnvironmentID string            `json:"environment_id"`
+		File          string            `json:"file"`
+		URL           string            `json:"url"`
+		Headers       map[string]string `json:"headers"`
+		Format        struct {
+			Type                  string `json:"type"`
+			SubjectTokenFieldName string `json:"subject_token_field_name"`
+		} `json:"format"`
+	} `json:"credential_source"`
+}
+
+func (a *externalAccount) validate() error {
+	if a.CredentialSource.EnvironmentID != "" {
+		return fmt.Errorf("The workload identity federation credentials in GOOGLE_APPLICATION_CREDENTIALS use %s, which isn't supported. Only credentials that read a token from a file or URL are supported.", a.CredentialSource.EnvironmentID)
+	}
+	if a.CredentialSource.File == "" && a.CredentialSource.URL == "" {
+		return fmt.Errorf("The workload identity federation credentials in GOOGLE_APPLICATION_CREDENTIALS don't have a file or URL to read a token from")
+	}
+	if a.Audience == "" || a.TokenURL == "" {
+		return fmt.Errorf("The workload identity federation credentials in GOOGLE_APPLICATION_CREDENTIALS must have an audience and token_url")
+	}
+	return nil
+}
+
+// subjectToken reads the token from the other identity provider
+func (a *externalAccount) subjectToken(ctx context.Context) (string, error) {
+	source := a.CredentialSource
+	var data []byte
+	if source.File != "" {
+		var err error
+		data, err = ioutil.ReadFile(source.File)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		req, err := http.NewRequest("GET", source.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		for name, value := range source.Headers {
+			req.Header.Set(name, value)
+		}
+		client, err := getHTTPClient()
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s returned %s: %s", source.URL, resp.Status, strings.TrimSpace(string(data)))
+		}
+	}
+
+	if source.Format.Type != "json" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("Failed to parse token as JSON: %w", err)
+	}
+	token, ok := fields[source.Format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("The token doesn't have a %q field", source.Format.SubjectTokenFieldName)
+	}
+	return token, nil
+}
+
+// externalAccountTokenSource exchanges the token from the other identity
+// provider for a Google access token, impersonating a service account if the
+// configuration has one
+type externalAccountTokenSource struct {
+	ctx     context.Context
+	account *externalAccount
+	scope   string
+}
+
+func (ts *externalAccountTokenSource) Token() (*oauth2.Token, error) {
+	subjectToken, err := ts.account.subjectToken(ts.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read token for workload identity federation: %w", err)
+	}
+	// Access to service accounts is granted with the cloud-platform scope,
+	// and the impersonated token is narrowed down to ts.scope
+	scope := ts.scope
+	if ts.account.ServiceAccountImpersonationURL != "" {
+		scope = cloudPlatformScope
+	}
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {ts.account.Audience},
+		"scope":                {scope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {ts.account.SubjectTokenType},
+	}
+	req, err := http.NewRequest("POST", ts.account.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	client, err := getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := doTokenRequest(client, req.WithContext(ts.ctx), &resp); err != nil {
+		return nil, fmt.Errorf("Failed to exchange token for workload identity federation: %w", err)
+	}
+	token := &oauth2.Token{
+		AccessToken: resp.AccessToken,
+		TokenType:   resp.TokenType,
+		Expiry:      time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}
+	if ts.account.ServiceAccountImpersonationURL == "" {
+		return token, nil
+	}
+	impersonated := &impersonatedTokenSource{
+		ctx:   ts.ctx,
+		base:  oauth2.StaticTokenSource(token),
+		url:   ts.account.ServiceAccountImpersonationURL,
+		scope: ts.scope,
+	}
+	return impersonated.Token()
+}
+
+// doTokenRequest sends req with client and decodes the JSON response into out
+func doTokenRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", req.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
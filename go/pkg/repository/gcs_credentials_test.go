@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestGCSTokenSourceWorkloadIdentityFederation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", r.Form.Get("grant_type"))
+			require.Equal(t, "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/providers/github", r.Form.Get("audience"))
+			require.Equal(t, "ci-token", r.Form.Get("subject_token"))
+			require.Equal(t, cloudPlatformScope, r.Form.Get("scope"))
+			w.Write([]byte(`{"access_token": "federated-token", "token_type": "Bearer", "expires_in": 3600}`))
+		case "/impersonate":
+			require.Equal(t, "Bearer federated-token", r.Header.Get("Authorization"))
+			body := struct {
+				Scope []string `json:"scope"`
+			}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, []string{"https://www.googleapis.com/auth/devstorage.read_write"}, body.Scope)
+			w.Write([]byte(`{"accessToken": "service-account-token", "expireTime": "2030-01-02T15:04:05Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := files.TempDir("gcs-credentials-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token.json")
+	require.NoError(t, ioutil.WriteFile(tokenPath, []byte(`{"id_token": "ci-token"}`), 0644))
+	credentials, err := json.Marshal(map[string]interface{}{
+		"type":                              "external_account",
+		"audience":                          "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/providers/github",
+		"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":                         server.URL + "/token",
+		"service_account_impersonation_url": server.URL + "/impersonate",
+		"credential_source": map[string]interface{}{
+			"file":   tokenPath,
+			"format": map[string]string{"type": "json", "subject_token_field_name": "id_token"},
+		},
+	})
+	require.NoError(t, err)
+	credentialsPath := filepath.Join(dir, "credentials.json")
+	require.NoError(t, ioutil.WriteFile(credentialsPath, credentials, 0644))
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentialsPath)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	tokenSource, err := gcsTokenSource(context.Background(), GCSOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, tokenSource)
+	token, err := tokenSource.Token()
+	require.NoError(t, err)
+	require.Equal(t, "service-account-token", token.AccessToken)
+	require.Equal(t, 2030, token.Expiry.Year())
+}
+
+func TestGCSTokenSourceUnsupportedExternalAccount(t *testing.T) {
+	dir, err := files.TempDir("gcs-credentials-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	credentialsPath := filepath.Join(dir, "credentials.json")
+	require.NoError(t, ioutil.WriteFile(credentialsPath, []byte(`{
+  "type": "external_account",
+  "audience": "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/providers/aws",
+  "token_url": "https://sts.googleapis.com/v1/token",
+  "credential_source": {"environment_id": "aws1"}
+}`), 0644))
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentialsPath)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	_, err = gcsTokenSource(context.Background(), GCSOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "aws1")
+}
@@ -150,25 +150,30 @@ func TestGCSRepository(t *testing.T) {
 
 		// Works with empty repository
 		results := make(chan ListResult)
-		go repository.ListRecursive(results, "checkpoints")
+		go repository.ListRecursive(context.Background(), results, "checkpoints")
 		require.Empty(t, <-results)
 
 		// Lists stuff!
 		require.NoError(t, repository.Put("checkpoints/abc123.json", []byte("yep")))
 		require.NoError(t, repository.Put("experiments/def456.json", []byte("nope")))
 		results = make(chan ListResult)
-		go repository.ListRecursive(results, "checkpoints")
+		go repository.ListRecursive(context.Background(), results, "checkpoints")
+		result := <-results
+		// GCS's ETags are opaque
+		require.NotEmpty(t, result.ETag)
+		result.ETag = ""
 		require.Equal(t, ListResult{
 			Path: "checkpoints/abc123.json",
 			MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
-		}, <-results)
+			Size: 3,
+		}, result)
 		require.Empty(t, <-results)
 
 		// Works with non-existent bucket
 		repository, err = NewGCSRepository("replicate-test-"+hash.Random()[0:10], "")
 		require.NoError(t, err)
 		results = make(chan ListResult)
-		go repository.ListRecursive(results, "checkpoints")
+		go repository.ListRecursive(context.Background(), results, "checkpoints")
 		require.Empty(t, <-results)
 	})
 }
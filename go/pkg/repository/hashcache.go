@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Hashes of directories with fewer files and bytes than this aren't cached
+const (
+	minHashCacheFiles = 1000
+	minHashCacheSize  = 100 * 1024 * 1024
+)
+
+// hashCache remembers the MD5 of each file in a directory on disk, so files
+// that haven't changed since they were last hashed don't need to be read
+// again. It is saved in the user's cache directory, keyed by the directory.
+type hashCache struct {
+	path    string
+	entries map[string]hashCacheEntry
+}
+
+type hashCacheEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+	// Hashed is when the file was about to be hashed. A file that changed
+	// in the same second could still have the same modification time
+	// afterwards on filesystems with coarse timestamps, so the hash is only
+	// trusted if the file was modified in an earlier second.
+	Hashed int64  `json:"hashed"`
+	MD5    []byte `json:"md5"`
+}
+
+// hashCacheDir returns the directory hash caches are saved in, or "" if they
+// aren't saved
+func hashCacheDir() string {
+	if dir := os.Getenv("REPLICATE_HASH_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "replicate", "hashes")
+}
+
+// loadHashCache loads the hash cache of the files in rootDir. If it can't be
+// read, it starts empty.
+func loadHashCache(rootDir string) *hashCache {
+	cache := &hashCache{entries: map[string]hashCacheEntry{}}
+	dir := hashCacheDir()
+	if dir == "" {
+		return cache
+	}
+	absDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return cache
+	}
+	sum := sha1.Sum([]byte(absDir))
+	cache.path = filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+
+	data, err := ioutil.ReadFile(cache.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			console.Debug("Failed to read hash cache %s: %s", cache.path, err)
+		}
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		console.Debug("Failed to parse hash cache %s: %s", cache.path, err)
+		cache.entries = map[string]hashCacheEntry{}
+	}
+	return cache
+}
+
+// get returns the MD5 of the file at relPath, if it hasn't changed since it
+// was hashed
+func (c *hashCache) get(relPath string, info os.FileInfo) ([]byte, bool) {
+	entry, ok := c.entries[relPath]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	if entry.ModTime >= time.Unix(0, entry.Hashed).Truncate(time.Second).UnixNano() {
+		return nil, false
+	}
+	return entry.MD5, true
+}
+
+// replace replaces the entries in folder with results, which are all the
+// files in it, and saves the cache
+func (c *hashCache) replace(folder string, results map[string]hashCacheEntry) {
+	if c.path == "" {
+		return
+	}
+	prefix := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(folder)), "/") + "/"
+	for relPath := range c.entries {
+		if folder == "" || folder == "." || strings.HasPrefix(relPath, prefix) {
+			delete(c.entries, relPath)
+		}
+	}
+	for relPath, entry := range results {
+		c.entries[relPath] = entry
+	}
+	if err := c.save(); err != nil {
+		console.Debug("Failed to save hash cache %s: %s", c.path, err)
+	}
+}
+
+func (c *hashCache) save() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// Written to a temporary file and renamed, so other processes listing
+	// the same directory never read half of it
+	f, err := ioutil.TempFile(filepath.Dir(c.path), ".hashes-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+func newHashCacheEntry(info os.FileInfo, md5sum []byte, hashed time.Time) hashCacheEntry {
+	return hashCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Hashed:  hashed.UnixNano(),
+		MD5:     md5sum,
+	}
+}
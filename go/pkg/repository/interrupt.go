@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Uploads, downloads, deletions and listings of S3 and GCS repositories run
+// in transferCtx, so they can all be stopped at once when the process is
+// asked to exit
+var transferCtx, cancelTransfers = context.WithCancel(context.Background())
+
+// abortTimeout is how long cleaning up after a stopped transfer, such as
+// aborting a multipart upload, can take
+const abortTimeout = 10 * time.Second
+
+// CancelTransfers stops the transfers that are in progress, and makes any
+// that start later fail straight away, with an Interrupted error. Multipart
+// uploads that are in progress are aborted, so they don't leave parts behind
+// in the bucket.
+func CancelTransfers() {
+	cancelTransfers()
+}
+
+// TransfersCancelled returns whether CancelTransfers has been called
+func TransfersCancelled() bool {
+	return transferCtx.Err() != nil
+}
+
+func transferContext() context.Context {
+	return transferCtx
+}
+
+// stopped returns whether an operation using ctx failed because the overall
+// timeout passed or transfers were cancelled
+func stopped(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+// stoppedError returns the error for an operation on url being stopped, with
+// the same arguments as timeoutError
+func stoppedError(verb string, url string, progress *transferProgress) error {
+	if !TransfersCancelled() {
+		return timeoutError(verb, url, progress)
+	}
+	msg := fmt.Sprintf("Interrupted %s %s", verb, url)
+	if progress != nil {
+		msg += fmt.Sprintf(" (%s finished)", progress)
+	}
+	return errors.Interrupted(msg)
+}
+
+// isStoppedError returns whether err is from stoppedError, so it is returned
+// as it is rather than wrapped in a read or write error
+func isStoppedError(err error) bool {
+	return errors.IsTimedOut(err) || errors.IsInterrupted(err)
+}
@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Listing a bucket with millions of objects in it takes millions of LIST
+// requests, which can take hours. S3 Inventory and GCS Storage Insights
+// write a listing of a whole bucket every day or week, as a few CSV files
+// and a manifest, so maintenance that needs to know everything in a
+// repository can read one of those instead.
+//
+// An inventory is a snapshot, so it doesn't have the objects saved since it
+// was made, and still has the objects deleted since.
+
+// Inventory is a listing of every object in a bucket
+type Inventory struct {
+	// URL is the URL of the inventory's manifest
+	URL string
+	// Created is when the bucket was listed
+	Created time.Time
+
+	// sourceBucket is the bucket that was listed, if the inventory says
+	sourceBucket string
+	// objects are keys in the source bucket, sorted by key
+	objects []inventoryObject
+}
+
+type inventoryObject struct {
+	key  string
+	md5  []byte
+	size int64
+	etag string
+}
+
+// s3InventoryManifest is the manifest.json that S3 Inventory writes next to
+// each inventory
+type s3InventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// gcsInventoryManifest is the manifest that GCS Storage Insights writes next
+// to each inventory report
+type gcsInventoryManifest struct {
+	SnapshotTime   time.Time `json:"snapshot_time"`
+	ShardFileNames []string  `json:"report_shards_file_names"`
+}
+
+// LoadInventory reads the inventory whose manifest is at inventoryURL, which
+// must be on S3 or GCS. If inventoryURL is a folder, the newest manifest in
+// it is read, so it can be the folder that a daily inventory is written to.
+func LoadInventory(inventoryURL string) (*Inventory, error) {
+	scheme, bucket, manifestPath, err := SplitURL(inventoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if scheme != SchemeS3 && scheme != SchemeGCS {
+		return nil, fmt.Errorf("Inventories can only be read from S3 or Google Cloud Storage, not %s", inventoryURL)
+	}
+	// S3 inventories refer to their files by their keys in the bucket, so
+	// the whole bucket is opened. Options such as an S3 role are kept.
+	bucketURL := string(scheme) + "://" + bucket
+	if i := strings.Index(inventoryURL, "?"); i != -1 {
+		bucketURL += inventoryURL[i:]
+	}
+	repo, err := ForURL(bucketURL, "")
+	if err != nil {
+		return nil, err
+	}
+	return loadInventory(repo, scheme, manifestPath)
+}
+
+// loadInventory reads the inventory with its manifest at manifestPath in
+// repo, which is the root of a bucket. scheme is the kind of bucket that
+// wrote it.
+func loadInventory(repo Repository, scheme Scheme, manifestPath string) (*Inventory, error) {
+	if !strings.HasSuffix(manifestPath, "manifest.json") {
+		latest, err := latestInventoryManifest(repo, manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		manifestPath = latest
+	}
+	data, err := repo.Get(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read inventory manifest: %w", err)
+	}
+
+	var inv *Inventory
+	if scheme == SchemeS3 {
+		inv, err = readS3Inventory(repo, data)
+	} else {
+		inv, err = readGCSInventory(repo, pathpkg.Dir(manifestPath), data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read inventory %s: %w", manifestPath, err)
+	}
+	inv.URL = strings.TrimSuffix(repo.RootURL(), "/") + "/" + manifestPath
+	sort.Slice(inv.objects, func(i, j int) bool {
+		return inv.objects[i].key < inv.objects[j].key
+	})
+	console.Debug("Read inventory %s of %d objects, made %s ago", inv.URL, len(inv.objects), time.Since(inv.Created).Round(time.Minute))
+	return inv, nil
+}
+
+// latestInventoryManifest returns the path of the newest manifest in folder.
+// Both S3 and GCS put the date in the path of each inventory, so the newest
+// is the last one.
+func latestInventoryManifest(repo Repository, folder string) (string, error) {
+	results, err := ListRecursiveAll(context.Background(), repo, folder)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, result := range results {
+		if strings.HasSuffix(result.Path, "manifest.json") && result.Path > latest {
+			latest = result.Path
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("There are no inventory manifests in %s/%s", strings.TrimSuffix(repo.RootURL(), "/"), folder)
+	}
+	return latest, nil
+}
+
+func readS3Inventory(repo Repository, data []byte) (*Inventory, error) {
+	manifest := new(s3InventoryManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.FileFormat != "CSV" {
+		return nil, fmt.Errorf("Only CSV inventories can be read, not %s", manifest.FileFormat)
+	}
+	millis, err := strconv.ParseInt(manifest.CreationTimestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid creationTimestamp: %w", err)
+	}
+	inv := &Inventory{Created: time.Unix(0, millis*int64(time.Millisecond)).UTC(), sourceBucket: manifest.SourceBucket}
+
+	// S3 inventory files don't have a header, so the columns are in the
+	// manifest
+	columns := map[string]int{}
+	for i, name := range strings.Split(manifest.FileSchema, ",") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	keyColumn, ok := columns["Key"]
+	if !ok {
+		return nil, fmt.Errorf("The inventory doesn't have a Key column")
+	}
+	sizeColumn, ok := columns["Size"]
+	if !ok {
+		return nil, fmt.Errorf("The inventory doesn't have a Size column, so it can't be used. Add the Size field to the inventory's configuration.")
+	}
+	etagColumn, hasETag := columns["ETag"]
+	isLatestColumn, hasIsLatest := columns["IsLatest"]
+	isDeleteMarkerColumn, hasIsDeleteMarker := columns["IsDeleteMarker"]
+
+	for _, file := range manifest.Files {
+		err := readInventoryCSV(repo, file.Key, func(record []string) error {
+			// Inventories of versioned buckets have every version of
+			// every object
+			if hasIsLatest && record[isLatestColumn] != "true" {
+				return nil
+			}
+			if hasIsDeleteMarker && record[isDeleteMarkerColumn] == "true" {
+				return nil
+			}
+			key, err := url.QueryUnescape(record[keyColumn])
+			if err != nil {
+				return fmt.Errorf("Invalid key %q: %w", record[keyColumn], err)
+			}
+			size, err := strconv.ParseInt(record[sizeColumn], 10, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid size of %s: %w", key, err)
+			}
+			object := inventoryObject{key: key, size: size}
+			if hasETag {
+				object.etag = record[etagColumn]
+				// As in listings, the ETag of a multipart upload isn't an
+				// MD5, so it is left blank
+				if md5, err := hex.DecodeString(record[etagColumn]); err == nil {
+					object.md5 = md5
+				}
+			}
+			inv.objects = append(inv.objects, object)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+func readGCSInventory(repo Repository, dir string, data []byte) (*Inventory, error) {
+	manifest := new(gcsInventoryManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	inv := &Inventory{Created: manifest.SnapshotTime.UTC()}
+
+	for _, name := range manifest.ShardFileNames {
+		// GCS inventory files have a header with the names of the columns
+		nameColumn, sizeColumn, md5Column, bucketColumn := -1, -1, -1, -1
+		header := true
+		err := readInventoryCSV(repo, pathpkg.Join(dir, name), func(record []string) error {
+			if header {
+				header = false
+				for i, column := range record {
+					switch column {
+					case "name":
+						nameColumn = i
+					case "size":
+						sizeColumn = i
+					case "md5Hash":
+						md5Column = i
+					case "bucket":
+						bucketColumn = i
+					}
+				}
+				if nameColumn == -1 || sizeColumn == -1 {
+					return fmt.Errorf("The inventory must have the name and size fields, and a header. Add them to the inventory's configuration.")
+				}
+				return nil
+			}
+			size, err := strconv.ParseInt(record[sizeColumn], 10, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid size of %s: %w", record[nameColumn], err)
+			}
+			object := inventoryObject{key: record[nameColumn], size: size}
+			if md5Column != -1 {
+				// Composite objects don't have an MD5
+				if md5, err := base64.StdEncoding.DecodeString(record[md5Column]); err == nil && len(md5) > 0 {
+					object.md5 = md5
+				}
+			}
+			if bucketColumn != -1 {
+				inv.sourceBucket = record[bucketColumn]
+			}
+			inv.objects = append(inv.objects, object)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+// readInventoryCSV calls fn with each record of the CSV file at filePath in
+// repo, which is decompressed if it is gzipped
+func readInventoryCSV(repo Repository, filePath string, fn func(record []string) error) error {
+	data, err := repo.Get(filePath)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader = bytes.NewReader(data)
+	if strings.HasSuffix(filePath, ".gz") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("Failed to decompress %s: %w", filePath, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	// Every record must have the same number of fields as the first
+	r := csv.NewReader(reader)
+	r.ReuseRecord = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", filePath, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// Age returns how long ago the bucket was listed
+func (inv *Inventory) Age() time.Duration {
+	return time.Since(inv.Created)
+}
+
+// ListRecursiveAll is like the ListRecursiveAll function, but lists the
+// files in each of folders in the repository at repositoryURL from the
+// inventory
+func (inv *Inventory) ListRecursiveAll(repositoryURL string, folders ...string) ([]ListResult, error) {
+	_, bucket, root, err := SplitURL(repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if inv.sourceBucket != "" && inv.sourceBucket != bucket {
+		return nil, fmt.Errorf("The inventory %s is of the bucket %s, not the bucket of %s", inv.URL, inv.sourceBucket, repositoryURL)
+	}
+	results := []ListResult{}
+	for _, folder := range folders {
+		prefix := strings.TrimPrefix(objectKey(root, folder), "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		i := sort.Search(len(inv.objects), func(i int) bool {
+			return inv.objects[i].key >= prefix
+		})
+		for ; i < len(inv.objects) && strings.HasPrefix(inv.objects[i].key, prefix); i++ {
+			object := inv.objects[i]
+			results = append(results, ListResult{Path: objectPath(root, object.key), MD5: object.md5, Size: object.size, ETag: object.etag})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func inventoryPaths(t *testing.T, inv *Inventory, repositoryURL string, folders ...string) map[string]int64 {
+	results, err := inv.ListRecursiveAll(repositoryURL, folders...)
+	require.NoError(t, err)
+	sizes := map[string]int64{}
+	for _, result := range results {
+		sizes[result.Path] = result.Size
+	}
+	return sizes
+}
+
+func TestS3Inventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bucket, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	folder := "inventory/hotdog/daily/"
+	require.NoError(t, bucket.Put(folder+"2026-10-14T01-00Z/manifest.json", []byte(`{"sourceBucket": "hotdog", "creationTimestamp": "1791939600000", "fileFormat": "CSV", "fileSchema": "Bucket, Key, Size", "files": []}`)))
+	require.NoError(t, bucket.Put(folder+"2026-10-15T01-00Z/manifest.json", []byte(`{
+  "sourceBucket": "hotdog",
+  "destinationBucket": "arn:aws:s3:::inventory",
+  "creationTimestamp": "1792026000000",
+  "fileFormat": "CSV",
+  "fileSchema": "Bucket, Key, IsLatest, IsDeleteMarker, Size, ETag",
+  "files": [{"key": "inventory/hotdog/daily/data/1.csv.gz"}]
+}`)))
+	require.NoError(t, bucket.Put(folder+"data/1.csv.gz", gzipped(t, `"hotdog","root/experiments/1eee.tar.gz","true","false","100","d41d8cd98f00b204e9800998ecf8427e"
+"hotdog","root/checkpoints/1ccc%20copy.tar.gz","true","false","200","d41d8cd98f00b204e9800998ecf8427e-2"
+"hotdog","root/checkpoints/2ccc.tar.gz","false","false","300",""
+"hotdog","root/checkpoints/3ccc.tar.gz","true","true","",""
+"hotdog","root/metadata/experiments/1eee.json","true","false","10",""
+"hotdog","other/experiments/2eee.tar.gz","true","false","400",""
+`)))
+
+	// The newest manifest in the folder is read
+	inv, err := loadInventory(bucket, SchemeS3, folder)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1792026000, 0).UTC(), inv.Created)
+	require.Equal(t, map[string]int64{
+		"experiments/1eee.tar.gz":      100,
+		"checkpoints/1ccc copy.tar.gz": 200,
+	}, inventoryPaths(t, inv, "s3://hotdog/root", "experiments", "checkpoints"))
+
+	results, err := inv.ListRecursiveAll("s3://hotdog/root", "experiments")
+	require.NoError(t, err)
+	require.Len(t, results[0].MD5, 16)
+	// The ETag of a multipart upload isn't an MD5
+	results, err = inv.ListRecursiveAll("s3://hotdog/root", "checkpoints")
+	require.NoError(t, err)
+	require.Nil(t, results[0].MD5)
+
+	_, err = inv.ListRecursiveAll("s3://another-bucket/root", "experiments")
+	require.Error(t, err)
+}
+
+func TestGCSInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bucket, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, bucket.Put("reports/hotdog_2026-10-15_manifest.json", []byte(`{
+  "records_processed": 3,
+  "snapshot_time": "2026-10-15T00:00:00Z",
+  "shard_count": 1,
+  "report_shards_file_names": ["hotdog_2026-10-15_0.csv"]
+}`)))
+	require.NoError(t, bucket.Put("reports/hotdog_2026-10-15_0.csv", []byte(`bucket,name,size,md5Hash
+hotdog,experiments/1eee.tar.gz,100,1B2M2Y8AsgTpgAmY7PhCfg==
+hotdog,checkpoints/1ccc.tar.gz,200,
+hotdog,metadata/experiments/1eee.json,10,1B2M2Y8AsgTpgAmY7PhCfg==
+`)))
+
+	inv, err := loadInventory(bucket, SchemeGCS, "reports/hotdog_2026-10-15_manifest.json")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), inv.Created)
+	require.Equal(t, map[string]int64{
+		"experiments/1eee.tar.gz": 100,
+		"checkpoints/1ccc.tar.gz": 200,
+	}, inventoryPaths(t, inv, "gs://hotdog", "experiments", "checkpoints"))
+
+	// Inventories without sizes can't be used
+	require.NoError(t, bucket.Put("reports/hotdog_2026-10-15_0.csv", []byte("bucket,name\nhotdog,experiments/1eee.tar.gz\n")))
+	_, err = loadInventory(bucket, SchemeGCS, "reports/hotdog_2026-10-15_manifest.json")
+	require.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"fmt"
+	pathpkg "path"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// Paths in a repository are slash-separated, and can have anything in them
+// that a local filename can. Object stores and filesystems each accept a
+// different subset of that, so paths are escaped on the way into a backend
+// and unescaped on the way out. Characters are escaped as %XX, one for each
+// byte. Anything that doesn't need escaping (spaces, +, #, unicode, etc) is
+// left alone, so keys are still readable in the S3 and GCS consoles.
+
+// encodeKey returns the object key for path. S3 and GCS keys must be valid
+// UTF-8, and S3 can't return control characters in listings, so those are
+// escaped, along with % itself.
+func encodeKey(path string) string {
+	return escapePath(path, false)
+}
+
+// decodeKey returns the path for an object key. Anything that isn't a valid
+// escape is left as it is, so keys written before paths were escaped are
+// still read correctly.
+func decodeKey(key string) string {
+	if !strings.Contains(key, "%") {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		if key[i] == '%' && i+2 < len(key) && isHex(key[i+1]) && isHex(key[i+2]) {
+			b.WriteByte(unhex(key[i+1])<<4 | unhex(key[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+// NeedsEscaping returns whether path is escaped by any backend, so older
+// versions of Replicate, which don't unescape paths, would misread it
+func NeedsEscaping(path string) bool {
+	return escapePath(path, true) != path
+}
+
+// objectKey returns the key of path in a bucket with root
+func objectKey(root, path string) string {
+	return encodeKey(pathpkg.Join(root, path))
+}
+
+// objectPath returns the path of the object with key in a bucket with root,
+// relative to root
+func objectPath(root, key string) string {
+	path := decodeKey(key)
+	if root != "" {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+	}
+	return path
+}
+
+// diskPath returns the relative path on disk of path. On Windows, characters
+// that aren't allowed in filenames, and dots and spaces at the end of a
+// filename, which Windows silently strips, are escaped too. Elsewhere,
+// anything can be in a filename, so the path isn't changed.
+func diskPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	return escapePath(path, true)
+}
+
+// pathFromDisk is the inverse of diskPath
+func pathFromDisk(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	return decodeKey(path)
+}
+
+func escapePath(path string, windows bool) string {
+	var b strings.Builder
+	for i, segment := range strings.Split(path, "/") {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		end := len(segment)
+		if windows && segment != "." && segment != ".." {
+			end = len(strings.TrimRight(segment, ". "))
+		}
+		for j := 0; j < len(segment); {
+			r, size := utf8.DecodeRuneInString(segment[j:])
+			escape := (r == utf8.RuneError && size == 1) || r == '%' || r < 0x20 || r == 0x7f
+			if windows && (strings.ContainsRune(`<>:"\|?*`, r) || j >= end) {
+				escape = true
+			}
+			if escape {
+				for k := j; k < j+size; k++ {
+					fmt.Fprintf(&b, "%%%02X", segment[k])
+				}
+			} else {
+				b.WriteString(segment[j : j+size])
+			}
+			j += size
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var specialPaths = []string{
+	"checkpoints/abc123/plain.txt",
+	"checkpoints/abc123/with space.txt",
+	"checkpoints/abc123/a+b.txt",
+	"checkpoints/abc123/#1.txt",
+	"checkpoints/abc123/50%.txt",
+	"checkpoints/abc123/%41.txt",
+	"checkpoints/abc123/ünïcödé/日本語.txt",
+	"checkpoints/abc123/trailing dot.",
+	"checkpoints/abc123/trailing space ",
+	"checkpoints/abc123/what?.txt",
+	"checkpoints/abc123/a:b<c>d\"e|f*g\\h.txt",
+	"checkpoints/abc123/new\nline.txt",
+	"checkpoints/abc123/invalid-\xff-utf8.txt",
+}
+
+func TestEncodeKey(t *testing.T) {
+	require.Equal(t, "checkpoints/abc123/with space.txt", encodeKey("checkpoints/abc123/with space.txt"))
+	require.Equal(t, "a+b#c/ünïcödé.", encodeKey("a+b#c/ünïcödé."))
+	require.Equal(t, "50%25", encodeKey("50%"))
+	require.Equal(t, "new%0Aline", encodeKey("new\nline"))
+	require.Equal(t, "invalid-%FF", encodeKey("invalid-\xff"))
+
+	for _, p := range specialPaths {
+		require.Equal(t, p, decodeKey(encodeKey(p)))
+	}
+
+	// Keys that were written before they were escaped
+	require.Equal(t, "50%off", decodeKey("50%off"))
+	require.Equal(t, "50%", decodeKey("50%"))
+}
+
+func TestEscapeWindowsPath(t *testing.T) {
+	require.Equal(t, "a%3Ab/c%3F/d%2E/e%20%20/./..", escapePath("a:b/c?/d./e  /./..", true))
+	require.Equal(t, "ünïcödé.txt", escapePath("ünïcödé.txt", true))
+	for _, p := range specialPaths {
+		require.Equal(t, p, decodeKey(escapePath(p, true)))
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	require.Equal(t, "foo/with space", objectPath("", objectKey("", "foo/with space")))
+	require.Equal(t, "foo/50%", objectPath("root", objectKey("root", "foo/50%")))
+	require.Equal(t, "foo/50%", objectPath("root#1", objectKey("root#1", "foo/50%")))
+}
+
+func TestDiskRepositorySpecialCharacters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	for _, p := range specialPaths {
+		require.NoError(t, repository.Put(p, []byte(p)))
+	}
+	for _, p := range specialPaths {
+		data, err := repository.Get(p)
+		require.NoError(t, err)
+		require.Equal(t, p, string(data))
+	}
+
+	results := make(chan ListResult)
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
+	listed := []string{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		listed = append(listed, result.Path)
+	}
+	expected := append([]string{}, specialPaths...)
+	sort.Strings(expected)
+	sort.Strings(listed)
+	require.Equal(t, expected, listed)
+}
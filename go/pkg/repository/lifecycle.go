@@ -0,0 +1,26 @@
+package repository
+
+// LifecycleRule moves the objects under Prefix to cheaper storage classes as
+// they get older. Zero values mean objects are not moved to that class.
+type LifecycleRule struct {
+	// Prefix is relative to the repository root, e.g. "checkpoints/"
+	Prefix                    string
+	InfrequentAccessAfterDays int
+	ArchiveAfterDays          int
+}
+
+// LifecycleManager is implemented by repositories that can move objects to
+// cheaper storage classes as they get older
+type LifecycleManager interface {
+	// SetLifecycleRules replaces the rules for the prefixes in rules,
+	// leaving any other rules on the bucket as they are. Rules without any
+	// transitions are removed.
+	SetLifecycleRules(rules []LifecycleRule) error
+}
+
+// AsLifecycleManager returns repo as a LifecycleManager, if it supports
+// lifecycle rules
+func AsLifecycleManager(repo Repository) (LifecycleManager, bool) {
+	manager, ok := unwrap(repo).(LifecycleManager)
+	return manager, ok
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3LifecycleRules(t *testing.T) {
+	other := &s3.LifecycleRule{
+		ID:     aws.String("expire-logs"),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+	}
+	old := &s3.LifecycleRule{
+		ID:     aws.String("replicate models/experiments/"),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("models/experiments/")},
+	}
+	rules := s3LifecycleRules([]*s3.LifecycleRule{other, old}, "models", []LifecycleRule{
+		{Prefix: "experiments"},
+		{Prefix: "checkpoints", InfrequentAccessAfterDays: 30, ArchiveAfterDays: 90},
+	})
+
+	// The rule for experiments has no transitions, so it is removed
+	require.Equal(t, []*s3.LifecycleRule{other, {
+		ID:     aws.String("replicate models/checkpoints/"),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("models/checkpoints/")},
+		Transitions: []*s3.Transition{
+			{Days: aws.Int64(30), StorageClass: aws.String("STANDARD_IA")},
+			{Days: aws.Int64(90), StorageClass: aws.String("GLACIER")},
+		},
+	}}, rules)
+
+	rules = s3LifecycleRules(nil, "", []LifecycleRule{{Prefix: "experiments", ArchiveAfterDays: 365}})
+	require.Len(t, rules, 1)
+	require.Equal(t, "experiments/", aws.StringValue(rules[0].Filter.Prefix))
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// sendListResult sends result to results for ListRecursive and
+// MatchFilenamesRecursive, unless ctx is cancelled first. It returns false if
+// ctx was cancelled, in which case listing should stop.
+func sendListResult(ctx context.Context, results chan<- ListResult, result ListResult) bool {
+	select {
+	case results <- result:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ListRecursiveAll lists the files in each of folders in r, and returns them
+// all. Every folder is listed even if listing others fails. If any fail, the
+// files that were listed are returned along with a ListErrors.
+func ListRecursiveAll(ctx context.Context, r Repository, folders ...string) ([]ListResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	files := []ListResult{}
+	errs := ListErrors{}
+	for _, folder := range folders {
+		results := make(chan ListResult)
+		go r.ListRecursive(ctx, results, folder)
+		for result := range results {
+			if result.Error != nil {
+				errs[folder] = result.Error
+				continue
+			}
+			files = append(files, result)
+		}
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+	}
+	if len(errs) > 0 {
+		return files, errs
+	}
+	return files, nil
+}
+
+// ListErrors are the errors from listing several folders, by folder
+type ListErrors map[string]error
+
+func (e ListErrors) Error() string {
+	if len(e) == 1 {
+		for _, err := range e {
+			return err.Error()
+		}
+	}
+	messages := []string{}
+	for _, folder := range e.folders() {
+		messages = append(messages, fmt.Sprintf("%s: %s", folder, e[folder]))
+	}
+	return "Failed to list files in " + fmt.Sprint(len(e)) + " folders:\n" + strings.Join(messages, "\n")
+}
+
+// Code is the code of the errors if they all have the same one (e.g. they
+// are all credentials errors), or a read error if they don't
+func (e ListErrors) Code() string {
+	codes := map[string]bool{}
+	for _, err := range e {
+		codes[errors.Code(err)] = true
+	}
+	if len(codes) == 1 {
+		for code := range codes {
+			if code != "" {
+				return code
+			}
+		}
+	}
+	return errors.CodeReadError
+}
+
+func (e ListErrors) folders() []string {
+	folders := []string{}
+	for folder := range e {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// Listing a folder with millions of objects a page at a time takes thousands
+// of requests one after the other. If a listing doesn't fit in one page, the
+// rest of it is split into ranges of keys that are listed at once.
+
+// listShardBoundaries are where the rest of a listing is split. IDs are hex,
+// so objects named after experiments and checkpoints are spread evenly
+// between them.
+const listShardBoundaries = "123456789abcdef"
+
+// listShardConcurrency is how many ranges of a listing are listed at once
+var listShardConcurrency = 8
+
+// keyRange is the keys after After, up to and including Until. If Until is
+// empty, the range doesn't end.
+type keyRange struct {
+	After string
+	Until string
+}
+
+// beyond returns whether key comes after the end of the range
+func (r keyRange) beyond(key string) bool {
+	return r.Until != "" && key > r.Until
+}
+
+// listShards splits the keys that start with prefix and come after after
+// into ranges
+func listShards(prefix, after string) []keyRange {
+	ranges := []keyRange{}
+	start := after
+	for _, c := range listShardBoundaries {
+		boundary := prefix + string(c)
+		if boundary <= start {
+			continue
+		}
+		ranges = append(ranges, keyRange{After: start, Until: boundary})
+		start = boundary
+	}
+	return append(ranges, keyRange{After: start})
+}
+
+// listShardsAtOnce calls list for each of ranges, listShardConcurrency at a
+// time. If one fails, the others are cancelled, and its error is returned.
+func listShardsAtOnce(ctx context.Context, ranges []keyRange, list func(ctx context.Context, r keyRange) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := concurrency.NewWorkerQueue(ctx, listShardConcurrency)
+	for _, r := range ranges {
+		r := r
+		if err := queue.Go(func() error {
+			if err := list(ctx, r); err != nil {
+				cancel()
+				return err
+			}
+			return nil
+		}); err != nil {
+			break
+		}
+	}
+	return queue.Wait()
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// ListCacheTTLEnvVar is how long recursive listings of buckets are cached for,
+// as a duration like "5m". Listings aren't cached if it isn't set.
+//
+// A cached listing doesn't include what other processes have saved since it
+// was listed, so this is for repositories big enough that listing them again
+// is slow or trips the bucket's rate limits. Anything this process saves or
+// deletes removes the listings it is in from the cache.
+const ListCacheTTLEnvVar = "REPLICATE_LIST_CACHE_TTL"
+
+// listCache saves recursive listings of a bucket repository in the user's
+// cache directory, keyed by the repository and the folder listed
+type listCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type listCacheEntry struct {
+	Listed  time.Time         `json:"listed"`
+	Results []listCacheResult `json:"results"`
+}
+
+type listCacheResult struct {
+	Path string `json:"path"`
+	MD5  []byte `json:"md5,omitempty"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// newListCache returns the cache of listings of the repository at rootURL,
+// or nil if listings aren't cached. The methods of a nil cache do nothing.
+func newListCache(rootURL string) *listCache {
+	value := os.Getenv(ListCacheTTLEnvVar)
+	if value == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		console.Warn("Not caching listings, because %s isn't a duration like \"5m\": %s", ListCacheTTLEnvVar, value)
+		return nil
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	dir := listCacheDir()
+	if dir == "" {
+		return nil
+	}
+	sum := sha1.Sum([]byte(rootURL))
+	return &listCache{dir: filepath.Join(dir, hex.EncodeToString(sum[:])), ttl: ttl}
+}
+
+// listCacheDir returns the directory listing caches are saved in, or "" if
+// they aren't saved
+func listCacheDir() string {
+	if dir := os.Getenv("REPLICATE_LIST_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "replicate", "listings")
+}
+
+// cleanListFolder normalizes folder, so "", "." and "/" are all the root
+func cleanListFolder(folder string) string {
+	return strings.Trim(pathpkg.Clean("/"+folder), "/")
+}
+
+func (c *listCache) path(folder string) string {
+	sum := sha1.Sum([]byte(cleanListFolder(folder)))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// get returns the cached listing of folder, if it was listed less than the
+// TTL ago
+func (c *listCache) get(folder string) ([]ListResult, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.path(folder))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			console.Debug("Failed to read listing cache: %s", err)
+		}
+		return nil, false
+	}
+	entry := new(listCacheEntry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		console.Debug("Failed to parse listing cache: %s", err)
+		return nil, false
+	}
+	if time.Since(entry.Listed) > c.ttl {
+		return nil, false
+	}
+	console.Debug("Using listing of %s cached %s ago", folder, time.Since(entry.Listed).Round(time.Second))
+	results := make([]ListResult, len(entry.Results))
+	for i, r := range entry.Results {
+		results[i] = ListResult{Path: r.Path, MD5: r.MD5, Size: r.Size, ETag: r.ETag}
+	}
+	return results, true
+}
+
+// set saves the listing of folder, which must be complete
+func (c *listCache) set(folder string, listed time.Time, results []ListResult) {
+	if c == nil {
+		return
+	}
+	entry := listCacheEntry{Listed: listed, Results: make([]listCacheResult, len(results))}
+	for i, r := range results {
+		entry.Results[i] = listCacheResult{Path: r.Path, MD5: r.MD5, Size: r.Size, ETag: r.ETag}
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = c.write(c.path(folder), data)
+	}
+	if err != nil {
+		console.Debug("Failed to save listing cache: %s", err)
+	}
+}
+
+func (c *listCache) write(path string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	// Written to a temporary file and renamed, so other processes never read
+	// half of it
+	f, err := ioutil.TempFile(c.dir, ".listing-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// clear removes every cached listing of the repository
+func (c *listCache) clear() {
+	if c == nil {
+		return
+	}
+	if err := os.RemoveAll(c.dir); err != nil {
+		console.Debug("Failed to remove listing cache: %s", err)
+	}
+}
+
+// invalidate removes the listings of every folder p is in
+func (c *listCache) invalidate(p string) {
+	if c == nil {
+		return
+	}
+	folder := cleanListFolder(p)
+	for {
+		if err := os.Remove(c.path(folder)); err != nil && !os.IsNotExist(err) {
+			console.Debug("Failed to remove listing cache: %s", err)
+		}
+		if folder == "" {
+			return
+		}
+		folder = pathpkg.Dir(folder)
+		if folder == "." {
+			folder = ""
+		}
+	}
+}
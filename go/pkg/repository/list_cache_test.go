@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func listedPaths(t *testing.T, r Repository, folder string) []string {
+	results, err := ListRecursiveAll(context.Background(), r, folder)
+	require.NoError(t, err)
+	paths := []string{}
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestListCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv("REPLICATE_LIST_CACHE_DIR", dir)
+	defer os.Unsetenv("REPLICATE_LIST_CACHE_DIR")
+
+	fake := newFakeS3(0)
+	repo, closeServer := newFakeS3Repository(t, fake, "root")
+	defer closeServer()
+
+	// Listings aren't cached unless the TTL is set
+	require.Nil(t, newListCache(repo.RootURL()))
+	os.Setenv(ListCacheTTLEnvVar, "1h")
+	defer os.Unsetenv(ListCacheTTLEnvVar)
+	repo.listCache = newListCache(repo.RootURL())
+	require.NotNil(t, repo.listCache)
+
+	require.NoError(t, repo.Put("checkpoints/1ccccccccc/model.pth", []byte("weights")))
+	require.NoError(t, repo.Put("checkpoints/2ccccccccc/model.pth", []byte("weights")))
+	require.Equal(t, []string{"checkpoints/1ccccccccc/model.pth", "checkpoints/2ccccccccc/model.pth"}, listedPaths(t, repo, "checkpoints"))
+
+	// Somebody else saves something, which isn't seen until the cache
+	// expires
+	fake.mu.Lock()
+	fake.buckets["bucket"]["root/checkpoints/3ccccccccc/model.pth"] = fakeS3Object{data: []byte("weights")}
+	requests := fake.listRequests
+	fake.mu.Unlock()
+	require.Len(t, listedPaths(t, repo, "checkpoints"), 2)
+	require.Len(t, listedPaths(t, repo, "checkpoints/"), 2)
+	fake.mu.Lock()
+	require.Equal(t, requests, fake.listRequests)
+	fake.mu.Unlock()
+
+	// Matching filenames uses the cached listing too
+	results := make(chan ListResult)
+	go repo.MatchFilenamesRecursive(context.Background(), results, "checkpoints", "model.pth")
+	count := 0
+	for result := range results {
+		require.NoError(t, result.Error)
+		count++
+	}
+	require.Equal(t, 2, count)
+
+	// Saving something removes the listings it's in
+	require.NoError(t, repo.Put("checkpoints/4ccccccccc/model.pth", []byte("weights")))
+	require.Len(t, listedPaths(t, repo, "checkpoints"), 4)
+
+	// Deleting removes everything
+	require.Len(t, listedPaths(t, repo, ""), 4)
+	require.NoError(t, repo.Delete("checkpoints/1ccccccccc"))
+	require.Len(t, listedPaths(t, repo, ""), 3)
+	require.Len(t, listedPaths(t, repo, "checkpoints"), 3)
+}
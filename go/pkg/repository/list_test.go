@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// newBrokenDiskRepository returns a disk repository with files in
+// checkpoints/ and experiments/, where checkpoints/b can't be read
+func newBrokenDiskRepository(t *testing.T) (*DiskRepository, func()) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	require.NoError(t, repository.Put("checkpoints/a", []byte("a")))
+	require.NoError(t, repository.Put("checkpoints/c", []byte("c")))
+	require.NoError(t, repository.Put("experiments/d", []byte("d")))
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "checkpoints", "b")); err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("Can't create symlinks: %s", err)
+	}
+	return repository, func() { os.RemoveAll(dir) }
+}
+
+func TestListRecursiveClosesResultsAfterError(t *testing.T) {
+	repository, cleanup := newBrokenDiskRepository(t)
+	defer cleanup()
+
+	results := make(chan ListResult)
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
+	received := []ListResult{}
+	for result := range results {
+		received = append(received, result)
+	}
+
+	// The error is the last thing sent, and nothing after the file that
+	// failed is listed
+	require.Len(t, received, 2)
+	require.Equal(t, "checkpoints/a", received[0].Path)
+	require.Error(t, received[1].Error)
+	require.Equal(t, errors.CodeReadError, errors.Code(received[1].Error))
+}
+
+func TestListRecursiveCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repository, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, repository.Put(fmt.Sprintf("checkpoints/%02d/replicate-metadata.json", i), []byte("{}")))
+	}
+
+	for name, list := range map[string]func(context.Context, chan<- ListResult){
+		"ListRecursive": func(ctx context.Context, results chan<- ListResult) {
+			repository.ListRecursive(ctx, results, "checkpoints")
+		},
+		"MatchFilenamesRecursive": func(ctx context.Context, results chan<- ListResult) {
+			repository.MatchFilenamesRecursive(ctx, results, "checkpoints", "replicate-metadata.json")
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			results := make(chan ListResult)
+			done := make(chan struct{})
+			go func() {
+				list(ctx, results)
+				close(done)
+			}()
+			require.NoError(t, (<-results).Error)
+
+			// Listing stops without anything reading the rest of the
+			// results...
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Listing didn't stop after being cancelled")
+			}
+
+			// ...and results is closed, without an error being sent
+			for result := range results {
+				require.NoError(t, result.Error)
+			}
+		})
+	}
+}
+
+func TestListRecursiveAll(t *testing.T) {
+	repository, cleanup := newBrokenDiskRepository(t)
+	defer cleanup()
+
+	// Every folder is listed, even though one fails
+	results, err := ListRecursiveAll(context.Background(), repository, "checkpoints", "experiments", "nonexistent")
+	paths := []string{}
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	require.Equal(t, []string{"checkpoints/a", "experiments/d"}, paths)
+	require.Error(t, err)
+	listErrors, ok := err.(ListErrors)
+	require.True(t, ok)
+	require.Equal(t, []string{"checkpoints"}, listErrors.folders())
+	require.Equal(t, errors.CodeReadError, errors.Code(err))
+
+	results, err = ListRecursiveAll(context.Background(), repository, "experiments")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ListRecursiveAll(ctx, repository, "experiments")
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestListErrors(t *testing.T) {
+	err := ListErrors{"checkpoints": errors.ReadError("oh no")}
+	require.Equal(t, "oh no", err.Error())
+	require.Equal(t, errors.CodeReadError, errors.Code(err))
+
+	err = ListErrors{
+		"experiments": errors.RepositoryCredentialsError("no credentials"),
+		"checkpoints": errors.RepositoryCredentialsError("no credentials"),
+	}
+	require.Equal(t, "Failed to list files in 2 folders:\ncheckpoints: no credentials\nexperiments: no credentials", err.Error())
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(err))
+
+	err = ListErrors{
+		"experiments": errors.RepositoryCredentialsError("no credentials"),
+		"checkpoints": fmt.Errorf("oh no"),
+	}
+	require.Equal(t, errors.CodeReadError, errors.Code(err))
+}
+
+func TestListShards(t *testing.T) {
+	require.Equal(t, []keyRange{
+		{After: "checkpoints/c5", Until: "checkpoints/d"},
+		{After: "checkpoints/d", Until: "checkpoints/e"},
+		{After: "checkpoints/e", Until: "checkpoints/f"},
+		{After: "checkpoints/f"},
+	}, listShards("checkpoints/", "checkpoints/c5"))
+	shards := listShards("checkpoints/", "checkpoints/0")
+	require.Len(t, shards, 16)
+	require.Equal(t, keyRange{After: "checkpoints/0", Until: "checkpoints/1"}, shards[0])
+}
+
+// shardedListingKeys returns more keys than fit in a page of a listing,
+// including ones on and around the boundaries of the shards
+func shardedListingKeys() []string {
+	keys := []string{"checkpoints/1", "checkpoints/f", "checkpoints/zzz", "checkpoints/G", "checkpoints/-"}
+	for i := 0; i < 2500; i++ {
+		keys = append(keys, fmt.Sprintf("checkpoints/%x", i*104729))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestS3ListRecursiveShards(t *testing.T) {
+	oldMinInterval := pacerMinInterval
+	pacerMinInterval = time.Millisecond
+	defer func() { pacerMinInterval = oldMinInterval }()
+
+	fake := newFakeS3(0)
+	repo, closeServer := newFakeS3Repository(t, fake, "")
+	defer closeServer()
+	// Throttled requests are retried by the pacer, not the SDK
+	repo.svc = s3.New(repo.sess, aws.NewConfig().WithMaxRetries(0))
+
+	keys := shardedListingKeys()
+	fake.mu.Lock()
+	for _, key := range keys {
+		fake.buckets["bucket"][key] = fakeS3Object{data: []byte(key), etag: `"` + hex.EncodeToString([]byte(key)) + `"`}
+	}
+	fake.buckets["bucket"]["experiments/1eeeeeeeee"] = fakeS3Object{}
+	fake.throttle = 3
+	fake.mu.Unlock()
+
+	require.Equal(t, keys, listedPaths(t, repo, "checkpoints"))
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	// Paging through it would take 3 requests, as well as the 3 that were
+	// throttled, but the rest of it after the first page is listed in shards
+	require.True(t, fake.listRequests > 3+3, "%d requests", fake.listRequests)
+}
+
+func TestGCSListRecursiveShards(t *testing.T) {
+	fake := newFakeGCS()
+	repo, closeServer := newFakeGCSRepository(t, fake, "")
+	defer closeServer()
+
+	keys := shardedListingKeys()
+	fake.mu.Lock()
+	for _, key := range keys {
+		fake.buckets["bucket"][key] = []byte(key)
+	}
+	fake.buckets["bucket"]["experiments/1eeeeeeeee"] = []byte{}
+	fake.mu.Unlock()
+
+	require.Equal(t, keys, listedPaths(t, repo, "checkpoints"))
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.True(t, fake.listRequests > 3, "%d requests", fake.listRequests)
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Object storage doesn't have locks, so a lock is a lease: an object that
+// says who holds the lock and until when. The holder renews the lease while
+// it is running, so if it crashes, the lease expires and someone else can
+// take the lock over. If the holder stalls for longer than that, it finds
+// out when it next renews, and stops so it doesn't overwrite the new lease.
+//
+// Object storage doesn't have compare-and-swap either, so two processes can
+// write a lease at the same time. After writing one, it is read back a
+// little later to check it wasn't overwritten.
+
+// LocksDir is the directory in the repository that locks are in
+const LocksDir = "locks"
+
+// LockTTL is how long a lease lasts without being renewed. It is renewed
+// every third of that.
+var LockTTL = 2 * time.Minute
+
+// LockSettleTime is how long to wait after writing a lease before reading it
+// back to check nobody else wrote theirs at the same time
+var LockSettleTime = time.Second
+
+// Lease is who holds a lock
+type Lease struct {
+	Token     string    `json:"token"`
+	Operation string    `json:"operation"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Acquired  time.Time `json:"acquired"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Expired returns whether the lease has run out, in which case the holder has
+// probably crashed
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+// Holder describes who holds the lease, e.g. "ben@gpu-1"
+func (l *Lease) Holder() string {
+	if l.Host == "" {
+		return l.User
+	}
+	return l.User + "@" + l.Host
+}
+
+// Lock is a lock that is held, until Release is called
+type Lock struct {
+	repo Repository
+	name string
+	path string
+
+	mu    sync.Mutex
+	lease *Lease
+	stop  chan struct{}
+	done  chan struct{}
+	lost  chan struct{}
+}
+
+// ErrLockLost is returned by Release if somebody else took the lock over
+// while it was held, because the lease ran out before it was renewed
+var ErrLockLost = goerrors.New("the lock was taken over by somebody else while it was held")
+
+func lockPath(name string) string {
+	return path.Join(LocksDir, name+".json")
+}
+
+// ReadLock returns the lease on the lock called name, or nil if nobody has
+// held it
+func ReadLock(r Repository, name string) (*Lease, error) {
+	data, err := r.Get(lockPath(name))
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	lease := &Lease{}
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, fmt.Errorf("Failed to parse lock %s: %w", name, err)
+	}
+	return lease, nil
+}
+
+// AcquireLock takes the lock called name for operation, which describes what
+// it is being held for. It fails if somebody else holds it, unless their
+// lease has expired. The lease is renewed in the background until Release is
+// called.
+func AcquireLock(r Repository, name string, operation string) (*Lock, error) {
+	existing, err := ReadLock(r, name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if existing != nil && !existing.Expired(now) {
+		return nil, fmt.Errorf("The repository is locked by %s, who started %s at %s. Try again when it has finished. If it has crashed, the lock expires at %s.", existing.Holder(), existing.Operation, existing.Acquired.Local().Format(time.RFC3339), existing.Expires.Local().Format(time.RFC3339))
+	}
+	if existing != nil {
+		console.Warn("Taking over the lock held by %s for %s, which expired at %s", existing.Holder(), existing.Operation, existing.Expires.Local().Format(time.RFC3339))
+	}
+
+	lease := &Lease{
+		Token:     newLockToken(),
+		Operation: operation,
+		Acquired:  now,
+		Expires:   now.Add(LockTTL),
+	}
+	if currentUser, err := user.Current(); err == nil {
+		lease.User = currentUser.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		lease.Host = host
+	}
+	lock := &Lock{repo: r, name: name, path: lockPath(name), lease: lease}
+	if err := lock.write(); err != nil {
+		return nil, err
+	}
+
+	time.Sleep(LockSettleTime)
+	current, err := ReadLock(r, name)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || current.Token != lease.Token {
+		holder := "somebody else"
+		if current != nil {
+			holder = current.Holder()
+		}
+		return nil, fmt.Errorf("The repository was locked by %s at the same time. Try again when they have finished.", holder)
+	}
+
+	lock.stop = make(chan struct{})
+	lock.done = make(chan struct{})
+	lock.lost = make(chan struct{})
+	go lock.renew()
+	return lock, nil
+}
+
+// Lost returns a channel that is closed if somebody else takes the lock over
+// while it is held. Whatever the lock is held for isn't safe any more, so it
+// should stop.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops renewing the lease and deletes it, so others can take the
+// lock. It returns ErrLockLost, and leaves the new holder's lease alone, if
+// the lock was lost while it was held.
+func (l *Lock) Release() error {
+	close(l.stop)
+	<-l.done
+	select {
+	case <-l.lost:
+		return ErrLockLost
+	default:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// If the lease expired while it couldn't be renewed, somebody else might
+	// hold it now
+	current := &Lease{}
+	data, err := l.repo.Get(l.path)
+	if err != nil {
+		if errors.IsDoesNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, current); err == nil && current.Token != l.lease.Token {
+		return nil
+	}
+	return l.repo.Delete(l.path)
+}
+
+func (l *Lock) renew() {
+	defer close(l.done)
+	ticker := time.NewTicker(LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if !l.renewOnce() {
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// renewOnce extends the lease, if it is still held. It returns false if
+// somebody else has taken the lock over, so the lease isn't written over
+// theirs.
+func (l *Lock) renewOnce() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current, err := ReadLock(l.repo, l.name)
+	if err != nil {
+		// Try again next time. The lease lasts for a few renewals.
+		console.Warn("Failed to renew lock %s: %s", l.path, err)
+		return true
+	}
+	if current == nil || current.Token != l.lease.Token {
+		holder := "somebody else"
+		if current != nil {
+			holder = current.Holder()
+		}
+		console.Warn("Lock %s was taken over by %s, because it wasn't renewed in time", l.path, holder)
+		return false
+	}
+	l.lease.Expires = time.Now().UTC().Add(LockTTL)
+	if err := l.write(); err != nil {
+		console.Warn("Failed to renew lock %s: %s", l.path, err)
+	}
+	return true
+}
+
+func (l *Lock) write() error {
+	data, err := json.MarshalIndent(l.lease, "", "  ")
+	if err != nil {
+		panic(err) // should never happen
+	}
+	if err := l.repo.Put(l.path, data); err != nil {
+		return fmt.Errorf("Failed to write lock %s: %w", l.path, err)
+	}
+	return nil
+}
+
+func newLockToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // should never happen
+	}
+	return hex.EncodeToString(b)
+}
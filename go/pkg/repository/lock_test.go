@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := files.TempDir("test-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	oldSettleTime := LockSettleTime
+	LockSettleTime = 0
+	defer func() { LockSettleTime = oldSettleTime }()
+
+	lease, err := ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.Nil(t, lease)
+
+	lock, err := AcquireLock(repo, "maintenance", "pruning")
+	require.NoError(t, err)
+	lease, err = ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.Equal(t, "pruning", lease.Operation)
+	require.False(t, lease.Expired(time.Now().UTC()))
+
+	// Somebody else can't take it while it's held
+	_, err = AcquireLock(repo, "maintenance", "deleting checkpoints")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "pruning")
+
+	// Other locks are separate
+	other, err := AcquireLock(repo, "other", "pruning")
+	require.NoError(t, err)
+	require.NoError(t, other.Release())
+
+	require.NoError(t, lock.Release())
+	lease, err = ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.Nil(t, lease)
+
+	lock, err = AcquireLock(repo, "maintenance", "deleting checkpoints")
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestLockTakeOverExpired(t *testing.T) {
+	dir, err := files.TempDir("test-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	oldSettleTime := LockSettleTime
+	LockSettleTime = 0
+	defer func() { LockSettleTime = oldSettleTime }()
+
+	// A process that crashed while holding the lock
+	stale := &Lock{repo: repo, name: "maintenance", path: lockPath("maintenance"), lease: &Lease{
+		Token:     "crashed",
+		Operation: "pruning",
+		Acquired:  time.Now().UTC().Add(-time.Hour),
+		Expires:   time.Now().UTC().Add(-time.Minute),
+	}}
+	require.NoError(t, stale.write())
+
+	lock, err := AcquireLock(repo, "maintenance", "deleting checkpoints")
+	require.NoError(t, err)
+	lease, err := ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.Equal(t, lock.lease.Token, lease.Token)
+	require.NoError(t, lock.Release())
+}
+
+func TestLockRenew(t *testing.T) {
+	dir, err := files.TempDir("test-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	oldSettleTime, oldTTL := LockSettleTime, LockTTL
+	LockSettleTime = 0
+	LockTTL = 300 * time.Millisecond
+	defer func() { LockSettleTime, LockTTL = oldSettleTime, oldTTL }()
+
+	lock, err := AcquireLock(repo, "maintenance", "pruning")
+	require.NoError(t, err)
+	first, err := ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+
+	// Held for longer than the TTL, but the lease is renewed
+	time.Sleep(2 * LockTTL)
+	lease, err := ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.True(t, lease.Expires.After(first.Expires))
+	require.False(t, lease.Expired(time.Now().UTC()))
+	require.NoError(t, lock.Release())
+}
+
+func TestLockLost(t *testing.T) {
+	dir, err := files.TempDir("test-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, err := NewDiskRepository(dir)
+	require.NoError(t, err)
+
+	oldSettleTime, oldTTL := LockSettleTime, LockTTL
+	LockSettleTime = 0
+	LockTTL = 300 * time.Millisecond
+	defer func() { LockSettleTime, LockTTL = oldSettleTime, oldTTL }()
+
+	lock, err := AcquireLock(repo, "maintenance", "pruning")
+	require.NoError(t, err)
+
+	// Somebody else takes the lock over, as if this holder had stalled
+	other := &Lock{repo: repo, name: "maintenance", path: lockPath("maintenance"), lease: &Lease{
+		Token:     "other",
+		Operation: "deleting checkpoints",
+		Acquired:  time.Now().UTC(),
+		Expires:   time.Now().UTC().Add(time.Hour),
+	}}
+	require.NoError(t, other.write())
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(2 * LockTTL):
+		t.Fatal("Lost wasn't closed when the lock was taken over")
+	}
+	// The new holder's lease isn't renewed or deleted
+	require.Equal(t, ErrLockLost, lock.Release())
+	lease, err := ReadLock(repo, "maintenance")
+	require.NoError(t, err)
+	require.Equal(t, "other", lease.Token)
+	require.Equal(t, other.lease.Expires.Unix(), lease.Expires.Unix())
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/metrics"
+)
+
+// Requests to S3 and GCS all go through the shared HTTP client, so they are
+// counted and timed in its transport
+var (
+	storageRequests        = metrics.NewCounter("replicate_storage_requests_total", "Requests made to S3 and GCS, by HTTP method and status code.", "method", "code")
+	storageRequestDuration = metrics.NewHistogram("replicate_storage_request_duration_seconds", "How long requests to S3 and GCS took to respond, in seconds, by HTTP method.", "method")
+	storageBytes           = metrics.NewCounter("replicate_storage_bytes_total", "Bytes uploaded to and downloaded from S3 and GCS.", "direction")
+)
+
+// metricsTransport records metrics for the requests made with transport
+type metricsTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.transport.RoundTrip(req)
+	storageRequestDuration.Observe(time.Since(start).Seconds(), req.Method)
+	if err != nil {
+		storageRequests.Inc(req.Method, "error")
+		return nil, err
+	}
+	storageRequests.Inc(req.Method, strconv.Itoa(resp.StatusCode))
+	if req.ContentLength > 0 {
+		storageBytes.Add(float64(req.ContentLength), "upload")
+	}
+	resp.Body = &countingReader{ReadCloser: resp.Body}
+	return resp, nil
+}
+
+// countingReader counts the bytes downloaded as the body of a response is read
+type countingReader struct {
+	io.ReadCloser
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		storageBytes.Add(float64(n), "download")
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// Network is how S3 and GCS are connected to, usually from the user's global
+// config file. The environment variables that set the same things take
+// precedence.
+type Network struct {
+	// MaxWorkers is how many files are uploaded, downloaded or deleted at
+	// once. Zero is the default.
+	MaxWorkers int
+	// Proxy is the URL of the HTTP proxy that requests are sent through
+	Proxy string
+	// CABundle is the path of a PEM file of CA certificates that are
+	// trusted as well as the system's
+	CABundle string
+}
+
+var (
+	networkMu sync.Mutex
+	network   Network
+)
+
+// SetNetwork sets how S3 and GCS are connected to. Like the connect and
+// request timeouts, the proxy and CA bundle are part of the HTTP client that
+// all repositories share, so they only apply if this is called before the
+// first repository connects.
+func SetNetwork(n Network) {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	network = n
+	if n.MaxWorkers > 0 && os.Getenv(maxWorkersEnvVar) == "" {
+		maxWorkers = n.MaxWorkers
+	}
+}
+
+func currentNetwork() Network {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	return network
+}
+
+// proxyFunc returns the function the HTTP transport picks a proxy with. A
+// proxy in the environment takes precedence over proxy, and if there isn't
+// either, requests aren't sent through a proxy.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" || proxyInEnv() {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("The proxy %q isn't a URL like \"http://proxy.example.com:3128\"", proxy)
+	}
+	return http.ProxyURL(u), nil
+}
+
+func proxyInEnv() bool {
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials are which credentials are used to access repositories, usually
+// from the user's global config file
+type Credentials struct {
+	// AWSProfile is the AWS profile used for S3
+	AWSProfile string
+	// GCPCredentialsFile is the path of the service account key used for
+	// Google Cloud Storage
+	GCPCredentialsFile string
+}
+
+// SetCredentials makes S3 and GCS use creds, unless credentials are already
+// set in the environment. They are set as environment variables, because that
+// is where the AWS and Google Cloud SDKs look for them, and what cached
+// sessions and clients are keyed on.
+func SetCredentials(creds Credentials) {
+	if creds.AWSProfile != "" && os.Getenv("AWS_PROFILE") == "" && os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		os.Setenv("AWS_PROFILE", creds.AWSProfile)
+	}
+	if creds.GCPCredentialsFile != "" && os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") == "" && os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_JSON") == "" {
+		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", creds.GCPCredentialsFile)
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// Buckets limit how many requests a prefix can have each second, and listing
+// a repository with millions of objects makes thousands of requests. A pacer
+// spaces out the requests made to a bucket: every time the bucket says it is
+// getting too many, it waits longer between requests and retries, and every
+// request that succeeds shortens the wait again.
+type pacer struct {
+	// throttled returns whether an error means the bucket is getting too
+	// many requests
+	throttled func(error) bool
+
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+var (
+	// pacerMinInterval is the time between requests after the first time a
+	// bucket says it's getting too many. Before that, requests aren't
+	// spaced out at all.
+	pacerMinInterval = 10 * time.Millisecond
+	// pacerMaxInterval is the longest time between requests
+	pacerMaxInterval = 5 * time.Second
+	// pacerRetries is how many times a request is retried if the bucket
+	// keeps saying it's getting too many
+	pacerRetries = 10
+)
+
+var pacerLog = console.Component("pacer")
+
+func newPacer(throttled func(error) bool) *pacer {
+	return &pacer{throttled: throttled}
+}
+
+// call calls fn once it is its turn, retrying if it is throttled
+func (p *pacer) call(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := p.wait(ctx); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil || !p.throttled(err) {
+			p.speedUp()
+			return err
+		}
+		if attempt >= pacerRetries {
+			pacerLog.Debug("Giving up after being throttled %d times: %s", attempt+1, err)
+			return err
+		}
+		p.slowDown()
+		pacerLog.Debug("Throttled, so retrying (attempt %d of %d): %s", attempt+1, pacerRetries, err)
+	}
+}
+
+// wait blocks until it is the turn of the next request
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	start := p.next
+	if start.Before(now) {
+		start = now
+	}
+	p.next = start.Add(p.interval)
+	p.mu.Unlock()
+
+	if delay := start.Sub(now); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// slowDown doubles the time between requests, and holds off the next one for
+// that long
+func (p *pacer) slowDown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.interval == 0 {
+		pacerLog.Debug("Requests are being throttled, slowing down")
+	}
+	p.interval *= 2
+	if p.interval < pacerMinInterval {
+		p.interval = pacerMinInterval
+	}
+	if p.interval > pacerMaxInterval {
+		p.interval = pacerMaxInterval
+	}
+	if next := time.Now().Add(p.interval); next.After(p.next) {
+		p.next = next
+	}
+}
+
+// speedUp shortens the time between requests by a tenth, until it stops
+// spacing them out again
+func (p *pacer) speedUp() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interval -= p.interval / 10
+	if p.interval < pacerMinInterval/2 {
+		p.interval = 0
+	}
+}
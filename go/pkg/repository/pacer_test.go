@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacer(t *testing.T) {
+	oldMinInterval := pacerMinInterval
+	pacerMinInterval = time.Millisecond
+	defer func() { pacerMinInterval = oldMinInterval }()
+
+	errThrottled := fmt.Errorf("slow down")
+	p := newPacer(func(err error) bool { return err == errThrottled })
+	ctx := context.Background()
+
+	// Throttled requests are retried, and slow it down
+	calls := 0
+	err := p.call(ctx, func() error {
+		calls++
+		if calls <= 2 {
+			return errThrottled
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.True(t, p.interval > 0)
+
+	// Other errors aren't retried
+	calls = 0
+	err = p.call(ctx, func() error {
+		calls++
+		return fmt.Errorf("oh no")
+	})
+	require.EqualError(t, err, "oh no")
+	require.Equal(t, 1, calls)
+
+	// Requests that succeed speed it back up
+	for i := 0; i < 50 && p.interval > 0; i++ {
+		require.NoError(t, p.call(ctx, func() error { return nil }))
+	}
+	require.Equal(t, time.Duration(0), p.interval)
+
+	// It gives up eventually
+	calls = 0
+	err = p.call(ctx, func() error {
+		calls++
+		return errThrottled
+	})
+	require.Equal(t, errThrottled, err)
+	require.Equal(t, pacerRetries+1, calls)
+}
+
+func TestPacerCancel(t *testing.T) {
+	p := newPacer(func(err error) bool { return true })
+	p.interval = time.Hour
+	p.next = time.Now().Add(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.call(ctx, func() error {
+		t.Fatal("Shouldn't be called")
+		return nil
+	})
+	require.Equal(t, context.Canceled, err)
+}
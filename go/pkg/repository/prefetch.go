@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// Objects that will probably be checked out soon, like the latest checkpoints
+// of running experiments, can be prefetched: downloaded ahead of time to a
+// directory on local disk, so checking them out doesn't wait for a slow
+// network. PrefetchingRepository reads them from there instead of from the
+// repository.
+//
+// Only objects that don't change once they are written are prefetched, such
+// as the tarballs of experiments and checkpoints, chunks and large files.
+// Anything that is written or deleted through a PrefetchingRepository is
+// removed from the prefetch directory, in case it has changed.
+
+// PrefetchDirEnvVar is the directory prefetched objects are kept in. It
+// defaults to "replicate/prefetch" in the user's cache directory.
+const PrefetchDirEnvVar = "REPLICATE_PREFETCH_DIR"
+
+// PrefetchDirForRepository returns the directory that objects prefetched from
+// the repository at rootURL are kept in, or "" if there isn't one
+func PrefetchDirForRepository(rootURL string) string {
+	dir := os.Getenv(PrefetchDirEnvVar)
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(cacheDir, "replicate", "prefetch")
+	}
+	sum := sha1.Sum([]byte(rootURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// PrefetchingRepository wraps another repository, reading objects that have
+// been prefetched from local disk
+type PrefetchingRepository struct {
+	repository  Repository
+	prefetchDir string
+	prefetched  *DiskRepository
+}
+
+func NewPrefetchingRepository(repo Repository, prefetchDir string) (*PrefetchingRepository, error) {
+	prefetched, err := NewDiskRepository(prefetchDir)
+	if err != nil {
+		return nil, err
+	}
+	return &PrefetchingRepository{
+		repository:  repo,
+		prefetchDir: prefetchDir,
+		prefetched:  prefetched,
+	}, nil
+}
+
+// AsPrefetching returns the PrefetchingRepository that repo is or wraps, if
+// there is one
+func AsPrefetching(repo Repository) (*PrefetchingRepository, bool) {
+	for {
+		switch r := repo.(type) {
+		case *PrefetchingRepository:
+			return r, true
+		case *CachedRepository:
+			repo = r.repository
+		case *SpoolingRepository:
+			repo = r.repository
+		default:
+			return nil, false
+		}
+	}
+}
+
+// IsPrefetched returns whether p has been prefetched
+func (s *PrefetchingRepository) IsPrefetched(p string) bool {
+	info, err := os.Stat(s.prefetched.fullPath(p))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Prefetch downloads p to the prefetch directory, if it isn't there already,
+// and returns the number of bytes that were downloaded
+func (s *PrefetchingRepository) Prefetch(p string) (int64, error) {
+	if s.IsPrefetched(p) {
+		return 0, nil
+	}
+	// Clearing the prefetch directory waits for this to finish
+	lock, err := files.RLockDir(s.prefetchDir)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to lock %s: %w", s.prefetchDir, err)
+	}
+	defer lock.Unlock()
+	reader, err := s.repository.GetReader(p)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	dest := s.prefetched.fullPath(p)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, err
+	}
+	// Written to a temporary file and renamed, so a prefetch that is
+	// interrupted is never read
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), dest); err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+// Clear removes everything that has been prefetched
+func (s *PrefetchingRepository) Clear() error {
+	lock, err := files.LockDir(s.prefetchDir)
+	if err != nil {
+		return fmt.Errorf("Failed to lock %s: %w", s.prefetchDir, err)
+	}
+	defer lock.Unlock()
+	return os.RemoveAll(s.prefetchDir)
+}
+
+// readRepository returns the prefetch directory if p has been prefetched,
+// otherwise the repository
+func (s *PrefetchingRepository) readRepository(p string) Repository {
+	if s.IsPrefetched(p) {
+		return s.prefetched
+	}
+	return s.repository
+}
+
+// forget removes p from the prefetch directory, because it is about to be
+// written or deleted
+func (s *PrefetchingRepository) forget(p string) {
+	if err := s.prefetched.Delete(p); err != nil {
+		console.Debug("Failed to remove prefetched %s: %s", p, err)
+	}
+}
+
+func (s *PrefetchingRepository) Get(p string) ([]byte, error) {
+	return s.readRepository(p).Get(p)
+}
+
+func (s *PrefetchingRepository) GetReader(p string) (io.ReadCloser, error) {
+	return s.readRepository(p).GetReader(p)
+}
+
+func (s *PrefetchingRepository) GetRangeReader(p string, offset, length int64) (io.ReadCloser, error) {
+	return s.readRepository(p).GetRangeReader(p, offset, length)
+}
+
+func (s *PrefetchingRepository) GetPath(repoPath string, localPath string) error {
+	return s.readRepository(repoPath).GetPath(repoPath, localPath)
+}
+
+func (s *PrefetchingRepository) GetPathTar(tarPath, localPath string) error {
+	return s.readRepository(tarPath).GetPathTar(tarPath, localPath)
+}
+
+func (s *PrefetchingRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	return s.readRepository(tarPath).GetPathItemTar(tarPath, itemPath, localPath)
+}
+
+func (s *PrefetchingRepository) Put(p string, data []byte) error {
+	s.forget(p)
+	return s.repository.Put(p, data)
+}
+
+func (s *PrefetchingRepository) PutPath(localPath string, repoPath string) error {
+	s.forget(repoPath)
+	return s.repository.PutPath(localPath, repoPath)
+}
+
+func (s *PrefetchingRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	s.forget(tarPath)
+	return s.repository.PutPathTar(localPath, tarPath, includePath)
+}
+
+func (s *PrefetchingRepository) List(p string) ([]string, error) {
+	return s.repository.List(p)
+}
+
+func (s *PrefetchingRepository) ListTarFile(p string) ([]string, error) {
+	return s.readRepository(p).ListTarFile(p)
+}
+
+func (s *PrefetchingRepository) ListRecursive(ctx context.Context, results chan<- ListResult, folder string) {
+	s.repository.ListRecursive(ctx, results, folder)
+}
+
+func (s *PrefetchingRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	s.repository.MatchFilenamesRecursive(ctx, results, folder, filename)
+}
+
+func (s *PrefetchingRepository) Delete(p string) error {
+	s.forget(p)
+	return s.repository.Delete(p)
+}
+
+func (s *PrefetchingRepository) Copy(src, dest string) error {
+	s.forget(dest)
+	return s.repository.Copy(src, dest)
+}
+
+func (s *PrefetchingRepository) Move(src, dest string) error {
+	s.forget(src)
+	s.forget(dest)
+	return s.repository.Move(src, dest)
+}
+
+func (s *PrefetchingRepository) RootURL() string {
+	return s.repository.RootURL()
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestPrefetchingRepository(t *testing.T) {
+	dir, err := files.TempDir("test-prefetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	remote, err := NewDiskRepository(filepath.Join(dir, "repository"))
+	require.NoError(t, err)
+	repo, err := NewPrefetchingRepository(remote, filepath.Join(dir, "prefetch"))
+	require.NoError(t, err)
+	as, ok := AsPrefetching(repo)
+	require.True(t, ok)
+	require.Equal(t, repo, as)
+
+	require.NoError(t, remote.Put("blobs/ab/abc", []byte("weights")))
+	size, err := repo.Prefetch("blobs/ab/abc")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), size)
+	require.True(t, repo.IsPrefetched("blobs/ab/abc"))
+	_, err = repo.Prefetch("blobs/ab/missing")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	// Prefetched objects are read from local disk...
+	require.NoError(t, remote.Delete("blobs/ab/abc"))
+	data, err := repo.Get("blobs/ab/abc")
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(data))
+	size, err = repo.Prefetch("blobs/ab/abc")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), size)
+
+	// ...until they are written through the repository
+	require.NoError(t, repo.Put("blobs/ab/abc", []byte("new weights")))
+	require.False(t, repo.IsPrefetched("blobs/ab/abc"))
+	data, err = repo.Get("blobs/ab/abc")
+	require.NoError(t, err)
+	require.Equal(t, "new weights", string(data))
+
+	_, err = repo.Prefetch("blobs/ab/abc")
+	require.NoError(t, err)
+	require.NoError(t, repo.Clear())
+	require.False(t, repo.IsPrefetched("blobs/ab/abc"))
+}
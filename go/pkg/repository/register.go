@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a repository for a URL with a registered scheme
+type Factory func(repositoryURL string) (Repository, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[Scheme]Factory{}
+)
+
+// Register makes a repository backend available for URLs with the given
+// scheme, so ForURL can create repositories in object stores that aren't
+// built in.
+//
+// It is intended to be called from the init function of the package that
+// implements the backend. To include a backend in the replicate binary,
+// blank-import that package from a file in cmd/replicate and
+// cmd/replicate-shared, optionally behind a build tag:
+//
+//	// +build mystore
+//
+//	package main
+//
+//	import _ "example.com/replicate-mystore"
+//
+// Register panics if the scheme is built in or already registered.
+func Register(scheme string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("repository: Register factory is nil")
+	}
+	s := Scheme(scheme)
+	if s == SchemeDisk || s == SchemeS3 || s == SchemeGCS {
+		panic(fmt.Sprintf("repository: scheme %q is built in", scheme))
+	}
+	if _, ok := factories[s]; ok {
+		panic(fmt.Sprintf("repository: Register called twice for scheme %q", scheme))
+	}
+	factories[s] = factory
+}
+
+// RegisteredSchemes returns the schemes of the backends added with Register,
+// sorted alphabetically
+func RegisteredSchemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	schemes := []string{}
+	for s := range factories {
+		schemes = append(schemes, string(s))
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func registeredFactory(scheme Scheme) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	factory, ok := factories[scheme]
+	return factory, ok
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func unregister(scheme string) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	delete(factories, Scheme(scheme))
+}
+
+func TestRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var gotURL string
+	Register("mystore", func(repositoryURL string) (Repository, error) {
+		gotURL = repositoryURL
+		return NewDiskRepository(dir)
+	})
+	defer unregister("mystore")
+
+	require.Equal(t, []string{"mystore"}, RegisteredSchemes())
+	require.Equal(t, shim(Scheme("mystore"), "my-bucket", "foo", nil), shim(SplitURL("mystore://my-bucket/foo")))
+
+	repo, err := ForURL("mystore://my-bucket/foo", "/project")
+	require.NoError(t, err)
+	require.Equal(t, "mystore://my-bucket/foo", gotURL)
+	require.NoError(t, repo.Put("hello.txt", []byte("hello")))
+	data, err := repo.Get("hello.txt")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	_, err = ForURL("foo://my-bucket", "/project")
+	require.Equal(t, fmt.Errorf(`Unknown repository scheme: foo.
+
+Make sure your repository URL starts with either 'file://', 's3://', 'gs://', or 'mystore://'.
+See the documentation for more details: https://replicate.ai/docs/reference/yaml`), err)
+
+	require.Panics(t, func() {
+		Register("mystore", func(repositoryURL string) (Repository, error) { return nil, nil })
+	})
+	require.Panics(t, func() {
+		Register("s3", func(repositoryURL string) (Repository, error) { return nil, nil })
+	})
+}
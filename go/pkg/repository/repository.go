@@ -2,12 +2,19 @@ package repository
 
 import (
 	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,7 +26,28 @@ import (
 	"github.com/replicate/replicate/go/pkg/files"
 )
 
-var maxWorkers = 128
+// defaultMaxWorkers is how many files are uploaded, downloaded or deleted at
+// once, unless REPLICATE_MAX_WORKERS or the network settings say otherwise
+const defaultMaxWorkers = 128
+
+const maxWorkersEnvVar = "REPLICATE_MAX_WORKERS"
+
+var maxWorkers = maxWorkersFromEnv()
+
+// maxWorkersFromEnv returns the number of workers in REPLICATE_MAX_WORKERS,
+// or the default if it isn't set to a positive number
+func maxWorkersFromEnv() int {
+	n, err := strconv.Atoi(os.Getenv(maxWorkersEnvVar))
+	if err != nil || n <= 0 {
+		return defaultMaxWorkers
+	}
+	return n
+}
+
+// MaxWorkers returns how many files are transferred at once
+func MaxWorkers() int {
+	return maxWorkers
+}
 
 type Scheme string
 
@@ -30,8 +58,13 @@ const (
 )
 
 type ListResult struct {
-	Path  string
-	MD5   []byte
+	Path string
+	MD5  []byte
+	Size int64
+	// ETag is the bucket's entity tag of the file, if it has one. Files
+	// without an MD5, such as multipart uploads to S3, can be compared
+	// with it instead.
+	ETag  string
 	Error error
 }
 
@@ -47,6 +80,13 @@ type Repository interface {
 	// Get data at path
 	Get(path string) ([]byte, error)
 
+	// GetReader returns a reader that streams the data at path. The caller must close it.
+	GetReader(path string) (io.ReadCloser, error)
+
+	// GetRangeReader returns a reader that streams length bytes of the data at path, starting at offset.
+	// The caller must close it.
+	GetRangeReader(path string, offset, length int64) (io.ReadCloser, error)
+
 	// GetPath recursively copies repoDir to localDir
 	GetPath(repoPath, localPath string) error
 
@@ -80,6 +120,15 @@ type Repository interface {
 	// all everything under path
 	Delete(path string) error
 
+	// Copy copies the object at src to dest. Where the backend can, it is
+	// copied without the data leaving it, so objects of any size can be
+	// copied without downloading them.
+	Copy(src, dest string) error
+
+	// Move moves the object at src to dest, like Copy then deleting src.
+	// Only the object at src is deleted, not other objects that start with it.
+	Move(src, dest string) error
+
 	// List files in a path non-recursively
 	//
 	// Returns a list of paths, prefixed with the given path, that can be passed straight to Get().
@@ -94,13 +143,27 @@ type Repository interface {
 	ListTarFile(path string) ([]string, error)
 
 	// List files in a path recursively
-	ListRecursive(results chan<- ListResult, folder string)
+	//
+	// Files are sent to results, which is always closed when listing is
+	// finished, whether or not it succeeded. If listing fails, a ListResult
+	// with an Error is sent, and it is the last thing sent. If folder does
+	// not exist, nothing is sent.
+	//
+	// If ctx is cancelled, listing stops and results is closed without
+	// anything else being sent, so callers can stop reading early by
+	// cancelling ctx.
+	ListRecursive(ctx context.Context, results chan<- ListResult, folder string)
 
-	MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string)
+	// Like ListRecursive, but only files named filename are sent
+	MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string)
 }
 
 // SplitURL splits a repository URL into <scheme>://<path>
 func SplitURL(repositoryURL string) (scheme Scheme, bucket string, root string, err error) {
+	// Paths on disk can have anything in them, so they aren't parsed as URLs
+	if strings.HasPrefix(repositoryURL, "file://") {
+		return SchemeDisk, "", diskRoot(strings.TrimPrefix(repositoryURL, "file://")), nil
+	}
 	u, err := url.Parse(repositoryURL)
 	if err != nil {
 		return "", "", "", err
@@ -108,16 +171,45 @@ func SplitURL(repositoryURL string) (scheme Scheme, bucket string, root string,
 	switch u.Scheme {
 	case "":
 		return "", "", "", unknownRepositoryScheme("")
-	case "file":
-		return SchemeDisk, "", u.Host + u.Path, nil
 	case "s3":
-		return SchemeS3, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+		return SchemeS3, u.Host, urlRoot(u), nil
 	case "gs":
-		return SchemeGCS, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+		return SchemeGCS, u.Host, urlRoot(u), nil
+	}
+	if _, ok := registeredFactory(Scheme(u.Scheme)); ok {
+		return Scheme(u.Scheme), u.Host, urlRoot(u), nil
 	}
 	return "", "", "", unknownRepositoryScheme(u.Scheme)
 }
 
+// diskRoot returns the path on disk in a file:// URL. Percent-escapes are
+// decoded if there are any, so paths can be written either way. It also
+// handles Windows paths: a drive letter (file://C:\foo, file:///C:/foo) or
+// a UNC path (file://\\server\share).
+func diskRoot(root string) string {
+	if unescaped, err := url.PathUnescape(root); err == nil {
+		root = unescaped
+	}
+	if len(root) >= 3 && root[0] == '/' && root[2] == ':' && isDriveLetter(root[1]) && (len(root) == 3 || root[3] == '/' || root[3] == '\\') {
+		root = root[1:]
+	}
+	return root
+}
+
+// urlRoot returns the root path in a bucket URL. # is allowed in keys, so
+// anything after one that url.Parse took to be a fragment is part of it.
+func urlRoot(u *url.URL) string {
+	root := strings.TrimPrefix(u.Path, "/")
+	if u.Fragment != "" {
+		root += "#" + u.Fragment
+	}
+	return root
+}
+
+func isDriveLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
 func ForURL(repositoryURL string, projectDir string) (Repository, error) {
 	scheme, bucket, root, err := SplitURL(repositoryURL)
 	if err != nil {
@@ -126,13 +218,24 @@ func ForURL(repositoryURL string, projectDir string) (Repository, error) {
 	switch scheme {
 	case SchemeDisk:
 		if !filepath.IsAbs(root) {
-			root = path.Join(projectDir, root)
+			root = filepath.Join(projectDir, root)
 		}
 		return NewDiskRepository(root)
 	case SchemeS3:
-		return NewS3Repository(bucket, root)
+		options, err := s3OptionsFromURL(repositoryURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3RepositoryWithOptions(bucket, root, options)
 	case SchemeGCS:
-		return NewGCSRepository(bucket, root)
+		options, err := gcsOptionsFromURL(repositoryURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewGCSRepositoryWithOptions(bucket, root, options)
+	}
+	if factory, ok := registeredFactory(scheme); ok {
+		return factory(repositoryURL)
 	}
 
 	return nil, unknownRepositoryScheme(string(scheme))
@@ -147,22 +250,31 @@ type fileToPut struct {
 	Info   os.FileInfo
 }
 
-func getListOfFilesToPut(localPath string, repoPath string) ([]fileToPut, error) {
+// getListOfFilesToPut returns the files in localPath that should be put in the
+// repository, skipping anything matched by .replicateignore or by the
+// gitignore-style patterns in exclude. Symlinks are followed. Special files,
+// such as sockets and named pipes, are skipped with a warning, or are an
+// error if errorOnSpecialFiles is set.
+func getListOfFilesToPut(localPath string, repoPath string, exclude []string, errorOnSpecialFiles bool) ([]fileToPut, error) {
 	// Perhaps this should be configurable, or done at a higher-level? It seems odd this is done at such a low level.
 	var ignore *gitignore.GitIgnore
 	var err error
 	ignoreFilePath := filepath.Join(localPath, ".replicateignore")
+	hasIgnoreFile := false
 	if isDir, _ := files.IsDir(localPath); isDir {
-		if exists, _ := files.FileExists(ignoreFilePath); exists {
-			ignore, err = gitignore.CompileIgnoreFile(ignoreFilePath)
-			if err != nil {
-				return nil, err
-			}
-		}
+		hasIgnoreFile, _ = files.FileExists(ignoreFilePath)
+	}
+	if hasIgnoreFile {
+		ignore, err = gitignore.CompileIgnoreFileAndLines(ignoreFilePath, exclude...)
+	} else if len(exclude) > 0 {
+		ignore, err = gitignore.CompileIgnoreLines(exclude...)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	result := []fileToPut{}
-	err = filepath.Walk(localPath, func(currentPath string, info os.FileInfo, err error) error {
+	err = walkFollowingSymlinks(localPath, func(currentPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -194,9 +306,17 @@ func getListOfFilesToPut(localPath string, repoPath string) ([]fileToPut, error)
 			return nil
 		}
 
+		if !info.Mode().IsRegular() {
+			if errorOnSpecialFiles {
+				return specialFileError(currentPath, info)
+			}
+			console.Warn("Skipping %s, because it is a %s", currentPath, specialFileKind(info))
+			return nil
+		}
+
 		result = append(result, fileToPut{
 			Source: currentPath,
-			Dest:   path.Join(repoPath, relativePath),
+			Dest:   path.Join(repoPath, filepath.ToSlash(relativePath)),
 			Info:   info,
 		})
 		return nil
@@ -204,29 +324,56 @@ func getListOfFilesToPut(localPath string, repoPath string) ([]fileToPut, error)
 	return result, err
 }
 
-func putPathTar(localPath string, out io.Writer, tarFileName string, includePath string) error {
+// ListLocalFiles returns the paths of the files in localPath that would be
+// put in a repository, relative to localPath, with .replicateignore and
+// exclude applied
+func ListLocalFiles(localPath string, exclude []string) ([]string, error) {
+	filesToPut, err := getListOfFilesToPut(localPath, "", exclude, false)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, file := range filesToPut {
+		paths = append(paths, file.Dest)
+	}
+	return paths, nil
+}
+
+// putPathTar writes localPath, or includePath inside it, to out as a tarball.
+// If it has enough files to be indexed, it is written as an indexed tarball
+// and its index is returned. Otherwise the index is nil.
+func putPathTar(localPath string, out io.Writer, tarFileName string, includePath string) (*TarIndex, error) {
+	// Prefix all paths with name of tarball so it isn't a rude tarball
+	rootDir := strings.TrimSuffix(tarFileName, ".tar.gz")
+	destPath := path.Join(rootDir, includePath)
+
+	files, err := getListOfFilesToPut(filepath.Join(localPath, filepath.FromSlash(includePath)), destPath, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) >= minIndexedTarFiles {
+		index, err := writeIndexedTar(files, out, rootDir)
+		if err != nil {
+			return nil, errors.WriteError(err.Error())
+		}
+		return index, nil
+	}
+
 	// archiver doesn't make it easy to include/exclude files, or write to a writer, so we have
 	// to implement all this ourselves
 	// TODO: adapt archiver so we can use its Archive() method with writers
 
 	z := archiver.NewTarGz()
 	if err := z.Create(out); err != nil {
-		return errors.WriteError(err.Error())
+		return nil, errors.WriteError(err.Error())
 	}
 	defer z.Close()
 
-	// Prefix all paths with name of tarball so it isn't a rude tarball
-	destPath := filepath.Join(strings.TrimSuffix(tarFileName, ".tar.gz"), includePath)
-
-	files, err := getListOfFilesToPut(filepath.Join(localPath, includePath), destPath)
-	if err != nil {
-		return err
-	}
-
 	for _, file := range files {
 		fh, err := os.Open(file.Source)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// write it to the archive
@@ -239,14 +386,28 @@ func putPathTar(localPath string, out io.Writer, tarFileName string, includePath
 		})
 		fh.Close()
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return nil, errors.WriteError(err.Error())
 		}
 	}
 	// Explicitly call Close() on success to capture error.
 	if err := z.Close(); err != nil {
-		return errors.WriteError(err.Error())
+		return nil, errors.WriteError(err.Error())
 	}
-	return nil
+	return nil, nil
+}
+
+// tarSizeEstimate returns a size that a tarball of the files in localPath
+// won't be bigger than. Compression can make data a tiny bit bigger if it
+// can't be compressed, and each file has a header and padding.
+func tarSizeEstimate(localPath string) int64 {
+	var size int64
+	_ = filepath.Walk(localPath, func(currentPath string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += info.Size() + 1024
+		}
+		return nil
+	})
+	return size + size/100 + 1024*1024
 }
 
 func extractTar(tarPath, localPath string) error {
@@ -273,6 +434,119 @@ func getListOfFilesInTar(tarPath string) ([]string, error) {
 	return result, err
 }
 
+// CopyFileFromTar writes the single file `itemPath` in the tarball `tarPath`
+// to out. The tarball is streamed from the repository and reading stops as
+// soon as the file has been found, so the rest of the tarball is never
+// downloaded or extracted. If the tarball is indexed, only the block the
+// file is in is downloaded.
+func CopyFileFromTar(r Repository, tarPath, itemPath string, out io.Writer) error {
+	if index := LoadTarIndex(r, tarPath); index != nil {
+		return copyFileFromIndexedTar(r, tarPath, index, itemPath, out)
+	}
+
+	reader, err := r.GetReader(tarPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %v", r.RootURL(), tarPath, err))
+	}
+	defer gz.Close()
+
+	tarBaseName := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
+	fullItemPath := path.Join(tarBaseName, path.Clean(itemPath))
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
+		}
+		if err != nil {
+			return errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %v", r.RootURL(), tarPath, err))
+		}
+		name := strings.TrimSuffix(header.Name, "/")
+		if name == fullItemPath {
+			if header.Typeflag == tar.TypeDir {
+				return fmt.Errorf("%s is a directory, not a file", itemPath)
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				return errors.ReadError(fmt.Sprintf("Failed to read %s from %s/%s: %v", itemPath, r.RootURL(), tarPath, err))
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, fullItemPath+"/") {
+			return fmt.Errorf("%s is a directory, not a file", itemPath)
+		}
+	}
+}
+
+// TarFile is a file in a tarball
+type TarFile struct {
+	// Path is relative to the tarball's root directory
+	Path string
+	// Size is -1 if it isn't known
+	Size int64
+	// SHA256 is the hex SHA-256 of the file's contents, or "" if it isn't
+	// known
+	SHA256 string
+}
+
+// ListTarFiles returns the files in the tarball `tarPath`. If the tarball is
+// indexed, only the index is downloaded, so the files' sizes and hashes
+// aren't known. Otherwise, the whole tarball is streamed to hash its files.
+func ListTarFiles(r Repository, tarPath string) ([]*TarFile, error) {
+	if index := LoadTarIndex(r, tarPath); index != nil {
+		files := []*TarFile{}
+		for filePath := range index.Files {
+			files = append(files, &TarFile{Path: filePath, Size: -1})
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+		return files, nil
+	}
+
+	reader, err := r.GetReader(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %v", r.RootURL(), tarPath, err))
+	}
+	defer gz.Close()
+
+	tarBaseName := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
+	files := []*TarFile{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %v", r.RootURL(), tarPath, err))
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, tr); err != nil {
+			return nil, errors.ReadError(fmt.Sprintf("Failed to read %s from %s/%s: %v", header.Name, r.RootURL(), tarPath, err))
+		}
+		files = append(files, &TarFile{
+			Path:   strings.TrimPrefix(header.Name, tarBaseName+"/"),
+			Size:   header.Size,
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+	}
+}
+
 func extractTarItem(tarPath, itemPath, localPath string) error {
 	tarBaseName := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
 	fullItemPath := path.Join(tarBaseName, itemPath)
@@ -309,7 +583,7 @@ func extractTarItem(tarPath, itemPath, localPath string) error {
 		return err
 	}
 
-	walkPath := path.Join(tmpDir, tarBaseName)
+	walkPath := filepath.Join(tmpDir, tarBaseName)
 	err = filepath.Walk(walkPath, func(currentPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -322,7 +596,7 @@ func extractTarItem(tarPath, itemPath, localPath string) error {
 		if err != nil {
 			return err
 		}
-		newPath := path.Join(localPath, relativePath)
+		newPath := filepath.Join(localPath, relativePath)
 
 		dir := filepath.Dir(newPath)
 
@@ -363,9 +637,14 @@ func unknownRepositoryScheme(scheme string) error {
 	} else {
 		message = "Unknown repository scheme: " + scheme
 	}
+	schemes := []string{"'file://'", "'s3://'", "'gs://'"}
+	for _, s := range RegisteredSchemes() {
+		schemes = append(schemes, "'"+s+"://'")
+	}
+	last := len(schemes) - 1
 	return fmt.Errorf(message + `.
 
-Make sure your repository URL starts with either 'file://', 's3://', or 'gs://'.
+Make sure your repository URL starts with either ` + strings.Join(schemes[:last], ", ") + `, or ` + schemes[last] + `.
 See the documentation for more details: https://replicate.ai/docs/reference/yaml`)
 }
 
@@ -374,14 +653,32 @@ func isVirtualenvDir(path string) (bool, error) {
 	return files.FileExists(filepath.Join(path, "pyvenv.cfg"))
 }
 
-func CopyToTempDir(localPath string, includePath string) (tempDir string, err error) {
+// snapshotTempDir makes the temporary directory for CopyToTempDir. It is in
+// .replicate/tmp in localPath if possible, so it is on the same filesystem and
+// files can be cloned instead of copied. scratch is whether it is in the
+// scratch directory instead, where the files take up space.
+func snapshotTempDir(localPath string) (tempDir string, scratch bool, err error) {
+	parent := filepath.Join(localPath, ".replicate", "tmp")
+	if err := os.MkdirAll(parent, 0755); err == nil {
+		if tempDir, err := ioutil.TempDir(parent, "copy-to-temp-dir-"); err == nil {
+			return tempDir, false, nil
+		}
+	}
+	tempDir, err = files.TempDir("copy-to-temp-dir")
+	return tempDir, true, err
+}
+
+// CopyToTempDir copies the files in includePath in localPath to a temporary
+// directory, so they can be saved while they continue to change.
+// errorOnSpecialFiles is passed to getListOfFilesToPut.
+func CopyToTempDir(localPath string, includePath string, exclude []string, errorOnSpecialFiles bool) (tempDir string, err error) {
 	// normalize path
 	includePath = filepath.Join(includePath)
 
 	console.Debug("Copying files to temporary directory")
 	start := time.Now()
 
-	tempDir, err = files.TempDir("copy-to-temp-dir")
+	tempDir, scratch, err := snapshotTempDir(localPath)
 	if err != nil {
 		return "", err
 	}
@@ -389,9 +686,10 @@ func CopyToTempDir(localPath string, includePath string) (tempDir string, err er
 	// we first scan the whole repository to get the list of eligable files,
 	// then copy the ones that match the includePath.
 	// TODO(andreas): only scan files in the includePath
-	filesToCopy, err := getListOfFilesToPut(localPath, tempDir)
-	count := 0
-	for _, file := range filesToCopy {
+	filesToPut, err := getListOfFilesToPut(localPath, tempDir, exclude, errorOnSpecialFiles)
+	filesToCopy := []fileToPut{}
+	var size int64
+	for _, file := range filesToPut {
 
 		// only include files in includePath
 		relPath, err := filepath.Rel(localPath, file.Source)
@@ -401,7 +699,21 @@ func CopyToTempDir(localPath string, includePath string) (tempDir string, err er
 		if !(includePath == "." || relPath == includePath || strings.HasPrefix(relPath, includePath+"/")) {
 			continue
 		}
+		filesToCopy = append(filesToCopy, file)
+		size += file.Info.Size()
+	}
+
+	// Files are only cloned on the same filesystem as the project, so
+	// copies to the scratch directory take up as much space as the files
+	if scratch {
+		if err := files.EnsureFreeSpace(tempDir, size); err != nil {
+			os.RemoveAll(tempDir)
+			return "", err
+		}
+	}
 
+	count := 0
+	for _, file := range filesToCopy {
 		dir := path.Dir(file.Dest)
 		dirExists, err := files.FileExists(dir)
 		if err != nil {
@@ -412,7 +724,7 @@ func CopyToTempDir(localPath string, includePath string) (tempDir string, err er
 				return "", fmt.Errorf("Failed to create directory %s: %v", dir, err)
 			}
 		}
-		if err := files.CopyFile(file.Source, file.Dest); err != nil {
+		if err := files.CloneFile(file.Source, file.Dest); err != nil {
 			return "", fmt.Errorf("Failed to copy %s to %s: %v", file.Source, file.Dest, err)
 		}
 		count += 1
@@ -7,6 +7,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -24,6 +25,19 @@ func TestSplitURL(t *testing.T) {
 	require.Equal(t, shim(SchemeDisk, "", "/foo/bar", nil), shim(SplitURL("file:///foo/bar")))
 	require.Equal(t, shim(SchemeDisk, "", "foo/bar", nil), shim(SplitURL("file://foo/bar")))
 
+	// Windows paths
+	require.Equal(t, shim(SchemeDisk, "", `C:\foo\bar`, nil), shim(SplitURL(`file://C:\foo\bar`)))
+	require.Equal(t, shim(SchemeDisk, "", "C:/foo/bar", nil), shim(SplitURL("file://C:/foo/bar")))
+	require.Equal(t, shim(SchemeDisk, "", "C:/foo/bar", nil), shim(SplitURL("file:///C:/foo/bar")))
+	require.Equal(t, shim(SchemeDisk, "", `\\server\share\foo`, nil), shim(SplitURL(`file://\\server\share\foo`)))
+
+	// Special characters
+	require.Equal(t, shim(SchemeDisk, "", "/my dir/a+b#1?", nil), shim(SplitURL("file:///my dir/a+b#1?")))
+	require.Equal(t, shim(SchemeDisk, "", "/my dir/ünïcödé", nil), shim(SplitURL("file:///my%20dir/%C3%BCn%C3%AFc%C3%B6d%C3%A9")))
+	require.Equal(t, shim(SchemeDisk, "", "50%off", nil), shim(SplitURL("file://50%off")))
+	require.Equal(t, shim(SchemeS3, "my-bucket", "my dir/a+b#1", nil), shim(SplitURL("s3://my-bucket/my dir/a+b#1")))
+	require.Equal(t, shim(SchemeGCS, "my-bucket", "ünïcödé", nil), shim(SplitURL("gs://my-bucket/ünïcödé")))
+
 	require.Equal(t, shim(SchemeS3, "my-bucket", "", nil), shim(SplitURL("s3://my-bucket")))
 	require.Equal(t, shim(SchemeS3, "my-bucket", "foo", nil), shim(SplitURL("s3://my-bucket/foo")))
 
@@ -40,6 +54,87 @@ Make sure your repository URL starts with either 'file://', 's3://', or 'gs://'.
 See the documentation for more details: https://replicate.ai/docs/reference/yaml`)), shim(SplitURL("/foo/bar")))
 }
 
+func TestS3OptionsFromURL(t *testing.T) {
+	options, err := s3OptionsFromURL("s3://my-bucket/foo")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{}, options)
+
+	options, err = s3OptionsFromURL("s3://my-bucket/foo?role_arn=arn:aws:iam::123456789012:role/replicate&external_id=abc&mfa_serial=arn:aws:iam::210987654321:mfa/ben")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{
+		RoleARN:    "arn:aws:iam::123456789012:role/replicate",
+		ExternalID: "abc",
+		MFASerial:  "arn:aws:iam::210987654321:mfa/ben",
+	}, options)
+
+	_, err = s3OptionsFromURL("s3://my-bucket?acl=public-read")
+	require.Error(t, err)
+	_, err = s3OptionsFromURL("s3://my-bucket?external_id=abc")
+	require.Error(t, err)
+
+	options, err = s3OptionsFromURL("s3://public-bucket?anonymous=true")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{Anonymous: true}, options)
+	_, err = s3OptionsFromURL("s3://public-bucket?anonymous=yes-please")
+	require.Error(t, err)
+	_, err = s3OptionsFromURL("s3://public-bucket?anonymous=true&role_arn=arn:aws:iam::123456789012:role/replicate")
+	require.Error(t, err)
+
+	options, err = s3OptionsFromURL("s3://my-bucket?region=us-gov-west-1&fips=true")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{Region: "us-gov-west-1", FIPS: true}, options)
+	options, err = s3OptionsFromURL("s3://my-bucket?region=eu-west-1&endpoint=https://vpce-1a2b3c4d-5e6f.s3.eu-west-1.vpce.amazonaws.com")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{Region: "eu-west-1", Endpoint: "https://vpce-1a2b3c4d-5e6f.s3.eu-west-1.vpce.amazonaws.com"}, options)
+	_, err = s3OptionsFromURL("s3://my-bucket?endpoint=vpce-1a2b3c4d-5e6f.s3.eu-west-1.vpce.amazonaws.com")
+	require.Error(t, err)
+	_, err = s3OptionsFromURL("s3://my-bucket?fips=true&endpoint=https://vpce-1a2b3c4d-5e6f.s3.eu-west-1.vpce.amazonaws.com")
+	require.Error(t, err)
+
+	options, err = s3OptionsFromURL("s3://my-bucket?credential_helper=vault")
+	require.NoError(t, err)
+	require.Equal(t, S3Options{CredentialHelper: "vault"}, options)
+	_, err = s3OptionsFromURL("s3://public-bucket?anonymous=true&credential_helper=vault")
+	require.Error(t, err)
+
+	// Options aren't part of the root
+	require.Equal(t, shim(SchemeS3, "my-bucket", "foo", nil), shim(SplitURL("s3://my-bucket/foo?role_arn=arn:aws:iam::123456789012:role/replicate")))
+	repo, err := ForURL("s3://my-bucket/foo?role_arn=arn:aws:iam::123456789012:role/replicate", "")
+	require.NoError(t, err)
+	require.Equal(t, "s3://my-bucket/foo", repo.RootURL())
+}
+
+func TestGCSOptionsFromURL(t *testing.T) {
+	options, err := gcsOptionsFromURL("gs://my-bucket/foo?impersonate_service_account=replicate@hooli.iam.gserviceaccount.com")
+	require.NoError(t, err)
+	require.Equal(t, GCSOptions{ImpersonateServiceAccount: "replicate@hooli.iam.gserviceaccount.com"}, options)
+
+	_, err = gcsOptionsFromURL("gs://my-bucket?role_arn=foo")
+	require.Error(t, err)
+
+	options, err = gcsOptionsFromURL("gs://public-bucket?anonymous=true")
+	require.NoError(t, err)
+	require.Equal(t, GCSOptions{Anonymous: true}, options)
+
+	options, err = gcsOptionsFromURL("gs://my-bucket?credential_helper=vault")
+	require.NoError(t, err)
+	require.Equal(t, GCSOptions{CredentialHelper: "vault"}, options)
+	_, err = gcsOptionsFromURL("gs://public-bucket?anonymous=true&credential_helper=vault")
+	require.Error(t, err)
+}
+
+func TestAnonymousRepositoriesAreReadOnly(t *testing.T) {
+	for _, url := range []string{"s3://public-bucket?anonymous=true", "gs://public-bucket?anonymous=true"} {
+		repo, err := ForURL(url, "")
+		require.NoError(t, err)
+		err = repo.Put("foo.txt", []byte("foo"))
+		require.Equal(t, errors.CodeWriteError, errors.Code(err))
+		require.Contains(t, err.Error(), "anonymously")
+		err = repo.Delete("foo.txt")
+		require.Equal(t, errors.CodeWriteError, errors.Code(err))
+	}
+}
+
 func TestListOfFilesToPut(t *testing.T) {
 	tmpDir, err := files.TempDir("repository-test")
 	require.NoError(t, err)
@@ -63,7 +158,7 @@ func TestListOfFilesToPut(t *testing.T) {
 	// test that .replicateignore is used
 	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "ignoreme/qux.txt"), []byte("qux"), 0644))
 
-	filesToPut, err := getListOfFilesToPut(tmpDir, "")
+	filesToPut, err := getListOfFilesToPut(tmpDir, "", nil, false)
 	require.NoError(t, err)
 
 	// erase .Info
@@ -124,8 +219,9 @@ func TestExtractTarItem(t *testing.T) {
 	require.NoError(t, err)
 	defer tarFile.Close()
 
-	err = putPathTar(fileDir, tarFile, "temp.tar.gz", "")
+	index, err := putPathTar(fileDir, tarFile, "temp.tar.gz", "")
 	require.NoError(t, err)
+	require.Nil(t, index)
 
 	// Create a temporary directory
 	tmpDir, err := files.TempDir("test")
@@ -165,9 +261,11 @@ func TestCopyToTempDir(t *testing.T) {
 	require.NoError(t, err)
 
 	// without includePath
-	tempDir, err := CopyToTempDir(dir, ".")
+	tempDir, err := CopyToTempDir(dir, ".", nil, false)
 	require.NoError(t, err)
 	defer os.RemoveAll(tempDir)
+	// On the same filesystem as the files so they can be cloned
+	require.True(t, strings.HasPrefix(tempDir, path.Join(dir, ".replicate", "tmp")+"/"))
 
 	contents, err := ioutil.ReadFile(path.Join(tempDir, "foo"))
 	require.NoError(t, err)
@@ -178,7 +276,7 @@ func TestCopyToTempDir(t *testing.T) {
 	require.Equal(t, "bar", string(contents))
 
 	// with directory includePath
-	tempDir, err = CopyToTempDir(dir, "my")
+	tempDir, err = CopyToTempDir(dir, "my", nil, false)
 	require.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
@@ -191,7 +289,7 @@ func TestCopyToTempDir(t *testing.T) {
 	require.Equal(t, "bar", string(contents))
 
 	// with file includePath
-	tempDir, err = CopyToTempDir(dir, "my/folder/bar")
+	tempDir, err = CopyToTempDir(dir, "my/folder/bar", nil, false)
 	require.NoError(t, err)
 	defer os.RemoveAll(tempDir)
 
@@ -202,4 +300,17 @@ func TestCopyToTempDir(t *testing.T) {
 	contents, err = ioutil.ReadFile(path.Join(tempDir, "my/folder/bar"))
 	require.NoError(t, err)
 	require.Equal(t, "bar", string(contents))
+
+	// with exclude patterns
+	tempDir, err = CopyToTempDir(dir, ".", []string{"my/"}, false)
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	exists, err = files.FileExists(path.Join(tempDir, "foo"))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = files.FileExists(path.Join(tempDir, "my/folder/bar"))
+	require.NoError(t, err)
+	require.False(t, exists)
 }
@@ -3,13 +3,21 @@ package repository
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -22,36 +30,175 @@ import (
 	"github.com/replicate/replicate/go/pkg/concurrency"
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
-	"github.com/replicate/replicate/go/pkg/files"
 )
 
+// S3Options are set with query parameters in the repository URL, e.g.
+// s3://bucket?role_arn=arn:aws:iam::123456789012:role/replicate
+type S3Options struct {
+	// RoleARN is a role to assume to access the bucket, which is how access
+	// is usually granted to buckets in other accounts
+	RoleARN string
+	// ExternalID is passed when assuming the role, if the role requires it
+	ExternalID string
+	// MFASerial is the serial number or ARN of an MFA device, if the role
+	// requires MFA. The code is asked for on the terminal, so it can't be
+	// used in the daemon.
+	MFASerial string
+	// Anonymous reads a public bucket without credentials. The repository
+	// is read-only.
+	Anonymous bool
+	// Region is the bucket's region. It is discovered if it isn't set, which
+	// needs access to the global S3 endpoint.
+	Region string
+	// Endpoint is the URL of an S3 endpoint to use instead of the public
+	// one, e.g. a VPC interface endpoint
+	Endpoint string
+	// FIPS uses the FIPS 140-2 endpoints for S3 and STS
+	FIPS bool
+	// CredentialHelper is the name of, or path to, a program that prints
+	// credentials. See credential_helper.go.
+	CredentialHelper string
+
+	// bucket is the bucket the options are for, which is passed to the
+	// credential helper
+	bucket string
+}
+
+var s3Log = console.Component("s3")
+
 type S3Repository struct {
 	bucketName string
 	root       string
+	options    S3Options
+
+	// Set by connect() on first use
+	mu         sync.Mutex
 	sess       *session.Session
 	svc        *s3.S3
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+
+	pacer     *pacer
+	listCache *listCache
 }
 
 func NewS3Repository(bucket, root string) (*S3Repository, error) {
-	region, err := getBucketRegionOrCreateBucket(bucket)
-	if err != nil {
-		return nil, err
-	}
+	return NewS3RepositoryWithOptions(bucket, root, S3Options{})
+}
 
+func NewS3RepositoryWithOptions(bucket, root string, options S3Options) (*S3Repository, error) {
+	options.bucket = bucket
 	s := &S3Repository{
 		bucketName: bucket,
 		root:       root,
+		options:    options,
+		pacer:      newPacer(s3Throttled),
 	}
-	s.sess, err = session.NewSession(&aws.Config{
-		Region:                        aws.String(region),
-		CredentialsChainVerboseErrors: aws.Bool(true),
-	})
+	s.listCache = newListCache(s.RootURL())
+	return s, nil
+}
+
+// s3OptionsFromURL reads S3Options from the query parameters of repositoryURL
+func s3OptionsFromURL(repositoryURL string) (S3Options, error) {
+	u, err := url.Parse(repositoryURL)
 	if err != nil {
-		return nil, errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to S3: %s", err))
+		return S3Options{}, err
+	}
+	options := S3Options{}
+	for name, values := range u.Query() {
+		value := values[len(values)-1]
+		switch name {
+		case "role_arn":
+			options.RoleARN = value
+		case "external_id":
+			options.ExternalID = value
+		case "mfa_serial":
+			options.MFASerial = value
+		case "anonymous":
+			options.Anonymous, err = strconv.ParseBool(value)
+			if err != nil {
+				return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The value of anonymous in repository URL %s must be true or false", repositoryURL))
+			}
+		case "region":
+			options.Region = value
+		case "endpoint":
+			endpoint, err := url.Parse(value)
+			if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+				return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The endpoint in repository URL %s must be a URL like https://vpce-1a2b3c4d-5e6f.s3.us-east-1.vpce.amazonaws.com", repositoryURL))
+			}
+			options.Endpoint = value
+		case "fips":
+			options.FIPS, err = strconv.ParseBool(value)
+			if err != nil {
+				return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The value of fips in repository URL %s must be true or false", repositoryURL))
+			}
+		case "credential_helper":
+			options.CredentialHelper = value
+		default:
+			return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("Unknown option %q in repository URL %s. The options for S3 repositories are role_arn, external_id, mfa_serial, anonymous, region, endpoint, fips, and credential_helper.", name, repositoryURL))
+		}
+	}
+	if options.RoleARN == "" && (options.ExternalID != "" || options.MFASerial != "") {
+		return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s has external_id or mfa_serial, but not role_arn", repositoryURL))
+	}
+	if options.Anonymous && options.RoleARN != "" {
+		return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s can't be anonymous and assume a role", repositoryURL))
+	}
+	if options.Anonymous && options.CredentialHelper != "" {
+		return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s can't be anonymous and have a credential helper", repositoryURL))
+	}
+	if options.FIPS && options.Endpoint != "" {
+		return S3Options{}, errors.RepositoryConfigurationError(fmt.Sprintf("The repository URL %s can't have both fips and endpoint. Set endpoint to the FIPS endpoint you want to use.", repositoryURL))
+	}
+	return options, nil
+}
+
+// connect looks up credentials and the bucket's region (creating the bucket if
+// it doesn't exist), and sets up clients. Every operation calls this first, and
+// it only does any work until it has succeeded once.
+func (s *S3Repository) connect() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.svc != nil {
+		return nil
+	}
+
+	sess, err := getS3Session("", s.options)
+	if err != nil {
+		return errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to S3: %s", err))
+	}
+	// Anonymous credentials are empty, so getting them fails
+	if _, err := sess.Config.Credentials.Get(); err != nil && !s.options.Anonymous {
+		if s.options.RoleARN != "" {
+			return s3AssumeRoleError(err, s.options.RoleARN, s.RootURL())
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return errors.RepositoryCredentialsError(fmt.Sprintf("Failed to get AWS credentials to access %s: %s", s.RootURL(), err))
+	}
+
+	region, err := getBucketRegionOrCreateBucket(s.bucketName, s.options)
+	if err != nil {
+		return err
+	}
+	s.sess, err = getS3Session(region, s.options)
+	if err != nil {
+		return errors.RepositoryConfigurationError(fmt.Sprintf("Failed to connect to S3: %s", err))
 	}
 	s.svc = s3.New(s.sess)
+	s.uploader = newS3Uploader(s.svc)
+	s.downloader = s3manager.NewDownloaderWithClient(s.svc)
+	return nil
+}
 
-	return s, nil
+// connectForWriting is connect for operations that change the bucket, which
+// anonymous repositories can't do
+func (s *S3Repository) connectForWriting() error {
+	if s.options.Anonymous {
+		return readOnlyError(s.RootURL())
+	}
+	return s.connect()
 }
 
 func (s *S3Repository) RootURL() string {
@@ -64,8 +211,13 @@ func (s *S3Repository) RootURL() string {
 
 // Get data at path
 func (s *S3Repository) Get(path string) ([]byte, error) {
-	key := filepath.Join(s.root, path)
-	obj, err := s.svc.GetObject(&s3.GetObjectInput{
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	key := objectKey(s.root, path)
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	obj, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
 	})
@@ -75,306 +227,844 @@ func (s *S3Repository) Get(path string) ([]byte, error) {
 				return nil, errors.DoesNotExist(fmt.Sprintf("Get: path does not exist: %v", path))
 			}
 		}
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read %s/%s: %s", s.RootURL(), path, err))
+		if stopped(ctx) {
+			return nil, stoppedError("downloading", s.RootURL()+"/"+path, nil)
+		}
+		if awsErrorCode(err) == errCodeInvalidObjectState {
+			return nil, s3ArchivedError(s.RootURL() + "/" + path)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to read %s/%s: %s", s.RootURL(), path, err))
 	}
 	body, err := ioutil.ReadAll(obj.Body)
 	if err != nil {
-		return nil, errors.ReadError(fmt.Sprintf("Failed to read body from %s/%s: %s", s.RootURL(), path, err))
+		if stopped(ctx) {
+			return nil, stoppedError("downloading", s.RootURL()+"/"+path, nil)
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to read body from %s/%s: %s", s.RootURL(), path, err))
 	}
 	return body, nil
 }
 
+func (s *S3Repository) GetReader(path string) (io.ReadCloser, error) {
+	return s.getReader(path, nil)
+}
+
+func (s *S3Repository) GetRangeReader(path string, offset, length int64) (io.ReadCloser, error) {
+	return s.getReader(path, aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)))
+}
+
+// getReader returns a reader for the object at path, or the range of it if
+// byteRange is set
+func (s *S3Repository) getReader(path string, byteRange *string) (io.ReadCloser, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	key := objectKey(s.root, path)
+	obj, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+		Range:  byteRange,
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			if aerr.Code() == s3.ErrCodeNoSuchKey {
+				return nil, errors.DoesNotExist(fmt.Sprintf("GetReader: path does not exist: %v", path))
+			}
+		}
+		if awsErrorCode(err) == errCodeInvalidObjectState {
+			return nil, s3ArchivedError(s.RootURL() + "/" + path)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to read %s/%s: %s", s.RootURL(), path, err))
+	}
+	return obj.Body, nil
+}
+
 func (s *S3Repository) Delete(path string) error {
-	console.Debug("Deleting %s/%s...", s.RootURL(), path)
-	key := filepath.Join(s.root, path)
+	s3Log.Debug("Deleting %s/%s...", s.RootURL(), path)
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.clear()
+	key := objectKey(s.root, path)
 	iter := s3manager.NewDeleteListIterator(s.svc, &s3.ListObjectsInput{
 		Bucket: &s.bucketName,
 		Prefix: &key,
 	})
-	if err := s3manager.NewBatchDeleteWithClient(s.svc).Delete(aws.BackgroundContext(), iter); err != nil {
-		return errors.WriteError(fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	if err := s3manager.NewBatchDeleteWithClient(s.svc).Delete(ctx, iter); err != nil {
+		if stopped(ctx) {
+			return stoppedError("deleting", s.RootURL()+"/"+path, nil)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), path, err))
 	}
 	return nil
 }
 
 // Put data at path
 func (s *S3Repository) Put(path string, data []byte) error {
-	key := filepath.Join(s.root, path)
-	uploader := s3manager.NewUploader(s.sess)
-	_, err := uploader.Upload(&s3manager.UploadInput{
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(path)
+	key := objectKey(s.root, path)
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(key),
 		Body:   bytes.NewReader(data),
 	})
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to upload to %s/%s: %v", s.RootURL(), path, err))
+		if stopped(ctx) {
+			s.abortMultipartUpload(err, key)
+			return stoppedError("uploading", s.RootURL()+"/"+path, nil)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Unable to upload to %s/%s: %v", s.RootURL(), path, err))
 	}
 	return nil
 }
 
 func (s *S3Repository) PutPath(localPath string, destPath string) error {
-	files, err := getListOfFilesToPut(localPath, filepath.Join(s.root, destPath))
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(destPath)
+	files, err := getListOfFilesToPut(localPath, pathpkg.Join(s.root, destPath), nil, false)
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
 	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	progress := newTransferProgress(len(files))
 
 	for _, file := range files {
 		// Variables used in closure
 		file := file
 		err := queue.Go(func() error {
-			data, err := ioutil.ReadFile(file.Source)
+			// Read from the file as it is uploaded, rather than into memory,
+			// because it could be bigger than memory. The uploader knows its
+			// size from the file, so large files are uploaded in parts.
+			f, err := os.Open(file.Source)
 			if err != nil {
 				return err
 			}
+			defer f.Close()
 
-			uploader := s3manager.NewUploader(s.sess)
-			_, err = uploader.Upload(&s3manager.UploadInput{
+			start := time.Now()
+			ctx, cancel := withOverallTimeout(transferContext())
+			defer cancel()
+			_, err = s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 				Bucket: aws.String(s.bucketName),
-				Key:    aws.String(file.Dest),
-				Body:   bytes.NewReader(data),
+				Key:    aws.String(encodeKey(file.Dest)),
+				Body:   f,
 			})
-			return err
+			if err != nil {
+				if stopped(ctx) {
+					s.abortMultipartUpload(err, encodeKey(file.Dest))
+					return stoppedError("uploading", "s3://"+s.bucketName+"/"+file.Dest, progress)
+				}
+				return err
+			}
+			s3Log.Debug("Uploaded %s to s3://%s/%s (%d bytes, took %.3f seconds)", file.Source, s.bucketName, file.Dest, file.Info.Size(), time.Since(start).Seconds())
+			progress.add()
+			return nil
 		})
 		if err != nil {
-			return errors.WriteError(err.Error())
+			return writeError(err, err.Error())
 		}
 	}
 
 	if err := queue.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		if isStoppedError(err) {
+			return err
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, err.Error())
 	}
 	return nil
 }
 
 func (s *S3Repository) PutPathTar(localPath, tarPath, includePath string) error {
 	if !strings.HasSuffix(tarPath, ".tar.gz") {
-		return fmt.Errorf("PutPathTar: tarPath must end with .tar.gz")
+		return errors.WriteError("PutPathTar: tarPath must end with .tar.gz")
 	}
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(tarPath)
 
 	reader, writer := io.Pipe()
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
 
 	// TODO: This doesn't cancel elegantly on error -- we should use the context returned here and check if it is done.
 	errs, _ := errgroup.WithContext(context.TODO())
 
+	key := objectKey(s.root, tarPath)
+	var index *TarIndex
+	var uploadErr error
 	errs.Go(func() error {
-		if err := putPathTar(localPath, writer, filepath.Base(tarPath), includePath); err != nil {
+		var err error
+		if index, err = putPathTar(localPath, writer, pathpkg.Base(tarPath), includePath); err != nil {
 			return err
 		}
 		return writer.Close()
 	})
 	errs.Go(func() error {
-		key := filepath.Join(s.root, tarPath)
-		uploader := s3manager.NewUploader(s.sess)
-		_, err := uploader.Upload(&s3manager.UploadInput{
+		// The size of a stream isn't known in advance, so the parts need to
+		// be big enough that the tarball fits in as many parts as S3 allows
+		partSize := s3PartSize(tarSizeEstimate(filepath.Join(localPath, filepath.FromSlash(includePath))))
+		_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 			Bucket: aws.String(s.bucketName),
 			Key:    aws.String(key),
 			Body:   reader,
+		}, func(u *s3manager.Uploader) {
+			u.PartSize = partSize
 		})
+		if err != nil {
+			// Stop writing the tarball, which would otherwise block
+			// forever on the pipe
+			reader.CloseWithError(err)
+			uploadErr = err
+		}
 		return err
 	})
 	if err := errs.Wait(); err != nil {
-		return errors.WriteError(err.Error())
+		if stopped(ctx) {
+			s.abortMultipartUpload(uploadErr, key)
+			return stoppedError("uploading", s.RootURL()+"/"+tarPath, nil)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, err.Error())
 	}
-	return nil
+	return putTarIndex(s, tarPath, index)
 }
 
 // GetPath recursively copies repoDir to localDir
 func (s *S3Repository) GetPath(remoteDir string, localDir string) error {
-	prefix := filepath.Join(s.root, remoteDir)
-	iter := new(s3manager.DownloadObjectsIterator)
-	files := []*os.File{}
-	defer func() {
-		for _, f := range files {
-			if err := f.Close(); err != nil {
-				console.Warn("Failed to close file %s", f.Name())
-			}
-		}
-	}()
+	if err := s.connect(); err != nil {
+		return err
+	}
+	prefix := pathpkg.Join(s.root, remoteDir)
 
 	keys := []*string{}
+	sizes := []int64{}
+	var keyErr error
 	err := s.svc.ListObjectsV2PagesWithContext(aws.BackgroundContext(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucketName),
-		Prefix: aws.String(prefix),
+		Bucket:       aws.String(s.bucketName),
+		Prefix:       aws.String(encodeKey(prefix)),
+		EncodingType: aws.String(s3.EncodingTypeUrl),
 	}, func(output *s3.ListObjectsV2Output, last bool) bool {
 		for _, object := range output.Contents {
-			keys = append(keys, object.Key)
+			key, err := s3ListedKey(object.Key)
+			if err != nil {
+				keyErr = err
+				return false
+			}
+			keys = append(keys, aws.String(key))
+			sizes = append(sizes, aws.Int64Value(object.Size))
 		}
 		return true
 	})
-	if err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to list objects in s3://%s/%s: %v", s.bucketName, prefix, err))
+	if err == nil {
+		err = keyErr
 	}
-
-	for _, key := range keys {
-		relPath, err := filepath.Rel(prefix, *key)
-		if err != nil {
-			return fmt.Errorf("Failed to determine directory of %s relative to %s: %v", *key, prefix, err)
-		}
-		localPath := filepath.Join(localDir, relPath)
-		localDir := filepath.Dir(localPath)
-		if err := os.MkdirAll(localDir, 0755); err != nil {
-			return fmt.Errorf("Failed to create directory %s: %v", localDir, err)
+	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
 		}
+		return listError(err, fmt.Sprintf("Failed to list objects in s3://%s/%s: %v", s.bucketName, prefix, err))
+	}
 
-		f, err := os.Create(localPath)
-		if err != nil {
-			return fmt.Errorf("Failed to create file %s: %v", localPath, err)
-		}
+	// Each object is downloaded on its own, rather than in a batch, so a
+	// timeout can say which one it was
+	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	progress := newTransferProgress(len(keys))
+	downloads := currentDownloads()
+	for i, key := range keys {
+		// Variables used in closure
+		key := key
+		size := sizes[i]
+		err := queue.Go(func() error {
+			localPath := filepath.Join(localDir, filepath.FromSlash(objectPath(prefix, *key)))
+			localDir := filepath.Dir(localPath)
+			if err := os.MkdirAll(localDir, 0755); err != nil {
+				return readError(err, fmt.Sprintf("Failed to create directory %s: %v", localDir, err))
+			}
 
-		console.Debug("Downloading %s to %s", *key, localPath)
+			f, err := os.Create(localPath)
+			if err != nil {
+				return readError(err, fmt.Sprintf("Failed to create file %s: %v", localPath, err))
+			}
+			defer func() {
+				if err := f.Close(); err != nil {
+					s3Log.Warn("Failed to close file %s", f.Name())
+				}
+			}()
 
-		iter.Objects = append(iter.Objects, s3manager.BatchDownloadObject{
-			Object: &s3.GetObjectInput{
+			s3Log.Debug("Downloading %s to %s", *key, localPath)
+			start := time.Now()
+			ctx, cancel := withOverallTimeout(transferContext())
+			defer cancel()
+			// Objects bigger than the chunk size are downloaded as several
+			// ranges at once
+			_, err = s.downloader.DownloadWithContext(ctx, f, &s3.GetObjectInput{
 				Bucket: aws.String(s.bucketName),
 				Key:    key,
-			},
-			Writer: f,
+			}, func(d *s3manager.Downloader) {
+				d.PartSize = downloads.ChunkSize
+				d.Concurrency = downloads.Concurrency
+			})
+			if err == nil && size > downloads.ChunkSize {
+				err = s.verifyDownload(ctx, *key, localPath, size)
+			}
+			if err != nil {
+				if stopped(ctx) {
+					return stoppedError("downloading", "s3://"+s.bucketName+"/"+*key, progress)
+				}
+				return err
+			}
+			s3Log.Debug("Downloaded %s (%d bytes, took %.3f seconds)", *key, size, time.Since(start).Seconds())
+			progress.add()
+			return nil
 		})
-		files = append(files, f)
+		if err != nil {
+			return err
+		}
 	}
 
-	downloader := s3manager.NewDownloader(s.sess)
-	if err := downloader.DownloadWithIterator(aws.BackgroundContext(), iter); err != nil {
-		return errors.ReadError(fmt.Sprintf("Failed to download s3://%s/%s to %s", s.bucketName, prefix, localDir))
+	if err := queue.Wait(); err != nil {
+		if isStoppedError(err) {
+			return err
+		}
+		if awsErrorCode(err) == errCodeInvalidObjectState {
+			return s3ArchivedError(s.RootURL() + "/" + remoteDir)
+		}
+		return readError(err, fmt.Sprintf("Failed to download s3://%s/%s to %s: %v", s.bucketName, prefix, localDir, err))
 	}
 	return nil
 }
 
-func (s *S3Repository) GetPathTar(tarPath, localPath string) error {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
+// verifyDownload checks the file at localPath, which is size bytes, against
+// the ETag of the object at key. The ETag is the MD5 of objects that were
+// uploaded in one piece, and the MD5 of the MD5s of each part, followed by
+// the number of parts, for objects that were uploaded in parts. The ETags of
+// objects encrypted with KMS or customer-provided keys aren't MD5s, so they
+// can't be checked.
+func (s *S3Repository) verifyDownload(ctx context.Context, key string, localPath string, size int64) error {
+	// The size of the first part is the size that all but the last part are
+	head, err := s.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(key),
+		PartNumber: aws.Int64(1),
+	})
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return err
+	if aws.StringValue(head.ServerSideEncryption) == s3.ServerSideEncryptionAwsKms || head.SSECustomerAlgorithm != nil {
+		return nil
 	}
-	exists, err := files.FileExists(tmptarball)
-	if err != nil {
-		return err
+	etag := strings.Trim(aws.StringValue(head.ETag), `"`)
+	var expected string
+	if parts := aws.Int64Value(head.PartsCount); parts == 0 {
+		if strings.Contains(etag, "-") {
+			// It was uploaded in parts, but their sizes aren't known
+			return nil
+		}
+		sum, err := fileChecksum(localPath, 0, -1, md5.New())
+		if err != nil {
+			return err
+		}
+		expected = hex.EncodeToString(sum)
+	} else {
+		partSize := aws.Int64Value(head.ContentLength)
+		if partSize*(parts-1) >= size || partSize*parts < size {
+			// The parts aren't all the same size, so where each one starts
+			// isn't known
+			return nil
+		}
+		sums := md5.New()
+		for i := int64(0); i < parts; i++ {
+			sum, err := fileChecksum(localPath, i*partSize, partSize, md5.New())
+			if err != nil {
+				return err
+			}
+			sums.Write(sum)
+		}
+		expected = fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), parts)
 	}
-	if !exists {
-		return errors.DoesNotExist(fmt.Sprintf("GetPathTar: does not exist: %v", tmptarball))
+	if etag != expected {
+		return errors.Transient("The downloaded file doesn't match the object's ETag, so it was corrupted while it was being downloaded")
 	}
-	return extractTar(tmptarball, localPath)
+	return nil
+}
+
+// objectSize returns the size in bytes of the object at path
+func (s *S3Repository) objectSize(path string) (int64, error) {
+	if err := s.connect(); err != nil {
+		return 0, err
+	}
+	head, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey(s.root, path)),
+	})
+	if err != nil {
+		if awsErrorCode(err) == "NotFound" {
+			return 0, errors.DoesNotExist(fmt.Sprintf("Path does not exist: %s/%s", s.RootURL(), path))
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return 0, cerr
+		}
+		return 0, readError(err, fmt.Sprintf("Failed to get the size of %s/%s: %s", s.RootURL(), path, err))
+	}
+	return aws.Int64Value(head.ContentLength), nil
+}
+
+func (s *S3Repository) GetPathTar(tarPath, localPath string) error {
+	return getPathTar(s, tarPath, "", localPath)
 }
 
 func (s *S3Repository) GetPathItemTar(tarPath, itemPath, localPath string) error {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
+	return getPathTar(s, tarPath, itemPath, localPath)
+}
+
+// ArchiveStatus returns whether the object at path is in the Glacier or Deep
+// Archive storage classes, or an Intelligent-Tiering archive tier, and has to
+// be restored before it can be read
+func (s *S3Repository) ArchiveStatus(path string) (*ArchiveStatus, error) {
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	key := objectKey(s.root, path)
+	out, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
 	if err != nil {
-		return err
+		if awsErrorCode(err) == "NotFound" {
+			return nil, errors.DoesNotExist(fmt.Sprintf("ArchiveStatus: path does not exist: %v", path))
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to get status of %s/%s: %s", s.RootURL(), path, err))
 	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return err
+	return s3ArchiveStatus(aws.StringValue(out.StorageClass), aws.StringValue(out.ArchiveStatus), aws.StringValue(out.Restore)), nil
+}
+
+// Restore requests a Standard retrieval of the archived object at path
+func (s *S3Repository) Restore(path string, days int) error {
+	if s.options.Anonymous {
+		return readOnlyError(s.RootURL())
 	}
-	exists, err := files.FileExists(tmptarball)
+	status, err := s.ArchiveStatus(path)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.DoesNotExist("Path does not exist: " + tmptarball)
+	if !status.Archived || status.Restoring {
+		return nil
+	}
+	key := objectKey(s.root, path)
+	restoreRequest := &s3.RestoreRequest{
+		GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(s3.TierStandard)},
+	}
+	// Intelligent-Tiering moves restored objects back to the frequent access
+	// tier rather than making a temporary copy, so days can't be set
+	if status.StorageClass != s3.StorageClassIntelligentTiering {
+		restoreRequest.Days = aws.Int64(int64(days))
+	}
+	s3Log.Debug("Requesting restore of %s/%s", s.RootURL(), path)
+	_, err = s.svc.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:         aws.String(s.bucketName),
+		Key:            aws.String(key),
+		RestoreRequest: restoreRequest,
+	})
+	if err != nil {
+		if awsErrorCode(err) == "RestoreAlreadyInProgress" {
+			return nil
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to request restore of %s/%s: %s", s.RootURL(), path, err))
 	}
-	return extractTarItem(tmptarball, itemPath, localPath)
+	return nil
 }
 
-func (s *S3Repository) ListRecursive(results chan<- ListResult, dir string) {
-	s.listRecursive(results, dir, func(_ string) bool { return true })
+// s3MaxCopySize is the size of the biggest object CopyObject can copy. Bigger
+// objects are copied a part at a time, with parts of s3CopyPartSize.
+const (
+	s3MaxCopySize  = 5 * 1024 * 1024 * 1024
+	s3CopyPartSize = 1024 * 1024 * 1024
+)
+
+// Archive copies the object at path over itself in storageClass, which is
+// GLACIER if it is empty. Objects that are already archived are left as they
+// are, because they can't be copied without being restored first.
+func (s *S3Repository) Archive(path string, storageClass string) (string, error) {
+	if storageClass == "" {
+		storageClass = s3.StorageClassGlacier
+	}
+	if err := s.connectForWriting(); err != nil {
+		return "", err
+	}
+	key := objectKey(s.root, path)
+	head, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if awsErrorCode(err) == "NotFound" {
+			return "", errors.DoesNotExist(fmt.Sprintf("Archive: path does not exist: %v", path))
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return "", cerr
+		}
+		return "", readError(err, fmt.Sprintf("Failed to get status of %s/%s: %s", s.RootURL(), path, err))
+	}
+	status := s3ArchiveStatus(aws.StringValue(head.StorageClass), aws.StringValue(head.ArchiveStatus), aws.StringValue(head.Restore))
+	if status.Archived || status.StorageClass == storageClass {
+		return status.StorageClass, nil
+	}
+
+	s3Log.Debug("Moving %s/%s to %s", s.RootURL(), path, storageClass)
+	source := (&url.URL{Path: s.bucketName + "/" + key}).EscapedPath()
+	if aws.Int64Value(head.ContentLength) <= s3MaxCopySize {
+		_, err = s.svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:               aws.String(s.bucketName),
+			Key:                  aws.String(key),
+			CopySource:           aws.String(source),
+			MetadataDirective:    aws.String(s3.MetadataDirectiveCopy),
+			StorageClass:         aws.String(storageClass),
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+		})
+	} else {
+		err = s.copyInParts(key, source, head, aws.String(storageClass))
+	}
+	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return "", cerr
+		}
+		return "", writeError(err, fmt.Sprintf("Failed to move %s/%s to %s: %s", s.RootURL(), path, storageClass, err))
+	}
+	return storageClass, nil
 }
 
-func (s *S3Repository) MatchFilenamesRecursive(results chan<- ListResult, folder string, filename string) {
-	s.listRecursive(results, folder, func(key string) bool {
-		return filepath.Base(key) == filename
+// copyInParts copies the object at source, whose metadata is head, to key in
+// storageClass, a part at a time, because CopyObject can't copy objects
+// bigger than 5GB
+func (s *S3Repository) copyInParts(key string, source string, head *s3.HeadObjectOutput, storageClass *string) error {
+	upload, err := s.svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(s.bucketName),
+		Key:                  aws.String(key),
+		StorageClass:         storageClass,
+		ContentType:          head.ContentType,
+		ContentEncoding:      head.ContentEncoding,
+		Metadata:             head.Metadata,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+	})
+	if err != nil {
+		return err
+	}
+	size := aws.Int64Value(head.ContentLength)
+	parts := []*s3.CompletedPart{}
+	for number, offset := int64(1), int64(0); offset < size; number, offset = number+1, offset+s3CopyPartSize {
+		end := offset + s3CopyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		out, err := s.svc.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucketName),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int64(number),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			s.abortUpload(key, upload.UploadId)
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int64(number)})
+	}
+	_, err = s.svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
 	})
+	if err != nil {
+		s.abortUpload(key, upload.UploadId)
+	}
+	return err
 }
 
-// List files in a path non-recursively
-func (s *S3Repository) List(dir string) ([]string, error) {
-	results := []string{}
-	prefix := filepath.Join(s.root, dir)
+// Copy copies the object at src to dest inside the bucket, with CopyObject,
+// or a part at a time if it is bigger than 5GB. Its storage class and
+// encryption are kept.
+func (s *S3Repository) Copy(src, dest string) error {
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	s.listCache.invalidate(dest)
+	srcKey, destKey := objectKey(s.root, src), objectKey(s.root, dest)
+	head, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		if awsErrorCode(err) == "NotFound" {
+			return errors.DoesNotExist(fmt.Sprintf("Copy: path does not exist: %v", src))
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return readError(err, fmt.Sprintf("Failed to get status of %s/%s: %s", s.RootURL(), src, err))
+	}
 
-	// prefixes must end with / and must not end with /
-	if !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
+	s3Log.Debug("Copying %s/%s to %s", s.RootURL(), src, dest)
+	source := (&url.URL{Path: s.bucketName + "/" + srcKey}).EscapedPath()
+	if aws.Int64Value(head.ContentLength) <= s3MaxCopySize {
+		_, err = s.svc.CopyObject(&s3.CopyObjectInput{
+			Bucket:               aws.String(s.bucketName),
+			Key:                  aws.String(destKey),
+			CopySource:           aws.String(source),
+			MetadataDirective:    aws.String(s3.MetadataDirectiveCopy),
+			StorageClass:         head.StorageClass,
+			ServerSideEncryption: head.ServerSideEncryption,
+			SSEKMSKeyId:          head.SSEKMSKeyId,
+		})
+	} else {
+		err = s.copyInParts(destKey, source, head, head.StorageClass)
 	}
-	prefix = strings.TrimPrefix(prefix, "/")
+	if err != nil {
+		if awsErrorCode(err) == errCodeInvalidObjectState {
+			return s3ArchivedError(s.RootURL() + "/" + src)
+		}
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to copy %s/%s to %s: %s", s.RootURL(), src, dest, err))
+	}
+	return nil
+}
 
-	err := s.svc.ListObjectsPages(&s3.ListObjectsInput{
-		Bucket:    aws.String(s.bucketName),
-		Prefix:    aws.String(prefix),
-		Delimiter: aws.String("/"),
-		MaxKeys:   aws.Int64(1000),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		for _, value := range page.Contents {
-			key := *value.Key
-			if s.root != "" {
-				key = strings.TrimPrefix(strings.TrimPrefix(key, s.root), "/")
-			}
-			results = append(results, key)
+// Move copies the object at src to dest, then deletes src. S3 can't rename
+// objects.
+func (s *S3Repository) Move(src, dest string) error {
+	if err := s.Copy(src, dest); err != nil {
+		return err
+	}
+	s.listCache.invalidate(src)
+	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey(s.root, src)),
+	})
+	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
 		}
-		return true
+		return writeError(err, fmt.Sprintf("Failed to delete %s/%s: %v", s.RootURL(), src, err))
+	}
+	return nil
+}
+
+// abortUpload aborts the multipart upload of key with uploadID that failed,
+// so the parts that were copied aren't stored
+func (s *S3Repository) abortUpload(key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	_, err := s.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		UploadId: uploadID,
 	})
 	if err != nil {
-		return nil, errors.ReadError(err.Error())
+		s3Log.Warn("Failed to abort the incomplete upload of s3://%s/%s, so the parts that were copied are still stored. Run 'replicate status' to see incomplete uploads. %s", s.bucketName, key, err)
 	}
-	return results, nil
 }
 
-func (s *S3Repository) ListTarFile(tarPath string) ([]string, error) {
-	// archiver doesn't let us use readers, so download to temporary file
-	// TODO: make a better tar implementation
-	tmpdir, err := files.TempDir("tar")
+// SetLifecycleRules sets lifecycle rules on the bucket that move objects to
+// STANDARD_IA and GLACIER
+func (s *S3Repository) SetLifecycleRules(rules []LifecycleRule) error {
+	if err := s.connectForWriting(); err != nil {
+		return err
+	}
+	existing := []*s3.LifecycleRule{}
+	out, err := s.svc.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucketName),
+	})
 	if err != nil {
-		return nil, err
+		if awsErrorCode(err) != "NoSuchLifecycleConfiguration" {
+			if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+				return cerr
+			}
+			return readError(err, fmt.Sprintf("Failed to get lifecycle rules of s3://%s: %s", s.bucketName, err))
+		}
+	} else {
+		existing = out.Rules
 	}
-	defer os.RemoveAll(tmpdir)
-	tmptarball := filepath.Join(tmpdir, filepath.Base(tarPath))
-	if err := s.GetPath(tarPath, tmptarball); err != nil {
-		return nil, err
+
+	newRules := s3LifecycleRules(existing, s.root, rules)
+	if len(newRules) == 0 {
+		_, err = s.svc.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(s.bucketName),
+		})
+	} else {
+		_, err = s.svc.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(s.bucketName),
+			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: newRules},
+		})
 	}
-	exists, err := files.FileExists(tmptarball)
 	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return cerr
+		}
+		return writeError(err, fmt.Sprintf("Failed to set lifecycle rules of s3://%s: %s", s.bucketName, err))
+	}
+	return nil
+}
+
+func (s *S3Repository) ListIncompleteUploads() ([]*IncompleteUpload, error) {
+	if err := s.connect(); err != nil {
 		return nil, err
 	}
-	if !exists {
-		return nil, errors.DoesNotExist("Path does not exist: " + tmptarball)
+	prefix := ""
+	if s.root != "" {
+		prefix = encodeKey(s.root) + "/"
 	}
-
-	files, err := getListOfFilesInTar(tmptarball)
+	uploads := []*IncompleteUpload{}
+	err := s.svc.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	}, func(output *s3.ListMultipartUploadsOutput, last bool) bool {
+		for _, upload := range output.Uploads {
+			uploads = append(uploads, &IncompleteUpload{
+				Path:      objectPath(s.root, aws.StringValue(upload.Key)),
+				Initiated: aws.TimeValue(upload.Initiated),
+			})
+		}
+		return true
+	})
 	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			return nil, cerr
+		}
+		return nil, listError(err, fmt.Sprintf("Failed to list incomplete uploads in %s: %v", s.RootURL(), err))
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Initiated.Before(uploads[j].Initiated) })
+	return uploads, nil
+}
+
+func (s *S3Repository) ListRecursive(ctx context.Context, results chan<- ListResult, dir string) {
+	s.listRecursive(ctx, results, dir, func(_ string) bool { return true })
+}
+
+func (s *S3Repository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	s.listRecursive(ctx, results, folder, func(key string) bool {
+		return pathpkg.Base(key) == filename
+	})
+}
+
+// List files in a path non-recursively
+func (s *S3Repository) List(dir string) ([]string, error) {
+	if err := s.connect(); err != nil {
 		return nil, err
 	}
+	results := []string{}
+	prefix := objectKey(s.root, dir)
 
-	tarname := filepath.Base(strings.TrimSuffix(tarPath, ".tar.gz"))
-	for idx := range files {
-		files[idx] = strings.TrimPrefix(files[idx], tarname+"/")
+	// prefixes must end with / and must not end with /
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	prefix = strings.TrimPrefix(prefix, "/")
+
+	input := &s3.ListObjectsInput{
+		Bucket:       aws.String(s.bucketName),
+		Prefix:       aws.String(prefix),
+		EncodingType: aws.String(s3.EncodingTypeUrl),
+		Delimiter:    aws.String("/"),
+		MaxKeys:      aws.Int64(1000),
+	}
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	for {
+		var page *s3.ListObjectsOutput
+		err := s.pacer.call(ctx, func() (err error) {
+			page, err = s.svc.ListObjectsWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			if stopped(ctx) {
+				return nil, stoppedError("listing", s.RootURL()+"/"+dir, nil)
+			}
+			if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+				return nil, cerr
+			}
+			return nil, readError(err, err.Error())
+		}
+		for _, value := range page.Contents {
+			rawKey, err := s3ListedKey(value.Key)
+			if err != nil {
+				return nil, readError(err, err.Error())
+			}
+			results = append(results, objectPath(s.root, rawKey))
+		}
+		marker, err := s3NextMarker(page)
+		if err != nil {
+			return nil, readError(err, err.Error())
+		}
+		if marker == "" {
+			return results, nil
+		}
+		input.Marker = aws.String(marker)
 	}
+}
 
-	return files, nil
+func (s *S3Repository) ListTarFile(tarPath string) ([]string, error) {
+	return listTarFile(s, tarPath)
 }
 
 func CreateS3Bucket(region, bucket string) (err error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:                        aws.String(region),
-		CredentialsChainVerboseErrors: aws.Bool(true),
-	})
+	return createS3BucketWithOptions(region, bucket, S3Options{})
+}
+
+func createS3BucketWithOptions(region, bucket string, options S3Options) (err error) {
+	sess, err := getS3Session(region, options)
 	if err != nil {
 		return fmt.Errorf("Failed to connect to S3: %w", err)
 	}
 	svc := s3.New(sess)
 
-	_, err = svc.CreateBucket(&s3.CreateBucketInput{
+	input := &s3.CreateBucketInput{
 		Bucket: aws.String(bucket),
-	})
+	}
+	// Buckets are made in us-east-1 unless another region is given
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+	}
+	_, err = svc.CreateBucket(input)
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to create bucket %q, %v", bucket, err))
+		return writeError(err, fmt.Sprintf("Unable to create bucket %q, %v", bucket, err))
 	}
 
 	// Default max attempts is 20, but we hit this sometimes
@@ -382,16 +1072,13 @@ func CreateS3Bucket(region, bucket string) (err error) {
 		Bucket: aws.String(bucket),
 	}, request.WithWaiterMaxAttempts(50))
 	if err != nil {
-		return errors.WriteError(err.Error())
+		return writeError(err, err.Error())
 	}
 	return nil
 }
 
 func DeleteS3Bucket(region, bucket string) (err error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:                        aws.String(region),
-		CredentialsChainVerboseErrors: aws.Bool(true),
-	})
+	sess, err := getS3Session(region, S3Options{})
 	if err != nil {
 		return fmt.Errorf("Failed to connect to S3: %v", err)
 	}
@@ -402,52 +1089,218 @@ func DeleteS3Bucket(region, bucket string) (err error) {
 	})
 
 	if err := s3manager.NewBatchDeleteWithClient(svc).Delete(aws.BackgroundContext(), iter); err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to delete objects from bucket %q, %v", bucket, err))
+		return writeError(err, fmt.Sprintf("Unable to delete objects from bucket %q, %v", bucket, err))
 	}
 	_, err = svc.DeleteBucket(&s3.DeleteBucketInput{
 		Bucket: aws.String(bucket),
 	})
 	if err != nil {
-		return errors.WriteError(fmt.Sprintf("Unable to delete bucket %q, %v", bucket, err))
+		return writeError(err, fmt.Sprintf("Unable to delete bucket %q, %v", bucket, err))
 	}
 	return nil
 }
 
-func (s *S3Repository) listRecursive(results chan<- ListResult, dir string, filter func(string) bool) {
-	prefix := filepath.Join(s.root, dir)
+func (s *S3Repository) listRecursive(ctx context.Context, results chan<- ListResult, dir string, filter func(string) bool) {
+	defer close(results)
+	if cached, ok := s.listCache.get(dir); ok {
+		for _, result := range cached {
+			if filter(result.Path) && !sendListResult(ctx, results, result) {
+				return
+			}
+		}
+		return
+	}
+	if err := s.connect(); err != nil {
+		sendListResult(ctx, results, ListResult{Error: err})
+		return
+	}
+	prefix := objectKey(s.root, dir)
 	// prefixes must end with / and must not end with /
 	if !strings.HasSuffix(prefix, "/") {
 		prefix += "/"
 	}
 	prefix = strings.TrimPrefix(prefix, "/")
 
-	err := s.svc.ListObjectsPages(&s3.ListObjectsInput{
-		Bucket:  aws.String(s.bucketName),
-		Prefix:  aws.String(prefix),
-		MaxKeys: aws.Int64(1000),
-	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+	// Everything listed is kept for the cache, before it is filtered
+	listed := time.Now()
+	var mu sync.Mutex
+	all := []ListResult{}
+	send := func(result ListResult) bool {
+		if s.listCache != nil {
+			mu.Lock()
+			all = append(all, result)
+			mu.Unlock()
+		}
+		if filter(result.Path) {
+			return sendListResult(ctx, results, result)
+		}
+		return true
+	}
+
+	// If it doesn't fit in one page, list the rest in shards
+	last, more, err := s.listRange(ctx, prefix, keyRange{}, 1, send)
+	if err == nil && more {
+		err = listShardsAtOnce(ctx, listShards(prefix, last), func(ctx context.Context, r keyRange) error {
+			_, _, err := s.listRange(ctx, prefix, r, 0, send)
+			return err
+		})
+	}
+	// Stopped by the caller, so there's nobody to tell
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		if cerr := s3CredentialsError(err, s.RootURL()); cerr != nil {
+			sendListResult(ctx, results, ListResult{Error: cerr})
+		} else {
+			sendListResult(ctx, results, ListResult{Error: listError(err, fmt.Sprintf("Failed to list objects in s3://%s: %s", s.bucketName, err))})
+		}
+		return
+	}
+	s.listCache.set(dir, listed, all)
+}
+
+// listRange lists the objects in r that start with prefix, a page at a time,
+// calling send with each one until it returns false. If maxPages isn't 0, it
+// stops after that many pages, and returns the last key listed and whether
+// there are more.
+func (s *S3Repository) listRange(ctx context.Context, prefix string, r keyRange, maxPages int, send func(ListResult) bool) (last string, more bool, err error) {
+	input := &s3.ListObjectsInput{
+		Bucket:       aws.String(s.bucketName),
+		Prefix:       aws.String(prefix),
+		EncodingType: aws.String(s3.EncodingTypeUrl),
+		MaxKeys:      aws.Int64(1000),
+	}
+	if r.After != "" {
+		input.Marker = aws.String(r.After)
+	}
+	for pages := 1; ; pages++ {
+		var page *s3.ListObjectsOutput
+		if err := s.pacer.call(ctx, func() (err error) {
+			page, err = s.svc.ListObjectsWithContext(ctx, input)
+			return err
+		}); err != nil {
+			return "", false, err
+		}
 		for _, value := range page.Contents {
-			key := *value.Key
-			if s.root != "" {
-				key = strings.TrimPrefix(strings.TrimPrefix(key, s.root), "/")
+			rawKey, err := s3ListedKey(value.Key)
+			if err != nil {
+				return "", false, err
 			}
-			if filter(key) {
-				// If S3 gives us an empty/bad etag, then make it blank and cause sync instead of throwing error
-				// Also, the etag includes quotes for some reason
-				md5, _ := hex.DecodeString(strings.Replace(*value.ETag, "\"", "", -1))
-				results <- ListResult{Path: key, MD5: md5}
+			if r.beyond(rawKey) {
+				return rawKey, false, nil
 			}
+			// If S3 gives us an empty/bad etag, then make it blank and cause sync instead of throwing error
+			// Also, the etag includes quotes for some reason
+			// The ETag of multipart uploads isn't an MD5, so blank that too.
+			etag := strings.Replace(aws.StringValue(value.ETag), "\"", "", -1)
+			md5, err := hex.DecodeString(etag)
+			if err != nil {
+				md5 = nil
+			}
+			if !send(ListResult{Path: objectPath(s.root, rawKey), MD5: md5, Size: aws.Int64Value(value.Size), ETag: etag}) {
+				return "", false, ctx.Err()
+			}
+		}
+		marker, err := s3NextMarker(page)
+		if err != nil {
+			return "", false, err
+		}
+		if marker == "" {
+			return "", false, nil
+		}
+		if maxPages > 0 && pages >= maxPages {
+			return marker, true, nil
 		}
+		input.Marker = aws.String(marker)
+	}
+}
+
+// s3NextMarker returns the marker to list the page after page, or "" if it
+// is the last page. NextMarker is only returned with a delimiter, so
+// otherwise it's the last key listed.
+func s3NextMarker(page *s3.ListObjectsOutput) (string, error) {
+	if !aws.BoolValue(page.IsTruncated) {
+		return "", nil
+	}
+	if page.NextMarker != nil {
+		return s3ListedKey(page.NextMarker)
+	}
+	if len(page.Contents) == 0 {
+		return "", fmt.Errorf("The listing was truncated without any keys")
+	}
+	return s3ListedKey(page.Contents[len(page.Contents)-1].Key)
+}
+
+// s3Throttled returns whether err means S3 is getting too many requests
+func s3Throttled(err error) bool {
+	if request.IsErrorThrottle(err) {
 		return true
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok {
+		return aerr.Code() == "SlowDown" || aerr.StatusCode() == http.StatusServiceUnavailable || aerr.StatusCode() == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// s3UploadConcurrency is how many parts of each file are uploaded at once
+const s3UploadConcurrency = 8
+
+// newS3Uploader returns an uploader for svc. Anything bigger than a part is
+// uploaded as a multipart upload, with its parts uploaded in parallel. A
+// single PUT can be at most 5GB, so big files would fail otherwise.
+// abortMultipartUpload aborts the multipart upload of key that failed with
+// err, if it got as far as starting one. The uploader aborts uploads that fail
+// by itself, but not ones whose context is done, because it uses that context
+// to abort them.
+func (s *S3Repository) abortMultipartUpload(err error, key string) {
+	failure, ok := err.(s3manager.MultiUploadFailure)
+	if !ok || failure.UploadID() == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+	defer cancel()
+	_, err = s.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(failure.UploadID()),
 	})
 	if err != nil {
-		results <- ListResult{Error: fmt.Errorf("Failed to list objects in s3://%s: %s", s.bucketName, err)}
+		s3Log.Warn("Failed to abort the incomplete upload of s3://%s/%s, so the parts that were uploaded are still stored. Run 'replicate status' to see incomplete uploads. %s", s.bucketName, key, err)
+		return
 	}
-	close(results)
+	s3Log.Debug("Aborted the incomplete upload of s3://%s/%s", s.bucketName, key)
 }
 
-func discoverBucketRegion(bucket string) (string, error) {
-	sess := session.Must(session.NewSession(&aws.Config{}))
+func newS3Uploader(svc *s3.S3) *s3manager.Uploader {
+	return s3manager.NewUploaderWithClient(svc, func(u *s3manager.Uploader) {
+		u.Concurrency = s3UploadConcurrency
+	})
+}
+
+// s3PartSize returns the size of the parts to upload a stream that is about
+// size bytes in. S3 allows at most 10,000 parts in an upload, so parts of the
+// default size only work for streams up to about 50GB.
+func s3PartSize(size int64) int64 {
+	partSize := int64(s3manager.DefaultUploadPartSize)
+	if min := size/s3manager.MaxUploadParts + 1; min > partSize {
+		partSize = min
+	}
+	return partSize
+}
+
+// s3ListedKey returns the key of an object in a listing. Keys are requested
+// URL-encoded, because S3 returns listings as XML, which can't have every
+// character a key can.
+func s3ListedKey(key *string) (string, error) {
+	return url.QueryUnescape(aws.StringValue(key))
+}
+
+func discoverBucketRegion(bucket string, options S3Options) (string, error) {
+	sess, err := getS3Session("", options)
+	if err != nil {
+		return "", err
+	}
 	ctx := context.Background()
 	region, err := s3manager.GetBucketRegion(ctx, sess, bucket, "us-east-1")
 	if err != nil {
@@ -456,22 +1309,146 @@ func discoverBucketRegion(bucket string) (string, error) {
 	return region, nil
 }
 
-func getBucketRegionOrCreateBucket(bucket string) (string, error) {
-	// TODO (bfirsh): cache this
-	region, err := discoverBucketRegion(bucket)
+// getBucketRegionOrCreateBucket returns the bucket's region, creating the
+// bucket if it doesn't exist. It costs a round trip, so connect() only calls it
+// once per repository.
+func getBucketRegionOrCreateBucket(bucket string, options S3Options) (string, error) {
+	if options.Region != "" {
+		if err := checkS3BucketInRegion(bucket, options); err != nil {
+			return "", err
+		}
+		return options.Region, nil
+	}
+	region, err := discoverBucketRegion(bucket, options)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			// The real check for this is `aerr.Code() == s3.ErrCodeNoSuchBucket` but GetBucketRegion doesnt return right error
 			if strings.Contains(aerr.Error(), "NotFound") {
+				if options.Anonymous {
+					return "", errors.DoesNotExist(fmt.Sprintf("The bucket s3://%s doesn't exist", bucket))
+				}
 				// TODO (bfirsh): report to use that this is being created, in a way that is compatible with shared library
 				region = "us-east-1"
-				if err := CreateS3Bucket(region, bucket); err != nil {
-					return "", fmt.Errorf("Error creating bucket: %v", err)
+				if err := createS3BucketWithOptions(region, bucket, options); err != nil {
+					return "", writeError(err, fmt.Sprintf("Error creating bucket: %v", err))
 				}
 				return region, nil
 			}
 		}
-		return "", fmt.Errorf("Failed to discover AWS region for bucket %s: %s", bucket, err)
+		return "", readError(err, fmt.Sprintf("Failed to discover AWS region for bucket %s: %s", bucket, err))
 	}
 	return region, nil
 }
+
+// checkS3BucketInRegion checks the bucket exists in the region in options,
+// creating it if it doesn't. This is used instead of discoverBucketRegion when
+// the region is given, because that asks the global endpoint, which might not
+// be reachable.
+func checkS3BucketInRegion(bucket string, options S3Options) error {
+	if options.Anonymous {
+		// Public buckets often don't allow HeadBucket, so the first read
+		// is what fails if the bucket doesn't exist
+		return nil
+	}
+	sess, err := getS3Session(options.Region, options)
+	if err != nil {
+		return err
+	}
+	_, err = s3.New(sess).HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return nil
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			if err := createS3BucketWithOptions(options.Region, bucket, options); err != nil {
+				return writeError(err, fmt.Sprintf("Error creating bucket: %v", err))
+			}
+			return nil
+		case http.StatusMovedPermanently:
+			return errors.RepositoryConfigurationError(fmt.Sprintf("The bucket s3://%s isn't in %s, the region in the repository URL", bucket, options.Region))
+		}
+	}
+	if cerr := s3CredentialsError(err, "s3://"+bucket); cerr != nil {
+		return cerr
+	}
+	return readError(err, fmt.Sprintf("Failed to access bucket %s in %s: %s", bucket, options.Region, err))
+}
+
+// errCodeInvalidObjectState is returned when reading an object that has to
+// be restored from an archive storage class first
+const errCodeInvalidObjectState = "InvalidObjectState"
+
+// s3ArchiveStatus works out whether an object can be read from its storage
+// class, its Intelligent-Tiering archive status, and its x-amz-restore header
+func s3ArchiveStatus(storageClass, archiveStatus, restore string) *ArchiveStatus {
+	if storageClass == "" {
+		storageClass = s3.StorageClassStandard
+	}
+	status := &ArchiveStatus{
+		StorageClass: storageClass,
+		Restoring:    strings.Contains(restore, `ongoing-request="true"`),
+		RestoreTime:  "3-5 hours",
+	}
+	switch storageClass {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+		// A finished restore leaves a temporary copy that can be read
+		status.Archived = !strings.Contains(restore, `ongoing-request="false"`)
+	case s3.StorageClassIntelligentTiering:
+		// The archive status is cleared when the object is restored
+		status.Archived = archiveStatus != ""
+	}
+	if storageClass == s3.StorageClassDeepArchive || archiveStatus == "DEEP_ARCHIVE_ACCESS" {
+		status.RestoreTime = "up to 12 hours"
+	}
+	return status
+}
+
+func s3ArchivedError(url string) error {
+	return errors.Archived(fmt.Sprintf(`%s is in an archive storage class, so it has to be restored before it can be read.
+
+Run 'replicate checkout' to restore it, or restore it with the AWS CLI.`, url))
+}
+
+// s3LifecycleRules returns the rules to set on a bucket, which are the
+// existing rules with the ones for the prefixes in rules replaced
+func s3LifecycleRules(existing []*s3.LifecycleRule, root string, rules []LifecycleRule) []*s3.LifecycleRule {
+	ids := map[string]bool{}
+	newRules := []*s3.LifecycleRule{}
+	for _, rule := range rules {
+		prefix := pathpkg.Join(root, rule.Prefix) + "/"
+		id := "replicate " + prefix
+		ids[id] = true
+
+		transitions := []*s3.Transition{}
+		if rule.InfrequentAccessAfterDays > 0 {
+			transitions = append(transitions, &s3.Transition{
+				Days:         aws.Int64(int64(rule.InfrequentAccessAfterDays)),
+				StorageClass: aws.String(s3.TransitionStorageClassStandardIa),
+			})
+		}
+		if rule.ArchiveAfterDays > 0 {
+			transitions = append(transitions, &s3.Transition{
+				Days:         aws.Int64(int64(rule.ArchiveAfterDays)),
+				StorageClass: aws.String(s3.TransitionStorageClassGlacier),
+			})
+		}
+		if len(transitions) == 0 {
+			continue
+		}
+		newRules = append(newRules, &s3.LifecycleRule{
+			ID:          aws.String(id),
+			Status:      aws.String(s3.ExpirationStatusEnabled),
+			Filter:      &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+			Transitions: transitions,
+		})
+	}
+
+	result := []*s3.LifecycleRule{}
+	for _, rule := range existing {
+		if !ids[aws.StringValue(rule.ID)] {
+			result = append(result, rule)
+		}
+	}
+	return append(result, newRules...)
+}
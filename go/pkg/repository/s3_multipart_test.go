@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3PutPathMultipart(t *testing.T) {
+	// Parts can't be smaller than 5MB, so the fake limit is the part size
+	fake := newFakeS3(int(s3manager.DefaultUploadPartSize))
+	repository, closeServer := newFakeS3Repository(t, fake, "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	large := make([]byte, 3*s3manager.DefaultUploadPartSize+123)
+	rand.New(rand.NewSource(1)).Read(large)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large.bin"), large, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0644))
+
+	require.NoError(t, repository.PutPath(dir, "checkpoints/abc123"))
+	require.False(t, fake.rejectedUpload)
+	require.Equal(t, 1, fake.puts)
+	require.Equal(t, 1, fake.multipartPuts)
+	require.Equal(t, 4, fake.partsUploaded)
+
+	data, err := repository.Get("checkpoints/abc123/large.bin")
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(large, data))
+	data, err = repository.Get("checkpoints/abc123/small.txt")
+	require.NoError(t, err)
+	require.Equal(t, "small", string(data))
+
+	// Tarballs are streamed, so their size isn't known in advance
+	require.NoError(t, repository.PutPathTar(dir, "checkpoints/abc123.tar.gz", ""))
+	require.False(t, fake.rejectedUpload)
+	require.Equal(t, 2, fake.multipartPuts)
+	data, err = repository.Get("checkpoints/abc123.tar.gz")
+	require.NoError(t, err)
+	require.True(t, len(data) > len(large))
+}
+
+func TestS3PartSize(t *testing.T) {
+	require.Equal(t, int64(s3manager.DefaultUploadPartSize), s3PartSize(0))
+	require.Equal(t, int64(s3manager.DefaultUploadPartSize), s3PartSize(10*1024*1024*1024))
+	// Bigger than 10,000 parts of the default size
+	size := int64(200 * 1024 * 1024 * 1024)
+	partSize := s3PartSize(size)
+	require.True(t, partSize > int64(s3manager.DefaultUploadPartSize))
+	require.True(t, (size+partSize-1)/partSize <= s3manager.MaxUploadParts)
+}
@@ -3,6 +3,7 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -90,17 +91,19 @@ func TestS3ListRecursive(t *testing.T) {
 
 	// Works with empty repository
 	results := make(chan ListResult)
-	go repository.ListRecursive(results, "checkpoints")
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
 	require.Empty(t, <-results)
 
 	// Lists stuff!
 	require.NoError(t, repository.Put("checkpoints/abc123.json", []byte("yep")))
 	require.NoError(t, repository.Put("experiments/def456.json", []byte("nope")))
 	results = make(chan ListResult)
-	go repository.ListRecursive(results, "checkpoints")
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
 	require.Equal(t, ListResult{
 		Path: "checkpoints/abc123.json",
 		MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
+		Size: 3,
+		ETag: "9348ae7851cf3ba798d9564ef308ec25",
 	}, <-results)
 	require.Empty(t, <-results)
 
@@ -110,7 +113,7 @@ func TestS3ListRecursive(t *testing.T) {
 	t.Cleanup(func() { deleteS3Bucket(t, anotherBucketName) })
 	require.NoError(t, err)
 	results = make(chan ListResult)
-	go repository.ListRecursive(results, "checkpoints")
+	go repository.ListRecursive(context.Background(), results, "checkpoints")
 	require.Empty(t, <-results)
 }
 
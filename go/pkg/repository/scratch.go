@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// Tarballs on S3 and GCS are either downloaded to the scratch directory (see
+// files.TempFolder) and then extracted, which is faster for big tarballs
+// because they are downloaded as several ranges at once, or extracted as they
+// are streamed, which doesn't need any space. By default, they are only
+// downloaded if there is room for them, so a small /tmp doesn't fill up.
+
+// Spill is whether tarballs are downloaded to the scratch directory before
+// they are extracted
+type Spill string
+
+const (
+	// SpillAuto downloads tarballs if there is room, and streams them
+	// otherwise
+	SpillAuto Spill = "auto"
+	// SpillAlways downloads tarballs, and fails if there isn't room
+	SpillAlways Spill = "always"
+	// SpillNever streams tarballs
+	SpillNever Spill = "never"
+)
+
+var (
+	spillMu sync.Mutex
+	spill   Spill
+)
+
+// SetSpill sets whether tarballs are downloaded to the scratch directory,
+// usually from replicate.yaml. An empty value is SpillAuto.
+func SetSpill(s Spill) {
+	spillMu.Lock()
+	defer spillMu.Unlock()
+	spill = s
+}
+
+func currentSpill() Spill {
+	spillMu.Lock()
+	defer spillMu.Unlock()
+	if spill == "" {
+		return SpillAuto
+	}
+	return spill
+}
+
+// objectSizer is a repository that can find out how big an object is
+// without reading it
+type objectSizer interface {
+	objectSize(path string) (int64, error)
+}
+
+// openTarball returns a reader for the tarball at tarPath in r, which is
+// either streamed or read from a copy in the scratch directory, depending on
+// SetSpill. The caller must close it.
+func openTarball(r Repository, tarPath string) (io.ReadCloser, error) {
+	sizer, ok := r.(objectSizer)
+	mode := currentSpill()
+	if !ok || mode == SpillNever {
+		return r.GetReader(tarPath)
+	}
+	size, err := sizer.objectSize(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	// Tarballs that fit in one range aren't downloaded any faster
+	if mode == SpillAuto && size <= currentDownloads().ChunkSize {
+		return r.GetReader(tarPath)
+	}
+	if err := files.EnsureFreeSpace(files.TempFolder(), size); err != nil {
+		if mode == SpillAlways || !errors.Is(err, files.ErrNotEnoughSpace) {
+			return nil, err
+		}
+		console.Debug("Streaming %s/%s instead of downloading it, because there is %s", r.RootURL(), tarPath, err)
+		return r.GetReader(tarPath)
+	}
+	return spillTarball(r, tarPath, size)
+}
+
+// spilledTarball is a tarball that has been downloaded to a temporary
+// directory, which is deleted when it is closed
+type spilledTarball struct {
+	*os.File
+	dir string
+}
+
+func (t *spilledTarball) Close() error {
+	err := t.File.Close()
+	os.RemoveAll(t.dir)
+	return err
+}
+
+// spillTarball downloads the tarball at tarPath in r, which is size bytes,
+// to a temporary directory, and returns it
+func spillTarball(r Repository, tarPath string, size int64) (io.ReadCloser, error) {
+	dir, err := files.TempDir("tar")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, filepath.Base(tarPath)))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	tarball := &spilledTarball{File: f, dir: dir}
+
+	ctx, cancel := withOverallTimeout(transferContext())
+	defer cancel()
+	err = downloadRanges(ctx, f, size, func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return r.GetRangeReader(tarPath, offset, length)
+	})
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tarball.Close()
+		if stopped(ctx) {
+			return nil, stoppedError("downloading", r.RootURL()+"/"+tarPath, nil)
+		}
+		// Errors from the repository already say what went wrong
+		if errors.Code(err) != "" {
+			return nil, err
+		}
+		return nil, readError(err, fmt.Sprintf("Failed to download %s/%s to %s: %v", r.RootURL(), tarPath, dir, err))
+	}
+	return tarball, nil
+}
+
+// getPathTar extracts the tarball at tarPath in r to localPath, without its
+// root directory. If itemPath isn't empty, only that file or directory in it
+// is extracted.
+func getPathTar(r Repository, tarPath, itemPath, localPath string) error {
+	reader, err := openTarball(r, tarPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return extractTarReader(reader, r.RootURL()+"/"+tarPath, itemPath, localPath)
+}
+
+// listTarFile returns the paths of the files in the tarball at tarPath in r,
+// relative to its root directory
+func listTarFile(r Repository, tarPath string) ([]string, error) {
+	reader, err := openTarball(r, tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	names := []string{}
+	err = walkTar(reader, r.RootURL()+"/"+tarPath, func(name string, header *tar.Header, tr *tar.Reader) (bool, error) {
+		if name != "" {
+			names = append(names, name)
+		}
+		return false, nil
+	})
+	return names, err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestS3GetPathTarSpill(t *testing.T) {
+	defer SetSpill("")
+	defer SetDownloads(Downloads{})
+	defer files.SetScratch("", 0)
+	repository, closeServer := newFakeS3Repository(t, newFakeS3(0), "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	project := filepath.Join(dir, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(project, "sub"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, "sub", "b.txt"), []byte("b"), 0644))
+	require.NoError(t, repository.PutPathTar(project, "checkpoints/abc.tar.gz", ""))
+
+	// Small chunks, so tarballs are downloaded in SpillAuto
+	SetDownloads(Downloads{ChunkSize: 16})
+	for _, spill := range []Spill{SpillAuto, SpillAlways, SpillNever} {
+		SetSpill(spill)
+		out := filepath.Join(dir, "out-"+string(spill))
+		require.NoError(t, repository.GetPathTar("checkpoints/abc.tar.gz", out))
+		data, err := ioutil.ReadFile(filepath.Join(out, "sub", "b.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "b", string(data))
+
+		names, err := repository.ListTarFile("checkpoints/abc.tar.gz")
+		require.NoError(t, err)
+		require.Contains(t, names, "a.txt")
+		require.Contains(t, names, "sub/b.txt")
+	}
+
+	out := filepath.Join(dir, "out-item")
+	require.NoError(t, repository.GetPathItemTar("checkpoints/abc.tar.gz", "sub", out))
+	exists, err := files.FileExists(filepath.Join(out, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = files.FileExists(filepath.Join(out, "a.txt"))
+	require.NoError(t, err)
+	require.False(t, exists)
+	err = repository.GetPathItemTar("checkpoints/abc.tar.gz", "missing", out)
+	require.True(t, errors.IsDoesNotExist(err))
+	err = repository.GetPathTar("checkpoints/missing.tar.gz", out)
+	require.True(t, errors.IsDoesNotExist(err))
+
+	// Without room in the scratch directory, tarballs are streamed, unless
+	// they must be downloaded
+	files.SetScratch("", 1<<62)
+	SetSpill(SpillAuto)
+	require.NoError(t, repository.GetPathTar("checkpoints/abc.tar.gz", filepath.Join(dir, "out-full")))
+	SetSpill(SpillAlways)
+	err = repository.GetPathTar("checkpoints/abc.tar.gz", filepath.Join(dir, "out-full"))
+	require.True(t, errors.Is(err, files.ErrNotEnoughSpace))
+}
+
+func TestExtractTarReaderOutside(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "abc/../../evil.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	err = extractTarReader(&buf, "s3://bucket/abc.tar.gz", "", out)
+	require.Error(t, err)
+	exists, err := files.FileExists(filepath.Join(dir, "evil.txt"))
+	require.NoError(t, err)
+	require.False(t, exists)
+}
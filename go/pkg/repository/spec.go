@@ -5,13 +5,40 @@ import (
 	"fmt"
 
 	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/hash"
+)
+
+// Version is the newest version of repository this version of Replicate
+// can read. A repository's version is raised when something is first
+// written to it that older versions of Replicate would misread, so they
+// refuse to use it instead.
+const Version = 3
+
+const (
+	// HashVersion is the version of repositories whose files are hashed
+	// with anything other than SHA-256, which older versions would think
+	// are corrupt
+	HashVersion = 2
+	// LargeFilesVersion is the version of repositories with large files
+	// stored as pointer files, which older versions would check out as
+	// they are
+	LargeFilesVersion = 3
+	// EventsVersion is the version of repositories with experiments'
+	// checkpoints and metrics saved as events, which older versions
+	// wouldn't see
+	EventsVersion = 3
+	// EscapedPathsVersion is the version of repositories with paths that
+	// had to be escaped, which older versions wouldn't unescape
+	EscapedPathsVersion = 3
 )
 
-const Version = 1
 const SpecPath = "repository.json"
 
 type Spec struct {
 	Version int `json:"version"`
+	// Hash is the algorithm the contents of chunks and large files are
+	// hashed with. It is SHA-256 if it is empty.
+	Hash string `json:"hash,omitempty"`
 }
 
 // LoadSpec returns the repository spec, or nil if the repository doesn't have a spec file
@@ -21,6 +48,9 @@ func LoadSpec(r Repository) (*Spec, error) {
 		if errors.IsDoesNotExist(err) {
 			return nil, nil
 		}
+		if IsUnreachable(err) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("Failed to read %s/%s: %v", r.RootURL(), SpecPath, err)
 	}
 
@@ -32,9 +62,21 @@ func LoadSpec(r Repository) (*Spec, error) {
 	return spec, nil
 }
 
-func WriteSpec(r Repository) error {
-	spec := Spec{Version: Version}
-	raw, err := json.Marshal(&spec)
+// NewSpec returns the spec of a new repository whose files are hashed with
+// hashAlgorithm. The default algorithm isn't recorded, so the spec is the same
+// as the one older versions of Replicate wrote.
+func NewSpec(hashAlgorithm string) *Spec {
+	spec := &Spec{Version: 1}
+	if hashAlgorithm != "" && hashAlgorithm != hash.DefaultAlgorithm {
+		spec.Version = HashVersion
+		spec.Hash = hashAlgorithm
+	}
+	return spec
+}
+
+// WriteSpec writes the repository spec
+func WriteSpec(r Repository, spec *Spec) error {
+	raw, err := json.Marshal(spec)
 	if err != nil {
 		panic(err) // should never happen
 	}
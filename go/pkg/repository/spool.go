@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// When a repository can't be reached, for example because the network is
+// down, SpoolingRepository writes to a spool directory on local disk instead.
+// It has the same layout as the repository, and PushSpool uploads what is in
+// it later. Objects are uploaded as they were written, so experiments and
+// checkpoints keep the times they were created at.
+//
+// Once a write has gone to the spool, the rest do too, so a checkpoint's
+// metadata is never uploaded before its files are.
+
+// SpoolDir is the directory in the project directory that spools are in
+const SpoolDir = ".replicate/spool"
+
+// OfflineEnvVar is the environment variable that, if it is set, makes writes
+// go straight to the spool without trying the repository
+const OfflineEnvVar = "REPLICATE_OFFLINE"
+
+// unreachableMessages are in the errors from the storage libraries when the
+// network is down. They are turned into strings by the time they get here,
+// so they can only be recognized by their messages.
+var unreachableMessages = []string{
+	"connection refused",
+	"connection reset by peer",
+	"dial tcp",
+	"i/o timeout",
+	"network is unreachable",
+	"no route to host",
+	"no such host",
+	"send request failed",
+	"TLS handshake timeout",
+}
+
+// IsUnreachable returns whether err is because the repository couldn't be
+// reached, as opposed to, say, it not having permission
+func IsUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Code(err) == errors.CodeUnreachable {
+		return true
+	}
+	msg := err.Error()
+	for _, m := range unreachableMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// SpoolDirForRepository returns the spool directory for the repository at
+// rootURL, so repositories that are switched between don't share a spool
+func SpoolDirForRepository(projectDir string, rootURL string) string {
+	sum := sha256.Sum256([]byte(rootURL))
+	return filepath.Join(projectDir, SpoolDir, hex.EncodeToString(sum[:])[:16])
+}
+
+// SpoolingRepository wraps another repository, writing to a spool directory
+// when it can't be reached. Reads of objects that are in the spool are read
+// from it.
+type SpoolingRepository struct {
+	repository Repository
+	spoolDir   string
+	spool      *DiskRepository
+
+	mu      sync.Mutex
+	offline bool
+}
+
+func NewSpoolingRepository(repo Repository, spoolDir string) (*SpoolingRepository, error) {
+	spool, err := NewDiskRepository(spoolDir)
+	if err != nil {
+		return nil, err
+	}
+	return &SpoolingRepository{
+		repository: repo,
+		spoolDir:   spoolDir,
+		spool:      spool,
+		offline:    os.Getenv(OfflineEnvVar) != "",
+	}, nil
+}
+
+// Offline returns whether writes are going to the spool
+func (s *SpoolingRepository) Offline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offline
+}
+
+func (s *SpoolingRepository) goOffline(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offline {
+		return
+	}
+	console.Warn("Failed to reach %s (%s), so saving to %s instead. It will be uploaded the next time you run a replicate command, or run 'replicate push' to upload it.", s.repository.RootURL(), err, s.spoolDir)
+	s.offline = true
+}
+
+// write runs put against the repository, or against the spool if the
+// repository can't be reached
+func (s *SpoolingRepository) write(put func(r Repository) error) error {
+	if !s.Offline() {
+		err := put(s.repository)
+		if !IsUnreachable(err) {
+			return err
+		}
+		s.goOffline(err)
+	}
+	// Pushing the spool removes it once it is empty, so it isn't removed
+	// while this is writing to it
+	lock, err := files.RLockDir(s.spoolDir)
+	if err != nil {
+		return fmt.Errorf("Failed to lock %s: %w", s.spoolDir, err)
+	}
+	defer lock.Unlock()
+	return put(s.spool)
+}
+
+// readRepository returns the spool if p is in it, otherwise the repository.
+// When offline, reads of objects that aren't in the spool fail straight away,
+// rather than after waiting for the network to time out.
+func (s *SpoolingRepository) readRepository(p string) (Repository, error) {
+	if exists, _ := files.FileExists(s.spool.fullPath(p)); exists {
+		return s.spool, nil
+	}
+	if s.Offline() {
+		return nil, errors.Unreachable(fmt.Sprintf("Failed to read %s/%s, because %s can't be reached", s.RootURL(), p, s.RootURL()))
+	}
+	return s.repository, nil
+}
+
+func (s *SpoolingRepository) Get(p string) ([]byte, error) {
+	r, err := s.readRepository(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(p)
+}
+
+func (s *SpoolingRepository) GetReader(p string) (io.ReadCloser, error) {
+	r, err := s.readRepository(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetReader(p)
+}
+
+func (s *SpoolingRepository) GetRangeReader(p string, offset, length int64) (io.ReadCloser, error) {
+	r, err := s.readRepository(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetRangeReader(p, offset, length)
+}
+
+func (s *SpoolingRepository) GetPath(repoPath string, localPath string) error {
+	r, err := s.readRepository(repoPath)
+	if err != nil {
+		return err
+	}
+	return r.GetPath(repoPath, localPath)
+}
+
+func (s *SpoolingRepository) GetPathTar(tarPath, localPath string) error {
+	r, err := s.readRepository(tarPath)
+	if err != nil {
+		return err
+	}
+	return r.GetPathTar(tarPath, localPath)
+}
+
+func (s *SpoolingRepository) GetPathItemTar(tarPath, itemPath, localPath string) error {
+	r, err := s.readRepository(tarPath)
+	if err != nil {
+		return err
+	}
+	return r.GetPathItemTar(tarPath, itemPath, localPath)
+}
+
+func (s *SpoolingRepository) Put(p string, data []byte) error {
+	return s.write(func(r Repository) error {
+		return r.Put(p, data)
+	})
+}
+
+func (s *SpoolingRepository) PutPath(localPath string, repoPath string) error {
+	return s.write(func(r Repository) error {
+		return r.PutPath(localPath, repoPath)
+	})
+}
+
+func (s *SpoolingRepository) PutPathTar(localPath, tarPath, includePath string) error {
+	return s.write(func(r Repository) error {
+		return r.PutPathTar(localPath, tarPath, includePath)
+	})
+}
+
+// List lists p in both the repository and the spool. If the repository can't
+// be reached, only what is in the spool is listed.
+func (s *SpoolingRepository) List(p string) ([]string, error) {
+	spooled, err := s.spool.List(p)
+	if err != nil {
+		return nil, err
+	}
+	if s.Offline() {
+		return spooled, nil
+	}
+	paths, err := s.repository.List(p)
+	if err != nil {
+		if !IsUnreachable(err) {
+			return nil, err
+		}
+		s.goOffline(err)
+		return spooled, nil
+	}
+	seen := map[string]bool{}
+	for _, objectPath := range paths {
+		seen[objectPath] = true
+	}
+	for _, objectPath := range spooled {
+		if !seen[objectPath] {
+			paths = append(paths, objectPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (s *SpoolingRepository) ListTarFile(p string) ([]string, error) {
+	r, err := s.readRepository(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.ListTarFile(p)
+}
+
+func (s *SpoolingRepository) ListRecursive(ctx context.Context, results chan<- ListResult, folder string) {
+	s.repository.ListRecursive(ctx, results, folder)
+}
+
+func (s *SpoolingRepository) MatchFilenamesRecursive(ctx context.Context, results chan<- ListResult, folder string, filename string) {
+	s.repository.MatchFilenamesRecursive(ctx, results, folder, filename)
+}
+
+func (s *SpoolingRepository) Delete(p string) error {
+	if err := s.spool.Delete(p); err != nil {
+		return err
+	}
+	return s.repository.Delete(p)
+}
+
+// Copy copies src within the spool if it is spooled, otherwise within the
+// repository
+func (s *SpoolingRepository) Copy(src, dest string) error {
+	r, err := s.readRepository(src)
+	if err != nil {
+		return err
+	}
+	return r.Copy(src, dest)
+}
+
+// Move moves src within the spool if it is spooled, otherwise within the
+// repository
+func (s *SpoolingRepository) Move(src, dest string) error {
+	r, err := s.readRepository(src)
+	if err != nil {
+		return err
+	}
+	return r.Move(src, dest)
+}
+
+func (s *SpoolingRepository) RootURL() string {
+	return s.repository.RootURL()
+}
+
+// SpooledPaths returns the paths of the objects in the spool
+func (s *SpoolingRepository) SpooledPaths() ([]string, error) {
+	return SpooledPaths(s.spoolDir)
+}
+
+// Push uploads what is in the spool to the repository. See PushSpool.
+func (s *SpoolingRepository) Push() (int, error) {
+	return PushSpool(s.spoolDir, s.repository)
+}
+
+// SpooledPaths returns the paths of the objects in the spool at spoolDir
+func SpooledPaths(spoolDir string) ([]string, error) {
+	paths := []string{}
+	err := filepath.Walk(spoolDir, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Objects that are being written are in temporary files that start
+		// with "."
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		relPath, err := filepath.Rel(spoolDir, currentPath)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, pathFromDisk(filepath.ToSlash(relPath)))
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// PushSpool uploads the objects in the spool at spoolDir to repo, deleting
+// them from the spool as they are uploaded, and returns how many were
+// uploaded. Metadata is uploaded after everything else, so nothing refers to
+// objects that haven't been uploaded yet.
+func PushSpool(spoolDir string, repo Repository) (int, error) {
+	// Only one command pushes the spool at a time, so objects aren't
+	// uploaded twice, or deleted from under another push
+	pushLock, err := files.LockDir(spoolDir + ".push")
+	if err != nil {
+		return 0, fmt.Errorf("Failed to lock %s: %w", spoolDir, err)
+	}
+	defer pushLock.Unlock()
+
+	paths, err := SpooledPaths(spoolDir)
+	if err != nil {
+		return 0, err
+	}
+	objects := []string{}
+	metadata := []string{}
+	for _, objectPath := range paths {
+		if strings.HasPrefix(objectPath, "metadata/") {
+			metadata = append(metadata, objectPath)
+		} else {
+			objects = append(objects, objectPath)
+		}
+	}
+
+	count := 0
+	var countMu sync.Mutex
+	for _, batch := range [][]string{objects, metadata} {
+		queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+		for _, objectPath := range batch {
+			objectPath := objectPath
+			err := queue.Go(func() error {
+				uploaded, err := pushSpooledObject(spoolDir, objectPath, repo)
+				if err != nil {
+					return fmt.Errorf("Failed to upload %s: %w", objectPath, err)
+				}
+				if uploaded {
+					countMu.Lock()
+					count++
+					countMu.Unlock()
+				}
+				return nil
+			})
+			if err != nil {
+				return count, err
+			}
+		}
+		if err := queue.Wait(); err != nil {
+			return count, err
+		}
+	}
+
+	// If anything is writing to the spool, it is left for the next push
+	lock, err := files.TryLockDir(spoolDir)
+	if err != nil {
+		return count, fmt.Errorf("Failed to lock %s: %w", spoolDir, err)
+	}
+	if lock == nil {
+		return count, nil
+	}
+	defer lock.Unlock()
+	if remaining, err := SpooledPaths(spoolDir); err == nil && len(remaining) == 0 {
+		if err := os.RemoveAll(spoolDir); err != nil {
+			console.Debug("Failed to remove %s: %s", spoolDir, err)
+		}
+	}
+	return count, nil
+}
+
+// pushSpooledObject uploads an object in the spool, then deletes it from the
+// spool if it wasn't written to again while it was being uploaded. In that
+// case it is left for the next push, and false is returned.
+func pushSpooledObject(spoolDir string, objectPath string, repo Repository) (bool, error) {
+	localPath := filepath.Join(spoolDir, filepath.FromSlash(diskPath(objectPath)))
+	before, err := os.Stat(localPath)
+	if err != nil {
+		return false, err
+	}
+	// PutPath streams the file, so large checkpoints aren't read into memory
+	if err := repo.PutPath(localPath, path.Clean(objectPath)); err != nil {
+		return false, err
+	}
+	after, err := os.Stat(localPath)
+	if err != nil {
+		return false, err
+	}
+	if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+		return false, nil
+	}
+	return true, os.Remove(localPath)
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+// flakyRepository is a disk repository that can't be reached while down is
+// set, like a bucket when the network is down
+type flakyRepository struct {
+	*DiskRepository
+	down bool
+}
+
+func (r *flakyRepository) err() error {
+	return errors.WriteError(fmt.Sprintf("Unable to upload to %s: RequestError: send request failed caused by: dial tcp: lookup bucket: no such host", r.RootURL()))
+}
+
+func (r *flakyRepository) Get(p string) ([]byte, error) {
+	if r.down {
+		return nil, r.err()
+	}
+	return r.DiskRepository.Get(p)
+}
+
+func (r *flakyRepository) Put(p string, data []byte) error {
+	if r.down {
+		return r.err()
+	}
+	return r.DiskRepository.Put(p, data)
+}
+
+func (r *flakyRepository) PutPath(localPath, repoPath string) error {
+	if r.down {
+		return r.err()
+	}
+	return r.DiskRepository.PutPath(localPath, repoPath)
+}
+
+func (r *flakyRepository) List(p string) ([]string, error) {
+	if r.down {
+		return nil, r.err()
+	}
+	return r.DiskRepository.List(p)
+}
+
+func TestIsUnreachable(t *testing.T) {
+	require.True(t, IsUnreachable(errors.Unreachable("down")))
+	require.True(t, IsUnreachable(fmt.Errorf("Failed to write: %s", "dial tcp 1.2.3.4:443: connect: connection refused")))
+	require.False(t, IsUnreachable(errors.DoesNotExist("not found")))
+	require.False(t, IsUnreachable(errors.RepositoryCredentialsError("forbidden")))
+	require.False(t, IsUnreachable(nil))
+}
+
+func TestSpoolingRepository(t *testing.T) {
+	dir, err := files.TempDir("test-spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	disk, err := NewDiskRepository(filepath.Join(dir, "repository"))
+	require.NoError(t, err)
+	remote := &flakyRepository{DiskRepository: disk}
+	spoolDir := SpoolDirForRepository(dir, remote.RootURL())
+	repo, err := NewSpoolingRepository(remote, spoolDir)
+	require.NoError(t, err)
+
+	// Writes go to the repository while it can be reached
+	require.NoError(t, repo.Put("metadata/experiments/1eeeeeeeee.json", []byte("one")))
+	require.False(t, repo.Offline())
+
+	// Then to the spool when it can't
+	remote.down = true
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	require.NoError(t, os.MkdirAll(checkpointDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(checkpointDir, "weights"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPath(checkpointDir, "checkpoints/1ccccccccc"))
+	require.True(t, repo.Offline())
+	require.NoError(t, repo.Put("metadata/experiments/1eeeeeeeee.json", []byte("two")))
+
+	// Spooled objects can be read, and other reads fail straight away
+	data, err := repo.Get("metadata/experiments/1eeeeeeeee.json")
+	require.NoError(t, err)
+	require.Equal(t, "two", string(data))
+	_, err = repo.Get("metadata/experiments/2eeeeeeeee.json")
+	require.True(t, IsUnreachable(err))
+	paths, err := repo.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/1eeeeeeeee.json"}, paths)
+
+	paths, err = repo.SpooledPaths()
+	require.NoError(t, err)
+	require.Equal(t, []string{"checkpoints/1ccccccccc/weights", "metadata/experiments/1eeeeeeeee.json"}, paths)
+
+	// Pushing fails while it's still down, and the spool is kept
+	_, err = repo.Push()
+	require.True(t, IsUnreachable(err))
+	paths, err = repo.SpooledPaths()
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+
+	remote.down = false
+	count, err := repo.Push()
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	data, err = remote.Get("metadata/experiments/1eeeeeeeee.json")
+	require.NoError(t, err)
+	require.Equal(t, "two", string(data))
+	data, err = remote.Get("checkpoints/1ccccccccc/weights")
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(data))
+	exists, err := files.FileExists(spoolDir)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Lists merge the repository and the spool
+	other, err := NewSpoolingRepository(remote, spoolDir)
+	require.NoError(t, err)
+	require.NoError(t, other.spool.Put("metadata/experiments/2eeeeeeeee.json", []byte("three")))
+	paths, err = other.List("metadata/experiments")
+	require.NoError(t, err)
+	require.Equal(t, []string{"metadata/experiments/1eeeeeeeee.json", "metadata/experiments/2eeeeeeeee.json"}, paths)
+}
+
+func TestSpoolingRepositoryOfflineEnvVar(t *testing.T) {
+	dir, err := files.TempDir("test-spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	remote, err := NewDiskRepository(filepath.Join(dir, "repository"))
+	require.NoError(t, err)
+
+	os.Setenv(OfflineEnvVar, "1")
+	defer os.Unsetenv(OfflineEnvVar)
+	repo, err := NewSpoolingRepository(remote, SpoolDirForRepository(dir, remote.RootURL()))
+	require.NoError(t, err)
+	require.True(t, repo.Offline())
+
+	require.NoError(t, repo.Put("metadata/experiments/1eeeeeeeee.json", []byte("one")))
+	_, err = remote.Get("metadata/experiments/1eeeeeeeee.json")
+	require.True(t, errors.IsDoesNotExist(err))
+
+	// Pushing explicitly uploads it anyway
+	count, err := repo.Push()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	_, err = remote.Get("metadata/experiments/1eeeeeeeee.json")
+	require.NoError(t, err)
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Credentials from `aws sso login`. The version of the AWS SDK we use can't
+// read SSO profiles, so this does what the AWS CLI does: it reads the token
+// that `aws sso login` caches, and exchanges it for credentials for the
+// profile's account and role. The credentials are fetched again when they
+// expire, for as long as the token is valid.
+
+// errCodeSSOTokenExpired is the code of the error returned when the user
+// needs to run `aws sso login`
+const errCodeSSOTokenExpired = "SSOTokenExpired"
+
+// ssoPortalURL is where tokens are exchanged for credentials. It is a
+// variable so tests can replace it.
+var ssoPortalURL = "https://portal.sso.%s.amazonaws.com"
+
+type ssoProfile struct {
+	name        string
+	sessionName string
+	startURL    string
+	region      string
+	accountID   string
+	roleName    string
+}
+
+// loadSSOProfile returns the AWS profile in use if it is an SSO profile, or
+// nil if it isn't
+func loadSSOProfile() (*ssoProfile, error) {
+	name := os.Getenv("AWS_PROFILE")
+	if name == "" {
+		name = "default"
+	}
+	configPath := os.Getenv("AWS_CONFIG_FILE")
+	if configPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		configPath = filepath.Join(home, ".aws", "config")
+	}
+	f, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sections, err := parseAWSConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", configPath, err)
+	}
+
+	section := sections["profile "+name]
+	if name == "default" && section == nil {
+		section = sections["default"]
+	}
+	if section == nil || section["sso_account_id"] == "" {
+		return nil, nil
+	}
+	profile := &ssoProfile{
+		name:        name,
+		sessionName: section["sso_session"],
+		startURL:    section["sso_start_url"],
+		region:      section["sso_region"],
+		accountID:   section["sso_account_id"],
+		roleName:    section["sso_role_name"],
+	}
+	// Newer versions of the AWS CLI put the start URL and region in a
+	// separate section so several profiles can share a login
+	if profile.sessionName != "" {
+		session := sections["sso-session "+profile.sessionName]
+		if session == nil {
+			return nil, fmt.Errorf("The AWS profile %q uses the SSO session %q, which isn't defined in %s", name, profile.sessionName, configPath)
+		}
+		profile.startURL = session["sso_start_url"]
+		profile.region = session["sso_region"]
+	}
+	if profile.startURL == "" || profile.region == "" || profile.roleName == "" {
+		return nil, fmt.Errorf("The AWS profile %q in %s must have sso_start_url, sso_region, and sso_role_name to use AWS SSO", name, configPath)
+	}
+	return profile, nil
+}
+
+// parseAWSConfig parses the INI format of ~/.aws/config into a map of section
+// name to keys and values
+func parseAWSConfig(f *os.File) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			section = map[string]string{}
+			sections[name] = section
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || section == nil {
+			// Nested values (e.g. for s3) are indented key = value lines,
+			// which end up here without harm
+			continue
+		}
+		section[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return sections, scanner.Err()
+}
+
+// ssoProvider is a credentials.Provider for SSO profiles
+type ssoProvider struct {
+	credentials.Expiry
+	profile *ssoProfile
+}
+
+func (p *ssoProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.cachedToken()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	u := fmt.Sprintf(ssoPortalURL, p.profile.region) + "/federation/credentials?" + url.Values{
+		"account_id": {p.profile.accountID},
+		"role_name":  {p.profile.roleName},
+	}.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	req.Header.Set("x-amz-sso_bearer_token", token)
+	client, err := getHTTPClient()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return credentials.Value{}, awserr.New("SSOProviderError", "Failed to get credentials from AWS SSO", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return credentials.Value{}, awserr.New("SSOProviderError", "Failed to get credentials from AWS SSO", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		// The token has been revoked, or the user has lost access to the role
+		return credentials.Value{}, awserr.New(errCodeSSOTokenExpired, fmt.Sprintf("AWS SSO rejected the login for profile %q: %s", p.profile.name, strings.TrimSpace(string(body))), nil)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{}, awserr.New("SSOProviderError", fmt.Sprintf("Failed to get credentials from AWS SSO: %s: %s", resp.Status, strings.TrimSpace(string(body))), nil)
+	}
+
+	var result struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			// Milliseconds since the epoch
+			Expiration int64 `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return credentials.Value{}, awserr.New("SSOProviderError", "Failed to parse credentials from AWS SSO", err)
+	}
+	creds := result.RoleCredentials
+	p.SetExpiration(time.Unix(0, creds.Expiration*int64(time.Millisecond)), time.Minute)
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		ProviderName:    "SSOProvider",
+	}, nil
+}
+
+// cachedToken reads the token `aws sso login` saved. It is read each time
+// credentials are needed, so logging in again takes effect straight away.
+func (p *ssoProvider) cachedToken() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	// The cache is keyed by the session name, or the start URL for
+	// profiles without one
+	key := p.profile.startURL
+	if p.profile.sessionName != "" {
+		key = p.profile.sessionName
+	}
+	sum := sha1.Sum([]byte(key))
+	cachePath := filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json")
+
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", awserr.New(errCodeSSOTokenExpired, fmt.Sprintf("You aren't logged in to AWS SSO for profile %q", p.profile.name), nil)
+		}
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresAt   string `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("Failed to parse %s: %w", cachePath, err)
+	}
+	// Older versions of the AWS CLI write e.g. 2021-01-19T23:20:26UTC
+	expiresAt, err := time.Parse(time.RFC3339, strings.Replace(token.ExpiresAt, "UTC", "Z", 1))
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse expiry time in %s: %w", cachePath, err)
+	}
+	if time.Now().After(expiresAt) {
+		return "", awserr.New(errCodeSSOTokenExpired, fmt.Sprintf("The AWS SSO login for profile %q expired at %s", p.profile.name, expiresAt.Local().Format(time.RFC1123)), nil)
+	}
+	return token.AccessToken, nil
+}
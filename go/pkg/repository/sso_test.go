@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/files"
+)
+
+func TestSSOProvider(t *testing.T) {
+	home, err := files.TempDir("sso-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(home)
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+	os.Setenv("AWS_PROFILE", "hotdog")
+	defer os.Unsetenv("AWS_PROFILE")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".aws", "sso", "cache"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ".aws", "config"), []byte(`
+[default]
+region = us-east-1
+
+[profile hotdog]
+sso_session = hooli
+sso_account_id = 123456789012
+sso_role_name = Replicate
+region = us-west-2
+
+[sso-session hooli]
+sso_start_url = https://hooli.awsapps.com/start
+sso_region = us-east-1
+`), 0644))
+
+	// Not a SSO profile
+	os.Setenv("AWS_PROFILE", "default")
+	profile, err := loadSSOProfile()
+	require.NoError(t, err)
+	require.Nil(t, profile)
+	os.Setenv("AWS_PROFILE", "hotdog")
+
+	profile, err = loadSSOProfile()
+	require.NoError(t, err)
+	require.Equal(t, &ssoProfile{
+		name:        "hotdog",
+		sessionName: "hooli",
+		startURL:    "https://hooli.awsapps.com/start",
+		region:      "us-east-1",
+		accountID:   "123456789012",
+		roleName:    "Replicate",
+	}, profile)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/us-east-1/federation/credentials", r.URL.Path)
+		require.Equal(t, "123456789012", r.URL.Query().Get("account_id"))
+		require.Equal(t, "Replicate", r.URL.Query().Get("role_name"))
+		if r.Header.Get("x-amz-sso_bearer_token") != "sso-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"roleCredentials": {"accessKeyId": "AKIA", "secretAccessKey": "secret", "sessionToken": "session", "expiration": 1893456000000}}`))
+	}))
+	defer server.Close()
+	oldPortalURL := ssoPortalURL
+	ssoPortalURL = server.URL + "/%s"
+	defer func() { ssoPortalURL = oldPortalURL }()
+
+	provider := &ssoProvider{profile: profile}
+
+	// Not logged in
+	_, err = provider.Retrieve()
+	require.Equal(t, errCodeSSOTokenExpired, awsErrorCode(err))
+	cerr := s3CredentialsError(err, "s3://my-bucket")
+	require.Equal(t, errors.CodeRepositoryCredentialsError, errors.Code(cerr))
+	require.Contains(t, cerr.Error(), "aws sso login --profile hotdog")
+
+	// SHA1 of the session name
+	cachePath := filepath.Join(home, ".aws", "sso", "cache", "fa2701449c3f1806101a4b981a2701cc1f3834f6.json")
+	writeToken := func(token string, expiresAt time.Time) {
+		require.NoError(t, ioutil.WriteFile(cachePath, []byte(`{"accessToken": "`+token+`", "expiresAt": "`+expiresAt.UTC().Format(time.RFC3339)+`"}`), 0644))
+	}
+
+	writeToken("sso-token", time.Now().Add(-time.Hour))
+	_, err = provider.Retrieve()
+	require.Equal(t, errCodeSSOTokenExpired, awsErrorCode(err))
+
+	writeToken("revoked-token", time.Now().Add(time.Hour))
+	_, err = provider.Retrieve()
+	require.Equal(t, errCodeSSOTokenExpired, awsErrorCode(err))
+
+	writeToken("sso-token", time.Now().Add(time.Hour))
+	value, err := provider.Retrieve()
+	require.NoError(t, err)
+	require.Equal(t, "AKIA", value.AccessKeyID)
+	require.Equal(t, "secret", value.SecretAccessKey)
+	require.Equal(t, "session", value.SessionToken)
+	require.False(t, provider.IsExpired())
+}
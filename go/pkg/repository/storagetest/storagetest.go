@@ -0,0 +1,395 @@
+// Package storagetest is a conformance test suite for implementations of
+// repository.Repository, so every backend behaves the same way.
+//
+// A backend's tests call TestConformance with a function that makes an empty
+// repository:
+//
+//	func TestDiskConformance(t *testing.T) {
+//		storagetest.TestConformance(t, func(t *testing.T) (repository.Repository, func()) {
+//			dir, err := ioutil.TempDir("", "replicate-test")
+//			require.NoError(t, err)
+//			r, err := repository.NewDiskRepository(dir)
+//			require.NoError(t, err)
+//			return r, func() { os.RemoveAll(dir) }
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+// Factory makes an empty repository for a test, and returns it along with a
+// function that cleans it up
+type Factory func(t *testing.T) (repository.Repository, func())
+
+// TestConformance checks that the repositories made by newRepository behave
+// as documented on repository.Repository. Each check is a subtest with a
+// repository of its own.
+func TestConformance(t *testing.T, newRepository Factory) {
+	for _, test := range []struct {
+		name string
+		test func(t *testing.T, r repository.Repository)
+	}{
+		{"GetPut", testGetPut},
+		{"EmptyFiles", testEmptyFiles},
+		{"GetRangeReader", testGetRangeReader},
+		{"Delete", testDelete},
+		{"CopyMove", testCopyMove},
+		{"List", testList},
+		{"ListRecursive", testListRecursive},
+		{"MatchFilenamesRecursive", testMatchFilenamesRecursive},
+		{"DeepNesting", testDeepNesting},
+		{"UnicodeKeys", testUnicodeKeys},
+		{"SpecialCharacters", testSpecialCharacters},
+		{"PutPathGetPath", testPutPathGetPath},
+		{"PutPathTar", testPutPathTar},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			r, cleanup := newRepository(t)
+			defer cleanup()
+			test.test(t, r)
+		})
+	}
+}
+
+func testGetPut(t *testing.T, r repository.Repository) {
+	_, err := r.Get("does-not-exist")
+	require.True(t, errors.IsDoesNotExist(err), "Get of missing file: %v", err)
+	_, err = r.GetReader("does-not-exist")
+	require.True(t, errors.IsDoesNotExist(err), "GetReader of missing file: %v", err)
+
+	require.NoError(t, r.Put("some/file.txt", []byte("hello")))
+	requireContent(t, r, "some/file.txt", "hello")
+
+	// Put overwrites
+	require.NoError(t, r.Put("some/file.txt", []byte("hello again")))
+	reader, err := r.GetReader("some/file.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello again", string(data))
+}
+
+func testEmptyFiles(t *testing.T, r repository.Repository) {
+	require.NoError(t, r.Put("dir/empty", []byte{}))
+	requireContent(t, r, "dir/empty", "")
+
+	paths, err := r.List("dir")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dir/empty"}, paths)
+
+	results := listRecursive(t, r, "dir")
+	require.Len(t, results, 1)
+	require.Equal(t, "dir/empty", results[0].Path)
+	require.Equal(t, int64(0), results[0].Size)
+	// MD5 of nothing
+	require.Equal(t, []byte{0xd4, 0x1d, 0x8c, 0xd9, 0x8f, 0x00, 0xb2, 0x04, 0xe9, 0x80, 0x09, 0x98, 0xec, 0xf8, 0x42, 0x7e}, results[0].MD5)
+}
+
+func testGetRangeReader(t *testing.T, r repository.Repository) {
+	require.NoError(t, r.Put("file.txt", []byte("hello world")))
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 5, "hello"},
+		{6, 5, "world"},
+		{10, 1, "d"},
+	} {
+		reader, err := r.GetRangeReader("file.txt", tc.offset, tc.length)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(data))
+	}
+
+	_, err := r.GetRangeReader("does-not-exist", 0, 5)
+	require.True(t, errors.IsDoesNotExist(err), "GetRangeReader of missing file: %v", err)
+}
+
+func testDelete(t *testing.T, r repository.Repository) {
+	require.NoError(t, r.Put("dir/a.txt", []byte("a")))
+	require.NoError(t, r.Put("dir/sub/b.txt", []byte("b")))
+	require.NoError(t, r.Put("other.txt", []byte("other")))
+
+	// Single files
+	require.NoError(t, r.Delete("other.txt"))
+	requireDoesNotExist(t, r, "other.txt")
+
+	// Directories are deleted recursively
+	require.NoError(t, r.Delete("dir"))
+	requireDoesNotExist(t, r, "dir/a.txt")
+	requireDoesNotExist(t, r, "dir/sub/b.txt")
+	require.Empty(t, listRecursive(t, r, "dir"))
+
+	// Deleting something that doesn't exist isn't an error
+	require.NoError(t, r.Delete("does-not-exist"))
+}
+
+func testCopyMove(t *testing.T, r repository.Repository) {
+	require.True(t, errors.IsDoesNotExist(r.Copy("does-not-exist", "dest")), "Copy of missing file")
+	require.True(t, errors.IsDoesNotExist(r.Move("does-not-exist", "dest")), "Move of missing file")
+
+	require.NoError(t, r.Put("a/file.tar.gz", []byte("hello")))
+	require.NoError(t, r.Put("a/file.tar.gz.index.json", []byte("index")))
+
+	require.NoError(t, r.Copy("a/file.tar.gz", "b/file.tar.gz"))
+	requireContent(t, r, "a/file.tar.gz", "hello")
+	requireContent(t, r, "b/file.tar.gz", "hello")
+
+	require.NoError(t, r.Move("a/file.tar.gz", "c/file.tar.gz"))
+	requireDoesNotExist(t, r, "a/file.tar.gz")
+	requireContent(t, r, "c/file.tar.gz", "hello")
+	// Only the object itself is moved, not others that start with its name
+	requireContent(t, r, "a/file.tar.gz.index.json", "index")
+
+	paths, err := r.List("c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c/file.tar.gz"}, paths)
+}
+
+func testList(t *testing.T, r repository.Repository) {
+	paths, err := r.List("metadata")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	require.NoError(t, r.Put("metadata/a.json", []byte("a")))
+	require.NoError(t, r.Put("metadata/b.json", []byte("b")))
+	require.NoError(t, r.Put("metadata/sub/c.json", []byte("c")))
+	require.NoError(t, r.Put("metadata-other/d.json", []byte("d")))
+
+	// Directories and files in them aren't listed
+	paths, err = r.List("metadata")
+	require.NoError(t, err)
+	sort.Strings(paths)
+	require.Equal(t, []string{"metadata/a.json", "metadata/b.json"}, paths)
+
+	// A trailing slash makes no difference
+	paths, err = r.List("metadata/")
+	require.NoError(t, err)
+	sort.Strings(paths)
+	require.Equal(t, []string{"metadata/a.json", "metadata/b.json"}, paths)
+}
+
+func testListRecursive(t *testing.T, r repository.Repository) {
+	require.Empty(t, listRecursive(t, r, "checkpoints"))
+
+	require.NoError(t, r.Put("checkpoints/abc123.json", []byte("yep")))
+	require.NoError(t, r.Put("checkpoints/def456/data.txt", []byte("hello")))
+	require.NoError(t, r.Put("experiments/def456.json", []byte("nope")))
+	require.Equal(t, []repository.ListResult{{
+		Path: "checkpoints/abc123.json",
+		MD5:  []byte{0x93, 0x48, 0xae, 0x78, 0x51, 0xcf, 0x3b, 0xa7, 0x98, 0xd9, 0x56, 0x4e, 0xf3, 0x8, 0xec, 0x25},
+		Size: 3,
+	}, {
+		Path: "checkpoints/def456/data.txt",
+		MD5:  []byte{0x5d, 0x41, 0x40, 0x2a, 0xbc, 0x4b, 0x2a, 0x76, 0xb9, 0x71, 0x9d, 0x91, 0x10, 0x17, 0xc5, 0x92},
+		Size: 5,
+	}}, listRecursive(t, r, "checkpoints"))
+}
+
+func testMatchFilenamesRecursive(t *testing.T, r repository.Repository) {
+	match := func() []string {
+		results := make(chan repository.ListResult)
+		go r.MatchFilenamesRecursive(context.Background(), results, "checkpoints", "replicate-metadata.json")
+		return collectPaths(t, results)
+	}
+	require.Empty(t, match())
+
+	require.NoError(t, r.Put("checkpoints/abc123/replicate-metadata.json", []byte("{}")))
+	require.NoError(t, r.Put("checkpoints/abc123/other.json", []byte("{}")))
+	require.NoError(t, r.Put("checkpoints/def456/sub/replicate-metadata.json", []byte("{}")))
+	require.NoError(t, r.Put("experiments/replicate-metadata.json", []byte("{}")))
+	require.Equal(t, []string{"checkpoints/abc123/replicate-metadata.json", "checkpoints/def456/sub/replicate-metadata.json"}, match())
+}
+
+func testDeepNesting(t *testing.T, r repository.Repository) {
+	parts := []string{"deep"}
+	for i := 0; i < 20; i++ {
+		parts = append(parts, string(rune('a'+i)))
+	}
+	dir := path.Join(parts...)
+	require.NoError(t, r.Put(dir+"/file.txt", []byte("deep")))
+	require.NoError(t, r.Put("deep/shallow.txt", []byte("shallow")))
+	requireContent(t, r, dir+"/file.txt", "deep")
+
+	// Only the files at each level are listed
+	paths, err := r.List(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{dir + "/file.txt"}, paths)
+	paths, err = r.List("deep")
+	require.NoError(t, err)
+	require.Equal(t, []string{"deep/shallow.txt"}, paths)
+	paths, err = r.List("deep/a/b")
+	require.NoError(t, err)
+	require.Empty(t, paths)
+
+	paths = []string{}
+	for _, result := range listRecursive(t, r, "deep") {
+		paths = append(paths, result.Path)
+	}
+	require.Equal(t, []string{dir + "/file.txt", "deep/shallow.txt"}, paths)
+
+	require.NoError(t, r.Delete("deep/a"))
+	requireDoesNotExist(t, r, dir+"/file.txt")
+	requireContent(t, r, "deep/shallow.txt", "shallow")
+}
+
+func testUnicodeKeys(t *testing.T, r repository.Repository) {
+	testNames(t, r, []string{"日本語.txt", "ünïcödé.txt", "emoji-😀.txt", "Ελληνικά.txt", "עברית.txt"})
+
+	// In directory names too
+	require.NoError(t, r.Put("données/模型/weights.bin", []byte("weights")))
+	requireContent(t, r, "données/模型/weights.bin", "weights")
+	paths, err := r.List("données/模型")
+	require.NoError(t, err)
+	require.Equal(t, []string{"données/模型/weights.bin"}, paths)
+}
+
+func testSpecialCharacters(t *testing.T, r repository.Repository) {
+	testNames(t, r, []string{"with space.txt", "100%.txt", "%41.txt", "question?.txt", "hash#.txt", "plus+.txt", "amp&.txt", "quote'.txt", "equals=.txt"})
+}
+
+// testNames checks that files named names can be put in a directory, and are
+// read and listed with the same names
+func testNames(t *testing.T, r repository.Repository, names []string) {
+	expected := []string{}
+	for _, name := range names {
+		require.NoError(t, r.Put("dir/"+name, []byte(name)))
+		expected = append(expected, "dir/"+name)
+	}
+	sort.Strings(expected)
+	for _, name := range names {
+		requireContent(t, r, "dir/"+name, name)
+	}
+
+	paths, err := r.List("dir")
+	require.NoError(t, err)
+	sort.Strings(paths)
+	require.Equal(t, expected, paths)
+
+	paths = []string{}
+	for _, result := range listRecursive(t, r, "dir") {
+		paths = append(paths, result.Path)
+	}
+	require.Equal(t, expected, paths)
+
+	require.NoError(t, r.Delete("dir/"+names[0]))
+	requireDoesNotExist(t, r, "dir/"+names[0])
+}
+
+func testPutPathGetPath(t *testing.T, r repository.Repository) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "somedir", "foo.txt"), "foo")
+	writeFile(t, filepath.Join(dir, "somedir", "sub", "bar.txt"), "bar")
+	writeFile(t, filepath.Join(dir, "somedir", "empty"), "")
+
+	// Whole directory
+	require.NoError(t, r.PutPath(filepath.Join(dir, "somedir"), "anotherdir"))
+	requireContent(t, r, "anotherdir/sub/bar.txt", "bar")
+	requireContent(t, r, "anotherdir/empty", "")
+
+	// Single file
+	require.NoError(t, r.PutPath(filepath.Join(dir, "somedir", "foo.txt"), "singlefile/foo.txt"))
+	requireContent(t, r, "singlefile/foo.txt", "foo")
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, r.GetPath("anotherdir", out))
+	requireFile(t, filepath.Join(out, "foo.txt"), "foo")
+	requireFile(t, filepath.Join(out, "sub", "bar.txt"), "bar")
+	requireFile(t, filepath.Join(out, "empty"), "")
+}
+
+func testPutPathTar(t *testing.T, r repository.Repository) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "files", "a.txt"), "file a")
+	writeFile(t, filepath.Join(dir, "files", "c", "d.txt"), "file d")
+
+	err := r.GetPathTar("checkpoints/does-not-exist.tar.gz", filepath.Join(dir, "out"))
+	require.True(t, errors.IsDoesNotExist(err), "GetPathTar of missing tarball: %v", err)
+
+	require.NoError(t, r.PutPathTar(filepath.Join(dir, "files"), "checkpoints/abc123.tar.gz", ""))
+
+	paths, err := r.ListTarFile("checkpoints/abc123.tar.gz")
+	require.NoError(t, err)
+	sort.Strings(paths)
+	require.Equal(t, []string{"a.txt", "c/d.txt"}, paths)
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, r.GetPathTar("checkpoints/abc123.tar.gz", out))
+	requireFile(t, filepath.Join(out, "a.txt"), "file a")
+	requireFile(t, filepath.Join(out, "c", "d.txt"), "file d")
+
+	item := filepath.Join(dir, "item")
+	require.NoError(t, r.GetPathItemTar("checkpoints/abc123.tar.gz", "c", item))
+	requireFile(t, filepath.Join(item, "c", "d.txt"), "file d")
+	err = r.GetPathItemTar("checkpoints/abc123.tar.gz", "does-not-exist.txt", item)
+	require.True(t, errors.IsDoesNotExist(err), "GetPathItemTar of missing item: %v", err)
+}
+
+func listRecursive(t *testing.T, r repository.Repository, folder string) []repository.ListResult {
+	results := make(chan repository.ListResult)
+	go r.ListRecursive(context.Background(), results, folder)
+	ret := []repository.ListResult{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		ret = append(ret, result)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
+
+func collectPaths(t *testing.T, results <-chan repository.ListResult) []string {
+	paths := []string{}
+	for result := range results {
+		require.NoError(t, result.Error)
+		paths = append(paths, result.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func requireContent(t *testing.T, r repository.Repository, p string, expected string) {
+	data, err := r.Get(p)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(data))
+}
+
+func requireDoesNotExist(t *testing.T, r repository.Repository, p string) {
+	_, err := r.Get(p)
+	require.True(t, errors.IsDoesNotExist(err), "%s should not exist, but Get returned %v", p, err)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "replicate-storagetest")
+	require.NoError(t, err)
+	return dir
+}
+
+func writeFile(t *testing.T, p string, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+}
+
+func requireFile(t *testing.T, p string, expected string) {
+	data, err := ioutil.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(data))
+}
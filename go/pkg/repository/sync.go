@@ -3,88 +3,192 @@ package repository
 import (
 	"bytes"
 	"context"
+	"io"
+	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/files"
 )
 
-// Sync destRepository/destPath to match sourceRepository/sourcePath
-//
-// - If file exists in source, but not in dest, it will copy from source to dest
-// - If file exists in both but different content, it will copy from source to dest
-// - If file exists in dest but not in source, it will delete in dest
-func Sync(sourceRepository Repository, sourcePath string, destRepository Repository, destPath string) error {
-	// A queue to use for the various storage operations we have to run
-	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+var syncLog = console.Component("sync")
+
+// SyncPlan is the set of changes that makes a path in one repository match a
+// path in another
+type SyncPlan struct {
+	sourceRepository Repository
+	sourcePath       string
+	destRepository   Repository
+	destPath         string
+
+	// Copy are the files in source that don't exist in dest or have
+	// different content, with paths relative to sourcePath
+	Copy []ListResult
+	// Delete are the files in dest that don't exist in source, relative to
+	// destPath
+	Delete []string
+}
+
+// PlanSync works out what needs to be done to make destRepository/destPath
+// match sourceRepository/sourcePath, without changing anything
+func PlanSync(sourceRepository Repository, sourcePath string, destRepository Repository, destPath string) (*SyncPlan, error) {
+	plan := &SyncPlan{
+		sourceRepository: sourceRepository,
+		sourcePath:       sourcePath,
+		destRepository:   destRepository,
+		destPath:         destPath,
+		Copy:             []ListResult{},
+		Delete:           []string{},
+	}
+	// Stops listing if this returns early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// 1: Fetch destFiles synchronously off disk
 	// TODO: This could be optimized by doing this while source list request is in flight
 	results := make(chan ListResult)
-	// path -> MD5 hash map used to efficiently check if files should be synced
-	destFiles := make(map[string][]byte)
+	// path map used to efficiently check if files should be synced
+	destFiles := make(map[string]ListResult)
 
-	go destRepository.ListRecursive(results, destPath)
+	go destRepository.ListRecursive(ctx, results, destPath)
 	for result := range results {
 		if result.Error != nil {
-			return result.Error
+			return nil, result.Error
 		}
-		destFiles[strings.TrimPrefix(result.Path, destPath)] = result.MD5
+		destFiles[strings.TrimPrefix(result.Path, destPath)] = result
 	}
 
-	// 2: Copy files from dest to source which don't exist or have changed
+	// 2: Find files in source which don't exist in dest or have changed
 	sourceFiles := make(chan ListResult)
 	// path map used for step (3)
 	sourceFileMap := make(map[string]struct{})
-	go sourceRepository.ListRecursive(sourceFiles, sourcePath)
+	go sourceRepository.ListRecursive(ctx, sourceFiles, sourcePath)
 	for sourceFile := range sourceFiles {
 		if sourceFile.Error != nil {
-			return sourceFile.Error
+			return nil, sourceFile.Error
 		}
 		relativePath := strings.TrimPrefix(sourceFile.Path, sourcePath)
 		sourceFileMap[relativePath] = struct{}{}
 
-		needsCopying := false
-		if destMD5, found := destFiles[relativePath]; found {
-			if !bytes.Equal(sourceFile.MD5, destMD5) {
-				needsCopying = true
-			}
-		} else {
-			needsCopying = true
-		}
-
-		if needsCopying {
-			// Variables used in closure
-			sourcePath := sourcePath
-			destPath := destPath
-			relativePath := relativePath
-			err := queue.Go(func() error {
-				data, err := sourceRepository.Get(path.Join(sourcePath, relativePath))
-				if err != nil {
-					return err
-				}
-				return destRepository.Put(path.Join(destPath, relativePath), data)
-			})
-			if err != nil {
-				return err
-			}
+		destFile, found := destFiles[relativePath]
+		if !found || !sameContent(sourceFile, destFile) {
+			sourceFile.Path = relativePath
+			plan.Copy = append(plan.Copy, sourceFile)
 		}
 	}
 
-	// 3: Delete files from dest that don't exist in source
+	// 3: Find files in dest that don't exist in source
 	for relativePath := range destFiles {
 		if _, found := sourceFileMap[relativePath]; !found {
-			// Variables used in closure
-			destPath := destPath
-			relativePath := relativePath
-			err := queue.Go(func() error {
-				return destRepository.Delete(path.Join(destPath, relativePath))
-			})
-			if err != nil {
+			plan.Delete = append(plan.Delete, relativePath)
+		}
+	}
+
+	sort.Slice(plan.Copy, func(i, j int) bool { return plan.Copy[i].Path < plan.Copy[j].Path })
+	sort.Strings(plan.Delete)
+	syncLog.Debug("%d files to copy from %s/%s and %d to delete from %s/%s", len(plan.Copy), sourceRepository.RootURL(), sourcePath, len(plan.Delete), destRepository.RootURL(), destPath)
+	return plan, nil
+}
+
+// sameContent returns whether a and b have the same content. They are
+// compared by MD5, or if one of them doesn't have an MD5 (e.g. multipart
+// uploads to S3), by size and ETag. If neither can be compared, they are
+// assumed to be different so the file gets copied.
+func sameContent(a, b ListResult) bool {
+	if len(a.MD5) > 0 && len(b.MD5) > 0 {
+		return bytes.Equal(a.MD5, b.MD5)
+	}
+	return a.Size == b.Size && a.ETag != "" && a.ETag == b.ETag
+}
+
+// Apply copies and deletes the files in the plan
+func (p *SyncPlan) Apply() error {
+	// A queue to use for the various storage operations we have to run
+	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+
+	for _, file := range p.Copy {
+		// Variables used in closure
+		relativePath := file.Path
+		size := file.Size
+		err := queue.Go(func() error {
+			start := time.Now()
+			if err := p.copyFile(relativePath, size); err != nil {
 				return err
 			}
+			syncLog.Debug("Copied %s (%d bytes, took %.3f seconds)", relativePath, size, time.Since(start).Seconds())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, relativePath := range p.Delete {
+		// Variables used in closure
+		relativePath := relativePath
+		err := queue.Go(func() error {
+			return p.destRepository.Delete(path.Join(p.destPath, relativePath))
+		})
+		if err != nil {
+			return err
 		}
 	}
 
 	return queue.Wait()
 }
+
+// copyFile copies relativePath from source to dest. Within a repository the
+// object is copied server-side, otherwise it is streamed through a temporary
+// file so it doesn't have to fit in memory.
+func (p *SyncPlan) copyFile(relativePath string, size int64) error {
+	src := path.Join(p.sourcePath, relativePath)
+	dest := path.Join(p.destPath, relativePath)
+	if p.sourceRepository == p.destRepository {
+		return p.destRepository.Copy(src, dest)
+	}
+
+	tempDir, err := files.TempDir("sync")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	if err := files.EnsureFreeSpace(tempDir, size); err != nil {
+		return err
+	}
+
+	reader, err := p.sourceRepository.GetReader(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	f, err := os.Create(filepath.Join(tempDir, path.Base(dest)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return p.destRepository.PutPath(tempDir, path.Dir(dest))
+}
+
+// Sync destRepository/destPath to match sourceRepository/sourcePath
+//
+// - If file exists in source, but not in dest, it will copy from source to dest
+// - If file exists in both but different content, it will copy from source to dest
+// - If file exists in dest but not in source, it will delete in dest
+func Sync(sourceRepository Repository, sourcePath string, destRepository Repository, destPath string) error {
+	plan, err := PlanSync(sourceRepository, sourcePath, destRepository, destPath)
+	if err != nil {
+		return err
+	}
+	return plan.Apply()
+}
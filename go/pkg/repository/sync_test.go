@@ -63,3 +63,23 @@ func TestSync(t *testing.T) {
 	info, _ = os.Stat(filepath.Join(destRepository.rootDir, "dest-path/same-content"))
 	require.Equal(t, info.ModTime(), sameContentMTime)
 }
+
+func TestSameContent(t *testing.T) {
+	md5 := []byte{1, 2, 3}
+	otherMD5 := []byte{4, 5, 6}
+	for _, tt := range []struct {
+		a, b ListResult
+		same bool
+	}{
+		{ListResult{MD5: md5, Size: 5}, ListResult{MD5: md5, Size: 5}, true},
+		{ListResult{MD5: md5, Size: 5}, ListResult{MD5: otherMD5, Size: 5}, false},
+		// Multipart uploads to S3 don't have an MD5, so size and ETag are compared
+		{ListResult{Size: 5, ETag: "abc-2"}, ListResult{Size: 5, ETag: "abc-2"}, true},
+		{ListResult{Size: 5, ETag: "abc-2"}, ListResult{Size: 6, ETag: "abc-2"}, false},
+		{ListResult{Size: 5, ETag: "abc-2"}, ListResult{MD5: md5, Size: 5, ETag: "def"}, false},
+		// With nothing to compare, files are assumed to be different
+		{ListResult{Size: 5}, ListResult{Size: 5}, false},
+	} {
+		require.Equal(t, tt.same, sameContent(tt.a, tt.b), "%+v %+v", tt.a, tt.b)
+	}
+}
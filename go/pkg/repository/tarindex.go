@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/replicate/replicate/go/pkg/concurrency"
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Tarballs with lots of files in them are written as a series of gzip
+// streams ("blocks") that each start at a file, along with an index of which
+// block each file is in. A gzip file can be made of several streams, so it is
+// still an ordinary .tar.gz, but files can be extracted by downloading only
+// the blocks they are in, rather than the whole tarball.
+
+const (
+	// minIndexedTarFiles is how many files a tarball needs to be indexed.
+	// Downloading all of a tarball with fewer is quick anyway.
+	minIndexedTarFiles = 100
+	// tarBlockSize is how much uncompressed data goes in a block before
+	// the next one is started
+	tarBlockSize = 1024 * 1024
+)
+
+// TarIndex is the index of an indexed tarball
+type TarIndex struct {
+	Blocks []TarBlock `json:"blocks"`
+	// Files maps the path of each file, relative to the tarball's root
+	// directory, to the index of the block it is in
+	Files map[string]int `json:"files"`
+}
+
+// TarBlock is the position of a gzip stream in a tarball
+type TarBlock struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// TarIndexPath returns the path of the index of the tarball at tarPath
+func TarIndexPath(tarPath string) string {
+	return tarPath + ".index.json"
+}
+
+// LoadTarIndex returns the index of the tarball at tarPath, or nil if it
+// doesn't have one. The index is only needed to read the tarball quickly, so
+// if it can't be read (e.g. because it has been archived), it is nil too and
+// the tarball is read in full.
+func LoadTarIndex(r Repository, tarPath string) *TarIndex {
+	data, err := r.Get(TarIndexPath(tarPath))
+	if err != nil {
+		if !errors.IsDoesNotExist(err) {
+			console.Debug("Failed to read %s/%s: %s", r.RootURL(), TarIndexPath(tarPath), err)
+		}
+		return nil
+	}
+	index := new(TarIndex)
+	if err := json.Unmarshal(data, index); err != nil {
+		console.Debug("Failed to parse %s/%s: %s", r.RootURL(), TarIndexPath(tarPath), err)
+		return nil
+	}
+	return index
+}
+
+// putTarIndex writes the index of the tarball at tarPath, if it has one
+func putTarIndex(r Repository, tarPath string, index *TarIndex) error {
+	if index == nil {
+		return nil
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return r.Put(TarIndexPath(tarPath), data)
+}
+
+// FilesIn returns the files in the tarball that are itemPath or inside it
+func (i *TarIndex) FilesIn(itemPath string) []string {
+	itemPath = path.Clean(itemPath)
+	ret := []string{}
+	for filePath := range i.Files {
+		if itemPath == "." || filePath == itemPath || strings.HasPrefix(filePath, itemPath+"/") {
+			ret = append(ret, filePath)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ExtractFromIndexedTar extracts filePaths from the tarball at tarPath to
+// localPath, downloading only the blocks they are in. filePaths are relative
+// to the tarball's root directory, and must be in index.
+func ExtractFromIndexedTar(r Repository, tarPath string, index *TarIndex, filePaths []string, localPath string) error {
+	filesByBlock := map[int]map[string]bool{}
+	for _, filePath := range filePaths {
+		block, ok := index.Files[filePath]
+		if !ok || block < 0 || block >= len(index.Blocks) {
+			return errors.DoesNotExist("Path does not exist inside the tarfile: " + filePath)
+		}
+		if filesByBlock[block] == nil {
+			filesByBlock[block] = map[string]bool{}
+		}
+		filesByBlock[block][filePath] = true
+	}
+
+	queue := concurrency.NewWorkerQueue(context.Background(), maxWorkers)
+	for block, wanted := range filesByBlock {
+		// Variables used in closure
+		block, wanted := block, wanted
+		err := queue.Go(func() error {
+			return extractTarBlock(r, tarPath, index.Blocks[block], func(name string, header *tar.Header, tr *tar.Reader) (bool, error) {
+				if !wanted[name] {
+					return false, nil
+				}
+				delete(wanted, name)
+				if err := writeTarEntry(header, tr, filepath.Join(localPath, filepath.FromSlash(name))); err != nil {
+					return false, err
+				}
+				return len(wanted) == 0, nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return queue.Wait()
+}
+
+// extractTarBlock calls fn with each entry in a block of the tarball at
+// tarPath, with its name relative to the tarball's root directory, until fn
+// returns true
+func extractTarBlock(r Repository, tarPath string, block TarBlock, fn func(name string, header *tar.Header, tr *tar.Reader) (bool, error)) error {
+	reader, err := r.GetRangeReader(tarPath, block.Offset, block.Length)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return walkTar(reader, r.RootURL()+"/"+tarPath, fn)
+}
+
+// walkTar calls fn with each entry in the tarball read from reader, with its
+// name relative to the tarball's root directory, until fn returns true. url
+// is where the tarball is, for errors.
+func walkTar(reader io.Reader, url string, fn func(name string, header *tar.Header, tr *tar.Reader) (bool, error)) error {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return readError(err, fmt.Sprintf("Failed to read %s: %v", url, err))
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return readError(err, fmt.Sprintf("Failed to read %s: %v", url, err))
+		}
+		// Strip the tarball's root directory
+		parts := strings.SplitN(header.Name, "/", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		done, err := fn(parts[1], header, tr)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// extractTarReader extracts the tarball read from reader to localPath,
+// without its root directory. If itemPath isn't empty, only that file or
+// directory in it is extracted, and it is an error if it isn't in it. url is
+// where the tarball is, for errors.
+func extractTarReader(reader io.Reader, url string, itemPath string, localPath string) error {
+	if itemPath != "" {
+		itemPath = path.Clean(itemPath)
+	}
+	if itemPath == "." {
+		itemPath = ""
+	}
+	found := false
+	err := walkTar(reader, url, func(name string, header *tar.Header, tr *tar.Reader) (bool, error) {
+		name = strings.TrimSuffix(name, "/")
+		if name == "" || (itemPath != "" && name != itemPath && !strings.HasPrefix(name, itemPath+"/")) {
+			return false, nil
+		}
+		found = true
+		dest := filepath.Join(localPath, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(localPath, dest); err != nil || strings.HasPrefix(rel, "..") {
+			return false, errors.ReadError(fmt.Sprintf("%s has the file %s, which is outside of it", url, header.Name))
+		}
+		if header.Typeflag == tar.TypeDir {
+			return false, os.MkdirAll(dest, 0755)
+		}
+		return false, writeTarEntry(header, tr, dest)
+	})
+	if err == nil && itemPath != "" && !found {
+		return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
+	}
+	return err
+}
+
+// writeTarEntry writes the file in a tarball with header to dest
+func writeTarEntry(header *tar.Header, tr *tar.Reader, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(header.Linkname, dest)
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return nil
+}
+
+// writeIndexedTar writes filesToPut to out as an indexed tarball, and returns
+// its index. rootDir is the tarball's root directory, which the paths in the
+// index are relative to.
+func writeIndexedTar(filesToPut []fileToPut, out io.Writer, rootDir string) (*TarIndex, error) {
+	cw := &countingWriter{w: out}
+	bw := &blockWriter{gz: gzip.NewWriter(cw)}
+	tw := tar.NewWriter(bw)
+	index := &TarIndex{Blocks: []TarBlock{{Offset: 0}}, Files: map[string]int{}}
+
+	for _, file := range filesToPut {
+		if bw.n >= tarBlockSize {
+			// Pad the last file out so the next block starts at a header
+			if err := tw.Flush(); err != nil {
+				return nil, err
+			}
+			if err := bw.gz.Close(); err != nil {
+				return nil, err
+			}
+			last := &index.Blocks[len(index.Blocks)-1]
+			last.Length = cw.n - last.Offset
+			index.Blocks = append(index.Blocks, TarBlock{Offset: cw.n})
+			bw.gz = gzip.NewWriter(cw)
+			bw.n = 0
+		}
+		if err := writeTarFile(tw, file); err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(file.Dest), rootDir+"/")
+		index.Files[name] = len(index.Blocks) - 1
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := bw.gz.Close(); err != nil {
+		return nil, err
+	}
+	last := &index.Blocks[len(index.Blocks)-1]
+	last.Length = cw.n - last.Offset
+	return index, nil
+}
+
+func writeTarFile(tw *tar.Writer, file fileToPut) error {
+	link := ""
+	if file.Info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(file.Source); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(file.Info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(file.Dest)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !file.Info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(file.Source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// countingWriter counts the bytes written to the tarball, to find where each
+// block starts
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// blockWriter compresses the tar stream into the current block, counting the
+// uncompressed bytes written to it
+type blockWriter struct {
+	gz *gzip.Writer
+	n  int64
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	n, err := b.gz.Write(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// copyFileFromIndexedTar writes the file itemPath in an indexed tarball to
+// out, downloading only the block it is in
+func copyFileFromIndexedTar(r Repository, tarPath string, index *TarIndex, itemPath string, out io.Writer) error {
+	itemPath = path.Clean(itemPath)
+	block, ok := index.Files[itemPath]
+	if !ok || block < 0 || block >= len(index.Blocks) {
+		if len(index.FilesIn(itemPath)) > 0 {
+			return fmt.Errorf("%s is a directory, not a file", itemPath)
+		}
+		return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
+	}
+	found := false
+	err := extractTarBlock(r, tarPath, index.Blocks[block], func(name string, header *tar.Header, tr *tar.Reader) (bool, error) {
+		if name != itemPath {
+			return false, nil
+		}
+		found = true
+		if _, err := io.Copy(out, tr); err != nil {
+			return false, errors.ReadError(fmt.Sprintf("Failed to read %s from %s/%s: %v", itemPath, r.RootURL(), tarPath, err))
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.DoesNotExist("Path does not exist inside the tarfile: " + itemPath)
+	}
+	return nil
+}
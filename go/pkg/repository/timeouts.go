@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+// Timeouts bound how long operations on S3 and GCS repositories can take, so
+// a hung connection fails instead of blocking forever. Zero values mean there
+// is no limit, apart from the default connect timeout of the HTTP transport.
+type Timeouts struct {
+	// Connect is how long connecting to the storage service can take,
+	// including the TLS handshake
+	Connect time.Duration
+	// Request is how long to wait for the response to each request once it
+	// has been sent
+	Request time.Duration
+	// Overall is how long each file can take to be uploaded, downloaded or
+	// deleted, and how long each listing can take
+	Overall time.Duration
+}
+
+// Environment variables that set timeouts, as durations like "30s". They take
+// precedence over the timeouts set in replicate.yaml.
+const (
+	ConnectTimeoutEnvVar = "REPLICATE_CONNECT_TIMEOUT"
+	RequestTimeoutEnvVar = "REPLICATE_REQUEST_TIMEOUT"
+	OverallTimeoutEnvVar = "REPLICATE_TIMEOUT"
+)
+
+var (
+	timeoutsMu sync.Mutex
+	timeouts   Timeouts
+)
+
+// SetTimeouts sets the timeouts of storage operations, usually from
+// replicate.yaml. The connect and request timeouts are part of the HTTP
+// client that all repositories share, so they only apply if this is called
+// before the first repository connects.
+func SetTimeouts(t Timeouts) {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	timeouts = t
+}
+
+// currentTimeouts returns the timeouts set with SetTimeouts, overridden by
+// any that are set in the environment
+func currentTimeouts() Timeouts {
+	timeoutsMu.Lock()
+	t := timeouts
+	timeoutsMu.Unlock()
+	timeoutFromEnv(ConnectTimeoutEnvVar, &t.Connect)
+	timeoutFromEnv(RequestTimeoutEnvVar, &t.Request)
+	timeoutFromEnv(OverallTimeoutEnvVar, &t.Overall)
+	return t
+}
+
+// timeoutFromEnv sets timeout to the duration in envVar, if it is set to one
+func timeoutFromEnv(envVar string, timeout *time.Duration) {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		console.Warn("Ignoring %s, because it isn't a duration like \"30s\": %s", envVar, value)
+		return
+	}
+	*timeout = d
+}
+
+// withOverallTimeout returns a context that is cancelled when the overall
+// timeout has passed, or ctx if there isn't one
+func withOverallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t := currentTimeouts().Overall; t > 0 {
+		return context.WithTimeout(ctx, t)
+	}
+	return context.WithCancel(ctx)
+}
+
+// transferProgress counts the files of an operation that have finished, so an
+// error part of the way through can say how far it got. total is -1 if the
+// number of files isn't known in advance.
+type transferProgress struct {
+	// done is first so it is aligned for atomic operations on 32-bit
+	// platforms
+	done  int64
+	total int
+}
+
+func newTransferProgress(total int) *transferProgress {
+	return &transferProgress{total: total}
+}
+
+func (p *transferProgress) add() {
+	atomic.AddInt64(&p.done, 1)
+}
+
+func (p *transferProgress) String() string {
+	if p.total < 0 {
+		return fmt.Sprintf("%d files", atomic.LoadInt64(&p.done))
+	}
+	return fmt.Sprintf("%d of %d files", atomic.LoadInt64(&p.done), p.total)
+}
+
+// timeoutError returns the error for url taking longer than the overall
+// timeout to be uploaded, downloaded, deleted or listed (verb). If it was one
+// of the files of a bigger operation, progress says how many had finished.
+func timeoutError(verb string, url string, progress *transferProgress) error {
+	msg := fmt.Sprintf("Timed out %s %s after %s", verb, url, currentTimeouts().Overall)
+	if progress != nil {
+		msg += fmt.Sprintf(" (%s finished)", progress)
+	}
+	return errors.TimedOut(msg + fmt.Sprintf(". To allow longer, set %s or timeouts.overall_seconds in replicate.yaml.", OverallTimeoutEnvVar))
+}
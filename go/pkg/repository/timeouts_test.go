@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/errors"
+)
+
+func TestCurrentTimeouts(t *testing.T) {
+	SetTimeouts(Timeouts{Connect: 5 * time.Second, Overall: time.Minute})
+	defer SetTimeouts(Timeouts{})
+	require.Equal(t, Timeouts{Connect: 5 * time.Second, Overall: time.Minute}, currentTimeouts())
+
+	// The environment takes precedence
+	os.Setenv(OverallTimeoutEnvVar, "90s")
+	defer os.Unsetenv(OverallTimeoutEnvVar)
+	os.Setenv(RequestTimeoutEnvVar, "not a duration")
+	defer os.Unsetenv(RequestTimeoutEnvVar)
+	require.Equal(t, Timeouts{Connect: 5 * time.Second, Overall: 90 * time.Second}, currentTimeouts())
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	SetTimeouts(Timeouts{Connect: 5 * time.Second, Request: 20 * time.Second})
+	defer SetTimeouts(Timeouts{})
+	transport, err := newTransport()
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	require.Equal(t, 20*time.Second, transport.ResponseHeaderTimeout)
+}
+
+func TestS3PutPathTimeout(t *testing.T) {
+	fake := newFakeS3(0)
+	// Uploads of hung.bin never get a response
+	repository, closeServer := newFakeS3Repository(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/hung.bin") {
+			<-r.Context().Done()
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}), "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "hung.bin"), []byte("hung"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ok.txt"), []byte("ok"), 0644))
+
+	SetTimeouts(Timeouts{Overall: 200 * time.Millisecond})
+	defer SetTimeouts(Timeouts{})
+	err = repository.PutPath(dir, "checkpoints/abc123")
+	require.Error(t, err)
+	require.True(t, errors.IsTimedOut(err))
+	require.Contains(t, err.Error(), "s3://bucket/root/checkpoints/abc123/hung.bin")
+	require.Contains(t, err.Error(), "of 2 files finished")
+
+	err = repository.Put("hung.bin", []byte("hung"))
+	require.True(t, errors.IsTimedOut(err))
+	require.NoError(t, repository.Put("ok.txt", []byte("ok")))
+}
+
+func TestS3PutPathInterrupted(t *testing.T) {
+	defer resetTransfers()
+	fake := newFakeS3(int(s3manager.DefaultUploadPartSize))
+	// The second part of the upload never gets a response
+	started := make(chan struct{})
+	var once sync.Once
+	repository, closeServer := newFakeS3Repository(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Get("partNumber") == "2" {
+			once.Do(func() { close(started) })
+			<-r.Context().Done()
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}), "root")
+	defer closeServer()
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	large := make([]byte, 2*s3manager.DefaultUploadPartSize)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large.bin"), large, 0644))
+
+	go func() {
+		<-started
+		CancelTransfers()
+	}()
+	err = repository.PutPath(dir, "checkpoints/abc123")
+	require.Error(t, err)
+	require.True(t, errors.IsInterrupted(err))
+	require.Contains(t, err.Error(), "Interrupted uploading s3://bucket/root/checkpoints/abc123/large.bin (0 of 1 files finished)")
+
+	// The parts that were uploaded were thrown away
+	require.Empty(t, fake.parts)
+	require.Equal(t, 0, fake.multipartPuts)
+
+	// Nothing else can start until the process exits
+	require.True(t, errors.IsInterrupted(repository.Put("small.txt", []byte("small"))))
+}
+
+// resetTransfers undoes CancelTransfers, so other tests can transfer files
+func resetTransfers() {
+	transferCtx, cancelTransfers = context.WithCancel(context.Background())
+}
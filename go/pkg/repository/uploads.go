@@ -0,0 +1,28 @@
+package repository
+
+import "time"
+
+// IncompleteUpload is a multipart upload that was started but never finished
+// or aborted, for example because the process uploading it was killed. The
+// parts that were uploaded are kept, and paid for, until it is aborted.
+type IncompleteUpload struct {
+	// Path is the path of the object being uploaded, relative to the
+	// repository root
+	Path      string
+	Initiated time.Time
+}
+
+// IncompleteUploadLister is implemented by repositories that upload large
+// objects in parts
+type IncompleteUploadLister interface {
+	// ListIncompleteUploads returns the incomplete uploads under the
+	// repository root, oldest first
+	ListIncompleteUploads() ([]*IncompleteUpload, error)
+}
+
+// AsIncompleteUploadLister returns repo as an IncompleteUploadLister, if it
+// uploads objects in parts
+func AsIncompleteUploadLister(repo Repository) (IncompleteUploadLister, bool) {
+	lister, ok := unwrap(repo).(IncompleteUploadLister)
+	return lister, ok
+}
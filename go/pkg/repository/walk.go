@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/replicate/go/pkg/console"
+)
+
+// walkFollowingSymlinks is like filepath.Walk, but symlinks are followed, so
+// walkFn gets the file or directory they point to. A symlink to a directory
+// that contains it would be walked forever, so it is skipped with a warning.
+// Broken symlinks are passed to walkFn as they are.
+func walkFollowingSymlinks(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = walkFollowingSymlinksDir(root, info, map[string]bool{}, walkFn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// ancestors are the real paths of the directories that contain currentPath
+func walkFollowingSymlinksDir(currentPath string, info os.FileInfo, ancestors map[string]bool, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(currentPath, info, nil)
+	}
+	realPath, err := filepath.EvalSymlinks(currentPath)
+	if err != nil {
+		return walkFn(currentPath, info, err)
+	}
+	if ancestors[realPath] {
+		console.Warn("Skipping %s, because it is a symlink to a directory that contains it", currentPath)
+		return nil
+	}
+	if err := walkFn(currentPath, info, nil); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(currentPath)
+	if err != nil {
+		return walkFn(currentPath, info, err)
+	}
+
+	ancestors[realPath] = true
+	defer delete(ancestors, realPath)
+	for _, entry := range entries {
+		entryPath := filepath.Join(currentPath, entry.Name())
+		if entry.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Stat(entryPath)
+			if err != nil && !os.IsNotExist(err) {
+				if err := walkFn(entryPath, entry, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err == nil {
+				entry = target
+			}
+		}
+		if err := walkFollowingSymlinksDir(entryPath, entry, ancestors, walkFn); err != nil {
+			if err == filepath.SkipDir && entry.IsDir() {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// specialFileError returns an error about a file that isn't a regular file,
+// directory or symlink to one of those, which can't be saved
+func specialFileError(path string, info os.FileInfo) error {
+	return fmt.Errorf("%s is a %s, which can't be saved. Add it to .replicateignore, or set 'special_files: skip' in replicate.yaml to skip files like it", path, specialFileKind(info))
+}
+
+func specialFileKind(info os.FileInfo) string {
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "broken symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	}
+	return "special file"
+}
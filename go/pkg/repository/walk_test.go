@@ -0,0 +1,68 @@
+// +build !windows
+
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetListOfFilesToPutSymlinksAndSpecialFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	dataDir, err := ioutil.TempDir("", "replicate-test-data")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "foo.txt"), []byte("foo"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "dir"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "bar.txt"), []byte("bar"), 0644))
+
+	// Symlinks to files and directories are followed
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "foo.txt"), filepath.Join(tmpDir, "link.txt")))
+	require.NoError(t, os.Symlink(dataDir, filepath.Join(tmpDir, "data")))
+	// Cycles are skipped
+	require.NoError(t, os.Symlink(tmpDir, filepath.Join(tmpDir, "dir", "loop")))
+	require.NoError(t, os.Symlink(".", filepath.Join(dataDir, "self")))
+
+	filesToPut, err := getListOfFilesToPut(tmpDir, "", nil, true)
+	require.NoError(t, err)
+	dests := []string{}
+	for _, file := range filesToPut {
+		dests = append(dests, file.Dest)
+		require.True(t, file.Info.Mode().IsRegular())
+	}
+	sort.Strings(dests)
+	require.Equal(t, []string{"data/bar.txt", "foo.txt", "link.txt"}, dests)
+
+	// Special files are skipped, or are an error
+	for _, name := range []string{"broken", "pipe"} {
+		special := filepath.Join(tmpDir, "dir", name)
+		if name == "broken" {
+			require.NoError(t, os.Symlink(filepath.Join(tmpDir, "does-not-exist"), special))
+		} else {
+			require.NoError(t, syscall.Mkfifo(special, 0644))
+		}
+
+		filesToPut, err = getListOfFilesToPut(tmpDir, "", nil, false)
+		require.NoError(t, err)
+		require.Len(t, filesToPut, 3)
+
+		_, err = getListOfFilesToPut(tmpDir, "", nil, true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), special)
+
+		// ...unless they're ignored
+		_, err = getListOfFilesToPut(tmpDir, "", []string{"dir/" + name}, true)
+		require.NoError(t, err)
+
+		require.NoError(t, os.Remove(special))
+	}
+}
@@ -27,6 +27,7 @@ type DaemonClient interface {
 	DeleteExperiment(ctx context.Context, in *DeleteExperimentRequest, opts ...grpc.CallOption) (*DeleteExperimentReply, error)
 	CheckoutCheckpoint(ctx context.Context, in *CheckoutCheckpointRequest, opts ...grpc.CallOption) (*CheckoutCheckpointReply, error)
 	GetExperimentStatus(ctx context.Context, in *GetExperimentStatusRequest, opts ...grpc.CallOption) (*GetExperimentStatusReply, error)
+	LogMetrics(ctx context.Context, in *LogMetricsRequest, opts ...grpc.CallOption) (*LogMetricsReply, error)
 }
 
 type daemonClient struct {
@@ -118,6 +119,15 @@ func (c *daemonClient) GetExperimentStatus(ctx context.Context, in *GetExperimen
 	return out, nil
 }
 
+func (c *daemonClient) LogMetrics(ctx context.Context, in *LogMetricsRequest, opts ...grpc.CallOption) (*LogMetricsReply, error) {
+	out := new(LogMetricsReply)
+	err := c.cc.Invoke(ctx, "/service.Daemon/LogMetrics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DaemonServer is the server API for Daemon service.
 // All implementations must embed UnimplementedDaemonServer
 // for forward compatibility
@@ -131,6 +141,7 @@ type DaemonServer interface {
 	DeleteExperiment(context.Context, *DeleteExperimentRequest) (*DeleteExperimentReply, error)
 	CheckoutCheckpoint(context.Context, *CheckoutCheckpointRequest) (*CheckoutCheckpointReply, error)
 	GetExperimentStatus(context.Context, *GetExperimentStatusRequest) (*GetExperimentStatusReply, error)
+	LogMetrics(context.Context, *LogMetricsRequest) (*LogMetricsReply, error)
 	mustEmbedUnimplementedDaemonServer()
 }
 
@@ -165,6 +176,9 @@ func (UnimplementedDaemonServer) CheckoutCheckpoint(context.Context, *CheckoutCh
 func (UnimplementedDaemonServer) GetExperimentStatus(context.Context, *GetExperimentStatusRequest) (*GetExperimentStatusReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetExperimentStatus not implemented")
 }
+func (UnimplementedDaemonServer) LogMetrics(context.Context, *LogMetricsRequest) (*LogMetricsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogMetrics not implemented")
+}
 func (UnimplementedDaemonServer) mustEmbedUnimplementedDaemonServer() {}
 
 // UnsafeDaemonServer may be embedded to opt out of forward compatibility for this service.
@@ -340,6 +354,24 @@ func _Daemon_GetExperimentStatus_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Daemon_LogMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).LogMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/service.Daemon/LogMetrics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).LogMetrics(ctx, req.(*LogMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Daemon_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "service.Daemon",
 	HandlerType: (*DaemonServer)(nil),
@@ -380,6 +412,10 @@ var _Daemon_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetExperimentStatus",
 			Handler:    _Daemon_GetExperimentStatus_Handler,
 		},
+		{
+			MethodName: "LogMetrics",
+			Handler:    _Daemon_LogMetrics_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "replicate.proto",
@@ -0,0 +1,29 @@
+package shared
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/replicate/replicate/go/pkg/metrics"
+)
+
+var (
+	daemonRequests        = metrics.NewCounter("replicate_daemon_requests_total", "Requests made to the daemon, by method and gRPC status code.", "method", "code")
+	daemonRequestDuration = metrics.NewHistogram("replicate_daemon_request_duration_seconds", "How long requests to the daemon took, in seconds, by method.", "method")
+	activeExperiments     = metrics.NewGauge("replicate_active_experiments", "Experiments that have been created and not stopped.")
+	checkpointsCreated    = metrics.NewCounter("replicate_checkpoints_created_total", "Checkpoints created.")
+)
+
+// metricsInterceptor counts and times the requests made to the daemon
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	method := path.Base(info.FullMethod)
+	daemonRequestDuration.Observe(time.Since(start).Seconds(), method)
+	daemonRequests.Inc(method, status.Code(err).String())
+	return resp, err
+}
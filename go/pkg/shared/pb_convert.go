@@ -26,12 +26,16 @@ func checkpointsFromPb(checkpointsPb []*servicepb.Checkpoint) []*project.Checkpo
 
 func checkpointFromPb(chkPb *servicepb.Checkpoint) *project.Checkpoint {
 	return &project.Checkpoint{
-		ID:            chkPb.Id,
-		Created:       chkPb.Created.AsTime(),
-		Metrics:       valueMapFromPb(chkPb.Metrics),
-		Step:          chkPb.Step,
-		Path:          chkPb.Path,
-		PrimaryMetric: primaryMetricFromPb(chkPb.PrimaryMetric),
+		ID:                     chkPb.Id,
+		Created:                chkPb.Created.AsTime(),
+		Metrics:                valueMapFromPb(chkPb.Metrics),
+		Step:                   chkPb.Step,
+		Path:                   chkPb.Path,
+		PrimaryMetric:          primaryMetricFromPb(chkPb.PrimaryMetric),
+		References:             chkPb.References,
+		ChunkedFiles:           chkPb.ChunkedFiles,
+		StoragePath:            chkPb.StoragePath,
+		ReferencedStoragePaths: chkPb.ReferencedStoragePaths,
 	}
 }
 
@@ -49,9 +53,81 @@ func experimentFromPb(expPb *servicepb.Experiment) *project.Experiment {
 		PythonVersion:    expPb.PythonVersion,
 		Checkpoints:      checkpointsFromPb(expPb.Checkpoints),
 		ReplicateVersion: expPb.ReplicateVersion,
+		Name:             expPb.Name,
+		DVCOutputs:       dvcOutputsFromPb(expPb.DvcOutputs),
+		Datasets:         datasetsFromPb(expPb.Datasets),
+		Environment:      expPb.Environment,
+		Seeds:            expPb.Seeds,
+		HostEnvironment:  hostEnvironmentFromPb(expPb.HostEnvironment),
+		Sweep:            sweepFromPb(expPb.Sweep),
+		StoragePath:      expPb.StoragePath,
+		Alerts:           alertsFromPb(expPb.Alerts),
 	}
 }
 
+func dvcOutputsFromPb(outputsPb []*servicepb.DVCOutput) []*project.DVCOutput {
+	if len(outputsPb) == 0 {
+		return nil
+	}
+	ret := make([]*project.DVCOutput, len(outputsPb))
+	for i, outPb := range outputsPb {
+		ret[i] = &project.DVCOutput{Path: outPb.Path, MD5: outPb.Md5, DVCFile: outPb.DvcFile}
+	}
+	return ret
+}
+
+func datasetsFromPb(datasetsPb []*servicepb.DatasetFingerprint) []*project.DatasetFingerprint {
+	if len(datasetsPb) == 0 {
+		return nil
+	}
+	ret := make([]*project.DatasetFingerprint, len(datasetsPb))
+	for i, dPb := range datasetsPb {
+		ret[i] = &project.DatasetFingerprint{
+			Name:      dPb.Name,
+			Path:      dPb.Path,
+			Hash:      dPb.Hash,
+			Algorithm: dPb.Algorithm,
+			Size:      dPb.Size,
+			Files:     int(dPb.Files),
+		}
+		if dPb.HasRows {
+			rows := dPb.Rows
+			ret[i].Rows = &rows
+		}
+	}
+	return ret
+}
+
+func hostEnvironmentFromPb(envPb *servicepb.HostEnvironment) *project.HostEnvironment {
+	if envPb == nil {
+		return nil
+	}
+	return &project.HostEnvironment{OS: envPb.Os, Arch: envPb.Arch, CUDAVersion: envPb.CudaVersion}
+}
+
+func sweepFromPb(sweepPb *servicepb.SweepMembership) *project.SweepMembership {
+	if sweepPb == nil {
+		return nil
+	}
+	return &project.SweepMembership{ID: sweepPb.Id, Run: int(sweepPb.Run)}
+}
+
+func alertsFromPb(alertsPb []*servicepb.Alert) []*project.Alert {
+	if len(alertsPb) == 0 {
+		return nil
+	}
+	ret := make([]*project.Alert, len(alertsPb))
+	for i, alertPb := range alertsPb {
+		ret[i] = &project.Alert{
+			Name:         alertPb.Name,
+			Message:      alertPb.Message,
+			CheckpointID: alertPb.CheckpointID,
+			Triggered:    alertPb.Triggered.AsTime(),
+		}
+	}
+	return ret
+}
+
 func configFromPb(confPb *servicepb.Config) *config.Config {
 	var conf *config.Config
 	if confPb != nil {
@@ -105,6 +181,16 @@ func valueFromPb(pb *servicepb.ParamType) param.Value {
 	panic(fmt.Sprintf("Unknown param type: %v", pb)) // should never happen
 }
 
+func metricSeriesFromPb(metricsPb []*servicepb.LoggedMetrics) (project.MetricSeries, error) {
+	series := project.MetricSeries{}
+	for _, m := range metricsPb {
+		if err := series.Add(m.Step, m.Timestamp.AsTime(), m.Values); err != nil {
+			return nil, err
+		}
+	}
+	return series, nil
+}
+
 // convert to protobuf
 
 func experimentsToPb(experiments []*project.Experiment) []*servicepb.Experiment {
@@ -129,7 +215,81 @@ func experimentToPb(exp *project.Experiment) *servicepb.Experiment {
 		PythonVersion:    exp.PythonVersion,
 		ReplicateVersion: exp.ReplicateVersion,
 		Checkpoints:      checkpointsToPb(exp.Checkpoints),
+		Name:             exp.Name,
+		DvcOutputs:       dvcOutputsToPb(exp.DVCOutputs),
+		Datasets:         datasetsToPb(exp.Datasets),
+		Environment:      exp.Environment,
+		Seeds:            exp.Seeds,
+		HostEnvironment:  hostEnvironmentToPb(exp.HostEnvironment),
+		Sweep:            sweepToPb(exp.Sweep),
+		StoragePath:      exp.StoragePath,
+		Alerts:           alertsToPb(exp.Alerts),
+	}
+}
+
+func dvcOutputsToPb(outputs []*project.DVCOutput) []*servicepb.DVCOutput {
+	if len(outputs) == 0 {
+		return nil
+	}
+	ret := make([]*servicepb.DVCOutput, len(outputs))
+	for i, out := range outputs {
+		ret[i] = &servicepb.DVCOutput{Path: out.Path, Md5: out.MD5, DvcFile: out.DVCFile}
+	}
+	return ret
+}
+
+func datasetsToPb(datasets []*project.DatasetFingerprint) []*servicepb.DatasetFingerprint {
+	if len(datasets) == 0 {
+		return nil
 	}
+	ret := make([]*servicepb.DatasetFingerprint, len(datasets))
+	for i, d := range datasets {
+		ret[i] = &servicepb.DatasetFingerprint{
+			Name:      d.Name,
+			Path:      d.Path,
+			Hash:      d.Hash,
+			Algorithm: d.Algorithm,
+			Size:      d.Size,
+			Files:     int64(d.Files),
+		}
+		// protobuf 3 doesn't have optionals, so whether rows were counted
+		// is a separate field
+		if d.Rows != nil {
+			ret[i].Rows = *d.Rows
+			ret[i].HasRows = true
+		}
+	}
+	return ret
+}
+
+func hostEnvironmentToPb(env *project.HostEnvironment) *servicepb.HostEnvironment {
+	if env == nil {
+		return nil
+	}
+	return &servicepb.HostEnvironment{Os: env.OS, Arch: env.Arch, CudaVersion: env.CUDAVersion}
+}
+
+func sweepToPb(sweep *project.SweepMembership) *servicepb.SweepMembership {
+	if sweep == nil {
+		return nil
+	}
+	return &servicepb.SweepMembership{Id: sweep.ID, Run: int64(sweep.Run)}
+}
+
+func alertsToPb(alerts []*project.Alert) []*servicepb.Alert {
+	if len(alerts) == 0 {
+		return nil
+	}
+	ret := make([]*servicepb.Alert, len(alerts))
+	for i, alert := range alerts {
+		ret[i] = &servicepb.Alert{
+			Name:         alert.Name,
+			Message:      alert.Message,
+			CheckpointID: alert.CheckpointID,
+			Triggered:    timestamppb.New(alert.Triggered),
+		}
+	}
+	return ret
 }
 
 func configToPb(conf *config.Config) *servicepb.Config {
@@ -158,12 +318,16 @@ func checkpointToPb(chk *project.Checkpoint) *servicepb.Checkpoint {
 		return nil
 	}
 	return &servicepb.Checkpoint{
-		Id:            chk.ID,
-		Created:       timestamppb.New(chk.Created),
-		Step:          chk.Step,
-		Metrics:       valueMapToPb(chk.Metrics),
-		Path:          chk.Path,
-		PrimaryMetric: primaryMetricToPb(chk.PrimaryMetric),
+		Id:                     chk.ID,
+		Created:                timestamppb.New(chk.Created),
+		Step:                   chk.Step,
+		Metrics:                valueMapToPb(chk.Metrics),
+		Path:                   chk.Path,
+		PrimaryMetric:          primaryMetricToPb(chk.PrimaryMetric),
+		References:             chk.References,
+		ChunkedFiles:           chk.ChunkedFiles,
+		StoragePath:            chk.StoragePath,
+		ReferencedStoragePaths: chk.ReferencedStoragePaths,
 	}
 }
 
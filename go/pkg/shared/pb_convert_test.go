@@ -32,6 +32,10 @@ func fullCheckpointPb() *servicepb.Checkpoint {
 			Name: "myfloat",
 			Goal: servicepb.PrimaryMetric_MAXIMIZE,
 		},
+		References:             map[string]string{"train.py": "bar"},
+		ChunkedFiles:           []string{"model.pth"},
+		StoragePath:            "runs/foo",
+		ReferencedStoragePaths: map[string]string{"bar": "runs/bar"},
 	}
 }
 
@@ -50,7 +54,11 @@ func fullCheckpoint() *project.Checkpoint {
 			"mylist":   param.Object([]interface{}{1.0, 2.0, 3.0}),
 			"mymap":    param.Object(map[string]interface{}{"bar": "baz"}),
 		},
-		PrimaryMetric: &project.PrimaryMetric{Name: "myfloat", Goal: "maximize"},
+		PrimaryMetric:          &project.PrimaryMetric{Name: "myfloat", Goal: "maximize"},
+		References:             map[string]string{"train.py": "bar"},
+		ChunkedFiles:           []string{"model.pth"},
+		StoragePath:            "runs/foo",
+		ReferencedStoragePaths: map[string]string{"bar": "runs/bar"},
 	}
 }
 
@@ -103,11 +111,26 @@ func fullExperimentPb() *servicepb.Experiment {
 				Step:    2,
 			},
 		},
+		Name:       "brave-falcon-42",
+		DvcOutputs: []*servicepb.DVCOutput{{Path: "data/train.csv", Md5: "abc", DvcFile: "data/train.csv.dvc"}},
+		Datasets: []*servicepb.DatasetFingerprint{
+			{Name: "train", Path: "data/train", Hash: "def", Size: 100, Files: 2, Rows: 10, HasRows: true},
+			{Name: "images", Path: "data/images", Hash: "ghi", Algorithm: "blake3", Size: 200, Files: 3},
+		},
+		Environment:     map[string]string{"CUDA_VISIBLE_DEVICES": "0"},
+		Seeds:           map[string]string{"seed": "42"},
+		HostEnvironment: &servicepb.HostEnvironment{Os: "linux", Arch: "amd64", CudaVersion: "11.0"},
+		Sweep:           &servicepb.SweepMembership{Id: "sweep1", Run: 3},
+		StoragePath:     "runs/foo",
+		Alerts: []*servicepb.Alert{
+			{Name: "loss > 1", Message: "loss is 2", CheckpointID: "c2", Triggered: timestamppb.New(t.Add(time.Minute * 2))},
+		},
 	}
 }
 
 func fullExperiment() *project.Experiment {
 	t := time.Date(2020, 12, 7, 1, 13, 29, 192682, time.UTC)
+	rows := int64(10)
 	return &project.Experiment{
 		ID:      "foo",
 		Created: t,
@@ -131,6 +154,20 @@ func fullExperiment() *project.Experiment {
 			{ID: "c1", Created: t.Add(time.Minute * 1), Step: 1},
 			{ID: "c2", Created: t.Add(time.Minute * 2), Step: 2},
 		},
+		Name:       "brave-falcon-42",
+		DVCOutputs: []*project.DVCOutput{{Path: "data/train.csv", MD5: "abc", DVCFile: "data/train.csv.dvc"}},
+		Datasets: []*project.DatasetFingerprint{
+			{Name: "train", Path: "data/train", Hash: "def", Size: 100, Files: 2, Rows: &rows},
+			{Name: "images", Path: "data/images", Hash: "ghi", Algorithm: "blake3", Size: 200, Files: 3},
+		},
+		Environment:     map[string]string{"CUDA_VISIBLE_DEVICES": "0"},
+		Seeds:           map[string]string{"seed": "42"},
+		HostEnvironment: &project.HostEnvironment{OS: "linux", Arch: "amd64", CUDAVersion: "11.0"},
+		Sweep:           &project.SweepMembership{ID: "sweep1", Run: 3},
+		StoragePath:     "runs/foo",
+		Alerts: []*project.Alert{
+			{Name: "loss > 1", Message: "loss is 2", CheckpointID: "c2", Triggered: t.Add(time.Minute * 2)},
+		},
 	}
 }
 
@@ -172,6 +209,20 @@ func TestConvertEmptyExperimentFromPb(t *testing.T) {
 	require.Equal(t, expected, experimentFromPb(expPb))
 }
 
+func TestConvertMetricSeriesFromPb(t *testing.T) {
+	t1 := time.Date(2020, 12, 7, 1, 13, 29, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+	series, err := metricSeriesFromPb([]*servicepb.LoggedMetrics{
+		{Step: 1, Timestamp: timestamppb.New(t1), Values: map[string]float64{"loss": 0.5, "accuracy": 0.7}},
+		{Step: 2, Timestamp: timestamppb.New(t2), Values: map[string]float64{"loss": 0.4}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, project.MetricSeries{
+		"loss":     {{Step: 1, Timestamp: t1, Value: 0.5}, {Step: 2, Timestamp: t2, Value: 0.4}},
+		"accuracy": {{Step: 1, Timestamp: t1, Value: 0.7}},
+	}, series)
+}
+
 func TestConvertCheckpointToPb(t *testing.T) {
 	chk := fullCheckpoint()
 	expected := fullCheckpointPb()
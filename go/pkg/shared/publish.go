@@ -0,0 +1,190 @@
+package shared
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/replicate/replicate/go/pkg/console"
+	"github.com/replicate/replicate/go/pkg/errors"
+	"github.com/replicate/replicate/go/pkg/project"
+)
+
+// Published checkpoints are served over plain HTTP, so services that use
+// models can download them with wget or curl, without Replicate or any cloud
+// credentials. Each file is at /<checkpoint ID>/<path>, where the path is
+// relative to the project directory, as it is in "replicate show". The URLs
+// don't change, because checkpoint IDs don't. /<checkpoint ID>/ lists the
+// files in the checkpoint, one per line, and / lists the checkpoints.
+//
+// Files are read from the repository when they are requested, so nothing is
+// copied anywhere before it is served.
+
+// PublishedCheckpoint is a checkpoint that is served, and its experiment
+type PublishedCheckpoint struct {
+	Experiment *project.Experiment
+	Checkpoint *project.Checkpoint
+}
+
+// PublishHandler serves the files of published checkpoints
+type PublishHandler struct {
+	project     *project.Project
+	checkpoints map[string]*PublishedCheckpoint
+	token       string
+
+	// files are the paths of the files in each checkpoint, by checkpoint
+	// ID, once they have been listed
+	filesMu sync.Mutex
+	files   map[string][]string
+}
+
+// NewPublishHandler returns a handler that serves the files of checkpoints
+// in proj. If token isn't empty, requests must include it, either as a
+// bearer token in the Authorization header or as the "token" query
+// parameter.
+func NewPublishHandler(proj *project.Project, checkpoints []*PublishedCheckpoint, token string) *PublishHandler {
+	h := &PublishHandler{
+		project:     proj,
+		checkpoints: map[string]*PublishedCheckpoint{},
+		token:       token,
+		files:       map[string][]string{},
+	}
+	for _, published := range checkpoints {
+		h.checkpoints[published.Checkpoint.ID] = published
+	}
+	return h
+}
+
+func (h *PublishHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="replicate"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlPath := strings.TrimPrefix(r.URL.Path, "/")
+	if urlPath == "" {
+		ids := []string{}
+		for id := range h.checkpoints {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		writeList(w, ids, "/")
+		return
+	}
+	parts := strings.SplitN(urlPath, "/", 2)
+	published, ok := h.checkpoints[parts[0]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		http.Redirect(w, r, "/"+parts[0]+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	filePaths, err := h.checkpointFiles(published)
+	if err != nil {
+		console.Warn("Failed to list the files in checkpoint %s: %s", published.Checkpoint.ShortID(), err)
+		http.Error(w, "Failed to list the files in the checkpoint", http.StatusInternalServerError)
+		return
+	}
+	if parts[1] == "" {
+		writeList(w, filePaths, "")
+		return
+	}
+	filePath := path.Clean(parts[1])
+	i := sort.SearchStrings(filePaths, filePath)
+	if i == len(filePaths) || filePaths[i] != filePath {
+		http.NotFound(w, r)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(filePath)}))
+	// Checkpoints don't change, so their files can be cached forever
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Method == http.MethodHead {
+		return
+	}
+	out := &writtenWriter{w: w}
+	if err := h.project.CopyFile(published.Checkpoint, published.Experiment, filePath, out); err != nil {
+		console.Warn("Failed to serve %s from checkpoint %s: %s", filePath, published.Checkpoint.ShortID(), err)
+		// Once some of the file has been sent, the status can't be
+		// changed, so the client sees a short response
+		if !out.written {
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Cache-Control")
+			if errors.IsDoesNotExist(err) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, "Failed to read the file from the repository", http.StatusBadGateway)
+			}
+		}
+	}
+}
+
+// authorized returns whether r has the token, if there is one
+func (h *PublishHandler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// checkpointFiles returns the paths of the files in a published checkpoint,
+// sorted, listing them the first time they are needed
+func (h *PublishHandler) checkpointFiles(published *PublishedCheckpoint) ([]string, error) {
+	h.filesMu.Lock()
+	defer h.filesMu.Unlock()
+	if filePaths, ok := h.files[published.Checkpoint.ID]; ok {
+		return filePaths, nil
+	}
+	filePaths, err := h.project.CheckpointFiles(published.Checkpoint, published.Experiment)
+	if err != nil {
+		return nil, err
+	}
+	h.files[published.Checkpoint.ID] = filePaths
+	return filePaths, nil
+}
+
+// writeList writes names as plain text, one per line, each followed by
+// suffix
+func writeList(w http.ResponseWriter, names []string, suffix string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s%s\n", name, suffix)
+	}
+}
+
+// writtenWriter records whether anything has been written to w
+type writtenWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (o *writtenWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		o.written = true
+	}
+	return o.w.Write(p)
+}
@@ -0,0 +1,93 @@
+package shared
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/replicate/go/pkg/config"
+	"github.com/replicate/replicate/go/pkg/files"
+	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
+)
+
+func TestPublishHandler(t *testing.T) {
+	repoDir, err := files.TempDir("test-publish")
+	require.NoError(t, err)
+	defer os.RemoveAll(repoDir)
+	repo, err := repository.NewDiskRepository(repoDir)
+	require.NoError(t, err)
+
+	exp := &project.Experiment{
+		ID:      "1eeeeeeeee",
+		Created: time.Now().Add(-10 * time.Minute),
+		Config:  &config.Config{},
+		Path:    ".",
+		Checkpoints: []*project.Checkpoint{
+			{ID: "1ccccccccc", Created: time.Now().Add(-5 * time.Minute), Path: "weights"},
+			{ID: "2ccccccccc", Created: time.Now().Add(-4 * time.Minute), Path: "weights"},
+		},
+	}
+	require.NoError(t, exp.Save(repo))
+	codeDir, err := files.TempDir("test-publish-code")
+	require.NoError(t, err)
+	defer os.RemoveAll(codeDir)
+	require.NoError(t, os.MkdirAll(path.Join(codeDir, "weights"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "train.py"), []byte("print(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(codeDir, "weights", "model.pt"), []byte("weights"), 0644))
+	require.NoError(t, repo.PutPathTar(codeDir, "experiments/1eeeeeeeee.tar.gz", ""))
+	require.NoError(t, repo.PutPathTar(codeDir, "checkpoints/1ccccccccc.tar.gz", "weights"))
+
+	proj := project.NewProject(repo, "")
+	handler := NewPublishHandler(proj, []*PublishedCheckpoint{{Experiment: exp, Checkpoint: exp.Checkpoints[0]}}, "secret")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(urlPath string, token string) (int, string) {
+		req, err := http.NewRequest("GET", server.URL+urlPath, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Files of the checkpoint, overlaid on its experiment's
+	status, body := get("/1ccccccccc/weights/model.pt", "secret")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "weights", body)
+	status, body = get("/1ccccccccc/train.py?token=secret", "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "print(1)", body)
+	status, body = get("/1ccccccccc/", "secret")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "train.py\nweights/model.pt\n", body)
+	status, body = get("/", "secret")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "1ccccccccc/\n", body)
+
+	// Without the token
+	status, _ = get("/1ccccccccc/weights/model.pt", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = get("/1ccccccccc/weights/model.pt", "wrong")
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	// Files that don't exist, and checkpoints that aren't published
+	status, _ = get("/1ccccccccc/missing.txt", "secret")
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/1ccccccccc/../../metadata/experiments/1eeeeeeeee.json", "secret")
+	require.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/2ccccccccc/weights/model.pt", "secret")
+	require.Equal(t, http.StatusNotFound, status)
+}
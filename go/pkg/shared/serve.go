@@ -19,6 +19,7 @@ import (
 	"github.com/replicate/replicate/go/pkg/console"
 	"github.com/replicate/replicate/go/pkg/errors"
 	"github.com/replicate/replicate/go/pkg/project"
+	"github.com/replicate/replicate/go/pkg/repository"
 	"github.com/replicate/replicate/go/pkg/servicepb"
 )
 
@@ -31,11 +32,28 @@ type server struct {
 	projectGetter            projectGetter
 	project                  *project.Project
 	heartbeatsByExperimentID map[string]*HeartbeatProcess
+
+	// savedExperimentsByID holds the last saved version of each running
+	// experiment, to find the checkpoints that are new when it is saved
+	// again and to run hooks when it is stopped
+	savedExperimentsByID map[string]*project.Experiment
+
+	// runningExperimentsByID are the experiments that have been created and
+	// not stopped, for the replicate_active_experiments metric and to find
+	// where their checkpoints are stored
+	runningExperimentsByID map[string]*project.Experiment
 }
 
 func (s *server) CreateExperiment(ctx context.Context, req *servicepb.CreateExperimentRequest) (*servicepb.CreateExperimentReply, error) {
 	pbReqExp := req.GetExperiment()
+	// Names can also be set with an environment variable, which is how
+	// `replicate sweep run` names the experiments it launches
+	name := req.GetName()
+	if name == "" {
+		name = os.Getenv("REPLICATE_EXPERIMENT_NAME")
+	}
 	args := project.CreateExperimentArgs{
+		Name:           name,
 		Path:           pbReqExp.GetPath(),
 		Command:        pbReqExp.GetCommand(),
 		Params:         valueMapFromPb(pbReqExp.GetParams()),
@@ -52,6 +70,8 @@ func (s *server) CreateExperiment(ctx context.Context, req *servicepb.CreateExpe
 	if !req.DisableHeartbeat {
 		s.heartbeatsByExperimentID[exp.ID] = StartHeartbeat(s.project, exp.ID)
 	}
+	s.runningExperimentsByID[exp.ID] = exp
+	activeExperiments.Inc()
 
 	pbRetExp := experimentToPb(exp)
 	return &servicepb.CreateExperimentReply{Experiment: pbRetExp}, nil
@@ -60,6 +80,7 @@ func (s *server) CreateExperiment(ctx context.Context, req *servicepb.CreateExpe
 func (s *server) CreateCheckpoint(ctx context.Context, req *servicepb.CreateCheckpointRequest) (*servicepb.CreateCheckpointReply, error) {
 	pbReqChk := req.GetCheckpoint()
 	args := project.CreateCheckpointArgs{
+		Experiment:    s.runningExperimentsByID[req.GetExperimentID()],
 		Path:          pbReqChk.GetPath(),
 		Metrics:       valueMapFromPb(pbReqChk.GetMetrics()),
 		PrimaryMetric: primaryMetricFromPb(pbReqChk.PrimaryMetric),
@@ -73,6 +94,7 @@ func (s *server) CreateCheckpoint(ctx context.Context, req *servicepb.CreateChec
 	if err != nil {
 		return nil, handleError(err)
 	}
+	checkpointsCreated.Inc()
 
 	pbRetChk := checkpointToPb(chk)
 	return &servicepb.CreateCheckpointReply{Checkpoint: pbRetChk}, nil
@@ -85,10 +107,17 @@ func (s *server) SaveExperiment(ctx context.Context, req *servicepb.SaveExperime
 	if err != nil {
 		return nil, handleError(err)
 	}
+	newCheckpoints := s.newCheckpoints(exp)
+	alerts := map[*project.Checkpoint][]*project.Alert{}
+	for _, chk := range newCheckpoints {
+		alerts[chk] = proj.CheckAlerts(exp, chk)
+	}
 	exp, err = proj.SaveExperiment(exp, req.Quiet)
 	if err != nil {
 		return nil, handleError(err)
 	}
+	s.runCheckpointHooks(proj, exp, newCheckpoints, alerts)
+	s.savedExperimentsByID[exp.ID] = exp
 	return &servicepb.SaveExperimentReply{Experiment: experimentToPb(exp)}, nil
 }
 
@@ -104,9 +133,73 @@ func (s *server) StopExperiment(ctx context.Context, req *servicepb.StopExperime
 	if err := proj.StopExperiment(req.ExperimentID); err != nil {
 		return nil, handleError(err)
 	}
+	if _, ok := s.runningExperimentsByID[req.ExperimentID]; ok {
+		delete(s.runningExperimentsByID, req.ExperimentID)
+		activeExperiments.Dec()
+	}
+	exp, ok := s.savedExperimentsByID[req.ExperimentID]
+	delete(s.savedExperimentsByID, req.ExperimentID)
+	// Hooks are queued on the worker so they run after pending uploads, but
+	// run in the background so they don't hold up uploads queued after them
+	s.workChan <- func() error {
+		proj.InBackground(func() error {
+			if !ok {
+				var err error
+				if exp, err = proj.ExperimentByID(req.ExperimentID); err != nil {
+					return err
+				}
+			}
+			return proj.RunExperimentEndHook(exp)
+		})
+		return nil
+	}
 	return &servicepb.StopExperimentReply{}, nil
 }
 
+// newCheckpoints returns the checkpoints of exp that weren't in it when it was
+// last saved
+func (s *server) newCheckpoints(exp *project.Experiment) []*project.Checkpoint {
+	seen := map[string]bool{}
+	if prev, ok := s.savedExperimentsByID[exp.ID]; ok {
+		for _, chk := range prev.Checkpoints {
+			seen[chk.ID] = true
+		}
+	}
+	checkpoints := []*project.Checkpoint{}
+	for _, chk := range exp.Checkpoints {
+		if !seen[chk.ID] {
+			checkpoints = append(checkpoints, chk)
+		}
+	}
+	return checkpoints
+}
+
+// runCheckpointHooks queues signing checkpoints and the on_checkpoint hook
+// for them. The worker starts them after the checkpoints' files have been
+// uploaded, and they run in the background, so they don't hold up uploads.
+// The on_alert hook for the alerts they triggered is run in the background
+// straight away, because alerts shouldn't wait for uploads.
+func (s *server) runCheckpointHooks(proj *project.Project, exp *project.Experiment, checkpoints []*project.Checkpoint, alerts map[*project.Checkpoint][]*project.Alert) {
+	for _, chk := range checkpoints {
+		chk := chk
+		s.workChan <- func() error {
+			proj.InBackground(func() error {
+				return proj.SignCheckpoint(exp, chk)
+			})
+			proj.InBackground(func() error {
+				return proj.RunCheckpointHook(exp, chk)
+			})
+			return nil
+		}
+		for _, alert := range alerts[chk] {
+			alert := alert
+			proj.InBackground(func() error {
+				return proj.RunAlertHook(exp, chk, alert)
+			})
+		}
+	}
+}
+
 func (s *server) GetExperiment(ctx context.Context, req *servicepb.GetExperimentRequest) (*servicepb.GetExperimentReply, error) {
 	proj, err := s.getProject()
 	if err != nil {
@@ -142,14 +235,13 @@ func (s *server) DeleteExperiment(ctx context.Context, req *servicepb.DeleteExpe
 	if err != nil {
 		return nil, handleError(err)
 	}
-	if err := s.project.DeleteExperiment(exp); err != nil {
+	// Checkpoints first, so they can be checked against the experiment's
+	// metadata for references from other checkpoints
+	if err := s.project.DeleteCheckpoints(exp.Checkpoints); err != nil {
 		return nil, handleError(err)
 	}
-	// This is slow, see https://github.com/replicate/replicate/issues/333
-	for _, checkpoint := range exp.Checkpoints {
-		if err := s.project.DeleteCheckpoint(checkpoint); err != nil {
-			return nil, handleError(err)
-		}
+	if err := s.project.DeleteExperiment(exp); err != nil {
+		return nil, handleError(err)
 	}
 
 	return &servicepb.DeleteExperimentReply{}, nil
@@ -190,6 +282,24 @@ func (s *server) GetExperimentStatus(ctx context.Context, req *servicepb.GetExpe
 	return &servicepb.GetExperimentStatusReply{Status: status}, nil
 }
 
+func (s *server) LogMetrics(ctx context.Context, req *servicepb.LogMetricsRequest) (*servicepb.LogMetricsReply, error) {
+	series, err := metricSeriesFromPb(req.GetMetrics())
+	if err != nil {
+		return nil, handleError(err)
+	}
+	if len(series) == 0 {
+		return &servicepb.LogMetricsReply{}, nil
+	}
+	proj, err := s.getProject()
+	if err != nil {
+		return nil, handleError(err)
+	}
+	if err := proj.AppendMetricSeries(&project.Experiment{ID: req.ExperimentID}, series); err != nil {
+		return nil, handleError(err)
+	}
+	return &servicepb.LogMetricsReply{}, nil
+}
+
 func (s *server) getProject() (*project.Project, error) {
 	// we get the project lazily so that we can return a protobuf exception to the client
 	// as part of a request flow
@@ -206,6 +316,10 @@ func (s *server) getProject() (*project.Project, error) {
 	return proj, nil
 }
 
+// uploadQueueSize is how many uploads can be waiting before creating an
+// experiment or checkpoint blocks
+const uploadQueueSize = 10
+
 func Serve(projGetter projectGetter, socketPath string) error {
 	console.Debug("Starting daemon")
 
@@ -214,14 +328,15 @@ func Serve(projGetter projectGetter, socketPath string) error {
 		return fmt.Errorf("Failed to open UNIX socket on %s: %w", socketPath, err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(metricsInterceptor))
 	s := &server{
-		// block if there already are two items on the queue, in case uploading is a bottleneck
-		// TODO(andreas): warn the user if the queue is full, so they know that they should
-		// upload at a lesser interval
-		workChan:                 make(chan func() error, 2),
+		// Files are snapshotted before they are queued, so training only
+		// waits for uploads if this many are already waiting
+		workChan:                 make(chan func() error, uploadQueueSize),
 		projectGetter:            projGetter,
 		heartbeatsByExperimentID: make(map[string]*HeartbeatProcess),
+		savedExperimentsByID:     make(map[string]*project.Experiment),
+		runningExperimentsByID:   make(map[string]*project.Experiment),
 	}
 	servicepb.RegisterDaemonServer(grpcServer, s)
 
@@ -241,6 +356,18 @@ func Serve(projGetter projectGetter, socketPath string) error {
 		console.Debug("Exiting...")
 		s.workChan <- nil // nil is an exit sentinel
 
+		// Python sends SIGTERM when it exits, so only interrupting again,
+		// e.g. pressing Ctrl-C twice, stops the uploads
+		go func() {
+			for sig := range sigc {
+				if sig == syscall.SIGINT {
+					console.Info("Stopping uploads...")
+					repository.CancelTransfers()
+					return
+				}
+			}
+		}()
+
 		// Wait a short sec so completedChan gets filled if workChan is empty. (Surely there's a more elegant way to do this.)
 		time.Sleep(1 * time.Millisecond)
 
@@ -257,10 +384,21 @@ func Serve(projGetter projectGetter, socketPath string) error {
 			case <-completedChan:
 				console.Debug("Work completed")
 			case <-time.After(5 * time.Second):
-				console.Info("Replicate is still saving. If you force quit, you might lose data.")
+				console.Info("Replicate is still saving. Press Ctrl-C again to stop it, but anything that hasn't finished uploading won't be saved.")
 				<-completedChan
 			}
 		}
+		if repository.TransfersCancelled() {
+			console.Warn("Replicate was stopped before it finished saving, so some experiments and checkpoints are missing their files. Run 'replicate status' to see which.")
+		}
+
+		if s.project != nil {
+			// Hooks time out, so this doesn't wait forever
+			s.project.WaitForBackground()
+			if err := s.project.FlushEvents(); err != nil {
+				console.Warn("Failed to write batched metadata: %s", err)
+			}
+		}
 
 		for _, hb := range s.heartbeatsByExperimentID {
 			hb.Kill()
@@ -276,8 +414,8 @@ func Serve(projGetter projectGetter, socketPath string) error {
 				return
 			}
 			if err := work(); err != nil {
+				// Failed uploads are also recorded for `replicate status`
 				console.Error("%v", err)
-				// TODO(andreas): poll status endpoint, put errors in chan of messages to return. also include progress in these messages
 			}
 		}
 	}()
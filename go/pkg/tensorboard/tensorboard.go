@@ -0,0 +1,140 @@
+// Package tensorboard writes TensorBoard event files.
+//
+// Event files are TFRecord files of serialized Event protocol buffers. Only
+// scalar summaries are needed, so the protocol buffers are encoded by hand
+// rather than depending on TensorFlow's generated code.
+package tensorboard
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// EventWriter writes events to a TensorBoard event file
+type EventWriter struct {
+	w io.Writer
+}
+
+// NewEventWriter returns an EventWriter that writes to w, starting with the
+// file version event that TensorBoard expects at the start of every file
+func NewEventWriter(w io.Writer, wallTime time.Time) (*EventWriter, error) {
+	ew := &EventWriter{w: w}
+	event := encodeEventHeader(wallTime, 0)
+	event = appendBytesField(event, 3, []byte("brain.Event:2"))
+	if err := ew.writeRecord(event); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+// WriteScalar writes a scalar summary for tag at step
+func (ew *EventWriter) WriteScalar(tag string, step int64, wallTime time.Time, value float64) error {
+	summaryValue := appendBytesField(nil, 1, []byte(tag))
+	summaryValue = append(summaryValue, fieldKey(2, wireFixed32))
+	summaryValue = appendUint32(summaryValue, math.Float32bits(float32(value)))
+	summary := appendBytesField(nil, 1, summaryValue)
+
+	event := encodeEventHeader(wallTime, step)
+	event = appendBytesField(event, 5, summary)
+	return ew.writeRecord(event)
+}
+
+// writeRecord writes data in TFRecord format: the length, a checksum of the
+// length, the data, then a checksum of the data
+func (ew *EventWriter) writeRecord(data []byte) error {
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint64(header, uint64(len(data)))
+	record := append(header, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(record[8:], maskedCRC(header))
+	record = append(record, data...)
+	record = appendUint32(record, maskedCRC(data))
+	_, err := ew.w.Write(record)
+	return err
+}
+
+// FileName returns the name of an event file, in the format TensorBoard
+// looks for in a log directory
+func FileName(wallTime time.Time) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("events.out.tfevents.%d.%s", wallTime.Unix(), hostname)
+}
+
+// CreateEventFile creates a new event file in dir, creating dir if it doesn't
+// exist. The caller must close the returned file.
+func CreateEventFile(dir string, wallTime time.Time) (*os.File, *EventWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("Failed to create directory %s: %w", dir, err)
+	}
+	f, err := os.Create(filepath.Join(dir, FileName(wallTime)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create event file: %w", err)
+	}
+	ew, err := NewEventWriter(f, wallTime)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, ew, nil
+}
+
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, crc32c)
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
+
+const (
+	wireVarint          = 0
+	wireFixed64         = 1
+	wireLengthDelimited = 2
+	wireFixed32         = 5
+)
+
+// encodeEventHeader encodes the wall_time and step fields of an Event
+func encodeEventHeader(wallTime time.Time, step int64) []byte {
+	b := []byte{fieldKey(1, wireFixed64)}
+	seconds := float64(wallTime.UnixNano()) / float64(time.Second)
+	b = appendUint64(b, math.Float64bits(seconds))
+	b = append(b, fieldKey(2, wireVarint))
+	return appendVarint(b, uint64(step))
+}
+
+func fieldKey(field int, wireType int) byte {
+	return byte(field<<3 | wireType)
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = append(b, fieldKey(field, wireLengthDelimited))
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	return append(b, buf...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return append(b, buf...)
+}
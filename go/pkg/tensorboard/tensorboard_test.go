@@ -0,0 +1,59 @@
+package tensorboard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, data []byte) [][]byte {
+	records := [][]byte{}
+	for len(data) > 0 {
+		require.True(t, len(data) >= 12)
+		length := binary.LittleEndian.Uint64(data[:8])
+		require.Equal(t, maskedCRC(data[:8]), binary.LittleEndian.Uint32(data[8:12]))
+		record := data[12 : 12+length]
+		require.Equal(t, maskedCRC(record), binary.LittleEndian.Uint32(data[12+length:16+length]))
+		records = append(records, record)
+		data = data[16+length:]
+	}
+	return records
+}
+
+func TestCRC32C(t *testing.T) {
+	require.Equal(t, uint32(0xe3069283), crc32.Checksum([]byte("123456789"), crc32c))
+}
+
+func TestEventWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	wallTime := time.Unix(10, 0)
+	ew, err := NewEventWriter(buf, wallTime)
+	require.NoError(t, err)
+	require.NoError(t, ew.WriteScalar("loss", 5, wallTime, 0.5))
+
+	records := readRecords(t, buf.Bytes())
+	require.Len(t, records, 2)
+
+	require.Equal(t, []byte{
+		0x09, 0, 0, 0, 0, 0, 0, 0x24, 0x40, // wall_time: 10.0
+		0x10, 0, // step: 0
+		0x1a, 13, 'b', 'r', 'a', 'i', 'n', '.', 'E', 'v', 'e', 'n', 't', ':', '2', // file_version
+	}, records[0])
+
+	require.Equal(t, []byte{
+		0x09, 0, 0, 0, 0, 0, 0, 0x24, 0x40, // wall_time: 10.0
+		0x10, 5, // step: 5
+		0x2a, 13, // summary
+		0x0a, 11, // value
+		0x0a, 4, 'l', 'o', 's', 's', // tag
+		0x15, 0, 0, 0, 0x3f, // simple_value: 0.5
+	}, records[1])
+}
+
+func TestAppendVarint(t *testing.T) {
+	require.Equal(t, []byte{0xac, 0x02}, appendVarint(nil, 300))
+}
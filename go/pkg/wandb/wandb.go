@@ -0,0 +1,409 @@
+// Package wandb is a client for the parts of the Weights & Biases API that
+// are needed to import runs.
+package wandb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the URL of the W&B API, which can be overridden with
+// $WANDB_BASE_URL for self-hosted W&B
+const DefaultBaseURL = "https://api.wandb.ai"
+
+// pageSize is the number of runs fetched in each request
+const pageSize = 50
+
+// historyPageSize is the number of steps of a run's history fetched in each
+// request
+const historyPageSize = 1000
+
+// Run is a W&B run
+type Run struct {
+	// Name is the ID of the run, which is unique in its project
+	Name        string
+	DisplayName string
+	User        string
+	State       string
+	Created     time.Time
+	// Config is the run's config, with W&B's internal keys removed
+	Config map[string]json.RawMessage
+	// LastStep is the step of the last row in the run's history, or -1 if
+	// it doesn't have any history
+	LastStep int64
+	Files    []*File
+}
+
+// File is a file saved with a run
+type File struct {
+	Name      string
+	URL       string
+	SizeBytes int64
+}
+
+// Client is a W&B API client
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewClient returns a client that authenticates with apiKey
+func NewClient(baseURL string, apiKey string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// NewClientFromEnvironment returns a client configured the same way as the
+// wandb command-line tool: the API key comes from $WANDB_API_KEY, or from
+// ~/.netrc where `wandb login` saves it.
+func NewClientFromEnvironment() (*Client, error) {
+	baseURL := os.Getenv("WANDB_BASE_URL")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	apiKey := os.Getenv("WANDB_API_KEY")
+	if apiKey == "" {
+		host := strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://")
+		var err error
+		apiKey, err = apiKeyFromNetrc(host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("Could not find a W&B API key. Set $WANDB_API_KEY or run 'wandb login'")
+	}
+	return NewClient(baseURL, apiKey), nil
+}
+
+const runsQuery = `
+query Runs($entity: String!, $project: String!, $first: Int!, $cursor: String) {
+  project(name: $project, entityName: $entity) {
+    runs(first: $first, after: $cursor) {
+      edges {
+        node {
+          name
+          displayName
+          state
+          createdAt
+          config
+          user { username }
+          historyKeys
+          files { edges { node { name directUrl sizeBytes } } }
+        }
+      }
+      pageInfo { endCursor hasNextPage }
+    }
+  }
+}`
+
+type runsResponse struct {
+	Project *struct {
+		Runs struct {
+			Edges []struct {
+				Node runNode `json:"node"`
+			} `json:"edges"`
+			PageInfo struct {
+				EndCursor   string `json:"endCursor"`
+				HasNextPage bool   `json:"hasNextPage"`
+			} `json:"pageInfo"`
+		} `json:"runs"`
+	} `json:"project"`
+}
+
+type runNode struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	State       string `json:"state"`
+	CreatedAt   string `json:"createdAt"`
+	Config      string `json:"config"`
+	HistoryKeys *struct {
+		LastStep *int64 `json:"lastStep"`
+	} `json:"historyKeys"`
+	User *struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Files struct {
+		Edges []struct {
+			Node struct {
+				Name      string `json:"name"`
+				DirectURL string `json:"directUrl"`
+				SizeBytes int64  `json:"sizeBytes"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"files"`
+}
+
+// ListRuns returns all of the runs in a project
+func (c *Client) ListRuns(entity string, project string) ([]*Run, error) {
+	runs := []*Run{}
+	var cursor *string
+	for {
+		resp := new(runsResponse)
+		err := c.query(runsQuery, map[string]interface{}{
+			"entity":  entity,
+			"project": project,
+			"first":   pageSize,
+			"cursor":  cursor,
+		}, resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Project == nil {
+			return nil, fmt.Errorf("W&B project %s/%s does not exist", entity, project)
+		}
+		for _, edge := range resp.Project.Runs.Edges {
+			run, err := parseRun(&edge.Node)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse W&B run %s: %w", edge.Node.Name, err)
+			}
+			runs = append(runs, run)
+		}
+		if !resp.Project.Runs.PageInfo.HasNextPage {
+			return runs, nil
+		}
+		endCursor := resp.Project.Runs.PageInfo.EndCursor
+		cursor = &endCursor
+	}
+}
+
+const historyQuery = `
+query History($entity: String!, $project: String!, $run: String!, $minStep: Int64!, $maxStep: Int64!, $samples: Int!) {
+  project(name: $project, entityName: $entity) {
+    run(name: $run) {
+      history(minStep: $minStep, maxStep: $maxStep, samples: $samples)
+    }
+  }
+}`
+
+type historyResponse struct {
+	Project *struct {
+		Run *struct {
+			History []string `json:"history"`
+		} `json:"run"`
+	} `json:"project"`
+}
+
+// History returns a row for each time wandb.log() was called in a run. Each
+// row has a "_step" and "_timestamp" key, as well as the logged values.
+//
+// W&B samples history when more rows are asked for than fit in a request, so
+// it is fetched a range of steps at a time, with no more steps in each range
+// than rows in a request.
+func (c *Client) History(entity string, project string, run *Run) ([]map[string]json.RawMessage, error) {
+	rows := []map[string]json.RawMessage{}
+	for minStep := int64(0); minStep <= run.LastStep; minStep += historyPageSize {
+		resp := new(historyResponse)
+		err := c.query(historyQuery, map[string]interface{}{
+			"entity":  entity,
+			"project": project,
+			"run":     run.Name,
+			"minStep": minStep,
+			"maxStep": minStep + historyPageSize,
+			"samples": historyPageSize,
+		}, resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Project == nil || resp.Project.Run == nil {
+			return nil, fmt.Errorf("W&B run %s/%s/%s does not exist", entity, project, run.Name)
+		}
+		for _, line := range resp.Project.Run.History {
+			row := map[string]json.RawMessage{}
+			if err := json.Unmarshal([]byte(line), &row); err != nil {
+				return nil, fmt.Errorf("Failed to parse history of W&B run %s: %w", run.Name, err)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// DownloadFile downloads a run's file to localPath
+func (c *Client) DownloadFile(file *File, localPath string) error {
+	resp, err := c.httpClient.Get(file.URL)
+	if err != nil {
+		return fmt.Errorf("Failed to download %s: %w", file.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to download %s: server returned %s", file.Name, resp.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("Failed to download %s: %w", file.Name, err)
+	}
+	return f.Close()
+}
+
+func (c *Client) query(query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.baseURL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("api", c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to connect to W&B API: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Failed to read response from W&B API: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("W&B API key is not valid. Set $WANDB_API_KEY or run 'wandb login'")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("W&B API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	graphqlResp := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if err := json.Unmarshal(data, &graphqlResp); err != nil {
+		return fmt.Errorf("Failed to parse response from W&B API: %w", err)
+	}
+	if len(graphqlResp.Errors) > 0 {
+		return fmt.Errorf("W&B API returned an error: %s", graphqlResp.Errors[0].Message)
+	}
+	return json.Unmarshal(graphqlResp.Data, result)
+}
+
+func parseRun(node *runNode) (*Run, error) {
+	run := &Run{
+		Name:        node.Name,
+		DisplayName: node.DisplayName,
+		State:       node.State,
+		Config:      map[string]json.RawMessage{},
+		LastStep:    -1,
+		Files:       []*File{},
+	}
+	if node.User != nil {
+		run.User = node.User.Username
+	}
+	if node.HistoryKeys != nil && node.HistoryKeys.LastStep != nil {
+		run.LastStep = *node.HistoryKeys.LastStep
+	}
+
+	created, err := parseTime(node.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.Created = created
+
+	// Config values are wrapped like {"lr": {"value": 0.01, "desc": null}}
+	if node.Config != "" {
+		config := map[string]struct {
+			Value json.RawMessage `json:"value"`
+		}{}
+		if err := json.Unmarshal([]byte(node.Config), &config); err != nil {
+			return nil, fmt.Errorf("Failed to parse config: %w", err)
+		}
+		for key, value := range config {
+			if strings.HasPrefix(key, "_wandb") || value.Value == nil {
+				continue
+			}
+			run.Config[key] = value.Value
+		}
+	}
+
+	for _, edge := range node.Files.Edges {
+		run.Files = append(run.Files, &File{
+			Name:      edge.Node.Name,
+			URL:       edge.Node.DirectURL,
+			SizeBytes: edge.Node.SizeBytes,
+		})
+	}
+	return run, nil
+}
+
+// parseTime parses a time from the W&B API, which are in UTC but don't
+// always have a timezone
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time: %q", s)
+}
+
+// apiKeyFromNetrc returns the password for host in ~/.netrc, or an empty
+// string if there isn't one
+func apiKeyFromNetrc(host string) (string, error) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanWords)
+	words := []string{}
+	for scanner.Scan() {
+		words = append(words, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+
+	inMachine := false
+	for i := 0; i < len(words)-1; i++ {
+		switch words[i] {
+		case "machine":
+			inMachine = words[i+1] == host
+			i++
+		case "default":
+			inMachine = false
+		case "password":
+			if inMachine {
+				return words[i+1], nil
+			}
+			i++
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,165 @@
+package wandb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListRuns(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/output.log" {
+			w.Write([]byte("hello"))
+			return
+		}
+		require.Equal(t, "/graphql", r.URL.Path)
+		user, password, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "api", user)
+		require.Equal(t, "secret", password)
+
+		body := struct {
+			Variables map[string]interface{} `json:"variables"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "my-team", body.Variables["entity"])
+		require.Equal(t, "my-project", body.Variables["project"])
+
+		requests++
+		name, hasNextPage := "abc123", true
+		if requests == 2 {
+			require.Equal(t, "cursor-1", body.Variables["cursor"])
+			name, hasNextPage = "def456", false
+		}
+		node := map[string]interface{}{
+			"name":        name,
+			"displayName": "swift-river-1",
+			"state":       "finished",
+			"createdAt":   "2020-10-01T12:00:00",
+			"config":      `{"lr": {"value": 0.01, "desc": null}, "_wandb": {"value": {}}}`,
+			"user":        map[string]string{"username": "andreas"},
+			"historyKeys": map[string]interface{}{"lastStep": 1500},
+			"files": map[string]interface{}{"edges": []interface{}{
+				map[string]interface{}{"node": map[string]interface{}{"name": "output.log", "directUrl": "http://" + r.Host + "/files/output.log", "sizeBytes": 5}},
+			}},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"project": map[string]interface{}{
+					"runs": map[string]interface{}{
+						"edges":    []interface{}{map[string]interface{}{"node": node}},
+						"pageInfo": map[string]interface{}{"endCursor": "cursor-1", "hasNextPage": hasNextPage},
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret")
+	runs, err := client.ListRuns("my-team", "my-project")
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, "abc123", runs[0].Name)
+	require.Equal(t, "def456", runs[1].Name)
+
+	run := runs[0]
+	require.Equal(t, "andreas", run.User)
+	require.Equal(t, time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC), run.Created)
+	require.Equal(t, map[string]json.RawMessage{"lr": json.RawMessage("0.01")}, run.Config)
+	require.Equal(t, int64(1500), run.LastStep)
+
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.Len(t, run.Files, 1)
+	require.NoError(t, client.DownloadFile(run.Files[0], filepath.Join(dir, "output.log")))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "output.log"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+}
+
+func TestHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Variables map[string]interface{} `json:"variables"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "abc123", body.Variables["run"])
+		minStep := int(body.Variables["minStep"].(float64))
+		maxStep := int(body.Variables["maxStep"].(float64))
+		require.Equal(t, minStep+historyPageSize, maxStep)
+
+		// A row every 100 steps, up to step 1500
+		history := []string{}
+		for step := minStep; step < maxStep && step <= 1500; step++ {
+			if step%100 == 0 {
+				history = append(history, fmt.Sprintf(`{"_step": %d, "loss": 0.5}`, step))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"project": map[string]interface{}{
+					"run": map[string]interface{}{"history": history},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret")
+	rows, err := client.History("my-team", "my-project", &Run{Name: "abc123", LastStep: 1500})
+	require.NoError(t, err)
+	require.Len(t, rows, 16)
+	require.Equal(t, json.RawMessage("0"), rows[0]["_step"])
+	require.Equal(t, json.RawMessage("1500"), rows[15]["_step"])
+
+	// Runs without any history don't make any requests
+	rows, err = NewClient("http://localhost:0", "secret").History("my-team", "my-project", &Run{Name: "abc123", LastStep: -1})
+	require.NoError(t, err)
+	require.Empty(t, rows)
+}
+
+func TestListRunsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"project": null}, "errors": [{"message": "permission denied"}]}`))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "secret").ListRuns("my-team", "my-project")
+	require.EqualError(t, err, "W&B API returned an error: permission denied")
+}
+
+func TestAPIKeyFromNetrc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replicate-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	netrc := filepath.Join(dir, ".netrc")
+	require.NoError(t, ioutil.WriteFile(netrc, []byte(`machine example.com
+  login foo
+  password bar
+machine api.wandb.ai
+  login user
+  password secret
+`), 0600))
+	os.Setenv("NETRC", netrc)
+	defer os.Unsetenv("NETRC")
+
+	key, err := apiKeyFromNetrc("api.wandb.ai")
+	require.NoError(t, err)
+	require.Equal(t, "secret", key)
+
+	key, err = apiKeyFromNetrc("wandb.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "", key)
+}
@@ -46,6 +46,9 @@ class Checkpoint(object):
 
     def __post_init__(self):
         self._experiment: Optional["Experiment"] = None
+        # Metadata that the daemon records when the checkpoint is created,
+        # such as references to files in earlier checkpoints
+        self._daemon_fields: Any = None
 
     def short_id(self) -> str:
         return self.id[:7]
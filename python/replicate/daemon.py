@@ -4,7 +4,8 @@
 import functools
 import tempfile
 import os
-from typing import Optional, Dict, Any, List
+import datetime
+from typing import Optional, Dict, Any, List, Tuple
 import subprocess
 import atexit
 import sys
@@ -51,12 +52,26 @@ def handle_exception(code, details):
         return exceptions.WriteError(details)
     if code == "REPOSITORY_CONFIGURATION_ERROR":
         return exceptions.RepositoryConfigurationError(details)
+    if code == "REPOSITORY_CREDENTIALS_ERROR":
+        return exceptions.RepositoryCredentialsError(details)
     if code == "INCOMPATIBLE_REPOSITORY_VERSION":
         return exceptions.IncompatibleRepositoryVersion(details)
     if code == "CORRUPTED_REPOSITORY_SPEC":
         return exceptions.CorruptedRepositorySpec(details)
     if code == "CONFIG_NOT_FOUND":
         return exceptions.ConfigNotFound(details)
+    if code == "UNREACHABLE":
+        return exceptions.RepositoryUnreachable(details)
+    if code == "TIMED_OUT":
+        return exceptions.RepositoryTimeout(details)
+    if code == "INTERRUPTED":
+        return exceptions.RepositoryInterrupted(details)
+    if code == "QUOTA_EXCEEDED":
+        return exceptions.QuotaExceeded(details)
+    if code == "PERMISSION_DENIED":
+        return exceptions.RepositoryPermissionDenied(details)
+    if code == "TRANSIENT":
+        return exceptions.RepositoryTransientError(details)
 
 
 def get_status_code(e, details):
@@ -140,6 +155,7 @@ class Daemon:
         self,
         path: Optional[str],
         params: Optional[Dict[str, Any]],
+        name: Optional[str],
         command: Optional[str],
         python_packages: Dict[str, str],
         python_version: str,
@@ -158,6 +174,7 @@ class Daemon:
                 experiment=pb_experiment,
                 disableHeartbeat=disable_hearbeat,
                 quiet=quiet,
+                name=name,
             ),
         )
         return pb_convert.experiment_from_pb(self.project, ret.experiment)
@@ -180,7 +197,9 @@ class Daemon:
             step=step,
         )
         ret = self.stub.CreateCheckpoint(
-            pb.CreateCheckpointRequest(checkpoint=pb_checkpoint, quiet=quiet)
+            pb.CreateCheckpointRequest(
+                checkpoint=pb_checkpoint, quiet=quiet, experimentID=experiment.id
+            )
         )
         return pb_convert.checkpoint_from_pb(experiment, ret.checkpoint)
 
@@ -189,14 +208,33 @@ class Daemon:
         self, experiment: Experiment, quiet: bool,
     ):
         pb_experiment = pb_convert.experiment_to_pb(experiment)
-        return self.stub.SaveExperiment(
+        ret = self.stub.SaveExperiment(
             pb.SaveExperimentRequest(experiment=pb_experiment, quiet=quiet)
         )
+        # Saving can record more metadata, like the alerts that new
+        # checkpoints triggered
+        experiment._daemon_fields = pb_convert.daemon_fields(
+            ret.experiment, pb_convert.DAEMON_EXPERIMENT_FIELDS
+        )
+        return ret
 
     @handle_error
     def stop_experiment(self, experiment_id: str):
         self.stub.StopExperiment(pb.StopExperimentRequest(experimentID=experiment_id))
 
+    @handle_error
+    def log_metrics(
+        self,
+        experiment_id: str,
+        logged_metrics: List[Tuple[int, datetime.datetime, Dict[str, float]]],
+    ):
+        self.stub.LogMetrics(
+            pb.LogMetricsRequest(
+                experimentID=experiment_id,
+                metrics=pb_convert.logged_metrics_to_pb(logged_metrics),
+            )
+        )
+
     @handle_error
     def get_experiment(self, experiment_id_prefix: str) -> Experiment:
         ret = self.stub.GetExperiment(
@@ -17,6 +17,10 @@ class RepositoryConfigurationError(Exception):
     pass
 
 
+class RepositoryCredentialsError(RepositoryConfigurationError):
+    pass
+
+
 class IncompatibleRepositoryVersion(Exception):
     pass
 
@@ -27,3 +31,27 @@ class CorruptedRepositorySpec(Exception):
 
 class ConfigNotFound(Exception):
     pass
+
+
+class RepositoryUnreachable(ReadError):
+    pass
+
+
+class RepositoryTimeout(Exception):
+    pass
+
+
+class RepositoryInterrupted(Exception):
+    pass
+
+
+class QuotaExceeded(WriteError):
+    pass
+
+
+class RepositoryPermissionDenied(ReadError, WriteError):
+    pass
+
+
+class RepositoryTransientError(ReadError, WriteError):
+    pass
@@ -13,6 +13,7 @@ import datetime
 import json
 import shlex
 import sys
+import time
 from typing import (
     Dict,
     Any,
@@ -39,6 +40,9 @@ from .version import version
 if TYPE_CHECKING:
     from .project import Project
 
+# How often metrics logged with log_metrics() are sent to the daemon
+METRICS_SEND_INTERVAL = 10
+
 
 @dataclass
 class Experiment:
@@ -50,6 +54,7 @@ class Experiment:
 
     id: str
     created: datetime.datetime
+    name: Optional[str] = None
     user: Optional[str] = None
     host: Optional[str] = None
     command: Optional[str] = None
@@ -64,6 +69,15 @@ class Experiment:
     def __post_init__(self, project: "Project"):
         self._project = project
         self._step = -1
+        # Metadata that the daemon records when the experiment is created,
+        # such as DVC outputs and dataset fingerprints. It is sent back
+        # unchanged each time the experiment is saved.
+        self._daemon_fields: Any = None
+        # Metrics logged with log_metrics() that haven't been sent to the
+        # daemon yet, as (step, timestamp, metrics) tuples
+        self._logged_metrics: List[Tuple[int, datetime.datetime, Dict[str, float]]] = []
+        self._logged_metrics_sent = time.time()
+        self._metrics_step = -1
 
     def short_id(self):
         return self.id[:7]
@@ -131,6 +145,7 @@ class Experiment:
         # Remember the current step
         self._step = step
 
+        self._send_logged_metrics()
         checkpoint = self._project._daemon().create_checkpoint(
             experiment=self,
             path=path,
@@ -143,6 +158,34 @@ class Experiment:
         self.save(quiet=quiet)
         return checkpoint
 
+    @console.catch_and_print_exceptions(msg="Error logging metrics")
+    def log_metrics(self, metrics: Dict[str, float], step: Optional[int] = None):
+        """
+        Record the value of metrics at a step, without creating a checkpoint.
+
+        This is cheap enough to call for every batch. The metrics are saved in a series apart from the experiment's metadata, every few seconds and when a checkpoint is created or the experiment is stopped.
+        """
+        # Auto-increment step if not provided
+        if step is None:
+            step = self._metrics_step + 1
+        self._metrics_step = step
+
+        self._logged_metrics.append(
+            (
+                step,
+                datetime.datetime.now(datetime.timezone.utc),
+                {name: float(value) for name, value in metrics.items()},
+            )
+        )
+        if time.time() - self._logged_metrics_sent >= METRICS_SEND_INTERVAL:
+            self._send_logged_metrics()
+
+    def _send_logged_metrics(self):
+        if self._logged_metrics:
+            self._project._daemon().log_metrics(self.id, self._logged_metrics)
+            self._logged_metrics = []
+        self._logged_metrics_sent = time.time()
+
     def save(self, quiet: bool):
         """
         Save this experiment's metadata to repository.
@@ -160,12 +203,14 @@ class Experiment:
             if field.name != "project":
                 value = getattr(exp, field.name)
                 setattr(self, field.name, value)
+        self._daemon_fields = exp._daemon_fields
         for chk in self.checkpoints:
             chk._experiment = self
 
     def to_json(self) -> Dict[str, Any]:
         return {
             "id": self.id,
+            "name": self.name,
             "created": rfc3339_datetime(self.created),
             "params": self.params,
             "user": self.user,
@@ -186,6 +231,7 @@ class Experiment:
         Experiments running in a script will eventually timeout, but when running in a notebook,
         you are required to call this method to mark an experiment as stopped.
         """
+        self._send_logged_metrics()
         self._project._daemon().stop_experiment(self.id)
 
     def delete(self):
@@ -364,12 +410,13 @@ class ExperimentCollection:
     project: "Project"
 
     def create(
-        self, path=None, params=None, quiet=False, disable_heartbeat=False
+        self, path=None, params=None, quiet=False, disable_heartbeat=False, name=None
     ) -> Experiment:
         command = " ".join(map(shlex.quote, sys.argv))
         return self.project._daemon().create_experiment(
             path=path,
             params=params,
+            name=name,
             command=command,
             python_version=get_python_version(),
             python_packages=get_imported_packages(),
@@ -1,6 +1,6 @@
 import datetime
 import json
-from typing import List, Dict, Any, Optional, MutableMapping
+from typing import List, Dict, Any, Optional, MutableMapping, Tuple
 
 from google.protobuf import timestamp_pb2
 
@@ -32,6 +32,39 @@ def _is_torch_tensor(obj):
     return (obj.__class__.__module__, obj.__class__.__name__) == ("torch", "Tensor")
 
 
+# Fields that the daemon records on experiments and checkpoints, but this
+# library doesn't use. They are kept as they are, and sent back to the daemon
+# each time an experiment is saved, so the daemon doesn't need to remember them.
+DAEMON_EXPERIMENT_FIELDS = {
+    "dvcOutputs",
+    "datasets",
+    "environment",
+    "seeds",
+    "hostEnvironment",
+    "sweep",
+    "storagePath",
+    "alerts",
+}
+DAEMON_CHECKPOINT_FIELDS = {
+    "references",
+    "chunkedFiles",
+    "storagePath",
+    "referencedStoragePaths",
+}
+
+
+def daemon_fields(message, names):
+    """
+    Returns a copy of the protobuf message with only the fields in names set.
+    """
+    kept = type(message)()
+    kept.CopyFrom(message)
+    for field, _ in kept.ListFields():
+        if field.name not in names:
+            kept.ClearField(field.name)
+    return kept
+
+
 def timestamp_from_pb(t: timestamp_pb2.Timestamp) -> datetime.datetime:
     return datetime.datetime.fromtimestamp(t.seconds + t.nanos / 1e9)
 
@@ -56,6 +89,7 @@ def checkpoint_from_pb(experiment: Experiment, chk_pb: pb.Checkpoint) -> Checkpo
         primary_metric=primary_metric_from_pb(chk_pb.primaryMetric),
     )
     chk._experiment = experiment
+    chk._daemon_fields = daemon_fields(chk_pb, DAEMON_CHECKPOINT_FIELDS)
     return chk
 
 
@@ -73,6 +107,7 @@ def experiment_from_pb(project, exp_pb: pb.Experiment) -> Experiment:
         project=project,
         id=exp_pb.id,
         created=timestamp_from_pb(exp_pb.created),
+        name=noneable(exp_pb.name),
         user=noneable(exp_pb.user),
         host=noneable(exp_pb.host),
         command=noneable(exp_pb.command),
@@ -84,6 +119,7 @@ def experiment_from_pb(project, exp_pb: pb.Experiment) -> Experiment:
         replicate_version=noneable(exp_pb.replicateVersion),
     )
     exp.checkpoints = checkpoints_from_pb(exp, exp_pb.checkpoints)
+    exp._daemon_fields = daemon_fields(exp_pb, DAEMON_EXPERIMENT_FIELDS)
     return exp
 
 
@@ -135,9 +171,10 @@ def timestamp_to_pb(t: datetime.datetime) -> timestamp_pb2.Timestamp:
 
 
 def experiment_to_pb(exp: Experiment) -> pb.Experiment:
-    return pb.Experiment(
+    exp_pb = pb.Experiment(
         id=exp.id,
         created=timestamp_to_pb(exp.created),
+        name=exp.name,
         user=exp.user,
         host=exp.host,
         command=exp.command,
@@ -149,6 +186,18 @@ def experiment_to_pb(exp: Experiment) -> pb.Experiment:
         replicateVersion=exp.replicate_version,
         checkpoints=checkpoints_to_pb(exp.checkpoints),
     )
+    if exp._daemon_fields is not None:
+        exp_pb.MergeFrom(exp._daemon_fields)
+    return exp_pb
+
+
+def logged_metrics_to_pb(
+    logged_metrics: List[Tuple[int, datetime.datetime, Dict[str, float]]]
+) -> List[pb.LoggedMetrics]:
+    return [
+        pb.LoggedMetrics(step=step, timestamp=timestamp_to_pb(t), values=values)
+        for step, t, values in logged_metrics
+    ]
 
 
 def config_to_pb(conf: Optional[Dict[str, Any]]) -> Optional[pb.Config]:
@@ -166,7 +215,7 @@ def checkpoints_to_pb(
 
 
 def checkpoint_to_pb(chk: Checkpoint) -> pb.Checkpoint:
-    return pb.Checkpoint(
+    chk_pb = pb.Checkpoint(
         id=chk.id,
         created=timestamp_to_pb(chk.created),
         path=chk.path,
@@ -174,6 +223,9 @@ def checkpoint_to_pb(chk: Checkpoint) -> pb.Checkpoint:
         metrics=value_map_to_pb(chk.metrics),
         primaryMetric=primary_metric_to_pb(chk.primary_metric),
     )
+    if chk._daemon_fields is not None:
+        chk_pb.MergeFrom(chk._daemon_fields)
+    return chk_pb
 
 
 def value_map_to_pb(m: Optional[Dict[str, Any]]) -> Optional[Dict[str, pb.ParamType]]:
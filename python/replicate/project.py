@@ -64,11 +64,12 @@ def init(
     params: Optional[Dict[str, Any]] = None,
     disable_heartbeat: bool = False,
     debug: bool = False,
+    name: Optional[str] = None,
 ) -> Experiment:
     """
     Create a new experiment.
     """
     project = Project(debug=debug)
     return project.experiments.create(
-        path=path, params=params, disable_heartbeat=disable_heartbeat
+        path=path, params=params, name=name, disable_heartbeat=disable_heartbeat
     )
@@ -20,7 +20,7 @@ DESCRIPTOR = _descriptor.FileDescriptor(
   syntax='proto3',
   serialized_options=b'Z/github.com/replicate/replicate/go/pkg/servicepb',
   create_key=_descriptor._internal_create_key,
-  serialized_pb=b'\n\x0freplicate.proto\x12\x07service\x1a\x1fgoogle/protobuf/timestamp.proto\"k\n\x17\x43reateExperimentRequest\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\x12\x18\n\x10\x64isableHeartbeat\x18\x02 \x01(\x08\x12\r\n\x05quiet\x18\x03 \x01(\x08\"@\n\x15\x43reateExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"Q\n\x17\x43reateCheckpointRequest\x12\'\n\ncheckpoint\x18\x01 \x01(\x0b\x32\x13.service.Checkpoint\x12\r\n\x05quiet\x18\x02 \x01(\x08\"@\n\x15\x43reateCheckpointReply\x12\'\n\ncheckpoint\x18\x01 \x01(\x0b\x32\x13.service.Checkpoint\"O\n\x15SaveExperimentRequest\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\x12\r\n\x05quiet\x18\x02 \x01(\x08\">\n\x13SaveExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"-\n\x15StopExperimentRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"\x15\n\x13StopExperimentReply\"2\n\x14GetExperimentRequest\x12\x1a\n\x12\x65xperimentIDPrefix\x18\x01 \x01(\t\"=\n\x12GetExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"\x18\n\x16ListExperimentsRequest\"@\n\x14ListExperimentsReply\x12(\n\x0b\x65xperiments\x18\x01 \x03(\x0b\x32\x13.service.Experiment\"/\n\x17\x44\x65leteExperimentRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"\x17\n\x15\x44\x65leteExperimentReply\"_\n\x19\x43heckoutCheckpointRequest\x12\x1a\n\x12\x63heckpointIDPrefix\x18\x01 \x01(\t\x12\x17\n\x0foutputDirectory\x18\x02 \x01(\t\x12\r\n\x05quiet\x18\x03 \x01(\x08\"\x19\n\x17\x43heckoutCheckpointReply\"2\n\x1aGetExperimentStatusRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"x\n\x18GetExperimentStatusReply\x12\x38\n\x06status\x18\x01 \x01(\x0e\x32(.service.GetExperimentStatusReply.Status\"\"\n\x06Status\x12\x0b\n\x07RUNNING\x10\x00\x12\x0b\n\x07STOPPED\x10\x01\"\xe8\x03\n\nExperiment\x12\n\n\x02id\x18\x01 \x01(\t\x12+\n\x07\x63reated\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12/\n\x06params\x18\x03 \x03(\x0b\x32\x1f.service.Experiment.ParamsEntry\x12\x0c\n\x04host\x18\x04 \x01(\t\x12\x0c\n\x04user\x18\x05 \x01(\t\x12\x1f\n\x06\x63onfig\x18\x06 \x01(\x0b\x32\x0f.service.Config\x12\x0f\n\x07\x63ommand\x18\x07 \x01(\t\x12\x0c\n\x04path\x18\x08 \x01(\t\x12?\n\x0epythonPackages\x18\t \x03(\x0b\x32\'.service.Experiment.PythonPackagesEntry\x12\x15\n\rpythonVersion\x18\n \x01(\t\x12(\n\x0b\x63heckpoints\x18\x0b \x03(\x0b\x32\x13.service.Checkpoint\x12\x18\n\x10replicateVersion\x18\x0c \x01(\t\x1a\x41\n\x0bParamsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12!\n\x05value\x18\x02 \x01(\x0b\x32\x12.service.ParamType:\x02\x38\x01\x1a\x35\n\x13PythonPackagesEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"-\n\x06\x43onfig\x12\x12\n\nrepository\x18\x01 \x01(\t\x12\x0f\n\x07storage\x18\x02 \x01(\t\"\x87\x02\n\nCheckpoint\x12\n\n\x02id\x18\x01 \x01(\t\x12+\n\x07\x63reated\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x31\n\x07metrics\x18\x03 \x03(\x0b\x32 .service.Checkpoint.MetricsEntry\x12\x0c\n\x04step\x18\x04 \x01(\x03\x12\x0c\n\x04path\x18\x05 \x01(\t\x12-\n\rprimaryMetric\x18\x06 \x01(\x0b\x32\x16.service.PrimaryMetric\x1a\x42\n\x0cMetricsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12!\n\x05value\x18\x02 \x01(\x0b\x32\x12.service.ParamType:\x02\x38\x01\"l\n\rPrimaryMetric\x12\x0c\n\x04name\x18\x01 \x01(\t\x12)\n\x04goal\x18\x02 \x01(\x0e\x32\x1b.service.PrimaryMetric.Goal\"\"\n\x04Goal\x12\x0c\n\x08MAXIMIZE\x10\x00\x12\x0c\n\x08MINIMIZE\x10\x01\"\x85\x01\n\tParamType\x12\x13\n\tboolValue\x18\x01 \x01(\x08H\x00\x12\x12\n\x08intValue\x18\x02 \x01(\x03H\x00\x12\x14\n\nfloatValue\x18\x03 \x01(\x01H\x00\x12\x15\n\x0bstringValue\x18\x04 \x01(\tH\x00\x12\x19\n\x0fobjectValueJson\x18\x05 \x01(\tH\x00\x42\x07\n\x05value2\x97\x06\n\x06\x44\x61\x65mon\x12V\n\x10\x43reateExperiment\x12 .service.CreateExperimentRequest\x1a\x1e.service.CreateExperimentReply\"\x00\x12V\n\x10\x43reateCheckpoint\x12 .service.CreateCheckpointRequest\x1a\x1e.service.CreateCheckpointReply\"\x00\x12P\n\x0eSaveExperiment\x12\x1e.service.SaveExperimentRequest\x1a\x1c.service.SaveExperimentReply\"\x00\x12P\n\x0eStopExperiment\x12\x1e.service.StopExperimentRequest\x1a\x1c.service.StopExperimentReply\"\x00\x12M\n\rGetExperiment\x12\x1d.service.GetExperimentRequest\x1a\x1b.service.GetExperimentReply\"\x00\x12S\n\x0fListExperiments\x12\x1f.service.ListExperimentsRequest\x1a\x1d.service.ListExperimentsReply\"\x00\x12V\n\x10\x44\x65leteExperiment\x12 .service.DeleteExperimentRequest\x1a\x1e.service.DeleteExperimentReply\"\x00\x12\\\n\x12\x43heckoutCheckpoint\x12\".service.CheckoutCheckpointRequest\x1a .service.CheckoutCheckpointReply\"\x00\x12_\n\x13GetExperimentStatus\x12#.service.GetExperimentStatusRequest\x1a!.service.GetExperimentStatusReply\"\x00\x42\x31Z/github.com/replicate/replicate/go/pkg/servicepbb\x06proto3'
+  serialized_pb=b'\n\x0freplicate.proto\x12\x07service\x1a\x1fgoogle/protobuf/timestamp.proto\"y\n\x17\x43reateExperimentRequest\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\x12\x18\n\x10\x64isableHeartbeat\x18\x02 \x01(\x08\x12\r\n\x05quiet\x18\x03 \x01(\x08\x12\x0c\n\x04name\x18\x04 \x01(\t\"@\n\x15\x43reateExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"g\n\x17\x43reateCheckpointRequest\x12\'\n\ncheckpoint\x18\x01 \x01(\x0b\x32\x13.service.Checkpoint\x12\r\n\x05quiet\x18\x02 \x01(\x08\x12\x14\n\x0c\x65xperimentID\x18\x03 \x01(\t\"@\n\x15\x43reateCheckpointReply\x12\'\n\ncheckpoint\x18\x01 \x01(\x0b\x32\x13.service.Checkpoint\"O\n\x15SaveExperimentRequest\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\x12\r\n\x05quiet\x18\x02 \x01(\x08\">\n\x13SaveExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"-\n\x15StopExperimentRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"\x15\n\x13StopExperimentReply\"2\n\x14GetExperimentRequest\x12\x1a\n\x12\x65xperimentIDPrefix\x18\x01 \x01(\t\"=\n\x12GetExperimentReply\x12\'\n\nexperiment\x18\x01 \x01(\x0b\x32\x13.service.Experiment\"\x18\n\x16ListExperimentsRequest\"@\n\x14ListExperimentsReply\x12(\n\x0b\x65xperiments\x18\x01 \x03(\x0b\x32\x13.service.Experiment\"/\n\x17\x44\x65leteExperimentRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"\x17\n\x15\x44\x65leteExperimentReply\"_\n\x19\x43heckoutCheckpointRequest\x12\x1a\n\x12\x63heckpointIDPrefix\x18\x01 \x01(\t\x12\x17\n\x0foutputDirectory\x18\x02 \x01(\t\x12\r\n\x05quiet\x18\x03 \x01(\x08\"\x19\n\x17\x43heckoutCheckpointReply\"2\n\x1aGetExperimentStatusRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\"x\n\x18GetExperimentStatusReply\x12\x38\n\x06status\x18\x01 \x01(\x0e\x32(.service.GetExperimentStatusReply.Status\"\"\n\x06Status\x12\x0b\n\x07RUNNING\x10\x00\x12\x0b\n\x07STOPPED\x10\x01\"\xaa\x07\n\nExperiment\x12\n\n\x02id\x18\x01 \x01(\t\x12+\n\x07\x63reated\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12/\n\x06params\x18\x03 \x03(\x0b\x32\x1f.service.Experiment.ParamsEntry\x12\x0c\n\x04host\x18\x04 \x01(\t\x12\x0c\n\x04user\x18\x05 \x01(\t\x12\x1f\n\x06\x63onfig\x18\x06 \x01(\x0b\x32\x0f.service.Config\x12\x0f\n\x07\x63ommand\x18\x07 \x01(\t\x12\x0c\n\x04path\x18\x08 \x01(\t\x12?\n\x0epythonPackages\x18\t \x03(\x0b\x32\'.service.Experiment.PythonPackagesEntry\x12\x15\n\rpythonVersion\x18\n \x01(\t\x12(\n\x0b\x63heckpoints\x18\x0b \x03(\x0b\x32\x13.service.Checkpoint\x12\x18\n\x10replicateVersion\x18\x0c \x01(\t\x12\x0c\n\x04name\x18\r \x01(\t\x12&\n\ndvcOutputs\x18\x0e \x03(\x0b\x32\x12.service.DVCOutput\x12-\n\x08\x64\x61tasets\x18\x0f \x03(\x0b\x32\x1b.service.DatasetFingerprint\x12\x39\n\x0b\x65nvironment\x18\x10 \x03(\x0b\x32$.service.Experiment.EnvironmentEntry\x12-\n\x05seeds\x18\x11 \x03(\x0b\x32\x1e.service.Experiment.SeedsEntry\x12\x31\n\x0fhostEnvironment\x18\x12 \x01(\x0b\x32\x18.service.HostEnvironment\x12\'\n\x05sweep\x18\x13 \x01(\x0b\x32\x18.service.SweepMembership\x12\x13\n\x0bstoragePath\x18\x14 \x01(\t\x12\x1e\n\x06\x61lerts\x18\x15 \x03(\x0b\x32\x0e.service.Alert\x1a\x41\n\x0bParamsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12!\n\x05value\x18\x02 \x01(\x0b\x32\x12.service.ParamType:\x02\x38\x01\x1a\x35\n\x13PythonPackagesEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\x1a\x32\n\x10\x45nvironmentEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\x1a,\n\nSeedsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"-\n\x06\x43onfig\x12\x12\n\nrepository\x18\x01 \x01(\t\x12\x0f\n\x07storage\x18\x02 \x01(\t\"\xae\x04\n\nCheckpoint\x12\n\n\x02id\x18\x01 \x01(\t\x12+\n\x07\x63reated\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x31\n\x07metrics\x18\x03 \x03(\x0b\x32 .service.Checkpoint.MetricsEntry\x12\x0c\n\x04step\x18\x04 \x01(\x03\x12\x0c\n\x04path\x18\x05 \x01(\t\x12-\n\rprimaryMetric\x18\x06 \x01(\x0b\x32\x16.service.PrimaryMetric\x12\x37\n\nreferences\x18\x07 \x03(\x0b\x32#.service.Checkpoint.ReferencesEntry\x12\x14\n\x0c\x63hunkedFiles\x18\x08 \x03(\t\x12\x13\n\x0bstoragePath\x18\t \x01(\t\x12O\n\x16referencedStoragePaths\x18\n \x03(\x0b\x32/.service.Checkpoint.ReferencedStoragePathsEntry\x1a\x42\n\x0cMetricsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12!\n\x05value\x18\x02 \x01(\x0b\x32\x12.service.ParamType:\x02\x38\x01\x1a\x31\n\x0fReferencesEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\x1a=\n\x1bReferencedStoragePathsEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"l\n\rPrimaryMetric\x12\x0c\n\x04name\x18\x01 \x01(\t\x12)\n\x04goal\x18\x02 \x01(\x0e\x32\x1b.service.PrimaryMetric.Goal\"\"\n\x04Goal\x12\x0c\n\x08MAXIMIZE\x10\x00\x12\x0c\n\x08MINIMIZE\x10\x01\"\x85\x01\n\tParamType\x12\x13\n\tboolValue\x18\x01 \x01(\x08H\x00\x12\x12\n\x08intValue\x18\x02 \x01(\x03H\x00\x12\x14\n\nfloatValue\x18\x03 \x01(\x01H\x00\x12\x15\n\x0bstringValue\x18\x04 \x01(\tH\x00\x12\x19\n\x0fobjectValueJson\x18\x05 \x01(\tH\x00\x42\x07\n\x05value\"7\n\tDVCOutput\x12\x0c\n\x04path\x18\x01 \x01(\t\x12\x0b\n\x03md5\x18\x02 \x01(\t\x12\x0f\n\x07\x64vcFile\x18\x03 \x01(\t\"\x8d\x01\n\x12\x44\x61tasetFingerprint\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x0c\n\x04path\x18\x02 \x01(\t\x12\x0c\n\x04hash\x18\x03 \x01(\t\x12\x11\n\talgorithm\x18\x04 \x01(\t\x12\x0c\n\x04size\x18\x05 \x01(\x03\x12\r\n\x05\x66iles\x18\x06 \x01(\x03\x12\x0c\n\x04rows\x18\x07 \x01(\x03\x12\x0f\n\x07hasRows\x18\x08 \x01(\x08\"@\n\x0fHostEnvironment\x12\n\n\x02os\x18\x01 \x01(\t\x12\x0c\n\x04\x61rch\x18\x02 \x01(\t\x12\x13\n\x0b\x63udaVersion\x18\x03 \x01(\t\"*\n\x0fSweepMembership\x12\n\n\x02id\x18\x01 \x01(\t\x12\x0b\n\x03run\x18\x02 \x01(\x03\"k\n\x05\x41lert\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x0f\n\x07message\x18\x02 \x01(\t\x12\x14\n\x0c\x63heckpointID\x18\x03 \x01(\t\x12-\n\ttriggered\x18\x04 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\"R\n\x11LogMetricsRequest\x12\x14\n\x0c\x65xperimentID\x18\x01 \x01(\t\x12\'\n\x07metrics\x18\x02 \x03(\x0b\x32\x16.service.LoggedMetrics\"\x11\n\x0fLogMetricsReply\"\xaf\x01\n\rLoggedMetrics\x12\x0c\n\x04step\x18\x01 \x01(\x03\x12-\n\ttimestamp\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x32\n\x06values\x18\x03 \x03(\x0b\x32\".service.LoggedMetrics.ValuesEntry\x1a-\n\x0bValuesEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\x01:\x02\x38\x01\x32\xdd\x06\n\x06\x44\x61\x65mon\x12V\n\x10\x43reateExperiment\x12 .service.CreateExperimentRequest\x1a\x1e.service.CreateExperimentReply\"\x00\x12V\n\x10\x43reateCheckpoint\x12 .service.CreateCheckpointRequest\x1a\x1e.service.CreateCheckpointReply\"\x00\x12P\n\x0eSaveExperiment\x12\x1e.service.SaveExperimentRequest\x1a\x1c.service.SaveExperimentReply\"\x00\x12P\n\x0eStopExperiment\x12\x1e.service.StopExperimentRequest\x1a\x1c.service.StopExperimentReply\"\x00\x12M\n\rGetExperiment\x12\x1d.service.GetExperimentRequest\x1a\x1b.service.GetExperimentReply\"\x00\x12S\n\x0fListExperiments\x12\x1f.service.ListExperimentsRequest\x1a\x1d.service.ListExperimentsReply\"\x00\x12V\n\x10\x44\x65leteExperiment\x12 .service.DeleteExperimentRequest\x1a\x1e.service.DeleteExperimentReply\"\x00\x12\\\n\x12\x43heckoutCheckpoint\x12\".service.CheckoutCheckpointRequest\x1a .service.CheckoutCheckpointReply\"\x00\x12_\n\x13GetExperimentStatus\x12#.service.GetExperimentStatusRequest\x1a!.service.GetExperimentStatusReply\"\x00\x12\x44\n\nLogMetrics\x12\x1a.service.LogMetricsRequest\x1a\x18.service.LogMetricsReply\"\x00\x42\x31Z/github.com/replicate/replicate/go/pkg/servicepbb\x06proto3'
   ,
   dependencies=[google_dot_protobuf_dot_timestamp__pb2.DESCRIPTOR,])
 
@@ -46,8 +46,8 @@ _GETEXPERIMENTSTATUSREPLY_STATUS = _descriptor.EnumDescriptor(
   ],
   containing_type=None,
   serialized_options=None,
-  serialized_start=1143,
-  serialized_end=1177,
+  serialized_start=1179,
+  serialized_end=1213,
 )
 _sym_db.RegisterEnumDescriptor(_GETEXPERIMENTSTATUSREPLY_STATUS)
 
@@ -71,8 +71,8 @@ _PRIMARYMETRIC_GOAL = _descriptor.EnumDescriptor(
   ],
   containing_type=None,
   serialized_options=None,
-  serialized_start=2057,
-  serialized_end=2091,
+  serialized_start=2838,
+  serialized_end=2872,
 )
 _sym_db.RegisterEnumDescriptor(_PRIMARYMETRIC_GOAL)
 
@@ -106,6 +106,13 @@ _CREATEEXPERIMENTREQUEST = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='name', full_name='service.CreateExperimentRequest.name', index=3,
+      number=4, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
   ],
   extensions=[
   ],
@@ -119,7 +126,7 @@ _CREATEEXPERIMENTREQUEST = _descriptor.Descriptor(
   oneofs=[
   ],
   serialized_start=61,
-  serialized_end=168,
+  serialized_end=182,
 )
 
 
@@ -150,8 +157,8 @@ _CREATEEXPERIMENTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=170,
-  serialized_end=234,
+  serialized_start=184,
+  serialized_end=248,
 )
 
 
@@ -177,6 +184,13 @@ _CREATECHECKPOINTREQUEST = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='experimentID', full_name='service.CreateCheckpointRequest.experimentID', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
   ],
   extensions=[
   ],
@@ -189,8 +203,8 @@ _CREATECHECKPOINTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=236,
-  serialized_end=317,
+  serialized_start=250,
+  serialized_end=353,
 )
 
 
@@ -221,8 +235,8 @@ _CREATECHECKPOINTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=319,
-  serialized_end=383,
+  serialized_start=355,
+  serialized_end=419,
 )
 
 
@@ -260,8 +274,8 @@ _SAVEEXPERIMENTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=385,
-  serialized_end=464,
+  serialized_start=421,
+  serialized_end=500,
 )
 
 
@@ -292,8 +306,8 @@ _SAVEEXPERIMENTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=466,
-  serialized_end=528,
+  serialized_start=502,
+  serialized_end=564,
 )
 
 
@@ -324,8 +338,8 @@ _STOPEXPERIMENTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=530,
-  serialized_end=575,
+  serialized_start=566,
+  serialized_end=611,
 )
 
 
@@ -349,8 +363,8 @@ _STOPEXPERIMENTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=577,
-  serialized_end=598,
+  serialized_start=613,
+  serialized_end=634,
 )
 
 
@@ -381,8 +395,8 @@ _GETEXPERIMENTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=600,
-  serialized_end=650,
+  serialized_start=636,
+  serialized_end=686,
 )
 
 
@@ -413,8 +427,8 @@ _GETEXPERIMENTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=652,
-  serialized_end=713,
+  serialized_start=688,
+  serialized_end=749,
 )
 
 
@@ -438,8 +452,8 @@ _LISTEXPERIMENTSREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=715,
-  serialized_end=739,
+  serialized_start=751,
+  serialized_end=775,
 )
 
 
@@ -470,8 +484,8 @@ _LISTEXPERIMENTSREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=741,
-  serialized_end=805,
+  serialized_start=777,
+  serialized_end=841,
 )
 
 
@@ -502,8 +516,8 @@ _DELETEEXPERIMENTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=807,
-  serialized_end=854,
+  serialized_start=843,
+  serialized_end=890,
 )
 
 
@@ -527,8 +541,8 @@ _DELETEEXPERIMENTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=856,
-  serialized_end=879,
+  serialized_start=892,
+  serialized_end=915,
 )
 
 
@@ -573,8 +587,8 @@ _CHECKOUTCHECKPOINTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=881,
-  serialized_end=976,
+  serialized_start=917,
+  serialized_end=1012,
 )
 
 
@@ -598,8 +612,8 @@ _CHECKOUTCHECKPOINTREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=978,
-  serialized_end=1003,
+  serialized_start=1014,
+  serialized_end=1039,
 )
 
 
@@ -630,8 +644,8 @@ _GETEXPERIMENTSTATUSREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1005,
-  serialized_end=1055,
+  serialized_start=1041,
+  serialized_end=1091,
 )
 
 
@@ -663,8 +677,8 @@ _GETEXPERIMENTSTATUSREPLY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1057,
-  serialized_end=1177,
+  serialized_start=1093,
+  serialized_end=1213,
 )
 
 
@@ -702,8 +716,8 @@ _EXPERIMENT_PARAMSENTRY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1548,
-  serialized_end=1613,
+  serialized_start=1936,
+  serialized_end=2001,
 )
 
 _EXPERIMENT_PYTHONPACKAGESENTRY = _descriptor.Descriptor(
@@ -740,8 +754,84 @@ _EXPERIMENT_PYTHONPACKAGESENTRY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1615,
-  serialized_end=1668,
+  serialized_start=2003,
+  serialized_end=2056,
+)
+
+_EXPERIMENT_ENVIRONMENTENTRY = _descriptor.Descriptor(
+  name='EnvironmentEntry',
+  full_name='service.Experiment.EnvironmentEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='service.Experiment.EnvironmentEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='service.Experiment.EnvironmentEntry.value', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=b'8\001',
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2058,
+  serialized_end=2108,
+)
+
+_EXPERIMENT_SEEDSENTRY = _descriptor.Descriptor(
+  name='SeedsEntry',
+  full_name='service.Experiment.SeedsEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='service.Experiment.SeedsEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='service.Experiment.SeedsEntry.value', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=b'8\001',
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2110,
+  serialized_end=2154,
 )
 
 _EXPERIMENT = _descriptor.Descriptor(
@@ -836,10 +926,73 @@ _EXPERIMENT = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='name', full_name='service.Experiment.name', index=12,
+      number=13, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='dvcOutputs', full_name='service.Experiment.dvcOutputs', index=13,
+      number=14, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='datasets', full_name='service.Experiment.datasets', index=14,
+      number=15, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='environment', full_name='service.Experiment.environment', index=15,
+      number=16, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='seeds', full_name='service.Experiment.seeds', index=16,
+      number=17, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='hostEnvironment', full_name='service.Experiment.hostEnvironment', index=17,
+      number=18, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='sweep', full_name='service.Experiment.sweep', index=18,
+      number=19, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='storagePath', full_name='service.Experiment.storagePath', index=19,
+      number=20, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='alerts', full_name='service.Experiment.alerts', index=20,
+      number=21, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
   ],
   extensions=[
   ],
-  nested_types=[_EXPERIMENT_PARAMSENTRY, _EXPERIMENT_PYTHONPACKAGESENTRY, ],
+  nested_types=[_EXPERIMENT_PARAMSENTRY, _EXPERIMENT_PYTHONPACKAGESENTRY, _EXPERIMENT_ENVIRONMENTENTRY, _EXPERIMENT_SEEDSENTRY, ],
   enum_types=[
   ],
   serialized_options=None,
@@ -848,8 +1001,8 @@ _EXPERIMENT = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1180,
-  serialized_end=1668,
+  serialized_start=1216,
+  serialized_end=2154,
 )
 
 
@@ -887,8 +1040,8 @@ _CONFIG = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1670,
-  serialized_end=1715,
+  serialized_start=2156,
+  serialized_end=2201,
 )
 
 
@@ -926,8 +1079,84 @@ _CHECKPOINT_METRICSENTRY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1915,
-  serialized_end=1981,
+  serialized_start=2582,
+  serialized_end=2648,
+)
+
+_CHECKPOINT_REFERENCESENTRY = _descriptor.Descriptor(
+  name='ReferencesEntry',
+  full_name='service.Checkpoint.ReferencesEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='service.Checkpoint.ReferencesEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='service.Checkpoint.ReferencesEntry.value', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=b'8\001',
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2650,
+  serialized_end=2699,
+)
+
+_CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY = _descriptor.Descriptor(
+  name='ReferencedStoragePathsEntry',
+  full_name='service.Checkpoint.ReferencedStoragePathsEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='service.Checkpoint.ReferencedStoragePathsEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='service.Checkpoint.ReferencedStoragePathsEntry.value', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=b'8\001',
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2701,
+  serialized_end=2762,
 )
 
 _CHECKPOINT = _descriptor.Descriptor(
@@ -980,10 +1209,38 @@ _CHECKPOINT = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='references', full_name='service.Checkpoint.references', index=6,
+      number=7, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='chunkedFiles', full_name='service.Checkpoint.chunkedFiles', index=7,
+      number=8, type=9, cpp_type=9, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='storagePath', full_name='service.Checkpoint.storagePath', index=8,
+      number=9, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='referencedStoragePaths', full_name='service.Checkpoint.referencedStoragePaths', index=9,
+      number=10, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
   ],
   extensions=[
   ],
-  nested_types=[_CHECKPOINT_METRICSENTRY, ],
+  nested_types=[_CHECKPOINT_METRICSENTRY, _CHECKPOINT_REFERENCESENTRY, _CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY, ],
   enum_types=[
   ],
   serialized_options=None,
@@ -992,8 +1249,8 @@ _CHECKPOINT = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1718,
-  serialized_end=1981,
+  serialized_start=2204,
+  serialized_end=2762,
 )
 
 
@@ -1032,8 +1289,8 @@ _PRIMARYMETRIC = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1983,
-  serialized_end=2091,
+  serialized_start=2764,
+  serialized_end=2872,
 )
 
 
@@ -1097,66 +1354,497 @@ _PARAMTYPE = _descriptor.Descriptor(
       create_key=_descriptor._internal_create_key,
     fields=[]),
   ],
-  serialized_start=2094,
-  serialized_end=2227,
+  serialized_start=2875,
+  serialized_end=3008,
 )
 
-_CREATEEXPERIMENTREQUEST.fields_by_name['experiment'].message_type = _EXPERIMENT
-_CREATEEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
-_CREATECHECKPOINTREQUEST.fields_by_name['checkpoint'].message_type = _CHECKPOINT
-_CREATECHECKPOINTREPLY.fields_by_name['checkpoint'].message_type = _CHECKPOINT
-_SAVEEXPERIMENTREQUEST.fields_by_name['experiment'].message_type = _EXPERIMENT
-_SAVEEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
-_GETEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
-_LISTEXPERIMENTSREPLY.fields_by_name['experiments'].message_type = _EXPERIMENT
-_GETEXPERIMENTSTATUSREPLY.fields_by_name['status'].enum_type = _GETEXPERIMENTSTATUSREPLY_STATUS
-_GETEXPERIMENTSTATUSREPLY_STATUS.containing_type = _GETEXPERIMENTSTATUSREPLY
-_EXPERIMENT_PARAMSENTRY.fields_by_name['value'].message_type = _PARAMTYPE
-_EXPERIMENT_PARAMSENTRY.containing_type = _EXPERIMENT
-_EXPERIMENT_PYTHONPACKAGESENTRY.containing_type = _EXPERIMENT
-_EXPERIMENT.fields_by_name['created'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
-_EXPERIMENT.fields_by_name['params'].message_type = _EXPERIMENT_PARAMSENTRY
-_EXPERIMENT.fields_by_name['config'].message_type = _CONFIG
-_EXPERIMENT.fields_by_name['pythonPackages'].message_type = _EXPERIMENT_PYTHONPACKAGESENTRY
-_EXPERIMENT.fields_by_name['checkpoints'].message_type = _CHECKPOINT
-_CHECKPOINT_METRICSENTRY.fields_by_name['value'].message_type = _PARAMTYPE
-_CHECKPOINT_METRICSENTRY.containing_type = _CHECKPOINT
-_CHECKPOINT.fields_by_name['created'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
-_CHECKPOINT.fields_by_name['metrics'].message_type = _CHECKPOINT_METRICSENTRY
-_CHECKPOINT.fields_by_name['primaryMetric'].message_type = _PRIMARYMETRIC
-_PRIMARYMETRIC.fields_by_name['goal'].enum_type = _PRIMARYMETRIC_GOAL
-_PRIMARYMETRIC_GOAL.containing_type = _PRIMARYMETRIC
-_PARAMTYPE.oneofs_by_name['value'].fields.append(
-  _PARAMTYPE.fields_by_name['boolValue'])
-_PARAMTYPE.fields_by_name['boolValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
-_PARAMTYPE.oneofs_by_name['value'].fields.append(
-  _PARAMTYPE.fields_by_name['intValue'])
-_PARAMTYPE.fields_by_name['intValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
-_PARAMTYPE.oneofs_by_name['value'].fields.append(
-  _PARAMTYPE.fields_by_name['floatValue'])
-_PARAMTYPE.fields_by_name['floatValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
-_PARAMTYPE.oneofs_by_name['value'].fields.append(
-  _PARAMTYPE.fields_by_name['stringValue'])
-_PARAMTYPE.fields_by_name['stringValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
-_PARAMTYPE.oneofs_by_name['value'].fields.append(
-  _PARAMTYPE.fields_by_name['objectValueJson'])
-_PARAMTYPE.fields_by_name['objectValueJson'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
-DESCRIPTOR.message_types_by_name['CreateExperimentRequest'] = _CREATEEXPERIMENTREQUEST
-DESCRIPTOR.message_types_by_name['CreateExperimentReply'] = _CREATEEXPERIMENTREPLY
-DESCRIPTOR.message_types_by_name['CreateCheckpointRequest'] = _CREATECHECKPOINTREQUEST
-DESCRIPTOR.message_types_by_name['CreateCheckpointReply'] = _CREATECHECKPOINTREPLY
-DESCRIPTOR.message_types_by_name['SaveExperimentRequest'] = _SAVEEXPERIMENTREQUEST
-DESCRIPTOR.message_types_by_name['SaveExperimentReply'] = _SAVEEXPERIMENTREPLY
-DESCRIPTOR.message_types_by_name['StopExperimentRequest'] = _STOPEXPERIMENTREQUEST
-DESCRIPTOR.message_types_by_name['StopExperimentReply'] = _STOPEXPERIMENTREPLY
-DESCRIPTOR.message_types_by_name['GetExperimentRequest'] = _GETEXPERIMENTREQUEST
-DESCRIPTOR.message_types_by_name['GetExperimentReply'] = _GETEXPERIMENTREPLY
-DESCRIPTOR.message_types_by_name['ListExperimentsRequest'] = _LISTEXPERIMENTSREQUEST
-DESCRIPTOR.message_types_by_name['ListExperimentsReply'] = _LISTEXPERIMENTSREPLY
-DESCRIPTOR.message_types_by_name['DeleteExperimentRequest'] = _DELETEEXPERIMENTREQUEST
-DESCRIPTOR.message_types_by_name['DeleteExperimentReply'] = _DELETEEXPERIMENTREPLY
-DESCRIPTOR.message_types_by_name['CheckoutCheckpointRequest'] = _CHECKOUTCHECKPOINTREQUEST
-DESCRIPTOR.message_types_by_name['CheckoutCheckpointReply'] = _CHECKOUTCHECKPOINTREPLY
+
+_DVCOUTPUT = _descriptor.Descriptor(
+  name='DVCOutput',
+  full_name='service.DVCOutput',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='path', full_name='service.DVCOutput.path', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='md5', full_name='service.DVCOutput.md5', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='dvcFile', full_name='service.DVCOutput.dvcFile', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3010,
+  serialized_end=3065,
+)
+
+
+_DATASETFINGERPRINT = _descriptor.Descriptor(
+  name='DatasetFingerprint',
+  full_name='service.DatasetFingerprint',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='name', full_name='service.DatasetFingerprint.name', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='path', full_name='service.DatasetFingerprint.path', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='hash', full_name='service.DatasetFingerprint.hash', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='algorithm', full_name='service.DatasetFingerprint.algorithm', index=3,
+      number=4, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='size', full_name='service.DatasetFingerprint.size', index=4,
+      number=5, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='files', full_name='service.DatasetFingerprint.files', index=5,
+      number=6, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='rows', full_name='service.DatasetFingerprint.rows', index=6,
+      number=7, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='hasRows', full_name='service.DatasetFingerprint.hasRows', index=7,
+      number=8, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3068,
+  serialized_end=3209,
+)
+
+
+_HOSTENVIRONMENT = _descriptor.Descriptor(
+  name='HostEnvironment',
+  full_name='service.HostEnvironment',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='os', full_name='service.HostEnvironment.os', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='arch', full_name='service.HostEnvironment.arch', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='cudaVersion', full_name='service.HostEnvironment.cudaVersion', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3211,
+  serialized_end=3275,
+)
+
+
+_SWEEPMEMBERSHIP = _descriptor.Descriptor(
+  name='SweepMembership',
+  full_name='service.SweepMembership',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='id', full_name='service.SweepMembership.id', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='run', full_name='service.SweepMembership.run', index=1,
+      number=2, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3277,
+  serialized_end=3319,
+)
+
+
+_ALERT = _descriptor.Descriptor(
+  name='Alert',
+  full_name='service.Alert',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='name', full_name='service.Alert.name', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='message', full_name='service.Alert.message', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='checkpointID', full_name='service.Alert.checkpointID', index=2,
+      number=3, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='triggered', full_name='service.Alert.triggered', index=3,
+      number=4, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3321,
+  serialized_end=3428,
+)
+
+
+_LOGMETRICSREQUEST = _descriptor.Descriptor(
+  name='LogMetricsRequest',
+  full_name='service.LogMetricsRequest',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='experimentID', full_name='service.LogMetricsRequest.experimentID', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='metrics', full_name='service.LogMetricsRequest.metrics', index=1,
+      number=2, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3430,
+  serialized_end=3512,
+)
+
+
+_LOGMETRICSREPLY = _descriptor.Descriptor(
+  name='LogMetricsReply',
+  full_name='service.LogMetricsReply',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3514,
+  serialized_end=3531,
+)
+
+
+_LOGGEDMETRICS_VALUESENTRY = _descriptor.Descriptor(
+  name='ValuesEntry',
+  full_name='service.LoggedMetrics.ValuesEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='service.LoggedMetrics.ValuesEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='service.LoggedMetrics.ValuesEntry.value', index=1,
+      number=2, type=1, cpp_type=5, label=1,
+      has_default_value=False, default_value=float(0),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=b'8\001',
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3664,
+  serialized_end=3709,
+)
+
+_LOGGEDMETRICS = _descriptor.Descriptor(
+  name='LoggedMetrics',
+  full_name='service.LoggedMetrics',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='step', full_name='service.LoggedMetrics.step', index=0,
+      number=1, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='timestamp', full_name='service.LoggedMetrics.timestamp', index=1,
+      number=2, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+    _descriptor.FieldDescriptor(
+      name='values', full_name='service.LoggedMetrics.values', index=2,
+      number=3, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[_LOGGEDMETRICS_VALUESENTRY, ],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=3534,
+  serialized_end=3709,
+)
+
+_CREATEEXPERIMENTREQUEST.fields_by_name['experiment'].message_type = _EXPERIMENT
+_CREATEEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
+_CREATECHECKPOINTREQUEST.fields_by_name['checkpoint'].message_type = _CHECKPOINT
+_CREATECHECKPOINTREPLY.fields_by_name['checkpoint'].message_type = _CHECKPOINT
+_SAVEEXPERIMENTREQUEST.fields_by_name['experiment'].message_type = _EXPERIMENT
+_SAVEEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
+_GETEXPERIMENTREPLY.fields_by_name['experiment'].message_type = _EXPERIMENT
+_LISTEXPERIMENTSREPLY.fields_by_name['experiments'].message_type = _EXPERIMENT
+_GETEXPERIMENTSTATUSREPLY.fields_by_name['status'].enum_type = _GETEXPERIMENTSTATUSREPLY_STATUS
+_GETEXPERIMENTSTATUSREPLY_STATUS.containing_type = _GETEXPERIMENTSTATUSREPLY
+_EXPERIMENT_PARAMSENTRY.fields_by_name['value'].message_type = _PARAMTYPE
+_EXPERIMENT_PARAMSENTRY.containing_type = _EXPERIMENT
+_EXPERIMENT_PYTHONPACKAGESENTRY.containing_type = _EXPERIMENT
+_EXPERIMENT_ENVIRONMENTENTRY.containing_type = _EXPERIMENT
+_EXPERIMENT_SEEDSENTRY.containing_type = _EXPERIMENT
+_EXPERIMENT.fields_by_name['created'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_EXPERIMENT.fields_by_name['params'].message_type = _EXPERIMENT_PARAMSENTRY
+_EXPERIMENT.fields_by_name['config'].message_type = _CONFIG
+_EXPERIMENT.fields_by_name['pythonPackages'].message_type = _EXPERIMENT_PYTHONPACKAGESENTRY
+_EXPERIMENT.fields_by_name['checkpoints'].message_type = _CHECKPOINT
+_EXPERIMENT.fields_by_name['dvcOutputs'].message_type = _DVCOUTPUT
+_EXPERIMENT.fields_by_name['datasets'].message_type = _DATASETFINGERPRINT
+_EXPERIMENT.fields_by_name['environment'].message_type = _EXPERIMENT_ENVIRONMENTENTRY
+_EXPERIMENT.fields_by_name['seeds'].message_type = _EXPERIMENT_SEEDSENTRY
+_EXPERIMENT.fields_by_name['hostEnvironment'].message_type = _HOSTENVIRONMENT
+_EXPERIMENT.fields_by_name['sweep'].message_type = _SWEEPMEMBERSHIP
+_EXPERIMENT.fields_by_name['alerts'].message_type = _ALERT
+_CHECKPOINT_METRICSENTRY.fields_by_name['value'].message_type = _PARAMTYPE
+_CHECKPOINT_METRICSENTRY.containing_type = _CHECKPOINT
+_CHECKPOINT_REFERENCESENTRY.containing_type = _CHECKPOINT
+_CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY.containing_type = _CHECKPOINT
+_CHECKPOINT.fields_by_name['created'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_CHECKPOINT.fields_by_name['metrics'].message_type = _CHECKPOINT_METRICSENTRY
+_CHECKPOINT.fields_by_name['primaryMetric'].message_type = _PRIMARYMETRIC
+_CHECKPOINT.fields_by_name['references'].message_type = _CHECKPOINT_REFERENCESENTRY
+_CHECKPOINT.fields_by_name['referencedStoragePaths'].message_type = _CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY
+_PRIMARYMETRIC.fields_by_name['goal'].enum_type = _PRIMARYMETRIC_GOAL
+_PRIMARYMETRIC_GOAL.containing_type = _PRIMARYMETRIC
+_PARAMTYPE.oneofs_by_name['value'].fields.append(
+  _PARAMTYPE.fields_by_name['boolValue'])
+_PARAMTYPE.fields_by_name['boolValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
+_PARAMTYPE.oneofs_by_name['value'].fields.append(
+  _PARAMTYPE.fields_by_name['intValue'])
+_PARAMTYPE.fields_by_name['intValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
+_PARAMTYPE.oneofs_by_name['value'].fields.append(
+  _PARAMTYPE.fields_by_name['floatValue'])
+_PARAMTYPE.fields_by_name['floatValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
+_PARAMTYPE.oneofs_by_name['value'].fields.append(
+  _PARAMTYPE.fields_by_name['stringValue'])
+_PARAMTYPE.fields_by_name['stringValue'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
+_PARAMTYPE.oneofs_by_name['value'].fields.append(
+  _PARAMTYPE.fields_by_name['objectValueJson'])
+_PARAMTYPE.fields_by_name['objectValueJson'].containing_oneof = _PARAMTYPE.oneofs_by_name['value']
+_ALERT.fields_by_name['triggered'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_LOGMETRICSREQUEST.fields_by_name['metrics'].message_type = _LOGGEDMETRICS
+_LOGGEDMETRICS_VALUESENTRY.containing_type = _LOGGEDMETRICS
+_LOGGEDMETRICS.fields_by_name['timestamp'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_LOGGEDMETRICS.fields_by_name['values'].message_type = _LOGGEDMETRICS_VALUESENTRY
+DESCRIPTOR.message_types_by_name['CreateExperimentRequest'] = _CREATEEXPERIMENTREQUEST
+DESCRIPTOR.message_types_by_name['CreateExperimentReply'] = _CREATEEXPERIMENTREPLY
+DESCRIPTOR.message_types_by_name['CreateCheckpointRequest'] = _CREATECHECKPOINTREQUEST
+DESCRIPTOR.message_types_by_name['CreateCheckpointReply'] = _CREATECHECKPOINTREPLY
+DESCRIPTOR.message_types_by_name['SaveExperimentRequest'] = _SAVEEXPERIMENTREQUEST
+DESCRIPTOR.message_types_by_name['SaveExperimentReply'] = _SAVEEXPERIMENTREPLY
+DESCRIPTOR.message_types_by_name['StopExperimentRequest'] = _STOPEXPERIMENTREQUEST
+DESCRIPTOR.message_types_by_name['StopExperimentReply'] = _STOPEXPERIMENTREPLY
+DESCRIPTOR.message_types_by_name['GetExperimentRequest'] = _GETEXPERIMENTREQUEST
+DESCRIPTOR.message_types_by_name['GetExperimentReply'] = _GETEXPERIMENTREPLY
+DESCRIPTOR.message_types_by_name['ListExperimentsRequest'] = _LISTEXPERIMENTSREQUEST
+DESCRIPTOR.message_types_by_name['ListExperimentsReply'] = _LISTEXPERIMENTSREPLY
+DESCRIPTOR.message_types_by_name['DeleteExperimentRequest'] = _DELETEEXPERIMENTREQUEST
+DESCRIPTOR.message_types_by_name['DeleteExperimentReply'] = _DELETEEXPERIMENTREPLY
+DESCRIPTOR.message_types_by_name['CheckoutCheckpointRequest'] = _CHECKOUTCHECKPOINTREQUEST
+DESCRIPTOR.message_types_by_name['CheckoutCheckpointReply'] = _CHECKOUTCHECKPOINTREPLY
 DESCRIPTOR.message_types_by_name['GetExperimentStatusRequest'] = _GETEXPERIMENTSTATUSREQUEST
 DESCRIPTOR.message_types_by_name['GetExperimentStatusReply'] = _GETEXPERIMENTSTATUSREPLY
 DESCRIPTOR.message_types_by_name['Experiment'] = _EXPERIMENT
@@ -1164,6 +1852,14 @@ DESCRIPTOR.message_types_by_name['Config'] = _CONFIG
 DESCRIPTOR.message_types_by_name['Checkpoint'] = _CHECKPOINT
 DESCRIPTOR.message_types_by_name['PrimaryMetric'] = _PRIMARYMETRIC
 DESCRIPTOR.message_types_by_name['ParamType'] = _PARAMTYPE
+DESCRIPTOR.message_types_by_name['DVCOutput'] = _DVCOUTPUT
+DESCRIPTOR.message_types_by_name['DatasetFingerprint'] = _DATASETFINGERPRINT
+DESCRIPTOR.message_types_by_name['HostEnvironment'] = _HOSTENVIRONMENT
+DESCRIPTOR.message_types_by_name['SweepMembership'] = _SWEEPMEMBERSHIP
+DESCRIPTOR.message_types_by_name['Alert'] = _ALERT
+DESCRIPTOR.message_types_by_name['LogMetricsRequest'] = _LOGMETRICSREQUEST
+DESCRIPTOR.message_types_by_name['LogMetricsReply'] = _LOGMETRICSREPLY
+DESCRIPTOR.message_types_by_name['LoggedMetrics'] = _LOGGEDMETRICS
 _sym_db.RegisterFileDescriptor(DESCRIPTOR)
 
 CreateExperimentRequest = _reflection.GeneratedProtocolMessageType('CreateExperimentRequest', (_message.Message,), {
@@ -1307,6 +2003,20 @@ Experiment = _reflection.GeneratedProtocolMessageType('Experiment', (_message.Me
     # @@protoc_insertion_point(class_scope:service.Experiment.PythonPackagesEntry)
     })
   ,
+
+  'EnvironmentEntry' : _reflection.GeneratedProtocolMessageType('EnvironmentEntry', (_message.Message,), {
+    'DESCRIPTOR' : _EXPERIMENT_ENVIRONMENTENTRY,
+    '__module__' : 'replicate_pb2'
+    # @@protoc_insertion_point(class_scope:service.Experiment.EnvironmentEntry)
+    })
+  ,
+
+  'SeedsEntry' : _reflection.GeneratedProtocolMessageType('SeedsEntry', (_message.Message,), {
+    'DESCRIPTOR' : _EXPERIMENT_SEEDSENTRY,
+    '__module__' : 'replicate_pb2'
+    # @@protoc_insertion_point(class_scope:service.Experiment.SeedsEntry)
+    })
+  ,
   'DESCRIPTOR' : _EXPERIMENT,
   '__module__' : 'replicate_pb2'
   # @@protoc_insertion_point(class_scope:service.Experiment)
@@ -1314,6 +2024,8 @@ Experiment = _reflection.GeneratedProtocolMessageType('Experiment', (_message.Me
 _sym_db.RegisterMessage(Experiment)
 _sym_db.RegisterMessage(Experiment.ParamsEntry)
 _sym_db.RegisterMessage(Experiment.PythonPackagesEntry)
+_sym_db.RegisterMessage(Experiment.EnvironmentEntry)
+_sym_db.RegisterMessage(Experiment.SeedsEntry)
 
 Config = _reflection.GeneratedProtocolMessageType('Config', (_message.Message,), {
   'DESCRIPTOR' : _CONFIG,
@@ -1330,12 +2042,28 @@ Checkpoint = _reflection.GeneratedProtocolMessageType('Checkpoint', (_message.Me
     # @@protoc_insertion_point(class_scope:service.Checkpoint.MetricsEntry)
     })
   ,
+
+  'ReferencesEntry' : _reflection.GeneratedProtocolMessageType('ReferencesEntry', (_message.Message,), {
+    'DESCRIPTOR' : _CHECKPOINT_REFERENCESENTRY,
+    '__module__' : 'replicate_pb2'
+    # @@protoc_insertion_point(class_scope:service.Checkpoint.ReferencesEntry)
+    })
+  ,
+
+  'ReferencedStoragePathsEntry' : _reflection.GeneratedProtocolMessageType('ReferencedStoragePathsEntry', (_message.Message,), {
+    'DESCRIPTOR' : _CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY,
+    '__module__' : 'replicate_pb2'
+    # @@protoc_insertion_point(class_scope:service.Checkpoint.ReferencedStoragePathsEntry)
+    })
+  ,
   'DESCRIPTOR' : _CHECKPOINT,
   '__module__' : 'replicate_pb2'
   # @@protoc_insertion_point(class_scope:service.Checkpoint)
   })
 _sym_db.RegisterMessage(Checkpoint)
 _sym_db.RegisterMessage(Checkpoint.MetricsEntry)
+_sym_db.RegisterMessage(Checkpoint.ReferencesEntry)
+_sym_db.RegisterMessage(Checkpoint.ReferencedStoragePathsEntry)
 
 PrimaryMetric = _reflection.GeneratedProtocolMessageType('PrimaryMetric', (_message.Message,), {
   'DESCRIPTOR' : _PRIMARYMETRIC,
@@ -1351,11 +2079,80 @@ ParamType = _reflection.GeneratedProtocolMessageType('ParamType', (_message.Mess
   })
 _sym_db.RegisterMessage(ParamType)
 
+DVCOutput = _reflection.GeneratedProtocolMessageType('DVCOutput', (_message.Message,), {
+  'DESCRIPTOR' : _DVCOUTPUT,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.DVCOutput)
+  })
+_sym_db.RegisterMessage(DVCOutput)
+
+DatasetFingerprint = _reflection.GeneratedProtocolMessageType('DatasetFingerprint', (_message.Message,), {
+  'DESCRIPTOR' : _DATASETFINGERPRINT,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.DatasetFingerprint)
+  })
+_sym_db.RegisterMessage(DatasetFingerprint)
+
+HostEnvironment = _reflection.GeneratedProtocolMessageType('HostEnvironment', (_message.Message,), {
+  'DESCRIPTOR' : _HOSTENVIRONMENT,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.HostEnvironment)
+  })
+_sym_db.RegisterMessage(HostEnvironment)
+
+SweepMembership = _reflection.GeneratedProtocolMessageType('SweepMembership', (_message.Message,), {
+  'DESCRIPTOR' : _SWEEPMEMBERSHIP,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.SweepMembership)
+  })
+_sym_db.RegisterMessage(SweepMembership)
+
+Alert = _reflection.GeneratedProtocolMessageType('Alert', (_message.Message,), {
+  'DESCRIPTOR' : _ALERT,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.Alert)
+  })
+_sym_db.RegisterMessage(Alert)
+
+LogMetricsRequest = _reflection.GeneratedProtocolMessageType('LogMetricsRequest', (_message.Message,), {
+  'DESCRIPTOR' : _LOGMETRICSREQUEST,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.LogMetricsRequest)
+  })
+_sym_db.RegisterMessage(LogMetricsRequest)
+
+LogMetricsReply = _reflection.GeneratedProtocolMessageType('LogMetricsReply', (_message.Message,), {
+  'DESCRIPTOR' : _LOGMETRICSREPLY,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.LogMetricsReply)
+  })
+_sym_db.RegisterMessage(LogMetricsReply)
+
+LoggedMetrics = _reflection.GeneratedProtocolMessageType('LoggedMetrics', (_message.Message,), {
+
+  'ValuesEntry' : _reflection.GeneratedProtocolMessageType('ValuesEntry', (_message.Message,), {
+    'DESCRIPTOR' : _LOGGEDMETRICS_VALUESENTRY,
+    '__module__' : 'replicate_pb2'
+    # @@protoc_insertion_point(class_scope:service.LoggedMetrics.ValuesEntry)
+    })
+  ,
+  'DESCRIPTOR' : _LOGGEDMETRICS,
+  '__module__' : 'replicate_pb2'
+  # @@protoc_insertion_point(class_scope:service.LoggedMetrics)
+  })
+_sym_db.RegisterMessage(LoggedMetrics)
+_sym_db.RegisterMessage(LoggedMetrics.ValuesEntry)
+
 
 DESCRIPTOR._options = None
 _EXPERIMENT_PARAMSENTRY._options = None
 _EXPERIMENT_PYTHONPACKAGESENTRY._options = None
+_EXPERIMENT_ENVIRONMENTENTRY._options = None
+_EXPERIMENT_SEEDSENTRY._options = None
 _CHECKPOINT_METRICSENTRY._options = None
+_CHECKPOINT_REFERENCESENTRY._options = None
+_CHECKPOINT_REFERENCEDSTORAGEPATHSENTRY._options = None
+_LOGGEDMETRICS_VALUESENTRY._options = None
 
 _DAEMON = _descriptor.ServiceDescriptor(
   name='Daemon',
@@ -1364,8 +2161,8 @@ _DAEMON = _descriptor.ServiceDescriptor(
   index=0,
   serialized_options=None,
   create_key=_descriptor._internal_create_key,
-  serialized_start=2230,
-  serialized_end=3021,
+  serialized_start=3712,
+  serialized_end=4573,
   methods=[
   _descriptor.MethodDescriptor(
     name='CreateExperiment',
@@ -1457,6 +2254,16 @@ _DAEMON = _descriptor.ServiceDescriptor(
     serialized_options=None,
     create_key=_descriptor._internal_create_key,
   ),
+  _descriptor.MethodDescriptor(
+    name='LogMetrics',
+    full_name='service.Daemon.LogMetrics',
+    index=9,
+    containing_service=None,
+    input_type=_LOGMETRICSREQUEST,
+    output_type=_LOGMETRICSREPLY,
+    serialized_options=None,
+    create_key=_descriptor._internal_create_key,
+  ),
 ])
 _sym_db.RegisterServiceDescriptor(_DAEMON)
 
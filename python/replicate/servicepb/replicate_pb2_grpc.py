@@ -59,6 +59,11 @@ class DaemonStub(object):
                 request_serializer=replicate__pb2.GetExperimentStatusRequest.SerializeToString,
                 response_deserializer=replicate__pb2.GetExperimentStatusReply.FromString,
                 )
+        self.LogMetrics = channel.unary_unary(
+                '/service.Daemon/LogMetrics',
+                request_serializer=replicate__pb2.LogMetricsRequest.SerializeToString,
+                response_deserializer=replicate__pb2.LogMetricsReply.FromString,
+                )
 
 
 class DaemonServicer(object):
@@ -118,6 +123,12 @@ class DaemonServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def LogMetrics(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_DaemonServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -166,6 +177,11 @@ def add_DaemonServicer_to_server(servicer, server):
                     request_deserializer=replicate__pb2.GetExperimentStatusRequest.FromString,
                     response_serializer=replicate__pb2.GetExperimentStatusReply.SerializeToString,
             ),
+            'LogMetrics': grpc.unary_unary_rpc_method_handler(
+                    servicer.LogMetrics,
+                    request_deserializer=replicate__pb2.LogMetricsRequest.FromString,
+                    response_serializer=replicate__pb2.LogMetricsReply.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'service.Daemon', rpc_method_handlers)
@@ -328,3 +344,20 @@ class Daemon(object):
             replicate__pb2.GetExperimentStatusReply.FromString,
             options, channel_credentials,
             insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
+    @staticmethod
+    def LogMetrics(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(request, target, '/service.Daemon/LogMetrics',
+            replicate__pb2.LogMetricsRequest.SerializeToString,
+            replicate__pb2.LogMetricsReply.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
@@ -27,6 +27,26 @@ from replicate.metadata import rfc3339_datetime
 from tests.factories import experiment_factory, checkpoint_factory
 
 
+def load_experiment_metadata(experiment_id):
+    """
+    Load an experiment's metadata, merged with the events that add
+    checkpoints to it while it is running.
+    """
+    with open(".replicate/metadata/experiments/{}.json".format(experiment_id)) as fh:
+        metadata = json.load(fh)
+    events_dir = ".replicate/metadata/events/{}".format(experiment_id)
+    if os.path.exists(events_dir):
+        for name in sorted(os.listdir(events_dir)):
+            if name[: -len(".json")] <= metadata.get("last_event", ""):
+                continue
+            with open(os.path.join(events_dir, name)) as fh:
+                event = json.load(fh)
+            metadata["checkpoints"] = (metadata["checkpoints"] or []) + event.get(
+                "checkpoints", []
+            )
+    return metadata
+
+
 def test_init_and_checkpoint(temp_workdir):
     with open("replicate.yaml", "w") as f:
         f.write("repository: file://.replicate/")
@@ -132,8 +152,7 @@ def test_init_and_checkpoint(temp_workdir):
     # wait in case async process tries to create a path anyway
     time.sleep(0.5)
 
-    with open(".replicate/metadata/experiments/{}.json".format(experiment.id)) as fh:
-        metadata = json.load(fh)
+    metadata = load_experiment_metadata(experiment.id)
     assert metadata["checkpoints"][-1]["id"] == checkpoint.id
     assert not os.path.exists(".replicate/checkpoints/{}.tar.gz".format(checkpoint.id))
 
@@ -183,6 +202,41 @@ def test_init_with_config_file(temp_workdir):
     experiment.stop()
 
 
+def test_init_with_name(temp_workdir):
+    with open("replicate.yaml", "w") as f:
+        f.write("repository: file://.replicate/")
+    experiment = replicate.init(name="my-run", disable_heartbeat=True)
+    assert experiment.name == "my-run"
+
+    with open(".replicate/metadata/experiments/{}.json".format(experiment.id)) as fh:
+        metadata = json.load(fh)
+    assert metadata["name"] == "my-run"
+
+    # name comes after the arguments that existed before it, so they can
+    # still be passed positionally
+    experiment = replicate.init(None, None, True)
+    assert experiment.name != "my-run"
+
+
+def test_log_metrics(temp_workdir):
+    with open("replicate.yaml", "w") as f:
+        f.write("repository: file://.replicate/")
+    experiment = replicate.init(disable_heartbeat=True)
+    experiment.log_metrics({"loss": 0.5, "accuracy": 0.7})
+    experiment.log_metrics({"loss": 0.4})
+    experiment.log_metrics({"loss": 0.2}, step=10)
+    experiment.stop()
+
+    with open(".replicate/metrics/{}.json".format(experiment.id)) as fh:
+        series = json.load(fh)["series"]
+    assert [(p["step"], p["value"]) for p in series["loss"]] == [
+        (0, 0.5),
+        (1, 0.4),
+        (10, 0.2),
+    ]
+    assert [(p["step"], p["value"]) for p in series["accuracy"]] == [(0, 0.7)]
+
+
 def test_init_without_config_file(temp_workdir):
     with pytest.raises(ConfigNotFound):
         replicate.init()
@@ -204,7 +258,7 @@ def test_project_repository_version(temp_workdir):
         assert f.read() == expected
 
     with open(".replicate/repository.json", "w") as f:
-        f.write("""{"version":2}""")
+        f.write("""{"version":4}""")
     with pytest.raises(IncompatibleRepositoryVersion):
         replicate.init()
 
@@ -70,6 +70,7 @@ def full_experiment_pb():
     return pb.Experiment(
         id="foo",
         created=pb_convert.timestamp_to_pb(t),
+        name="brave-falcon-42",
         user="myuser",
         host="myhost",
         command="mycmd",
@@ -107,6 +108,7 @@ def full_experiment(project):
         project=project,
         id="foo",
         created=t,
+        name="brave-falcon-42",
         user="myuser",
         host="myhost",
         command="mycmd",
@@ -199,3 +201,29 @@ def test_empty_experiment_to_pb():
     exp = empty_experiment(project)
     expected = empty_experiment_pb()
     assert pb_convert.experiment_to_pb(exp) == expected
+
+
+def test_logged_metrics_to_pb():
+    t = datetime.datetime(2020, 12, 7, 1, 13, 29, tzinfo=datetime.timezone.utc)
+    metrics_pb = pb_convert.logged_metrics_to_pb([(3, t, {"loss": 0.5})])
+    assert len(metrics_pb) == 1
+    assert metrics_pb[0].step == 3
+    assert metrics_pb[0].timestamp.seconds == int(t.timestamp())
+    assert dict(metrics_pb[0].values) == {"loss": 0.5}
+
+
+def test_daemon_fields_are_sent_back():
+    t = datetime.datetime(2020, 12, 7, 1, 13, 29, 192682)
+    exp_pb = empty_experiment_pb()
+    exp_pb.dvcOutputs.add(path="data/train.csv", md5="abc", dvcFile="data.dvc")
+    exp_pb.environment["CUDA_VISIBLE_DEVICES"] = "0"
+    exp_pb.hostEnvironment.os = "linux"
+    exp_pb.alerts.add(name="loss > 1", checkpointID="c1")
+    chk_pb = exp_pb.checkpoints.add(
+        id="c1", created=pb_convert.timestamp_to_pb(t), step=1
+    )
+    chk_pb.references["train.py"] = "c0"
+    chk_pb.chunkedFiles.append("model.pth")
+
+    exp = pb_convert.experiment_from_pb(Project(), exp_pb)
+    assert pb_convert.experiment_to_pb(exp) == exp_pb